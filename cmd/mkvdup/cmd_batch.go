@@ -12,29 +12,77 @@ import (
 	"github.com/stuckj/mkvdup/internal/source"
 )
 
-// sourceGroup represents a set of files sharing the same source directory.
+// sourceGroup represents a set of files sharing the same source directory
+// and Blu-ray playlist.
 type sourceGroup struct {
 	sourceDir string
-	indices   []int // indices into the manifest Files slice
+	playlist  string // playlist name ("" = whole source)
+	indices   []int  // indices into the manifest Files slice
 }
 
-// groupBySource groups batch manifest files by their SourceDir.
+// groupBySource groups batch manifest files by their SourceDir and Playlist.
 // Groups are returned in first-seen order, and file indices within each group
 // preserve their original manifest order.
 func groupBySource(files []dedup.BatchManifestFile) []sourceGroup {
+	type groupKey struct{ sourceDir, playlist string }
 	var groups []sourceGroup
-	seen := map[string]int{} // sourceDir -> index in groups
+	seen := map[groupKey]int{} // key -> index in groups
 	for i, f := range files {
-		if gi, ok := seen[f.SourceDir]; ok {
+		key := groupKey{f.SourceDir, f.Playlist}
+		if gi, ok := seen[key]; ok {
 			groups[gi].indices = append(groups[gi].indices, i)
 		} else {
-			seen[f.SourceDir] = len(groups)
-			groups = append(groups, sourceGroup{sourceDir: f.SourceDir, indices: []int{i}})
+			seen[key] = len(groups)
+			groups = append(groups, sourceGroup{sourceDir: f.SourceDir, playlist: f.Playlist, indices: []int{i}})
 		}
 	}
 	return groups
 }
 
+// resolveBatchPlaylists selects the Blu-ray playlist of each manifest file
+// that names one (or "auto"), and replaces its Playlist field by the name of
+// the selected playlist so that files muxed from the same playlist share an
+// index. Playlists are listed once per source directory. The returned slice
+// is aligned with files; entries without a playlist are nil.
+func resolveBatchPlaylists(files []dedup.BatchManifestFile) ([]*source.BlurayPlaylist, error) {
+	selected := make([]*source.BlurayPlaylist, len(files))
+	listed := map[string][]*source.BlurayPlaylist{}
+	for i := range files {
+		f := &files[i]
+		if f.Playlist == "" {
+			continue
+		}
+		playlists, ok := listed[f.SourceDir]
+		if !ok {
+			var err error
+			if playlists, err = source.ListBlurayPlaylists(f.SourceDir); err != nil {
+				return nil, fmt.Errorf("%s: list playlists: %w", f.MKV, err)
+			}
+			listed[f.SourceDir] = playlists
+		}
+
+		// An unreadable MKV picks the longest playlist; its own error is
+		// reported when the file is processed.
+		var duration time.Duration
+		var tracks []mkv.Track
+		if f.Playlist == "auto" {
+			if parser, err := mkv.NewParser(f.MKV); err == nil {
+				if parser.ParseTracksOnly() == nil {
+					duration, tracks = parser.Duration(), parser.Tracks()
+				}
+				parser.Close()
+			}
+		}
+		pl, err := selectPlaylist(playlists, f.Playlist, duration, tracks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.MKV, err)
+		}
+		selected[i] = pl
+		f.Playlist = pl.String()
+	}
+	return selected, nil
+}
+
 // codecMismatchAction controls how reportCodecMismatches handles a mismatch.
 type codecMismatchAction int
 
@@ -97,15 +145,30 @@ func reportCodecMismatches(mismatches []source.CodecMismatch, action codecMismat
 
 // createBatch processes multiple MKVs from a batch manifest.
 // Files are grouped by source directory so each source is indexed once.
-// If skipCodecMismatch is true, MKVs with codec mismatches are skipped instead of processed.
-func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch bool) error {
+// If opts.skipCodecMismatch is true, MKVs with codec mismatches are skipped instead of processed.
+// Codec mismatches are never prompted for, and matches are not checkpointed.
+// An interrupt stops the batch, removing what the file in progress wrote;
+// the files already created are skipped when the batch is run again.
+func createBatch(manifestPath string, opts createOptions) error {
 	totalStart := time.Now()
+	ctx, stop := interruptContext()
+	defer stop()
+
+	opts.nonInteractive = true
+	if err := opts.setup(); err != nil {
+		return err
+	}
 
 	manifest, err := dedup.ReadBatchManifest(manifestPath)
 	if err != nil {
 		return err
 	}
 
+	playlists, err := resolveBatchPlaylists(manifest.Files)
+	if err != nil {
+		return err
+	}
+
 	groups := groupBySource(manifest.Files)
 	multiSource := len(groups) > 1
 
@@ -132,8 +195,13 @@ func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch b
 			if len(g.indices) == 1 {
 				fileWord = "file"
 			}
-			printInfo("--- Source %d/%d: %s (%d %s) ---\n", gi+1, len(groups), g.sourceDir, len(g.indices), fileWord)
+			sourceName := g.sourceDir
+			if g.playlist != "" {
+				sourceName += " playlist " + g.playlist
+			}
+			printInfo("--- Source %d/%d: %s (%d %s) ---\n", gi+1, len(groups), sourceName, len(g.indices), fileWord)
 		}
+		playlist := playlists[g.indices[0]]
 
 		// Pre-check: skip files whose output already exists (resuming interrupted batch)
 		for _, fi := range g.indices {
@@ -145,7 +213,7 @@ func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch b
 
 		// Pre-check: detect source codecs and warn about incompatible MKVs
 		// before the expensive indexing step.
-		sourceCodecs, codecErr := source.DetectSourceCodecsFromDir(g.sourceDir)
+		sourceCodecs, codecErr := sourceCodecsFor(g.sourceDir, sourceScope{playlist: playlist})
 		if codecErr != nil {
 			if vw := verboseWriter(); vw != nil {
 				fmt.Fprintf(vw, "Note: could not detect source codecs for %s: %v\n", g.sourceDir, codecErr)
@@ -173,7 +241,7 @@ func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch b
 				}
 				mismatches := source.CheckCodecCompatibility(codecParser.Tracks(), sourceCodecs)
 				codecParser.Close()
-				if skipCodecMismatch && len(mismatches) > 0 {
+				if opts.skipCodecMismatch && len(mismatches) > 0 {
 					reportCodecMismatches(mismatches, codecMismatchSkip)
 					skipReasons[fi] = "codec mismatch"
 					continue
@@ -210,9 +278,12 @@ func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch b
 			indexLabel = fmt.Sprintf("Indexing source %d/%d...", gi+1, len(groups))
 		}
 		indexStart := time.Now()
-		indexer, index, err := buildSourceIndex(g.sourceDir, indexLabel)
+		indexer, index, err := buildSourceIndex(ctx, g.sourceDir, sourceScope{playlist: playlist}, indexLabel)
 		totalIndexDuration += time.Since(indexStart)
 		if err != nil {
+			if ctx.Err() != nil {
+				return errInterrupted
+			}
 			printWarn("  ERROR indexing %s: %v\n", g.sourceDir, err)
 			// Mark non-skipped files in this group as failed
 			for _, fi := range g.indices {
@@ -242,7 +313,11 @@ func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch b
 				printSkipStatus(results[fi])
 				continue
 			}
-			results[fi] = createDedupWithIndex(f.MKV, f.SourceDir, f.Output, f.Name, indexer, index, 1, 4, true, skipCodecMismatch)
+			results[fi] = createDedupWithIndex(ctx, f.MKV, f.SourceDir, f.Output, f.Name, indexer, index, 1, 4, opts)
+			if ctx.Err() != nil {
+				index.Close()
+				return errInterrupted
+			}
 			r := results[fi]
 			if r.Skipped {
 				printSkipStatus(r)
@@ -265,7 +340,7 @@ func createBatch(manifestPath string, warnThreshold float64, skipCodecMismatch b
 	}
 
 	// Print summary
-	printBatchSummary(results, totalIndexDuration, totalStart, warnThreshold)
+	printBatchSummary(results, totalIndexDuration, totalStart, opts.warnThreshold)
 
 	// Return error only if there were non-skipped files and all of them failed.
 	// All-skipped batches (e.g., codec mismatch) are not considered failures.
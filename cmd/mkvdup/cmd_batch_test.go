@@ -75,6 +75,24 @@ func TestGroupBySource(t *testing.T) {
 		}
 	})
 
+	t.Run("playlists of one source split", func(t *testing.T) {
+		files := []dedup.BatchManifestFile{
+			{MKV: "a.mkv", SourceDir: "/src/bd", Playlist: "00800.mpls"},
+			{MKV: "b.mkv", SourceDir: "/src/bd", Playlist: "00012.mpls"},
+			{MKV: "c.mkv", SourceDir: "/src/bd", Playlist: "00800.mpls"},
+		}
+		groups := groupBySource(files)
+		if len(groups) != 2 {
+			t.Fatalf("got %d groups, want 2", len(groups))
+		}
+		if groups[0].playlist != "00800.mpls" || !slices.Equal(groups[0].indices, []int{0, 2}) {
+			t.Errorf("group 0: playlist=%q indices=%v, want 00800.mpls [0,2]", groups[0].playlist, groups[0].indices)
+		}
+		if groups[1].playlist != "00012.mpls" || !slices.Equal(groups[1].indices, []int{1}) {
+			t.Errorf("group 1: playlist=%q indices=%v, want 00012.mpls [1]", groups[1].playlist, groups[1].indices)
+		}
+	})
+
 	t.Run("empty input", func(t *testing.T) {
 		groups := groupBySource(nil)
 		if len(groups) != 0 {
@@ -86,7 +104,7 @@ func TestGroupBySource(t *testing.T) {
 // --- batch-create command tests ---
 
 func TestCreateBatch_InvalidManifest(t *testing.T) {
-	err := createBatch("/nonexistent/batch.yaml", 75.0, false)
+	err := createBatch("/nonexistent/batch.yaml", createOptions{warnThreshold: 75.0})
 	if err == nil {
 		t.Error("expected error for nonexistent manifest")
 	}
@@ -100,7 +118,7 @@ files:
   - mkv: /nonexistent/ep1.mkv
 `)
 
-	err := createBatch(manifestPath, 75.0, false)
+	err := createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 	if err == nil {
 		t.Error("expected error for nonexistent source directory")
 	}
@@ -113,7 +131,7 @@ func TestCreateBatch_EmptyManifest(t *testing.T) {
 files: []
 `)
 
-	err := createBatch(manifestPath, 75.0, false)
+	err := createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 	if err == nil {
 		t.Error("expected error for empty files list")
 	}
@@ -135,7 +153,7 @@ func TestCreateBatch_PerFileSourceDir(t *testing.T) {
 	os.MkdirAll(filepath.Join(dir, "source1"), 0755)
 	os.MkdirAll(filepath.Join(dir, "source2"), 0755)
 
-	err := createBatch(manifestPath, 75.0, false)
+	err := createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 	// Should fail (sources exist but have no media to index)
 	if err == nil {
 		t.Error("expected error for empty source directories")
@@ -160,7 +178,7 @@ func TestCreateBatch_MultiSource_ContinuesOnIndexFailure(t *testing.T) {
 
 	// Capture stderr to verify both sources were attempted
 	stderrOutput := captureStderr(t, func() {
-		createBatch(manifestPath, 75.0, false)
+		createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 	})
 
 	// Both source directories should appear in error output
@@ -188,7 +206,7 @@ func TestCreateBatch_MultiSource_OutputHeaders(t *testing.T) {
 	os.MkdirAll(filepath.Join(dir, "source2"), 0755)
 
 	output := captureStdout(t, func() {
-		createBatch(manifestPath, 75.0, false)
+		createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 	})
 
 	// Should show multi-source header
@@ -218,7 +236,7 @@ files:
 	os.MkdirAll(filepath.Join(dir, "source"), 0755)
 
 	output := captureStdout(t, func() {
-		createBatch(manifestPath, 75.0, false)
+		createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 	})
 
 	// Single source should NOT show source group separators
@@ -418,7 +436,7 @@ files:
 	var output string
 	captureStderr(t, func() {
 		output = captureStdout(t, func() {
-			createBatch(manifestPath, 75.0, false)
+			createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 		})
 	})
 
@@ -458,7 +476,7 @@ files:
 `, dir, dir, ep1Output, dir, ep2Output))
 
 	output := captureStdout(t, func() {
-		err := createBatch(manifestPath, 75.0, false)
+		err := createBatch(manifestPath, createOptions{warnThreshold: 75.0})
 		// Should succeed (all files skipped, no errors)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"hash"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -52,6 +55,7 @@ type createResult struct {
 	DedupSize      int64
 	MatchedBytes   int64
 	UnmatchedBytes int64
+	FilledBytes    int64
 	MatchedPackets int
 	TotalPackets   int
 	IndexEntries   int
@@ -63,43 +67,78 @@ type createResult struct {
 	SkipReason     string // reason for skipping (shown in summary)
 }
 
+// sourceScope restricts a source index to part of a disc. The zero value
+// indexes the whole source.
+type sourceScope struct {
+	playlist *source.BlurayPlaylist // Blu-ray playlist whose clips are indexed
+	title    *source.DVDTitle       // DVD title whose cells are indexed
+	streams  *source.StreamFilter   // Streams indexed, for the tracks of one MKV
+}
+
 // buildSourceIndex indexes a source directory and returns the indexer and index.
 // This is the expensive step that should only happen once in batch mode.
 // The phasePrefix is shown on the progress bar (e.g., "Phase 2/6: Building source index...").
-func buildSourceIndex(sourceDir, phasePrefix string) (*source.Indexer, *source.Index, error) {
+// Indexing stops once ctx is canceled.
+func buildSourceIndex(ctx context.Context, sourceDir string, scope sourceScope, phasePrefix string) (*source.Indexer, *source.Index, error) {
 	indexer, err := source.NewIndexer(sourceDir, source.DefaultWindowSize)
 	if err != nil {
 		return nil, nil, fmt.Errorf("create indexer: %w", err)
 	}
 	indexer.SetVerboseWriter(verboseWriter())
+	indexer.SetMaxMemory(maxIndexMemory)
+	indexer.SetWorkers(indexWorkers)
+	indexer.SetPlaylist(scope.playlist)
+	indexer.SetTitle(scope.title)
+	indexer.SetStreamFilter(scope.streams)
 
-	// We don't know total size until Build starts calling back with it,
-	// so create bar with 0 and let first Update set the total.
-	bar := newProgressBar(phasePrefix, 0, "bytes")
-	err = indexer.Build(func(processed, total int64) {
-		if bar.total == 0 && total > 0 {
-			bar.total = total
-		}
-		bar.Update(processed)
-	})
+	index, err := loadOrBuildIndex(ctx, indexer, phasePrefix)
 	if err != nil {
-		bar.Cancel()
-		return nil, nil, fmt.Errorf("build index: %w", err)
+		return nil, nil, err
+	}
+	return indexer, index, nil
+}
+
+// loadOrBuildIndex builds the index of indexer, or loads it from the index
+// cache, showing progress under phasePrefix, until ctx is canceled.
+func loadOrBuildIndex(ctx context.Context, indexer *source.Indexer, phasePrefix string) (*source.Index, error) {
+	if loadCachedIndex(indexer) {
+		printInfo("%s loaded from cache\n", phasePrefix)
+	} else {
+		// We don't know total size until Build starts calling back with it,
+		// so create bar with 0 and let first Update set the total.
+		bar := newProgressBar(phasePrefix, 0, "bytes")
+		err := indexer.BuildContext(ctx, func(processed, total int64) {
+			if bar.total == 0 && total > 0 {
+				bar.total = total
+			}
+			bar.Update(processed)
+		})
+		if err != nil {
+			bar.Cancel()
+			return nil, fmt.Errorf("build index: %w", err)
+		}
+		bar.Finish()
+		saveCachedIndex(indexer)
 	}
-	bar.Finish()
 	index := indexer.Index()
-	printInfo("  Indexed %d hashes\n", len(index.HashToLocations))
+	printInfo("  Indexed %d hashes\n", index.HashCount())
 	if index.UsesESOffsets {
 		printInfo("  (Using ES-aware indexing for %v)\n", indexer.SourceType())
 	}
-
-	return indexer, index, nil
+	if index.Sorted() {
+		printInfo("  (Index exceeds the memory limit; searching it in a sorted file)\n")
+	}
+	if n := len(index.SkippedStreams); n > 0 {
+		printInfo("  (Skipped %d source %s the MKV has no track of)\n", n, plural(n, "stream", "streams"))
+	}
+	return index, nil
 }
 
 // checkCodecCompatibilityFromDir performs a lightweight codec check using only
 // the source directory (no index needed). This runs before the expensive indexing step.
-func checkCodecCompatibilityFromDir(tracks []mkv.Track, sourceDir string, nonInteractive bool) error {
-	sourceCodecs, err := source.DetectSourceCodecsFromDir(sourceDir)
+// With a playlist or title, the codecs declared for it are used instead.
+func checkCodecCompatibilityFromDir(tracks []mkv.Track, sourceDir string, scope sourceScope, nonInteractive bool) error {
+	sourceCodecs, err := sourceCodecsFor(sourceDir, scope)
 	if err != nil {
 		if vw := verboseWriter(); vw != nil {
 			fmt.Fprintf(vw, "  Note: could not detect source codecs: %v\n", err)
@@ -115,13 +154,221 @@ func checkCodecCompatibilityFromDir(tracks []mkv.Track, sourceDir string, nonInt
 	return reportCodecMismatches(mismatches, action)
 }
 
+// sourceCodecsFor returns the codecs of a source directory, or those of the
+// Blu-ray playlist or DVD title it is restricted to.
+func sourceCodecsFor(sourceDir string, scope sourceScope) (*source.SourceCodecs, error) {
+	if scope.playlist != nil {
+		return scope.playlist.Codecs, nil
+	}
+	if scope.title != nil {
+		return scope.title.Codecs, nil
+	}
+	return source.DetectSourceCodecsFromDir(sourceDir)
+}
+
+// selectPlaylist returns the playlist named by spec, or with spec "auto" the
+// one matching the MKV's duration and tracks.
+func selectPlaylist(playlists []*source.BlurayPlaylist, spec string, duration time.Duration, tracks []mkv.Track) (*source.BlurayPlaylist, error) {
+	if spec == "auto" {
+		return source.SelectBlurayPlaylist(playlists, duration, tracks)
+	}
+	return source.FindBlurayPlaylist(playlists, spec)
+}
+
+// selectTitle returns the DVD title named by spec, or with spec "auto" the
+// one an MKV was muxed from: the only title matching its duration and
+// codecs, or else the candidate in which most of the MKV's probe hashes are
+// found. Probing indexes each candidate's cells, which costs at most one
+// indexing pass over the disc.
+func selectTitle(sourceDir string, titles []*source.DVDTitle, spec, mkvPath string, duration time.Duration, tracks []mkv.Track) (*source.DVDTitle, error) {
+	if spec != "auto" {
+		return source.FindDVDTitle(titles, spec)
+	}
+	candidates, err := source.DVDTitleCandidates(titles, duration, tracks)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	if isStreamInput(mkvPath) {
+		return nil, fmt.Errorf("%d titles match the MKV, and one read from a pipe cannot be probed to choose; name the title with --title", len(candidates))
+	}
+
+	parser, err := mkv.NewParser(mkvPath)
+	if err != nil {
+		return nil, fmt.Errorf("open MKV: %w", err)
+	}
+	defer parser.Close()
+	if err := parser.Parse(nil); err != nil {
+		return nil, fmt.Errorf("parse MKV: %w", err)
+	}
+	hashes, err := probeHashesFromParser(parser, mkvPath, source.DefaultWindowSize)
+	if err != nil {
+		return nil, fmt.Errorf("probe MKV: %w", err)
+	}
+
+	// Candidates come best first, so ties keep the closer duration.
+	best, bestCount := candidates[0], -1
+	for _, t := range candidates {
+		count, err := probeTitle(sourceDir, t, hashes)
+		if err != nil {
+			return nil, fmt.Errorf("probe title %s: %w", t, err)
+		}
+		if vw := verboseWriter(); vw != nil {
+			fmt.Fprintf(vw, "  Title %s: %d/%d probe hashes matched\n", t, count, len(hashes))
+		}
+		if count > bestCount {
+			best, bestCount = t, count
+		}
+	}
+	return best, nil
+}
+
+// probeTitle indexes the cells of a DVD title and returns how many of the
+// probe hashes are found in them.
+func probeTitle(sourceDir string, title *source.DVDTitle, hashes []matcher.ProbeHash) (int, error) {
+	indexer, err := source.NewIndexer(sourceDir, source.DefaultWindowSize)
+	if err != nil {
+		return 0, fmt.Errorf("create indexer: %w", err)
+	}
+	indexer.SetTitle(title)
+	indexer.SetMaxMemory(maxIndexMemory)
+	indexer.SetWorkers(indexWorkers)
+	if !loadCachedIndex(indexer) {
+		if err := indexer.Build(nil); err != nil {
+			return 0, fmt.Errorf("build index: %w", err)
+		}
+		saveCachedIndex(indexer)
+	}
+	index := indexer.Index()
+	defer index.Close()
+	return countProbeMatches(index, hashes), nil
+}
+
+// sourceDigests computes extended checksums of source files for create,
+// remembering them so a batch hashes each source file only once.
+type sourceDigests struct {
+	algorithm string
+	sums      map[string][]byte // Absolute source path -> digest
+}
+
+// newSourceDigests returns a sourceDigests for algorithm, or nil if
+// algorithm is empty (no extended checksums).
+func newSourceDigests(algorithm string) (*sourceDigests, error) {
+	if algorithm == "" {
+		return nil, nil
+	}
+	if _, err := dedup.NewChecksumHash(algorithm); err != nil {
+		return nil, err
+	}
+	return &sourceDigests{algorithm: algorithm, sums: make(map[string][]byte)}, nil
+}
+
+// newHash returns a new hash of the configured algorithm.
+func (d *sourceDigests) newHash() hash.Hash {
+	h, _ := dedup.NewChecksumHash(d.algorithm) // Validated in newSourceDigests
+	return h
+}
+
+// sumFiles returns the digests of files under sourceDir, in order, with a
+// progress bar over the files not hashed before.
+func (d *sourceDigests) sumFiles(sourceDir string, files []source.File) ([][]byte, error) {
+	var total int64
+	pending := false
+	for _, f := range files {
+		if _, ok := d.sums[filepath.Join(sourceDir, f.RelativePath)]; !ok {
+			total += f.Size
+			pending = true
+		}
+	}
+	var bar *progressBar
+	if pending {
+		bar = newProgressBar(fmt.Sprintf("  Calculating source checksums (%s)...", d.algorithm), total, "bytes")
+		defer bar.Cancel() // clean up if we return early on error
+	}
+
+	sums := make([][]byte, len(files))
+	buf := make([]byte, 4*1024*1024)
+	var done int64
+	for i, f := range files {
+		path := filepath.Join(sourceDir, f.RelativePath)
+		if sum, ok := d.sums[path]; ok {
+			sums[i] = sum
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		h := d.newHash()
+		for {
+			n, err := file.Read(buf)
+			h.Write(buf[:n])
+			done += int64(n)
+			bar.Update(done)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("read %s: %w", f.RelativePath, err)
+			}
+		}
+		file.Close()
+		sums[i] = h.Sum(nil)
+		d.sums[path] = sums[i]
+	}
+	if bar != nil {
+		bar.Finish()
+	}
+	return sums, nil
+}
+
+// createOptions configures createDedup and createBatch, which pass it on
+// to the create of each MKV with what setup made of it.
+type createOptions struct {
+	playlist          string  // Blu-ray playlist to restrict the source to ("auto" to pick; "" = whole source)
+	title             string  // DVD title to restrict the source to ("auto" to pick; "" = whole disc)
+	checksumAlgo      string  // Algorithm of the extended checksums to store ("" = none)
+	deltaStoreDir     string  // Shared delta store to keep the delta in ("" = in the dedup file)
+	warnThreshold     float64 // Space savings, in percent, below which to warn
+	nonInteractive    bool    // Continue on a codec mismatch without prompting
+	skipCodecMismatch bool    // Skip an MKV whose codecs don't match the source instead
+	allStreams        bool    // Index every source stream, not only those of the MKV's tracks
+	checkpoint        bool    // Record the progress of matching in a checkpoint file
+	resume            bool    // Resume the checkpoint of an interrupted create
+
+	// Set up from the options above
+	digests    *sourceDigests    // Extended checksums to store (nil = none)
+	deltaStore *dedup.DeltaStore // Store to keep the delta in (nil = the dedup file)
+	matchCP    *matchCheckpoint  // Checkpoint of the match (nil = none)
+}
+
+// setup sets up the extended checksums and delta store of the options.
+func (o *createOptions) setup() error {
+	var err error
+	if o.digests, err = newSourceDigests(o.checksumAlgo); err != nil {
+		return err
+	}
+	o.deltaStore, err = openDeltaStore(o.deltaStoreDir)
+	return err
+}
+
 // createDedupWithIndex processes a single MKV using a pre-built source index.
 // It handles parsing, matching, writing, and verification.
 // phaseStart and phaseTotal control phase numbering (e.g., 3,6 for single create; 1,4 for batch).
-// If nonInteractive is true, codec mismatch warnings do not prompt the user.
-// If skipCodecMismatch is true, the result is marked as Skipped on codec mismatch instead of continuing.
-func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
-	indexer *source.Indexer, index *source.Index, phaseStart, phaseTotal int, nonInteractive, skipCodecMismatch bool) *createResult {
+// If opts.nonInteractive is true, codec mismatch warnings do not prompt the user.
+// If opts.skipCodecMismatch is true, the result is marked as Skipped on codec mismatch instead of continuing.
+// If opts.digests is non-nil, extended checksums of the MKV and source files are stored.
+// If opts.deltaStore is non-nil, the delta is kept in it instead of in the dedup file.
+// If opts.matchCP is non-nil, the progress of matching is recorded in it.
+// If the index was restricted to the MKV's streams and a track matches
+// poorly, index is closed and indexer builds the index of every stream to
+// match against.
+// Once ctx is canceled, the create stops and removes what it wrote.
+func createDedupWithIndex(ctx context.Context, mkvPath, sourceDir, outputPath, virtualName string,
+	indexer *source.Indexer, index *source.Index, phaseStart, phaseTotal int, opts createOptions) *createResult {
 	start := time.Now()
 	result := &createResult{
 		MkvPath:     mkvPath,
@@ -146,14 +393,14 @@ func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
 	sourceCodecs, codecErr := source.DetectSourceCodecs(index)
 	if codecErr == nil {
 		mismatches := source.CheckCodecCompatibility(parser.Tracks(), sourceCodecs)
-		if skipCodecMismatch && len(mismatches) > 0 {
+		if opts.skipCodecMismatch && len(mismatches) > 0 {
 			reportCodecMismatches(mismatches, codecMismatchSkip)
 			result.Skipped = true
 			result.SkipReason = "codec mismatch"
 			return result
 		}
 		action := codecMismatchPrompt
-		if nonInteractive {
+		if opts.nonInteractive {
 			action = codecMismatchContinue
 		}
 		if err := reportCodecMismatches(mismatches, action); err != nil {
@@ -162,54 +409,198 @@ func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
 		}
 	}
 
-	// Calculate MKV checksum
+	// Calculate MKV checksum, with the extended checksum in the same pass
+	var mkvDigest hash.Hash
+	if opts.digests != nil {
+		mkvDigest = opts.digests.newHash()
+	}
 	printInfo("  Calculating MKV checksum...")
-	mkvChecksum, err := calculateFileChecksum(mkvPath)
+	mkvChecksum, err := calculateFileChecksumWithProgress(mkvPath, 0, "", mkvDigest)
 	if err != nil {
 		result.Err = fmt.Errorf("calculate MKV checksum: %w", err)
 		return result
 	}
 	printInfo(" done\n")
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
 
 	// Match packets
-	m, err := matcher.NewMatcher(index)
+	orig := originalMKV{size: parser.Size(), checksum: mkvChecksum, metadata: dedup.NewMetadata(parser)}
+	m, matchResult, err := matchPackets(ctx, mkvPath, parser, index, orig, opts.matchCP, phaseLabel(1, "Matching packets..."))
 	if err != nil {
-		result.Err = fmt.Errorf("create matcher: %w", err)
+		result.Err = err
 		return result
 	}
+
+	// The index may have left out the source stream of a track, if the
+	// track's codec or channels differ from what the source declares for
+	// it. Such a track is matched again against every stream.
+	if missed := missedTracks(parser.Tracks(), parser.Packets(), index, matchResult); len(missed) > 0 {
+		for _, t := range missed {
+			printInfo("  Track %d (%s) matched %.1f%%, but %d source %s of its codec %s not indexed\n",
+				t.track.Number, t.track.CodecID, t.matched*100, len(t.skipped),
+				plural(len(t.skipped), "stream", "streams"), plural(len(t.skipped), "was", "were"))
+		}
+		// The filtered index and its match are released first, so that
+		// the full index doesn't need memory on top of them.
+		m.Close()
+		matchResult.Close()
+		index.Close()
+		indexer.SetStreamFilter(nil)
+		full, err := loadOrBuildIndex(ctx, indexer, phaseLabel(1, "Indexing all source streams..."))
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		defer full.Close()
+		index = full
+		m, matchResult, err = matchPackets(ctx, mkvPath, parser, full, orig, opts.matchCP, phaseLabel(1, "Matching packets again..."))
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
 	defer m.Close()
+	defer matchResult.Close()
+
+	// Write dedup file
+	if mkvDigest != nil {
+		orig.digest = mkvDigest.Sum(nil)
+	}
+	sourceDir, err = writeDedupFile(ctx, outputPath, sourceDir, virtualName, indexer, index, matchResult, orig,
+		opts.digests, opts.deltaStore, phaseLabel(2, "Writing dedup file..."))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// Verify reconstruction
+	verifyPrefix := phaseLabel(3, "Verifying reconstruction...")
+	outputPath = handleVerifyResult(outputPath, sourceDir, mkvPath, index, verifyPrefix, result)
+
+	result.setStats(parser.Size(), matchResult, outputPath, start)
+	return result
+}
+
+// matchPackets matches the packets of the MKV orig parsed by parser
+// against index, showing progress under label, until ctx is canceled. If
+// checkpoint is non-nil, the progress is recorded in it. The caller closes
+// the matcher and the result.
+func matchPackets(ctx context.Context, mkvPath string, parser *mkv.Parser, index *source.Index, orig originalMKV,
+	checkpoint *matchCheckpoint, label string) (*matcher.Matcher, *matcher.Result, error) {
+	m, err := matcher.NewMatcher(index)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create matcher: %w", err)
+	}
 	m.SetVerboseWriter(verboseWriter())
 
-	matchBar := newProgressBar(phaseLabel(1, "Matching packets..."), int64(len(parser.Packets())), "packets")
-	matchResult, err := m.Match(mkvPath, parser.Packets(), parser.Tracks(), func(processed, total int) {
+	cp, err := checkpoint.open(matcher.CheckpointKey(orig.size, orig.checksum, index))
+	if err != nil {
+		m.Close()
+		return nil, nil, fmt.Errorf("open checkpoint: %w", err)
+	}
+	if cp != nil {
+		defer cp.Close()
+		m.SetCheckpoint(cp)
+	}
+
+	matchBar := newProgressBar(label, int64(len(parser.Packets())), "packets")
+	matchResult, err := m.MatchContext(ctx, mkvPath, parser.Packets(), parser.Tracks(), func(processed, total int) {
 		matchBar.Update(int64(processed))
 	})
 	if err != nil {
 		matchBar.Cancel()
-		result.Err = fmt.Errorf("match: %w", err)
-		return result
+		m.Close()
+		return nil, nil, fmt.Errorf("match: %w", err)
 	}
-	defer matchResult.Close()
 	matchBar.Finish()
+	return m, matchResult, nil
+}
 
-	// Write dedup file
+// setStats populates the statistics of a created dedup file at outputPath.
+func (r *createResult) setStats(mkvSize int64, matchResult *matcher.Result, outputPath string, start time.Time) {
+	r.MkvSize = mkvSize
+	r.MatchedBytes = matchResult.MatchedBytes
+	r.UnmatchedBytes = matchResult.UnmatchedBytes
+	r.FilledBytes = matchResult.FilledBytes
+	r.MatchedPackets = matchResult.MatchedPackets
+	r.TotalPackets = matchResult.TotalPackets
+	r.IndexEntries = len(matchResult.Entries)
+
+	dedupInfo, _ := os.Stat(outputPath)
+	if dedupInfo != nil {
+		r.DedupSize = dedupInfo.Size()
+		r.Savings = float64(r.MkvSize-r.DedupSize) / float64(r.MkvSize) * 100
+	}
+	r.Duration = time.Since(start)
+}
+
+// originalMKV describes the MKV a dedup file is created from.
+type originalMKV struct {
+	size     int64
+	checksum uint64
+	digest   []byte // Extended checksum, if digests are stored
+	metadata *dedup.Metadata
+}
+
+// writeDedupFile writes the dedup file for a match result of the MKV orig,
+// and its config file. It returns the source directory recorded in them,
+// which differs from sourceDir for virtual MKV sources. The dedup file is
+// removed on error, including once ctx is canceled.
+func writeDedupFile(ctx context.Context, outputPath, sourceDir, virtualName string, indexer *source.Indexer, index *source.Index,
+	matchResult *matcher.Result, orig originalMKV, digests *sourceDigests, deltaStore *dedup.DeltaStore, writePrefix string) (string, error) {
 	writer, err := dedup.NewWriter(outputPath)
 	if err != nil {
-		result.Err = fmt.Errorf("create dedup writer: %w", err)
-		return result
+		return "", fmt.Errorf("create dedup writer: %w", err)
 	}
 	defer writer.Close()
 
-	writer.SetHeader(parser.Size(), mkvChecksum, indexer.SourceType())
+	// MKV sources that are virtual files of an mkvdup mount are recorded as
+	// the .mkvdup files behind them, which moves the recorded source directory.
+	sourceFiles := index.Files
+	if indexer.SourceType() == source.TypeMKV {
+		recordDir, resolved, err := dedup.ResolveChainedSources(sourceDir, sourceFiles)
+		if err != nil {
+			os.Remove(outputPath)
+			return "", fmt.Errorf("resolve chained sources: %w", err)
+		}
+		if recordDir != sourceDir {
+			printInfo("  Virtual MKV sources recorded via their .mkvdup files in %s\n", recordDir)
+		}
+		sourceDir, sourceFiles = recordDir, resolved
+	}
+
+	writer.SetHeader(orig.size, orig.checksum, indexer.SourceType())
 	writer.SetCreatorVersion("mkvdup " + version)
-	writer.SetSourceFiles(index.Files)
+	writer.SetDeltaCompression(true)
+	writer.SetCompactIndex(true)
+	writer.SetSourceFiles(sourceFiles)
+	writer.SetMetadata(orig.metadata)
+	if digests != nil {
+		sums, err := digests.sumFiles(sourceDir, sourceFiles)
+		if err != nil {
+			os.Remove(outputPath)
+			return "", fmt.Errorf("calculate source checksums: %w", err)
+		}
+		writer.SetExtendedChecksums(&dedup.ExtendedChecksums{
+			Algorithm: digests.algorithm,
+			Original:  orig.digest,
+			Sources:   sums,
+		})
+	}
 
 	// For sources with ES offsets, decide between V3 (convert to raw) and V4 (range maps).
 	// V4 stores ES offsets with embedded range maps for ES-to-raw translation at read time.
 	// V3 converts ES offsets to raw file offsets at write time (simpler, smaller files).
-	// V4 is used for Blu-ray (TS packet structure makes V3 impractical) and for DVDs
-	// with LPCM audio (byte-swap pairs can straddle PES boundaries, requiring contiguous
-	// ES reads that only range maps provide). Non-LPCM DVDs use V3 for fastest reads.
+	// V4 is used for Blu-ray and .ts recordings (TS packet structure makes V3
+	// impractical; this includes any DVD ISOs of a mixed multi-disc Blu-ray
+	// source), for MP4 and MKV sources (interleaved samples and blocks map
+	// compactly to range maps) and for DVDs with LPCM audio (byte-swap pairs
+	// can straddle PES boundaries, requiring contiguous ES reads that only
+	// range maps provide).
+	// Non-LPCM DVDs use V3 for fastest reads.
 	var esConverters []source.ESRangeConverter
 	if index.UsesESOffsets && len(index.ESReaders) > 0 {
 		// Check if any matched entry uses LPCM (requires range maps for correct byte-swap).
@@ -221,7 +612,8 @@ func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
 			}
 		}
 
-		useRangeMaps := indexer.SourceType() == source.TypeBluray || hasLPCM
+		sourceType := indexer.SourceType()
+		useRangeMaps := sourceType == source.TypeBluray || sourceType == source.TypeMPEGTS || sourceType == source.TypeMP4 || sourceType == source.TypeMKV || hasLPCM
 		if useRangeMaps {
 			// V4: use range maps (preserves ES offsets in entries)
 			// Only include range maps for streams actually referenced by matched entries.
@@ -304,23 +696,35 @@ func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
 
 	if err := writer.SetMatchResult(matchResult, esConverters); err != nil {
 		os.Remove(outputPath)
-		result.Err = fmt.Errorf("set match result: %w", err)
-		return result
+		return "", fmt.Errorf("set match result: %w", err)
 	}
 
 	// Pre-encode range maps (CPU-intensive) before the progress-tracked write.
 	rangeMapSize, err := writer.EncodeRangeMaps()
 	if err != nil {
 		os.Remove(outputPath)
-		result.Err = fmt.Errorf("encode range maps: %w", err)
-		return result
+		return "", fmt.Errorf("encode range maps: %w", err)
 	}
 	if rangeMapSize > 0 {
 		printInfo("  Range maps encoded: %s bytes\n", formatInt(rangeMapSize))
 	}
 
-	writeBar := newProgressBar(phaseLabel(2, "Writing dedup file..."), 0, "bytes")
-	if err := writer.WriteWithProgress(func(written, total int64) {
+	if deltaStore != nil {
+		writer.SetDeltaStore(deltaStore)
+		storeBar := newProgressBar("  Storing delta...", matchResult.DeltaSize(), "bytes")
+		if err := writer.StoreDelta(func(done, _ int64) {
+			storeBar.Update(done)
+		}); err != nil {
+			storeBar.Cancel()
+			os.Remove(outputPath)
+			return "", err
+		}
+		storeBar.Finish()
+		printInfo("  Delta stored in %s\n", deltaStore.Dir())
+	}
+
+	writeBar := newProgressBar(writePrefix, 0, "bytes")
+	if err := writer.WriteContext(ctx, func(written, total int64) {
 		if writeBar.total == 0 && total > 0 {
 			writeBar.total = total
 		}
@@ -328,8 +732,7 @@ func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
 	}); err != nil {
 		writeBar.Cancel()
 		os.Remove(outputPath)
-		result.Err = fmt.Errorf("write dedup file: %w", err)
-		return result
+		return "", fmt.Errorf("write dedup file: %w", err)
 	}
 	writeBar.Finish()
 
@@ -341,33 +744,20 @@ func createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName string,
 		printInfo("  Config: %s\n", configPath)
 	}
 
-	// Verify reconstruction
-	verifyPrefix := phaseLabel(3, "Verifying reconstruction...")
-	outputPath = handleVerifyResult(outputPath, sourceDir, mkvPath, index, verifyPrefix, result)
-
-	// Populate result
-	result.MkvSize = parser.Size()
-	result.MatchedBytes = matchResult.MatchedBytes
-	result.UnmatchedBytes = matchResult.UnmatchedBytes
-	result.MatchedPackets = matchResult.MatchedPackets
-	result.TotalPackets = matchResult.TotalPackets
-	result.IndexEntries = len(matchResult.Entries)
-
-	dedupInfo, _ := os.Stat(outputPath)
-	if dedupInfo != nil {
-		result.DedupSize = dedupInfo.Size()
-		result.Savings = float64(result.MkvSize-result.DedupSize) / float64(result.MkvSize) * 100
-	}
-	result.Duration = time.Since(start)
-
-	return result
+	return sourceDir, nil
 }
 
 // handleVerifyResult runs post-write verification and handles failures.
 // On failure: removes the config file, renames .mkvdup to .mkvdup.failed,
 // and sets result.VerifyErr. Returns the (possibly updated) outputPath.
 func handleVerifyResult(outputPath, sourceDir, mkvPath string, index *source.Index, phasePrefix string, result *createResult) string {
-	if err := verifyReconstructionFunc(outputPath, sourceDir, mkvPath, index, phasePrefix); err != nil {
+	return handleVerifyError(outputPath, verifyReconstructionFunc(outputPath, sourceDir, mkvPath, index, phasePrefix), result)
+}
+
+// handleVerifyError handles the outcome of post-write verification as
+// handleVerifyResult does.
+func handleVerifyError(outputPath string, err error, result *createResult) string {
+	if err != nil {
 		printWarn("  ERROR: Verification failed: %v\n", err)
 
 		// Remove orphaned config file (it references the pre-rename path)
@@ -397,18 +787,46 @@ func handleVerifyResult(outputPath, sourceDir, mkvPath string, index *source.Ind
 }
 
 // createDedup creates a .mkvdup file from an MKV and source directory.
-func createDedup(mkvPath, sourceDir, outputPath, virtualName string, warnThreshold float64, nonInteractive bool) error {
+// opts.playlist restricts a Blu-ray source to one playlist, and opts.title
+// a DVD source to one title. Unless opts.allStreams is set, only the
+// source streams the MKV's tracks could have come from are indexed at
+// first. With opts.checkpoint, the progress of matching is recorded in a
+// checkpoint file next to the output, and with opts.resume an earlier
+// create's checkpoint is resumed.
+// An interrupt stops the create, removing what it wrote but the checkpoint.
+func createDedup(mkvPath, sourceDir, outputPath, virtualName string, opts createOptions) error {
 	totalStart := time.Now()
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := opts.setup(); err != nil {
+		return err
+	}
 
 	// Default virtual name
 	if virtualName == "" {
 		virtualName = filepath.Base(mkvPath)
+		if mkvPath == "-" {
+			virtualName = strings.TrimSuffix(filepath.Base(outputPath), ".mkvdup")
+		}
 	}
 	// Ensure virtual name has .mkv extension
 	if !strings.HasSuffix(strings.ToLower(virtualName), ".mkv") {
 		virtualName += ".mkv"
 	}
 
+	// An MKV from a pipe is read once, while it is matched, and verified
+	// against its checksum, so it takes one phase less.
+	streamed := isStreamInput(mkvPath)
+	phaseTotal := 6
+	if streamed {
+		phaseTotal = 5
+		if opts.checkpoint || opts.resume {
+			return fmt.Errorf("--checkpoint and --resume need an MKV file, not one read from a pipe")
+		}
+	}
+	opts.matchCP = newMatchCheckpoint(outputPath, opts.checkpoint, opts.resume)
+
 	printInfoln("Creating dedup file...")
 	printInfo("  MKV:     %s\n", mkvPath)
 	printInfo("  Source:  %s\n", sourceDir)
@@ -416,37 +834,111 @@ func createDedup(mkvPath, sourceDir, outputPath, virtualName string, warnThresho
 	printInfoln()
 
 	// Phase 1: Quick codec compatibility check (only reads MKV track headers, not full file)
-	printInfo("Phase 1/6: Checking codec compatibility...")
-	codecParser, err := mkv.NewParser(mkvPath)
-	if err != nil {
-		return fmt.Errorf("open MKV: %w", err)
+	printInfo("Phase 1/%d: Checking codec compatibility...", phaseTotal)
+	var stream *mkvStream
+	var codecParser *mkv.Parser
+	var tracksErr error
+	var err error
+	if streamed {
+		// The headers are read from the pipe now; the rest waits in it
+		// until the source is indexed.
+		stream, err = openMKVStream(mkvPath, opts.digests)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		codecParser = stream.parser.Parser()
+	} else {
+		codecParser, err = mkv.NewParser(mkvPath)
+		if err != nil {
+			return fmt.Errorf("open MKV: %w", err)
+		}
+		tracksErr = codecParser.ParseTracksOnly()
+	}
+	var scope sourceScope
+	if opts.playlist != "" {
+		playlists, err := source.ListBlurayPlaylists(sourceDir)
+		if err != nil {
+			codecParser.Close()
+			return fmt.Errorf("list playlists: %w", err)
+		}
+		// A failed track parse leaves no duration or tracks, so "auto"
+		// falls back to the longest playlist.
+		scope.playlist, err = selectPlaylist(playlists, opts.playlist, codecParser.Duration(), codecParser.Tracks())
+		if err != nil {
+			codecParser.Close()
+			return err
+		}
+	}
+	if opts.title != "" {
+		titles, err := source.ListDVDTitles(sourceDir)
+		if err != nil {
+			codecParser.Close()
+			return fmt.Errorf("list titles: %w", err)
+		}
+		scope.title, err = selectTitle(sourceDir, titles, opts.title, mkvPath, codecParser.Duration(), codecParser.Tracks())
+		if err != nil {
+			codecParser.Close()
+			return err
+		}
 	}
-	if err := codecParser.ParseTracksOnly(); err != nil {
+	if tracksErr != nil {
 		// Fail open: this fast-path parser can't handle all MKV layouts.
 		// Log and continue without the pre-index codec compatibility check.
-		log.Printf("Warning: fast MKV track parsing failed for %q: %v; continuing without pre-index codec check", mkvPath, err)
+		log.Printf("Warning: fast MKV track parsing failed for %q: %v; continuing without pre-index codec check", mkvPath, tracksErr)
 		codecParser.Close()
 	} else {
-		if err := checkCodecCompatibilityFromDir(codecParser.Tracks(), sourceDir, nonInteractive); err != nil {
+		if err := checkCodecCompatibilityFromDir(codecParser.Tracks(), sourceDir, scope, opts.nonInteractive); err != nil {
 			codecParser.Close()
 			return err
 		}
+		// A streamed MKV can't be matched again against every stream if
+		// the filtered index misses some of it.
+		if !opts.allStreams && !streamed {
+			scope.streams = source.NewStreamFilter(codecParser.Tracks())
+		}
 		codecParser.Close()
 	}
 	printInfoln(" done")
+	if pl := scope.playlist; pl != nil {
+		printInfo("  Playlist: %s (%d %s, %v)\n", pl, len(pl.Clips),
+			plural(len(pl.Clips), "clip", "clips"), pl.Duration.Round(time.Second))
+	}
+	if t := scope.title; t != nil {
+		printInfo("  Title:    %s (%d %s, %v, %.2f MB of cells)\n", t, t.Chapters,
+			plural(t.Chapters, "chapter", "chapters"), t.Duration.Round(time.Second), float64(t.Size())/(1024*1024))
+	}
+	if scope.streams != nil {
+		printInfo("  Streams:  %s\n", scope.streams)
+	}
 
 	// Phase 2: Index source (expensive)
-	indexer, index, err := buildSourceIndex(sourceDir, "Phase 2/6: Building source index...")
+	indexer, index, err := buildSourceIndex(ctx, sourceDir, scope, fmt.Sprintf("Phase 2/%d: Building source index...", phaseTotal))
 	if err != nil {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
 		return err
 	}
 	defer index.Close()
 
-	// Phase 3-6: Process MKV (re-parses MKV, but parsing is fast relative to indexing)
-	result := createDedupWithIndex(mkvPath, sourceDir, outputPath, virtualName, indexer, index, 3, 6, nonInteractive, false)
+	// Phase 3 on: Process MKV (re-parses an MKV file, but parsing is fast relative to indexing)
+	var result *createResult
+	if streamed {
+		result = createDedupFromStream(ctx, stream, sourceDir, outputPath, virtualName, indexer, index, 3, phaseTotal, opts)
+	} else {
+		result = createDedupWithIndex(ctx, mkvPath, sourceDir, outputPath, virtualName, indexer, index, 3, phaseTotal, opts)
+	}
 	if result.Err != nil {
+		if opts.matchCP.kept() {
+			printWarn("Checkpoint kept in %s; run create again with --resume to continue\n", opts.matchCP.path)
+		}
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
 		return result.Err
 	}
+	opts.matchCP.remove()
 
 	// Summary
 	printInfoln()
@@ -461,6 +953,11 @@ func createDedup(mkvPath, sourceDir, outputPath, virtualName string, warnThresho
 	printInfo("Delta (unmatched):  %s bytes (%.2f MB, %.1f%%)\n",
 		formatInt(result.UnmatchedBytes), float64(result.UnmatchedBytes)/(1024*1024),
 		float64(result.UnmatchedBytes)/float64(result.MkvSize)*100)
+	if result.FilledBytes > 0 {
+		printInfo("Fill (synthesized): %s bytes (%.2f MB, %.1f%%)\n",
+			formatInt(result.FilledBytes), float64(result.FilledBytes)/(1024*1024),
+			float64(result.FilledBytes)/float64(result.MkvSize)*100)
+	}
 	printInfoln()
 
 	printInfo("Dedup file size:    %s bytes (%.2f MB)\n", formatInt(result.DedupSize), float64(result.DedupSize)/(1024*1024))
@@ -473,9 +970,9 @@ func createDedup(mkvPath, sourceDir, outputPath, virtualName string, warnThresho
 	printInfo("Index entries:      %s\n", formatInt(int64(result.IndexEntries)))
 
 	// Warning for low savings
-	if !quiet && result.Savings < warnThreshold {
+	if !quiet && result.Savings < opts.warnThreshold {
 		printInfoln()
-		printInfo("WARNING: Space savings (%.1f%%) below %.0f%%\n", result.Savings, warnThreshold)
+		printInfo("WARNING: Space savings (%.1f%%) below %.0f%%\n", result.Savings, opts.warnThreshold)
 		printInfoln("  This may indicate wrong source, transcoded MKV, or very small MKV file.")
 	}
 
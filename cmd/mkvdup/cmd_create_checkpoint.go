@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+)
+
+// errInterrupted is returned by a create stopped by SIGINT or SIGTERM.
+var errInterrupted = errors.New("interrupted")
+
+// interruptContext returns a context canceled by the first SIGINT or
+// SIGTERM, so that a create can stop cleanly. The signal is caught only
+// once: a second one ends the process at once. The returned function
+// stops catching signals.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigChan:
+			signal.Stop(sigChan)
+			printWarnln("\nInterrupted; stopping (interrupt again to exit at once)...")
+			cancel()
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigChan)
+		close(done)
+		cancel()
+	}
+}
+
+// matchCheckpoint is the checkpoint file in which a create records the
+// progress of its match, for an interrupted create to resume.
+type matchCheckpoint struct {
+	path   string
+	resume bool // Continue the checkpoint left at path by an earlier create
+}
+
+// newMatchCheckpoint returns the checkpoint of a create writing outputPath,
+// or nil if it records none.
+func newMatchCheckpoint(outputPath string, record, resume bool) *matchCheckpoint {
+	if !record && !resume {
+		return nil
+	}
+	return &matchCheckpoint{path: outputPath + ".checkpoint", resume: resume}
+}
+
+// open opens the checkpoint for a match identified by key (see
+// matcher.CheckpointKey), or returns nil if c is nil. A resumed checkpoint
+// of another match is left alone, and the match is not recorded: it may be
+// the checkpoint of the match against every source stream that follows
+// this one.
+func (c *matchCheckpoint) open(key uint64) (*matcher.Checkpoint, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if !c.resume {
+		return matcher.CreateCheckpoint(c.path, key)
+	}
+	cp, err := matcher.ResumeCheckpoint(c.path, key)
+	if errors.Is(err, matcher.ErrCheckpointMismatch) {
+		printInfo("  Checkpoint %s is of another match; not resuming it\n", c.path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cp.Finished() {
+		printInfo("  Resuming the finished match in %s\n", c.path)
+	} else if n := cp.Batches(); n > 0 {
+		printInfo("  Resuming from %s (%s packet %s matched)\n", c.path, formatInt(int64(n)), plural(n, "batch", "batches"))
+	}
+	return cp, nil
+}
+
+// remove removes the checkpoint of a create that is done with it.
+func (c *matchCheckpoint) remove() {
+	if c == nil {
+		return
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		printWarn("  Warning: failed to remove checkpoint %s: %v\n", c.path, err)
+	}
+}
+
+// kept reports whether the checkpoint of a failed create was left for it
+// to be resumed.
+func (c *matchCheckpoint) kept() bool {
+	if c == nil {
+		return false
+	}
+	_, err := os.Stat(c.path)
+	return err == nil
+}
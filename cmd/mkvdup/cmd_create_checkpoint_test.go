@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchCheckpoint(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "movie.mkvdup")
+	if c := newMatchCheckpoint(output, false, false); c != nil {
+		t.Fatalf("newMatchCheckpoint without checkpoint or resume = %+v, want nil", c)
+	}
+	var none *matchCheckpoint
+	if cp, err := none.open(1); cp != nil || err != nil {
+		t.Errorf("open of no checkpoint = %v, %v", cp, err)
+	}
+
+	c := newMatchCheckpoint(output, true, false)
+	if c.path != output+".checkpoint" {
+		t.Errorf("checkpoint path = %q", c.path)
+	}
+	cp, err := c.open(1)
+	if err != nil || cp == nil {
+		t.Fatalf("open = %v, %v", cp, err)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !c.kept() {
+		t.Error("checkpoint not kept")
+	}
+
+	// Resuming the checkpoint of another match leaves it alone
+	resumed := newMatchCheckpoint(output, false, true)
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp, err := resumed.open(2); cp != nil || err != nil {
+		t.Errorf("open of another match's checkpoint = %v, %v; want nil, nil", cp, err)
+	}
+	if got, err := os.ReadFile(c.path); err != nil || string(got) != string(data) {
+		t.Error("open of another match's checkpoint changed it")
+	}
+	cp, err = resumed.open(1)
+	if err != nil || cp == nil {
+		t.Fatalf("open to resume = %v, %v", cp, err)
+	}
+	cp.Close()
+
+	resumed.remove()
+	if resumed.kept() {
+		t.Error("checkpoint kept after remove")
+	}
+	resumed.remove() // Already gone
+}
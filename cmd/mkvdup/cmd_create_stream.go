@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/mkv"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// streamWindowSize is how much of a piped MKV is matched at a time. Each
+// window is held in memory while it is matched.
+const streamWindowSize = 256 * 1024 * 1024
+
+// isStreamInput reports whether the MKV at path can only be read once, from
+// start to end: standard input ("-") or a named pipe.
+func isStreamInput(path string) bool {
+	if path == "-" {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// mkvStream is an MKV read once from a pipe, checksummed as it is read.
+type mkvStream struct {
+	path     string
+	parser   *mkv.StreamParser
+	file     *os.File
+	checksum *xxhash.Digest
+	digest   hash.Hash // Extended checksum, or nil
+}
+
+// openMKVStream opens the MKV at path ("-" for standard input) and reads
+// its headers. With digests, its extended checksum is computed too.
+func openMKVStream(path string, digests *sourceDigests) (*mkvStream, error) {
+	s := &mkvStream{path: path, file: os.Stdin, checksum: xxhash.New()}
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open MKV: %w", err)
+		}
+		s.file = f
+	}
+	var sum io.Writer = s.checksum
+	if digests != nil {
+		s.digest = digests.newHash()
+		sum = io.MultiWriter(s.checksum, s.digest)
+	}
+	s.parser = mkv.NewStreamParser(io.TeeReader(s.file, sum))
+	if err := s.parser.ReadHeaders(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("read MKV headers: %w", err)
+	}
+	return s, nil
+}
+
+// Close closes the stream's file, unless it is standard input.
+func (s *mkvStream) Close() {
+	if s.file != os.Stdin {
+		s.file.Close()
+	}
+}
+
+// original describes the MKV read so far; once the stream has ended, the
+// whole MKV.
+func (s *mkvStream) original() originalMKV {
+	orig := originalMKV{
+		size:     s.parser.Size(),
+		checksum: s.checksum.Sum64(),
+		metadata: dedup.NewMetadata(s.parser.Parser()),
+	}
+	if s.digest != nil {
+		orig.digest = s.digest.Sum(nil)
+	}
+	return orig
+}
+
+// createDedupFromStream is createDedupWithIndex for an MKV read from a pipe.
+// The MKV is read once: its clusters are matched a window at a time as they
+// arrive, and its checksums computed on the way. Verification compares the
+// reconstruction with those checksums, since the MKV cannot be read again.
+// Once ctx is canceled, the create stops before the next window.
+func createDedupFromStream(ctx context.Context, stream *mkvStream, sourceDir, outputPath, virtualName string,
+	indexer *source.Indexer, index *source.Index, phaseStart, phaseTotal int, opts createOptions) *createResult {
+	start := time.Now()
+	result := &createResult{
+		MkvPath:     stream.path,
+		OutputPath:  outputPath,
+		VirtualName: virtualName,
+	}
+
+	phaseLabel := func(offset int, label string) string {
+		return fmt.Sprintf("Phase %d/%d: %s", phaseStart+offset, phaseTotal, label)
+	}
+
+	// Fallback codec check using the index, as in createDedupWithIndex
+	tracks := stream.parser.Parser().Tracks()
+	if sourceCodecs, err := source.DetectSourceCodecs(index); err == nil {
+		action := codecMismatchPrompt
+		if opts.nonInteractive {
+			action = codecMismatchContinue
+		}
+		if err := reportCodecMismatches(source.CheckCodecCompatibility(tracks, sourceCodecs), action); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	m, err := matcher.NewMatcher(index)
+	if err != nil {
+		result.Err = fmt.Errorf("create matcher: %w", err)
+		return result
+	}
+	defer m.Close()
+	m.SetVerboseWriter(verboseWriter())
+
+	ms, err := m.NewStream(tracks)
+	if err != nil {
+		result.Err = fmt.Errorf("create matcher: %w", err)
+		return result
+	}
+	defer ms.Close()
+
+	// The MKV's size is unknown until it ends, so the bar only times the phase
+	matchBar := newProgressBar(phaseLabel(0, "Reading and matching MKV..."), 0, "bytes")
+	for {
+		if err := ctx.Err(); err != nil {
+			matchBar.Cancel()
+			result.Err = err
+			return result
+		}
+		w, err := stream.parser.NextWindow(streamWindowSize)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err == nil {
+			err = ms.MatchWindow(ctx, w.Data, w.Packets)
+		}
+		if err != nil {
+			matchBar.Cancel()
+			result.Err = fmt.Errorf("match at MKV offset %s: %w", formatInt(ms.Size()), err)
+			return result
+		}
+	}
+	matchBar.Finish()
+	matchResult, err := ms.Finish()
+	if err != nil {
+		result.Err = fmt.Errorf("match: %w", err)
+		return result
+	}
+	defer matchResult.Close()
+
+	orig := stream.original()
+	printInfo("  Read %s bytes of MKV\n", formatInt(orig.size))
+	sourceDir, err = writeDedupFile(ctx, outputPath, sourceDir, virtualName, indexer, index, matchResult, orig,
+		opts.digests, opts.deltaStore, phaseLabel(1, "Writing dedup file..."))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	verifyPrefix := phaseLabel(2, "Verifying reconstruction...")
+	outputPath = handleVerifyError(outputPath,
+		verifyStreamReconstructionFunc(outputPath, sourceDir, orig.size, orig.checksum, verifyPrefix), result)
+
+	result.setStats(orig.size, matchResult, outputPath, start)
+	return result
+}
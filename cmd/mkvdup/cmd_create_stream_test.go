@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestIsStreamInput(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(file, []byte("mkv"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if !isStreamInput("-") {
+		t.Error(`isStreamInput("-") = false`)
+	}
+	if isStreamInput(file) {
+		t.Error("isStreamInput(regular file) = true")
+	}
+	if isStreamInput(filepath.Join(dir, "missing.mkv")) {
+		t.Error("isStreamInput(missing file) = true")
+	}
+
+	fifo := filepath.Join(dir, "pipe")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	if !isStreamInput(fifo) {
+		t.Error("isStreamInput(named pipe) = false")
+	}
+}
+
+func TestVerifyStreamReconstruction(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	original := []byte(strings.Repeat("streamed mkv data ", 20))
+	createExtractableDedup(t, dedupPath, sourceDir, original)
+	size, checksum := int64(len(original)), xxhash.Sum64(original)
+
+	if err := verifyStreamReconstruction(dedupPath, sourceDir, size, checksum, "Verifying..."); err != nil {
+		t.Errorf("verifyStreamReconstruction: %v", err)
+	}
+	if err := verifyStreamReconstruction(dedupPath, sourceDir, size, checksum+1, "Verifying..."); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verifyStreamReconstruction(wrong checksum) = %v, want checksum mismatch", err)
+	}
+	if err := verifyStreamReconstruction(dedupPath, sourceDir, size+1, checksum, "Verifying..."); err == nil || !strings.Contains(err.Error(), "size mismatch") {
+		t.Errorf("verifyStreamReconstruction(wrong size) = %v, want size mismatch", err)
+	}
+}
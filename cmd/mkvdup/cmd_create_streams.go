@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/mkv"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// minFilteredTrackMatch is the fraction of a track's packet bytes that must
+// match a stream-filtered index. A track matching less, when the index left
+// out streams it could have come from, is matched again against every stream.
+const minFilteredTrackMatch = 0.5
+
+// missedTrack is an MKV track that matched poorly against an index that
+// left out source streams it could have come from.
+type missedTrack struct {
+	track   mkv.Track
+	matched float64                // Fraction of its packet bytes matched
+	skipped []source.SkippedStream // Streams of its codec left out of the index
+}
+
+// missedTracks returns the tracks of the MKV that matched poorly against
+// index because its stream filter may have left out their source streams,
+// such as a track whose source stream declares another channel count than
+// the MKV does.
+func missedTracks(tracks []mkv.Track, packets []mkv.Packet, index *source.Index, result *matcher.Result) []missedTrack {
+	if len(index.SkippedStreams) == 0 {
+		return nil
+	}
+	matched := trackMatchFractions(packets, result.Entries)
+	var missed []missedTrack
+	for _, track := range tracks {
+		fraction, ok := matched[track.Number]
+		if !ok || fraction >= minFilteredTrackMatch {
+			continue
+		}
+		if skipped := index.SkippedStreamsFor(track); len(skipped) > 0 {
+			missed = append(missed, missedTrack{track: track, matched: fraction, skipped: skipped})
+		}
+	}
+	return missed
+}
+
+// trackMatchFractions returns the fraction of the packet bytes of each
+// track that is not delta, given the entries of its match result. Both are
+// in MKV offset order.
+func trackMatchFractions(packets []mkv.Packet, entries []matcher.Entry) map[uint64]float64 {
+	total := make(map[uint64]int64)
+	unmatched := make(map[uint64]int64)
+	next := 0
+	for _, pkt := range packets {
+		end := pkt.Offset + pkt.Size
+		total[pkt.TrackNum] += pkt.Size
+		for next < len(entries) && entries[next].MkvOffset+entries[next].Length <= pkt.Offset {
+			next++
+		}
+		for _, e := range entries[next:] {
+			if e.MkvOffset >= end {
+				break
+			}
+			if e.Source == 0 && !e.IsFill {
+				unmatched[pkt.TrackNum] += min(end, e.MkvOffset+e.Length) - max(pkt.Offset, e.MkvOffset)
+			}
+		}
+	}
+	fractions := make(map[uint64]float64, len(total))
+	for track, n := range total {
+		if n > 0 {
+			fractions[track] = 1 - float64(unmatched[track])/float64(n)
+		}
+	}
+	return fractions
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/mkv"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+func TestMissedTracks(t *testing.T) {
+	tracks := []mkv.Track{
+		{Number: 1, Type: mkv.TrackTypeVideo, CodecID: "V_MPEG2"},
+		{Number: 2, Type: mkv.TrackTypeAudio, CodecID: "A_AC3", Channels: 6},
+		{Number: 3, Type: mkv.TrackTypeAudio, CodecID: "A_AAC"},
+	}
+	packets := []mkv.Packet{
+		{Offset: 100, Size: 100, TrackNum: 1},
+		{Offset: 200, Size: 50, TrackNum: 2},
+		{Offset: 260, Size: 40, TrackNum: 3},
+		{Offset: 300, Size: 50, TrackNum: 2},
+	}
+	// The video and the first AC3 packet match, with the container bytes
+	// around them in the delta; the rest of the audio does not
+	result := &matcher.Result{Entries: []matcher.Entry{
+		{MkvOffset: 0, Length: 100},
+		{MkvOffset: 100, Length: 100, Source: 1, IsVideo: true},
+		{MkvOffset: 200, Length: 40, Source: 1},
+		{MkvOffset: 240, Length: 10, IsFill: true},
+		{MkvOffset: 250, Length: 110},
+	}}
+
+	fractions := trackMatchFractions(packets, result.Entries)
+	if want := map[uint64]float64{1: 1, 2: 0.5, 3: 0}; !reflect.DeepEqual(fractions, want) {
+		t.Errorf("trackMatchFractions = %v, want %v", fractions, want)
+	}
+
+	index := &source.Index{}
+	if missed := missedTracks(tracks, packets, index, result); missed != nil {
+		t.Errorf("missedTracks of an unfiltered index = %+v", missed)
+	}
+
+	// The AAC track has no source stream to miss, and the AC3 track
+	// matched well enough
+	index.SkippedStreams = []source.SkippedStream{{SubStreamID: 0x81, Codec: source.CodecAC3Audio, Channels: 2}}
+	if missed := missedTracks(tracks, packets, index, result); missed != nil {
+		t.Errorf("missedTracks = %+v, want none", missed)
+	}
+	result.Entries[2].Length = 25
+	result.Entries[3] = matcher.Entry{MkvOffset: 225, Length: 25}
+	missed := missedTracks(tracks, packets, index, result)
+	if len(missed) != 1 || missed[0].track.Number != 2 || missed[0].matched != 0.25 || len(missed[0].skipped) != 1 {
+		t.Errorf("missedTracks = %+v, want track 2 matched 25%%", missed)
+	}
+}
@@ -406,3 +406,48 @@ func TestReportCodecMismatches_NoMismatches(t *testing.T) {
 		t.Errorf("expected no output for empty mismatches, got: %q", stderr)
 	}
 }
+
+func TestSourceDigests(t *testing.T) {
+	if d, err := newSourceDigests(""); d != nil || err != nil {
+		t.Errorf("newSourceDigests(\"\") = %v, %v; want nil, nil", d, err)
+	}
+	if _, err := newSourceDigests("md5"); err == nil {
+		t.Error("newSourceDigests(md5) should fail")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.vob"), []byte("first"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.vob"), nil, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	files := []source.File{{RelativePath: "a.vob", Size: 5}, {RelativePath: "empty.vob"}}
+
+	d, err := newSourceDigests("sha256")
+	if err != nil {
+		t.Fatalf("newSourceDigests: %v", err)
+	}
+	sums, err := d.sumFiles(dir, files)
+	if err != nil {
+		t.Fatalf("sumFiles: %v", err)
+	}
+	if got, want := fmt.Sprintf("%x", sums[0]), fmt.Sprintf("%x", sha256Sum([]byte("first"))); got != want {
+		t.Errorf("sum[0] = %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprintf("%x", sums[1]), fmt.Sprintf("%x", sha256Sum(nil)); got != want {
+		t.Errorf("sum[1] = %s, want %s", got, want)
+	}
+
+	// A second MKV of the same batch reuses the digests without rereading.
+	if err := os.Remove(filepath.Join(dir, "a.vob")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	again, err := d.sumFiles(dir, files[:1])
+	if err != nil {
+		t.Fatalf("sumFiles (cached): %v", err)
+	}
+	if string(again[0]) != string(sums[0]) {
+		t.Error("cached digest differs")
+	}
+}
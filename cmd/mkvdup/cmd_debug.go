@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -92,6 +93,8 @@ func indexSource(dir string) error {
 	}
 
 	fmt.Printf("Source type: %s\n", indexer.SourceType())
+	indexer.SetMaxMemory(maxIndexMemory)
+	indexer.SetWorkers(indexWorkers)
 
 	start := time.Now()
 	lastProgress := time.Now()
@@ -120,21 +123,23 @@ func indexSource(dir string) error {
 	}
 	fmt.Println()
 
-	fmt.Printf("Unique hashes: %d\n", len(index.HashToLocations))
+	fmt.Printf("Unique hashes: %d\n", index.HashCount())
 	if index.UsesESOffsets {
 		containerType := "MPEG-PS"
-		if indexer.SourceType() == source.TypeBluray {
+		if indexer.SourceType() == source.TypeBluray || indexer.SourceType() == source.TypeMPEGTS {
 			containerType = "MPEG-TS"
+		} else if indexer.SourceType() == source.TypeMP4 {
+			containerType = "MP4"
+		} else if indexer.SourceType() == source.TypeMKV {
+			containerType = "MKV"
 		}
 		fmt.Printf("Index type: ES-aware (%s)\n", containerType)
 	}
 
-	// Count total locations
-	totalLocations := 0
-	for _, locs := range index.HashToLocations {
-		totalLocations += len(locs)
+	fmt.Printf("Total indexed locations: %d\n", index.LocationCount())
+	if index.Sorted() {
+		fmt.Println("Index storage: sorted file (exceeds --max-index-memory)")
 	}
-	fmt.Printf("Total indexed locations: %d\n", totalLocations)
 
 	return nil
 }
@@ -150,7 +155,7 @@ func matchMKV(mkvPath, sourceDir string) error {
 	defer parser.Close()
 
 	// Phase 2: Index source
-	_, index, err := buildSourceIndex(sourceDir, "Phase 2/3: Indexing source...")
+	_, index, err := buildSourceIndex(context.Background(), sourceDir, sourceScope{}, "Phase 2/3: Indexing source...")
 	if err != nil {
 		return err
 	}
@@ -192,6 +197,11 @@ func matchMKV(mkvPath, sourceDir string) error {
 	fmt.Printf("Delta (unmatched):  %s bytes (%.2f MB, %.1f%%)\n",
 		formatInt(result.UnmatchedBytes), float64(result.UnmatchedBytes)/(1024*1024),
 		float64(result.UnmatchedBytes)/float64(mkvSize)*100)
+	if result.FilledBytes > 0 {
+		fmt.Printf("Fill (synthesized): %s bytes (%.2f MB, %.1f%%)\n",
+			formatInt(result.FilledBytes), float64(result.FilledBytes)/(1024*1024),
+			float64(result.FilledBytes)/float64(mkvSize)*100)
+	}
 	fmt.Println()
 
 	fmt.Printf("Packets matched:    %d / %d (%.1f%%)\n",
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stuckj/mkvdup/internal/dedup"
+)
+
+// openDeltaStore returns the delta store in dir, or nil if dir is empty
+// (deltas stored in the dedup files).
+func openDeltaStore(dir string) (*dedup.DeltaStore, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("delta store %s is not a directory", dir)
+	}
+	return dedup.NewDeltaStore(dir)
+}
+
+// findDedupFiles returns the .mkvdup files among paths, searching
+// directories recursively.
+func findDedupFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ".mkvdup") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("search %s: %w", p, err)
+		}
+	}
+	return files, nil
+}
+
+// pruneDeltaStore removes the chunks of the delta store in storeDir that
+// none of the dedup files found under paths reference. Every dedup file
+// using the store must be listed: the chunks of any that is missed are
+// removed. If a dedup file can't be read, or none of them uses the store,
+// nothing is removed. Unless force is set, neither is anything removed when
+// a listed dedup file uses another store, which suggests the wrong files or
+// store were given.
+func pruneDeltaStore(storeDir string, paths []string, dryRun, force bool) error {
+	store, err := openDeltaStore(storeDir)
+	if err != nil {
+		return err
+	}
+	storeInfo, err := os.Stat(store.Dir())
+	if err != nil {
+		return err
+	}
+	files, err := findDedupFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .mkvdup files found in %s; refusing to prune", strings.Join(paths, ", "))
+	}
+
+	keep := make(map[[sha256.Size]byte]bool)
+	using := 0
+	var others []string // Dedup files using another store
+	for _, path := range files {
+		reader, err := dedup.NewReaderLazy(path, "")
+		if err != nil {
+			return fmt.Errorf("%s: %w (nothing pruned)", path, err)
+		}
+		ref := reader.DeltaStore()
+		reader.Close()
+		if ref == nil {
+			continue
+		}
+		// The store may be reached by another path, such as through a
+		// symlink or another mount point, so compare the directories.
+		if info, err := os.Stat(ref.Dir); err != nil || !os.SameFile(info, storeInfo) {
+			others = append(others, fmt.Sprintf("%s (store %s)", path, ref.Dir))
+			continue
+		}
+		using++
+		for _, c := range ref.Chunks {
+			keep[c.Hash] = true
+		}
+	}
+	printInfo("Dedup files: %d scanned, %d using %s\n", len(files), using, store.Dir())
+	if using == 0 {
+		return fmt.Errorf("none of the dedup files found uses delta store %s; refusing to prune", store.Dir())
+	}
+	if len(others) > 0 {
+		for _, o := range others {
+			printWarn("  Uses another delta store: %s\n", o)
+		}
+		if !force {
+			return fmt.Errorf("%d %s another delta store; refusing to prune without --force",
+				len(others), plural(len(others), "dedup file uses", "dedup files use"))
+		}
+	}
+	printInfo("Referenced chunks: %s\n", formatInt(int64(len(keep))))
+
+	res, err := store.PruneDeltaStore(keep, dryRun)
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %s unreferenced chunks (%s bytes); %s kept\n",
+		verb, formatInt(int64(res.Removed)), formatInt(res.RemovedBytes), formatInt(int64(res.Kept)))
+	return nil
+}
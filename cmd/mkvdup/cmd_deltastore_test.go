@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// createStoredDeltaDedup writes a dedup file whose delta, delta, is kept
+// in store.
+func createStoredDeltaDedup(t *testing.T, dedupPath string, store *dedup.DeltaStore, delta []byte) {
+	t.Helper()
+	writer, err := dedup.NewWriter(dedupPath)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer writer.Close()
+	writer.SetHeader(int64(len(delta)), xxhash.Sum64(delta), source.TypeDVD)
+	writer.SetDeltaCompression(true)
+	writer.SetCompactIndex(true)
+	writer.SetDeltaStore(store)
+	result := &matcher.Result{
+		Entries:   []matcher.Entry{{MkvOffset: 0, Length: int64(len(delta)), Source: 0}},
+		DeltaData: delta,
+	}
+	if err := writer.SetMatchResult(result, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := writer.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+// ageDeltaStore makes every file in the store older than the prune grace
+// period.
+func ageDeltaStore(t *testing.T, dir string) {
+	t.Helper()
+	old := time.Now().Add(-2 * dedup.DeltaStorePruneGrace)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatalf("age store: %v", err)
+	}
+}
+
+// countStoreChunks returns the number of files in the store.
+func countStoreChunks(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walk store: %v", err)
+	}
+	return n
+}
+
+func TestPruneDeltaStore(t *testing.T) {
+	dir := t.TempDir()
+	storeDir := filepath.Join(dir, "store")
+	store, err := openDeltaStore(storeDir)
+	if err != nil {
+		t.Fatalf("openDeltaStore: %v", err)
+	}
+	libDir := filepath.Join(dir, "library")
+	if err := os.MkdirAll(filepath.Join(libDir, "show"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	keptPath := filepath.Join(libDir, "show", "kept.mkvdup")
+	removedPath := filepath.Join(dir, "removed.mkvdup")
+	createStoredDeltaDedup(t, keptPath, store, []byte(strings.Repeat("kept delta ", 100)))
+	createStoredDeltaDedup(t, removedPath, store, []byte(strings.Repeat("other delta ", 100)))
+	ageDeltaStore(t, storeDir)
+	if n := countStoreChunks(t, storeDir); n != 2 {
+		t.Fatalf("store has %d chunks, want 2", n)
+	}
+
+	// Both files listed: nothing to remove.
+	if err := pruneDeltaStore(storeDir, []string{libDir, removedPath}, false, false); err != nil {
+		t.Fatalf("pruneDeltaStore: %v", err)
+	}
+	if n := countStoreChunks(t, storeDir); n != 2 {
+		t.Errorf("store has %d chunks after pruning with all files listed, want 2", n)
+	}
+
+	// An unreadable dedup file stops the prune.
+	badPath := filepath.Join(libDir, "bad.mkvdup")
+	if err := os.WriteFile(badPath, []byte("not a dedup file"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := pruneDeltaStore(storeDir, []string{libDir}, false, false); err == nil {
+		t.Error("pruneDeltaStore succeeded with an unreadable dedup file")
+	}
+	if n := countStoreChunks(t, storeDir); n != 2 {
+		t.Errorf("store has %d chunks after a failed prune, want 2", n)
+	}
+	os.Remove(badPath)
+
+	if err := pruneDeltaStore(storeDir, []string{libDir}, true, false); err != nil {
+		t.Fatalf("pruneDeltaStore(dry run): %v", err)
+	}
+	if n := countStoreChunks(t, storeDir); n != 2 {
+		t.Errorf("dry run left %d chunks, want 2", n)
+	}
+
+	if err := pruneDeltaStore(storeDir, []string{libDir}, false, false); err != nil {
+		t.Fatalf("pruneDeltaStore: %v", err)
+	}
+	if n := countStoreChunks(t, storeDir); n != 1 {
+		t.Errorf("store has %d chunks, want 1", n)
+	}
+	reader, err := dedup.NewReader(keptPath, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+	if err := reader.VerifyIntegrity(); err != nil {
+		t.Errorf("kept file: %v", err)
+	}
+
+	if err := pruneDeltaStore(storeDir, []string{filepath.Join(dir, "store")}, false, false); err == nil ||
+		!strings.Contains(err.Error(), "refusing") {
+		t.Errorf("pruneDeltaStore with no dedup files = %v, want refusal", err)
+	}
+}
+
+func TestPruneDeltaStore_StorePaths(t *testing.T) {
+	dir := t.TempDir()
+	storeDir := filepath.Join(dir, "store")
+	store, err := openDeltaStore(storeDir)
+	if err != nil {
+		t.Fatalf("openDeltaStore: %v", err)
+	}
+	otherStore, err := openDeltaStore(filepath.Join(dir, "other-store"))
+	if err != nil {
+		t.Fatalf("openDeltaStore: %v", err)
+	}
+	libDir := filepath.Join(dir, "library")
+	if err := os.Mkdir(libDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	createStoredDeltaDedup(t, filepath.Join(libDir, "a.mkvdup"), store, []byte(strings.Repeat("delta a ", 100)))
+	createStoredDeltaDedup(t, filepath.Join(dir, "b.mkvdup"), store, []byte(strings.Repeat("delta b ", 100)))
+	ageDeltaStore(t, storeDir)
+
+	// The store reached through a symlink is the same store.
+	link := filepath.Join(dir, "store-link")
+	if err := os.Symlink(storeDir, link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := pruneDeltaStore(link, []string{libDir, filepath.Join(dir, "b.mkvdup")}, false, false); err != nil {
+		t.Fatalf("pruneDeltaStore through a symlink: %v", err)
+	}
+	if n := countStoreChunks(t, storeDir); n != 2 {
+		t.Errorf("store has %d chunks after pruning through a symlink, want 2", n)
+	}
+
+	// No listed file uses the store.
+	otherDir := filepath.Join(dir, "other")
+	if err := os.Mkdir(otherDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	createStoredDeltaDedup(t, filepath.Join(otherDir, "c.mkvdup"), otherStore, []byte("delta c"))
+	if err := pruneDeltaStore(storeDir, []string{otherDir}, false, true); err == nil ||
+		!strings.Contains(err.Error(), "refusing") {
+		t.Errorf("pruneDeltaStore with no file using the store = %v, want refusal", err)
+	}
+
+	// A listed file using another store needs --force.
+	if err := pruneDeltaStore(storeDir, []string{libDir, otherDir}, false, false); err == nil ||
+		!strings.Contains(err.Error(), "--force") {
+		t.Errorf("pruneDeltaStore with a file of another store = %v, want refusal", err)
+	}
+	if n := countStoreChunks(t, storeDir); n != 2 {
+		t.Errorf("store has %d chunks after refused prunes, want 2", n)
+	}
+	if err := pruneDeltaStore(storeDir, []string{libDir, otherDir}, false, true); err != nil {
+		t.Fatalf("pruneDeltaStore --force: %v", err)
+	}
+	if n := countStoreChunks(t, storeDir); n != 1 {
+		t.Errorf("store has %d chunks after a forced prune, want 1", n)
+	}
+}
@@ -90,8 +90,8 @@ func deltadiag(dedupPath, mkvPath string) error {
 		if !ok {
 			continue
 		}
-		if ent.Source != 0 {
-			continue // Skip matched entries
+		if ent.Source != 0 || ent.IsFill {
+			continue // Skip matched and fill entries
 		}
 
 		entStart := ent.MkvOffset
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // formatInt formats an integer with thousands separators (e.g., 1234567 → "1,234,567").
@@ -22,6 +24,24 @@ func formatInt(n int64) string {
 	return string(result)
 }
 
+// parseSize parses a byte count with an optional binary unit suffix,
+// such as "512M", "1.5G" or "2GB". A bare number is a count of bytes.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	shift := 0
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGT", num[n-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			num = num[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 || v*float64(int64(1)<<shift) >= 1<<63 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512M or 2G)", s)
+	}
+	return int64(v * float64(int64(1)<<shift)), nil
+}
+
 // plural returns singular when n == 1, plural otherwise.
 // Example: plural(n, "file", "files")
 func plural(n int, singular, pl string) string {
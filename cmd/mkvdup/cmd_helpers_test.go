@@ -37,6 +37,33 @@ func TestFormatInt(t *testing.T) {
 	}
 }
 
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"512M", 512 << 20},
+		{"2G", 2 << 30},
+		{"2gb", 2 << 30},
+		{"1.5G", 3 << 29},
+		{"1T", 1 << 40},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1M", "lots", "1X", "99999999T"} {
+		if got, err := parseSize(bad); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", bad, got)
+		}
+	}
+}
+
 func TestCalculateFileChecksum(t *testing.T) {
 	t.Run("normal file", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// indexCacheDir is the directory of the source index cache, or "" when the
+// cache is disabled. main sets it to the default unless --no-index-cache is
+// given.
+var indexCacheDir string
+
+// openIndexCache returns the source index cache, or nil when it is disabled.
+func openIndexCache() *source.IndexCache {
+	if indexCacheDir == "" {
+		return nil
+	}
+	cache, err := source.NewIndexCache(indexCacheDir)
+	if err != nil {
+		log.Printf("Warning: index cache disabled: %v", err)
+		return nil
+	}
+	return cache
+}
+
+// loadCachedIndex fills indexer's index from the index cache if it holds a
+// current index of the same source and scope, and reports whether it did.
+// A cache file that can't be read is only warned about: the index is then
+// built as if it were not cached.
+func loadCachedIndex(indexer *source.Indexer) bool {
+	cache := openIndexCache()
+	if cache == nil {
+		return false
+	}
+	loaded, err := indexer.LoadCache(cache)
+	if err != nil {
+		log.Printf("Warning: ignoring cached source index: %v", err)
+	}
+	return loaded
+}
+
+// saveCachedIndex stores the index indexer has built in the index cache.
+// Failing to do so is only warned about.
+func saveCachedIndex(indexer *source.Indexer) {
+	cache := openIndexCache()
+	if cache == nil {
+		return
+	}
+	if err := indexer.SaveCache(cache); err != nil {
+		log.Printf("Warning: could not cache source index: %v", err)
+	}
+}
+
+// requireIndexCache returns the index cache for the index-cache command.
+func requireIndexCache() (*source.IndexCache, error) {
+	if indexCacheDir == "" {
+		return nil, errors.New("the index cache is disabled (--no-index-cache)")
+	}
+	return source.NewIndexCache(indexCacheDir)
+}
+
+// listIndexCache prints the indexes in the cache.
+func listIndexCache() error {
+	cache, err := requireIndexCache()
+	if err != nil {
+		return err
+	}
+	entries, err := cache.List()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Index cache: %s\n", cache.Dir())
+	if len(entries) == 0 {
+		fmt.Println("No cached indexes")
+		return nil
+	}
+
+	var total int64
+	stale := 0
+	for _, e := range entries {
+		total += e.Size
+		fmt.Println()
+		if e.SourceDir == "" {
+			fmt.Printf("%s\n", filepath.Base(e.Path))
+		} else {
+			fmt.Printf("%s (%s", e.SourceDir, e.SourceType)
+			if e.Scope != "" {
+				fmt.Printf(", %s", e.Scope)
+			}
+			if e.RawIndexing {
+				fmt.Print(", raw")
+			}
+			fmt.Println(")")
+			fmt.Printf("  %d source %s, %s, %s hashes (window %d)\n", e.SourceFiles,
+				plural(e.SourceFiles, "file", "files"), formatSize(e.SourceSize), formatInt(int64(e.Hashes)), e.WindowSize)
+			fmt.Printf("  Built:  %s\n", e.Created.Format(time.DateTime))
+			fmt.Printf("  File:   %s (%s)\n", filepath.Base(e.Path), formatSize(e.Size))
+		}
+		if e.Stale != "" {
+			stale++
+			fmt.Printf("  Status: stale (%s)\n", e.Stale)
+		} else {
+			fmt.Println("  Status: valid")
+		}
+	}
+	fmt.Printf("\n%d cached %s (%d stale), %s\n", len(entries),
+		plural(len(entries), "index", "indexes"), stale, formatSize(total))
+	return nil
+}
+
+// pruneIndexCache removes the stale indexes from the cache, or with all
+// every index.
+func pruneIndexCache(all, dryRun bool) error {
+	cache, err := requireIndexCache()
+	if err != nil {
+		return err
+	}
+	res, err := cache.Prune(all, dryRun)
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d cached %s (%s); %d kept\n", verb, res.Removed,
+		plural(res.Removed, "index", "indexes"), formatSize(res.RemovedBytes), res.Kept)
+	return nil
+}
+
+// buildIndexCache indexes each source directory, restricted to a playlist
+// or title if given, and stores the indexes in the cache. Sources whose
+// cached index is current are skipped.
+func buildIndexCache(sourceDirs []string, playlistSpec, titleSpec string) error {
+	if _, err := requireIndexCache(); err != nil {
+		return err
+	}
+	if playlistSpec == "auto" || titleSpec == "auto" {
+		return errors.New(`"auto" needs an MKV to choose with; name the playlist or title`)
+	}
+	for _, sourceDir := range sourceDirs {
+		var scope sourceScope
+		if playlistSpec != "" {
+			playlists, err := source.ListBlurayPlaylists(sourceDir)
+			if err != nil {
+				return fmt.Errorf("%s: list playlists: %w", sourceDir, err)
+			}
+			if scope.playlist, err = source.FindBlurayPlaylist(playlists, playlistSpec); err != nil {
+				return fmt.Errorf("%s: %w", sourceDir, err)
+			}
+		}
+		if titleSpec != "" {
+			titles, err := source.ListDVDTitles(sourceDir)
+			if err != nil {
+				return fmt.Errorf("%s: list titles: %w", sourceDir, err)
+			}
+			if scope.title, err = source.FindDVDTitle(titles, titleSpec); err != nil {
+				return fmt.Errorf("%s: %w", sourceDir, err)
+			}
+		}
+
+		printInfo("Source: %s\n", sourceDir)
+		_, index, err := buildSourceIndex(context.Background(), sourceDir, scope, "  Indexing source...")
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceDir, err)
+		}
+		index.Close()
+	}
+	return nil
+}
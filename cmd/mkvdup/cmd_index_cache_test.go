@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTestIndexCache enables the index cache in a temporary directory for
+// the duration of the test.
+func useTestIndexCache(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "index-cache")
+	old := indexCacheDir
+	indexCacheDir = dir
+	t.Cleanup(func() { indexCacheDir = old })
+	return dir
+}
+
+func TestBuildSourceIndex_UsesIndexCache(t *testing.T) {
+	useTestIndexCache(t)
+	sourceDir := t.TempDir()
+	vob := filepath.Join(sourceDir, "VIDEO_TS", "VTS_01_1.VOB")
+	if err := os.MkdirAll(filepath.Dir(vob), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(vob, make([]byte, 64*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func() string {
+		return captureStdout(t, func() {
+			_, index, err := buildSourceIndex(context.Background(), sourceDir, sourceScope{}, "Indexing...")
+			if err != nil {
+				t.Fatalf("buildSourceIndex: %v", err)
+			}
+			index.Close()
+		})
+	}
+	if out := build(); strings.Contains(out, "loaded from cache") {
+		t.Fatalf("first index loaded from an empty cache:\n%s", out)
+	}
+	if out := build(); !strings.Contains(out, "Indexing... loaded from cache") {
+		t.Fatalf("second index was not loaded from the cache:\n%s", out)
+	}
+
+	out := captureStdout(t, func() {
+		if err := listIndexCache(); err != nil {
+			t.Fatalf("listIndexCache: %v", err)
+		}
+	})
+	if !strings.Contains(out, sourceDir) || !strings.Contains(out, "Status: valid") {
+		t.Errorf("list output missing the valid index of %s:\n%s", sourceDir, out)
+	}
+
+	// A changed source is indexed again
+	if err := os.WriteFile(vob, make([]byte, 32*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out = captureStdout(t, func() {
+		if err := listIndexCache(); err != nil {
+			t.Fatalf("listIndexCache: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Status: stale") {
+		t.Errorf("list output does not show the changed source stale:\n%s", out)
+	}
+	if out := build(); strings.Contains(out, "loaded from cache") {
+		t.Errorf("index of a changed source loaded from the cache:\n%s", out)
+	}
+
+	out = captureStdout(t, func() {
+		if err := pruneIndexCache(true, false); err != nil {
+			t.Fatalf("pruneIndexCache: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Removed 1 cached index") {
+		t.Errorf("prune output = %q, want one removal", out)
+	}
+}
+
+func TestIndexCacheDisabled(t *testing.T) {
+	old := indexCacheDir
+	indexCacheDir = ""
+	t.Cleanup(func() { indexCacheDir = old })
+
+	if err := listIndexCache(); err == nil {
+		t.Error("listIndexCache with the cache disabled succeeded")
+	}
+	if openIndexCache() != nil {
+		t.Error("openIndexCache with the cache disabled returned a cache")
+	}
+}
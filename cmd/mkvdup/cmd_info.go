@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/source"
 )
 
 // showInfo displays information about a dedup file.
@@ -36,6 +40,10 @@ func showInfo(dedupPath string, hideUnused bool) error {
 		formatInt(info["original_size"].(int64)),
 		float64(info["original_size"].(int64))/(1024*1024))
 	fmt.Printf("Original checksum:  %016x\n", info["original_checksum"].(uint64))
+	checksums := reader.ExtendedChecksums()
+	if checksums != nil {
+		fmt.Printf("Original %-10s %x\n", checksums.Algorithm+":", checksums.Original)
+	}
 	fmt.Println()
 
 	sourceType := "Unknown"
@@ -44,6 +52,12 @@ func showInfo(dedupPath string, hideUnused bool) error {
 		sourceType = "DVD"
 	case 1:
 		sourceType = "Blu-ray"
+	case 2:
+		sourceType = "MPEG-TS"
+	case 3:
+		sourceType = "MP4"
+	case 4:
+		sourceType = "MKV"
 	}
 	fmt.Printf("Source type:        %s\n", sourceType)
 	fmt.Printf("Uses ES offsets:    %v\n", info["uses_es_offsets"].(bool))
@@ -52,15 +66,43 @@ func showInfo(dedupPath string, hideUnused bool) error {
 	}
 	fmt.Printf("Source file count:  %d\n", info["source_file_count"].(int))
 	fmt.Printf("Index entry count:  %d\n", info["entry_count"].(int))
+	indexSize := info["index_size"].(int64)
+	indexNote := ""
+	if info["compact_index"].(bool) {
+		indexNote = ", compact"
+	}
+	fmt.Printf("Index size:         %s bytes (%.2f MB%s)\n",
+		formatInt(indexSize), float64(indexSize)/(1024*1024), indexNote)
 	fmt.Printf("Delta size:         %s bytes (%.2f MB)\n",
 		formatInt(info["delta_size"].(int64)),
 		float64(info["delta_size"].(int64))/(1024*1024))
+	if store := reader.DeltaStore(); store != nil {
+		fmt.Printf("Delta store:        %s (%s chunks)\n", store.Dir, formatInt(int64(len(store.Chunks))))
+	} else if info["delta_compressed"].(bool) {
+		logical := info["delta_size"].(int64)
+		stored := info["delta_stored_size"].(int64)
+		pct := float64(100)
+		if logical > 0 {
+			pct = float64(stored) / float64(logical) * 100
+		}
+		fmt.Printf("Delta stored size:  %s bytes (%.2f MB, %.1f%% of delta size)\n",
+			formatInt(stored), float64(stored)/(1024*1024), pct)
+	}
+	if chunks := reader.ChunkChecksums(); chunks != nil {
+		fmt.Printf("Chunk checksums:    %s (%s-byte chunks)\n",
+			formatInt(int64(chunks.Count())), formatInt(chunks.ChunkSize))
+	}
 	fmt.Println()
 
+	if m := reader.Metadata(); m != nil {
+		printMetadata(m)
+		fmt.Println()
+	}
+
 	// Source files
 	fmt.Println("Source files:")
 	hasUsedFlags := reader.HasSourceUsedFlags()
-	for _, sf := range reader.SourceFiles() {
+	for i, sf := range reader.SourceFiles() {
 		if hideUnused && hasUsedFlags && !sf.Used {
 			continue
 		}
@@ -69,19 +111,98 @@ func showInfo(dedupPath string, hideUnused bool) error {
 			suffix = " (unused)"
 		}
 		fmt.Printf("  %s (%s bytes)%s\n", sf.RelativePath, formatInt(sf.Size), suffix)
+		if checksums != nil {
+			fmt.Printf("    %s: %x\n", checksums.Algorithm, checksums.Sources[i])
+		}
 	}
 
 	return nil
 }
 
+// printMetadata prints the description of the original MKV stored in a
+// dedup file.
+func printMetadata(m *dedup.Metadata) {
+	if m.Title != "" {
+		fmt.Printf("Title:              %s\n", m.Title)
+	}
+	if m.Duration > 0 {
+		fmt.Printf("Duration:           %s\n", formatDuration(m.Duration))
+	}
+	fmt.Printf("Chapters:           %d\n", m.Chapters)
+	fmt.Println("Tracks:")
+	for _, t := range m.Tracks {
+		fmt.Printf("  %s\n", describeTrack(t))
+	}
+}
+
+// describeTrack returns a one-line description of a track, e.g.
+// `2: audio A_AC3, 6 ch, 48000 Hz, "Commentary" (fr-CA, default)`.
+func describeTrack(t dedup.TrackMetadata) string {
+	parts := []string{t.CodecID}
+	if t.PixelWidth > 0 && t.PixelHeight > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", t.PixelWidth, t.PixelHeight))
+	}
+	if t.Channels > 0 {
+		parts = append(parts, fmt.Sprintf("%d ch", t.Channels))
+	}
+	if t.SampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d Hz", t.SampleRate))
+	}
+	if t.Name != "" {
+		parts = append(parts, strconv.Quote(t.Name))
+	}
+	var flags []string
+	if t.Language != "" {
+		flags = append(flags, t.Language)
+	}
+	if t.Default {
+		flags = append(flags, "default")
+	}
+	if t.Forced {
+		flags = append(flags, "forced")
+	}
+	desc := fmt.Sprintf("%d: %s %s", t.Number, t.Type, strings.Join(parts, ", "))
+	if len(flags) > 0 {
+		desc += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return desc
+}
+
+// summarizeMetadata returns a one-line summary of the original MKV, e.g.
+// `"Feature Presentation", 01:30:21, 1 video, 2 audio, 3 subtitle, 28 chapters`.
+func summarizeMetadata(m *dedup.Metadata) string {
+	var parts []string
+	if m.Title != "" {
+		parts = append(parts, strconv.Quote(m.Title))
+	}
+	if m.Duration > 0 {
+		parts = append(parts, formatDuration(m.Duration))
+	}
+	var types []string
+	counts := make(map[string]int)
+	for _, t := range m.Tracks {
+		if counts[t.Type] == 0 {
+			types = append(types, t.Type)
+		}
+		counts[t.Type]++
+	}
+	for _, typ := range types {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[typ], typ))
+	}
+	parts = append(parts, fmt.Sprintf("%d chapters", m.Chapters))
+	return strings.Join(parts, ", ")
+}
+
 // calculateFileChecksum calculates xxhash checksum of a file.
 func calculateFileChecksum(path string) (uint64, error) {
 	return calculateFileChecksumWithProgress(path, 0, "")
 }
 
 // calculateFileChecksumWithProgress calculates xxhash checksum of a file,
-// showing inline progress when expectedSize > 0.
-func calculateFileChecksumWithProgress(path string, expectedSize int64, displayName string) (uint64, error) {
+// showing inline progress when expectedSize > 0. The file is also fed to
+// each non-nil writer in extra in the same pass, e.g. for an extended
+// checksum.
+func calculateFileChecksumWithProgress(path string, expectedSize int64, displayName string, extra ...io.Writer) (uint64, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return 0, err
@@ -89,10 +210,17 @@ func calculateFileChecksumWithProgress(path string, expectedSize int64, displayN
 	defer f.Close()
 
 	hasher := xxhash.New()
+	writers := []io.Writer{hasher}
+	for _, w := range extra {
+		if w != nil {
+			writers = append(writers, w)
+		}
+	}
+	w := io.MultiWriter(writers...)
 	showProgress := expectedSize > 0
 
 	if !showProgress {
-		if _, err := io.Copy(hasher, f); err != nil {
+		if _, err := io.Copy(w, f); err != nil {
 			return 0, err
 		}
 		return hasher.Sum64(), nil
@@ -105,7 +233,7 @@ func calculateFileChecksumWithProgress(path string, expectedSize int64, displayN
 	for {
 		n, err := f.Read(buf)
 		if n > 0 {
-			if _, werr := hasher.Write(buf[:n]); werr != nil {
+			if _, werr := w.Write(buf[:n]); werr != nil {
 				return 0, werr
 			}
 			processed += int64(n)
@@ -124,11 +252,51 @@ func calculateFileChecksumWithProgress(path string, expectedSize int64, displayN
 		}
 	}
 
-	// Clear progress line
+	clearVerifyProgress(displayName)
+	return hasher.Sum64(), nil
+}
+
+// clearVerifyProgress clears the inline progress line for displayName.
+func clearVerifyProgress(displayName string) {
 	progressText := fmt.Sprintf("  Verifying %s... 100.0%%", displayName)
 	fmt.Printf("\r%s\r", strings.Repeat(" ", len(progressText)))
+}
 
-	return hasher.Sum64(), nil
+// verifySourceChunks checks the chunks of a source file that a dedup file
+// reads against their stored checksums, showing inline progress, and
+// returns the chunks that do not match.
+func verifySourceChunks(path string, fc dedup.FileChunks, chunkSize, fileSize int64, displayName string) ([]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	total := fc.ByteCount(chunkSize, fileSize)
+	lastProgress := time.Time{}
+	bad, err := fc.Verify(f, chunkSize, fileSize, func(done int64) {
+		if time.Since(lastProgress) > 500*time.Millisecond {
+			fmt.Printf("\r  Verifying %s... %.1f%%", displayName, float64(done)/float64(total)*100)
+			lastProgress = time.Now()
+		}
+	})
+	clearVerifyProgress(displayName)
+	return bad, err
+}
+
+// formatBadChunks describes corrupt chunks by their source file offsets.
+func formatBadChunks(bad []int64, chunkSize int64) string {
+	const maxShown = 5
+	offsets := make([]string, 0, maxShown+1)
+	for i, c := range bad {
+		if i == maxShown {
+			offsets = append(offsets, fmt.Sprintf("and %d more", len(bad)-maxShown))
+			break
+		}
+		offsets = append(offsets, formatInt(c*chunkSize))
+	}
+	return fmt.Sprintf("%d corrupt %s at %s %s", len(bad), plural(len(bad), "chunk", "chunks"),
+		plural(len(bad), "offset", "offsets"), strings.Join(offsets, "; "))
 }
 
 // checkDedup checks the integrity of a dedup file and its source files.
@@ -178,22 +346,87 @@ func checkDedup(dedupPath, sourceDir string, sourceChecksums bool) error {
 		if errCount > 0 {
 			fmt.Println("\nSkipping source checksum verification due to earlier errors")
 		} else {
-			fmt.Printf("\nVerifying source file checksums...\n")
-			for _, sf := range sourceFiles {
+			// Extended checksums, if present, are verified in the same pass.
+			// Without them, only the chunks the dedup file reads are checked
+			// when it has chunk checksums.
+			checksums := reader.ExtendedChecksums()
+			if checksums != nil {
+				if _, err := dedup.NewChecksumHash(checksums.Algorithm); err != nil {
+					fmt.Printf("\nWarning: %v; verifying xxhash checksums only\n", err)
+					checksums = nil
+				}
+			}
+			chunks := reader.ChunkChecksums()
+			switch {
+			case checksums != nil:
+				fmt.Printf("\nVerifying source file checksums (xxhash and %s)...\n", checksums.Algorithm)
+			case chunks != nil:
+				fmt.Printf("\nVerifying source file chunks read by this file (%s-byte chunks)...\n",
+					formatInt(chunks.ChunkSize))
+			default:
+				fmt.Printf("\nVerifying source file checksums...\n")
+			}
+			for i, sf := range sourceFiles {
 				sfPath := filepath.Join(sourceDir, sf.RelativePath)
 
-				checksum, err := calculateFileChecksumWithProgress(sfPath, sf.Size, sf.RelativePath)
+				if chunks != nil && checksums == nil {
+					fc := chunks.Files[i]
+					bad, err := verifySourceChunks(sfPath, fc, chunks.ChunkSize, sf.Size, sf.RelativePath)
+					if err != nil {
+						fmt.Printf("  FAILED  %s: %v\n", sf.RelativePath, err)
+						errCount++
+						continue
+					}
+					if len(bad) > 0 {
+						fmt.Printf("  FAILED  %s: %s\n", sf.RelativePath, formatBadChunks(bad, chunks.ChunkSize))
+						errCount++
+						continue
+					}
+					fmt.Printf("  OK      %s (%s of %s bytes read by this file)\n", sf.RelativePath,
+						formatInt(fc.ByteCount(chunks.ChunkSize, sf.Size)), formatInt(sf.Size))
+					continue
+				}
+
+				var digest hash.Hash
+				var extra []io.Writer
+				if checksums != nil {
+					digest, _ = dedup.NewChecksumHash(checksums.Algorithm)
+					extra = append(extra, digest)
+				}
+				var chunkHasher *source.ChunkHasher
+				if chunks != nil {
+					chunkHasher = source.NewChunkHasher(chunks.ChunkSize)
+					extra = append(extra, chunkHasher)
+				}
+				checksum, err := calculateFileChecksumWithProgress(sfPath, sf.Size, sf.RelativePath, extra...)
 				if err != nil {
 					fmt.Printf("  FAILED  %s: %v\n", sf.RelativePath, err)
 					errCount++
 					continue
 				}
+				// Locate the damage when the file has chunk checksums
+				chunkNote := ""
+				if chunks != nil {
+					if bad := chunks.Files[i].Mismatches(chunkHasher.ChunkSums()); len(bad) > 0 {
+						chunkNote = "; " + formatBadChunks(bad, chunks.ChunkSize)
+					} else {
+						chunkNote = "; the chunks this file reads are intact"
+					}
+				}
 				if checksum != sf.Checksum {
-					fmt.Printf("  FAILED  %s: checksum mismatch (expected %016x, got %016x)\n",
-						sf.RelativePath, sf.Checksum, checksum)
+					fmt.Printf("  FAILED  %s: checksum mismatch (expected %016x, got %016x)%s\n",
+						sf.RelativePath, sf.Checksum, checksum, chunkNote)
 					errCount++
 					continue
 				}
+				if digest != nil {
+					if got := digest.Sum(nil); !bytes.Equal(got, checksums.Sources[i]) {
+						fmt.Printf("  FAILED  %s: %s mismatch (expected %x, got %x)%s\n",
+							sf.RelativePath, checksums.Algorithm, checksums.Sources[i], got, chunkNote)
+						errCount++
+						continue
+					}
+				}
 				fmt.Printf("  OK      %s\n", sf.RelativePath)
 			}
 		}
@@ -91,8 +91,14 @@ func probe(mkvPaths []string, sourceDirs []string) error {
 			continue
 		}
 		indexer.SetVerboseWriter(verboseWriter())
+		indexer.SetMaxMemory(maxIndexMemory)
+		indexer.SetWorkers(indexWorkers)
 
-		if err := indexer.Build(nil); err != nil {
+		loaded := loadCachedIndex(indexer)
+		if !loaded {
+			err = indexer.Build(nil)
+		}
+		if err != nil {
 			fmt.Printf("  Error building index: %v\n", err)
 			for i, md := range mkvData {
 				if md.Error != "" {
@@ -106,6 +112,9 @@ func probe(mkvPaths []string, sourceDirs []string) error {
 			}
 			continue
 		}
+		if !loaded {
+			saveCachedIndex(indexer)
+		}
 
 		index := indexer.Index()
 
@@ -115,22 +124,7 @@ func probe(mkvPaths []string, sourceDirs []string) error {
 				continue
 			}
 
-			matchCount := 0
-			for _, ph := range md.ProbeHashes {
-				if locs, ok := index.HashToLocations[ph.Hash]; ok {
-					if index.UsesESOffsets {
-						for _, loc := range locs {
-							if loc.IsVideo == ph.IsVideo {
-								matchCount++
-								break
-							}
-						}
-					} else if len(locs) > 0 {
-						matchCount++
-					}
-				}
-			}
-
+			matchCount := countProbeMatches(index, md.ProbeHashes)
 			matchPercent := float64(matchCount) / float64(md.HashCount) * 100
 			results[i] = append(results[i], ProbeResult{
 				MKVPath:      md.Path,
@@ -199,6 +193,27 @@ func probe(mkvPaths []string, sourceDirs []string) error {
 	return nil
 }
 
+// countProbeMatches returns the number of probe hashes found in a source
+// index, counting ES-indexed hashes only against the same kind of stream.
+func countProbeMatches(index *source.Index, hashes []matcher.ProbeHash) int {
+	matchCount := 0
+	for _, ph := range hashes {
+		if locs := index.Lookup(ph.Hash); len(locs) > 0 {
+			if index.UsesESOffsets {
+				for _, loc := range locs {
+					if loc.IsVideo == ph.IsVideo {
+						matchCount++
+						break
+					}
+				}
+			} else {
+				matchCount++
+			}
+		}
+	}
+	return matchCount
+}
+
 // computeProbeHashes parses an MKV and returns its probe hashes.
 func computeProbeHashes(mkvPath string, windowSize int) ([]matcher.ProbeHash, error) {
 	parser, _, err := parseMKVWithProgress(mkvPath, "")
@@ -206,7 +221,12 @@ func computeProbeHashes(mkvPath string, windowSize int) ([]matcher.ProbeHash, er
 		return nil, err
 	}
 	defer parser.Close()
+	return probeHashesFromParser(parser, mkvPath, windowSize)
+}
 
+// probeHashesFromParser returns the probe hashes of a parsed MKV: one for
+// each of a sample of packets spread across the file.
+func probeHashesFromParser(parser *mkv.Parser, mkvPath string, windowSize int) ([]matcher.ProbeHash, error) {
 	packets := parser.Packets()
 	if len(packets) == 0 {
 		return nil, fmt.Errorf("no packets found in MKV")
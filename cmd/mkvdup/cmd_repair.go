@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// repairOptions configures repairDedupFile.
+type repairOptions struct {
+	sourceDir string // Source directory ("" to read it from the sidecar config)
+	fromMKV   string // The original MKV, or a reconstructed copy of it
+	fromDedup string // A backup of the dedup file, or another dedup file of the same MKV
+	dryRun    bool
+}
+
+// repairDedupFile finds the damage in a dedup file and repairs it from the
+// reference copy in opts, if any. Without one it reports which MKV byte
+// ranges, clusters and timestamps cannot be recovered, and fails.
+func repairDedupFile(dedupPath string, opts repairOptions) error {
+	// A byte-for-byte backup is the most complete repair: it also covers
+	// the header and the other sections no checksum protects.
+	if opts.fromDedup != "" {
+		patches, err := dedup.PatchFromCopy(dedupPath, opts.fromDedup, opts.dryRun)
+		if err == nil {
+			return reportPatches(dedupPath, opts.fromDedup, patches, opts.dryRun)
+		}
+		if !errors.Is(err, dedup.ErrDifferentLayout) {
+			return err
+		}
+		printInfo("%s is laid out differently; using it as a copy of the original MKV\n", opts.fromDedup)
+	}
+
+	sourceDir := opts.sourceDir
+	if sourceDir == "" {
+		// Without a reference the sources only help to locate clusters
+		dir, err := sidecarSourceDir(dedupPath)
+		if err != nil && (opts.fromMKV != "" || opts.fromDedup != "") {
+			return err
+		}
+		sourceDir = dir
+	}
+
+	reader, err := dedup.NewReaderLazy(dedupPath, sourceDir)
+	if err != nil {
+		return fmt.Errorf("open dedup file: %w (only a backup copy can restore it, with --from-dedup)", err)
+	}
+	defer reader.Close()
+
+	damage := reader.FindDamage()
+	if damage.OK() {
+		printInfo("%s: no damage found\n", dedupPath)
+		return nil
+	}
+	printDamage(dedupPath, damage)
+
+	if opts.fromMKV == "" && opts.fromDedup == "" {
+		if sourceDir != "" {
+			// Clusters are found through source data too, where readable
+			_ = reader.LoadSourceFiles()
+		}
+		printDamagedRanges(reader, damage)
+		if len(damage.Ranges) == 0 {
+			return fmt.Errorf("the damage could not be located; repair it with --from-mkv or --from-dedup")
+		}
+		return fmt.Errorf("%s of the original MKV cannot be recovered without a reference copy (--from-mkv or --from-dedup)",
+			formatSize(damagedBytes(damage)))
+	}
+	if opts.dryRun {
+		fmt.Printf("%s: would repair from %s\n", dedupPath, opts.fromMKV+opts.fromDedup)
+		return nil
+	}
+
+	ref, closeRef, err := openRepairReference(opts, sourceDir, reader.OriginalSize(), reader.OriginalChecksum())
+	if err != nil {
+		return err
+	}
+	defer closeRef()
+	if err := reader.LoadSourceFiles(); err != nil {
+		return fmt.Errorf("load source files: %w", err)
+	}
+
+	stat, err := os.Stat(dedupPath)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dedupPath), "."+filepath.Base(dedupPath)+".repair-*")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath) // No-op once renamed into place
+
+	compareBar := newProgressBar("Comparing with reference...", reader.OriginalSize(), "bytes")
+	var writeBar *progressBar
+	res, err := reader.WriteRepaired(tmpPath, ref, func(done, _ int64) {
+		compareBar.Update(done)
+	}, func(written, total int64) {
+		if writeBar == nil {
+			compareBar.Finish()
+			writeBar = newProgressBar("Writing repaired file...", total, "bytes")
+		}
+		writeBar.Update(written)
+	})
+	if err != nil {
+		compareBar.Cancel()
+		if writeBar != nil {
+			writeBar.Cancel()
+		}
+		return fmt.Errorf("write repaired file: %w", err)
+	}
+	if writeBar != nil {
+		writeBar.Finish()
+	}
+
+	if err := verifyRewrittenFile(tmpPath, sourceDir, reader.OriginalChecksum()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, stat.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod repaired file: %w", err)
+	}
+	if err := os.Rename(tmpPath, dedupPath); err != nil {
+		return fmt.Errorf("replace dedup file: %w", err)
+	}
+	printInfo("Repaired %s: %s of delta corrected, %s restored from the reference\n",
+		dedupPath, formatSize(res.PatchedDelta), formatSize(res.Restored))
+	return nil
+}
+
+// reportPatches prints the ranges PatchFromCopy rewrote (or would rewrite)
+// and checks the patched file.
+func reportPatches(dedupPath, backupPath string, patches []dedup.PatchedRange, dryRun bool) error {
+	if len(patches) == 0 {
+		printInfo("%s: identical to %s; nothing to repair\n", dedupPath, backupPath)
+		return nil
+	}
+	verb := "Patched"
+	if dryRun {
+		verb = "Would patch"
+	}
+	fmt.Printf("%s %d %s of %s from %s:\n", verb, len(patches), plural(len(patches), "region", "regions"), dedupPath, backupPath)
+	for _, p := range patches {
+		fmt.Printf("  offset %s: %s (%s)\n", formatInt(p.Offset), formatSize(p.Length), p.Section)
+	}
+	if dryRun {
+		return nil
+	}
+
+	reader, err := dedup.NewReader(dedupPath, "")
+	if err != nil {
+		return fmt.Errorf("open patched file: %w", err)
+	}
+	defer reader.Close()
+	if err := reader.VerifyIntegrity(); err != nil {
+		return fmt.Errorf("patched file integrity: %w", err)
+	}
+	return nil
+}
+
+// openRepairReference opens the reference copy of the original MKV named in
+// opts and checks it against the original's size and checksum.
+func openRepairReference(opts repairOptions, sourceDir string, size int64, checksum uint64) (io.ReaderAt, func(), error) {
+	var ref io.ReaderAt
+	var closeRef func()
+	if opts.fromMKV != "" {
+		f, err := os.Open(opts.fromMKV)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open reference: %w", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if info.Size() != size {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s is %s bytes, but the original MKV was %s", opts.fromMKV, formatInt(info.Size()), formatInt(size))
+		}
+		ref, closeRef = f, func() { f.Close() }
+	} else {
+		r, err := openDedupReader(opts.fromDedup, sourceDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reference %s: %w", opts.fromDedup, err)
+		}
+		if r.OriginalSize() != size {
+			r.Close()
+			return nil, nil, fmt.Errorf("%s reconstructs %s bytes, but the original MKV was %s", opts.fromDedup, formatInt(r.OriginalSize()), formatInt(size))
+		}
+		ref, closeRef = r, func() { r.Close() }
+	}
+
+	got, err := checksumReaderAt(ref, size, "Verifying reference...")
+	if err != nil {
+		closeRef()
+		return nil, nil, fmt.Errorf("reference: %w", err)
+	}
+	if got != checksum {
+		closeRef()
+		return nil, nil, fmt.Errorf("reference has checksum %016x, but the original MKV had %016x", got, checksum)
+	}
+	return ref, closeRef, nil
+}
+
+// printDamage prints which sections of a dedup file are damaged, and the
+// damage that could not be located.
+func printDamage(dedupPath string, d *dedup.Damage) {
+	var sections []string
+	if d.Index {
+		sections = append(sections, "index")
+	}
+	if d.Delta {
+		sections = append(sections, "delta")
+	}
+	if d.RangeMap {
+		sections = append(sections, "range maps")
+	}
+	if len(sections) == 0 {
+		sections = append(sections, "structure")
+	}
+	fmt.Printf("%s: damaged %s\n", dedupPath, strings.Join(sections, ", "))
+	for _, u := range d.Unlocated {
+		fmt.Printf("  %s\n", u)
+	}
+}
+
+// printDamagedRanges prints each damaged MKV range with the clusters and
+// play times it spans. Clusters are found by reading the MKV around the
+// damage, so they are only as complete as the readable data.
+func printDamagedRanges(reader *dedup.Reader, d *dedup.Damage) {
+	if len(d.Ranges) == 0 {
+		return
+	}
+	skip := make([]mkv.ByteRange, len(d.Ranges))
+	for i, dr := range d.Ranges {
+		skip[i] = mkv.ByteRange{Start: dr.Start, End: dr.End}
+	}
+	clusters := mkv.ScanClusters(reader, reader.OriginalSize(), skip)
+	var duration time.Duration
+	if m := reader.Metadata(); m != nil {
+		duration = m.Duration
+	}
+
+	fmt.Println("Unrecoverable ranges of the original MKV:")
+	for _, dr := range d.Ranges {
+		fmt.Printf("  bytes %s-%s (%s): %s\n", formatInt(dr.Start), formatInt(dr.End-1), formatSize(dr.End-dr.Start), dr.Cause)
+		fmt.Printf("    %s\n", describeClusterSpan(clusters, dr.Start, dr.End, duration))
+	}
+}
+
+// describeClusterSpan describes the clusters that MKV bytes [start, end)
+// fall in, e.g. "clusters 12-13, 00:01:02-00:01:07". Clusters are numbered
+// from 1 in the order found; duration ends the last cluster, if known.
+func describeClusterSpan(clusters []mkv.ClusterPosition, start, end int64, duration time.Duration) string {
+	if len(clusters) == 0 {
+		return "cluster positions unknown: the MKV structure could not be read"
+	}
+	first := sort.Search(len(clusters), func(i int) bool { return clusters[i].Offset > start }) - 1
+	last := sort.Search(len(clusters), func(i int) bool { return clusters[i].Offset >= end }) - 1
+	if last < 0 {
+		return "MKV headers, before the first cluster"
+	}
+
+	var desc string
+	if first < 0 {
+		desc = "MKV headers and "
+		first = 0
+	}
+	if first == last {
+		desc += fmt.Sprintf("cluster %d", first+1)
+	} else {
+		desc += fmt.Sprintf("clusters %d-%d", first+1, last+1)
+	}
+
+	from, to := "?", "end"
+	if ts := clusters[first].Timestamp; ts >= 0 {
+		from = formatDuration(ts.Truncate(time.Second))
+	}
+	if last+1 < len(clusters) {
+		to = "?"
+		if ts := clusters[last+1].Timestamp; ts >= 0 {
+			to = formatDuration((ts + time.Second - 1).Truncate(time.Second))
+		}
+	} else if duration > 0 {
+		to = formatDuration((duration + time.Second - 1).Truncate(time.Second))
+	}
+	return fmt.Sprintf("%s, %s-%s", desc, from, to)
+}
+
+// damagedBytes returns the number of MKV bytes in the damaged ranges.
+func damagedBytes(d *dedup.Damage) int64 {
+	var n int64
+	for _, dr := range d.Ranges {
+		n += dr.End - dr.Start
+	}
+	return n
+}
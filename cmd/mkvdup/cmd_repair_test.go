@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// damageDelta inverts a few bytes of original's data in the uncompressed
+// delta of the dedup file at path.
+func damageDelta(t *testing.T, path string, original []byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	i := bytes.Index(data, original)
+	if i < 0 {
+		t.Fatal("original data not found in the delta")
+	}
+	for j := i + 40; j < i+48; j++ {
+		data[j] ^= 0xFF
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestRepairDedupFile(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	original := []byte(strings.Repeat("original mkv data ", 20))
+	createExtractableDedup(t, dedupPath, sourceDir, original)
+	if err := dedup.WriteConfig(dedupPath+".yaml", "movie.mkv", dedupPath, sourceDir); err != nil {
+		t.Fatalf("WriteConfig: %v", err)
+	}
+	good, err := os.ReadFile(dedupPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	backupPath := filepath.Join(dir, "backup.mkvdup")
+	if err := os.WriteFile(backupPath, good, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	mkvPath := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(mkvPath, original, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := repairDedupFile(dedupPath, repairOptions{}); err != nil {
+		t.Errorf("repairDedupFile(intact): %v", err)
+	}
+
+	damageDelta(t, dedupPath, original)
+	damaged, _ := os.ReadFile(dedupPath)
+	if err := repairDedupFile(dedupPath, repairOptions{}); err == nil {
+		t.Error("repairDedupFile without a reference succeeded on a damaged file")
+	}
+	if err := repairDedupFile(dedupPath, repairOptions{fromMKV: mkvPath, dryRun: true}); err != nil {
+		t.Errorf("repairDedupFile(dry run): %v", err)
+	}
+	if data, _ := os.ReadFile(dedupPath); !bytes.Equal(data, damaged) {
+		t.Error("dry run changed the file")
+	}
+
+	if err := repairDedupFile(dedupPath, repairOptions{fromDedup: backupPath}); err != nil {
+		t.Fatalf("repairDedupFile(--from-dedup): %v", err)
+	}
+	if data, _ := os.ReadFile(dedupPath); !bytes.Equal(data, good) {
+		t.Error("file patched from backup differs from the backup")
+	}
+
+	damageDelta(t, dedupPath, original)
+	if err := repairDedupFile(dedupPath, repairOptions{fromMKV: mkvPath}); err != nil {
+		t.Fatalf("repairDedupFile(--from-mkv): %v", err)
+	}
+	outPath := filepath.Join(dir, "out.mkv")
+	if err := extractDedup(dedupPath, sourceDir, outPath); err != nil {
+		t.Fatalf("extractDedup: %v", err)
+	}
+	if got, _ := os.ReadFile(outPath); !bytes.Equal(got, original) {
+		t.Error("repaired file extracts different data")
+	}
+
+	// A reference that is not the original MKV is refused.
+	damageDelta(t, dedupPath, original)
+	wrong := bytes.ToUpper(original)
+	if err := os.WriteFile(mkvPath, wrong, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := repairDedupFile(dedupPath, repairOptions{fromMKV: mkvPath}); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("repairDedupFile(wrong reference) = %v, want checksum error", err)
+	}
+}
+
+func TestDescribeClusterSpan(t *testing.T) {
+	clusters := []mkv.ClusterPosition{
+		{Offset: 1000, Timestamp: 0},
+		{Offset: 5000, Timestamp: 61500 * time.Millisecond},
+		{Offset: 9000, Timestamp: -1},
+		{Offset: 13000, Timestamp: 185 * time.Second},
+	}
+	for _, tt := range []struct {
+		name       string
+		clusters   []mkv.ClusterPosition
+		start, end int64
+		duration   time.Duration
+		want       string
+	}{
+		{"no clusters", nil, 0, 10, 0, "cluster positions unknown: the MKV structure could not be read"},
+		{"headers", clusters, 10, 500, 0, "MKV headers, before the first cluster"},
+		{"headers and cluster", clusters, 500, 1500, 0, "MKV headers and cluster 1, 00:00:00-00:01:02"},
+		{"one cluster", clusters, 5100, 5200, 0, "cluster 2, 00:01:01-?"},
+		{"several clusters", clusters, 4000, 9500, 0, "clusters 1-3, 00:00:00-00:03:05"},
+		{"last cluster", clusters, 14000, 15000, 190 * time.Second, "cluster 4, 00:03:05-00:03:10"},
+		{"last cluster without duration", clusters, 14000, 15000, 0, "cluster 4, 00:03:05-end"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeClusterSpan(tt.clusters, tt.start, tt.end, tt.duration); got != tt.want {
+				t.Errorf("describeClusterSpan = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,9 +14,12 @@ type fileStats struct {
 	sourceDir   string
 	origSize    int64
 	dedupSize   int64
+	deltaSize   int64 // Logical (uncompressed) delta size
+	deltaStored int64 // On-disk delta section size
 	sourceType  string
 	sourceFiles int
 	entryCount  int
+	metadata    *dedup.Metadata
 	err         error
 }
 
@@ -86,12 +89,21 @@ func collectFileStats(cfg dedup.Config) fileStats {
 	fs.origSize = info["original_size"].(int64)
 	fs.sourceFiles = info["source_file_count"].(int)
 	fs.entryCount = info["entry_count"].(int)
+	fs.deltaSize = info["delta_size"].(int64)
+	fs.deltaStored = info["delta_stored_size"].(int64)
+	fs.metadata = reader.Metadata()
 
 	switch info["source_type"].(uint8) {
 	case 0:
 		fs.sourceType = "DVD"
 	case 1:
 		fs.sourceType = "Blu-ray"
+	case 2:
+		fs.sourceType = "MPEG-TS"
+	case 3:
+		fs.sourceType = "MP4"
+	case 4:
+		fs.sourceType = "MKV"
 	default:
 		fs.sourceType = "Unknown"
 	}
@@ -114,6 +126,9 @@ func printFileStats(fs fileStats) {
 	}
 
 	printInfo("%s\n", fs.name)
+	if fs.metadata != nil {
+		printInfo("  Contents:          %s\n", summarizeMetadata(fs.metadata))
+	}
 	printInfo("  Original size:     %s bytes (%s)\n", formatInt(fs.origSize), formatSize(fs.origSize))
 	printInfo("  Dedup file size:   %s bytes (%s)\n", formatInt(fs.dedupSize), formatSize(fs.dedupSize))
 	printInfo("  Space savings:     %s bytes (%.2f%%)\n", formatInt(fs.origSize-fs.dedupSize), savings)
@@ -121,12 +136,13 @@ func printFileStats(fs fileStats) {
 	printInfo("  Source directory:  %s\n", fs.sourceDir)
 	printInfo("  Source files:      %d\n", fs.sourceFiles)
 	printInfo("  Index entries:     %s\n", formatInt(int64(fs.entryCount)))
+	printDeltaStats(fs.deltaSize, fs.deltaStored)
 	printInfoln()
 }
 
 // printRollupStats prints aggregate statistics across all successful files.
 func printRollupStats(stats []fileStats) {
-	var totalOrig, totalDedup int64
+	var totalOrig, totalDedup, totalDelta, totalDeltaStored int64
 	var succeeded int
 	uniqueSources := map[string]struct{}{}
 
@@ -137,6 +153,8 @@ func printRollupStats(stats []fileStats) {
 		succeeded++
 		totalOrig += fs.origSize
 		totalDedup += fs.dedupSize
+		totalDelta += fs.deltaSize
+		totalDeltaStored += fs.deltaStored
 		uniqueSources[fs.sourceDir] = struct{}{}
 	}
 
@@ -153,5 +171,19 @@ func printRollupStats(stats []fileStats) {
 	printInfo("  Original size:     %s bytes (%s)\n", formatInt(totalOrig), formatSize(totalOrig))
 	printInfo("  Dedup file size:   %s bytes (%s)\n", formatInt(totalDedup), formatSize(totalDedup))
 	printInfo("  Space savings:     %s bytes (%.2f%%)\n", formatInt(totalOrig-totalDedup), savings)
+	printDeltaStats(totalDelta, totalDeltaStored)
 	printInfo("  Unique sources:    %d\n", len(uniqueSources))
 }
+
+// printDeltaStats prints the logical delta size and, when the delta is
+// stored compressed, its on-disk size.
+func printDeltaStats(logical, stored int64) {
+	printInfo("  Delta size:        %s bytes (%s)\n", formatInt(logical), formatSize(logical))
+	if stored != logical {
+		pct := float64(100)
+		if logical > 0 {
+			pct = float64(stored) / float64(logical) * 100
+		}
+		printInfo("  Delta stored:      %s bytes (%s, %.1f%% of delta size)\n", formatInt(stored), formatSize(stored), pct)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/dedup"
 )
 
 func TestShowStats_SingleFile(t *testing.T) {
@@ -182,3 +185,49 @@ source_dir: %q
 		t.Errorf("rollup should not appear with only 1 successful file\n\nFull output:\n%s", output)
 	}
 }
+
+func TestPrintDeltaStats(t *testing.T) {
+	output := captureStdout(t, func() {
+		printDeltaStats(1000, 1000)
+	})
+	if !strings.Contains(output, "Delta size:        1,000 bytes") {
+		t.Errorf("missing delta size\n\nFull output:\n%s", output)
+	}
+	if strings.Contains(output, "Delta stored:") {
+		t.Errorf("uncompressed delta should not report a stored size\n\nFull output:\n%s", output)
+	}
+
+	output = captureStdout(t, func() {
+		printDeltaStats(1000, 250)
+	})
+	if !strings.Contains(output, "Delta stored:      250 bytes") || !strings.Contains(output, "25.0% of delta size") {
+		t.Errorf("missing compressed delta size\n\nFull output:\n%s", output)
+	}
+}
+
+func TestSummarizeMetadata(t *testing.T) {
+	m := &dedup.Metadata{
+		Title:    "Movie",
+		Duration: 90*time.Minute + 21*time.Second,
+		Chapters: 28,
+		Tracks: []dedup.TrackMetadata{
+			{Number: 1, Type: "video", CodecID: "V_MPEG2", Language: "eng", Default: true, PixelWidth: 720, PixelHeight: 480},
+			{Number: 2, Type: "audio", CodecID: "A_AC3", Language: "eng", Default: true, Channels: 6, SampleRate: 48000},
+			{Number: 3, Type: "audio", CodecID: "A_AC3", Language: "fre", Name: "Commentary", Channels: 2, SampleRate: 48000},
+			{Number: 4, Type: "subtitle", CodecID: "S_VOBSUB", Language: "eng", Forced: true},
+		},
+	}
+	if got, want := summarizeMetadata(m), `"Movie", 01:30:21, 1 video, 2 audio, 1 subtitle, 28 chapters`; got != want {
+		t.Errorf("summarizeMetadata() = %q, want %q", got, want)
+	}
+	for i, want := range []string{
+		"1: video V_MPEG2, 720x480 (eng, default)",
+		"2: audio A_AC3, 6 ch, 48000 Hz (eng, default)",
+		`3: audio A_AC3, 2 ch, 48000 Hz, "Commentary" (fre)`,
+		"4: subtitle S_VOBSUB (eng, forced)",
+	} {
+		if got := describeTrack(m.Tracks[i]); got != want {
+			t.Errorf("describeTrack(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
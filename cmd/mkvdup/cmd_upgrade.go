@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/dedup"
+)
+
+// upgradeTarget is a dedup file to upgrade and the source directory its
+// reconstruction is verified against.
+type upgradeTarget struct {
+	dedupFile string
+	sourceDir string
+}
+
+// resolveUpgradeTargets returns the dedup files to upgrade. With configDir,
+// args is a directory of configs naming the dedup files and their sources.
+// Otherwise args are dedup files, whose source directory is sourceDir if
+// set, or read from their .mkvdup.yaml sidecar.
+func resolveUpgradeTargets(args []string, configDir bool, sourceDir string) ([]upgradeTarget, error) {
+	var targets []upgradeTarget
+	if configDir {
+		configPaths, err := resolveConfigPaths(args, true)
+		if err != nil {
+			return nil, err
+		}
+		configs, _, _, err := dedup.ResolveConfigs(configPaths)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, cfg := range configs {
+			if seen[cfg.DedupFile] {
+				continue
+			}
+			seen[cfg.DedupFile] = true
+			targets = append(targets, upgradeTarget{dedupFile: cfg.DedupFile, sourceDir: cfg.SourceDir})
+		}
+		return targets, nil
+	}
+
+	for _, path := range args {
+		if sourceDir != "" {
+			targets = append(targets, upgradeTarget{dedupFile: path, sourceDir: sourceDir})
+			continue
+		}
+		dir, err := sidecarSourceDir(path)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, upgradeTarget{dedupFile: path, sourceDir: dir})
+	}
+	return targets, nil
+}
+
+// sidecarSourceDir returns the source directory of a dedup file from its
+// .mkvdup.yaml sidecar config.
+func sidecarSourceDir(path string) (string, error) {
+	sidecar := path + ".yaml"
+	if _, err := os.Stat(sidecar); err != nil {
+		return "", fmt.Errorf("%s: no config at %s to find the source directory (use --source-dir)", path, sidecar)
+	}
+	configs, _, _, err := dedup.ResolveConfigs([]string{sidecar})
+	if err != nil {
+		return "", err
+	}
+	if len(configs) == 0 {
+		return "", fmt.Errorf("%s: config %s names no dedup file", path, sidecar)
+	}
+	return configs[0].SourceDir, nil
+}
+
+// upgradeDedupFiles upgrades each dedup file to the newest format version,
+// continuing past failures and reporting how many there were.
+func upgradeDedupFiles(args []string, configDir bool, sourceDir string, dryRun bool) error {
+	targets, err := resolveUpgradeTargets(args, configDir, sourceDir)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, t := range targets {
+		if err := upgradeDedupFile(t.dedupFile, t.sourceDir, dryRun); err != nil {
+			printWarn("%s: %v\n", t.dedupFile, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to upgrade", failed, len(targets))
+	}
+	return nil
+}
+
+// upgradeDedupFile rewrites a dedup file in the newest format version. The
+// new file is written beside the old one, and replaces it only once its
+// reconstruction matches the original MKV's checksum.
+func upgradeDedupFile(dedupPath, sourceDir string, dryRun bool) error {
+	reader, err := dedup.NewReaderLazy(dedupPath, sourceDir)
+	if err != nil {
+		return fmt.Errorf("open dedup file: %w", err)
+	}
+	fromVersion := reader.Version()
+	needsUpgrade := reader.NeedsUpgrade()
+	reader.Close()
+	if !needsUpgrade {
+		printInfo("%s: already version %d\n", dedupPath, fromVersion)
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("%s: would upgrade from version %d\n", dedupPath, fromVersion)
+		return nil
+	}
+
+	printInfo("Upgrading %s (version %d)\n", dedupPath, fromVersion)
+	reader, err = openDedupReader(dedupPath, sourceDir)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	stat, err := os.Stat(dedupPath)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dedupPath), "."+filepath.Base(dedupPath)+".upgrade-*")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath) // No-op once renamed into place
+
+	creator := fmt.Sprintf("mkvdup %s (upgraded from version %d)", version, fromVersion)
+	if orig := reader.CreatorVersion(); orig != "" {
+		creator = fmt.Sprintf("mkvdup %s (upgraded from version %d, created by %s)", version, fromVersion, orig)
+	}
+	writeBar := newProgressBar("Writing upgraded file...", 0, "bytes")
+	toVersion, err := reader.WriteUpgraded(tmpPath, creator, func(written, total int64) {
+		if writeBar.total == 0 && total > 0 {
+			writeBar.total = total
+		}
+		writeBar.Update(written)
+	})
+	if err != nil {
+		writeBar.Cancel()
+		return fmt.Errorf("write upgraded file: %w", err)
+	}
+	writeBar.Finish()
+
+	if err := verifyRewrittenFile(tmpPath, sourceDir, reader.OriginalChecksum()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, stat.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod upgraded file: %w", err)
+	}
+	if err := os.Rename(tmpPath, dedupPath); err != nil {
+		return fmt.Errorf("replace dedup file: %w", err)
+	}
+	printInfo("Upgraded %s from version %d to %d\n", dedupPath, fromVersion, toVersion)
+	return nil
+}
+
+// verifyRewrittenFile checks that the dedup file at path, written to
+// replace another, reconstructs data with the xxhash checksum want.
+func verifyRewrittenFile(path, sourceDir string, want uint64) error {
+	reader, err := dedup.NewReader(path, sourceDir)
+	if err != nil {
+		return fmt.Errorf("open new file: %w", err)
+	}
+	defer reader.Close()
+	if err := reader.VerifyIntegrity(); err != nil {
+		return fmt.Errorf("new file integrity: %w", err)
+	}
+	if err := reader.LoadSourceFiles(); err != nil {
+		return fmt.Errorf("load source files: %w", err)
+	}
+
+	got, err := checksumReaderAt(reader, reader.OriginalSize(), "Verifying reconstruction...")
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("new file reconstructs checksum %016x, want %016x; original left unchanged", got, want)
+	}
+	return nil
+}
+
+// checksumReaderAt returns the xxhash checksum of the first size bytes of
+// r, showing progress under label.
+func checksumReaderAt(r io.ReaderAt, size int64, label string) (uint64, error) {
+	bar := newProgressBar(label, size, "bytes")
+	defer bar.Cancel() // clean up if we return early on error
+
+	hasher := xxhash.New()
+	const chunkSize = 4 * 1024 * 1024
+	buf := make([]byte, chunkSize)
+	var offset int64
+	for offset < size {
+		n, err := r.ReadAt(buf[:min(int64(chunkSize), size-offset)], offset)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("read at offset %d: %w", offset, err)
+		}
+		if n == 0 {
+			return 0, fmt.Errorf("data ends at offset %d of %d", offset, size)
+		}
+		hasher.Write(buf[:n])
+		offset += int64(n)
+		bar.Update(offset)
+	}
+	bar.Finish()
+	return hasher.Sum64(), nil
+}
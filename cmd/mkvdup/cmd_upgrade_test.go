@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/dedup"
+)
+
+// dedupVersion returns the format version of the dedup file at path.
+func dedupVersion(t *testing.T, path string) uint32 {
+	t.Helper()
+	reader, err := dedup.NewReaderLazy(path, "")
+	if err != nil {
+		t.Fatalf("NewReaderLazy: %v", err)
+	}
+	defer reader.Close()
+	return reader.Version()
+}
+
+func TestUpgradeDedupFiles(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	original := []byte(strings.Repeat("original mkv data ", 20))
+	createExtractableDedup(t, dedupPath, sourceDir, original)
+	if err := os.Chmod(dedupPath, 0600); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	if err := dedup.WriteConfig(dedupPath+".yaml", "movie.mkv", dedupPath, sourceDir); err != nil {
+		t.Fatalf("WriteConfig: %v", err)
+	}
+	if v := dedupVersion(t, dedupPath); v != dedup.Version {
+		t.Fatalf("version = %d, want %d", v, dedup.Version)
+	}
+
+	if err := upgradeDedupFiles([]string{dedupPath}, false, "", true); err != nil {
+		t.Fatalf("upgradeDedupFiles(dry run): %v", err)
+	}
+	if v := dedupVersion(t, dedupPath); v != dedup.Version {
+		t.Errorf("dry run changed version to %d", v)
+	}
+
+	if err := upgradeDedupFiles([]string{dedupPath}, false, "", false); err != nil {
+		t.Fatalf("upgradeDedupFiles: %v", err)
+	}
+	if v := dedupVersion(t, dedupPath); v != dedup.VersionCompactIndex {
+		t.Errorf("version = %d, want %d", v, dedup.VersionCompactIndex)
+	}
+	if info, err := os.Stat(dedupPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("upgraded file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	outPath := filepath.Join(dir, "out.mkv")
+	if err := extractDedup(dedupPath, sourceDir, outPath); err != nil {
+		t.Fatalf("extractDedup: %v", err)
+	}
+	if got, _ := os.ReadFile(outPath); string(got) != string(original) {
+		t.Error("upgraded file extracts different data")
+	}
+
+	// Upgrading again is a no-op.
+	if err := upgradeDedupFiles([]string{dedupPath}, false, "", false); err != nil {
+		t.Errorf("upgradeDedupFiles(current): %v", err)
+	}
+}
+
+func TestUpgradeDedupFiles_ChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	createExtractableDedup(t, dedupPath, sourceDir, []byte("original mkv data"))
+
+	// Corrupt the header's OriginalChecksum, which no footer checksum covers.
+	data, err := os.ReadFile(dedupPath)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	data[24] ^= 0xFF
+	if err := os.WriteFile(dedupPath, data, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	err = upgradeDedupFiles([]string{dedupPath}, false, sourceDir, false)
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 files failed") {
+		t.Errorf("upgradeDedupFiles = %v, want failure", err)
+	}
+	if v := dedupVersion(t, dedupPath); v != dedup.Version {
+		t.Errorf("failed upgrade replaced the file (version %d)", v)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".upgrade-") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestResolveUpgradeTargets(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := resolveUpgradeTargets([]string{filepath.Join(dir, "a.mkvdup")}, false, ""); err == nil ||
+		!strings.Contains(err.Error(), "--source-dir") {
+		t.Errorf("missing sidecar error = %v, want hint to use --source-dir", err)
+	}
+
+	configDir := filepath.Join(dir, "configs")
+	writeTestYAML(t, filepath.Join(configDir, "a.yaml"), "name: a.mkv\ndedup_file: /data/a.mkvdup\nsource_dir: /src/a\n")
+	writeTestYAML(t, filepath.Join(configDir, "b.yaml"), "name: b.mkv\ndedup_file: /data/a.mkvdup\nsource_dir: /src/a\n")
+	targets, err := resolveUpgradeTargets([]string{configDir}, true, "")
+	if err != nil {
+		t.Fatalf("resolveUpgradeTargets: %v", err)
+	}
+	if len(targets) != 1 || targets[0].dedupFile != "/data/a.mkvdup" || targets[0].sourceDir != "/src/a" {
+		t.Errorf("targets = %+v, want the shared dedup file once", targets)
+	}
+}
@@ -235,8 +235,12 @@ func runDeepValidation(entries []validationEntry, configs []dedup.Config) bool {
 			hasErrors = true
 			continue
 		}
+		metadata := reader.Metadata()
 		reader.Close()
 		fmt.Printf("  OK   %s: checksums valid\n", cfg.Name)
+		if metadata != nil {
+			fmt.Printf("       %s\n", summarizeMetadata(metadata))
+		}
 	}
 	return hasErrors
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -107,6 +108,36 @@ func verifyReconstruction(dedupPath, sourceDir, originalPath string, index *sour
 	return nil
 }
 
+// verifyStreamReconstructionFunc is the function used for post-create
+// verification of an MKV read from a pipe. It can be overridden in tests.
+var verifyStreamReconstructionFunc = verifyStreamReconstruction
+
+// verifyStreamReconstruction verifies that the dedup file reconstructs data
+// of the original MKV's size and checksum, for an original that cannot be
+// read again to compare with.
+func verifyStreamReconstruction(dedupPath, sourceDir string, size int64, checksum uint64, phasePrefix string) error {
+	reader, err := dedup.NewReader(dedupPath, sourceDir)
+	if err != nil {
+		return fmt.Errorf("open dedup file: %w", err)
+	}
+	defer reader.Close()
+
+	if err := reader.LoadSourceFiles(); err != nil {
+		return fmt.Errorf("load source files: %w", err)
+	}
+	if reader.OriginalSize() != size {
+		return fmt.Errorf("size mismatch: original=%d, reconstructed=%d", size, reader.OriginalSize())
+	}
+	got, err := checksumReaderAt(reader, size, phasePrefix)
+	if err != nil {
+		return fmt.Errorf("read reconstructed: %w", err)
+	}
+	if got != checksum {
+		return fmt.Errorf("checksum mismatch: original=%016x, reconstructed=%016x", checksum, got)
+	}
+	return nil
+}
+
 // openDedupReader opens a dedup file with its source directory, verifies
 // integrity, loads source files, and checks source file sizes. This is the
 // shared preamble for verify, extract, and similar commands.
@@ -170,6 +201,16 @@ func verifyDedup(dedupPath, sourceDir, originalPath string) error {
 	}
 	defer original.Close()
 
+	// Files with extended checksums also have the reconstruction's digest checked
+	checksums := reader.ExtendedChecksums()
+	var digest hash.Hash
+	if checksums != nil {
+		digest, err = dedup.NewChecksumHash(checksums.Algorithm)
+		if err != nil {
+			printWarn("Warning: %v; skipping extended checksum verification\n", err)
+		}
+	}
+
 	totalSize := reader.OriginalSize()
 	bar := newProgressBar("Verifying reconstruction...", totalSize, "bytes")
 	defer bar.Cancel() // clean up if we return early on error
@@ -208,11 +249,23 @@ func verifyDedup(dedupPath, sourceDir, originalPath string) error {
 			return fmt.Errorf("read reconstructed: %w", err2)
 		}
 
+		if digest != nil {
+			digest.Write(reconstructedBuf[:n2])
+		}
 		offset += int64(n1)
 		bar.Update(offset)
 	}
 	bar.Finish()
 
+	if digest != nil {
+		printInfo("Verifying %s checksum...", checksums.Algorithm)
+		if got := digest.Sum(nil); !bytes.Equal(got, checksums.Original) {
+			printInfoln(" FAILED")
+			return fmt.Errorf("%s mismatch: expected %x, got %x", checksums.Algorithm, checksums.Original, got)
+		}
+		printInfoln(" OK")
+	}
+
 	printInfoln()
 	printInfoln("Verification PASSED")
 	return nil
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"crypto/sha256"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
 )
 
 // --- check command tests ---
@@ -146,6 +153,170 @@ func TestCheckDedup_SkipsChecksumOnSizeError(t *testing.T) {
 	}
 }
 
+// createChecksummedDedup creates a dedup file like createExtractableDedup,
+// with sha256 extended checksums of originalSum and sourceSum.
+func createChecksummedDedup(t *testing.T, dedupPath, sourceDir string, originalData, originalSum, sourceSum []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("mkdir source: %v", err)
+	}
+	srcContent := []byte("source data")
+	if err := os.WriteFile(filepath.Join(sourceDir, "test.vob"), srcContent, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	writer, err := dedup.NewWriter(dedupPath)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer writer.Close()
+	writer.SetHeader(int64(len(originalData)), xxhash.Sum64(originalData), source.TypeDVD)
+	writer.SetSourceFiles([]source.File{
+		{RelativePath: "test.vob", Size: int64(len(srcContent)), Checksum: xxhash.Sum64(srcContent)},
+	})
+	writer.SetExtendedChecksums(&dedup.ExtendedChecksums{
+		Algorithm: dedup.ChecksumSHA256,
+		Original:  originalSum,
+		Sources:   [][]byte{sourceSum},
+	})
+	if err := writer.SetMatchResult(&matcher.Result{
+		Entries:   []matcher.Entry{{MkvOffset: 0, Length: int64(len(originalData)), Source: 0, SourceOffset: 0}},
+		DeltaData: originalData,
+	}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := writer.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func TestCheckDedup_ExtendedChecksums(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	original := []byte("original data")
+
+	createChecksummedDedup(t, dedupPath, sourceDir, original, sha256Sum(original), sha256Sum([]byte("source data")))
+	if err := checkDedup(dedupPath, sourceDir, true); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	// The xxhash still matches, but the stored sha256 does not.
+	createChecksummedDedup(t, dedupPath, sourceDir, original, sha256Sum(original), sha256Sum([]byte("other data")))
+	if err := checkDedup(dedupPath, sourceDir, true); err == nil {
+		t.Error("expected error for wrong sha256 source checksum")
+	}
+}
+
+func TestCheckDedup_ChunkChecksums(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("mkdir source: %v", err)
+	}
+	srcContent := make([]byte, 64)
+	for i := range srcContent {
+		srcContent[i] = byte(i)
+	}
+	srcPath := filepath.Join(sourceDir, "test.vob")
+	if err := os.WriteFile(srcPath, srcContent, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	h := source.NewChunkHasher(16)
+	h.Write(srcContent)
+
+	writer, err := dedup.NewWriter(dedupPath)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	original := append(append([]byte(nil), srcContent[0:16]...), srcContent[48:56]...)
+	writer.SetHeader(int64(len(original)), xxhash.Sum64(original), source.TypeDVD)
+	writer.SetChunkSize(16)
+	writer.SetSourceFiles([]source.File{{
+		RelativePath:   "test.vob",
+		Size:           int64(len(srcContent)),
+		Checksum:       xxhash.Sum64(srcContent),
+		ChunkChecksums: h.ChunkSums(),
+	}})
+	// The MKV reads chunks 0 and 3 of the source
+	result := &matcher.Result{Entries: []matcher.Entry{
+		{MkvOffset: 0, Length: 16, Source: 1, SourceOffset: 0},
+		{MkvOffset: 16, Length: 8, Source: 1, SourceOffset: 48},
+	}}
+	if err := writer.SetMatchResult(result, nil); err != nil {
+		writer.Close()
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := writer.Write(); err != nil {
+		writer.Close()
+		t.Fatalf("Write: %v", err)
+	}
+	writer.Close()
+
+	if err := checkDedup(dedupPath, sourceDir, true); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	// Damage to chunk 1, which the MKV never reads, is not an error
+	corrupt := append([]byte(nil), srcContent...)
+	corrupt[20] ^= 0xFF
+	if err := os.WriteFile(srcPath, corrupt, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := checkDedup(dedupPath, sourceDir, true); err != nil {
+		t.Errorf("expected no error for damage outside the used chunks, got: %v", err)
+	}
+
+	corrupt[50] ^= 0xFF
+	if err := os.WriteFile(srcPath, corrupt, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := checkDedup(dedupPath, sourceDir, true); err == nil {
+		t.Error("expected error for a corrupt chunk the MKV reads")
+	}
+}
+
+func TestFormatBadChunks(t *testing.T) {
+	if got, want := formatBadChunks([]int64{3}, 1<<20), "1 corrupt chunk at offset 3,145,728"; got != want {
+		t.Errorf("formatBadChunks = %q, want %q", got, want)
+	}
+	got := formatBadChunks([]int64{0, 1, 2, 3, 4, 5, 6}, 10)
+	if want := "7 corrupt chunks at offsets 0; 10; 20; 30; 40; and 2 more"; got != want {
+		t.Errorf("formatBadChunks = %q, want %q", got, want)
+	}
+}
+
+func TestVerifyDedup_ExtendedChecksums(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	dedupPath := filepath.Join(dir, "movie.mkvdup")
+	originalPath := filepath.Join(dir, "original.mkv")
+	original := []byte("original data for verification")
+	if err := os.WriteFile(originalPath, original, 0644); err != nil {
+		t.Fatalf("write original: %v", err)
+	}
+	sourceSum := sha256Sum([]byte("source data"))
+
+	createChecksummedDedup(t, dedupPath, sourceDir, original, sha256Sum(original), sourceSum)
+	if err := verifyDedup(dedupPath, sourceDir, originalPath); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+
+	// Bytes match the original, but the stored sha256 does not.
+	createChecksummedDedup(t, dedupPath, sourceDir, original, sha256Sum([]byte("something else")), sourceSum)
+	err := verifyDedup(dedupPath, sourceDir, originalPath)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Errorf("expected sha256 mismatch error, got: %v", err)
+	}
+}
+
 // --- extract command tests ---
 
 func TestExtractDedup_Success(t *testing.T) {
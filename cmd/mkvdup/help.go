@@ -24,6 +24,11 @@ Commands:
   reload        Reload running daemon's configuration
   expand-config Expand wildcard config to explicit file list
   relocate      Move dedup file + sidecar, updating paths
+  upgrade       Rewrite dedup files in the newest format version
+  repair        Locate and repair damage in a dedup file
+  prune-delta-store
+                Remove delta store chunks no dedup file uses
+  index-cache   List, prune or prebuild cached source indexes
 
 Analysis commands:
   deltadiag    Analyze unmatched regions by stream type
@@ -39,6 +44,15 @@ Options:
   --no-progress      Disable progress bars (still show status messages)
   --log-file PATH    Duplicate output to a log file (non-TTY style)
   --log-verbose      Enable verbose output in log file only
+  --index-cache DIR  Cache source indexes in DIR
+                     (default: ~/.cache/mkvdup/index)
+  --no-index-cache   Always index sources from scratch
+  --max-index-memory SIZE
+                     Limit source index memory (e.g. 2G); larger indexes
+                     are sorted into a temporary file (default: auto,
+                     a quarter of RAM; or unlimited)
+  --index-workers N  Index up to N source files at once
+                     (default: auto, one per CPU; 1 = serial)
   -h, --help         Show help
   --version          Show version
 `)
@@ -76,6 +90,14 @@ func printCommandUsage(cmd string) {
 		printExpandConfigUsage()
 	case "relocate":
 		printRelocateUsage()
+	case "upgrade":
+		printUpgradeUsage()
+	case "repair":
+		printRepairUsage()
+	case "prune-delta-store":
+		printPruneDeltaStoreUsage()
+	case "index-cache":
+		printIndexCacheUsage()
 	case "deltadiag":
 		printDeltadiagUsage()
 	case "parse-mkv":
@@ -95,11 +117,13 @@ func printCreateUsage() {
 Create a dedup file from an MKV and its source media.
 
 Arguments:
-    <mkv-file>    Path to the MKV file to deduplicate
-    <source-dir>  Directory containing source media (ISO files or BDMV folders)
+    <mkv-file>    Path to the MKV file to deduplicate, or "-" to read it from
+                  standard input (a named pipe also works)
+    <source-dir>  Directory containing source media (ISO files, BDMV folders, VIDEO_TS folders, .ts, MP4/MOV or MKV files)
     <output>      Output .mkvdup file path
-    [name]        Display name in FUSE mount (default: basename of mkv-file;
-                  .mkv extension auto-added if missing)
+    [name]        Display name in FUSE mount (default: basename of mkv-file,
+                  or of output when reading standard input; .mkv extension
+                  auto-added if missing)
 
 Options:
     -v, --verbose       Enable verbose/debug output
@@ -107,6 +131,27 @@ Options:
     --log-verbose       Enable verbose output in log file only
     --warn-threshold N  Minimum space savings percentage to avoid warning (default: 75)
     --non-interactive   Don't prompt on codec mismatch (show warning and continue)
+    --playlist NAME     Index only the clips of a Blu-ray playlist (e.g. 00800.mpls),
+                        or "auto" to pick the playlist matching the MKV's duration
+                        and streams. Use <iso>:NAME when several ISOs have NAME.
+    --title N           Index only the cells of DVD title N, or "auto" to pick the
+                        title matching the MKV's duration, probing the candidates
+                        when several do. Use <disc>:N when the source has several
+                        discs.
+    --all-streams       Index every source stream, rather than only those of the
+                        MKV's codecs and DVD audio channel counts
+    --checkpoint        Record the progress of matching in <output>.checkpoint,
+                        so that an interrupted create can be resumed
+    --resume            Resume matching from the checkpoint of an interrupted
+                        create, recording a new one if there is none
+    --checksum ALGO     Also store cryptographic checksums of the MKV and source
+                        files (sha256, blake3, sha512 or sha1), for matching
+                        against disc image databases. Hashing the source files
+                        adds a full read of the source.
+    --delta-store DIR   Keep the delta in a shared, content-addressed store in
+                        DIR instead of in the dedup file, so that data common to
+                        many files (fonts, chapters) is stored once. The dedup
+                        file can't be read without the store.
 
 Before matching, codecs in the MKV are compared against the source media.
 If a mismatch is detected (e.g., MKV has H.264 but source is MPEG-2), you
@@ -116,11 +161,34 @@ After writing, the dedup file is verified against the original MKV. If
 verification fails, the output is renamed to <output>.failed and the
 command exits with code 1.
 
+An MKV read from a pipe is read once, without a temporary copy: clusters
+are matched as they arrive, and the reconstruction is verified against the
+checksums computed while reading. The pipe is read up to the first cluster
+before indexing, then waits until the source is indexed.
+
+Source streams none of the MKV's tracks could come from (other codecs, or
+DVD audio of other channel counts) are not indexed. If a track then matches
+less than half, the source is indexed again with all its streams and the
+MKV matched again. An MKV read from a pipe always uses every stream.
+
+Ctrl-C (or SIGTERM) stops indexing, matching and writing cleanly, removing
+the partial output; press it again to exit at once. With --checkpoint, the
+matched packets are recorded as they are matched, and the match result
+when it is done, so that after an interrupt, crash or reboot, running the
+same command with --resume skips the matching already done. The checkpoint
+is removed once the dedup file is created. It needs an MKV file, not a pipe.
+
 Examples:
     mkvdup create movie.mkv /media/dvd-backups movie.mkvdup
+    ssh nas cat /rips/movie.mkv | mkvdup create - /media/dvd-backups movie.mkvdup
     mkvdup create movie.mkv /media/dvd-backups movie.mkvdup "My Movie"
     mkvdup create --warn-threshold 50 movie.mkv /media/dvd-backups movie.mkvdup
     mkvdup create --non-interactive movie.mkv /media/dvd-backups movie.mkvdup
+    mkvdup create --resume movie.mkv /media/bluray-backups/movie movie.mkvdup
+    mkvdup create --playlist auto movie.mkv /media/bluray-backups/movie movie.mkvdup
+    mkvdup create --title auto episode3.mkv /media/dvd-backups/show-s1d1 episode3.mkvdup
+    mkvdup create --checksum sha256 movie.mkv /media/dvd-backups movie.mkvdup
+    mkvdup create --delta-store /media/dedup/store movie.mkv /media/dvd-backups movie.mkvdup
 `)
 }
 
@@ -143,6 +211,10 @@ Options:
     --log-verbose          Enable verbose output in log file only
     --warn-threshold N     Minimum space savings percentage to avoid warning (default: 75)
     --skip-codec-mismatch  Skip MKVs with codec mismatch instead of processing them
+    --checksum ALGO        Also store cryptographic checksums (sha256, blake3, sha512 or sha1);
+                           each source file is hashed once per batch
+    --delta-store DIR      Keep the deltas in a shared, content-addressed store in DIR
+                           (see 'mkvdup create --help')
 
 Manifest format:
     source_dir: /media/dvd-backups/disc1   # default for all files (optional)
@@ -155,13 +227,21 @@ Manifest format:
       - mkv: movie.mkv
         output: movie.mkvdup
         source_dir: /media/dvd-backups/disc2  # per-file override
+      - mkv: feature.mkv
+        output: feature.mkvdup
+        source_dir: /media/bluray-backups/movie
+        playlist: auto                      # Blu-ray playlist (optional)
 
 Fields:
     source_dir          Default source directory (optional if all files specify their own)
+    playlist            Default Blu-ray playlist (optional)
     files               List of MKV files to process (required, at least one)
     files[].mkv         Path to MKV file (required)
     files[].output      Output .mkvdup file (required)
     files[].source_dir  Source directory for this file (overrides top-level default)
+    files[].playlist    Blu-ray playlist to index for this file (e.g. 00800.mpls, or
+                        "auto"; overrides top-level default). Files with the same
+                        source and playlist share one index.
     files[].name        Display name in FUSE mount (default: basename of mkv;
                         .mkv extension auto-added if missing)
 
@@ -231,8 +311,10 @@ Source Watch Options:
                                          warn     - log a warning
                                          disable  - disable affected virtual files (reads return EIO)
                                          checksum - size change: disable immediately
-                                                    timestamp-only: verify checksum in background,
-                                                    disable on mismatch, re-enable on pass
+                                                    timestamp-only: verify checksum in background
+                                                    (xxhash, plus the --checksum digest if the
+                                                    dedup file has one), disable on mismatch,
+                                                    re-enable on pass
     --source-watch-poll-interval DUR     Poll interval for source file changes (default: 60s)
     --source-read-timeout DUR            Read timeout for network FS sources (default: 30s)
 
@@ -305,6 +387,9 @@ Arguments:
     <source-dir>    Directory containing the source media
     <original-mkv>  Path to the original MKV for comparison
 
+Dedup files created with --checksum also have the cryptographic checksum of
+the reconstructed MKV verified.
+
 Examples:
     mkvdup verify movie.mkvdup /media/dvd-backups original.mkv
 `)
@@ -335,14 +420,19 @@ Arguments:
     <source-dir>  Directory containing the source media
 
 Options:
-    --source-checksums  Verify source file checksums (slow, reads entire files)
+    --source-checksums  Verify source file checksums (slow, reads the source
+                        data the dedup file uses)
 
 Checks performed:
     - Dedup file header validity (magic, version, structure)
     - Index and delta checksum verification
     - Source file existence and size
     With --source-checksums:
-    - Source file checksum verification (reads entire files)
+    - Source file checksum verification. Dedup files with chunk checksums
+      have only the chunks they read verified, and corrupt chunks are
+      reported by offset. Dedup files created with --checksum have entire
+      files read, with each file's cryptographic checksum verified in the
+      same pass
 
 Examples:
     mkvdup check movie.mkvdup /media/dvd-backups
@@ -529,6 +619,146 @@ Examples:
 `)
 }
 
+func printUpgradeUsage() {
+	fmt.Print(`Usage: mkvdup upgrade [options] <file.mkvdup>...
+       mkvdup upgrade [options] --config-dir <dir>
+
+Rewrite dedup files created by older versions of mkvdup in the newest
+format version, which has per-source Used flags, the creator version, a
+compact index and a compressed delta. The original MKV is not needed.
+
+Each file is checked and rewritten beside the original, then the new
+file's reconstruction is checked against the original MKV's checksum
+(a full read of the source data it uses). The original is replaced only
+if it matches. Files already in the newest version are left unchanged.
+
+Arguments:
+    <file.mkvdup>  Dedup files to upgrade. The source directory is read from
+                   each file's .mkvdup.yaml config unless --source-dir is set.
+
+Options:
+    --source-dir DIR  Source directory of the dedup files
+    --config-dir      Treat the argument as a directory of .yaml configs and
+                      upgrade the dedup files they name
+    --dry-run         Report which files would be upgraded
+
+Examples:
+    mkvdup upgrade movie.mkvdup
+    mkvdup upgrade --source-dir /media/dvd-backups movie.mkvdup
+    mkvdup upgrade --dry-run --config-dir /etc/mkvdup.d
+`)
+}
+
+func printRepairUsage() {
+	fmt.Print(`Usage: mkvdup repair [options] <file.mkvdup>
+
+Find which parts of a damaged dedup file are corrupt and repair them from
+a copy of the original data. Damage is located by checking each compact
+index block and compressed delta frame, the consistency of the index
+entries, and each delta store chunk.
+
+With --from-dedup and a backup copy of the same dedup file, only the
+bytes that differ are rewritten, in place. Otherwise the reference (the
+original MKV, a file reconstructed from it, or a dedup file laid out
+differently) is checked against the original MKV's checksum, the data of
+every trusted entry is compared with it, and the damaged regions are
+restored from it. The repaired file is written beside the original and
+replaces it only if its reconstruction matches the checksum.
+
+Without a reference, the damaged byte ranges of the original MKV are
+listed with the clusters and play times they cover, and the command
+fails.
+
+Arguments:
+    <file.mkvdup>  Dedup file to repair. The source directory is read from
+                   its .mkvdup.yaml config unless --source-dir is set.
+
+Options:
+    --from-mkv FILE     The original MKV, or a copy reconstructed from it
+    --from-dedup FILE   A backup of the dedup file, or another dedup file
+                        of the same MKV using the same source directory
+    --source-dir DIR    Source directory of the dedup file
+    --dry-run           Report the damage and what would be repaired
+
+Examples:
+    mkvdup repair movie.mkvdup
+    mkvdup repair --from-dedup /backup/movie.mkvdup movie.mkvdup
+    mkvdup repair --from-mkv /mnt/old-disk/movie.mkv movie.mkvdup
+`)
+}
+
+func printPruneDeltaStoreUsage() {
+	fmt.Print(`Usage: mkvdup prune-delta-store [options] <store-dir> <dedup-file|dir>...
+
+Remove the chunks of a delta store (see 'create --delta-store') that none
+of the given dedup files reference. Directories are searched recursively
+for .mkvdup files.
+
+WARNING: every dedup file using the store must be listed. Chunks used only
+by dedup files not listed on the command line are deleted, and those files
+can no longer be read.
+
+Nothing is removed if any listed file can't be read, or if none of them
+uses the store (compared as directories, so a store reached through a
+symlink or another mount point is recognized). A listed file using another
+store also stops the prune, unless --force is given. Chunks written or
+reused in the last hour are kept, so a prune is safe alongside a running
+create.
+
+Arguments:
+    <store-dir>       Delta store directory
+    <dedup-file|dir>  Dedup files, or directories containing them
+
+Options:
+    --dry-run  Report what would be removed without removing anything
+    --force    Prune even if some listed dedup files use another store
+
+Examples:
+    mkvdup prune-delta-store /media/dedup/store /media/dedup
+    mkvdup prune-delta-store --dry-run /media/dedup/store /media/dedup /archive/old.mkvdup
+`)
+}
+
+func printIndexCacheUsage() {
+	fmt.Print(`Usage: mkvdup index-cache <subcommand> [options]
+
+Manage the cache of source indexes. create, batch-create and probe store
+each source index they build in the cache, and reuse it when the same
+source is indexed again with the same settings, skipping the parse and
+hash pass. An index is reused only while every source file it covers has
+the size and modification time it had when the index was built, so a
+changed source is indexed again.
+
+The cache is kept in ~/.cache/mkvdup/index ($XDG_CACHE_HOME/mkvdup/index
+if set). Use the global --index-cache DIR option to keep it elsewhere, or
+--no-index-cache to neither read nor write it.
+
+Subcommands:
+    list                        Show each cached index and whether it is
+                                still valid
+    prune [options]             Remove indexes whose source has changed or
+                                is gone
+    build [options] <source-dir>...
+                                Index sources ahead of time so later
+                                commands find them cached
+
+Prune Options:
+    --all      Remove every cached index, valid or not
+    --dry-run  Report what would be removed without removing anything
+
+Build Options:
+    --playlist NAME  Index only the clips of a Blu-ray playlist (e.g. 00800)
+    --title N        Index only the cells of a DVD title (e.g. 1 or 1.2)
+
+Examples:
+    mkvdup index-cache list
+    mkvdup index-cache build /media/bluray/DISC1 /media/bluray/DISC2
+    mkvdup index-cache build --playlist 00800 /media/bluray/DISC1
+    mkvdup index-cache prune --dry-run
+    mkvdup --index-cache /fast/cache index-cache prune --all
+`)
+}
+
 func printDeltadiagUsage() {
 	fmt.Print(`Usage: mkvdup deltadiag <dedup-file> <mkv-file>
 
@@ -569,7 +799,7 @@ func printIndexSourceUsage() {
 Index a source directory and display statistics (debugging).
 
 Arguments:
-    <source-dir>  Directory containing source media (ISO files or BDMV folders)
+    <source-dir>  Directory containing source media (ISO files, BDMV folders, VIDEO_TS folders, .ts, MP4/MOV or MKV files)
 
 Examples:
     mkvdup index-source /media/dvd-backups
@@ -12,6 +12,7 @@ import (
 
 	"github.com/stuckj/mkvdup/internal/daemon"
 	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/source"
 )
 
 // MountOptions holds all options for the mount command.
@@ -106,6 +107,15 @@ var showProgress = true
 // quiet suppresses all informational stdout output. Errors still go to stderr.
 var quiet bool
 
+// maxIndexMemory limits the memory of source index hash tables, set by
+// --max-index-memory (0 = automatic, negative = unlimited; see
+// source.Indexer.SetMaxMemory).
+var maxIndexMemory int64
+
+// indexWorkers is the number of source files indexed at once, set by
+// --index-workers (0 = one per CPU; see source.Indexer.SetWorkers).
+var indexWorkers int
+
 func printVersion() {
 	fmt.Printf("mkvdup version %s\n", version)
 }
@@ -116,6 +126,7 @@ func main() {
 	var filteredArgs []string
 	showHelp := false
 	showVersion := false
+	noIndexCache := false
 
 	// Extract --cpuprofile flag (only available in debug builds)
 	args, cpuprofile := parseCPUProfileFlag(args)
@@ -148,12 +159,58 @@ func main() {
 			} else {
 				log.Fatalf("Error: --log-file requires a path argument")
 			}
+		case arg == "--index-cache":
+			if i+1 < len(args) {
+				i++
+				indexCacheDir = args[i]
+			} else {
+				log.Fatalf("Error: --index-cache requires a directory argument")
+			}
+		case arg == "--no-index-cache":
+			noIndexCache = true
+		case arg == "--max-index-memory":
+			if i+1 >= len(args) {
+				log.Fatalf("Error: --max-index-memory requires a size argument")
+			}
+			i++
+			switch args[i] {
+			case "auto":
+				maxIndexMemory = 0
+			case "unlimited":
+				maxIndexMemory = -1
+			default:
+				n, err := parseSize(args[i])
+				if err != nil || n == 0 {
+					log.Fatalf("Error: --max-index-memory: expected a size such as 2G, auto or unlimited, got %q", args[i])
+				}
+				maxIndexMemory = n
+			}
+		case arg == "--index-workers":
+			if i+1 >= len(args) {
+				log.Fatalf("Error: --index-workers requires a count argument")
+			}
+			i++
+			if args[i] == "auto" {
+				indexWorkers = 0
+			} else if n, err := strconv.Atoi(args[i]); err == nil && n > 0 {
+				indexWorkers = n
+			} else {
+				log.Fatalf("Error: --index-workers: expected a positive count or auto, got %q", args[i])
+			}
 		default:
 			filteredArgs = append(filteredArgs, arg)
 		}
 	}
 	args = filteredArgs
 
+	if noIndexCache {
+		indexCacheDir = ""
+	} else if indexCacheDir == "" {
+		if dir, err := source.DefaultIndexCacheDir(); err == nil {
+			indexCacheDir = dir
+		}
+	}
+
 	// Auto-disable progress bars when stdout is not a TTY
 	if !isTerminalStdout() {
 		showProgress = false
@@ -193,13 +250,48 @@ func main() {
 
 	switch cmd {
 	case "create":
-		warnThreshold, remaining := parseWarnFlags(args)
-		nonInteractive := false
+		var opts createOptions
+		var remaining []string
+		opts.warnThreshold, remaining = parseWarnFlags(args)
 		var createArgs []string
 		for i := 0; i < len(remaining); i++ {
 			switch remaining[i] {
 			case "--non-interactive":
-				nonInteractive = true
+				opts.nonInteractive = true
+			case "--all-streams":
+				opts.allStreams = true
+			case "--checkpoint":
+				opts.checkpoint = true
+			case "--resume":
+				opts.resume = true
+			case "--playlist":
+				if i+1 < len(remaining) && !strings.HasPrefix(remaining[i+1], "--") {
+					opts.playlist = remaining[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --playlist requires a playlist name or \"auto\"")
+				}
+			case "--title":
+				if i+1 < len(remaining) && !strings.HasPrefix(remaining[i+1], "--") {
+					opts.title = remaining[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --title requires a title number or \"auto\"")
+				}
+			case "--checksum":
+				if i+1 < len(remaining) && !strings.HasPrefix(remaining[i+1], "--") {
+					opts.checksumAlgo = remaining[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --checksum requires an algorithm (%s)", strings.Join(dedup.ChecksumAlgorithms, ", "))
+				}
+			case "--delta-store":
+				if i+1 < len(remaining) && !strings.HasPrefix(remaining[i+1], "--") {
+					opts.deltaStoreDir = remaining[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --delta-store requires a directory")
+				}
 			default:
 				createArgs = append(createArgs, remaining[i])
 			}
@@ -213,26 +305,42 @@ func main() {
 		if len(createArgs) >= 4 {
 			name = createArgs[3]
 		}
-		if err := createDedup(createArgs[0], createArgs[1], output, name, warnThreshold, nonInteractive); err != nil {
+		if err := createDedup(createArgs[0], createArgs[1], output, name, opts); err != nil {
 			log.Fatalf("Error: %v", err)
 		}
 
 	case "batch-create":
-		warnThreshold, remaining := parseWarnFlags(args)
-		skipCodecMismatch := false
+		var opts createOptions
+		var remaining []string
+		opts.warnThreshold, remaining = parseWarnFlags(args)
 		var batchArgs []string
-		for _, arg := range remaining {
-			if arg == "--skip-codec-mismatch" {
-				skipCodecMismatch = true
-			} else {
-				batchArgs = append(batchArgs, arg)
+		for i := 0; i < len(remaining); i++ {
+			switch remaining[i] {
+			case "--skip-codec-mismatch":
+				opts.skipCodecMismatch = true
+			case "--checksum":
+				if i+1 < len(remaining) && !strings.HasPrefix(remaining[i+1], "--") {
+					opts.checksumAlgo = remaining[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --checksum requires an algorithm (%s)", strings.Join(dedup.ChecksumAlgorithms, ", "))
+				}
+			case "--delta-store":
+				if i+1 < len(remaining) && !strings.HasPrefix(remaining[i+1], "--") {
+					opts.deltaStoreDir = remaining[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --delta-store requires a directory")
+				}
+			default:
+				batchArgs = append(batchArgs, remaining[i])
 			}
 		}
 		if len(batchArgs) < 1 {
 			printCommandUsage("batch-create")
 			os.Exit(1)
 		}
-		if err := createBatch(batchArgs[0], warnThreshold, skipCodecMismatch); err != nil {
+		if err := createBatch(batchArgs[0], opts); err != nil {
 			log.Fatalf("Error: %v", err)
 		}
 
@@ -651,6 +759,143 @@ func main() {
 			log.Fatalf("Error: %v", err)
 		}
 
+	case "upgrade":
+		dryRun := false
+		configDir := false
+		sourceDir := ""
+		var upgradeArgs []string
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--dry-run":
+				dryRun = true
+			case "--config-dir":
+				configDir = true
+			case "--source-dir":
+				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+					sourceDir = args[i+1]
+					i++
+				} else {
+					log.Fatalf("Error: --source-dir requires a directory")
+				}
+			default:
+				upgradeArgs = append(upgradeArgs, args[i])
+			}
+		}
+		if len(upgradeArgs) < 1 || (configDir && sourceDir != "") {
+			printCommandUsage("upgrade")
+			os.Exit(1)
+		}
+		if err := upgradeDedupFiles(upgradeArgs, configDir, sourceDir, dryRun); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+	case "repair":
+		var opts repairOptions
+		var repairArgs []string
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--dry-run":
+				opts.dryRun = true
+			case "--source-dir", "--from-mkv", "--from-dedup":
+				if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+					log.Fatalf("Error: %s requires a path", args[i])
+				}
+				switch args[i] {
+				case "--source-dir":
+					opts.sourceDir = args[i+1]
+				case "--from-mkv":
+					opts.fromMKV = args[i+1]
+				default:
+					opts.fromDedup = args[i+1]
+				}
+				i++
+			default:
+				repairArgs = append(repairArgs, args[i])
+			}
+		}
+		if len(repairArgs) != 1 || (opts.fromMKV != "" && opts.fromDedup != "") {
+			printCommandUsage("repair")
+			os.Exit(1)
+		}
+		if err := repairDedupFile(repairArgs[0], opts); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+	case "prune-delta-store":
+		dryRun, force := false, false
+		var pruneArgs []string
+		for _, arg := range args {
+			switch arg {
+			case "--dry-run":
+				dryRun = true
+			case "--force":
+				force = true
+			default:
+				pruneArgs = append(pruneArgs, arg)
+			}
+		}
+		if len(pruneArgs) < 2 {
+			printCommandUsage("prune-delta-store")
+			os.Exit(1)
+		}
+		if err := pruneDeltaStore(pruneArgs[0], pruneArgs[1:], dryRun, force); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+	case "index-cache":
+		if len(args) < 1 {
+			printCommandUsage("index-cache")
+			os.Exit(1)
+		}
+		var err error
+		switch sub, subArgs := args[0], args[1:]; sub {
+		case "list":
+			err = listIndexCache()
+		case "prune":
+			all, dryRun := false, false
+			for _, arg := range subArgs {
+				switch arg {
+				case "--all":
+					all = true
+				case "--dry-run":
+					dryRun = true
+				default:
+					log.Fatalf("Error: unknown option for index-cache prune: %s", arg)
+				}
+			}
+			err = pruneIndexCache(all, dryRun)
+		case "build":
+			var playlistSpec, titleSpec string
+			var sourceDirs []string
+			for i := 0; i < len(subArgs); i++ {
+				switch subArgs[i] {
+				case "--playlist", "--title":
+					if i+1 >= len(subArgs) || strings.HasPrefix(subArgs[i+1], "--") {
+						log.Fatalf("Error: %s requires an argument", subArgs[i])
+					}
+					if subArgs[i] == "--playlist" {
+						playlistSpec = subArgs[i+1]
+					} else {
+						titleSpec = subArgs[i+1]
+					}
+					i++
+				default:
+					sourceDirs = append(sourceDirs, subArgs[i])
+				}
+			}
+			if len(sourceDirs) == 0 {
+				printCommandUsage("index-cache")
+				os.Exit(1)
+			}
+			err = buildIndexCache(sourceDirs, playlistSpec, titleSpec)
+		default:
+			printCommandUsage("index-cache")
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
 	case "deltadiag":
 		if len(args) < 2 {
 			printCommandUsage("deltadiag")
@@ -124,6 +124,10 @@ func TestPrintCommandUsage(t *testing.T) {
 		{"match", []string{"mkv-file", "source-dir"}},
 		{"stats", []string{"config.yaml", "--config-dir"}},
 		{"reload", []string{"pid-file", "SIGHUP"}},
+		{"prune-delta-store", []string{"store-dir", "--dry-run"}},
+		{"index-cache", []string{"list", "prune", "build", "--all", "--playlist", "source-dir"}},
+		{"upgrade", []string{"file.mkvdup", "--config-dir", "--source-dir"}},
+		{"repair", []string{"file.mkvdup", "--from-mkv", "--from-dedup", "--dry-run"}},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,168 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/mmap"
+	"github.com/stuckj/mkvdup/internal/source"
+	"golang.org/x/sys/unix"
+)
+
+// VirtualFileXattr is the extended attribute carried by the virtual files of
+// an mkvdup mount. Its value is the path of the .mkvdup file the virtual file
+// is reconstructed from.
+const VirtualFileXattr = "user.mkvdup.dedup_file"
+
+// maxChainDepth bounds how many .mkvdup files a read passes through when the
+// source MKV of a dedup file is itself a .mkvdup file. It also stops cycles.
+const maxChainDepth = 8
+
+// isChainedSource reports whether a source file is a .mkvdup file to be read
+// through its reconstruction. Only MKV sources can be chained.
+func (r *Reader) isChainedSource(relPath string) bool {
+	return r.file.Header.SourceType == SourceTypeMKV && strings.EqualFold(filepath.Ext(relPath), ".mkvdup")
+}
+
+// openChainedSource opens a .mkvdup source file as the MKV it reconstructs.
+// Its source directory is read from the sidecar config written next to it by
+// create. load loads the nested reader's own source files.
+func (r *Reader) openChainedSource(path string, load func(*Reader) error) (mmap.SourceFile, error) {
+	if r.chainDepth >= maxChainDepth {
+		return nil, fmt.Errorf("chained sources nested more than %d deep", maxChainDepth)
+	}
+	configPath := path + ".yaml"
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("chained source config: %w", err)
+	}
+	nested, err := NewReader(path, resolveRelative(filepath.Dir(configPath), config.SourceDir))
+	if err != nil {
+		return nil, err
+	}
+	nested.chainDepth = r.chainDepth + 1
+	if err := load(nested); err != nil {
+		nested.Close()
+		return nil, err
+	}
+	return &chainedSourceFile{reader: nested}, nil
+}
+
+// chainedSourceFile presents the MKV reconstructed by a nested Reader as a
+// source file. It owns the nested Reader.
+type chainedSourceFile struct {
+	reader *Reader
+}
+
+// ReadAt reads reconstructed data, returning io.EOF on a short read.
+func (c *chainedSourceFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.reader.ReadAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Size returns the size of the reconstructed MKV.
+func (c *chainedSourceFile) Size() int64 {
+	return c.reader.OriginalSize()
+}
+
+// Close closes the nested Reader and its source files.
+func (c *chainedSourceFile) Close() error {
+	return c.reader.Close()
+}
+
+// ResolveChainedSources replaces the MKV source files that are virtual files
+// of an mkvdup mount by the .mkvdup files backing them, so that reads of the
+// new dedup file do not go through a mount (possibly the very mount that
+// serves it). Each replaced entry describes the .mkvdup file on disk: its
+// size and checksum are those of the .mkvdup file. Relative paths are rebased
+// onto the deepest directory containing every source, which is returned
+// along with the new file list. Without virtual files, sourceDir and files
+// are returned unchanged.
+func ResolveChainedSources(sourceDir string, files []source.File) (string, []source.File, error) {
+	absDir, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	paths := make([]string, len(files))
+	resolved := make([]source.File, len(files))
+	chained := false
+	for i, f := range files {
+		paths[i] = filepath.Join(absDir, f.RelativePath)
+		resolved[i] = f
+
+		dedupPath, ok := virtualFileDedupPath(paths[i])
+		if !ok {
+			continue
+		}
+		dedupPath, err = filepath.Abs(dedupPath)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := ReadConfig(dedupPath + ".yaml"); err != nil {
+			return "", nil, fmt.Errorf("virtual source %s is backed by %s, which has no usable config: %w", f.RelativePath, dedupPath, err)
+		}
+		size, checksum, err := fileSizeAndChecksum(dedupPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("virtual source %s: %w", f.RelativePath, err)
+		}
+		paths[i] = dedupPath
+		resolved[i].Size = size
+		resolved[i].Checksum = checksum
+		// The indexer hashed the chunks of the reconstructed MKV, not of the
+		// dedup file that is now the source.
+		resolved[i].ChunkChecksums = nil
+		chained = true
+	}
+	if !chained {
+		return sourceDir, files, nil
+	}
+
+	base := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for base != filepath.Dir(base) && !strings.HasPrefix(p, base+string(filepath.Separator)) {
+			base = filepath.Dir(base)
+		}
+	}
+	for i, p := range paths {
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return "", nil, err
+		}
+		resolved[i].RelativePath = rel
+	}
+	return base, resolved, nil
+}
+
+// virtualFileDedupPath returns the .mkvdup file behind a virtual file of an
+// mkvdup mount, or false if path is a regular file.
+func virtualFileDedupPath(path string) (string, bool) {
+	buf := make([]byte, 4096)
+	n, err := unix.Getxattr(path, VirtualFileXattr, buf)
+	if err != nil || n == 0 {
+		return "", false
+	}
+	return string(buf[:n]), true
+}
+
+// fileSizeAndChecksum returns the size and xxhash of a file.
+func fileSizeAndChecksum(path string) (int64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	h := xxhash.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return n, h.Sum64(), nil
+}
@@ -0,0 +1,156 @@
+package dedup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+	"golang.org/x/sys/unix"
+)
+
+// writeTestChain writes an inner dedup file reconstructing 150 bytes of a raw
+// source file, with its sidecar config, and returns the inner dedup path and
+// the bytes it reconstructs.
+func writeTestChain(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	srcDir := filepath.Join(dir, "disc")
+	innerDir := filepath.Join(dir, "library")
+	for _, d := range []string{srcDir, innerDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := make([]byte, 200)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "disc.bin"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	inner := writeTestDedupFile(t, innerDir, writeTestOptions{
+		originalSize: 150,
+		sourceType:   source.TypeDVD,
+		sourceFiles:  []source.File{{RelativePath: "disc.bin", Size: int64(len(src))}},
+		result: &matcher.Result{
+			Entries:      []matcher.Entry{{MkvOffset: 0, Length: 150, Source: 1, SourceOffset: 20}},
+			MatchedBytes: 150,
+			TotalPackets: 1,
+		},
+	})
+	if err := WriteConfig(inner+".yaml", "movie.mkv", inner, srcDir); err != nil {
+		t.Fatal(err)
+	}
+	return inner, src[20:170]
+}
+
+func TestReader_ChainedMKVSource(t *testing.T) {
+	dir := t.TempDir()
+	inner, innerData := writeTestChain(t, dir)
+
+	outerDir := filepath.Join(dir, "variant")
+	if err := os.MkdirAll(outerDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outer := writeTestDedupFile(t, outerDir, writeTestOptions{
+		originalSize: 100,
+		sourceType:   source.TypeMKV,
+		sourceFiles:  []source.File{{RelativePath: filepath.Base(inner), Size: 1}},
+		result: &matcher.Result{
+			Entries:      []matcher.Entry{{MkvOffset: 0, Length: 100, Source: 1, SourceOffset: 30}},
+			MatchedBytes: 100,
+			TotalPackets: 1,
+		},
+	})
+
+	r, err := NewReader(outer, filepath.Dir(inner))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 0); err != nil || n != 100 {
+		t.Fatalf("ReadAt = (%d, %v), want (100, nil)", n, err)
+	}
+	if !bytes.Equal(buf, innerData[30:130]) {
+		t.Error("ReadAt data mismatch through chained source")
+	}
+}
+
+func TestReader_ChainedSourceCycle(t *testing.T) {
+	dir := t.TempDir()
+	// A dedup file whose only source is itself
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize: 10,
+		sourceType:   source.TypeMKV,
+		sourceFiles:  []source.File{{RelativePath: "test.mkvdup", Size: 10}},
+		result: &matcher.Result{
+			Entries:      []matcher.Entry{{MkvOffset: 0, Length: 10, Source: 1}},
+			MatchedBytes: 10,
+			TotalPackets: 1,
+		},
+	})
+	if err := WriteConfig(path+".yaml", "loop.mkv", path, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	err = r.LoadSourceFiles()
+	if err == nil || !strings.Contains(err.Error(), "nested more than") {
+		t.Errorf("LoadSourceFiles() error = %v, want chain depth error", err)
+	}
+}
+
+func TestResolveChainedSources(t *testing.T) {
+	dir := t.TempDir()
+	inner, _ := writeTestChain(t, dir)
+	mountDir := filepath.Join(dir, "mount")
+	if err := os.MkdirAll(mountDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	virtual := filepath.Join(mountDir, "movie.mkv")
+	if err := os.WriteFile(virtual, make([]byte, 150), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []source.File{{RelativePath: "movie.mkv", Size: 150, Checksum: 1, ChunkChecksums: []uint64{7}}}
+
+	// Regular files are recorded unchanged
+	gotDir, gotFiles, err := ResolveChainedSources(mountDir, files)
+	if err != nil || gotDir != mountDir || !reflect.DeepEqual(gotFiles, files) {
+		t.Fatalf("ResolveChainedSources() = (%s, %+v, %v), want input unchanged", gotDir, gotFiles, err)
+	}
+
+	// Stand in for a mount by setting the attribute the FUSE node exposes
+	if err := unix.Setxattr(virtual, VirtualFileXattr, []byte(inner), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+			t.Skipf("user xattrs not supported here: %v", err)
+		}
+		t.Fatal(err)
+	}
+	gotDir, gotFiles, err = ResolveChainedSources(mountDir, files)
+	if err != nil {
+		t.Fatalf("ResolveChainedSources() error = %v", err)
+	}
+	info, err := os.Stat(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotDir != filepath.Dir(inner) || gotFiles[0].RelativePath != filepath.Base(inner) || gotFiles[0].Size != info.Size() {
+		t.Errorf("ResolveChainedSources() = (%s, %+v), want the .mkvdup file in %s", gotDir, gotFiles[0], filepath.Dir(inner))
+	}
+	if gotFiles[0].ChunkChecksums != nil {
+		t.Errorf("chained source kept the chunk checksums of the virtual file: %v", gotFiles[0].ChunkChecksums)
+	}
+}
@@ -0,0 +1,124 @@
+package dedup
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Extended checksum algorithms. These match the digests used by disc image
+// databases and archive catalogues, unlike the 64-bit xxhash values in the
+// header and source file records.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumBLAKE3 = "blake3" // 256-bit digest, as b3sum prints
+	ChecksumSHA512 = "sha512"
+	ChecksumSHA1   = "sha1"
+)
+
+// ChecksumAlgorithms lists the supported extended checksum algorithms,
+// default first.
+var ChecksumAlgorithms = []string{ChecksumSHA256, ChecksumBLAKE3, ChecksumSHA512, ChecksumSHA1}
+
+// NewChecksumHash returns a new hash for an extended checksum algorithm.
+func NewChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumBLAKE3:
+		return blake3.New(32, nil), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	case ChecksumSHA1:
+		return sha1.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q (supported: %s)",
+		algorithm, strings.Join(ChecksumAlgorithms, ", "))
+}
+
+// ExtendedChecksums holds cryptographic digests of the original MKV and of
+// each source file. They are stored in the CSUM extension record:
+//
+//	AlgorithmLen: uint8
+//	Algorithm: [AlgorithmLen]byte (e.g. "sha256")
+//	DigestSize: uint8
+//	Original: [DigestSize]byte
+//	SourceCount: uint16 (equal to the header's SourceFileCount)
+//	Sources: [SourceCount][DigestSize]byte
+type ExtendedChecksums struct {
+	Algorithm string   // One of ChecksumAlgorithms
+	Original  []byte   // Digest of the original MKV
+	Sources   [][]byte // Digest of each source file, in source file order
+}
+
+// encode returns the CSUM record data.
+func (c *ExtendedChecksums) encode() ([]byte, error) {
+	h, err := NewChecksumHash(c.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	size := h.Size()
+	if len(c.Original) != size {
+		return nil, fmt.Errorf("original %s digest is %d bytes, want %d", c.Algorithm, len(c.Original), size)
+	}
+	if len(c.Sources) > 0xFFFF {
+		return nil, fmt.Errorf("too many source digests (%d)", len(c.Sources))
+	}
+
+	buf := make([]byte, 0, 1+len(c.Algorithm)+1+size+2+len(c.Sources)*size)
+	buf = append(buf, uint8(len(c.Algorithm)))
+	buf = append(buf, c.Algorithm...)
+	buf = append(buf, uint8(size))
+	buf = append(buf, c.Original...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(c.Sources)))
+	for i, d := range c.Sources {
+		if len(d) != size {
+			return nil, fmt.Errorf("source %d %s digest is %d bytes, want %d", i, c.Algorithm, len(d), size)
+		}
+		buf = append(buf, d...)
+	}
+	return buf, nil
+}
+
+// parseExtendedChecksums parses CSUM record data for a file with
+// sourceFileCount source files. Algorithms this version does not know are
+// accepted; NewChecksumHash reports them when the digests are verified.
+func parseExtendedChecksums(data []byte, sourceFileCount int) (*ExtendedChecksums, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("checksum record too small")
+	}
+	algLen := int(data[0])
+	data = data[1:]
+	if len(data) < algLen+1 {
+		return nil, fmt.Errorf("checksum record truncated in algorithm name")
+	}
+	c := &ExtendedChecksums{Algorithm: string(data[:algLen])}
+	size := int(data[algLen])
+	data = data[algLen+1:]
+	if size == 0 {
+		return nil, fmt.Errorf("checksum record has zero digest size")
+	}
+	if len(data) < size+2 {
+		return nil, fmt.Errorf("checksum record truncated in original digest")
+	}
+	c.Original = data[:size]
+	count := int(binary.LittleEndian.Uint16(data[size : size+2]))
+	data = data[size+2:]
+	if count != sourceFileCount {
+		return nil, fmt.Errorf("checksum record has %d source digests, want %d", count, sourceFileCount)
+	}
+	if len(data) != count*size {
+		return nil, fmt.Errorf("checksum record has %d bytes of source digests, want %d", len(data), count*size)
+	}
+	c.Sources = make([][]byte, count)
+	for i := range c.Sources {
+		c.Sources[i] = data[i*size : (i+1)*size]
+	}
+	return c, nil
+}
@@ -0,0 +1,285 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testDigest returns the digest of data for algorithm.
+func testDigest(t *testing.T, algorithm string, data []byte) []byte {
+	t.Helper()
+	h, err := NewChecksumHash(algorithm)
+	if err != nil {
+		t.Fatalf("NewChecksumHash(%q): %v", algorithm, err)
+	}
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func TestNewChecksumHash(t *testing.T) {
+	// Digests of "abc", as sha256sum and b3sum print them
+	for alg, want := range map[string]string{
+		ChecksumSHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		ChecksumBLAKE3: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85",
+	} {
+		if got := fmt.Sprintf("%x", testDigest(t, alg, []byte("abc"))); got != want {
+			t.Errorf("%s digest = %s, want %s", alg, got, want)
+		}
+	}
+}
+
+func TestWriter_RoundTrip_ExtendedChecksums(t *testing.T) {
+	for _, alg := range ChecksumAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			dir := t.TempDir()
+			srcA := bytes.Repeat([]byte("source A "), 50)
+			srcB := bytes.Repeat([]byte("source B "), 30)
+			if err := os.WriteFile(filepath.Join(dir, "a.vob"), srcA, 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "b.vob"), srcB, 0644); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			delta := []byte("delta bytes")
+			var want []byte
+			want = append(want, delta...)
+			want = append(want, srcA[:100]...)
+			want = append(want, srcB[20:70]...)
+
+			checksums := &ExtendedChecksums{
+				Algorithm: alg,
+				Original:  testDigest(t, alg, want),
+				Sources:   [][]byte{testDigest(t, alg, srcA), testDigest(t, alg, srcB)},
+			}
+			d := int64(len(delta))
+			path := writeTestDedupFile(t, dir, writeTestOptions{
+				originalSize:   int64(len(want)),
+				sourceType:     source.TypeDVD,
+				creatorVersion: "test-v1",
+				compressDelta:  true,
+				compactIndex:   true,
+				checksums:      checksums,
+				sourceFiles: []source.File{
+					{RelativePath: "a.vob", Size: int64(len(srcA)), Checksum: 0xAAAA},
+					{RelativePath: "b.vob", Size: int64(len(srcB)), Checksum: 0xBBBB},
+				},
+				result: &matcher.Result{
+					Entries: []matcher.Entry{
+						{MkvOffset: 0, Length: d, Source: 0, SourceOffset: 0},
+						{MkvOffset: d, Length: 100, Source: 1, SourceOffset: 0},
+						{MkvOffset: d + 100, Length: 50, Source: 2, SourceOffset: 20},
+					},
+					DeltaData: delta,
+				},
+			})
+
+			r, err := NewReader(path, dir)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			defer r.Close()
+			if err := r.LoadSourceFiles(); err != nil {
+				t.Fatalf("LoadSourceFiles: %v", err)
+			}
+
+			info := r.Info()
+			if got := info["version"].(uint32); got != VersionExtensions {
+				t.Errorf("version = %d, want %d", got, VersionExtensions)
+			}
+			if got := info["checksum_algorithm"]; got != alg {
+				t.Errorf("checksum_algorithm = %v, want %s", got, alg)
+			}
+			got := r.ExtendedChecksums()
+			if got == nil {
+				t.Fatal("ExtendedChecksums() = nil")
+			}
+			if got.Algorithm != alg || !bytes.Equal(got.Original, checksums.Original) {
+				t.Errorf("ExtendedChecksums() = %s %x, want %s %x", got.Algorithm, got.Original, alg, checksums.Original)
+			}
+			for i := range checksums.Sources {
+				if !bytes.Equal(got.Sources[i], checksums.Sources[i]) {
+					t.Errorf("source %d digest = %x, want %x", i, got.Sources[i], checksums.Sources[i])
+				}
+			}
+			if err := r.VerifyIntegrity(); err != nil {
+				t.Fatalf("VerifyIntegrity: %v", err)
+			}
+
+			buf := make([]byte, len(want))
+			if n, err := r.ReadAt(buf, 0); err != nil || n != len(want) {
+				t.Fatalf("ReadAt: n=%d, err=%v", n, err)
+			}
+			if !bytes.Equal(buf, want) {
+				t.Error("reconstructed data mismatch")
+			}
+		})
+	}
+}
+
+func TestWriter_ExtendedChecksumsRangeMaps(t *testing.T) {
+	dir := t.TempDir()
+	srcData := make([]byte, 200)
+	for i := range srcData {
+		srcData[i] = byte(i * 3)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00001.m2ts"), srcData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	path := filepath.Join(dir, "test.mkvdup")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.SetHeader(184, 0x1234, source.TypeBluray)
+	w.SetCreatorVersion("test-v1")
+	w.SetSourceFiles([]source.File{{RelativePath: "00001.m2ts", Size: int64(len(srcData))}})
+	w.SetRangeMaps([]RangeMapData{{
+		VideoRanges: []source.PESPayloadRange{{FileOffset: 8, Size: 184, ESOffset: 0}},
+	}})
+	w.SetExtendedChecksums(&ExtendedChecksums{
+		Algorithm: ChecksumSHA256,
+		Original:  testDigest(t, ChecksumSHA256, srcData[8:192]),
+		Sources:   [][]byte{testDigest(t, ChecksumSHA256, srcData)},
+	})
+	if err := w.SetMatchResult(&matcher.Result{
+		Entries: []matcher.Entry{{MkvOffset: 0, Length: 184, Source: 1, SourceOffset: 0, IsVideo: true}},
+	}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	if got := r.Info()["version"].(uint32); got != VersionRangeMapExtensions {
+		t.Errorf("version = %d, want %d", got, VersionRangeMapExtensions)
+	}
+	if !r.HasRangeMaps() || !r.HasCompressedDelta() || r.ExtendedChecksums() == nil {
+		t.Error("V14 should have range maps, a compressed delta and checksums")
+	}
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	buf := make([]byte, 184)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(buf, srcData[8:192]) {
+		t.Error("range map region mismatch")
+	}
+}
+
+func TestWriter_ExtendedChecksumsSourceCountMismatch(t *testing.T) {
+	w, err := NewWriter(filepath.Join(t.TempDir(), "test.mkvdup"))
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+	w.SetHeader(0, 0, source.TypeDVD)
+	w.SetSourceFiles([]source.File{{RelativePath: "a.vob"}, {RelativePath: "b.vob"}})
+	w.SetExtendedChecksums(&ExtendedChecksums{
+		Algorithm: ChecksumSHA256,
+		Original:  testDigest(t, ChecksumSHA256, nil),
+		Sources:   [][]byte{testDigest(t, ChecksumSHA256, nil)},
+	})
+	if err := w.SetMatchResult(&matcher.Result{}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err == nil || !strings.Contains(err.Error(), "1 source digests for 2 source files") {
+		t.Errorf("Write error = %v, want source digest count mismatch", err)
+	}
+}
+
+func TestReadExtensions_SkipsUnknownRecords(t *testing.T) {
+	c := &ExtendedChecksums{Algorithm: ChecksumSHA1, Original: testDigest(t, ChecksumSHA1, []byte("x"))}
+	data, err := c.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	area, err := encodeExtensions([]extensionRecord{
+		{tag: "XTRA", data: []byte("future data")},
+		{tag: ExtensionTagChecksums, data: data},
+	})
+	if err != nil {
+		t.Fatalf("encodeExtensions: %v", err)
+	}
+
+	records, size, err := readExtensions(bytes.NewReader(area))
+	if err != nil {
+		t.Fatalf("readExtensions: %v", err)
+	}
+	if size != int64(len(area)) {
+		t.Errorf("size = %d, want %d", size, len(area))
+	}
+	if len(records) != 2 || records[0].tag != "XTRA" || records[1].tag != ExtensionTagChecksums {
+		t.Fatalf("records = %+v, want XTRA and CSUM", records)
+	}
+	got, err := parseExtendedChecksums(records[1].data, 0)
+	if err != nil {
+		t.Fatalf("parseExtendedChecksums: %v", err)
+	}
+	if got.Algorithm != ChecksumSHA1 || !bytes.Equal(got.Original, c.Original) {
+		t.Errorf("parsed %s %x, want %s %x", got.Algorithm, got.Original, c.Algorithm, c.Original)
+	}
+
+	// A record running past the end of the area is rejected.
+	if _, _, err := readExtensions(bytes.NewReader(area[:len(area)-1])); err == nil {
+		t.Error("readExtensions(truncated) succeeded")
+	}
+}
+
+func TestParseExtendedChecksums_Invalid(t *testing.T) {
+	c := &ExtendedChecksums{
+		Algorithm: ChecksumSHA256,
+		Original:  testDigest(t, ChecksumSHA256, []byte("orig")),
+		Sources:   [][]byte{testDigest(t, ChecksumSHA256, []byte("src"))},
+	}
+	valid, err := c.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := parseExtendedChecksums(valid, 1); err != nil {
+		t.Fatalf("parseExtendedChecksums(valid): %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		sources int
+		wantErr string
+	}{
+		{"empty", nil, 1, "too small"},
+		{"truncated name", valid[:3], 1, "algorithm name"},
+		{"truncated original", valid[:20], 1, "original digest"},
+		{"wrong source count", valid, 2, "1 source digests, want 2"},
+		{"truncated sources", valid[:len(valid)-1], 1, "bytes of source digests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExtendedChecksums(tt.data, tt.sources)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewChecksumHash("md5"); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("NewChecksumHash(md5) error = %v, want unsupported", err)
+	}
+}
@@ -0,0 +1,412 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// ErrBadSourceChunk is returned for reads of data stored in a source file
+// chunk marked corrupt with Reader.SetBadChunks.
+var ErrBadSourceChunk = errors.New("source data is in a chunk that failed its checksum")
+
+// ChunkChecksums holds the xxhash of each source file chunk a dedup file
+// reads from. Chunks the file never reads are left out, so verifying them
+// skips source data the file does not depend on. They are stored in the
+// CHNK extension record:
+//
+//	ChunkSize: uint32
+//	FileCount: uint16 (equal to the header's SourceFileCount)
+//	Per file:
+//	    RunCount: uvarint
+//	    Runs, each:
+//	        Skip: uvarint (chunks between the previous run and this one)
+//	        Count: uvarint
+//	    Sums: [chunks in all runs]uint64
+type ChunkChecksums struct {
+	ChunkSize int64        // Size of every chunk but the last of a file
+	Files     []FileChunks // One per source file, in source file order
+}
+
+// FileChunks lists the checksummed chunks of one source file. Chunk i
+// covers bytes [i*ChunkSize, (i+1)*ChunkSize) of the file.
+type FileChunks struct {
+	Chunks []int64  // Chunk indices, ascending
+	Sums   []uint64 // xxhash of each chunk in Chunks
+}
+
+// Count returns the total number of checksummed chunks.
+func (c *ChunkChecksums) Count() int {
+	n := 0
+	for _, fc := range c.Files {
+		n += len(fc.Chunks)
+	}
+	return n
+}
+
+// ByteCount returns the number of bytes the chunks cover in a file of
+// fileSize bytes.
+func (fc FileChunks) ByteCount(chunkSize, fileSize int64) int64 {
+	var n int64
+	for _, c := range fc.Chunks {
+		n += max(0, min(chunkSize, fileSize-c*chunkSize))
+	}
+	return n
+}
+
+// Mismatches compares the chunks against actual, the checksums of every
+// chunk of the file in order, and returns the chunks that differ.
+func (fc FileChunks) Mismatches(actual []uint64) []int64 {
+	var bad []int64
+	for i, c := range fc.Chunks {
+		if c >= int64(len(actual)) || actual[c] != fc.Sums[i] {
+			bad = append(bad, c)
+		}
+	}
+	return bad
+}
+
+// Verify reads each chunk from r, a file of fileSize bytes, and returns the
+// chunks whose checksum does not match. If progress is non-nil, it is
+// called with the number of bytes read so far after each chunk.
+func (fc FileChunks) Verify(r io.ReaderAt, chunkSize, fileSize int64, progress func(int64)) ([]int64, error) {
+	var bad []int64
+	var done int64
+	buf := make([]byte, chunkSize)
+	for i, c := range fc.Chunks {
+		start := c * chunkSize
+		n := min(chunkSize, fileSize-start)
+		if n <= 0 {
+			// The file is too small to hold the chunk
+			bad = append(bad, c)
+			continue
+		}
+		if m, err := r.ReadAt(buf[:n], start); int64(m) < n {
+			return nil, fmt.Errorf("read chunk %d: %w", c, err)
+		}
+		if xxhash.Sum64(buf[:n]) != fc.Sums[i] {
+			bad = append(bad, c)
+		}
+		done += n
+		if progress != nil {
+			progress(done)
+		}
+	}
+	return bad, nil
+}
+
+// encode returns the CHNK record data.
+func (c *ChunkChecksums) encode() ([]byte, error) {
+	if c.ChunkSize <= 0 || c.ChunkSize > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid chunk size %d", c.ChunkSize)
+	}
+	if len(c.Files) > 0xFFFF {
+		return nil, fmt.Errorf("too many source files (%d)", len(c.Files))
+	}
+
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(c.ChunkSize))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(c.Files)))
+	for i, fc := range c.Files {
+		if len(fc.Sums) != len(fc.Chunks) {
+			return nil, fmt.Errorf("source %d has %d chunk checksums for %d chunks", i, len(fc.Sums), len(fc.Chunks))
+		}
+		// Split the chunk list into runs of consecutive chunks
+		type run struct{ skip, count int64 }
+		var runs []run
+		next := int64(0) // First chunk after the previous run
+		for j, ch := range fc.Chunks {
+			if ch < next || (j > 0 && ch == fc.Chunks[j-1]) {
+				return nil, fmt.Errorf("source %d chunks are not ascending", i)
+			}
+			if len(runs) > 0 && ch == next {
+				runs[len(runs)-1].count++
+			} else {
+				runs = append(runs, run{skip: ch - next, count: 1})
+			}
+			next = ch + 1
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(runs)))
+		for _, r := range runs {
+			buf = binary.AppendUvarint(buf, uint64(r.skip))
+			buf = binary.AppendUvarint(buf, uint64(r.count))
+		}
+		for _, sum := range fc.Sums {
+			buf = binary.LittleEndian.AppendUint64(buf, sum)
+		}
+	}
+	return buf, nil
+}
+
+// parseChunkChecksums parses CHNK record data for a file with
+// sourceFileCount source files.
+func parseChunkChecksums(data []byte, sourceFileCount int) (*ChunkChecksums, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("chunk checksum record too small")
+	}
+	c := &ChunkChecksums{ChunkSize: int64(binary.LittleEndian.Uint32(data[0:4]))}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	data = data[6:]
+	if c.ChunkSize == 0 {
+		return nil, fmt.Errorf("chunk checksum record has zero chunk size")
+	}
+	if count != sourceFileCount {
+		return nil, fmt.Errorf("chunk checksum record has %d source files, want %d", count, sourceFileCount)
+	}
+
+	uvarint := func() (uint64, bool) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, false
+		}
+		data = data[n:]
+		return v, true
+	}
+	c.Files = make([]FileChunks, count)
+	for i := range c.Files {
+		runCount, ok := uvarint()
+		if !ok || runCount > uint64(len(data)) {
+			return nil, fmt.Errorf("chunk checksum record truncated in source %d runs", i)
+		}
+		var chunks []int64
+		next := int64(0)
+		for range runCount {
+			skip, ok1 := uvarint()
+			n, ok2 := uvarint()
+			if !ok1 || !ok2 || n == 0 || skip > math.MaxInt32 {
+				return nil, fmt.Errorf("chunk checksum record has an invalid run for source %d", i)
+			}
+			if n > uint64(len(data))/8 {
+				return nil, fmt.Errorf("chunk checksum record truncated in source %d checksums", i)
+			}
+			next += int64(skip)
+			for range n {
+				chunks = append(chunks, next)
+				next++
+			}
+		}
+		if len(data) < 8*len(chunks) {
+			return nil, fmt.Errorf("chunk checksum record truncated in source %d checksums", i)
+		}
+		sums := make([]uint64, len(chunks))
+		for j := range sums {
+			sums[j] = binary.LittleEndian.Uint64(data[8*j:])
+		}
+		data = data[8*len(chunks):]
+		c.Files[i] = FileChunks{Chunks: chunks, Sums: sums}
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("chunk checksum record has %d trailing bytes", len(data))
+	}
+	return c, nil
+}
+
+// sourceRangeWalker maps index entries to the source file bytes they read.
+type sourceRangeWalker struct {
+	files     []SourceFile
+	rangeMaps map[int]*SourceRangeMaps // nil for files with raw offsets
+	sets      map[int][]int            // VOB set parts, keyed by the first part
+}
+
+func newSourceRangeWalker(sourceType uint8, files []SourceFile, rangeMaps map[int]*SourceRangeMaps) *sourceRangeWalker {
+	wk := &sourceRangeWalker{files: files, rangeMaps: rangeMaps}
+	for _, set := range vobSetsFor(sourceType, files) {
+		if len(set) < 2 {
+			continue
+		}
+		if wk.sets == nil {
+			wk.sets = make(map[int][]int)
+		}
+		wk.sets[set[0]] = set
+	}
+	return wk
+}
+
+// walk calls fn with each byte range [start, end) of a source file that
+// source entry e reads, in the order the entry's data is assembled.
+func (wk *sourceRangeWalker) walk(e Entry, fn func(file int, start, end int64)) error {
+	fi := int(e.Source) - 1
+	if fi < 0 || fi >= len(wk.files) {
+		return fmt.Errorf("invalid source file %d", e.Source)
+	}
+	emit := func(start, end int64) { wk.emit(fi, start, end, fn) }
+	if wk.rangeMaps == nil {
+		emit(e.SourceOffset, e.SourceOffset+e.Length)
+		return nil
+	}
+
+	src, ok := wk.rangeMaps[fi]
+	if !ok {
+		return fmt.Errorf("no range map for source file %d", fi)
+	}
+	sm := src.VideoMap
+	if !e.IsVideo {
+		sm = src.AudioMaps[e.AudioSubStreamID]
+	}
+	if sm == nil {
+		return fmt.Errorf("no range map for stream of source file %d", fi)
+	}
+	return sm.rawRanges(e.SourceOffset, e.Length, emit)
+}
+
+// emit passes a range of file fi to fn, splitting ranges of a VOB set's
+// continuous stream across the set's parts.
+func (wk *sourceRangeWalker) emit(fi int, start, end int64, fn func(file int, start, end int64)) {
+	parts, ok := wk.sets[fi]
+	if !ok {
+		fn(fi, start, end)
+		return
+	}
+	var base int64
+	for _, p := range parts {
+		size := wk.files[p].Size
+		if s, e := max(start, base), min(end, base+size); s < e {
+			fn(p, s-base, e-base)
+		}
+		base += size
+		if base >= end {
+			return
+		}
+	}
+}
+
+// chunkChecksums returns the checksums of the source file chunks the
+// entries read, or nil if no source file has chunk checksums.
+func (w *Writer) chunkChecksums(rangeMapBuf []byte) (*ChunkChecksums, error) {
+	if w.chunkRecord != nil {
+		return w.chunkRecord, nil
+	}
+	if !w.hasChunkSums() {
+		return nil, nil
+	}
+	var rangeMaps map[int]*SourceRangeMaps
+	if rangeMapBuf != nil {
+		sources, err := readRangeMapSection(rangeMapBuf)
+		if err != nil {
+			return nil, fmt.Errorf("parse range maps: %w", err)
+		}
+		rangeMaps = rangeMapsByIndex(sources)
+	}
+	walker := newSourceRangeWalker(w.header.SourceType, w.sourceFiles, rangeMaps)
+
+	chunkSize := w.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = source.ChecksumChunkSize
+	}
+	used := make([][]bool, len(w.sourceFiles))
+	for i := range used {
+		used[i] = make([]bool, len(w.chunkSums[i]))
+	}
+	for _, e := range w.entries {
+		if e.Source == 0 {
+			continue
+		}
+		err := walker.walk(e, func(fi int, start, end int64) {
+			for c := start / chunkSize; c*chunkSize < end && c < int64(len(used[fi])); c++ {
+				used[fi][c] = true
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("entry at MKV offset %d: %w", e.MkvOffset, err)
+		}
+	}
+
+	c := &ChunkChecksums{ChunkSize: chunkSize, Files: make([]FileChunks, len(w.sourceFiles))}
+	for fi, u := range used {
+		for ci, ok := range u {
+			if ok {
+				c.Files[fi].Chunks = append(c.Files[fi].Chunks, int64(ci))
+				c.Files[fi].Sums = append(c.Files[fi].Sums, w.chunkSums[fi][ci])
+			}
+		}
+	}
+	return c, nil
+}
+
+// mkvRange is a byte range [start, end) of the reconstructed MKV.
+type mkvRange struct {
+	start, end int64
+}
+
+// overlapsAny reports whether [start, end) overlaps any of the sorted,
+// non-overlapping ranges.
+func overlapsAny(ranges []mkvRange, start, end int64) bool {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].end > start })
+	return i < len(ranges) && ranges[i].start < end
+}
+
+// ChunkChecksums returns the checksums of the source file chunks the file
+// reads, or nil if the file has none (before V13, or created from sources
+// without chunk checksums).
+func (r *Reader) ChunkChecksums() *ChunkChecksums {
+	return r.file.ChunkChecksums
+}
+
+// SetBadChunks marks source file chunks as corrupt, keyed by source file
+// index. Reads that touch MKV data stored in them fail with
+// ErrBadSourceChunk; the rest of the file stays readable. An empty map
+// clears the marks.
+func (r *Reader) SetBadChunks(bad map[int][]int64) error {
+	total := 0
+	for _, chunks := range bad {
+		total += len(chunks)
+	}
+	if total == 0 {
+		r.badRanges.Store(nil)
+		return nil
+	}
+	if r.file.ChunkChecksums == nil {
+		return fmt.Errorf("dedup file has no chunk checksums")
+	}
+	if err := r.initEntryAccess(); err != nil {
+		return fmt.Errorf("init entry access: %w", err)
+	}
+
+	chunkSize := r.file.ChunkChecksums.ChunkSize
+	sorted := make(map[int][]int64, len(bad))
+	for fi, chunks := range bad {
+		s := append([]int64(nil), chunks...)
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		sorted[fi] = s
+	}
+
+	walker := newSourceRangeWalker(r.file.Header.SourceType, r.file.SourceFiles, r.rangeMapsByFile)
+	var ranges []mkvRange
+	add := func(start, end int64) {
+		if n := len(ranges); n > 0 && ranges[n-1].end >= start {
+			ranges[n-1].end = max(ranges[n-1].end, end)
+			return
+		}
+		ranges = append(ranges, mkvRange{start, end})
+	}
+	for i := range r.entryCount {
+		e, ok := r.getEntry(i)
+		if !ok {
+			return fmt.Errorf("read entry %d", i)
+		}
+		if e.Source == 0 {
+			continue
+		}
+		pos := e.MkvOffset // MKV offset of the range being walked
+		err := walker.walk(e, func(fi int, start, end int64) {
+			chunks := sorted[fi]
+			j := sort.Search(len(chunks), func(j int) bool { return (chunks[j]+1)*chunkSize > start })
+			for ; j < len(chunks) && chunks[j]*chunkSize < end; j++ {
+				s := max(start, chunks[j]*chunkSize)
+				e := min(end, (chunks[j]+1)*chunkSize)
+				add(pos+s-start, pos+e-start)
+			}
+			pos += end - start
+		})
+		if err != nil {
+			return fmt.Errorf("entry at MKV offset %d: %w", e.MkvOffset, err)
+		}
+	}
+	r.badRanges.Store(&ranges)
+	return nil
+}
@@ -0,0 +1,247 @@
+package dedup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testChunkSums returns the chunk checksums of data.
+func testChunkSums(data []byte, chunkSize int64) []uint64 {
+	h := source.NewChunkHasher(chunkSize)
+	h.Write(data)
+	return h.ChunkSums()
+}
+
+func TestWriter_ChunkChecksums_VOBSet(t *testing.T) {
+	dir := t.TempDir()
+	videoTS := filepath.Join(dir, "VIDEO_TS")
+	if err := os.MkdirAll(videoTS, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	vob1 := make([]byte, 64)
+	vob2 := make([]byte, 64)
+	for i := range vob1 {
+		vob1[i] = byte(i)
+		vob2[i] = byte(200 - i)
+	}
+	path1 := filepath.Join(videoTS, "VTS_01_1.VOB")
+	if err := os.WriteFile(path1, vob1, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(videoTS, "VTS_01_2.VOB"), vob2, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	set := append(append([]byte(nil), vob1...), vob2...)
+	want := append(append([]byte("dd"), set[20:40]...), set[56:72]...)
+
+	const chunkSize = 16
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize: int64(len(want)),
+		sourceType:   source.TypeDVD,
+		chunkSize:    chunkSize,
+		sourceFiles: []source.File{
+			{RelativePath: filepath.Join("VIDEO_TS", "VTS_01_1.VOB"), Size: 64, ChunkChecksums: testChunkSums(vob1, chunkSize)},
+			{RelativePath: filepath.Join("VIDEO_TS", "VTS_01_2.VOB"), Size: 64, ChunkChecksums: testChunkSums(vob2, chunkSize)},
+		},
+		result: &matcher.Result{
+			Entries: []matcher.Entry{
+				{MkvOffset: 0, Length: 2, Source: 0, SourceOffset: 0},
+				{MkvOffset: 2, Length: 20, Source: 1, SourceOffset: 20},
+				// Crosses from the first part into the second
+				{MkvOffset: 22, Length: 16, Source: 1, SourceOffset: 56},
+			},
+			DeltaData: []byte("dd"),
+		},
+	})
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	if got := r.Info()["version"].(uint32); got != VersionExtensions {
+		t.Errorf("version = %d, want %d", got, VersionExtensions)
+	}
+
+	chunks := r.ChunkChecksums()
+	if chunks == nil {
+		t.Fatal("ChunkChecksums() = nil")
+	}
+	if chunks.ChunkSize != chunkSize {
+		t.Errorf("ChunkSize = %d, want %d", chunks.ChunkSize, chunkSize)
+	}
+	// Only the chunks the entries read are recorded
+	if got := chunks.Files[0].Chunks; !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("part 1 chunks = %v, want [1 2 3]", got)
+	}
+	if got := chunks.Files[1].Chunks; !reflect.DeepEqual(got, []int64{0}) {
+		t.Errorf("part 2 chunks = %v, want [0]", got)
+	}
+	if bad, err := chunks.Files[0].Verify(bytes.NewReader(vob1), chunkSize, 64, nil); err != nil || len(bad) != 0 {
+		t.Errorf("Verify(intact) = %v, %v; want no bad chunks", bad, err)
+	}
+	corrupt := append([]byte(nil), vob1...)
+	corrupt[35] ^= 0xFF
+	if bad, err := chunks.Files[0].Verify(bytes.NewReader(corrupt), chunkSize, 64, nil); err != nil || !reflect.DeepEqual(bad, []int64{2}) {
+		t.Errorf("Verify(corrupt) = %v, %v; want [2]", bad, err)
+	}
+	if bad := chunks.Files[0].Mismatches(testChunkSums(corrupt, chunkSize)); !reflect.DeepEqual(bad, []int64{2}) {
+		t.Errorf("Mismatches(corrupt) = %v, want [2]", bad)
+	}
+
+	// Marking chunk 2 of the first part fails only the reads touching
+	// MKV bytes [14, 22), which came from set bytes [32, 40).
+	if err := r.SetBadChunks(map[int][]int64{0: {2}}); err != nil {
+		t.Fatalf("SetBadChunks: %v", err)
+	}
+	buf := make([]byte, 16)
+	if _, err := r.ReadAt(buf[:12], 0); err != nil {
+		t.Errorf("ReadAt(0) before the bad chunk: %v", err)
+	}
+	if _, err := r.ReadAt(buf[:4], 12); !errors.Is(err, ErrBadSourceChunk) {
+		t.Errorf("ReadAt(12) error = %v, want ErrBadSourceChunk", err)
+	}
+	if _, err := r.ReadAt(buf[:16], 22); err != nil || !bytes.Equal(buf[:16], want[22:]) {
+		t.Errorf("ReadAt(22) after the bad chunk: %v", err)
+	}
+	if err := r.SetBadChunks(nil); err != nil {
+		t.Fatalf("SetBadChunks(nil): %v", err)
+	}
+	got := make([]byte, len(want))
+	if _, err := r.ReadAt(got, 0); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadAt after clearing: %v", err)
+	}
+}
+
+func TestWriter_ChunkChecksumsRangeMaps(t *testing.T) {
+	dir := t.TempDir()
+	srcData := make([]byte, 200)
+	for i := range srcData {
+		srcData[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00001.m2ts"), srcData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	const chunkSize = 32
+	path := filepath.Join(dir, "test.mkvdup")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.SetHeader(40, 0, source.TypeBluray)
+	w.SetChunkSize(chunkSize)
+	w.SetSourceFiles([]source.File{{
+		RelativePath:   "00001.m2ts",
+		Size:           int64(len(srcData)),
+		ChunkChecksums: testChunkSums(srcData, chunkSize),
+	}})
+	w.SetRangeMaps([]RangeMapData{{
+		VideoRanges: []source.PESPayloadRange{
+			{FileOffset: 8, Size: 20, ESOffset: 0},
+			{FileOffset: 100, Size: 20, ESOffset: 20},
+		},
+	}})
+	if err := w.SetMatchResult(&matcher.Result{
+		Entries: []matcher.Entry{{MkvOffset: 0, Length: 40, Source: 1, SourceOffset: 0, IsVideo: true}},
+	}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	if got := r.Info()["version"].(uint32); got != VersionRangeMapExtensions {
+		t.Errorf("version = %d, want %d", got, VersionRangeMapExtensions)
+	}
+	chunks := r.ChunkChecksums()
+	if chunks == nil || !reflect.DeepEqual(chunks.Files[0].Chunks, []int64{0, 3}) {
+		t.Fatalf("ChunkChecksums() = %+v, want chunks [0 3]", chunks)
+	}
+
+	if err := r.SetBadChunks(map[int][]int64{0: {3}}); err != nil {
+		t.Fatalf("SetBadChunks: %v", err)
+	}
+	buf := make([]byte, 20)
+	if _, err := r.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, srcData[8:28]) {
+		t.Errorf("ReadAt(0): %v", err)
+	}
+	if _, err := r.ReadAt(buf, 20); !errors.Is(err, ErrBadSourceChunk) {
+		t.Errorf("ReadAt(20) error = %v, want ErrBadSourceChunk", err)
+	}
+}
+
+func TestChunkChecksums_EncodeParse(t *testing.T) {
+	c := &ChunkChecksums{
+		ChunkSize: 4 << 20,
+		Files: []FileChunks{
+			{Chunks: []int64{0, 1, 2, 7, 9, 10}, Sums: []uint64{1, 2, 3, 4, 5, 6}},
+			{},
+			{Chunks: []int64{300}, Sums: []uint64{0xFFFFFFFFFFFFFFFF}},
+		},
+	}
+	data, err := c.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, err := parseChunkChecksums(data, 3)
+	if err != nil {
+		t.Fatalf("parseChunkChecksums: %v", err)
+	}
+	if got.ChunkSize != c.ChunkSize || got.Count() != 7 {
+		t.Errorf("parsed chunk size %d, count %d; want %d, 7", got.ChunkSize, got.Count(), c.ChunkSize)
+	}
+	for i := range c.Files {
+		if len(c.Files[i].Chunks) == 0 && len(got.Files[i].Chunks) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got.Files[i], c.Files[i]) {
+			t.Errorf("file %d = %+v, want %+v", i, got.Files[i], c.Files[i])
+		}
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		sources int
+		wantErr string
+	}{
+		{"empty", nil, 3, "too small"},
+		{"wrong source count", data, 2, "3 source files, want 2"},
+		{"truncated sums", data[:len(data)-1], 3, "truncated"},
+		{"trailing bytes", append(append([]byte(nil), data...), 0), 3, "trailing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseChunkChecksums(tt.data, tt.sources)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	unsorted := &ChunkChecksums{ChunkSize: 16, Files: []FileChunks{{Chunks: []int64{3, 1}, Sums: []uint64{1, 2}}}}
+	if _, err := unsorted.encode(); err == nil {
+		t.Error("encode(unsorted chunks) succeeded")
+	}
+}
@@ -0,0 +1,277 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A compact (V11/V12) index stores entries as varints in blocks of
+// CompactIndexBlockEntries. Each block is decodable on its own: it starts
+// from the absolute MkvOffset in the seek table, and every other field is
+// predicted from earlier entries of the same block.
+//
+// Per entry:
+//
+//	Flags: uint8 (ESFlags bits 0-2, compactFlagSourceChanged, compactFlagSubStreamChanged,
+//	    compactFlagFill)
+//	Source: uvarint (only if compactFlagSourceChanged)
+//	AudioSubStreamID: uint8 (only if compactFlagSubStreamChanged)
+//	MkvGap: varint (MkvOffset minus the end of the previous entry; usually 0)
+//	Length: uvarint
+//	SourceOffsetDelta: varint (SourceOffset minus the end of the previous
+//	    entry of the same stream in this block, or minus 0 if there is none),
+//	    or for a fill entry its pattern (SourceOffset) as a uvarint
+
+// compactBlockCacheSize is the number of decoded index blocks a Reader keeps.
+const compactBlockCacheSize = 4
+
+// compactStreamKey identifies the stream an entry reads from, for
+// SourceOffset prediction.
+type compactStreamKey struct {
+	source    uint16
+	isVideo   bool
+	subStream byte
+}
+
+// compactStreamEnds tracks, per stream, where the previous entry of that
+// stream ended. Blocks only touch a few streams, so a slice beats a map.
+type compactStreamEnds []struct {
+	key compactStreamKey
+	end int64
+}
+
+func (s *compactStreamEnds) predict(key compactStreamKey) int64 {
+	for _, e := range *s {
+		if e.key == key {
+			return e.end
+		}
+	}
+	return 0
+}
+
+func (s *compactStreamEnds) update(key compactStreamKey, end int64) {
+	for i := range *s {
+		if (*s)[i].key == key {
+			(*s)[i].end = end
+			return
+		}
+	}
+	*s = append(*s, struct {
+		key compactStreamKey
+		end int64
+	}{key, end})
+}
+
+// entryFlags returns the ESFlags byte of an entry.
+func entryFlags(e Entry) uint8 {
+	var flags uint8
+	if e.IsVideo {
+		flags |= 1
+	}
+	if e.IsLPCM {
+		flags |= 2
+	}
+	if e.IsLPCM24 {
+		flags |= 4
+	}
+	if e.IsFill {
+		flags |= 8
+	}
+	return flags
+}
+
+// encodeCompactIndex encodes entries as a compact index section.
+func encodeCompactIndex(entries []Entry) []byte {
+	blockCount := (len(entries) + CompactIndexBlockEntries - 1) / CompactIndexBlockEntries
+	seekSize := CompactIndexHeaderSize + blockCount*CompactIndexSeekEntrySize
+
+	buf := make([]byte, seekSize, seekSize+len(entries)*6)
+	binary.LittleEndian.PutUint32(buf[0:4], CompactIndexBlockEntries)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(blockCount))
+
+	var ends compactStreamEnds
+	for b := range blockCount {
+		block := entries[b*CompactIndexBlockEntries : min((b+1)*CompactIndexBlockEntries, len(entries))]
+		seek := buf[CompactIndexHeaderSize+b*CompactIndexSeekEntrySize:]
+		binary.LittleEndian.PutUint64(seek[0:8], uint64(block[0].MkvOffset))
+		binary.LittleEndian.PutUint64(seek[8:16], uint64(len(buf)-seekSize))
+
+		prev := Entry{MkvOffset: block[0].MkvOffset}
+		ends = ends[:0]
+		for _, e := range block {
+			flags := entryFlags(e) & 7
+			if e.IsFill {
+				flags |= compactFlagFill
+			}
+			if e.Source != prev.Source {
+				flags |= compactFlagSourceChanged
+			}
+			if e.AudioSubStreamID != prev.AudioSubStreamID {
+				flags |= compactFlagSubStreamChanged
+			}
+			buf = append(buf, flags)
+			if flags&compactFlagSourceChanged != 0 {
+				buf = binary.AppendUvarint(buf, uint64(e.Source))
+			}
+			if flags&compactFlagSubStreamChanged != 0 {
+				buf = append(buf, e.AudioSubStreamID)
+			}
+			buf = binary.AppendVarint(buf, e.MkvOffset-(prev.MkvOffset+prev.Length))
+			buf = binary.AppendUvarint(buf, uint64(e.Length))
+			if e.IsFill {
+				buf = binary.AppendUvarint(buf, uint64(e.SourceOffset))
+				prev = e
+				continue
+			}
+
+			key := compactStreamKey{e.Source, e.IsVideo, e.AudioSubStreamID}
+			buf = binary.AppendVarint(buf, e.SourceOffset-ends.predict(key))
+			ends.update(key, e.SourceOffset+e.Length)
+			prev = e
+		}
+	}
+	return buf
+}
+
+// compactIndex provides block-wise access to a compact index section.
+type compactIndex struct {
+	data            []byte  // Block data (after the seek table)
+	entriesPerBlock int     // Entries per block (the last block may be shorter)
+	entryCount      int     // Total number of entries
+	firstOffsets    []int64 // MkvOffset of each block's first entry
+	dataOffsets     []int   // Start of each block within data, plus len(data)
+}
+
+// parseCompactIndex parses the header and seek table of a compact index
+// section holding entryCount entries.
+func parseCompactIndex(section []byte, entryCount int) (*compactIndex, error) {
+	if len(section) < CompactIndexHeaderSize {
+		return nil, fmt.Errorf("compact index too small (%d bytes)", len(section))
+	}
+	perBlock := int(binary.LittleEndian.Uint32(section[0:4]))
+	blockCount := int(binary.LittleEndian.Uint32(section[4:8]))
+	if perBlock <= 0 {
+		return nil, fmt.Errorf("invalid compact index block size %d", perBlock)
+	}
+	if want := (entryCount + perBlock - 1) / perBlock; blockCount != want {
+		return nil, fmt.Errorf("compact index has %d blocks, want %d for %d entries", blockCount, want, entryCount)
+	}
+	seekSize := CompactIndexHeaderSize + blockCount*CompactIndexSeekEntrySize
+	if len(section) < seekSize {
+		return nil, fmt.Errorf("compact index seek table (%d blocks) exceeds section size %d", blockCount, len(section))
+	}
+
+	ci := &compactIndex{
+		data:            section[seekSize:],
+		entriesPerBlock: perBlock,
+		entryCount:      entryCount,
+		firstOffsets:    make([]int64, blockCount),
+		dataOffsets:     make([]int, blockCount+1),
+	}
+	for b := range blockCount {
+		seek := section[CompactIndexHeaderSize+b*CompactIndexSeekEntrySize:]
+		ci.firstOffsets[b] = int64(binary.LittleEndian.Uint64(seek[0:8]))
+		off := binary.LittleEndian.Uint64(seek[8:16])
+		if off > uint64(len(ci.data)) || (b > 0 && int(off) < ci.dataOffsets[b-1]) {
+			return nil, fmt.Errorf("compact index block %d has invalid data offset %d", b, off)
+		}
+		ci.dataOffsets[b] = int(off)
+	}
+	ci.dataOffsets[blockCount] = len(ci.data)
+	return ci, nil
+}
+
+// blockCount returns the number of blocks.
+func (ci *compactIndex) blockCount() int {
+	return len(ci.firstOffsets)
+}
+
+// decodeBlock decodes the entries of block b.
+func (ci *compactIndex) decodeBlock(b int) ([]Entry, error) {
+	if b < 0 || b >= ci.blockCount() {
+		return nil, fmt.Errorf("compact index block %d out of range", b)
+	}
+	data := ci.data[ci.dataOffsets[b]:ci.dataOffsets[b+1]]
+	n := min(ci.entriesPerBlock, ci.entryCount-b*ci.entriesPerBlock)
+	entries := make([]Entry, n)
+
+	prev := Entry{MkvOffset: ci.firstOffsets[b]}
+	var ends compactStreamEnds
+	pos := 0
+	uvarint := func() (uint64, bool) {
+		v, k := binary.Uvarint(data[pos:])
+		if k <= 0 {
+			return 0, false
+		}
+		pos += k
+		return v, true
+	}
+	varint := func() (int64, bool) {
+		v, k := binary.Varint(data[pos:])
+		if k <= 0 {
+			return 0, false
+		}
+		pos += k
+		return v, true
+	}
+
+	for i := range entries {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("compact index block %d truncated at entry %d", b, i)
+		}
+		flags := data[pos]
+		pos++
+
+		e := Entry{
+			Source:           prev.Source,
+			AudioSubStreamID: prev.AudioSubStreamID,
+			IsVideo:          flags&1 != 0,
+			IsLPCM:           flags&2 != 0,
+			IsLPCM24:         flags&4 != 0,
+			IsFill:           flags&compactFlagFill != 0,
+		}
+		if flags&compactFlagSourceChanged != 0 {
+			src, ok := uvarint()
+			if !ok || src > 0xFFFF {
+				return nil, fmt.Errorf("compact index block %d: invalid source at entry %d", b, i)
+			}
+			e.Source = uint16(src)
+		}
+		if flags&compactFlagSubStreamChanged != 0 {
+			if pos >= len(data) {
+				return nil, fmt.Errorf("compact index block %d truncated at entry %d", b, i)
+			}
+			e.AudioSubStreamID = data[pos]
+			pos++
+		}
+		gap, ok1 := varint()
+		length, ok2 := uvarint()
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("compact index block %d truncated at entry %d", b, i)
+		}
+		e.MkvOffset = prev.MkvOffset + prev.Length + gap
+		e.Length = int64(length)
+		if e.IsFill {
+			pattern, ok := uvarint()
+			if !ok {
+				return nil, fmt.Errorf("compact index block %d truncated at entry %d", b, i)
+			}
+			e.SourceOffset = int64(pattern)
+			entries[i] = e
+			prev = e
+			continue
+		}
+		srcDelta, ok := varint()
+		if !ok {
+			return nil, fmt.Errorf("compact index block %d truncated at entry %d", b, i)
+		}
+
+		key := compactStreamKey{e.Source, e.IsVideo, e.AudioSubStreamID}
+		e.SourceOffset = ends.predict(key) + srcDelta
+		ends.update(key, e.SourceOffset+e.Length)
+
+		entries[i] = e
+		prev = e
+	}
+	return entries, nil
+}
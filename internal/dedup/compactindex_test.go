@@ -0,0 +1,239 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testCompactEntries returns n contiguous entries that interleave delta,
+// video and audio entries from several sources, with the occasional gap,
+// LPCM flag and backwards SourceOffset jump.
+func testCompactEntries(n int) []Entry {
+	rng := rand.New(rand.NewPCG(11, 0))
+	entries := make([]Entry, n)
+	var mkv, delta int64
+	esEnd := map[compactStreamKey]int64{}
+	for i := range entries {
+		length := int64(1 + rng.IntN(5000))
+		e := Entry{MkvOffset: mkv, Length: length}
+		switch rng.IntN(4) {
+		case 0:
+			e.SourceOffset = delta
+			delta += length
+		case 1:
+			e.Source = uint16(1 + rng.IntN(3))
+			e.IsVideo = true
+		default:
+			e.Source = uint16(1 + rng.IntN(3))
+			e.AudioSubStreamID = byte(0x80 + rng.IntN(2))
+			e.IsLPCM = e.AudioSubStreamID == 0x81
+			e.IsLPCM24 = e.IsLPCM && rng.IntN(2) == 0
+		}
+		if e.Source != 0 {
+			key := compactStreamKey{e.Source, e.IsVideo, e.AudioSubStreamID}
+			e.SourceOffset = esEnd[key] + int64(rng.IntN(3)*184)
+			if rng.IntN(50) == 0 {
+				e.SourceOffset = int64(rng.IntN(1 << 20)) // Seek elsewhere
+			}
+			esEnd[key] = e.SourceOffset + length
+		}
+		entries[i] = e
+		mkv += length
+		if rng.IntN(100) == 0 {
+			mkv += 7 // Rare gap between entries
+		}
+	}
+	return entries
+}
+
+func TestCompactIndex_RoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, CompactIndexBlockEntries, 5*CompactIndexBlockEntries + 17} {
+		entries := testCompactEntries(n)
+		buf := encodeCompactIndex(entries)
+
+		ci, err := parseCompactIndex(buf, n)
+		if err != nil {
+			t.Fatalf("n=%d: parseCompactIndex: %v", n, err)
+		}
+		var got []Entry
+		for b := 0; b < ci.blockCount(); b++ {
+			block, err := ci.decodeBlock(b)
+			if err != nil {
+				t.Fatalf("n=%d: decodeBlock(%d): %v", n, b, err)
+			}
+			got = append(got, block...)
+		}
+		if len(got) != n {
+			t.Fatalf("n=%d: decoded %d entries", n, len(got))
+		}
+		for i := range entries {
+			if got[i] != entries[i] {
+				t.Fatalf("n=%d: entry %d = %+v, want %+v", n, i, got[i], entries[i])
+			}
+		}
+		if n > CompactIndexBlockEntries && len(buf) > n*EntrySize/3 {
+			t.Errorf("n=%d: compact index is %d bytes, want under a third of %d", n, len(buf), n*EntrySize)
+		}
+	}
+}
+
+func TestParseCompactIndex_Invalid(t *testing.T) {
+	entries := testCompactEntries(2 * CompactIndexBlockEntries)
+	valid := encodeCompactIndex(entries)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		entries int
+		want    string
+	}{
+		{"too small", valid[:4], len(entries), "too small"},
+		{"wrong entry count", valid, len(entries) + CompactIndexBlockEntries, "blocks"},
+		{"zero block size", func() []byte {
+			b := bytes.Clone(valid)
+			binary.LittleEndian.PutUint32(b[0:4], 0)
+			return b
+		}(), len(entries), "block size"},
+		{"truncated seek table", valid[:CompactIndexHeaderSize+CompactIndexSeekEntrySize], len(entries), "seek table"},
+		{"decreasing data offset", func() []byte {
+			b := bytes.Clone(valid)
+			binary.LittleEndian.PutUint64(b[CompactIndexHeaderSize+CompactIndexSeekEntrySize+8:], 0)
+			binary.LittleEndian.PutUint64(b[CompactIndexHeaderSize+8:], 10)
+			return b
+		}(), len(entries), "invalid data offset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCompactIndex(tt.data, tt.entries)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseCompactIndex error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// A truncated final block parses but fails to decode.
+	ci, err := parseCompactIndex(valid[:len(valid)-10], len(entries))
+	if err != nil {
+		t.Fatalf("parseCompactIndex(truncated block): %v", err)
+	}
+	if _, err := ci.decodeBlock(1); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("decodeBlock(truncated) error = %v, want truncated", err)
+	}
+}
+
+func TestWriter_RoundTrip_CompactIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	// Alternate 100-byte delta and source entries across several blocks.
+	const pairs = 3 * CompactIndexBlockEntries
+	srcData := make([]byte, pairs*100)
+	for i := range srcData {
+		srcData[i] = byte(i*31 + 7)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "source.vob"), srcData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	var want, delta []byte
+	var entries []matcher.Entry
+	for i := 0; i < pairs; i++ {
+		d := bytes.Repeat([]byte{byte(i)}, 100)
+		entries = append(entries,
+			matcher.Entry{MkvOffset: int64(len(want)), Length: 100, Source: 0, SourceOffset: int64(len(delta))},
+			matcher.Entry{MkvOffset: int64(len(want)) + 100, Length: 100, Source: 1, SourceOffset: int64(i * 100)},
+		)
+		want = append(want, d...)
+		want = append(want, srcData[i*100:(i+1)*100]...)
+		delta = append(delta, d...)
+	}
+
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize:   int64(len(want)),
+		sourceType:     source.TypeDVD,
+		creatorVersion: "test-v1",
+		compactIndex:   true,
+		sourceFiles: []source.File{
+			{RelativePath: "source.vob", Size: int64(len(srcData)), Checksum: 0xBBBB},
+		},
+		result: &matcher.Result{Entries: entries, DeltaData: delta},
+	})
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+
+	info := r.Info()
+	if got := info["version"].(uint32); got != VersionCompactIndex {
+		t.Errorf("version = %d, want %d", got, VersionCompactIndex)
+	}
+	if !info["compact_index"].(bool) || !info["delta_compressed"].(bool) {
+		t.Error("V11 should have a compact index and compressed delta")
+	}
+	if got := info["index_size"].(int64); got >= int64(len(entries))*EntrySize/4 {
+		t.Errorf("index_size = %d, want well below %d", got, len(entries)*EntrySize)
+	}
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+
+	// Random access in reverse order decodes blocks on demand.
+	for i := len(entries) - 1; i >= 0; i -= 37 {
+		got, ok := r.GetEntry(i)
+		if !ok || got != FromMatcherEntry(entries[i]) {
+			t.Fatalf("GetEntry(%d) = %+v, %v; want %+v", i, got, ok, entries[i])
+		}
+	}
+
+	buf := make([]byte, len(want))
+	if n, err := r.ReadAt(buf, 0); err != nil || n != len(want) {
+		t.Fatalf("ReadAt full: n=%d, err=%v", n, err)
+	}
+	if !bytes.Equal(buf, want) {
+		t.Error("full read mismatch")
+	}
+	for _, off := range []int{len(want) - 1, 12345, 99, CompactIndexBlockEntries * 200} {
+		part := make([]byte, min(300, len(want)-off))
+		if _, err := r.ReadAt(part, int64(off)); err != nil {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(part, want[off:off+len(part)]) {
+			t.Errorf("ReadAt(%d) mismatch", off)
+		}
+	}
+}
+
+func TestCompactIndex_FillEntries(t *testing.T) {
+	entries := []Entry{
+		{MkvOffset: 0, Length: 100, SourceOffset: 0},
+		FromMatcherEntry(matcher.NewFillEntry(100, 5000, []byte{0})),
+		{MkvOffset: 5100, Length: 300, Source: 1, SourceOffset: 4096, IsVideo: true},
+		FromMatcherEntry(matcher.NewFillEntry(5400, 999, []byte{0xFF, 0xEE, 0xDD, 0xCC, 0xBB, 0xAA, 0x99, 0x88})),
+		{MkvOffset: 6399, Length: 50, SourceOffset: 100},
+	}
+	buf := encodeCompactIndex(entries)
+	ci, err := parseCompactIndex(buf, len(entries))
+	if err != nil {
+		t.Fatalf("parseCompactIndex: %v", err)
+	}
+	got, err := ci.decodeBlock(0)
+	if err != nil {
+		t.Fatalf("decodeBlock: %v", err)
+	}
+	for i := range entries {
+		if got[i] != entries[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], entries[i])
+		}
+	}
+}
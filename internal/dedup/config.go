@@ -321,15 +321,18 @@ func resolveConfig(configPath string, seen map[string]bool) ([]Config, *ErrorCom
 // BatchManifest represents the batch create manifest file format.
 type BatchManifest struct {
 	SourceDir string              `yaml:"source_dir"`
+	Playlist  string              `yaml:"playlist"`
 	Files     []BatchManifestFile `yaml:"files"`
 }
 
 // BatchManifestFile represents a single file entry in a batch manifest.
+// Playlist names the Blu-ray playlist the MKV was muxed from, or "auto".
 type BatchManifestFile struct {
 	MKV       string `yaml:"mkv"`
 	Output    string `yaml:"output"`
 	Name      string `yaml:"name"`
 	SourceDir string `yaml:"source_dir"`
+	Playlist  string `yaml:"playlist"`
 }
 
 // ReadBatchManifest reads and validates a batch manifest file.
@@ -391,6 +394,11 @@ func ReadBatchManifest(manifestPath string) (*BatchManifest, error) {
 		} else {
 			return nil, fmt.Errorf("batch manifest %s: files[%d] has no source_dir (set per-file or top-level default)", manifestPath, i)
 		}
+
+		// Fall back to the top-level playlist default
+		if f.Playlist == "" {
+			f.Playlist = manifest.Playlist
+		}
 	}
 
 	return &manifest, nil
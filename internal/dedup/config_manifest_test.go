@@ -236,6 +236,31 @@ files:
 	}
 }
 
+func TestReadBatchManifest_Playlist(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "batch.yaml")
+	writeYAML(t, manifestPath, `source_dir: /source/bluray
+playlist: auto
+files:
+  - mkv: /data/feature.mkv
+    output: /data/feature.mkvdup
+  - mkv: /data/extras.mkv
+    output: /data/extras.mkvdup
+    playlist: 00012.mpls
+`)
+
+	m, err := ReadBatchManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("ReadBatchManifest: %v", err)
+	}
+	if m.Files[0].Playlist != "auto" {
+		t.Errorf("Files[0].Playlist = %q, want %q", m.Files[0].Playlist, "auto")
+	}
+	if m.Files[1].Playlist != "00012.mpls" {
+		t.Errorf("Files[1].Playlist = %q, want %q", m.Files[1].Playlist, "00012.mpls")
+	}
+}
+
 func TestReadBatchManifest_PerFileSourceDir_Relative(t *testing.T) {
 	dir := t.TempDir()
 	subDir := filepath.Join(dir, "manifests")
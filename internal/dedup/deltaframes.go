@@ -0,0 +1,167 @@
+package dedup
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// deltaFrameWriter writes a compressed (V9+) delta section: each
+// DeltaFrameSize chunk of delta is DEFLATE-compressed on its own, and the
+// frame table and trailer follow the last frame.
+type deltaFrameWriter struct {
+	w           io.Writer
+	zw          *flate.Writer
+	buf         bytes.Buffer
+	sizes       []uint32 // Frame table entries (stored size, deltaFrameStored bit)
+	logicalSize int64
+	storedSize  int64
+}
+
+func newDeltaFrameWriter(w io.Writer) (*deltaFrameWriter, error) {
+	zw, err := flate.NewWriter(nil, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return &deltaFrameWriter{w: w, zw: zw}, nil
+}
+
+// writeFrame compresses and writes one frame. Every frame except the last
+// must be exactly DeltaFrameSize bytes.
+func (fw *deltaFrameWriter) writeFrame(frame []byte) error {
+	fw.buf.Reset()
+	fw.zw.Reset(&fw.buf)
+	if _, err := fw.zw.Write(frame); err != nil {
+		return err
+	}
+	if err := fw.zw.Close(); err != nil {
+		return err
+	}
+
+	data := fw.buf.Bytes()
+	size := uint32(len(data))
+	if len(data) >= len(frame) {
+		// Incompressible: store as-is so reads need no decompression.
+		data = frame
+		size = uint32(len(frame)) | deltaFrameStored
+	}
+	if _, err := fw.w.Write(data); err != nil {
+		return err
+	}
+	fw.sizes = append(fw.sizes, size)
+	fw.logicalSize += int64(len(frame))
+	fw.storedSize += int64(len(data))
+	return nil
+}
+
+// finish writes the frame table and trailer and returns the total size of
+// the delta section.
+func (fw *deltaFrameWriter) finish() (int64, error) {
+	tail := make([]byte, 4*len(fw.sizes)+DeltaFrameTrailerSize)
+	off := 0
+	for _, size := range fw.sizes {
+		binary.LittleEndian.PutUint32(tail[off:], size)
+		off += 4
+	}
+	binary.LittleEndian.PutUint64(tail[off:], uint64(fw.logicalSize))
+	binary.LittleEndian.PutUint32(tail[off+8:], DeltaFrameSize)
+	binary.LittleEndian.PutUint32(tail[off+12:], uint32(len(fw.sizes)))
+	copy(tail[off+16:], DeltaFrameMagic)
+	if _, err := fw.w.Write(tail); err != nil {
+		return 0, err
+	}
+	return fw.storedSize + int64(len(tail)), nil
+}
+
+// deltaFrameIndex locates the frames of a compressed delta section.
+type deltaFrameIndex struct {
+	section     []byte  // The whole delta section (mmap'd)
+	frameSize   int64   // Uncompressed size of every frame but the last
+	logicalSize int64   // Uncompressed size of the delta
+	offsets     []int64 // Start of each frame within section, plus the table start
+	stored      []bool  // Whether each frame is stored uncompressed
+}
+
+// parseDeltaFrames parses the frame table at the end of a compressed delta
+// section and validates it against the section size.
+func parseDeltaFrames(section []byte) (*deltaFrameIndex, error) {
+	if len(section) < DeltaFrameTrailerSize {
+		return nil, fmt.Errorf("delta section too small for frame trailer (%d bytes)", len(section))
+	}
+	trailer := section[len(section)-DeltaFrameTrailerSize:]
+	if string(trailer[16:24]) != DeltaFrameMagic {
+		return nil, fmt.Errorf("invalid delta frame magic")
+	}
+	logicalSize := int64(binary.LittleEndian.Uint64(trailer[0:8]))
+	frameSize := int64(binary.LittleEndian.Uint32(trailer[8:12]))
+	frameCount := int64(binary.LittleEndian.Uint32(trailer[12:16]))
+
+	if frameSize <= 0 || logicalSize < 0 {
+		return nil, fmt.Errorf("invalid delta frame size %d or logical size %d", frameSize, logicalSize)
+	}
+	if want := (logicalSize + frameSize - 1) / frameSize; frameCount != want {
+		return nil, fmt.Errorf("delta frame count %d, want %d for %d bytes", frameCount, want, logicalSize)
+	}
+	tableStart := int64(len(section)) - DeltaFrameTrailerSize - 4*frameCount
+	if tableStart < 0 {
+		return nil, fmt.Errorf("delta frame table (%d frames) exceeds section size %d", frameCount, len(section))
+	}
+
+	ix := &deltaFrameIndex{
+		section:     section,
+		frameSize:   frameSize,
+		logicalSize: logicalSize,
+		offsets:     make([]int64, frameCount+1),
+		stored:      make([]bool, frameCount),
+	}
+	var off int64
+	for i := range ix.stored {
+		entry := binary.LittleEndian.Uint32(section[tableStart+4*int64(i):])
+		size := int64(entry &^ deltaFrameStored)
+		ix.stored[i] = entry&deltaFrameStored != 0
+		if ix.stored[i] && size != ix.frameLen(i) {
+			return nil, fmt.Errorf("stored delta frame %d has size %d, want %d", i, size, ix.frameLen(i))
+		}
+		ix.offsets[i] = off
+		off += size
+	}
+	ix.offsets[frameCount] = off
+	if off != tableStart {
+		return nil, fmt.Errorf("delta frames end at %d, but frame table starts at %d", off, tableStart)
+	}
+	return ix, nil
+}
+
+// frameCount returns the number of frames.
+func (ix *deltaFrameIndex) frameCount() int {
+	return len(ix.stored)
+}
+
+// frameLen returns the uncompressed size of frame i.
+func (ix *deltaFrameIndex) frameLen(i int) int64 {
+	start := int64(i) * ix.frameSize
+	return min(ix.frameSize, ix.logicalSize-start)
+}
+
+// decodeFrame returns the uncompressed data of frame i. Stored frames are
+// returned as a slice of the section without copying.
+func (ix *deltaFrameIndex) decodeFrame(i int) ([]byte, error) {
+	data := ix.section[ix.offsets[i]:ix.offsets[i+1]]
+	if ix.stored[i] {
+		return data, nil
+	}
+	out := make([]byte, ix.frameLen(i))
+	zr := flate.NewReader(bytes.NewReader(data))
+	defer zr.Close()
+	if _, err := io.ReadFull(zr, out); err != nil {
+		return nil, fmt.Errorf("decompress delta frame %d: %w", i, err)
+	}
+	return out, nil
+}
+
+// deltaFrameCacheSize is the number of decompressed delta frames a Reader
+// keeps. Delta entries are small and interleaved with source entries, so
+// sequential reads revisit the same frame many times.
+const deltaFrameCacheSize = 8
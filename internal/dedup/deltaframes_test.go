@@ -0,0 +1,295 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testCompressibleDelta returns delta data spanning several frames: a run of
+// repetitive container-like bytes followed by a random (incompressible)
+// frame and a short compressible tail.
+func testCompressibleDelta() []byte {
+	var buf bytes.Buffer
+	for buf.Len() < 2*DeltaFrameSize+1000 {
+		buf.WriteString("\x1f\x43\xb6\x75 cluster header, block header, cues, tags; ")
+	}
+	random := make([]byte, DeltaFrameSize)
+	rng := rand.New(rand.NewPCG(7, 0))
+	for i := range random {
+		random[i] = byte(rng.Uint32())
+	}
+	buf.Write(random)
+	buf.WriteString(strings.Repeat("tail ", 500))
+	return buf.Bytes()
+}
+
+func TestWriter_RoundTrip_CompressedDelta(t *testing.T) {
+	dir := t.TempDir()
+	delta := testCompressibleDelta()
+	size := int64(len(delta))
+
+	// Two entries so reads also cross an entry boundary; the second starts
+	// inside the first frame and reads the delta back to front.
+	half := size / 2
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize:     size,
+		originalChecksum: 0x1234,
+		sourceType:       source.TypeDVD,
+		creatorVersion:   "test-v1",
+		compressDelta:    true,
+		result: &matcher.Result{
+			Entries: []matcher.Entry{
+				{MkvOffset: 0, Length: half, Source: 0, SourceOffset: 0},
+				{MkvOffset: half, Length: size - half, Source: 0, SourceOffset: half},
+			},
+			DeltaData:      delta,
+			UnmatchedBytes: size,
+			TotalPackets:   2,
+		},
+	})
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+
+	info := r.Info()
+	if got := info["version"].(uint32); got != VersionCompressed {
+		t.Errorf("version = %d, want %d", got, VersionCompressed)
+	}
+	if !info["delta_compressed"].(bool) {
+		t.Error("delta_compressed = false, want true")
+	}
+	if got := info["delta_size"].(int64); got != size {
+		t.Errorf("delta_size = %d, want %d", got, size)
+	}
+	stored := info["delta_stored_size"].(int64)
+	if stored <= 0 || stored >= size-DeltaFrameSize {
+		t.Errorf("delta_stored_size = %d, want well below %d", stored, size)
+	}
+	if r.deltaFrames.frameCount() != 4 {
+		t.Errorf("frame count = %d, want 4", r.deltaFrames.frameCount())
+	}
+	if !r.deltaFrames.stored[2] {
+		t.Error("random frame should be stored uncompressed")
+	}
+
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		size   int
+	}{
+		{"whole file", 0, int(size)},
+		{"first bytes", 0, 100},
+		{"across frame boundary", DeltaFrameSize - 10, 20},
+		{"across entry boundary", half - 50, 100},
+		{"inside stored frame", 2*DeltaFrameSize + 123, 4096},
+		{"into stored frame", 2*DeltaFrameSize - 5, 10},
+		{"tail", size - 7, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.size)
+			n, err := r.ReadAt(buf, tt.offset)
+			if err != nil {
+				t.Fatalf("ReadAt(%d, %d): %v", tt.offset, tt.size, err)
+			}
+			if n != tt.size {
+				t.Fatalf("ReadAt(%d, %d): n=%d", tt.offset, tt.size, n)
+			}
+			if !bytes.Equal(buf, delta[tt.offset:tt.offset+int64(tt.size)]) {
+				t.Errorf("ReadAt(%d, %d): data mismatch", tt.offset, tt.size)
+			}
+		})
+	}
+}
+
+func TestWriter_RoundTrip_CompressedDeltaEmpty(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize:  500,
+		sourceType:    source.TypeDVD,
+		compressDelta: true,
+		result: &matcher.Result{
+			Entries: []matcher.Entry{
+				{MkvOffset: 0, Length: 500, Source: 1, SourceOffset: 0},
+			},
+			MatchedBytes: 500,
+		},
+	})
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+
+	info := r.Info()
+	if got := info["version"].(uint32); got != VersionCompressed {
+		t.Errorf("version = %d, want %d", got, VersionCompressed)
+	}
+	if got := info["delta_size"].(int64); got != 0 {
+		t.Errorf("delta_size = %d, want 0", got)
+	}
+	if got := info["delta_stored_size"].(int64); got != DeltaFrameTrailerSize {
+		t.Errorf("delta_stored_size = %d, want %d", got, DeltaFrameTrailerSize)
+	}
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+}
+
+func TestWriter_RoundTrip_CompressedDeltaRangeMaps(t *testing.T) {
+	dir := t.TempDir()
+
+	// Source file with two 184-byte video payloads behind 8-byte headers.
+	srcData := make([]byte, 400)
+	for i := range srcData {
+		srcData[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00001.m2ts"), srcData, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	rangeMaps := []RangeMapData{{
+		FileIndex: 0,
+		VideoRanges: []source.PESPayloadRange{
+			{FileOffset: 8, Size: 184, ESOffset: 0},
+			{FileOffset: 200, Size: 184, ESOffset: 184},
+		},
+	}}
+	var wantES []byte
+	wantES = append(wantES, srcData[8:192]...)
+	wantES = append(wantES, srcData[200:384]...)
+
+	delta := testCompressibleDelta()
+	deltaLen := int64(len(delta))
+	originalSize := deltaLen + int64(len(wantES))
+
+	path := filepath.Join(dir, "test.mkvdup")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.SetHeader(originalSize, 0x1234, source.TypeBluray)
+	w.SetCreatorVersion("test-v1")
+	w.SetDeltaCompression(true)
+	w.SetSourceFiles([]source.File{
+		{RelativePath: "00001.m2ts", Size: int64(len(srcData)), Checksum: 0x5678},
+	})
+	w.SetRangeMaps(rangeMaps)
+	if err := w.SetMatchResult(&matcher.Result{
+		Entries: []matcher.Entry{
+			{MkvOffset: 0, Length: deltaLen, Source: 0, SourceOffset: 0},
+			{MkvOffset: deltaLen, Length: int64(len(wantES)), Source: 1, SourceOffset: 0, IsVideo: true},
+		},
+		DeltaData: delta,
+	}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+
+	if got := r.Info()["version"].(uint32); got != VersionRangeMapCompressed {
+		t.Errorf("version = %d, want %d", got, VersionRangeMapCompressed)
+	}
+	if !r.HasRangeMaps() || !r.HasSourceUsedFlags() {
+		t.Error("V10 should have range maps and Used flags")
+	}
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+
+	buf := make([]byte, originalSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(buf[:deltaLen], delta) {
+		t.Error("delta region mismatch")
+	}
+	if !bytes.Equal(buf[deltaLen:], wantES) {
+		t.Error("range map region mismatch")
+	}
+}
+
+func TestParseDeltaFrames_Invalid(t *testing.T) {
+	var valid bytes.Buffer
+	fw, err := newDeltaFrameWriter(&valid)
+	if err != nil {
+		t.Fatalf("newDeltaFrameWriter: %v", err)
+	}
+	if err := fw.writeFrame(bytes.Repeat([]byte("abc"), 1000)); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+	if _, err := fw.finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if _, err := parseDeltaFrames(valid.Bytes()); err != nil {
+		t.Fatalf("parseDeltaFrames(valid): %v", err)
+	}
+
+	corrupt := func(f func(b []byte) []byte) []byte {
+		b := bytes.Clone(valid.Bytes())
+		return f(b)
+	}
+	trailer := func(b []byte) []byte { return b[len(b)-DeltaFrameTrailerSize:] }
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"too small", []byte("short"), "too small"},
+		{"bad magic", corrupt(func(b []byte) []byte {
+			copy(trailer(b)[16:], "XXXXXXXX")
+			return b
+		}), "magic"},
+		{"frame count mismatch", corrupt(func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(trailer(b)[12:], 2)
+			return b
+		}), "frame count"},
+		{"zero frame size", corrupt(func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(trailer(b)[8:], 0)
+			return b
+		}), "invalid delta frame size"},
+		{"frame sizes disagree with table", corrupt(func(b []byte) []byte {
+			return append([]byte{0}, b...)
+		}), "frame table starts"},
+		{"bad stored frame size", corrupt(func(b []byte) []byte {
+			table := b[len(b)-DeltaFrameTrailerSize-4:]
+			binary.LittleEndian.PutUint32(table, 10|deltaFrameStored)
+			return b
+		}), "stored delta frame"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDeltaFrames(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseDeltaFrames error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
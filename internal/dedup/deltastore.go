@@ -0,0 +1,454 @@
+package dedup
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Delta store chunking parameters. Chunk boundaries are content-defined, so
+// content shared by several deltas (font attachments, chapters, tags) splits
+// into the same chunks wherever it sits in each delta.
+const (
+	deltaChunkMin = 16 * 1024
+	deltaChunkMax = 256 * 1024
+	// deltaChunkMaskBits gives an average chunk size of about
+	// deltaChunkMin + 64 KB.
+	deltaChunkMaskBits = 16
+)
+
+// Delta store chunk file encodings (first byte of each chunk file)
+const (
+	deltaChunkRaw     = 0 // Chunk data as-is
+	deltaChunkDeflate = 1 // Raw DEFLATE (RFC 1951) of the chunk data
+)
+
+// DeltaStorePruneGrace is how recently a chunk file must have been written
+// or reused for PruneDeltaStore to keep it even if no dedup file references
+// it, so that a prune running alongside a create doesn't remove chunks the
+// create has stored but not yet recorded.
+const DeltaStorePruneGrace = time.Hour
+
+// deltaChunkGear is the gear table of the chunker's rolling hash. Changing
+// it moves chunk boundaries, which only costs sharing with existing chunks.
+var deltaChunkGear = func() (gear [256]uint64) {
+	// splitmix64 with a fixed seed
+	x := uint64(0x6d6b76647570) // "mkvdup"
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+	return gear
+}()
+
+// deltaChunkCut returns the length of the first chunk of data, which holds
+// at most deltaChunkMax bytes. If data is shorter than deltaChunkMax and no
+// boundary is found, the whole of data is the chunk.
+func deltaChunkCut(data []byte) int {
+	if len(data) <= deltaChunkMin {
+		return len(data)
+	}
+	const mask = uint64(1<<deltaChunkMaskBits-1) << (64 - deltaChunkMaskBits)
+	end := min(len(data), deltaChunkMax)
+	var h uint64
+	for i := deltaChunkMin; i < end; i++ {
+		h = h<<1 + deltaChunkGear[data[i]]
+		if h&mask == 0 {
+			return i + 1
+		}
+	}
+	return end
+}
+
+// chunkDelta splits the data read from r into content-defined chunks and
+// calls fn with each. The slice passed to fn is only valid during the call.
+func chunkDelta(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, deltaChunkMax)
+	n := 0
+	eof := false
+	for {
+		for !eof && n < len(buf) {
+			m, err := r.Read(buf[n:])
+			n += m
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		cut := deltaChunkCut(buf[:n])
+		if err := fn(buf[:cut]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[cut:n])
+	}
+}
+
+// DeltaChunk identifies a chunk of delta data in a delta store.
+type DeltaChunk struct {
+	Hash [sha256.Size]byte // SHA-256 of the chunk data
+	Size int64             // Length of the chunk data
+}
+
+// DeltaStoreRef is the delta of a dedup file kept in a delta store instead
+// of its own delta section. It is stored in the DSTR extension record:
+//
+//	DirLen: uint16
+//	Dir: [DirLen]byte (absolute path of the store)
+//	ChunkCount: uvarint
+//	Chunks: [ChunkCount] of
+//	    Size: uvarint
+//	    Hash: [32]byte
+//
+// The delta is the concatenation of the chunks, in order.
+type DeltaStoreRef struct {
+	Dir    string
+	Chunks []DeltaChunk
+}
+
+// Size returns the total size of the delta.
+func (ref *DeltaStoreRef) Size() int64 {
+	var n int64
+	for _, c := range ref.Chunks {
+		n += c.Size
+	}
+	return n
+}
+
+// encode returns the DSTR record data.
+func (ref *DeltaStoreRef) encode() ([]byte, error) {
+	if len(ref.Dir) > 0xFFFF {
+		return nil, fmt.Errorf("delta store path too long (%d bytes)", len(ref.Dir))
+	}
+	buf := make([]byte, 0, 2+len(ref.Dir)+binary.MaxVarintLen64+len(ref.Chunks)*(3+sha256.Size))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(ref.Dir)))
+	buf = append(buf, ref.Dir...)
+	buf = binary.AppendUvarint(buf, uint64(len(ref.Chunks)))
+	for _, c := range ref.Chunks {
+		buf = binary.AppendUvarint(buf, uint64(c.Size))
+		buf = append(buf, c.Hash[:]...)
+	}
+	return buf, nil
+}
+
+// parseDeltaStoreRef parses DSTR record data.
+func parseDeltaStoreRef(data []byte) (*DeltaStoreRef, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("delta store record too small")
+	}
+	dirLen := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < dirLen {
+		return nil, fmt.Errorf("delta store record truncated in store path")
+	}
+	ref := &DeltaStoreRef{Dir: string(data[:dirLen])}
+	data = data[dirLen:]
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data))/(1+sha256.Size) {
+		return nil, fmt.Errorf("delta store record has an invalid chunk count")
+	}
+	data = data[n:]
+	ref.Chunks = make([]DeltaChunk, count)
+	for i := range ref.Chunks {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size == 0 || size > deltaChunkMax || len(data) < n+sha256.Size {
+			return nil, fmt.Errorf("delta store record truncated or invalid at chunk %d", i)
+		}
+		ref.Chunks[i].Size = int64(size)
+		copy(ref.Chunks[i].Hash[:], data[n:n+sha256.Size])
+		data = data[n+sha256.Size:]
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("delta store record has %d trailing bytes", len(data))
+	}
+	return ref, nil
+}
+
+// DeltaStore is a directory of delta chunks shared by dedup files. Each
+// chunk is stored once, in a file named by the hex SHA-256 of its data under
+// a subdirectory named by the first two hex digits:
+//
+//	<dir>/3f/3fa8...c2
+//
+// A chunk file is one encoding byte (raw or DEFLATE) followed by the
+// encoded data.
+type DeltaStore struct {
+	dir string
+}
+
+// NewDeltaStore returns the delta store in dir. The directory is created
+// when the first chunk is stored.
+func NewDeltaStore(dir string) (*DeltaStore, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve delta store path: %w", err)
+	}
+	return &DeltaStore{dir: abs}, nil
+}
+
+// Dir returns the absolute path of the store.
+func (s *DeltaStore) Dir() string {
+	return s.dir
+}
+
+// chunkPath returns the path of the chunk file for hash.
+func (s *DeltaStore) chunkPath(hash [sha256.Size]byte) string {
+	name := hex.EncodeToString(hash[:])
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+// put stores data as a chunk unless the store already has it intact. An
+// existing chunk's modification time is refreshed so that a concurrent
+// prune keeps it (see DeltaStorePruneGrace); one that fails get's hash
+// check is written again.
+func (s *DeltaStore) put(data []byte) (DeltaChunk, error) {
+	c := DeltaChunk{Hash: sha256.Sum256(data), Size: int64(len(data))}
+	path := s.chunkPath(c.Hash)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		if _, err := s.get(c); err == nil {
+			return c, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(deltaChunkDeflate)
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return c, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return c, err
+	}
+	if err := zw.Close(); err != nil {
+		return c, err
+	}
+	encoded := buf.Bytes()
+	if len(encoded) > len(data) {
+		// DEFLATE only grows the chunk; kept as deltaChunkRaw, get skips inflating it.
+		encoded = append([]byte{deltaChunkRaw}, data...)
+	}
+
+	// Write to a temporary file and rename it into place, so that readers
+	// never see a partial chunk.
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return c, fmt.Errorf("create delta store directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return c, fmt.Errorf("create chunk file: %w", err)
+	}
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return c, fmt.Errorf("write chunk file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return c, fmt.Errorf("write chunk file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return c, fmt.Errorf("chmod chunk file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return c, fmt.Errorf("rename chunk file: %w", err)
+	}
+	return c, nil
+}
+
+// get reads chunk c and verifies its hash.
+func (s *DeltaStore) get(c DeltaChunk) ([]byte, error) {
+	name := hex.EncodeToString(c.Hash[:])
+	raw, err := os.ReadFile(s.chunkPath(c.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("read delta chunk %s: %w", name, err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("delta chunk %s is empty", name)
+	}
+	var data []byte
+	switch raw[0] {
+	case deltaChunkRaw:
+		data = raw[1:]
+	case deltaChunkDeflate:
+		data = make([]byte, c.Size)
+		zr := flate.NewReader(bytes.NewReader(raw[1:]))
+		_, err := io.ReadFull(zr, data)
+		zr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decompress delta chunk %s: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("delta chunk %s has unknown encoding %d", name, raw[0])
+	}
+	if int64(len(data)) != c.Size || sha256.Sum256(data) != c.Hash {
+		return nil, fmt.Errorf("delta chunk %s is corrupt", name)
+	}
+	return data, nil
+}
+
+// DeltaStorePruneResult summarizes a PruneDeltaStore run.
+type DeltaStorePruneResult struct {
+	Kept         int   // Chunks kept (referenced or recent)
+	Removed      int   // Unreferenced chunks removed (or that would be)
+	RemovedBytes int64 // On-disk size of the removed chunks
+}
+
+// PruneDeltaStore removes the chunk files of s that are not in keep and
+// were last written or reused before DeltaStorePruneGrace ago, along with
+// leftover temporary files. With dryRun, nothing is removed but the result
+// reports what would be.
+func (s *DeltaStore) PruneDeltaStore(keep map[[sha256.Size]byte]bool, dryRun bool) (DeltaStorePruneResult, error) {
+	var res DeltaStorePruneResult
+	cutoff := time.Now().Add(-DeltaStorePruneGrace)
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == s.dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		var hash [sha256.Size]byte
+		isTemp := strings.HasPrefix(name, ".tmp-")
+		if !isTemp {
+			if n, err := hex.Decode(hash[:], []byte(name)); err != nil || n != sha256.Size ||
+				filepath.Base(filepath.Dir(path)) != name[:2] {
+				return nil // Not a chunk file
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if (!isTemp && keep[hash]) || info.ModTime().After(cutoff) {
+			if !isTemp {
+				res.Kept++
+			}
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		if !isTemp {
+			res.Removed++
+			res.RemovedBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("prune delta store: %w", err)
+	}
+	return res, nil
+}
+
+// storeDelta splits the delta read from r into the store and returns the
+// chunk list. progress, if non-nil, is called with the number of delta bytes
+// stored so far.
+func (s *DeltaStore) storeDelta(r io.Reader, progress func(int64)) (*DeltaStoreRef, error) {
+	ref := &DeltaStoreRef{Dir: s.dir}
+	var done int64
+	err := chunkDelta(r, func(chunk []byte) error {
+		c, err := s.put(chunk)
+		if err != nil {
+			return err
+		}
+		ref.Chunks = append(ref.Chunks, c)
+		done += c.Size
+		if progress != nil {
+			progress(done)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// initDeltaStore prepares reads of a delta kept in a delta store.
+func (r *Reader) initDeltaStore() {
+	ref := r.file.DeltaStore
+	r.deltaStore = &DeltaStore{dir: ref.Dir}
+	r.deltaChunkOffsets = make([]int64, len(ref.Chunks)+1)
+	for i, c := range ref.Chunks {
+		r.deltaChunkOffsets[i+1] = r.deltaChunkOffsets[i] + c.Size
+	}
+}
+
+// DeltaStore returns the delta store record of a file whose delta is kept
+// in a delta store, or nil.
+func (r *Reader) DeltaStore() *DeltaStoreRef {
+	return r.file.DeltaStore
+}
+
+// readStoredDeltaInto reads delta data at the given offset from the delta
+// store into dest.
+func (r *Reader) readStoredDeltaInto(offset int64, dest []byte) error {
+	for len(dest) > 0 {
+		if offset < 0 || offset >= r.deltaChunkOffsets[len(r.deltaChunkOffsets)-1] {
+			return fmt.Errorf("delta offset out of range")
+		}
+		idx := sort.Search(len(r.deltaChunkOffsets)-1, func(i int) bool {
+			return r.deltaChunkOffsets[i+1] > offset
+		})
+		chunk, err := r.deltaStoreChunk(idx)
+		if err != nil {
+			return err
+		}
+		n := copy(dest, chunk[offset-r.deltaChunkOffsets[idx]:])
+		dest = dest[n:]
+		offset += int64(n)
+	}
+	return nil
+}
+
+// deltaStoreChunk returns the data of a delta store chunk, reading it from
+// the store on a cache miss.
+func (r *Reader) deltaStoreChunk(idx int) ([]byte, error) {
+	if data, ok := r.deltaCache.get(idx); ok {
+		return data, nil
+	}
+	data, err := r.deltaStore.get(r.file.DeltaStore.Chunks[idx])
+	if err != nil {
+		return nil, err
+	}
+	r.deltaCache.put(idx, data)
+	return data, nil
+}
+
+// verifyDeltaStore checks that every chunk of the delta is in the store and
+// matches its hash.
+func (r *Reader) verifyDeltaStore() error {
+	for _, c := range r.file.DeltaStore.Chunks {
+		if _, err := r.deltaStore.get(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
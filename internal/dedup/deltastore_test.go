@@ -0,0 +1,295 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testDeltaChunks returns the chunks chunkDelta splits data into.
+func testDeltaChunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	if err := chunkDelta(bytes.NewReader(data), func(c []byte) error {
+		chunks = append(chunks, bytes.Clone(c))
+		return nil
+	}); err != nil {
+		t.Fatalf("chunkDelta: %v", err)
+	}
+	return chunks
+}
+
+func TestChunkDelta_ContentDefined(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	shared := make([]byte, 2*1024*1024)
+	rng.Read(shared)
+
+	chunks := testDeltaChunks(t, shared)
+	if got := bytes.Join(chunks, nil); !bytes.Equal(got, shared) {
+		t.Fatal("chunks do not reassemble the input")
+	}
+	for i, c := range chunks {
+		if len(c) > deltaChunkMax || (len(c) < deltaChunkMin && i != len(chunks)-1) {
+			t.Errorf("chunk %d has %d bytes", i, len(c))
+		}
+	}
+
+	// The same content behind a different prefix splits into mostly the
+	// same chunks once the boundaries resynchronise.
+	prefixed := append([]byte("a different prefix of some length"), shared...)
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, c := range chunks {
+		seen[sha256.Sum256(c)] = true
+	}
+	common := 0
+	for _, c := range testDeltaChunks(t, prefixed) {
+		if seen[sha256.Sum256(c)] {
+			common++
+		}
+	}
+	if common < len(chunks)-2 {
+		t.Errorf("%d of %d chunks shared after a prefix change", common, len(chunks))
+	}
+}
+
+func TestDeltaStore_SharedAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	srcData := bytes.Repeat([]byte("source data "), 100)
+	if err := os.WriteFile(filepath.Join(dir, "a.vob"), srcData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	store, err := NewDeltaStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatalf("NewDeltaStore: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	shared := make([]byte, 600*1024)
+	rng.Read(shared)
+	paths := make([]string, 2)
+	wants := make([][]byte, 2)
+	for i := range paths {
+		// Each delta has its own header bytes followed by shared content,
+		// like two rips carrying the same font attachments.
+		delta := append([]byte(strings.Repeat("file specific ", i+1)), shared...)
+		d := int64(len(delta))
+		wants[i] = append(bytes.Clone(delta), srcData[:200]...)
+		fileDir := filepath.Join(dir, "out", string(rune('a'+i)))
+		if err := os.MkdirAll(fileDir, 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		paths[i] = writeTestDedupFile(t, fileDir, writeTestOptions{
+			originalSize:  int64(len(wants[i])),
+			sourceType:    source.TypeDVD,
+			compressDelta: true,
+			compactIndex:  true,
+			deltaStore:    store,
+			sourceFiles:   []source.File{{RelativePath: "a.vob", Size: int64(len(srcData))}},
+			result: &matcher.Result{
+				Entries: []matcher.Entry{
+					{MkvOffset: 0, Length: d, Source: 0, SourceOffset: 0},
+					{MkvOffset: d, Length: 200, Source: 1, SourceOffset: 0},
+				},
+				DeltaData: delta,
+			},
+		})
+	}
+
+	keep := make(map[[sha256.Size]byte]bool)
+	var total int
+	for i, path := range paths {
+		r, err := NewReader(path, dir)
+		if err != nil {
+			t.Fatalf("NewReader: %v", err)
+		}
+		defer r.Close()
+		if err := r.LoadSourceFiles(); err != nil {
+			t.Fatalf("LoadSourceFiles: %v", err)
+		}
+		ref := r.DeltaStore()
+		if ref == nil || ref.Dir != store.Dir() {
+			t.Fatalf("DeltaStore() = %+v, want store %s", ref, store.Dir())
+		}
+		if got := r.Info()["version"].(uint32); got != VersionExtensions {
+			t.Errorf("version = %d, want %d", got, VersionExtensions)
+		}
+		if r.DeltaSize() != int64(len(wants[i])-200) {
+			t.Errorf("DeltaSize() = %d, want %d", r.DeltaSize(), len(wants[i])-200)
+		}
+		if err := r.VerifyIntegrity(); err != nil {
+			t.Fatalf("VerifyIntegrity: %v", err)
+		}
+		buf := make([]byte, len(wants[i]))
+		if n, err := r.ReadAt(buf, 0); err != nil || n != len(buf) {
+			t.Fatalf("ReadAt: n=%d, err=%v", n, err)
+		}
+		if !bytes.Equal(buf, wants[i]) {
+			t.Errorf("file %d: reconstructed data mismatch", i)
+		}
+		for _, c := range ref.Chunks {
+			keep[c.Hash] = true
+		}
+		total += len(ref.Chunks)
+	}
+	if len(keep) >= total-1 {
+		t.Errorf("%d distinct chunks of %d referenced, want the shared content stored once", len(keep), total)
+	}
+
+	// A missing chunk fails verification and reads.
+	r, err := NewReader(paths[0], dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := os.Remove(store.chunkPath(r.DeltaStore().Chunks[0].Hash)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := r.VerifyIntegrity(); err == nil {
+		t.Error("VerifyIntegrity succeeded with a missing chunk")
+	}
+	if _, err := r.ReadAt(make([]byte, 10), 0); err == nil {
+		t.Error("ReadAt succeeded with a missing chunk")
+	}
+}
+
+func TestDeltaStore_PutRepairsCorruptChunk(t *testing.T) {
+	store, err := NewDeltaStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDeltaStore: %v", err)
+	}
+	data := bytes.Repeat([]byte("delta chunk data "), 1000)
+	c, err := store.put(data)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// Truncate the stored chunk, as a failing disk might
+	path := store.chunkPath(c.Hash)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if err := os.WriteFile(path, raw[:len(raw)/2], 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := store.get(c); err == nil {
+		t.Fatal("get succeeded with a truncated chunk")
+	}
+
+	if _, err := store.put(data); err != nil {
+		t.Fatalf("put again: %v", err)
+	}
+	got, err := store.get(c)
+	if err != nil {
+		t.Fatalf("get after put again: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("repaired chunk data mismatch")
+	}
+}
+
+func TestDeltaStore_Prune(t *testing.T) {
+	store, err := NewDeltaStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDeltaStore: %v", err)
+	}
+	put := func(data string) DeltaChunk {
+		c, err := store.put([]byte(data))
+		if err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		return c
+	}
+	old := time.Now().Add(-2 * DeltaStorePruneGrace)
+	kept := put("referenced")
+	stale := put("unreferenced")
+	recent := put("unreferenced but recent")
+	for _, c := range []DeltaChunk{kept, stale} {
+		if err := os.Chtimes(store.chunkPath(c.Hash), old, old); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+	tmp := filepath.Join(store.Dir(), "00", ".tmp-123")
+	if err := os.MkdirAll(filepath.Dir(tmp), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(tmp, []byte("partial"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chtimes(tmp, old, old); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	keep := map[[sha256.Size]byte]bool{kept.Hash: true}
+
+	res, err := store.PruneDeltaStore(keep, true)
+	if err != nil {
+		t.Fatalf("PruneDeltaStore(dry run): %v", err)
+	}
+	if res.Kept != 2 || res.Removed != 1 {
+		t.Errorf("dry run = %+v, want 2 kept and 1 removed", res)
+	}
+	if _, err := store.get(stale); err != nil {
+		t.Errorf("dry run removed a chunk: %v", err)
+	}
+
+	if _, err := store.PruneDeltaStore(keep, false); err != nil {
+		t.Fatalf("PruneDeltaStore: %v", err)
+	}
+	for _, c := range []DeltaChunk{kept, recent} {
+		if _, err := store.get(c); err != nil {
+			t.Errorf("kept chunk: %v", err)
+		}
+	}
+	if _, err := store.get(stale); err == nil {
+		t.Error("unreferenced chunk was not removed")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file was not removed: %v", err)
+	}
+
+	// Storing an existing chunk again refreshes it against pruning.
+	if err := os.Chtimes(store.chunkPath(kept.Hash), old, old); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	put("referenced")
+	if res, err := store.PruneDeltaStore(nil, false); err != nil || res.Removed != 0 {
+		t.Errorf("PruneDeltaStore after reuse = %+v, %v; want nothing removed", res, err)
+	}
+
+	// A store that does not exist yet has nothing to prune.
+	empty, _ := NewDeltaStore(filepath.Join(t.TempDir(), "missing"))
+	if res, err := empty.PruneDeltaStore(nil, false); err != nil || res != (DeltaStorePruneResult{}) {
+		t.Errorf("PruneDeltaStore(missing) = %+v, %v", res, err)
+	}
+}
+
+func TestParseDeltaStoreRef(t *testing.T) {
+	ref := &DeltaStoreRef{Dir: "/store", Chunks: []DeltaChunk{
+		{Hash: sha256.Sum256([]byte("a")), Size: 1},
+		{Hash: sha256.Sum256([]byte("bb")), Size: 70000},
+	}}
+	data, err := ref.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, err := parseDeltaStoreRef(data)
+	if err != nil {
+		t.Fatalf("parseDeltaStoreRef: %v", err)
+	}
+	if got.Dir != ref.Dir || len(got.Chunks) != 2 || got.Chunks[1] != ref.Chunks[1] || got.Size() != 70001 {
+		t.Errorf("parsed %+v, want %+v", got, ref)
+	}
+	for _, bad := range [][]byte{nil, data[:4], data[:len(data)-1], append(bytes.Clone(data), 0)} {
+		if _, err := parseDeltaStoreRef(bad); err == nil {
+			t.Errorf("parseDeltaStoreRef(%d bytes) succeeded", len(bad))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// An extension area (V13/V14) sits between the source files and the index:
+//
+//	Size: uint32 (bytes of records that follow)
+//	Records, each:
+//	    Tag: [4]byte
+//	    Length: uint32
+//	    Data: [Length]byte
+//
+// Readers skip records with tags they do not know, so adding a record type
+// does not need a new format version.
+
+// extensionRecord is one tagged record of the extension area.
+type extensionRecord struct {
+	tag  string
+	data []byte
+}
+
+// encodeExtensions encodes records as an extension area.
+func encodeExtensions(records []extensionRecord) ([]byte, error) {
+	size := 0
+	for _, rec := range records {
+		if len(rec.tag) != 4 {
+			return nil, fmt.Errorf("invalid extension tag %q", rec.tag)
+		}
+		size += ExtensionRecordHeaderSize + len(rec.data)
+	}
+	if size > MaxExtensionAreaSize {
+		return nil, fmt.Errorf("extension area size %d exceeds maximum (%d)", size, MaxExtensionAreaSize)
+	}
+
+	buf := make([]byte, ExtensionAreaHeaderSize, ExtensionAreaHeaderSize+size)
+	binary.LittleEndian.PutUint32(buf, uint32(size))
+	for _, rec := range records {
+		buf = append(buf, rec.tag...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(rec.data)))
+		buf = append(buf, rec.data...)
+	}
+	return buf, nil
+}
+
+// readExtensions reads an extension area and returns its records and its
+// total on-disk size.
+func readExtensions(r io.Reader) ([]extensionRecord, int64, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, 0, fmt.Errorf("read extension area size: %w", err)
+	}
+	if size > MaxExtensionAreaSize {
+		return nil, 0, fmt.Errorf("extension area size %d exceeds maximum (%d)", size, MaxExtensionAreaSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, fmt.Errorf("read extension area: %w", err)
+	}
+
+	var records []extensionRecord
+	for len(data) > 0 {
+		if len(data) < ExtensionRecordHeaderSize {
+			return nil, 0, fmt.Errorf("truncated extension record header")
+		}
+		tag := string(data[0:4])
+		n := binary.LittleEndian.Uint32(data[4:8])
+		data = data[ExtensionRecordHeaderSize:]
+		if uint64(n) > uint64(len(data)) {
+			return nil, 0, fmt.Errorf("extension record %q length %d exceeds area", tag, n)
+		}
+		records = append(records, extensionRecord{tag: tag, data: data[:n]})
+		data = data[n:]
+	}
+	return records, ExtensionAreaHeaderSize + int64(size), nil
+}
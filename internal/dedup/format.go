@@ -3,6 +3,7 @@ package dedup
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/stuckj/mkvdup/internal/matcher"
 	"github.com/stuckj/mkvdup/internal/source"
@@ -23,11 +24,33 @@ const (
 	VersionUsed uint32 = 7
 	// VersionRangeMapUsed is V8: V6 with a per-source-file Used byte after the checksum.
 	VersionRangeMapUsed uint32 = 8
+	// VersionCompressed is V9: V7 with the delta section stored as independently
+	// compressed frames (see DeltaFrameSize).
+	VersionCompressed uint32 = 9
+	// VersionRangeMapCompressed is V10: V8 with a compressed delta section.
+	VersionRangeMapCompressed uint32 = 10
+	// VersionCompactIndex is V11: V9 with variable-length index entries
+	// encoded in blocks (see CompactIndexBlockEntries).
+	VersionCompactIndex uint32 = 11
+	// VersionRangeMapCompactIndex is V12: V10 with a compact index.
+	VersionRangeMapCompactIndex uint32 = 12
+	// VersionExtensions is V13: V11 with an extension record area after the
+	// source files (see ExtensionAreaHeaderSize).
+	VersionExtensions uint32 = 13
+	// VersionRangeMapExtensions is V14: V12 with an extension record area.
+	VersionRangeMapExtensions uint32 = 14
+	// VersionFill is V15: V13 whose index may hold fill entries (see
+	// Entry.IsFill), which older readers would read as delta.
+	VersionFill uint32 = 15
+	// VersionRangeMapFill is V16: V14 whose index may hold fill entries.
+	VersionRangeMapFill uint32 = 16
+	// MaxVersion is the newest version this package reads.
+	MaxVersion = VersionRangeMapFill
 	// HeaderSize = Magic(8) + Version(4) + Flags(4) + OriginalSize(8) + OriginalChecksum(8) +
 	//              SourceType(1) + UsesESOffsets(1) + SourceFileCount(2) + EntryCount(8) +
 	//              DeltaOffset(8) + DeltaSize(8) = 60 bytes
 	HeaderSize           = 60
-	EntrySize            = 28 // Fixed entry size: 8+8+2+8+1+1 = 28 bytes
+	EntrySize            = 28 // Fixed entry size (V3-V10): 8+8+2+8+1+1 = 28 bytes
 	FooterSize           = 24
 	FooterV4Size         = 32 // V4 footer adds RangeMapChecksum (8 bytes)
 	MagicSize            = 8
@@ -35,10 +58,65 @@ const (
 	MaxCreatorVersionLen = 4096 // Max bytes for creator version string (writer truncates, reader rejects)
 )
 
+// Compact index constants (V11/V12)
+const (
+	// CompactIndexBlockEntries is the number of entries per compact index
+	// block. Each block is decoded as a unit, so this bounds the work of a
+	// random entry lookup.
+	CompactIndexBlockEntries = 128
+	// CompactIndexHeaderSize = EntriesPerBlock(4) + BlockCount(4)
+	CompactIndexHeaderSize = 8
+	// CompactIndexSeekEntrySize = FirstMkvOffset(8) + DataOffset(8)
+	CompactIndexSeekEntrySize = 16
+)
+
+// Extension record constants (V13/V14)
+const (
+	// ExtensionAreaHeaderSize = Size(4)
+	ExtensionAreaHeaderSize = 4
+	// ExtensionRecordHeaderSize = Tag(4) + Length(4)
+	ExtensionRecordHeaderSize = 8
+	// MaxExtensionAreaSize bounds the extension area a reader accepts.
+	MaxExtensionAreaSize = 64 * 1024 * 1024
+	// ExtensionTagChecksums tags the extended (cryptographic) checksum record.
+	ExtensionTagChecksums = "CSUM"
+	// ExtensionTagChunkChecksums tags the per-chunk source checksum record.
+	ExtensionTagChunkChecksums = "CHNK"
+	// ExtensionTagDeltaStore tags the record of a delta kept in a delta store.
+	ExtensionTagDeltaStore = "DSTR"
+	// ExtensionTagMetadata tags the record describing the original MKV.
+	ExtensionTagMetadata = "META"
+)
+
+// Compact entry flag bits. Bits 0-2 are the ESFlags of the fixed-size entry.
+const (
+	compactFlagSourceChanged    = 1 << 3 // Source differs from the previous entry's
+	compactFlagSubStreamChanged = 1 << 4 // AudioSubStreamID differs from the previous entry's
+	compactFlagFill             = 1 << 5 // IsFill (ESFlags bit 3; here bit 3 is compactFlagSourceChanged)
+)
+
+// Compressed delta constants (V9+)
+const (
+	// DeltaFrameMagic ends the frame table of a compressed delta section.
+	DeltaFrameMagic = "DLTFRAME"
+	// DeltaFrameSize is the uncompressed size of each delta frame (the last
+	// frame may be shorter). Frames are compressed independently so a read
+	// only decompresses the frames it touches.
+	DeltaFrameSize = 256 * 1024
+	// DeltaFrameTrailerSize = LogicalSize(8) + FrameSize(4) + FrameCount(4) + Magic(8)
+	DeltaFrameTrailerSize = 24
+	// deltaFrameStored marks a frame table entry whose frame is stored
+	// uncompressed because compression did not make it smaller.
+	deltaFrameStored uint32 = 1 << 31
+)
+
 // Source types
 const (
 	SourceTypeDVD    uint8 = 0
 	SourceTypeBluray uint8 = 1
+	SourceTypeMPEGTS uint8 = 2
+	SourceTypeMP4    uint8 = 3
+	SourceTypeMKV    uint8 = 4
 )
 
 // Header represents the fixed header at the start of a .mkvdup file.
@@ -48,7 +126,7 @@ type Header struct {
 	Flags            uint32  // Reserved for future use
 	OriginalSize     int64   // Size of original MKV file
 	OriginalChecksum uint64  // xxhash of original MKV file
-	SourceType       uint8   // 0=DVD, 1=Blu-ray
+	SourceType       uint8   // 0=DVD, 1=Blu-ray, 2=MPEG-TS, 3=MP4, 4=MKV
 	UsesESOffsets    uint8   // 1 if source uses ES offsets (MPEG-PS)
 	SourceFileCount  uint16  // Number of source files
 	EntryCount       uint64  // Number of index entries
@@ -61,7 +139,7 @@ type SourceFile struct {
 	RelativePath string // Path relative to source directory
 	Size         int64  // File size
 	Checksum     uint64 // xxhash of file
-	Used         bool   // Whether this source file is referenced by any entry (V7/V8 only)
+	Used         bool   // Whether this source file is referenced by any entry (V7+ only)
 }
 
 // Entry represents an index entry in the dedup file.
@@ -73,7 +151,38 @@ type Entry struct {
 	SourceOffset     int64  // Offset in source file (or ES offset)
 	IsVideo          bool   // For ES-based sources
 	AudioSubStreamID byte   // For ES-based audio sub-streams
-	IsLPCM           bool   // True if 16-bit LPCM audio requiring byte-swap on read
+	IsLPCM           bool   // True if LPCM audio requiring byte-swap on read
+	IsLPCM24         bool   // With IsLPCM: 24-bit samples (3-byte swap) rather than 16-bit
+	IsFill           bool   // Source 0: SourceOffset holds a pattern of AudioSubStreamID bytes repeated on read
+}
+
+// lpcmSampleSize returns the size of the byte-swapped samples of an LPCM entry.
+func (e *Entry) lpcmSampleSize() int {
+	if e.IsLPCM24 {
+		return 3
+	}
+	return 2
+}
+
+// fill writes the bytes of a fill entry starting offsetInEntry bytes into
+// it to dest.
+func (e *Entry) fill(offsetInEntry int64, dest []byte) error {
+	n := int64(e.AudioSubStreamID)
+	if e.Source != 0 || n < 1 || n > matcher.MaxFillPattern {
+		return fmt.Errorf("invalid fill entry at MKV offset %d (source %d, pattern length %d)", e.MkvOffset, e.Source, n)
+	}
+	if len(dest) == 0 {
+		return nil
+	}
+	m := e.ToMatcherEntry()
+	pattern := m.FillPattern()
+	phase := offsetInEntry % n
+	k := copy(dest, pattern[phase:])
+	k += copy(dest[k:], pattern[:phase])
+	for k < len(dest) {
+		k += copy(dest[k:], dest[:k])
+	}
+	return nil
 }
 
 // RawEntry matches the 28-byte on-disk entry format exactly.
@@ -91,8 +200,10 @@ type RawEntry struct {
 // ESFlags bit layout:
 //
 //	bit 0: IsVideo
-//	bit 1: IsLPCM (16-bit LPCM requiring byte-swap on read)
-//	bits 2-7: reserved
+//	bit 1: IsLPCM (LPCM requiring byte-swap on read)
+//	bit 2: IsLPCM24 (the LPCM samples are 24-bit rather than 16-bit)
+//	bit 3: IsFill (V15/V16 only; synthesized fill, see Entry.IsFill)
+//	bits 4-7: reserved
 
 // ToEntry converts a RawEntry to an Entry by parsing the byte arrays.
 func (r *RawEntry) ToEntry() Entry {
@@ -104,6 +215,8 @@ func (r *RawEntry) ToEntry() Entry {
 		IsVideo:          r.ESFlags&1 == 1,
 		AudioSubStreamID: r.AudioSubStreamID,
 		IsLPCM:           r.ESFlags&2 != 0,
+		IsLPCM24:         r.ESFlags&4 != 0,
+		IsFill:           r.ESFlags&8 != 0,
 	}
 	return e
 }
@@ -124,18 +237,47 @@ type File struct {
 	SourceFiles    []SourceFile
 	DeltaOffset    int64 // Offset to delta section in file
 	UsesESOffsets  bool
-	CreatorVersion string // Version of mkvdup that created this file (V5+ only)
-	headerSize     int64  // Effective header size (60 for V3/V4, 60+2+len for V5-V8)
+	CreatorVersion string             // Version of mkvdup that created this file (V5+ only)
+	Checksums      *ExtendedChecksums // Cryptographic checksums (V13+ only, nil if absent)
+	ChunkChecksums *ChunkChecksums    // Source chunk checksums (V13+ only, nil if absent)
+	DeltaStore     *DeltaStoreRef     // Delta kept in a delta store (V13+ only, nil if absent)
+	Metadata       *Metadata          // Description of the original MKV (V13+ only, nil if absent)
+	headerSize     int64              // Effective header size (60 for V3/V4, 60+2+len for V5+)
+	extensionsSize int64              // Size of the extension area (V13+ only)
 }
 
-// creatorVersionSize returns the on-disk size of the creator version field.
-func creatorVersionSize(v string) int64 {
-	if v == "" {
+// creatorVersionSize returns the on-disk size of the creator version field
+// for a file of the given version.
+func creatorVersionSize(version uint32, v string) int64 {
+	if version < VersionCreator {
 		return 0
 	}
 	return 2 + int64(len(v))
 }
 
+// hasRangeMapSection reports whether files of the given version carry a
+// range map section (V4/V6/V8/V10/V12/V14).
+func hasRangeMapSection(version uint32) bool {
+	switch version {
+	case VersionRangeMap, VersionRangeMapCreator, VersionRangeMapUsed, VersionRangeMapCompressed,
+		VersionRangeMapCompactIndex, VersionRangeMapExtensions, VersionRangeMapFill:
+		return true
+	}
+	return false
+}
+
+// hasUsedFlags reports whether the source file records of the given version
+// carry a Used byte (V7+).
+func hasUsedFlags(version uint32) bool {
+	return version >= VersionUsed
+}
+
+// hasCompressedDelta reports whether the delta section of the given version
+// is stored as compressed frames (V9+).
+func hasCompressedDelta(version uint32) bool {
+	return version >= VersionCompressed
+}
+
 // ToMatcherEntry converts a dedup Entry to a matcher Entry.
 func (e *Entry) ToMatcherEntry() matcher.Entry {
 	return matcher.Entry{
@@ -146,6 +288,8 @@ func (e *Entry) ToMatcherEntry() matcher.Entry {
 		IsVideo:          e.IsVideo,
 		AudioSubStreamID: e.AudioSubStreamID,
 		IsLPCM:           e.IsLPCM,
+		IsLPCM24:         e.IsLPCM24,
+		IsFill:           e.IsFill,
 	}
 }
 
@@ -159,6 +303,8 @@ func FromMatcherEntry(e matcher.Entry) Entry {
 		IsVideo:          e.IsVideo,
 		AudioSubStreamID: e.AudioSubStreamID,
 		IsLPCM:           e.IsLPCM,
+		IsLPCM24:         e.IsLPCM24,
+		IsFill:           e.IsFill,
 	}
 }
 
@@ -170,3 +316,15 @@ func ToSourceFile(sf source.File) SourceFile {
 		Checksum:     sf.Checksum,
 	}
 }
+
+// hasCompactIndex reports whether the index of the given version uses
+// variable-length entries (V11/V12).
+func hasCompactIndex(version uint32) bool {
+	return version >= VersionCompactIndex
+}
+
+// hasExtensions reports whether files of the given version carry an
+// extension record area after the source files (V13+).
+func hasExtensions(version uint32) bool {
+	return version >= VersionExtensions
+}
@@ -336,3 +336,92 @@ func TestLPCM_RoundTrip_MultiPES(t *testing.T) {
 		}
 	})
 }
+
+// TestLPCM_RoundTrip_24Bit verifies reconstruction of 24-bit Blu-ray LPCM,
+// whose 3-byte samples are aligned to the ES start and may straddle PES
+// payloads.
+func TestLPCM_RoundTrip_24Bit(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two PES payloads of 31 and 29 bytes (a sample straddles the boundary),
+	// each behind an 8-byte header filled with 0xFF.
+	es := make([]byte, 60)
+	for i := range es {
+		es[i] = byte(i + 1)
+	}
+	sourceFileData := append(append(append(bytes.Repeat([]byte{0xFF}, 8), es[:31]...),
+		bytes.Repeat([]byte{0xFF}, 8)...), es[31:]...)
+	if err := os.WriteFile(filepath.Join(dir, "00001.m2ts"), sourceFileData, 0644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	rangeMaps := []RangeMapData{{
+		FileIndex: 0,
+		AudioStreams: []AudioRangeData{{
+			SubStreamID: 1,
+			Ranges: []source.PESPayloadRange{
+				{FileOffset: 8, Size: 31, ESOffset: 0},
+				{FileOffset: 47, Size: 29, ESOffset: 31},
+			},
+		}},
+	}}
+
+	expected := append([]byte(nil), es...)
+	source.TransformLPCM24BE(expected)
+
+	// 5 delta bytes, then 45 bytes (15 samples) from ES offset 6
+	deltaData := bytes.Repeat([]byte{0xEE}, 5)
+	const lpcmLen = 45
+	dedupPath := filepath.Join(dir, "test.mkvdup")
+	w, err := NewWriter(dedupPath)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.SetHeader(int64(len(deltaData)+lpcmLen), 0x1234, source.TypeBluray)
+	w.SetSourceFiles([]source.File{
+		{RelativePath: "00001.m2ts", Size: int64(len(sourceFileData)), Checksum: 0x5678},
+	})
+	w.SetRangeMaps(rangeMaps)
+	if err := w.SetMatchResult(&matcher.Result{
+		Entries: []matcher.Entry{
+			{MkvOffset: 0, Length: 5, Source: 0, SourceOffset: 0},
+			{MkvOffset: 5, Length: lpcmLen, Source: 1, SourceOffset: 6,
+				AudioSubStreamID: 1, IsLPCM: true, IsLPCM24: true},
+		},
+		DeltaData:      deltaData,
+		MatchedBytes:   lpcmLen,
+		UnmatchedBytes: 5,
+		TotalPackets:   2,
+	}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+
+	reader, err := NewReader(dedupPath, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+	if err := reader.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	if e, ok := reader.GetEntry(1); !ok || !e.IsLPCM || !e.IsLPCM24 {
+		t.Fatalf("entry 1 = %+v, want IsLPCM and IsLPCM24", e)
+	}
+
+	want := append(append([]byte(nil), deltaData...), expected[6:6+lpcmLen]...)
+	for offset := 0; offset < len(want); offset++ {
+		for size := 1; offset+size <= len(want); size++ {
+			buf := make([]byte, size)
+			n, err := reader.ReadAt(buf, int64(offset))
+			if err != nil || n != size {
+				t.Fatalf("ReadAt(%d, %d) = (%d, %v)", offset, size, n, err)
+			}
+			if !bytes.Equal(buf, want[offset:offset+size]) {
+				t.Fatalf("ReadAt(%d, %d) = %x, want %x", offset, size, buf, want[offset:offset+size])
+			}
+		}
+	}
+}
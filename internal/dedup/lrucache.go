@@ -0,0 +1,50 @@
+package dedup
+
+import "sync"
+
+// lruCache is a small fixed-capacity LRU cache keyed by int, used for
+// decoded delta frames and index blocks. A linear scan is cheaper than a
+// map at the handful of items it holds. Safe for concurrent use.
+type lruCache[V any] struct {
+	mu       sync.Mutex
+	capacity int
+	items    []lruItem[V] // Most recently used first
+}
+
+type lruItem[V any] struct {
+	key   int
+	value V
+}
+
+func newLRUCache[V any](capacity int) *lruCache[V] {
+	return &lruCache[V]{capacity: capacity}
+}
+
+func (c *lruCache[V]) get(key int) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, it := range c.items {
+		if it.key == key {
+			copy(c.items[1:i+1], c.items[:i])
+			c.items[0] = it
+			return it.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *lruCache[V]) put(key int, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, it := range c.items {
+		if it.key == key {
+			return // Decoded concurrently by another reader
+		}
+	}
+	if len(c.items) < c.capacity {
+		c.items = append(c.items, lruItem[V]{})
+	}
+	copy(c.items[1:], c.items[:len(c.items)-1])
+	c.items[0] = lruItem[V]{key: key, value: value}
+}
@@ -0,0 +1,34 @@
+package dedup
+
+import "testing"
+
+func TestLRUCache_Eviction(t *testing.T) {
+	const capacity = 4
+	c := newLRUCache[[]byte](capacity)
+	for i := 0; i < capacity; i++ {
+		c.put(i, []byte{byte(i)})
+	}
+	// Touch item 0 so item 1 becomes the least recently used.
+	if data, ok := c.get(0); !ok || data[0] != 0 {
+		t.Fatalf("get(0) = %v, %v", data, ok)
+	}
+	c.put(capacity, []byte{0xFF})
+
+	if _, ok := c.get(1); ok {
+		t.Error("item 1 should have been evicted")
+	}
+	for _, key := range []int{0, 2, capacity} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("item %d should be cached", key)
+		}
+	}
+	if len(c.items) != capacity {
+		t.Errorf("cache holds %d items, want %d", len(c.items), capacity)
+	}
+
+	// Re-adding a cached key keeps the existing value.
+	c.put(0, []byte{0xEE})
+	if data, _ := c.get(0); data[0] != 0 {
+		t.Errorf("get(0) = %v, want original value", data)
+	}
+}
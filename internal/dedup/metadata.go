@@ -0,0 +1,248 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// Metadata describes the contents of the original MKV, so that a dedup file
+// can be inspected without mounting it or having its sources online. It is
+// stored in the META extension record:
+//
+//	Title: string
+//	Duration: uvarint (nanoseconds, 0 if unknown)
+//	ChapterCount: uvarint
+//	TrackCount: uvarint
+//	Tracks, each:
+//	    Number: uvarint
+//	    Type: string ("video", "audio", "subtitle", ...)
+//	    CodecID: string
+//	    Language: string
+//	    Name: string
+//	    Flags: uint8 (bit 0 = default, bit 1 = forced)
+//	    PixelWidth: uvarint
+//	    PixelHeight: uvarint
+//	    Channels: uvarint
+//	    SampleRate: uvarint (Hz)
+//
+// Each string is a uvarint byte length followed by UTF-8 bytes.
+type Metadata struct {
+	Title    string          `json:"title,omitempty"`
+	Duration time.Duration   `json:"duration_ns,omitempty"`
+	Chapters int             `json:"chapters"`
+	Tracks   []TrackMetadata `json:"tracks"`
+}
+
+// TrackMetadata describes one track of the original MKV. Picture size is
+// only set for video tracks, and channels and sample rate for audio tracks.
+type TrackMetadata struct {
+	Number      uint64 `json:"number"`
+	Type        string `json:"type"`
+	CodecID     string `json:"codec_id"`
+	Language    string `json:"language,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Default     bool   `json:"default"`
+	Forced      bool   `json:"forced"`
+	PixelWidth  uint64 `json:"pixel_width,omitempty"`
+	PixelHeight uint64 `json:"pixel_height,omitempty"`
+	Channels    uint64 `json:"channels,omitempty"`
+	SampleRate  uint64 `json:"sample_rate,omitempty"`
+}
+
+// Metadata track flags.
+const (
+	metadataFlagDefault = 1 << 0
+	metadataFlagForced  = 1 << 1
+)
+
+// NewMetadata returns the metadata of an MKV from its parser. Chapters are
+// only counted if the parser ran Parse.
+func NewMetadata(p *mkv.Parser) *Metadata {
+	m := &Metadata{
+		Title:    p.Title(),
+		Duration: p.Duration(),
+		Chapters: p.ChapterCount(),
+		Tracks:   make([]TrackMetadata, 0, len(p.Tracks())),
+	}
+	for _, t := range p.Tracks() {
+		tm := TrackMetadata{
+			Number:   t.Number,
+			Type:     trackTypeName(t.Type),
+			CodecID:  t.CodecID,
+			Language: t.Language,
+			Name:     t.Name,
+			Default:  t.Default,
+			Forced:   t.Forced,
+		}
+		switch t.Type {
+		case mkv.TrackTypeVideo:
+			tm.PixelWidth, tm.PixelHeight = t.PixelWidth, t.PixelHeight
+		case mkv.TrackTypeAudio:
+			tm.Channels = t.Channels
+			tm.SampleRate = uint64(math.Round(max(t.SamplingFreq, 0)))
+		}
+		m.Tracks = append(m.Tracks, tm)
+	}
+	return m
+}
+
+// trackTypeName returns the name of a Matroska track type.
+func trackTypeName(trackType int) string {
+	switch trackType {
+	case mkv.TrackTypeVideo:
+		return "video"
+	case mkv.TrackTypeAudio:
+		return "audio"
+	case mkv.TrackTypeComplex:
+		return "complex"
+	case mkv.TrackTypeLogo:
+		return "logo"
+	case mkv.TrackTypeSubtitle:
+		return "subtitle"
+	case mkv.TrackTypeButtons:
+		return "buttons"
+	case mkv.TrackTypeControl:
+		return "control"
+	}
+	return fmt.Sprintf("type %d", trackType)
+}
+
+// encode returns the META record data.
+func (m *Metadata) encode() []byte {
+	var buf []byte
+	appendString := func(s string) {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	appendString(m.Title)
+	buf = binary.AppendUvarint(buf, uint64(max(m.Duration, 0)))
+	buf = binary.AppendUvarint(buf, uint64(max(m.Chapters, 0)))
+	buf = binary.AppendUvarint(buf, uint64(len(m.Tracks)))
+	for _, t := range m.Tracks {
+		buf = binary.AppendUvarint(buf, t.Number)
+		appendString(t.Type)
+		appendString(t.CodecID)
+		appendString(t.Language)
+		appendString(t.Name)
+		var flags uint8
+		if t.Default {
+			flags |= metadataFlagDefault
+		}
+		if t.Forced {
+			flags |= metadataFlagForced
+		}
+		buf = append(buf, flags)
+		buf = binary.AppendUvarint(buf, t.PixelWidth)
+		buf = binary.AppendUvarint(buf, t.PixelHeight)
+		buf = binary.AppendUvarint(buf, t.Channels)
+		buf = binary.AppendUvarint(buf, t.SampleRate)
+	}
+	return buf
+}
+
+// metadataDecoder reads the fields of a META record, remembering the first
+// error.
+type metadataDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *metadataDecoder) readUvarint(field string) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = fmt.Errorf("metadata record truncated or invalid in %s", field)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *metadataDecoder) readString(field string) string {
+	n := d.readUvarint(field)
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.data)) {
+		d.err = fmt.Errorf("metadata record truncated in %s", field)
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *metadataDecoder) readByte(field string) uint8 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) == 0 {
+		d.err = fmt.Errorf("metadata record truncated in %s", field)
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+// minTrackMetadataSize is the smallest encoding of a track: one byte for
+// each uvarint, string length and the flags.
+const minTrackMetadataSize = 10
+
+// parseMetadata parses META record data.
+func parseMetadata(data []byte) (*Metadata, error) {
+	d := &metadataDecoder{data: data}
+	m := &Metadata{Title: d.readString("title")}
+	duration := d.readUvarint("duration")
+	if duration > math.MaxInt64 {
+		return nil, fmt.Errorf("metadata record has an invalid duration")
+	}
+	m.Duration = time.Duration(duration)
+	chapters := d.readUvarint("chapter count")
+	if chapters > math.MaxInt32 {
+		return nil, fmt.Errorf("metadata record has an invalid chapter count")
+	}
+	m.Chapters = int(chapters)
+	count := d.readUvarint("track count")
+	if d.err != nil {
+		return nil, d.err
+	}
+	if count > uint64(len(d.data))/minTrackMetadataSize {
+		return nil, fmt.Errorf("metadata record has an invalid track count")
+	}
+	m.Tracks = make([]TrackMetadata, count)
+	for i := range m.Tracks {
+		t := &m.Tracks[i]
+		t.Number = d.readUvarint("track number")
+		t.Type = d.readString("track type")
+		t.CodecID = d.readString("codec ID")
+		t.Language = d.readString("language")
+		t.Name = d.readString("track name")
+		flags := d.readByte("track flags")
+		t.Default = flags&metadataFlagDefault != 0
+		t.Forced = flags&metadataFlagForced != 0
+		t.PixelWidth = d.readUvarint("pixel width")
+		t.PixelHeight = d.readUvarint("pixel height")
+		t.Channels = d.readUvarint("channels")
+		t.SampleRate = d.readUvarint("sample rate")
+		if d.err != nil {
+			return nil, fmt.Errorf("track %d: %w", i, d.err)
+		}
+	}
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("metadata record has %d trailing bytes", len(d.data))
+	}
+	return m, nil
+}
+
+// Metadata returns the description of the original MKV, or nil if the file
+// has none (before V13, or created without it).
+func (r *Reader) Metadata() *Metadata {
+	return r.file.Metadata
+}
@@ -0,0 +1,107 @@
+package dedup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testMetadata returns metadata for a two-track MKV.
+func testMetadata() *Metadata {
+	return &Metadata{
+		Title:    "Feature Presentation",
+		Duration: 5421 * time.Second,
+		Chapters: 28,
+		Tracks: []TrackMetadata{
+			{Number: 1, Type: "video", CodecID: "V_MPEG2", Language: "und", Default: true, PixelWidth: 720, PixelHeight: 480},
+			{Number: 2, Type: "audio", CodecID: "A_AC3", Language: "fr-CA", Name: "Commentary", Forced: true, Channels: 6, SampleRate: 48000},
+		},
+	}
+}
+
+func TestWriter_RoundTrip_Metadata(t *testing.T) {
+	dir := t.TempDir()
+	src := bytes.Repeat([]byte("source "), 50)
+	if err := os.WriteFile(filepath.Join(dir, "a.vob"), src, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	want := testMetadata()
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize:  100,
+		sourceType:    source.TypeDVD,
+		compressDelta: true,
+		compactIndex:  true,
+		metadata:      want,
+		sourceFiles:   []source.File{{RelativePath: "a.vob", Size: int64(len(src))}},
+		result: &matcher.Result{
+			Entries: []matcher.Entry{{MkvOffset: 0, Length: 100, Source: 1, SourceOffset: 0}},
+		},
+	})
+
+	r, err := NewReaderLazy(path, dir)
+	if err != nil {
+		t.Fatalf("NewReaderLazy: %v", err)
+	}
+	defer r.Close()
+	if r.Version() != VersionExtensions {
+		t.Errorf("version = %d, want %d", r.Version(), VersionExtensions)
+	}
+	if got := r.Metadata(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Metadata() = %+v, want %+v", got, want)
+	}
+	if got := readAllDedup(t, path, dir); !bytes.Equal(got, src[:100]) {
+		t.Error("file with metadata reconstructs different data")
+	}
+
+	// Files written without metadata have none.
+	plain := writeTestDedupFile(t, t.TempDir(), writeTestOptions{originalSize: 0, sourceType: source.TypeDVD})
+	p, err := NewReaderLazy(plain, dir)
+	if err != nil {
+		t.Fatalf("NewReaderLazy: %v", err)
+	}
+	defer p.Close()
+	if p.Metadata() != nil {
+		t.Errorf("Metadata() = %+v, want nil", p.Metadata())
+	}
+}
+
+func TestParseMetadata_Invalid(t *testing.T) {
+	valid := testMetadata().encode()
+	// The fields before the track count, which encodes as 0 here.
+	prefix := (&Metadata{Title: "Feature Presentation", Duration: 5421 * time.Second, Chapters: 28}).encode()
+	prefix = prefix[:len(prefix)-1]
+	if _, err := parseMetadata(valid); err != nil {
+		t.Fatalf("parseMetadata(valid): %v", err)
+	}
+	empty, err := parseMetadata((&Metadata{}).encode())
+	if err != nil || empty.Title != "" || len(empty.Tracks) != 0 {
+		t.Errorf("parseMetadata(empty) = %+v, %v", empty, err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"empty", nil, "title"},
+		{"truncated title", valid[:5], "title"},
+		{"huge track count", append(prefix, 0xFF, 0x01), "track count"},
+		{"truncated track", valid[:len(valid)-1], "track 1"},
+		{"trailing bytes", append(append([]byte(nil), valid...), 0), "trailing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMetadata(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -483,6 +483,35 @@ func (sm *StreamRangeMap) seekTo(esOffset int64) (rangeMapCursor, error) {
 	return cur, nil
 }
 
+// rawRanges calls fn with the raw file range [start, end) of each piece of
+// the ES region [esOffset, esOffset+size), in ES order.
+func (sm *StreamRangeMap) rawRanges(esOffset, size int64, fn func(start, end int64)) error {
+	if sm.entryCount == 0 {
+		return fmt.Errorf("empty range map")
+	}
+	cur, err := sm.seekTo(esOffset)
+	if err != nil {
+		return err
+	}
+	for size > 0 {
+		offsetInEntry := esOffset - cur.esOff
+		if offsetInEntry < 0 {
+			return fmt.Errorf("ES offset gap at ES %d", cur.esOff)
+		}
+		n := min(int64(cur.size)-offsetInEntry, size)
+		start := cur.fileOff + offsetInEntry
+		fn(start, start+n)
+		esOffset += n
+		size -= n
+		if size > 0 {
+			if err := sm.advanceCursor(&cur); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // ReadData reads ES data at the given offset, copying into a new buffer.
 // Uses the coarse index for fast binary search, RLE arithmetic for fast seeking.
 func (sm *StreamRangeMap) ReadData(sourceData []byte, sourceSize int64, esOffset int64, size int) ([]byte, error) {
@@ -729,6 +758,15 @@ type SourceRangeMaps struct {
 	AudioMaps map[byte]*StreamRangeMap // keyed by sub-stream ID
 }
 
+// rangeMapsByIndex keys parsed range maps by source file index.
+func rangeMapsByIndex(sources []SourceRangeMaps) map[int]*SourceRangeMaps {
+	m := make(map[int]*SourceRangeMaps, len(sources))
+	for i := range sources {
+		m[int(sources[i].FileIndex)] = &sources[i]
+	}
+	return m
+}
+
 // readRangeMapSection parses the range map section from mmap'd data.
 // The data slice should point to the start of the range map section.
 // Compressed data is zero-copy sliced from the input.
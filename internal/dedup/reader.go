@@ -7,6 +7,7 @@ import (
 	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
@@ -35,8 +36,13 @@ type Reader struct {
 
 	// Direct mmap access to entries (no []Entry allocation)
 	indexStart int64 // Byte offset where entries begin in file
+	indexSize  int64 // Size of the index section in bytes
 	entryCount int   // Number of entries
 
+	// V11/V12 compact index: seek table and recently decoded blocks
+	compactIdx *compactIndex
+	blockCache *lruCache[[]Entry]
+
 	// Block index for fast entry lookup on cache miss.
 	// Maps block_number (MKV offset / blockSize) → entry index for O(1)
 	// narrowing, followed by bounded binary search within the block range.
@@ -52,6 +58,28 @@ type Reader struct {
 
 	// V4 range map data (maps ES offsets to raw file offsets)
 	rangeMapsByFile map[int]*SourceRangeMaps // file index -> range maps
+
+	// V9+ compressed delta: frame table and recently decompressed frames
+	deltaFrames *deltaFrameIndex
+	deltaCache  *lruCache[[]byte]
+
+	// Delta kept in a delta store: the store and the delta offset at which
+	// each chunk starts. Chunks share deltaCache, which such files don't
+	// use for frames as their delta section is empty.
+	deltaStore        *DeltaStore
+	deltaChunkOffsets []int64
+
+	// Continuous views over DVD VOB sets, keyed by the file index of the
+	// set's first part. Built when source files are loaded.
+	vobSets map[int]mmap.SourceFile
+
+	// Number of .mkvdup files above this one when it is opened as the
+	// chained source of another dedup file (see openChainedSource).
+	chainDepth int
+
+	// MKV ranges stored in source chunks marked corrupt (see SetBadChunks).
+	// Sorted and non-overlapping; nil when no chunks are marked.
+	badRanges atomic.Pointer[[]mkvRange]
 }
 
 // ESReader interface for reading ES data from MPEG-PS sources.
@@ -97,13 +125,19 @@ func NewReaderLazy(dedupPath, sourceDir string) (*Reader, error) {
 		return nil, fmt.Errorf("mmap dedup file: %w", err)
 	}
 
-	return &Reader{
+	r := &Reader{
 		file:         file,
 		dedupMmap:    dedupMmap,
 		dedupPath:    dedupPath,
 		sourceDir:    sourceDir,
 		lastEntryIdx: -1, // No entry cached yet
-	}, nil
+		deltaCache:   newLRUCache[[]byte](deltaFrameCacheSize),
+		blockCache:   newLRUCache[[]Entry](compactBlockCacheSize),
+	}
+	if file.DeltaStore != nil {
+		r.initDeltaStore()
+	}
+	return r, nil
 }
 
 // SetESReader sets the ES reader for ES-based sources.
@@ -111,7 +145,8 @@ func (r *Reader) SetESReader(esReader ESReader) {
 	r.esReader = esReader
 }
 
-// LoadSourceFiles memory-maps all source files.
+// LoadSourceFiles memory-maps all source files. Chained .mkvdup sources of an
+// MKV-sourced dedup file are opened as nested Readers instead.
 func (r *Reader) LoadSourceFiles() error {
 	r.sourceFiles = make([]mmap.SourceFile, len(r.file.SourceFiles))
 	for i, sf := range r.file.SourceFiles {
@@ -124,6 +159,19 @@ func (r *Reader) LoadSourceFiles() error {
 			}
 			return fmt.Errorf("source file %s: %w", sf.RelativePath, err)
 		}
+		if r.isChainedSource(sf.RelativePath) {
+			cf, err := r.openChainedSource(path, (*Reader).LoadSourceFiles)
+			if err != nil {
+				for j := 0; j < i; j++ {
+					if r.sourceFiles[j] != nil {
+						r.sourceFiles[j].Close()
+					}
+				}
+				return fmt.Errorf("chained source file %s: %w", sf.RelativePath, err)
+			}
+			r.sourceFiles[i] = cf
+			continue
+		}
 		m, err := mmap.Open(path)
 		if err != nil {
 			// Clean up already opened files
@@ -139,6 +187,7 @@ func (r *Reader) LoadSourceFiles() error {
 		m.Advise(unix.MADV_SEQUENTIAL)
 		r.sourceFiles[i] = m
 	}
+	r.initVOBSets()
 	return nil
 }
 
@@ -156,6 +205,21 @@ func (r *Reader) LoadSourceFilesPread(timeout time.Duration) error {
 			}
 			return fmt.Errorf("source file %s: %w", sf.RelativePath, err)
 		}
+		if r.isChainedSource(sf.RelativePath) {
+			cf, err := r.openChainedSource(path, func(nested *Reader) error {
+				return nested.LoadSourceFilesPread(timeout)
+			})
+			if err != nil {
+				for j := 0; j < i; j++ {
+					if r.sourceFiles[j] != nil {
+						r.sourceFiles[j].Close()
+					}
+				}
+				return fmt.Errorf("chained source file %s: %w", sf.RelativePath, err)
+			}
+			r.sourceFiles[i] = cf
+			continue
+		}
 		pf, err := mmap.OpenPread(path, timeout)
 		if err != nil {
 			// Clean up already opened files
@@ -168,9 +232,38 @@ func (r *Reader) LoadSourceFilesPread(timeout time.Duration) error {
 		}
 		r.sourceFiles[i] = pf
 	}
+	r.initVOBSets()
 	return nil
 }
 
+// initVOBSets builds continuous views over multi-part DVD VOB sets so entries
+// referencing a set's first part can read across part boundaries.
+func (r *Reader) initVOBSets() {
+	r.vobSets = nil
+	for _, set := range vobSetsFor(r.file.Header.SourceType, r.file.SourceFiles) {
+		if len(set) < 2 {
+			continue
+		}
+		parts := make([]mmap.SourceFile, len(set))
+		for i, fi := range set {
+			parts[i] = r.sourceFiles[fi]
+		}
+		if r.vobSets == nil {
+			r.vobSets = make(map[int]mmap.SourceFile)
+		}
+		r.vobSets[set[0]] = newVOBSetFile(parts)
+	}
+}
+
+// sourceFile returns the source data for a file index: the continuous VOB
+// set view when the file starts a multi-part VOB set, otherwise the file itself.
+func (r *Reader) sourceFile(fileIndex int) mmap.SourceFile {
+	if sf, ok := r.vobSets[fileIndex]; ok {
+		return sf
+	}
+	return r.sourceFiles[fileIndex]
+}
+
 // Close releases all resources.
 func (r *Reader) Close() error {
 	if r.dedupMmap != nil {
@@ -189,27 +282,44 @@ func (r *Reader) Close() error {
 func (r *Reader) initEntryAccess() error {
 	r.entriesOnce.Do(func() {
 		// Calculate index start offset
-		r.indexStart = r.file.headerSize + r.calculateSourceFilesSize()
+		r.indexStart = r.file.headerSize + r.calculateSourceFilesSize() + r.file.extensionsSize
 		r.entryCount = int(r.file.Header.EntryCount)
 
-		// Validate mmap has enough data for all entries
-		requiredSize := r.indexStart + int64(r.entryCount)*EntrySize
-		if int64(r.dedupMmap.Size()) < requiredSize {
-			r.entriesErr = fmt.Errorf("mmap too small: need %d, have %d",
-				requiredSize, r.dedupMmap.Size())
-			return
+		if hasCompactIndex(r.file.Header.Version) {
+			// V11/V12: the index runs up to the delta section
+			if err := r.initCompactIndex(); err != nil {
+				r.entriesErr = fmt.Errorf("init compact index: %w", err)
+				return
+			}
+		} else {
+			// Validate mmap has enough data for all entries
+			r.indexSize = int64(r.entryCount) * EntrySize
+			requiredSize := r.indexStart + r.indexSize
+			if int64(r.dedupMmap.Size()) < requiredSize {
+				r.entriesErr = fmt.Errorf("mmap too small: need %d, have %d",
+					requiredSize, r.dedupMmap.Size())
+				return
+			}
 		}
 
 		// Build block index for fast random access lookup
 		r.buildBlockIndex()
 
-		// V4/V6/V8: parse range map section
+		// V4/V6/V8/V10/V12/V14: parse range map section
 		if r.hasRangeMaps() {
 			if err := r.initRangeMaps(); err != nil {
 				r.entriesErr = fmt.Errorf("init range maps: %w", err)
 				return
 			}
 		}
+
+		// V9+: parse the delta frame table
+		if hasCompressedDelta(r.file.Header.Version) {
+			if err := r.initDeltaFrames(); err != nil {
+				r.entriesErr = fmt.Errorf("init delta frames: %w", err)
+				return
+			}
+		}
 	})
 	return r.entriesErr
 }
@@ -235,24 +345,50 @@ func (r *Reader) initRangeMaps() error {
 		return fmt.Errorf("parse range map section: %w", err)
 	}
 
-	r.rangeMapsByFile = make(map[int]*SourceRangeMaps, len(sources))
-	for i := range sources {
-		r.rangeMapsByFile[int(sources[i].FileIndex)] = &sources[i]
+	r.rangeMapsByFile = rangeMapsByIndex(sources)
+
+	return nil
+}
+
+// initCompactIndex parses the seek table of a compact index.
+func (r *Reader) initCompactIndex() error {
+	r.indexSize = r.file.DeltaOffset - r.indexStart
+	if r.indexSize < 0 {
+		return fmt.Errorf("delta offset %d precedes index start %d", r.file.DeltaOffset, r.indexStart)
+	}
+	section := r.dedupMmap.Slice(r.indexStart, int(r.indexSize))
+	if section == nil {
+		return fmt.Errorf("mmap too small: need %d, have %d",
+			r.indexStart+r.indexSize, r.dedupMmap.Size())
 	}
+	ci, err := parseCompactIndex(section, r.entryCount)
+	if err != nil {
+		return err
+	}
+	r.compactIdx = ci
+	return nil
+}
 
+// initDeltaFrames parses the frame table of a compressed delta section.
+func (r *Reader) initDeltaFrames() error {
+	section := r.dedupMmap.Slice(r.file.DeltaOffset, int(r.file.Header.DeltaSize))
+	if section == nil {
+		return fmt.Errorf("delta section slice out of bounds")
+	}
+	frames, err := parseDeltaFrames(section)
+	if err != nil {
+		return err
+	}
+	r.deltaFrames = frames
 	return nil
 }
 
-// hasRangeMaps returns true if this dedup file uses range maps (V4/V6/V8).
+// hasRangeMaps returns true if this dedup file uses range maps (V4/V6/V8/V10/V12/V14).
 func (r *Reader) hasRangeMaps() bool {
-	switch r.file.Header.Version {
-	case VersionRangeMap, VersionRangeMapCreator, VersionRangeMapUsed:
-		return true
-	}
-	return false
+	return hasRangeMapSection(r.file.Header.Version)
 }
 
-// HasRangeMaps returns true if this dedup file uses V4/V6/V8 range maps.
+// HasRangeMaps returns true if this dedup file uses V4/V6/V8/V10/V12/V14 range maps.
 // This checks the header version (available immediately after NewReaderLazy)
 // rather than the lazily-loaded range map data, so it's safe to call
 // before the first ReadAt.
@@ -262,11 +398,37 @@ func (r *Reader) HasRangeMaps() bool {
 
 // HasSourceUsedFlags returns true if the dedup file has per-source-file Used flags (V7+).
 func (r *Reader) HasSourceUsedFlags() bool {
-	switch r.file.Header.Version {
-	case VersionUsed, VersionRangeMapUsed:
-		return true
+	return hasUsedFlags(r.file.Header.Version)
+}
+
+// HasCompressedDelta returns true if the delta section is stored as
+// compressed frames (V9+).
+func (r *Reader) HasCompressedDelta() bool {
+	return hasCompressedDelta(r.file.Header.Version)
+}
+
+// ExtendedChecksums returns the cryptographic checksums of the original MKV
+// and source files, or nil if the file has none (before V13, or created
+// without them).
+func (r *Reader) ExtendedChecksums() *ExtendedChecksums {
+	return r.file.Checksums
+}
+
+// DeltaSize returns the logical (uncompressed) size of the delta.
+func (r *Reader) DeltaSize() int64 {
+	if r.file.DeltaStore != nil {
+		return r.file.DeltaStore.Size()
+	}
+	if r.deltaFrames != nil {
+		return r.deltaFrames.logicalSize
 	}
-	return false
+	return r.file.Header.DeltaSize
+}
+
+// StoredDeltaSize returns the on-disk size of the delta section. For
+// compressed deltas this includes the frame table.
+func (r *Reader) StoredDeltaSize() int64 {
+	return r.file.Header.DeltaSize
 }
 
 // buildBlockIndex creates a mapping from block numbers to entry indices.
@@ -318,13 +480,38 @@ func (r *Reader) getEntry(idx int) (Entry, bool) {
 	}
 	r.cacheMu.Unlock()
 
-	// Parse entry from mmap using RawEntry (no lock needed - mmap is read-only)
+	entry, ok := r.entryAt(idx)
+	if !ok {
+		return Entry{}, false
+	}
+
+	// Update cache (with lock)
+	r.cacheMu.Lock()
+	r.lastEntryIdx = idx
+	r.lastEntry = entry
+	r.lastEntryValid = true
+	r.cacheMu.Unlock()
+
+	return entry, true
+}
+
+// entryAt parses the entry at idx, bypassing the last-entry cache.
+func (r *Reader) entryAt(idx int) (Entry, bool) {
+	if r.compactIdx != nil {
+		return r.compactEntryAt(idx)
+	}
+
+	// Parse entry from mmap (no lock needed - mmap is read-only)
 	offset := r.indexStart + int64(idx)*EntrySize
 	data := r.dedupMmap.Slice(offset, EntrySize)
 	if len(data) < EntrySize {
 		return Entry{}, false
 	}
+	return decodeFixedEntry(data), true
+}
 
+// decodeFixedEntry decodes a fixed-size (V3-V10) index entry.
+func decodeFixedEntry(data []byte) Entry {
 	// Parse using RawEntry for portable unaligned access
 	// Layout: MkvOffset(8) + Length(8) + Source(2) + SourceOffset(8) + ESFlags(1) + AudioSubStreamID(1) = 28
 	var raw RawEntry
@@ -334,17 +521,24 @@ func (r *Reader) getEntry(idx int) (Entry, bool) {
 	copy(raw.SourceOffset[:], data[18:26])
 	raw.ESFlags = data[26]
 	raw.AudioSubStreamID = data[27]
+	return raw.ToEntry()
+}
 
-	entry := raw.ToEntry()
-
-	// Update cache (with lock)
-	r.cacheMu.Lock()
-	r.lastEntryIdx = idx
-	r.lastEntry = entry
-	r.lastEntryValid = true
-	r.cacheMu.Unlock()
-
-	return entry, true
+// compactEntryAt returns entry idx of a compact index, decoding its block
+// on a cache miss. Sequential access stays within a cached block.
+func (r *Reader) compactEntryAt(idx int) (Entry, bool) {
+	perBlock := r.compactIdx.entriesPerBlock
+	b := idx / perBlock
+	block, ok := r.blockCache.get(b)
+	if !ok {
+		var err error
+		block, err = r.compactIdx.decodeBlock(b)
+		if err != nil {
+			return Entry{}, false
+		}
+		r.blockCache.put(b, block)
+	}
+	return block[idx-b*perBlock], true
 }
 
 // getMkvOffset returns just the MkvOffset for entry at idx (for binary search).
@@ -353,6 +547,10 @@ func (r *Reader) getMkvOffset(idx int) (int64, bool) {
 	if idx < 0 || idx >= r.entryCount {
 		return 0, false
 	}
+	if r.compactIdx != nil {
+		e, ok := r.compactEntryAt(idx)
+		return e.MkvOffset, ok
+	}
 
 	offset := r.indexStart + int64(idx)*EntrySize
 	data := r.dedupMmap.Slice(offset, 8) // Only read MkvOffset field (first 8 bytes)
@@ -369,6 +567,10 @@ func (r *Reader) getEntryLength(idx int) (int64, bool) {
 	if idx < 0 || idx >= r.entryCount {
 		return 0, false
 	}
+	if r.compactIdx != nil {
+		e, ok := r.compactEntryAt(idx)
+		return e.Length, ok
+	}
 
 	// Length is at offset 8 within each entry (after MkvOffset)
 	offset := r.indexStart + int64(idx)*EntrySize + 8
@@ -445,6 +647,10 @@ func (r *Reader) ReadAt(buf []byte, offset int64) (int, error) {
 
 	endOffset := offset + int64(remaining)
 
+	if bad := r.badRanges.Load(); bad != nil && overlapsAny(*bad, offset, endOffset) {
+		return 0, fmt.Errorf("read at offset %d: %w", offset, ErrBadSourceChunk)
+	}
+
 	// Find starting entry index (zero-allocation inline lookup)
 	startIdx := r.findStartEntry(offset)
 
@@ -471,46 +677,10 @@ func (r *Reader) ReadAt(buf []byte, offset int64) (int, error) {
 			continue
 		}
 
-		// Calculate offset within entry
-		offsetInEntry := readStart - entry.MkvOffset
-		sourceOffset := entry.SourceOffset + offsetInEntry
-
 		// Calculate buffer position
 		bufOffset := int(readStart - originalOffset)
-
-		// Check if this is an LPCM entry needing byte-swap.
-		// For LPCM entries, the source data is raw big-endian PCM; we must
-		// byte-swap 16-bit pairs aligned to the entry start. Both the start
-		// offset and read length may be misaligned to pair boundaries when
-		// the caller's buffer doesn't align with entry boundaries.
-		needsLPCMSwap := entry.Source != 0 && entry.IsLPCM && !(r.file.UsesESOffsets && r.esReader != nil)
-
-		if needsLPCMSwap {
-			// Compute pair-aligned read range within the entry.
-			alignedOff := offsetInEntry
-			trimFront := 0
-			if alignedOff%2 == 1 {
-				alignedOff--
-				trimFront = 1
-			}
-			alignedLen := readLen + trimFront
-			entryRemaining := int(entry.Length - alignedOff)
-			if alignedLen%2 == 1 && alignedLen < entryRemaining {
-				alignedLen++
-			}
-
-			alignedSrcOff := entry.SourceOffset + alignedOff
-			tmp := make([]byte, alignedLen)
-			if err := r.lpcmAlignedRead(entry, alignedSrcOff, tmp); err != nil {
-				return totalRead, fmt.Errorf("read at offset %d: %w", readStart, err)
-			}
-			source.TransformLPCM16BE(tmp)
-			copy(buf[bufOffset:bufOffset+readLen], tmp[trimFront:trimFront+readLen])
-		} else {
-			// Normal read path (non-LPCM)
-			if err := r.readEntry(entry, sourceOffset, readLen, buf[bufOffset:bufOffset+readLen]); err != nil {
-				return totalRead, fmt.Errorf("read at offset %d: %w", readStart, err)
-			}
+		if err := r.readEntryAt(entry, readStart-entry.MkvOffset, buf[bufOffset:bufOffset+readLen]); err != nil {
+			return totalRead, fmt.Errorf("read at offset %d: %w", readStart, err)
 		}
 
 		totalRead += readLen
@@ -525,6 +695,46 @@ func (r *Reader) ReadAt(buf []byte, offset int64) (int, error) {
 	return totalRead, nil
 }
 
+// readEntryAt reconstructs len(dest) bytes of entry starting offsetInEntry
+// bytes into it.
+func (r *Reader) readEntryAt(entry Entry, offsetInEntry int64, dest []byte) error {
+	if entry.IsFill {
+		return entry.fill(offsetInEntry, dest)
+	}
+	readLen := len(dest)
+	sourceOffset := entry.SourceOffset + offsetInEntry
+
+	// Check if this is an LPCM entry needing byte-swap.
+	// For LPCM entries, the source data is raw big-endian PCM; we must
+	// byte-swap whole samples, which are aligned to the ES start. Both
+	// the start offset and read length may fall inside a sample when
+	// the caller's buffer doesn't align with sample boundaries.
+	needsLPCMSwap := entry.Source != 0 && entry.IsLPCM && !(r.file.UsesESOffsets && r.esReader != nil)
+	if !needsLPCMSwap {
+		// Normal read path (non-LPCM)
+		return r.readEntry(entry, sourceOffset, readLen, dest)
+	}
+
+	sampleSize := entry.lpcmSampleSize()
+	// Compute the sample-aligned read range within the entry.
+	trimFront := int(sourceOffset % int64(sampleSize))
+	alignedOff := offsetInEntry - int64(trimFront)
+	alignedLen := readLen + trimFront
+	entryRemaining := int(entry.Length - alignedOff)
+	if rem := alignedLen % sampleSize; rem != 0 && alignedLen+sampleSize-rem <= entryRemaining {
+		alignedLen += sampleSize - rem
+	}
+
+	alignedSrcOff := entry.SourceOffset + alignedOff
+	tmp := make([]byte, alignedLen)
+	if err := r.lpcmAlignedRead(entry, alignedSrcOff, tmp); err != nil {
+		return err
+	}
+	source.TransformLPCM(tmp, sampleSize)
+	copy(dest, tmp[trimFront:trimFront+readLen])
+	return nil
+}
+
 // findStartEntry returns the index of the first entry whose range covers offset.
 // Uses the entry cache for O(1) sequential access, block index for O(1) narrowing,
 // then bounded binary search. Zero allocations.
@@ -658,13 +868,8 @@ func (r *Reader) findEntriesForRange(offset, length int64) []Entry {
 // Handles delta, V4 range map, V1 ES reader, and V3 raw source paths.
 func (r *Reader) readEntry(entry Entry, sourceOffset int64, readLen int, dest []byte) error {
 	if entry.Source == 0 {
-		// Read from delta section (zero-copy mmap slice)
-		data, err := r.readDelta(sourceOffset, readLen)
-		if err != nil {
-			return err
-		}
-		copy(dest, data)
-		return nil
+		// Read from delta section
+		return r.readDeltaInto(sourceOffset, dest)
 	} else if r.rangeMapsByFile != nil {
 		// V4: Read via range map directly into output buffer (no allocation)
 		fileIndex := int(entry.Source - 1)
@@ -690,8 +895,8 @@ func (r *Reader) readEntry(entry Entry, sourceOffset int64, readLen int, dest []
 }
 
 // lpcmAlignedRead reads source data for an LPCM entry at the given (already
-// pair-aligned) source offset. This is used for the odd-offset case where we
-// need to read from one byte before the actual requested offset.
+// sample-aligned) source offset, which may be up to a sample before the
+// requested offset.
 func (r *Reader) lpcmAlignedRead(entry Entry, alignedSrcOff int64, dest []byte) error {
 	if r.rangeMapsByFile != nil {
 		fileIndex := int(entry.Source - 1)
@@ -702,13 +907,53 @@ func (r *Reader) lpcmAlignedRead(entry Entry, alignedSrcOff int64, dest []byte)
 	return r.readSourceInto(fileIndex, alignedSrcOff, dest)
 }
 
-func (r *Reader) readDelta(offset int64, size int) ([]byte, error) {
-	fileOffset := r.file.DeltaOffset + offset
-	// Zero-copy slice from mmap'd data
-	data := r.dedupMmap.Slice(fileOffset, size)
-	if data == nil {
-		return nil, fmt.Errorf("delta offset out of range")
+// readDeltaInto reads delta data at the given logical offset into dest.
+// Compressed deltas decompress only the frames the read touches.
+func (r *Reader) readDeltaInto(offset int64, dest []byte) error {
+	if r.deltaStore != nil {
+		return r.readStoredDeltaInto(offset, dest)
+	}
+	if r.deltaFrames == nil {
+		// Zero-copy slice from mmap'd data
+		data := r.dedupMmap.Slice(r.file.DeltaOffset+offset, len(dest))
+		if data == nil {
+			return fmt.Errorf("delta offset out of range")
+		}
+		copy(dest, data)
+		return nil
+	}
+
+	frameSize := r.deltaFrames.frameSize
+	for len(dest) > 0 {
+		if offset < 0 || offset >= r.deltaFrames.logicalSize {
+			return fmt.Errorf("delta offset out of range")
+		}
+		idx := int(offset / frameSize)
+		frame, err := r.deltaFrame(idx)
+		if err != nil {
+			return err
+		}
+		n := copy(dest, frame[offset-int64(idx)*frameSize:])
+		dest = dest[n:]
+		offset += int64(n)
+	}
+	return nil
+}
+
+// deltaFrame returns the uncompressed data of a delta frame, decompressing
+// it on a cache miss. Stored frames are sliced directly from the mmap.
+func (r *Reader) deltaFrame(idx int) ([]byte, error) {
+	if r.deltaFrames.stored[idx] {
+		return r.deltaFrames.decodeFrame(idx)
+	}
+	if data, ok := r.deltaCache.get(idx); ok {
+		return data, nil
 	}
+	data, err := r.deltaFrames.decodeFrame(idx)
+	if err != nil {
+		return nil, err
+	}
+	r.deltaCache.put(idx, data)
 	return data, nil
 }
 
@@ -723,7 +968,7 @@ func (r *Reader) readViaRangeMapInto(fileIndex int, entry Entry, sourceOffset in
 		return fmt.Errorf("source file %d not loaded for range map read", fileIndex)
 	}
 
-	sf := r.sourceFiles[fileIndex]
+	sf := r.sourceFile(fileIndex)
 
 	if entry.IsVideo {
 		if src.VideoMap == nil {
@@ -750,7 +995,7 @@ func (r *Reader) readSourceInto(fileIndex int, offset int64, dest []byte) error
 		return fmt.Errorf("source file %d not loaded", fileIndex)
 	}
 
-	n, err := r.sourceFiles[fileIndex].ReadAt(dest, offset)
+	n, err := r.sourceFile(fileIndex).ReadAt(dest, offset)
 	if n == len(dest) {
 		if err == io.EOF {
 			return nil
@@ -783,17 +1028,19 @@ func parseHeaderOnly(r io.Reader) (*File, error) {
 	if err := binary.Read(r, binary.LittleEndian, &file.Header.Version); err != nil {
 		return nil, fmt.Errorf("read version: %w", err)
 	}
-	// Support versions 3-8. Older versions must be recreated.
+	// Support versions 3 through MaxVersion. Older versions must be recreated.
 	switch file.Header.Version {
 	case Version, VersionRangeMap, VersionCreator, VersionRangeMapCreator,
-		VersionUsed, VersionRangeMapUsed:
+		VersionUsed, VersionRangeMapUsed, VersionCompressed, VersionRangeMapCompressed,
+		VersionCompactIndex, VersionRangeMapCompactIndex, VersionExtensions, VersionRangeMapExtensions,
+		VersionFill, VersionRangeMapFill:
 		// OK
 	case 1:
 		return nil, fmt.Errorf("unsupported version 1 (uses ES offsets); please recreate with 'mkvdup create'")
 	case 2:
 		return nil, fmt.Errorf("unsupported version 2 (uses uint8 source index); please recreate with 'mkvdup create'")
 	default:
-		return nil, fmt.Errorf("unsupported version: %d (expected 3-8)", file.Header.Version)
+		return nil, fmt.Errorf("unsupported version: %d (expected 3-%d)", file.Header.Version, MaxVersion)
 	}
 
 	// Read flags
@@ -843,7 +1090,7 @@ func parseHeaderOnly(r io.Reader) (*File, error) {
 		return nil, fmt.Errorf("read delta size: %w", err)
 	}
 
-	// Read creator version string (V5/V6 only)
+	// Read creator version string (V5+)
 	file.headerSize = int64(HeaderSize)
 	if file.Header.Version >= VersionCreator {
 		var versionLen uint16
@@ -885,8 +1132,8 @@ func parseHeaderOnly(r io.Reader) (*File, error) {
 			return nil, fmt.Errorf("read file checksum: %w", err)
 		}
 
-		// V7/V8: read used flag
-		if file.Header.Version == VersionUsed || file.Header.Version == VersionRangeMapUsed {
+		// V7+: read used flag
+		if hasUsedFlags(file.Header.Version) {
 			var used uint8
 			if err := binary.Read(r, binary.LittleEndian, &used); err != nil {
 				return nil, fmt.Errorf("read file used flag: %w", err)
@@ -895,6 +1142,39 @@ func parseHeaderOnly(r io.Reader) (*File, error) {
 		}
 	}
 
+	// V13+: read extension records, skipping unknown tags
+	if hasExtensions(file.Header.Version) {
+		records, size, err := readExtensions(r)
+		if err != nil {
+			return nil, err
+		}
+		file.extensionsSize = size
+		for _, rec := range records {
+			switch rec.tag {
+			case ExtensionTagChecksums:
+				file.Checksums, err = parseExtendedChecksums(rec.data, len(file.SourceFiles))
+				if err != nil {
+					return nil, fmt.Errorf("parse checksum record: %w", err)
+				}
+			case ExtensionTagChunkChecksums:
+				file.ChunkChecksums, err = parseChunkChecksums(rec.data, len(file.SourceFiles))
+				if err != nil {
+					return nil, fmt.Errorf("parse chunk checksum record: %w", err)
+				}
+			case ExtensionTagDeltaStore:
+				file.DeltaStore, err = parseDeltaStoreRef(rec.data)
+				if err != nil {
+					return nil, fmt.Errorf("parse delta store record: %w", err)
+				}
+			case ExtensionTagMetadata:
+				file.Metadata, err = parseMetadata(rec.data)
+				if err != nil {
+					return nil, fmt.Errorf("parse metadata record: %w", err)
+				}
+			}
+		}
+	}
+
 	// Entries are accessed directly from mmap via Reader.getEntry()
 	return file, nil
 }
@@ -906,37 +1186,13 @@ func (r *Reader) VerifyIntegrity() error {
 		return fmt.Errorf("init entry access: %w", err)
 	}
 
-	footerSz := int64(FooterSize)
-	if r.hasRangeMaps() {
-		footerSz = int64(FooterV4Size)
-	}
-
-	fileSize := r.dedupMmap.Size()
-
-	// Read footer from mmap
-	footerOffset := fileSize - footerSz
-	footerData := r.dedupMmap.Slice(footerOffset, int(footerSz))
-	if footerData == nil {
-		return fmt.Errorf("footer slice out of range")
-	}
-
-	var footer Footer
-	off := 0
-	footer.IndexChecksum = binary.LittleEndian.Uint64(footerData[off : off+8])
-	off += 8
-	footer.DeltaChecksum = binary.LittleEndian.Uint64(footerData[off : off+8])
-	off += 8
-	if r.hasRangeMaps() {
-		footer.RangeMapChecksum = binary.LittleEndian.Uint64(footerData[off : off+8])
-		off += 8
-	}
-	if string(footerData[off:off+MagicSize]) != Magic {
-		return fmt.Errorf("invalid footer magic")
+	footer, footerOffset, err := r.readFooter()
+	if err != nil {
+		return err
 	}
 
 	// Calculate and verify index checksum (zero-copy)
-	indexSize := int(int64(r.entryCount) * EntrySize)
-	indexData := r.dedupMmap.Slice(r.indexStart, indexSize)
+	indexData := r.dedupMmap.Slice(r.indexStart, int(r.indexSize))
 	if indexData == nil {
 		return fmt.Errorf("read index for checksum: slice out of range")
 	}
@@ -944,6 +1200,15 @@ func (r *Reader) VerifyIntegrity() error {
 		return fmt.Errorf("index checksum mismatch")
 	}
 
+	// V11/V12: every block must decode to its full entry count
+	if r.compactIdx != nil {
+		for b := 0; b < r.compactIdx.blockCount(); b++ {
+			if _, err := r.compactIdx.decodeBlock(b); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Calculate and verify delta checksum (zero-copy)
 	deltaData := r.dedupMmap.Slice(r.file.DeltaOffset, int(r.file.Header.DeltaSize))
 	if deltaData == nil {
@@ -953,7 +1218,23 @@ func (r *Reader) VerifyIntegrity() error {
 		return fmt.Errorf("delta checksum mismatch")
 	}
 
-	// V4/V6: verify range map checksum
+	// V9+: every frame must decompress to its full size
+	if r.deltaFrames != nil {
+		for i := 0; i < r.deltaFrames.frameCount(); i++ {
+			if _, err := r.deltaFrames.decodeFrame(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Delta store: every chunk must be present and match its hash
+	if r.deltaStore != nil {
+		if err := r.verifyDeltaStore(); err != nil {
+			return err
+		}
+	}
+
+	// V4/V6/V8/V10/V12/V14: verify range map checksum
 	if r.hasRangeMaps() {
 		rangeMapOffset := r.file.DeltaOffset + r.file.Header.DeltaSize
 		rangeMapSize := int(footerOffset - rangeMapOffset)
@@ -971,6 +1252,37 @@ func (r *Reader) VerifyIntegrity() error {
 	return nil
 }
 
+// readFooter reads the footer, returning it and its offset in the file.
+func (r *Reader) readFooter() (Footer, int64, error) {
+	footerSz := int64(FooterSize)
+	if r.hasRangeMaps() {
+		footerSz = int64(FooterV4Size)
+	}
+
+	// Read footer from mmap
+	footerOffset := r.dedupMmap.Size() - footerSz
+	footerData := r.dedupMmap.Slice(footerOffset, int(footerSz))
+	if footerData == nil {
+		return Footer{}, 0, fmt.Errorf("footer slice out of range")
+	}
+
+	var footer Footer
+	off := 0
+	footer.IndexChecksum = binary.LittleEndian.Uint64(footerData[off : off+8])
+	off += 8
+	footer.DeltaChecksum = binary.LittleEndian.Uint64(footerData[off : off+8])
+	off += 8
+	if r.hasRangeMaps() {
+		footer.RangeMapChecksum = binary.LittleEndian.Uint64(footerData[off : off+8])
+		off += 8
+	}
+	if string(footerData[off:off+MagicSize]) != Magic {
+		return Footer{}, 0, fmt.Errorf("invalid footer magic")
+	}
+	copy(footer.Magic[:], footerData[off:off+MagicSize])
+	return footer, footerOffset, nil
+}
+
 func (r *Reader) calculateSourceFilesSize() int64 {
 	var size int64
 	hasUsed := r.HasSourceUsedFlags()
@@ -997,9 +1309,24 @@ func (r *Reader) Info() map[string]any {
 		"has_range_maps":    r.rangeMapsByFile != nil,
 		"source_file_count": len(r.file.SourceFiles),
 		"entry_count":       r.entryCount,
-		"delta_size":        r.file.Header.DeltaSize,
+		"index_size":        r.indexSize,
+		"compact_index":     r.compactIdx != nil,
+		"delta_size":        r.DeltaSize(),
+		"delta_stored_size": r.StoredDeltaSize(),
+		"delta_compressed":  r.HasCompressedDelta(),
 		"creator_version":   r.file.CreatorVersion,
 	}
+	if c := r.file.Checksums; c != nil {
+		info["checksum_algorithm"] = c.Algorithm
+	}
+	if c := r.file.ChunkChecksums; c != nil {
+		info["checksum_chunks"] = c.Count()
+		info["checksum_chunk_size"] = c.ChunkSize
+	}
+	if d := r.file.DeltaStore; d != nil {
+		info["delta_store"] = d.Dir
+		info["delta_store_chunks"] = len(d.Chunks)
+	}
 	if err != nil {
 		info["error"] = err.Error()
 	}
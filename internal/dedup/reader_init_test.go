@@ -2,6 +2,7 @@ package dedup
 
 import (
 	"encoding/binary"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -183,8 +184,8 @@ func TestNewReader_InvalidVersion(t *testing.T) {
 	if err == nil {
 		t.Error("NewReader should fail for unsupported version")
 	}
-	if err != nil && !strings.Contains(err.Error(), "expected 3-8") {
-		t.Errorf("Error should mention expected versions 3-8: %v", err)
+	if want := fmt.Sprintf("expected 3-%d", MaxVersion); err != nil && !strings.Contains(err.Error(), want) {
+		t.Errorf("Error should mention expected versions 3-%d: %v", MaxVersion, err)
 	}
 }
 
@@ -0,0 +1,658 @@
+package dedup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/matcher"
+)
+
+// DamagedRange is a byte range [Start, End) of the original MKV that a
+// damaged dedup file can no longer reconstruct.
+type DamagedRange struct {
+	Start int64
+	End   int64
+	Cause string // The damaged part of the dedup file, e.g. "delta frame"
+}
+
+// Damage describes the damage FindDamage found in a dedup file.
+type Damage struct {
+	Index    bool // The index fails its checksum or cannot be decoded
+	Delta    bool // The delta fails its checksum, or delta store chunks are missing or corrupt
+	RangeMap bool // The range map section fails its checksum or cannot be parsed
+
+	// Ranges are the MKV byte ranges the damage was traced to, sorted and
+	// non-overlapping.
+	Ranges []DamagedRange
+
+	// Unlocated describes damage that could not be traced to MKV ranges,
+	// such as a corrupt uncompressed delta. Comparing with a copy of the
+	// original MKV still finds it.
+	Unlocated []string
+}
+
+// OK reports whether no damage was found.
+func (d *Damage) OK() bool {
+	return !d.Index && !d.Delta && !d.RangeMap && len(d.Ranges) == 0 && len(d.Unlocated) == 0
+}
+
+// deltaRange is a byte range [start, end) of the logical delta.
+type deltaRange struct {
+	start, end int64
+	cause      string
+}
+
+// damageScan is the result of checking a dedup file section by section,
+// along with what a repair needs to rebuild it.
+type damageScan struct {
+	damage    Damage
+	entries   []Entry          // Entries that passed the checks, in MKV order
+	deltaSize int64            // Logical delta size, or -1 if the delta is unreadable
+	frames    *deltaFrameIndex // Frame table of a compressed delta
+	badDelta  []deltaRange     // Unreadable parts of the delta
+	badChunks []DeltaChunk     // Missing or corrupt delta store chunks
+	rangeMaps map[int]*SourceRangeMaps
+}
+
+// FindDamage checks a dedup file section by section and traces the damage
+// to the MKV byte ranges it affects. Unlike VerifyIntegrity it does not stop
+// at the first problem, and it works on files too damaged to open for
+// reading. Compact index blocks and compressed delta frames are checked one
+// by one, and index entries must tile the MKV and point inside the delta
+// and source files, so damage to them can be located; a mismatching
+// checksum with nothing located is reported in Damage.Unlocated.
+func (r *Reader) FindDamage() *Damage {
+	return &r.scanDamage().damage
+}
+
+func (r *Reader) scanDamage() *damageScan {
+	s := &damageScan{deltaSize: -1}
+	d := &s.damage
+
+	footer, _, err := r.readFooter()
+	footerOK := err == nil
+	if !footerOK {
+		d.Unlocated = append(d.Unlocated, fmt.Sprintf("footer: %v; section checksums cannot be checked", err))
+	}
+	checksumFails := func(data []byte, want uint64) bool {
+		return footerOK && xxhash.Sum64(data) != want
+	}
+
+	s.scanDelta(r, checksumFails, footer.DeltaChecksum)
+
+	// Range maps are needed to read source entries of V4-style files
+	rangeMapsBroken := false
+	if r.hasRangeMaps() {
+		offset := r.file.DeltaOffset + r.file.Header.DeltaSize
+		data := r.sectionData(offset, r.dedupMmap.Size()-FooterV4Size-offset)
+		var sources []SourceRangeMaps
+		err := fmt.Errorf("section out of range")
+		if data != nil {
+			sources, err = readRangeMapSection(data)
+		}
+		switch {
+		case err != nil:
+			d.RangeMap = true
+			rangeMapsBroken = true
+		case checksumFails(data, footer.RangeMapChecksum):
+			d.RangeMap = true
+			d.Unlocated = append(d.Unlocated, "range map checksum mismatch: the corrupt range maps could not be located")
+			fallthrough
+		default:
+			s.rangeMaps = rangeMapsByIndex(sources)
+		}
+	}
+
+	s.scanIndex(r, checksumFails, footer.IndexChecksum)
+
+	// Trace the unreadable parts of the delta and source data to the
+	// entries that use them.
+	for _, e := range s.entries {
+		end := e.MkvOffset + e.Length
+		switch {
+		case e.IsFill:
+			// Synthesized: nothing outside the index to be damaged
+		case e.Source == 0 && s.deltaSize < 0:
+			d.Ranges = append(d.Ranges, DamagedRange{e.MkvOffset, end, "delta"})
+		case e.Source == 0:
+			for _, dr := range s.badDelta {
+				lo := max(dr.start, e.SourceOffset)
+				hi := min(dr.end, e.SourceOffset+e.Length)
+				if lo < hi {
+					d.Ranges = append(d.Ranges, DamagedRange{
+						e.MkvOffset + lo - e.SourceOffset, e.MkvOffset + hi - e.SourceOffset, dr.cause})
+				}
+			}
+		case rangeMapsBroken:
+			d.Ranges = append(d.Ranges, DamagedRange{e.MkvOffset, end, "range map section"})
+		}
+	}
+	d.Ranges = mergeDamagedRanges(d.Ranges)
+
+	if d.Index && !hasCause(d.Ranges, "index") {
+		d.Unlocated = append(d.Unlocated, "index checksum mismatch: every entry is consistent, so the corrupt ones could not be located")
+	}
+	return s
+}
+
+// scanDelta finds the unreadable parts of the delta.
+func (s *damageScan) scanDelta(r *Reader, checksumFails func([]byte, uint64) bool, checksum uint64) {
+	d := &s.damage
+	section := r.sectionData(r.file.DeltaOffset, r.file.Header.DeltaSize)
+	if section == nil {
+		d.Delta = true
+		d.Unlocated = append(d.Unlocated, "delta section extends past the end of the file")
+		return
+	}
+	d.Delta = checksumFails(section, checksum)
+
+	switch {
+	case r.file.DeltaStore != nil:
+		s.deltaSize = r.file.DeltaStore.Size()
+		var offset int64
+		for _, c := range r.file.DeltaStore.Chunks {
+			if _, err := r.deltaStore.get(c); err != nil {
+				d.Delta = true
+				s.badDelta = append(s.badDelta, deltaRange{offset, offset + c.Size, "delta store chunk"})
+				s.badChunks = append(s.badChunks, c)
+			}
+			offset += c.Size
+		}
+
+	case hasCompressedDelta(r.file.Header.Version):
+		frames, err := parseDeltaFrames(section)
+		if err != nil {
+			// Without the frame table no delta byte can be found
+			d.Delta = true
+			return
+		}
+		s.frames = frames
+		s.deltaSize = frames.logicalSize
+		for i := 0; i < frames.frameCount(); i++ {
+			if _, err := frames.decodeFrame(i); err != nil {
+				start := int64(i) * frames.frameSize
+				s.badDelta = append(s.badDelta, deltaRange{start, start + frames.frameLen(i), "delta frame"})
+			}
+		}
+		if d.Delta && len(s.badDelta) == 0 {
+			d.Unlocated = append(d.Unlocated, "delta checksum mismatch: every frame decompresses, so the corrupt ones could not be located")
+		}
+
+	default:
+		s.deltaSize = r.file.Header.DeltaSize
+		if d.Delta {
+			d.Unlocated = append(d.Unlocated, "delta checksum mismatch: an uncompressed delta has no structure to locate the damage by")
+		}
+	}
+}
+
+// scanIndex decodes the index and keeps the entries that are consistent:
+// each must start where the previous one ended and point inside the delta
+// or its source file. Runs of MKV bytes without such entries are damaged.
+func (s *damageScan) scanIndex(r *Reader, checksumFails func([]byte, uint64) bool, checksum uint64) {
+	d := &s.damage
+	indexStart := r.file.headerSize + r.calculateSourceFilesSize() + r.file.extensionsSize
+	entryCount := int(r.file.Header.EntryCount)
+
+	var candidates []Entry
+	if hasCompactIndex(r.file.Header.Version) {
+		section := r.sectionData(indexStart, r.file.DeltaOffset-indexStart)
+		if section == nil {
+			d.Index = true
+		} else if ci, err := parseCompactIndex(section, entryCount); err != nil {
+			d.Index = true
+		} else {
+			d.Index = checksumFails(section, checksum)
+			for b := 0; b < ci.blockCount(); b++ {
+				block, err := ci.decodeBlock(b)
+				if err != nil {
+					d.Index = true
+					continue
+				}
+				candidates = append(candidates, block...)
+			}
+		}
+	} else {
+		available := max(min(int64(entryCount), (r.dedupMmap.Size()-indexStart)/EntrySize), 0)
+		if section := r.sectionData(indexStart, int64(entryCount)*EntrySize); section == nil || checksumFails(section, checksum) {
+			d.Index = true
+		}
+		candidates = make([]Entry, available)
+		for i := range candidates {
+			candidates[i] = decodeFixedEntry(r.dedupMmap.Slice(indexStart+int64(i)*EntrySize, EntrySize))
+		}
+	}
+
+	originalSize := r.file.Header.OriginalSize
+	// resyncsAt reports whether candidate j can be trusted after damage
+	// ending at pos: it and its successor must be consistent and chained.
+	resyncsAt := func(j int, pos int64) bool {
+		e := candidates[j]
+		if e.MkvOffset <= pos || !s.plausible(r, e) {
+			return false
+		}
+		end := e.MkvOffset + e.Length
+		if j+1 == len(candidates) {
+			return end == originalSize
+		}
+		return candidates[j+1].MkvOffset == end && s.plausible(r, candidates[j+1])
+	}
+
+	var pos int64
+	for i := 0; i < len(candidates) && pos < originalSize; {
+		if e := candidates[i]; e.MkvOffset == pos && s.plausible(r, e) {
+			s.entries = append(s.entries, e)
+			pos += e.Length
+			i++
+			continue
+		}
+		j := i
+		for j < len(candidates) && !resyncsAt(j, pos) {
+			j++
+		}
+		end := originalSize
+		if j < len(candidates) {
+			end = candidates[j].MkvOffset
+		}
+		d.Index = true
+		d.Ranges = append(d.Ranges, DamagedRange{pos, end, "index"})
+		pos = end
+		i = j
+	}
+	if pos < originalSize {
+		d.Index = true
+		d.Ranges = append(d.Ranges, DamagedRange{pos, originalSize, "index"})
+	}
+}
+
+// plausible reports whether an entry lies within the MKV and points inside
+// the delta or its source file.
+func (s *damageScan) plausible(r *Reader, e Entry) bool {
+	if e.IsFill {
+		return e.Length > 0 && e.MkvOffset >= 0 && e.Length <= r.file.Header.OriginalSize-e.MkvOffset &&
+			e.Source == 0 && e.AudioSubStreamID >= 1 && e.AudioSubStreamID <= matcher.MaxFillPattern
+	}
+	if e.Length <= 0 || e.MkvOffset < 0 || e.Length > r.file.Header.OriginalSize-e.MkvOffset || e.SourceOffset < 0 {
+		return false
+	}
+	if e.Source == 0 {
+		return s.deltaSize < 0 || e.Length <= s.deltaSize-e.SourceOffset
+	}
+	if int(e.Source) > len(r.file.SourceFiles) {
+		return false
+	}
+	if r.file.UsesESOffsets {
+		// ES offsets are bounded by the range maps, not the file size
+		return true
+	}
+	return e.Length <= r.file.SourceFiles[e.Source-1].Size-e.SourceOffset
+}
+
+// sectionData returns size bytes of the file at offset, or nil if they are
+// not all within the file.
+func (r *Reader) sectionData(offset, size int64) []byte {
+	if offset < 0 || size < 0 || size > r.dedupMmap.Size()-offset {
+		return nil
+	}
+	if size == 0 {
+		return []byte{}
+	}
+	return r.dedupMmap.Slice(offset, int(size))
+}
+
+// readDelta returns the logical delta with its unreadable parts zeroed, or
+// nil if it cannot be read at all.
+func (s *damageScan) readDelta(r *Reader) []byte {
+	if s.deltaSize < 0 {
+		return nil
+	}
+	delta := make([]byte, s.deltaSize)
+	switch {
+	case r.file.DeltaStore != nil:
+		var offset int64
+		for _, c := range r.file.DeltaStore.Chunks {
+			if data, err := r.deltaStore.get(c); err == nil {
+				copy(delta[offset:], data)
+			}
+			offset += c.Size
+		}
+	case s.frames != nil:
+		for i := 0; i < s.frames.frameCount(); i++ {
+			if data, err := s.frames.decodeFrame(i); err == nil {
+				copy(delta[int64(i)*s.frames.frameSize:], data)
+			}
+		}
+	default:
+		copy(delta, r.sectionData(r.file.DeltaOffset, r.file.Header.DeltaSize))
+	}
+	return delta
+}
+
+// mergeDamagedRanges sorts ranges and merges those that overlap or touch,
+// joining their causes.
+func mergeDamagedRanges(ranges []DamagedRange) []DamagedRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	var merged []DamagedRange
+	for _, dr := range ranges {
+		if n := len(merged); n > 0 && dr.Start <= merged[n-1].End {
+			last := &merged[n-1]
+			last.End = max(last.End, dr.End)
+			if !strings.Contains(last.Cause, dr.Cause) {
+				last.Cause += ", " + dr.Cause
+			}
+			continue
+		}
+		merged = append(merged, dr)
+	}
+	return merged
+}
+
+// hasCause reports whether any range was caused by cause.
+func hasCause(ranges []DamagedRange, cause string) bool {
+	for _, dr := range ranges {
+		if strings.Contains(dr.Cause, cause) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepairResult summarizes what WriteRepaired changed.
+type RepairResult struct {
+	Version      uint32 // Format version of the repaired file
+	PatchedDelta int64  // Delta bytes corrected in place
+	Restored     int64  // MKV bytes stored anew in the delta
+}
+
+// repairCompareSize is how much of an entry WriteRepaired compares at once.
+const repairCompareSize = 4 * 1024 * 1024
+
+// WriteRepaired writes a repaired copy of a damaged dedup file to path,
+// taking the damaged regions from ref, which must hold the original MKV.
+// Every entry the damage scan trusts is compared with ref. When the index
+// is intact, delta bytes that differ are corrected in place; entries that
+// still differ, and MKV ranges without trustworthy entries, are stored anew
+// in the delta from ref. Everything else — source files, range maps,
+// extension records and the format version — is carried over, so the
+// repaired file differs from the damaged one only where it was damaged.
+//
+// Source files must be loaded. When the index is intact, source data that
+// differs from ref means the sources are damaged, not the dedup file, and
+// is an error. A damaged range map section cannot be repaired this way.
+// compareProgress counts MKV bytes compared and writeProgress bytes written.
+func (r *Reader) WriteRepaired(path string, ref io.ReaderAt, compareProgress, writeProgress WriteProgressFunc) (*RepairResult, error) {
+	s := r.scanDamage()
+	if s.damage.RangeMap {
+		return nil, fmt.Errorf("range map section is damaged; restore the file from a backup copy instead")
+	}
+	if r.rangeMapsByFile == nil && s.rangeMaps != nil {
+		// Entry access may have failed to initialize on the damage;
+		// source entries still need the range maps to be read.
+		r.rangeMapsByFile = s.rangeMaps
+	}
+
+	delta := s.readDelta(r)
+	indexIntact := !s.damage.Index
+	originalSize := r.file.Header.OriginalSize
+	res := &RepairResult{}
+	var entries []Entry
+
+	// restore stores MKV bytes [start, end) from ref at the end of the
+	// delta, extending the previous entry when it is contiguous.
+	restore := func(start, end int64) error {
+		offset := int64(len(delta))
+		delta = append(delta, make([]byte, end-start)...)
+		if _, err := ref.ReadAt(delta[offset:], start); err != nil {
+			return fmt.Errorf("read reference at offset %d: %w", start, err)
+		}
+		if n := len(entries); n > 0 && entries[n-1].Source == 0 && !entries[n-1].IsFill &&
+			entries[n-1].MkvOffset+entries[n-1].Length == start &&
+			entries[n-1].SourceOffset+entries[n-1].Length == offset {
+			entries[n-1].Length += end - start
+		} else {
+			entries = append(entries, Entry{MkvOffset: start, Length: end - start, SourceOffset: offset})
+		}
+		res.Restored += end - start
+		return nil
+	}
+
+	want := make([]byte, repairCompareSize)
+	got := make([]byte, repairCompareSize)
+	var pos int64
+	for _, e := range s.entries {
+		if e.MkvOffset > pos {
+			if err := restore(pos, e.MkvOffset); err != nil {
+				return nil, err
+			}
+		}
+		pos = e.MkvOffset + e.Length
+		if compareProgress != nil {
+			compareProgress(pos, originalSize)
+		}
+
+		fromDelta := e.Source == 0 && !e.IsFill
+		inDelta := fromDelta && e.SourceOffset+e.Length <= int64(len(delta))
+		matches := true
+		for off := int64(0); off < e.Length; off += repairCompareSize {
+			n := int(min(repairCompareSize, e.Length-off))
+			if _, err := ref.ReadAt(want[:n], e.MkvOffset+off); err != nil {
+				return nil, fmt.Errorf("read reference at offset %d: %w", e.MkvOffset+off, err)
+			}
+			if fromDelta {
+				if !inDelta {
+					matches = false
+					break
+				}
+				stored := delta[e.SourceOffset+off : e.SourceOffset+off+int64(n)]
+				if bytes.Equal(stored, want[:n]) {
+					continue
+				}
+				if !indexIntact {
+					matches = false
+					break
+				}
+				for i := range stored {
+					if stored[i] != want[i] {
+						res.PatchedDelta++
+					}
+				}
+				copy(stored, want[:n])
+				continue
+			}
+
+			err := r.readEntryAt(e, off, got[:n])
+			if err == nil && bytes.Equal(got[:n], want[:n]) {
+				continue
+			}
+			if indexIntact && !e.IsFill {
+				if err == nil {
+					err = errors.New("source data differs from the reference")
+				}
+				return nil, fmt.Errorf("MKV offset %d (source file %d): %w; the source files are damaged or have changed",
+					e.MkvOffset+off, e.Source-1, err)
+			}
+			matches = false
+			break
+		}
+
+		if matches {
+			entries = append(entries, e)
+		} else if err := restore(e.MkvOffset, pos); err != nil {
+			return nil, err
+		}
+	}
+	if pos < originalSize {
+		if err := restore(pos, originalSize); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := NewWriter(path)
+	if err != nil {
+		return nil, err
+	}
+	w.header = r.file.Header
+	w.SetCreatorVersion(r.file.CreatorVersion)
+	w.SetDeltaCompression(hasCompressedDelta(r.file.Header.Version))
+	w.SetCompactIndex(hasCompactIndex(r.file.Header.Version))
+	w.checksums = r.file.Checksums
+	w.chunkRecord = r.file.ChunkChecksums
+	w.metadata = r.file.Metadata
+	w.sourceFiles = append([]SourceFile(nil), r.file.SourceFiles...)
+	w.entries = entries
+	w.header.EntryCount = uint64(len(entries))
+	w.deltaData = delta
+	w.header.DeltaSize = int64(len(delta))
+
+	// The range map section is intact, so it is copied as-is.
+	if r.hasRangeMaps() {
+		offset := r.file.DeltaOffset + r.file.Header.DeltaSize
+		w.rangeMaps = []RangeMapData{}
+		w.rangeMapBuf = r.dedupMmap.Slice(offset, int(r.dedupMmap.Size()-FooterV4Size-offset))
+	}
+
+	if ref := r.file.DeltaStore; ref != nil {
+		store := &DeltaStore{dir: ref.Dir}
+		// A corrupt chunk file would be kept as it is when the repaired
+		// delta stores the same chunk, so remove it first.
+		for _, c := range s.badChunks {
+			if err := os.Remove(store.chunkPath(c.Hash)); err != nil && !os.IsNotExist(err) {
+				w.Close()
+				return nil, fmt.Errorf("remove corrupt delta store chunk: %w", err)
+			}
+		}
+		w.SetDeltaStore(store)
+	}
+
+	if err := w.WriteWithProgress(writeProgress); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("close: %w", err)
+	}
+	res.Version = w.header.Version
+	return res, nil
+}
+
+// ErrDifferentLayout is returned by PatchFromCopy when the copy is not laid
+// out like the damaged file, so that it cannot be patched byte for byte.
+var ErrDifferentLayout = errors.New("copy differs in size from the damaged file")
+
+// PatchedRange is a byte range of a dedup file rewritten by PatchFromCopy.
+type PatchedRange struct {
+	Offset  int64
+	Length  int64
+	Section string // The file section the range starts in, e.g. "index"
+}
+
+// patchMergeGap is the distance below which PatchFromCopy merges runs of
+// differing bytes into one write.
+const patchMergeGap = 64
+
+// PatchFromCopy repairs the dedup file at path from a copy of it, such as a
+// backup, by rewriting only the bytes that differ. The copy must pass
+// VerifyIntegrity and describe the same MKV. If the files differ in size,
+// ErrDifferentLayout is returned and nothing is written; the copy can
+// still be used as a reference for WriteRepaired. With dryRun the differing
+// ranges are returned without writing them.
+func PatchFromCopy(path, copyPath string, dryRun bool) ([]PatchedRange, error) {
+	good, err := NewReaderLazy(copyPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("open copy: %w", err)
+	}
+	defer good.Close()
+	if err := good.VerifyIntegrity(); err != nil {
+		return nil, fmt.Errorf("copy is damaged too: %w", err)
+	}
+	if damaged, err := NewReaderLazy(path, ""); err == nil {
+		same := damaged.OriginalSize() == good.OriginalSize() && damaged.OriginalChecksum() == good.OriginalChecksum()
+		damaged.Close()
+		if !same {
+			return nil, fmt.Errorf("copy describes a different MKV")
+		}
+	}
+
+	flags := os.O_RDWR
+	if dryRun {
+		flags = os.O_RDONLY
+	}
+	f, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() != good.dedupMmap.Size() {
+		return nil, ErrDifferentLayout
+	}
+
+	const chunkSize = 1024 * 1024
+	var patches []PatchedRange
+	buf := make([]byte, chunkSize)
+	for offset := int64(0); offset < stat.Size(); offset += chunkSize {
+		n := int(min(chunkSize, stat.Size()-offset))
+		if _, err := f.ReadAt(buf[:n], offset); err != nil {
+			return nil, fmt.Errorf("read at offset %d: %w", offset, err)
+		}
+		want := good.dedupMmap.Slice(offset, n)
+		for i := 0; i < n; i++ {
+			if buf[i] == want[i] {
+				continue
+			}
+			at := offset + int64(i)
+			if k := len(patches); k > 0 && at-(patches[k-1].Offset+patches[k-1].Length) < patchMergeGap {
+				patches[k-1].Length = at + 1 - patches[k-1].Offset
+			} else {
+				patches = append(patches, PatchedRange{Offset: at, Length: 1, Section: good.sectionAt(at)})
+			}
+		}
+	}
+	if dryRun || len(patches) == 0 {
+		return patches, nil
+	}
+
+	for _, p := range patches {
+		if _, err := f.WriteAt(good.dedupMmap.Slice(p.Offset, int(p.Length)), p.Offset); err != nil {
+			return nil, fmt.Errorf("patch offset %d: %w", p.Offset, err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	return patches, nil
+}
+
+// sectionAt returns the name of the file section containing offset.
+func (r *Reader) sectionAt(offset int64) string {
+	sourceFilesEnd := r.file.headerSize + r.calculateSourceFilesSize()
+	deltaEnd := r.file.DeltaOffset + r.file.Header.DeltaSize
+	footerSize := int64(FooterSize)
+	if r.hasRangeMaps() {
+		footerSize = FooterV4Size
+	}
+	switch {
+	case offset < r.file.headerSize:
+		return "header"
+	case offset < sourceFilesEnd:
+		return "source file table"
+	case offset < sourceFilesEnd+r.file.extensionsSize:
+		return "extension records"
+	case offset < r.file.DeltaOffset:
+		return "index"
+	case offset < deltaEnd:
+		return "delta"
+	case offset < r.dedupMmap.Size()-footerSize:
+		return "range maps"
+	}
+	return "footer"
+}
@@ -0,0 +1,286 @@
+package dedup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// writeRepairFixture writes a dedup file alternating delta and source
+// entries, large enough for several compact index blocks and delta frames.
+// It returns the file path, its source directory and the original MKV.
+func writeRepairFixture(t *testing.T, compressed bool) (string, string, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	src := make([]byte, 64*1024)
+	for i := range src {
+		src[i] = byte(i*7 + i/251)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.vob"), src, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var want, delta []byte
+	var entries []matcher.Entry
+	for i := range 300 {
+		if i%2 == 0 {
+			chunk := []byte(strings.Repeat(fmt.Sprintf("delta entry %d ", i), 150))
+			entries = append(entries, matcher.Entry{MkvOffset: int64(len(want)), Length: int64(len(chunk)), SourceOffset: int64(len(delta))})
+			delta = append(delta, chunk...)
+			want = append(want, chunk...)
+			continue
+		}
+		off := int64(i * 200)
+		entries = append(entries, matcher.Entry{MkvOffset: int64(len(want)), Length: 100, Source: 1, SourceOffset: off})
+		want = append(want, src[off:off+100]...)
+	}
+
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize:   int64(len(want)),
+		sourceType:     source.TypeDVD,
+		creatorVersion: "test",
+		compressDelta:  compressed,
+		compactIndex:   compressed,
+		sourceFiles:    []source.File{{RelativePath: "a.vob", Size: int64(len(src))}},
+		result:         &matcher.Result{Entries: entries, DeltaData: delta},
+	})
+	return path, dir, want
+}
+
+// corruptFile inverts n bytes of the file at path starting at offset.
+func corruptFile(t *testing.T, path string, offset int64, n int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for i := range n {
+		data[offset+int64(i)] ^= 0xFF
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// fixtureLayout returns the index start and delta offset of a dedup file.
+func fixtureLayout(t *testing.T, path string) (int64, int64) {
+	t.Helper()
+	r, err := NewReader(path, "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	return r.indexStart, r.file.DeltaOffset
+}
+
+func TestReader_FindDamage(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		compressed bool
+		corrupt    func(t *testing.T, path string)
+		cause      string // Cause of the located ranges ("" for none)
+		unlocated  bool
+	}{
+		{"intact", true, func(*testing.T, string) {}, "", false},
+		{"delta frame", true, func(t *testing.T, path string) {
+			_, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, deltaOffset+200, 16)
+		}, "delta frame", false},
+		{"index block", true, func(t *testing.T, path string) {
+			indexStart, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, (indexStart+deltaOffset)/2, 16)
+		}, "index", false},
+		{"fixed index entry", false, func(t *testing.T, path string) {
+			indexStart, _ := fixtureLayout(t, path)
+			corruptFile(t, path, indexStart+10*EntrySize, 8) // MkvOffset of entry 10
+		}, "index", false},
+		{"uncompressed delta", false, func(t *testing.T, path string) {
+			_, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, deltaOffset+200, 16)
+		}, "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _, want := writeRepairFixture(t, tt.compressed)
+			tt.corrupt(t, path)
+
+			r, err := NewReaderLazy(path, "")
+			if err != nil {
+				t.Fatalf("NewReaderLazy: %v", err)
+			}
+			defer r.Close()
+			d := r.FindDamage()
+			if tt.cause == "" && !tt.unlocated {
+				if !d.OK() {
+					t.Fatalf("FindDamage = %+v, want no damage", d)
+				}
+				return
+			}
+			if d.OK() {
+				t.Fatal("FindDamage found no damage")
+			}
+			if tt.unlocated != (len(d.Unlocated) > 0) {
+				t.Errorf("Unlocated = %q, want unlocated damage %v", d.Unlocated, tt.unlocated)
+			}
+			if tt.cause == "" {
+				if len(d.Ranges) != 0 {
+					t.Errorf("Ranges = %+v, want none", d.Ranges)
+				}
+				return
+			}
+			if len(d.Ranges) == 0 {
+				t.Fatal("no damaged ranges located")
+			}
+			for i, dr := range d.Ranges {
+				if dr.Cause != tt.cause {
+					t.Errorf("range %d cause = %q, want %q", i, dr.Cause, tt.cause)
+				}
+				if dr.Start >= dr.End || dr.End > int64(len(want)) || (i > 0 && dr.Start <= d.Ranges[i-1].End) {
+					t.Errorf("range %d = [%d, %d) is out of order or bounds", i, dr.Start, dr.End)
+				}
+			}
+		})
+	}
+}
+
+func TestReader_WriteRepaired(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		compressed bool
+		corrupt    func(t *testing.T, path string)
+	}{
+		{"delta frame", true, func(t *testing.T, path string) {
+			_, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, deltaOffset+200, 16)
+		}},
+		{"index block", true, func(t *testing.T, path string) {
+			indexStart, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, (indexStart+deltaOffset)/2, 16)
+		}},
+		{"index and delta", true, func(t *testing.T, path string) {
+			indexStart, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, indexStart+CompactIndexHeaderSize+40, 8)
+			corruptFile(t, path, deltaOffset+200, 16)
+		}},
+		{"uncompressed delta", false, func(t *testing.T, path string) {
+			_, deltaOffset := fixtureLayout(t, path)
+			corruptFile(t, path, deltaOffset+200, 16)
+		}},
+		{"fixed index entry", false, func(t *testing.T, path string) {
+			indexStart, _ := fixtureLayout(t, path)
+			corruptFile(t, path, indexStart+11*EntrySize+18, 8) // SourceOffset of a source entry
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path, sourceDir, want := writeRepairFixture(t, tt.compressed)
+			origSize := fileSize(t, path)
+			tt.corrupt(t, path)
+
+			r, err := NewReaderLazy(path, sourceDir)
+			if err != nil {
+				t.Fatalf("NewReaderLazy: %v", err)
+			}
+			defer r.Close()
+			if err := r.LoadSourceFiles(); err != nil {
+				t.Fatalf("LoadSourceFiles: %v", err)
+			}
+			version := r.Version()
+			out := filepath.Join(t.TempDir(), "repaired.mkvdup")
+			res, err := r.WriteRepaired(out, bytes.NewReader(want), nil, nil)
+			if err != nil {
+				t.Fatalf("WriteRepaired: %v", err)
+			}
+			if res.Version != version {
+				t.Errorf("repaired version = %d, want %d", res.Version, version)
+			}
+			if res.PatchedDelta == 0 && res.Restored == 0 {
+				t.Error("WriteRepaired reports nothing repaired")
+			}
+			if got := readAllDedup(t, out, sourceDir); !bytes.Equal(got, want) {
+				t.Error("repaired file reconstructs different data")
+			}
+			// Only damaged data is re-stored, so the file barely grows.
+			if size := fileSize(t, out); size > origSize+int64(len(want))/4 {
+				t.Errorf("repaired file is %d bytes, original %d", size, origSize)
+			}
+		})
+	}
+}
+
+func TestReader_WriteRepaired_SourceChanged(t *testing.T) {
+	path, sourceDir, want := writeRepairFixture(t, true)
+	_, deltaOffset := fixtureLayout(t, path)
+	corruptFile(t, path, deltaOffset+200, 16)
+	// Source data no longer matching an intact index is not the dedup
+	// file's damage, and must not be papered over.
+	corruptFile(t, filepath.Join(sourceDir, "a.vob"), 31*200, 4)
+
+	r, err := NewReaderLazy(path, sourceDir)
+	if err != nil {
+		t.Fatalf("NewReaderLazy: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	_, err = r.WriteRepaired(filepath.Join(t.TempDir(), "repaired.mkvdup"), bytes.NewReader(want), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "source files are damaged") {
+		t.Errorf("WriteRepaired = %v, want source damage error", err)
+	}
+}
+
+func TestPatchFromCopy(t *testing.T) {
+	path, _, _ := writeRepairFixture(t, true)
+	backup := filepath.Join(t.TempDir(), "backup.mkvdup")
+	good, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if err := os.WriteFile(backup, good, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	indexStart, deltaOffset := fixtureLayout(t, path)
+	corruptFile(t, path, indexStart+20, 4)
+	corruptFile(t, path, deltaOffset+200, 16)
+
+	patches, err := PatchFromCopy(path, backup, true)
+	if err != nil {
+		t.Fatalf("PatchFromCopy(dry run): %v", err)
+	}
+	if len(patches) != 2 || patches[0].Section != "index" || patches[1].Section != "delta" ||
+		patches[0].Length != 4 || patches[1].Length != 16 {
+		t.Fatalf("patches = %+v, want 4 index bytes and 16 delta bytes", patches)
+	}
+	if data, _ := os.ReadFile(path); bytes.Equal(data, good) {
+		t.Fatal("dry run patched the file")
+	}
+
+	if _, err := PatchFromCopy(path, backup, false); err != nil {
+		t.Fatalf("PatchFromCopy: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, good) {
+		t.Error("patched file differs from the copy")
+	}
+
+	// A copy laid out differently cannot be patched from.
+	other, _, _ := writeRepairFixture(t, false)
+	if _, err := PatchFromCopy(path, other, true); !errors.Is(err, ErrDifferentLayout) {
+		t.Errorf("PatchFromCopy(other layout) = %v, want ErrDifferentLayout", err)
+	}
+}
+
+// fileSize returns the size of the file at path.
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	return info.Size()
+}
@@ -0,0 +1,140 @@
+package dedup
+
+import (
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+)
+
+// Version returns the file format version.
+func (r *Reader) Version() uint32 {
+	return r.file.Header.Version
+}
+
+// CreatorVersion returns the version string of the mkvdup that created the
+// file, or "" for files before V5.
+func (r *Reader) CreatorVersion() string {
+	return r.file.CreatorVersion
+}
+
+// NeedsUpgrade reports whether WriteUpgraded would write the file in a
+// newer format version. Files with a compact index (V11+) are current: V13
+// and V14 only add an extension area, which an upgrade has nothing to put in.
+func (r *Reader) NeedsUpgrade() bool {
+	return !hasCompactIndex(r.file.Header.Version)
+}
+
+// WriteUpgraded writes the contents of r to a new dedup file at path in the
+// newest format version (V11, or V12 with range maps), with a compact index,
+// a compressed delta, per-source Used flags computed from the entries and
+// creatorVersion as the creator version. Entries, delta and range maps are
+// carried over unchanged, so the file reconstructs the same MKV. It returns
+// the version written.
+func (r *Reader) WriteUpgraded(path, creatorVersion string, progress WriteProgressFunc) (uint32, error) {
+	if !r.NeedsUpgrade() {
+		return 0, fmt.Errorf("file is already version %d", r.file.Header.Version)
+	}
+	if err := r.initEntryAccess(); err != nil {
+		return 0, fmt.Errorf("init entry access: %w", err)
+	}
+
+	entries := make([]Entry, r.entryCount)
+	for i := range entries {
+		e, ok := r.getEntry(i)
+		if !ok {
+			return 0, fmt.Errorf("read entry %d", i)
+		}
+		entries[i] = e
+	}
+
+	// Compressed deltas are decompressed a frame at a time into a temp
+	// file, as a match writes its delta, rather than held in memory whole.
+	// Uncompressed deltas are passed on straight from the mmap.
+	var delta []byte
+	var deltaFile *matcher.DeltaWriter
+	if r.deltaFrames != nil {
+		var err error
+		deltaFile, err = r.decompressDelta()
+		if err != nil {
+			return 0, err
+		}
+		defer deltaFile.Close()
+	} else if r.file.Header.DeltaSize > 0 {
+		delta = r.dedupMmap.Slice(r.file.DeltaOffset, int(r.file.Header.DeltaSize))
+		if delta == nil {
+			return 0, fmt.Errorf("delta section slice out of bounds")
+		}
+	}
+
+	// The range map section has the same encoding in every version, so it
+	// is copied as-is.
+	var rangeMapBuf []byte
+	if r.hasRangeMaps() {
+		offset := r.file.DeltaOffset + r.file.Header.DeltaSize
+		rangeMapBuf = r.dedupMmap.Slice(offset, int(r.dedupMmap.Size()-FooterV4Size-offset))
+		if rangeMapBuf == nil {
+			return 0, fmt.Errorf("range map section slice out of bounds")
+		}
+	}
+
+	w, err := NewWriter(path)
+	if err != nil {
+		return 0, err
+	}
+
+	w.header = r.file.Header
+	w.SetCreatorVersion(creatorVersion)
+	w.SetDeltaCompression(true)
+	w.SetCompactIndex(true)
+	w.sourceFiles = append([]SourceFile(nil), r.file.SourceFiles...)
+	w.entries = entries
+	if deltaFile != nil {
+		w.deltaFile = deltaFile
+		w.header.DeltaSize = deltaFile.Size()
+	} else {
+		w.deltaData = delta
+		w.header.DeltaSize = int64(len(delta))
+	}
+
+	if rangeMapBuf != nil {
+		w.rangeMaps = []RangeMapData{}
+		w.rangeMapBuf = rangeMapBuf
+	}
+
+	if err := w.WriteWithProgress(progress); err != nil {
+		w.Close()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("close: %w", err)
+	}
+	return w.header.Version, nil
+}
+
+// decompressDelta writes the compressed delta of r, a frame at a time, to
+// a temp file. The caller closes it.
+func (r *Reader) decompressDelta() (*matcher.DeltaWriter, error) {
+	dw, err := matcher.NewDeltaWriter()
+	if err != nil {
+		return nil, err
+	}
+	for i := range r.deltaFrames.frameCount() {
+		frame, err := r.deltaFrames.decodeFrame(i)
+		if err == nil {
+			err = dw.Write(frame)
+		}
+		if err != nil {
+			dw.Close()
+			return nil, fmt.Errorf("read delta: %w", err)
+		}
+	}
+	if err := dw.Flush(); err != nil {
+		dw.Close()
+		return nil, fmt.Errorf("write delta: %w", err)
+	}
+	if dw.Size() != r.deltaFrames.logicalSize {
+		dw.Close()
+		return nil, fmt.Errorf("delta frames hold %d bytes, want %d", dw.Size(), r.deltaFrames.logicalSize)
+	}
+	return dw, nil
+}
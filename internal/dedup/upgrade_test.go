@@ -0,0 +1,172 @@
+package dedup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// readAllDedup reconstructs the whole MKV of the dedup file at path.
+func readAllDedup(t *testing.T, path, sourceDir string) []byte {
+	t.Helper()
+	r, err := NewReader(path, sourceDir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	buf := make([]byte, r.OriginalSize())
+	if n, err := r.ReadAt(buf, 0); err != nil || n != len(buf) {
+		t.Fatalf("ReadAt: n=%d, err=%v", n, err)
+	}
+	return buf
+}
+
+func TestReader_WriteUpgraded(t *testing.T) {
+	dir := t.TempDir()
+	srcA := bytes.Repeat([]byte("source A "), 50)
+	if err := os.WriteFile(filepath.Join(dir, "a.vob"), srcA, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.vob"), []byte("unused"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	// A delta of several frames, which don't all compress
+	frames := make([]byte, 2*DeltaFrameSize+1000)
+	for i := range frames {
+		frames[i] = byte(i * i >> 7)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		creator  string
+		compress bool
+		delta    []byte
+		version  uint32
+	}{
+		{"V3", "", false, []byte("delta bytes"), Version},
+		{"V9", "test-v1", true, []byte("delta bytes"), VersionCompressed},
+		{"V9 frames", "test-v1", true, frames, VersionCompressed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := tt.delta
+			d := int64(len(delta))
+			want := append(append([]byte(nil), delta...), srcA[10:110]...)
+			path := writeTestDedupFile(t, t.TempDir(), writeTestOptions{
+				originalSize:   int64(len(want)),
+				sourceType:     source.TypeDVD,
+				creatorVersion: tt.creator,
+				compressDelta:  tt.compress,
+				sourceFiles: []source.File{
+					{RelativePath: "a.vob", Size: int64(len(srcA))},
+					{RelativePath: "b.vob", Size: 6},
+				},
+				result: &matcher.Result{
+					Entries: []matcher.Entry{
+						{MkvOffset: 0, Length: d, Source: 0, SourceOffset: 0},
+						{MkvOffset: d, Length: 100, Source: 1, SourceOffset: 10},
+					},
+					DeltaData: delta,
+				},
+			})
+
+			r, err := NewReader(path, dir)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			defer r.Close()
+			if r.Version() != tt.version || !r.NeedsUpgrade() {
+				t.Fatalf("version = %d, NeedsUpgrade = %v; want %d, true", r.Version(), r.NeedsUpgrade(), tt.version)
+			}
+			out := filepath.Join(t.TempDir(), "upgraded.mkvdup")
+			version, err := r.WriteUpgraded(out, "test-v2", nil)
+			if err != nil {
+				t.Fatalf("WriteUpgraded: %v", err)
+			}
+			if version != VersionCompactIndex {
+				t.Errorf("WriteUpgraded version = %d, want %d", version, VersionCompactIndex)
+			}
+
+			if got := readAllDedup(t, out, dir); !bytes.Equal(got, want) {
+				t.Error("upgraded file reconstructs different data")
+			}
+			u, err := NewReader(out, dir)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			defer u.Close()
+			if u.NeedsUpgrade() || u.CreatorVersion() != "test-v2" {
+				t.Errorf("upgraded NeedsUpgrade = %v, creator = %q", u.NeedsUpgrade(), u.CreatorVersion())
+			}
+			files := u.SourceFiles()
+			if !files[0].Used || files[1].Used {
+				t.Errorf("Used flags = %v, %v; want true, false", files[0].Used, files[1].Used)
+			}
+			if _, err := u.WriteUpgraded(filepath.Join(t.TempDir(), "again.mkvdup"), "", nil); err == nil ||
+				!strings.Contains(err.Error(), "already version") {
+				t.Errorf("WriteUpgraded of a current file = %v, want already version", err)
+			}
+		})
+	}
+}
+
+func TestReader_WriteUpgradedRangeMaps(t *testing.T) {
+	dir := t.TempDir()
+	srcData := make([]byte, 200)
+	for i := range srcData {
+		srcData[i] = byte(i * 3)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00001.m2ts"), srcData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	path := filepath.Join(dir, "test.mkvdup")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.SetHeader(184, 0x1234, source.TypeBluray)
+	w.SetSourceFiles([]source.File{{RelativePath: "00001.m2ts", Size: int64(len(srcData))}})
+	w.SetRangeMaps([]RangeMapData{{
+		VideoRanges: []source.PESPayloadRange{{FileOffset: 8, Size: 184, ESOffset: 0}},
+	}})
+	if err := w.SetMatchResult(&matcher.Result{
+		Entries: []matcher.Entry{{MkvOffset: 0, Length: 184, Source: 1, SourceOffset: 0, IsVideo: true}},
+	}, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if r.Version() != VersionRangeMap {
+		t.Fatalf("version = %d, want %d", r.Version(), VersionRangeMap)
+	}
+	out := filepath.Join(dir, "upgraded.mkvdup")
+	version, err := r.WriteUpgraded(out, "test-v2", nil)
+	if err != nil {
+		t.Fatalf("WriteUpgraded: %v", err)
+	}
+	if version != VersionRangeMapCompactIndex {
+		t.Errorf("version = %d, want %d", version, VersionRangeMapCompactIndex)
+	}
+	if got := readAllDedup(t, out, dir); !bytes.Equal(got, srcData[8:192]) {
+		t.Error("upgraded file reconstructs different data")
+	}
+}
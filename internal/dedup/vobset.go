@@ -0,0 +1,91 @@
+package dedup
+
+import (
+	"io"
+	"os"
+	"sort"
+
+	"github.com/stuckj/mkvdup/internal/mmap"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// vobSetsFor returns the DVD VOB sets (see source.VOBSets) among the given
+// source files. Entries and range maps for a VOB set reference the file index
+// of its first part, with offsets into the concatenation of all parts.
+func vobSetsFor(sourceType uint8, files []SourceFile) [][]int {
+	if sourceType != SourceTypeDVD {
+		return nil
+	}
+	paths := make([]string, len(files))
+	for i, sf := range files {
+		paths[i] = sf.RelativePath
+	}
+	return source.VOBSets(paths)
+}
+
+// vobSetFile presents the parts of a DVD VOB set as one continuous source
+// file. It does not own the parts: Close is a no-op and the parts are closed
+// through Reader.sourceFiles.
+type vobSetFile struct {
+	parts  []mmap.SourceFile
+	starts []int64 // logical start offset of each part
+	size   int64
+}
+
+// newVOBSetFile creates a continuous view over the given parts, in order.
+func newVOBSetFile(parts []mmap.SourceFile) *vobSetFile {
+	v := &vobSetFile{
+		parts:  parts,
+		starts: make([]int64, len(parts)),
+	}
+	for i, p := range parts {
+		v.starts[i] = v.size
+		v.size += p.Size()
+	}
+	return v
+}
+
+// ReadAt reads len(p) bytes at the given logical offset, crossing part
+// boundaries as needed.
+func (v *vobSetFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off >= v.size {
+		return 0, io.EOF
+	}
+	// Find the part containing off
+	i := sort.Search(len(v.parts), func(i int) bool {
+		return v.starts[i]+v.parts[i].Size() > off
+	})
+	n := 0
+	for ; i < len(v.parts) && n < len(p); i++ {
+		partOff := off + int64(n) - v.starts[i]
+		want := int64(len(p) - n)
+		if avail := v.parts[i].Size() - partOff; want > avail {
+			want = avail
+		}
+		m, err := v.parts[i].ReadAt(p[n:n+int(want)], partOff)
+		n += m
+		if err != nil && !(err == io.EOF && int64(m) == want) {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the combined size of all parts.
+func (v *vobSetFile) Size() int64 {
+	return v.size
+}
+
+// Close is a no-op; the parts are owned by the Reader.
+func (v *vobSetFile) Close() error {
+	return nil
+}
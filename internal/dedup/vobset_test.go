@@ -0,0 +1,148 @@
+package dedup
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/mmap"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+func TestVOBSetFile_ReadAt(t *testing.T) {
+	dir := t.TempDir()
+	partData := [][]byte{
+		bytes.Repeat([]byte{0x11}, 100),
+		bytes.Repeat([]byte{0x22}, 50),
+		bytes.Repeat([]byte{0x33}, 80),
+	}
+	var want []byte
+	parts := make([]mmap.SourceFile, len(partData))
+	for i, d := range partData {
+		path := filepath.Join(dir, "part"+string(rune('0'+i)))
+		if err := os.WriteFile(path, d, 0644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := mmap.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+		parts[i] = m
+		want = append(want, d...)
+	}
+
+	v := newVOBSetFile(parts)
+	if v.Size() != int64(len(want)) {
+		t.Fatalf("Size() = %d, want %d", v.Size(), len(want))
+	}
+
+	tests := []struct {
+		name string
+		off  int64
+		size int
+	}{
+		{"within first part", 10, 20},
+		{"spans first boundary", 90, 20},
+		{"spans all parts", 0, len(want)},
+		{"spans middle part", 99, 60},
+		{"last byte", int64(len(want) - 1), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.size)
+			n, err := v.ReadAt(buf, tt.off)
+			if err != nil {
+				t.Fatalf("ReadAt: %v", err)
+			}
+			if n != tt.size {
+				t.Fatalf("ReadAt returned %d bytes, want %d", n, tt.size)
+			}
+			if !bytes.Equal(buf, want[tt.off:tt.off+int64(tt.size)]) {
+				t.Error("ReadAt data mismatch")
+			}
+		})
+	}
+
+	// Reading past the end returns a short read with io.EOF
+	buf := make([]byte, 20)
+	n, err := v.ReadAt(buf, int64(len(want)-10))
+	if n != 10 || err != io.EOF {
+		t.Errorf("ReadAt past end = (%d, %v), want (10, EOF)", n, err)
+	}
+}
+
+func TestReadAt_VOBSetSpansParts(t *testing.T) {
+	dir := t.TempDir()
+	srcDir := filepath.Join(dir, "src")
+	videoTS := filepath.Join(srcDir, "VIDEO_TS")
+	if err := os.MkdirAll(videoTS, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	vob1 := make([]byte, 120)
+	vob2 := make([]byte, 80)
+	for i := range vob1 {
+		vob1[i] = byte(i)
+	}
+	for i := range vob2 {
+		vob2[i] = byte(200 - i)
+	}
+	if err := os.WriteFile(filepath.Join(videoTS, "VTS_01_1.VOB"), vob1, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(videoTS, "VTS_01_2.VOB"), vob2, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stream := append(append([]byte{}, vob1...), vob2...)
+
+	// One entry referencing the first part, reading across into the second.
+	dedupPath := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize:     100,
+		originalChecksum: 0xAAAA,
+		sourceType:       source.TypeDVD,
+		creatorVersion:   "test-v1",
+		sourceFiles: []source.File{
+			{RelativePath: filepath.Join("VIDEO_TS", "VTS_01_1.VOB"), Size: int64(len(vob1))},
+			{RelativePath: filepath.Join("VIDEO_TS", "VTS_01_2.VOB"), Size: int64(len(vob2))},
+		},
+		result: &matcher.Result{
+			Entries: []matcher.Entry{
+				{MkvOffset: 0, Length: 100, Source: 1, SourceOffset: 70, IsVideo: true},
+			},
+			MatchedBytes: 100,
+			TotalPackets: 1,
+		},
+	})
+
+	r, err := NewReader(dedupPath, srcDir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+
+	// Both parts are marked used even though only the first is referenced.
+	for i, sf := range r.SourceFiles() {
+		if !sf.Used {
+			t.Errorf("source file %d (%s) not marked used", i, sf.RelativePath)
+		}
+	}
+
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	buf := make([]byte, 100)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if n != 100 {
+		t.Fatalf("ReadAt returned %d bytes, want 100", n)
+	}
+	if !bytes.Equal(buf, stream[70:170]) {
+		t.Error("ReadAt data mismatch across VOB boundary")
+	}
+}
@@ -2,6 +2,8 @@ package dedup
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -23,6 +25,15 @@ type Writer struct {
 	rangeMaps      []RangeMapData       // V4/V6: per-source-file range maps (nil for V3/V5)
 	rangeMapBuf    []byte               // Pre-encoded range map section (set by EncodeRangeMaps)
 	creatorVersion string               // Version string to embed in the file
+	compressDelta  bool                 // Store the delta as compressed frames (V9+)
+	compactIndex   bool                 // Store variable-length index entries (V11/V12)
+	checksums      *ExtendedChecksums   // Cryptographic checksums (V13/V14)
+	chunkSums      [][]uint64           // Per-source chunk checksums from the indexer (V13/V14)
+	chunkSize      int64                // Chunk size of chunkSums (0 = source.ChecksumChunkSize)
+	chunkRecord    *ChunkChecksums      // Chunk checksums carried over as they are (see WriteRepaired)
+	deltaStore     *DeltaStore          // Shared store to keep the delta in (V13/V14)
+	deltaStoreRef  *DeltaStoreRef       // Chunks of the delta, once stored (see StoreDelta)
+	metadata       *Metadata            // Description of the original MKV (V13/V14)
 }
 
 // NewWriter creates a new dedup file writer.
@@ -35,7 +46,8 @@ func NewWriter(path string) (*Writer, error) {
 }
 
 // SetCreatorVersion sets the version string to embed in the file.
-// When set, the writer produces V7 (or V8 if range maps are also set).
+// When set, the writer produces V7 (or V8 if range maps are also set),
+// or V9/V10 if delta compression is enabled.
 func (w *Writer) SetCreatorVersion(v string) {
 	if len(v) > MaxCreatorVersionLen {
 		v = v[:MaxCreatorVersionLen]
@@ -43,6 +55,87 @@ func (w *Writer) SetCreatorVersion(v string) {
 	w.creatorVersion = v
 }
 
+// SetDeltaCompression enables storing the delta section as independently
+// compressed frames. This produces V9 (or V10 if range maps are also set),
+// which includes the creator version and Used flags of V7/V8.
+func (w *Writer) SetDeltaCompression(enabled bool) {
+	w.compressDelta = enabled
+}
+
+// SetCompactIndex enables storing index entries varint-encoded in blocks
+// instead of at a fixed 28 bytes each. This produces V11 (or V12 if range
+// maps are also set), which also compresses the delta like V9/V10.
+func (w *Writer) SetCompactIndex(enabled bool) {
+	w.compactIndex = enabled
+}
+
+// SetExtendedChecksums stores cryptographic digests of the original MKV and
+// the source files in a checksum extension record. This produces V13 (or V14
+// if range maps are also set), which has the compact index and compressed
+// delta of V11/V12. c.Sources must follow the order of SetSourceFiles.
+func (w *Writer) SetExtendedChecksums(c *ExtendedChecksums) {
+	w.checksums = c
+}
+
+// SetChunkSize sets the chunk size of the source files' ChunkChecksums, if
+// they were not computed with source.ChecksumChunkSize.
+func (w *Writer) SetChunkSize(size int64) {
+	w.chunkSize = size
+}
+
+// SetDeltaStore keeps the delta in a shared delta store instead of in the
+// dedup file, so that content common to many files' deltas is stored once.
+// This produces V13 (or V14 if range maps are also set) with a delta store
+// extension record; the file's own delta section is empty.
+func (w *Writer) SetDeltaStore(store *DeltaStore) {
+	w.deltaStore = store
+}
+
+// SetMetadata stores a description of the original MKV in a metadata
+// extension record, producing V13 (or V14 if range maps are also set).
+func (w *Writer) SetMetadata(m *Metadata) {
+	w.metadata = m
+}
+
+// StoreDelta splits the delta set by SetMatchResult into the delta store.
+// WriteWithProgress calls it if it has not been called, but calling it first
+// allows its progress to be reported separately; progress counts delta bytes.
+func (w *Writer) StoreDelta(progress WriteProgressFunc) error {
+	if w.deltaStore == nil {
+		return fmt.Errorf("no delta store set")
+	}
+	if w.deltaStoreRef != nil {
+		return nil
+	}
+	var src io.Reader
+	if w.deltaFile != nil {
+		f := w.deltaFile.File()
+		if _, err := f.Seek(0, 0); err != nil {
+			return fmt.Errorf("seek delta file: %w", err)
+		}
+		src = f
+	} else {
+		src = bytes.NewReader(w.deltaData)
+	}
+	total := w.header.DeltaSize
+	ref, err := w.deltaStore.storeDelta(src, func(done int64) {
+		if progress != nil {
+			progress(done, total)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("store delta: %w", err)
+	}
+	if ref.Size() != total {
+		return fmt.Errorf("delta size changed: expected %d bytes, read %d", total, ref.Size())
+	}
+	w.deltaStoreRef = ref
+	w.deltaFile = nil
+	w.deltaData = nil
+	w.header.DeltaSize = 0
+	return nil
+}
+
 // SetHeader sets the header information.
 func (w *Writer) SetHeader(originalSize int64, originalChecksum uint64, sourceType source.Type) {
 	copy(w.header.Magic[:], Magic)
@@ -57,18 +150,38 @@ func (w *Writer) SetHeader(originalSize int64, originalChecksum uint64, sourceTy
 		w.header.SourceType = SourceTypeDVD
 	case source.TypeBluray:
 		w.header.SourceType = SourceTypeBluray
+	case source.TypeMPEGTS:
+		w.header.SourceType = SourceTypeMPEGTS
+	case source.TypeMP4:
+		w.header.SourceType = SourceTypeMP4
+	case source.TypeMKV:
+		w.header.SourceType = SourceTypeMKV
 	}
 }
 
-// SetSourceFiles sets the source file list.
+// SetSourceFiles sets the source file list. If any file has chunk
+// checksums, those of the chunks the entries read are stored in a chunk
+// checksum extension record, producing V13 (or V14 with range maps).
 func (w *Writer) SetSourceFiles(files []source.File) {
 	w.sourceFiles = make([]SourceFile, len(files))
+	w.chunkSums = make([][]uint64, len(files))
 	for i, sf := range files {
 		w.sourceFiles[i] = ToSourceFile(sf)
+		w.chunkSums[i] = sf.ChunkChecksums
 	}
 	w.header.SourceFileCount = uint16(len(files))
 }
 
+// hasChunkSums reports whether any source file has chunk checksums.
+func (w *Writer) hasChunkSums() bool {
+	for _, sums := range w.chunkSums {
+		if len(sums) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // SetRangeMaps sets the range map data for V4 format.
 // When range maps are set, ES-offset entries are preserved (not converted to raw offsets)
 // and a range map section is written to the dedup file for mapping ES offsets to
@@ -79,8 +192,50 @@ func (w *Writer) SetRangeMaps(rangeMaps []RangeMapData) {
 	w.header.UsesESOffsets = 1
 }
 
+// hasFillEntries reports whether any entry is a fill entry.
+func (w *Writer) hasFillEntries() bool {
+	for _, e := range w.entries {
+		if e.IsFill {
+			return true
+		}
+	}
+	return false
+}
+
 // resolveVersion sets the final file version based on configured features.
 func (w *Writer) resolveVersion() {
+	if w.hasFillEntries() {
+		if w.rangeMaps != nil {
+			w.header.Version = VersionRangeMapFill // V16
+		} else {
+			w.header.Version = VersionFill // V15
+		}
+		return
+	}
+	if w.checksums != nil || w.hasChunkSums() || w.chunkRecord != nil || w.deltaStore != nil || w.metadata != nil {
+		if w.rangeMaps != nil {
+			w.header.Version = VersionRangeMapExtensions // V14
+		} else {
+			w.header.Version = VersionExtensions // V13
+		}
+		return
+	}
+	if w.compactIndex {
+		if w.rangeMaps != nil {
+			w.header.Version = VersionRangeMapCompactIndex // V12
+		} else {
+			w.header.Version = VersionCompactIndex // V11
+		}
+		return
+	}
+	if w.compressDelta {
+		if w.rangeMaps != nil {
+			w.header.Version = VersionRangeMapCompressed // V10
+		} else {
+			w.header.Version = VersionCompressed // V9
+		}
+		return
+	}
 	if w.rangeMaps != nil {
 		if w.creatorVersion != "" {
 			w.header.Version = VersionRangeMapUsed // V8
@@ -109,6 +264,16 @@ func (w *Writer) computeUsedFlags() {
 			}
 		}
 	}
+	// Entries for a DVD VOB set reference its first part but may read from
+	// any part, so a used set marks all of its parts.
+	for _, set := range vobSetsFor(w.header.SourceType, w.sourceFiles) {
+		if !w.sourceFiles[set[0]].Used {
+			continue
+		}
+		for _, fi := range set[1:] {
+			w.sourceFiles[fi].Used = true
+		}
+	}
 }
 
 // EncodeRangeMaps pre-encodes the range map section. Call this before
@@ -204,6 +369,7 @@ func (w *Writer) convertESToRawOffsets(entries []Entry, esConverters []source.ES
 				IsVideo:          entry.IsVideo,
 				AudioSubStreamID: entry.AudioSubStreamID,
 				IsLPCM:           entry.IsLPCM,
+				IsLPCM24:         entry.IsLPCM24,
 			})
 			mkvOffset += int64(rr.Size)
 		}
@@ -222,10 +388,23 @@ func (w *Writer) Write() error {
 
 // WriteWithProgress writes the dedup file with progress reporting.
 func (w *Writer) WriteWithProgress(progress WriteProgressFunc) error {
+	return w.WriteContext(context.Background(), progress)
+}
+
+// WriteContext is like WriteWithProgress, but stops once ctx is canceled,
+// returning its error. As after any failed write, the caller removes the
+// partly written file.
+func (w *Writer) WriteContext(ctx context.Context, progress WriteProgressFunc) error {
 	// Scan entries to compute per-source Used flags, then determine file version.
 	w.computeUsedFlags()
 	w.resolveVersion()
 
+	if w.deltaStore != nil {
+		if err := w.StoreDelta(nil); err != nil {
+			return err
+		}
+	}
+
 	// Use pre-encoded range maps if available (from EncodeRangeMaps),
 	// otherwise encode now.
 	rangeMapBuf := w.rangeMapBuf
@@ -237,11 +416,26 @@ func (w *Writer) WriteWithProgress(progress WriteProgressFunc) error {
 		}
 	}
 
+	// V13/V14: encode the extension area
+	extensionBuf, err := w.encodeExtensions(rangeMapBuf)
+	if err != nil {
+		return fmt.Errorf("encode extensions: %w", err)
+	}
+
+	// V11/V12: encode the compact index up front so its size is known
+	var compactIndexBuf []byte
+	if hasCompactIndex(w.header.Version) {
+		compactIndexBuf = encodeCompactIndex(w.entries)
+	}
+
 	// Calculate offsets and total size
 	sourceFilesSize := w.calculateSourceFilesSize()
-	cvSize := creatorVersionSize(w.creatorVersion)
+	cvSize := creatorVersionSize(w.header.Version, w.creatorVersion)
 	indexSize := int64(len(w.entries)) * EntrySize
-	deltaOffset := int64(HeaderSize) + cvSize + sourceFilesSize + indexSize
+	if compactIndexBuf != nil {
+		indexSize = int64(len(compactIndexBuf))
+	}
+	deltaOffset := int64(HeaderSize) + cvSize + sourceFilesSize + int64(len(extensionBuf)) + indexSize
 	w.header.DeltaOffset = deltaOffset
 
 	footerSize := int64(FooterSize)
@@ -252,7 +446,7 @@ func (w *Writer) WriteWithProgress(progress WriteProgressFunc) error {
 	totalSize := deltaOffset + w.header.DeltaSize + int64(len(rangeMapBuf)) + footerSize
 	var written int64
 
-	// Write header (includes creator version for V5/V6)
+	// Write header (includes creator version for V5+)
 	if err := w.writeHeader(); err != nil {
 		return fmt.Errorf("write header: %w", err)
 	}
@@ -264,14 +458,32 @@ func (w *Writer) WriteWithProgress(progress WriteProgressFunc) error {
 	}
 	written += sourceFilesSize
 
+	// Write extension area (V13/V14)
+	if extensionBuf != nil {
+		if _, err := w.file.Write(extensionBuf); err != nil {
+			return fmt.Errorf("write extensions: %w", err)
+		}
+		written += int64(len(extensionBuf))
+	}
+
 	// Write index entries and calculate checksum
-	indexChecksum, err := w.writeEntriesWithProgress(progress, &written, totalSize)
+	var indexChecksum uint64
+	if compactIndexBuf != nil {
+		indexChecksum, err = w.writeCompactIndexWithProgress(ctx, compactIndexBuf, progress, &written, totalSize)
+	} else {
+		indexChecksum, err = w.writeEntriesWithProgress(ctx, progress, &written, totalSize)
+	}
 	if err != nil {
 		return fmt.Errorf("write entries: %w", err)
 	}
 
 	// Write delta data and calculate checksum
-	deltaChecksum, err := w.writeDeltaWithProgress(progress, &written, totalSize)
+	var deltaChecksum uint64
+	if hasCompressedDelta(w.header.Version) {
+		deltaChecksum, err = w.writeCompressedDeltaWithProgress(ctx, progress, &written, totalSize)
+	} else {
+		deltaChecksum, err = w.writeDeltaWithProgress(ctx, progress, &written, totalSize)
+	}
 	if err != nil {
 		return fmt.Errorf("write delta: %w", err)
 	}
@@ -311,7 +523,7 @@ func (w *Writer) Close() error {
 
 func (w *Writer) calculateSourceFilesSize() int64 {
 	var size int64
-	hasUsed := w.header.Version == VersionUsed || w.header.Version == VersionRangeMapUsed
+	hasUsed := hasUsedFlags(w.header.Version)
 	for _, sf := range w.sourceFiles {
 		// PathLen (2) + Path (variable) + Size (8) + Checksum (8) [+ Used (1)]
 		size += 2 + int64(len(sf.RelativePath)) + 8 + 8
@@ -322,6 +534,47 @@ func (w *Writer) calculateSourceFilesSize() int64 {
 	return size
 }
 
+// encodeExtensions encodes the extension area, or returns nil for versions
+// without one. rangeMapBuf is the encoded range map section, if any.
+func (w *Writer) encodeExtensions(rangeMapBuf []byte) ([]byte, error) {
+	if !hasExtensions(w.header.Version) {
+		return nil, nil
+	}
+	var records []extensionRecord
+	if w.checksums != nil {
+		if len(w.checksums.Sources) != len(w.sourceFiles) {
+			return nil, fmt.Errorf("%d source digests for %d source files", len(w.checksums.Sources), len(w.sourceFiles))
+		}
+		data, err := w.checksums.encode()
+		if err != nil {
+			return nil, fmt.Errorf("encode checksums: %w", err)
+		}
+		records = append(records, extensionRecord{tag: ExtensionTagChecksums, data: data})
+	}
+	chunks, err := w.chunkChecksums(rangeMapBuf)
+	if err != nil {
+		return nil, fmt.Errorf("chunk checksums: %w", err)
+	}
+	if chunks != nil {
+		data, err := chunks.encode()
+		if err != nil {
+			return nil, fmt.Errorf("encode chunk checksums: %w", err)
+		}
+		records = append(records, extensionRecord{tag: ExtensionTagChunkChecksums, data: data})
+	}
+	if w.deltaStoreRef != nil {
+		data, err := w.deltaStoreRef.encode()
+		if err != nil {
+			return nil, fmt.Errorf("encode delta store record: %w", err)
+		}
+		records = append(records, extensionRecord{tag: ExtensionTagDeltaStore, data: data})
+	}
+	if w.metadata != nil {
+		records = append(records, extensionRecord{tag: ExtensionTagMetadata, data: w.metadata.encode()})
+	}
+	return encodeExtensions(records)
+}
+
 func (w *Writer) writeHeader() error {
 	// Write magic
 	if _, err := w.file.Write([]byte(Magic)); err != nil {
@@ -378,8 +631,8 @@ func (w *Writer) writeHeader() error {
 		return err
 	}
 
-	// Write creator version string (V5/V6)
-	if w.creatorVersion != "" {
+	// Write creator version string (V5+)
+	if w.header.Version >= VersionCreator {
 		versionLen := uint16(len(w.creatorVersion))
 		if err := binary.Write(w.file, binary.LittleEndian, versionLen); err != nil {
 			return err
@@ -393,7 +646,7 @@ func (w *Writer) writeHeader() error {
 }
 
 func (w *Writer) writeSourceFiles() error {
-	hasUsed := w.header.Version == VersionUsed || w.header.Version == VersionRangeMapUsed
+	hasUsed := hasUsedFlags(w.header.Version)
 	for _, sf := range w.sourceFiles {
 		// Write path length
 		pathLen := uint16(len(sf.RelativePath))
@@ -416,7 +669,7 @@ func (w *Writer) writeSourceFiles() error {
 			return err
 		}
 
-		// Write used flag (V7/V8)
+		// Write used flag (V7+)
 		if hasUsed {
 			var used uint8
 			if sf.Used {
@@ -430,7 +683,7 @@ func (w *Writer) writeSourceFiles() error {
 	return nil
 }
 
-func (w *Writer) writeEntriesWithProgress(progress WriteProgressFunc, written *int64, total int64) (uint64, error) {
+func (w *Writer) writeEntriesWithProgress(ctx context.Context, progress WriteProgressFunc, written *int64, total int64) (uint64, error) {
 	hasher := xxhash.New()
 	// Use buffered writer to batch syscalls (64KB buffer)
 	bufWriter := bufio.NewWriterSize(w.file, 64*1024)
@@ -443,21 +696,20 @@ func (w *Writer) writeEntriesWithProgress(progress WriteProgressFunc, written *i
 	var entryBuf [EntrySize]byte
 
 	for i, entry := range w.entries {
+		if i%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+
 		// Serialize entry to buffer using allocation-free Put* functions
 		binary.LittleEndian.PutUint64(entryBuf[0:8], uint64(entry.MkvOffset))
 		binary.LittleEndian.PutUint64(entryBuf[8:16], uint64(entry.Length))
 		binary.LittleEndian.PutUint16(entryBuf[16:18], entry.Source)
 		binary.LittleEndian.PutUint64(entryBuf[18:26], uint64(entry.SourceOffset))
 
-		// ES flags byte: bit 0 = IsVideo, bit 1 = IsLPCM
-		var esFlags uint8
-		if entry.IsVideo {
-			esFlags |= 1
-		}
-		if entry.IsLPCM {
-			esFlags |= 2
-		}
-		entryBuf[26] = esFlags
+		// ES flags byte: bit 0 = IsVideo, bit 1 = IsLPCM, bit 2 = IsLPCM24, bit 3 = IsFill
+		entryBuf[26] = entryFlags(entry)
 		entryBuf[27] = entry.AudioSubStreamID
 
 		// Single write per entry
@@ -485,7 +737,35 @@ func (w *Writer) writeEntriesWithProgress(progress WriteProgressFunc, written *i
 	return hasher.Sum64(), nil
 }
 
-func (w *Writer) writeDeltaWithProgress(progress WriteProgressFunc, written *int64, total int64) (uint64, error) {
+// writeCompactIndexWithProgress writes a pre-encoded compact index (V11/V12).
+func (w *Writer) writeCompactIndexWithProgress(ctx context.Context, buf []byte, progress WriteProgressFunc, written *int64, total int64) (uint64, error) {
+	const chunkSize = 64 * 1024
+	hasher := xxhash.New()
+	lastProgress := 0
+	for len(buf) > 0 {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		chunk := buf[:min(len(buf), chunkSize)]
+		buf = buf[len(chunk):]
+		if _, err := w.file.Write(chunk); err != nil {
+			return 0, err
+		}
+		hasher.Write(chunk)
+		*written += int64(len(chunk))
+
+		if progress != nil && total > 0 {
+			pct := int((*written * 100) / total)
+			if pct > lastProgress {
+				progress(*written, total)
+				lastProgress = pct
+			}
+		}
+	}
+	return hasher.Sum64(), nil
+}
+
+func (w *Writer) writeDeltaWithProgress(ctx context.Context, progress WriteProgressFunc, written *int64, total int64) (uint64, error) {
 	hasher := xxhash.New()
 	const chunkSize = 64 * 1024 // 64KB chunks
 	lastProgress := 0
@@ -499,6 +779,9 @@ func (w *Writer) writeDeltaWithProgress(progress WriteProgressFunc, written *int
 
 		buf := make([]byte, chunkSize)
 		for {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
 			n, err := f.Read(buf)
 			if n > 0 {
 				chunk := buf[:n]
@@ -527,6 +810,9 @@ func (w *Writer) writeDeltaWithProgress(progress WriteProgressFunc, written *int
 		// In-memory path (for tests / small files)
 		data := w.deltaData
 		for len(data) > 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
 			chunk := data
 			if len(chunk) > chunkSize {
 				chunk = data[:chunkSize]
@@ -552,6 +838,80 @@ func (w *Writer) writeDeltaWithProgress(progress WriteProgressFunc, written *int
 	return hasher.Sum64(), nil
 }
 
+// writeCompressedDeltaWithProgress writes the delta as compressed frames
+// (V9+). The compressed size is only known once all frames are written,
+// so the header's DeltaSize is patched afterwards. Progress counts logical
+// delta bytes.
+func (w *Writer) writeCompressedDeltaWithProgress(ctx context.Context, progress WriteProgressFunc, written *int64, total int64) (uint64, error) {
+	var src io.Reader
+	if w.deltaFile != nil {
+		f := w.deltaFile.File()
+		if _, err := f.Seek(0, 0); err != nil {
+			return 0, fmt.Errorf("seek delta file: %w", err)
+		}
+		src = f
+	} else {
+		src = bytes.NewReader(w.deltaData)
+	}
+
+	hasher := xxhash.New()
+	bufWriter := bufio.NewWriterSize(w.file, 64*1024)
+	fw, err := newDeltaFrameWriter(io.MultiWriter(bufWriter, hasher))
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, DeltaFrameSize)
+	lastProgress := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if werr := fw.writeFrame(buf[:n]); werr != nil {
+				return 0, werr
+			}
+			*written += int64(n)
+
+			if progress != nil && total > 0 {
+				pct := int((*written * 100) / total)
+				if pct > lastProgress {
+					progress(*written, total)
+					lastProgress = pct
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if fw.logicalSize != w.header.DeltaSize {
+		return 0, fmt.Errorf("delta size changed: expected %d bytes, read %d", w.header.DeltaSize, fw.logicalSize)
+	}
+
+	storedSize, err := fw.finish()
+	if err != nil {
+		return 0, err
+	}
+	if err := bufWriter.Flush(); err != nil {
+		return 0, err
+	}
+
+	// Patch DeltaSize, the last header field, with the stored size.
+	w.header.DeltaSize = storedSize
+	var sizeBuf [8]byte
+	binary.LittleEndian.PutUint64(sizeBuf[:], uint64(storedSize))
+	if _, err := w.file.WriteAt(sizeBuf[:], HeaderSize-8); err != nil {
+		return 0, fmt.Errorf("patch delta size: %w", err)
+	}
+
+	return hasher.Sum64(), nil
+}
+
 func (w *Writer) writeFooter(indexChecksum, deltaChecksum, rangeMapChecksum uint64) error {
 	// Write index checksum
 	if err := binary.Write(w.file, binary.LittleEndian, indexChecksum); err != nil {
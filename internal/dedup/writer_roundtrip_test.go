@@ -2,6 +2,8 @@ package dedup
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stuckj/mkvdup/internal/matcher"
@@ -231,6 +233,9 @@ func TestWriter_RoundTrip_SourceTypes(t *testing.T) {
 	}{
 		{"DVD", source.TypeDVD, SourceTypeDVD},
 		{"Bluray", source.TypeBluray, SourceTypeBluray},
+		{"MPEGTS", source.TypeMPEGTS, SourceTypeMPEGTS},
+		{"MP4", source.TypeMP4, SourceTypeMP4},
+		{"MKV", source.TypeMKV, SourceTypeMKV},
 	}
 
 	for _, tt := range tests {
@@ -551,3 +556,65 @@ func TestWriter_RoundTrip_CreatorVersion_V7(t *testing.T) {
 		t.Errorf("version = %d, want %d (V7)", got, VersionUsed)
 	}
 }
+
+func TestWriter_RoundTrip_FillEntries(t *testing.T) {
+	dir := t.TempDir()
+	srcData := bytes.Repeat([]byte("source bytes "), 100)
+	if err := os.WriteFile(filepath.Join(dir, "source.vob"), srcData, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	delta := []byte("EBML header and other unmatched bytes")
+	want := append([]byte(nil), delta[:20]...)
+	want = append(want, make([]byte, 3000)...)
+	want = append(want, srcData[:500]...)
+	want = append(want, bytes.Repeat([]byte{0xEC, 0x01, 0x02}, 700)...)
+	want = append(want, delta[20:]...)
+	entries := []matcher.Entry{
+		{MkvOffset: 0, Length: 20, SourceOffset: 0},
+		matcher.NewFillEntry(20, 3000, []byte{0}),
+		{MkvOffset: 3020, Length: 500, Source: 1},
+		matcher.NewFillEntry(3520, 2100, []byte{0xEC, 0x01, 0x02}),
+		{MkvOffset: 5620, Length: int64(len(delta) - 20), SourceOffset: 20},
+	}
+
+	path := writeTestDedupFile(t, dir, writeTestOptions{
+		originalSize: int64(len(want)),
+		sourceType:   source.TypeDVD,
+		sourceFiles:  []source.File{{RelativePath: "source.vob", Size: int64(len(srcData))}},
+		result:       &matcher.Result{Entries: entries, DeltaData: delta},
+	})
+
+	r, err := NewReader(path, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	if v := r.Version(); v != VersionFill {
+		t.Errorf("version = %d, want %d", v, VersionFill)
+	}
+	if err := r.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	if d := r.FindDamage(); !d.OK() {
+		t.Errorf("FindDamage = %+v, want no damage", d)
+	}
+	for i, e := range entries {
+		if got, ok := r.GetEntry(i); !ok || got != FromMatcherEntry(e) {
+			t.Errorf("GetEntry(%d) = %+v, %v; want %+v", i, got, ok, e)
+		}
+	}
+
+	// Reads starting and ending mid-pattern, within and across entries.
+	for _, rg := range [][2]int{{0, len(want)}, {3521, 3522}, {3530, 5630}, {15, 3100}, {3700, 3707}} {
+		buf := make([]byte, rg[1]-rg[0])
+		if n, err := r.ReadAt(buf, int64(rg[0])); err != nil || n != len(buf) {
+			t.Fatalf("ReadAt(%d, %d) = %d, %v", rg[0], len(buf), n, err)
+		}
+		if !bytes.Equal(buf, want[rg[0]:rg[1]]) {
+			t.Errorf("ReadAt(%d, %d) returned different data", rg[0], len(buf))
+		}
+	}
+}
@@ -2,6 +2,8 @@ package dedup
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync/atomic"
@@ -20,6 +22,12 @@ type writeTestOptions struct {
 	result           *matcher.Result
 	esConverters     []source.ESRangeConverter
 	creatorVersion   string
+	compressDelta    bool
+	compactIndex     bool
+	checksums        *ExtendedChecksums
+	chunkSize        int64
+	deltaStore       *DeltaStore
+	metadata         *Metadata
 }
 
 // writeTestDedupFile creates a dedup file using the Writer API and returns the path.
@@ -36,6 +44,18 @@ func writeTestDedupFile(t *testing.T, dir string, opts writeTestOptions) string
 	if opts.creatorVersion != "" {
 		w.SetCreatorVersion(opts.creatorVersion)
 	}
+	w.SetDeltaCompression(opts.compressDelta)
+	w.SetCompactIndex(opts.compactIndex)
+	if opts.checksums != nil {
+		w.SetExtendedChecksums(opts.checksums)
+	}
+	w.SetChunkSize(opts.chunkSize)
+	if opts.deltaStore != nil {
+		w.SetDeltaStore(opts.deltaStore)
+	}
+	if opts.metadata != nil {
+		w.SetMetadata(opts.metadata)
+	}
 	if len(opts.sourceFiles) > 0 {
 		w.SetSourceFiles(opts.sourceFiles)
 	}
@@ -155,6 +175,47 @@ func TestWriter_WriteWithProgress(t *testing.T) {
 	}
 }
 
+func TestWriter_WriteContext_Canceled(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compressed=%v", compress), func(t *testing.T) {
+			w, err := NewWriter(filepath.Join(t.TempDir(), "test.mkvdup"))
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			defer w.Close()
+
+			const size = 4 * DeltaFrameSize
+			w.SetHeader(size, 0xFFFF, source.TypeDVD)
+			w.SetDeltaCompression(compress)
+			result := &matcher.Result{
+				Entries:        []matcher.Entry{{MkvOffset: 0, Length: size}},
+				DeltaData:      bytes.Repeat([]byte{0xAA}, size),
+				UnmatchedBytes: size,
+			}
+			if err := w.SetMatchResult(result, nil); err != nil {
+				t.Fatalf("SetMatchResult: %v", err)
+			}
+
+			// Canceled once the delta is being written
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var finished bool
+			err = w.WriteContext(ctx, func(written, total int64) {
+				if written > size/2 {
+					cancel()
+				}
+				finished = written == total
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("WriteContext = %v, want %v", err, context.Canceled)
+			}
+			if finished {
+				t.Error("canceled write reported finishing")
+			}
+		})
+	}
+}
+
 func TestWriter_Close_Idempotent(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "test.mkvdup")
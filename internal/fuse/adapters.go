@@ -12,6 +12,8 @@ import (
 
 // Ensure adapters implement interfaces
 var _ ReaderInitializer = (*dedupReaderAdapter)(nil)
+var _ badChunkSetter = (*dedupReaderAdapter)(nil)
+var _ metadataProvider = (*dedupReaderAdapter)(nil)
 var _ ReaderFactory = (*DefaultReaderFactory)(nil)
 var _ ConfigReader = (*DefaultConfigReader)(nil)
 
@@ -69,16 +71,28 @@ func (a *dedupReaderAdapter) InitializeForReading(sourceDir string) error {
 func (a *dedupReaderAdapter) SourceFileInfo() []SourceFileInfo {
 	sourceFiles := a.reader.SourceFiles()
 	hasUsedFlags := a.reader.HasSourceUsedFlags()
+	checksums := a.reader.ExtendedChecksums()
+	chunks := a.reader.ChunkChecksums()
 	var infos []SourceFileInfo
-	for _, sf := range sourceFiles {
+	for i, sf := range sourceFiles {
 		if hasUsedFlags && !sf.Used {
 			continue
 		}
-		infos = append(infos, SourceFileInfo{
+		info := SourceFileInfo{
+			Index:        i,
 			RelativePath: sf.RelativePath,
 			Size:         sf.Size,
 			Checksum:     sf.Checksum,
-		})
+		}
+		if checksums != nil {
+			info.Digest = checksums.Sources[i]
+			info.DigestAlg = checksums.Algorithm
+		}
+		if chunks != nil {
+			info.ChunkSize = chunks.ChunkSize
+			info.Chunks = chunks.Files[i]
+		}
+		infos = append(infos, info)
 	}
 	return infos
 }
@@ -87,6 +101,14 @@ func (a *dedupReaderAdapter) ReadAt(p []byte, off int64) (n int, err error) {
 	return a.reader.ReadAt(p, off)
 }
 
+func (a *dedupReaderAdapter) SetBadChunks(bad map[int][]int64) error {
+	return a.reader.SetBadChunks(bad)
+}
+
+func (a *dedupReaderAdapter) Metadata() *dedup.Metadata {
+	return a.reader.Metadata()
+}
+
 func (a *dedupReaderAdapter) Close() error {
 	var errs []error
 	if err := a.reader.Close(); err != nil {
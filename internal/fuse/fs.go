@@ -36,6 +36,16 @@ type MKVFile struct {
 	// When true, Open/Read return EIO. Reset to false on reload.
 	disabled bool
 
+	// badChunks maps source file indexes to chunks that failed checksum
+	// verification. Reads that touch them return EIO while the rest of the
+	// file stays readable. Applied to each new reader; reset on reload.
+	badChunks map[int][]int64
+
+	// metadata is the JSON description of the original MKV exposed as the
+	// MetadataXattr attribute, read with the dedup file header. Nil if the
+	// dedup file has none.
+	metadata []byte
+
 	// derivedMtime caches the virtual file's modification time, derived from
 	// the dedup (.mkvdup) file's mtime. Computed lazily on first stat and
 	// refreshed by the source watcher when the dedup file changes. Guarded by mu.
@@ -193,6 +203,8 @@ var _ fs.NodeOpener = (*MKVFSNode)(nil)
 var _ fs.NodeReader = (*MKVFSNode)(nil)
 var _ fs.NodeGetattrer = (*MKVFSNode)(nil)
 var _ fs.NodeSetattrer = (*MKVFSNode)(nil)
+var _ fs.NodeGetxattrer = (*MKVFSNode)(nil)
+var _ fs.NodeListxattrer = (*MKVFSNode)(nil)
 var _ fs.NodeSetattrer = (*MKVFSDirNode)(nil)
 
 // getFilePerms returns file permissions from the store, or defaults if store is nil.
@@ -117,6 +117,7 @@ func NewMKVFSWithFactories(configPaths []string, verbose bool, readerFactory Rea
 			DedupPath:     dedupPath,
 			SourceDir:     sourceDir,
 			Size:          reader.OriginalSize(),
+			metadata:      readerMetadata(reader),
 			readerFactory: root.readerFactory,
 		}
 
@@ -210,6 +211,7 @@ func readConfigHeaders(configs []dedup.Config, readerFactory ReaderFactory, verb
 				DedupPath:     config.DedupFile,
 				SourceDir:     config.SourceDir,
 				Size:          reader.OriginalSize(),
+				metadata:      readerMetadata(reader),
 				readerFactory: readerFactory,
 			}
 			reader.Close()
@@ -260,6 +262,7 @@ func readConfigHeaders(configs []dedup.Config, readerFactory ReaderFactory, verb
 					DedupPath:     cfg.DedupFile,
 					SourceDir:     cfg.SourceDir,
 					Size:          reader.OriginalSize(),
+					metadata:      readerMetadata(reader),
 					readerFactory: readerFactory,
 				}
 				reader.Close()
@@ -2,12 +2,15 @@ package fuse
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"path/filepath"
 	"syscall"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stuckj/mkvdup/internal/dedup"
 )
 
 // Getattr implements fs.NodeGetattrer - returns file attributes.
@@ -211,6 +214,55 @@ func (n *MKVFSNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off
 	return fuse.ReadResultData(dest[:nRead]), 0
 }
 
+// MetadataXattr is the extended attribute holding a JSON description of the
+// original MKV (title, duration, chapter count and tracks), for virtual files
+// whose dedup file records one.
+const MetadataXattr = "user.mkvdup.metadata"
+
+// Getxattr implements fs.NodeGetxattrer. It exposes the .mkvdup file behind
+// a virtual file, so that create can record it as a chained source instead of
+// a path inside the mount, and the description of the original MKV.
+func (n *MKVFSNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	var value string
+	switch attr {
+	case dedup.VirtualFileXattr:
+		n.file.mu.RLock()
+		value = n.file.DedupPath
+		n.file.mu.RUnlock()
+		// Relative paths would resolve against the reader's working directory
+		if abs, err := filepath.Abs(value); err == nil {
+			value = abs
+		}
+	case MetadataXattr:
+		n.file.mu.RLock()
+		value = string(n.file.metadata)
+		n.file.mu.RUnlock()
+		if value == "" {
+			return 0, fs.ENOATTR
+		}
+	default:
+		return 0, fs.ENOATTR
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
+
+// Listxattr implements fs.NodeListxattrer.
+func (n *MKVFSNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	names := dedup.VirtualFileXattr + "\x00"
+	n.file.mu.RLock()
+	if n.file.metadata != nil {
+		names += MetadataXattr + "\x00"
+	}
+	n.file.mu.RUnlock()
+	if len(dest) < len(names) {
+		return uint32(len(names)), syscall.ERANGE
+	}
+	return uint32(copy(dest, names)), 0
+}
+
 // ensureReader ensures the dedup reader is initialized.
 func (n *MKVFSNode) ensureReader() error {
 	n.file.mu.Lock()
@@ -231,11 +283,44 @@ func (n *MKVFSNode) ensureReader() error {
 		reader.Close()
 		return fmt.Errorf("initialize reader: %w", err)
 	}
+	if len(n.file.badChunks) > 0 {
+		if err := applyBadChunks(reader, n.file.badChunks); err != nil {
+			reader.Close()
+			return fmt.Errorf("mark bad source chunks: %w", err)
+		}
+	}
 
 	n.file.reader = reader
 	return nil
 }
 
+// readerMetadata returns the JSON description of the original MKV from
+// reader, or nil if it has none.
+func readerMetadata(reader DedupReader) []byte {
+	p, ok := reader.(metadataProvider)
+	if !ok {
+		return nil
+	}
+	m := p.Metadata()
+	if m == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// applyBadChunks passes bad chunk marks to reader.
+func applyBadChunks(reader DedupReader, bad map[int][]int64) error {
+	setter, ok := reader.(badChunkSetter)
+	if !ok {
+		return fmt.Errorf("reader cannot fail reads of individual chunks")
+	}
+	return setter.SetBadChunks(bad)
+}
+
 // Disable marks the file as disabled (source changed). Subsequent reads
 // return EIO. Closes any active reader. Thread-safe.
 func (f *MKVFile) Disable() {
@@ -257,6 +342,32 @@ func (f *MKVFile) Enable() {
 	f.disabled = false
 }
 
+// SetBadChunks records the chunks of a source file that failed checksum
+// verification, replacing earlier marks for that source. Reads touching them
+// return EIO; empty chunks clears the marks. If the reader cannot restrict
+// failures to those reads, the file is disabled instead. Thread-safe.
+func (f *MKVFile) SetBadChunks(sourceIndex int, chunks []int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(chunks) == 0 {
+		delete(f.badChunks, sourceIndex)
+	} else {
+		if f.badChunks == nil {
+			f.badChunks = make(map[int][]int64)
+		}
+		f.badChunks[sourceIndex] = chunks
+	}
+	if f.reader == nil {
+		return // Applied when the reader is next initialized
+	}
+	if err := applyBadChunks(f.reader, f.badChunks); err != nil {
+		log.Printf("%s: %v — disabling", f.Name, err)
+		f.disabled = true
+		f.reader.Close()
+		f.reader = nil
+	}
+}
+
 // Close cleans up the file's resources.
 func (f *MKVFile) Close() {
 	f.mu.Lock()
@@ -277,13 +388,19 @@ func (f *MKVFile) updateFrom(src *MKVFile) {
 		f.reader.Close()
 		f.reader = nil
 	}
+	if f.reader != nil && len(f.badChunks) > 0 {
+		// Only a reader that accepted the marks can hold them
+		applyBadChunks(f.reader, nil)
+	}
 	f.Name = src.Name
 	f.DedupPath = src.DedupPath
 	f.SourceDir = src.SourceDir
 	f.Size = src.Size
+	f.metadata = src.metadata
 	f.readerFactory = src.readerFactory
-	// Reset disabled flag — reload re-validates source files
+	// Reset disabled flag and bad chunks — reload re-validates source files
 	f.disabled = false
+	f.badChunks = nil
 	// Invalidate the cached derived mtime so it's re-derived from the (possibly
 	// changed) dedup file on the next stat.
 	f.derivedSet = false
@@ -2,11 +2,14 @@ package fuse
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"syscall"
 	"testing"
 
+	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stuckj/mkvdup/internal/dedup"
 )
 
 func TestMKVFSNode_Getattr(t *testing.T) {
@@ -30,6 +33,76 @@ func TestMKVFSNode_Getattr(t *testing.T) {
 	}
 }
 
+func TestMKVFSNode_Getxattr(t *testing.T) {
+	node := &MKVFSNode{file: &MKVFile{Name: "movie.mkv", DedupPath: "/data/movie.mkvdup"}}
+	ctx := context.Background()
+
+	// Size probe with an empty buffer
+	n, errno := node.Getxattr(ctx, dedup.VirtualFileXattr, nil)
+	if errno != syscall.ERANGE || n != uint32(len("/data/movie.mkvdup")) {
+		t.Errorf("Getxattr(nil) = (%d, %v), want (%d, ERANGE)", n, errno, len("/data/movie.mkvdup"))
+	}
+
+	buf := make([]byte, 64)
+	n, errno = node.Getxattr(ctx, dedup.VirtualFileXattr, buf)
+	if errno != 0 || string(buf[:n]) != "/data/movie.mkvdup" {
+		t.Errorf("Getxattr() = (%q, %v), want the dedup path", buf[:n], errno)
+	}
+
+	if _, errno := node.Getxattr(ctx, "user.other", buf); errno != fs.ENOATTR {
+		t.Errorf("Getxattr(user.other) errno = %v, want ENOATTR", errno)
+	}
+}
+
+func TestMKVFSNode_MetadataXattr(t *testing.T) {
+	factory := &mockReaderFactory{
+		readers: map[string]*mockReader{
+			"/data/m1.dedup": {originalSize: 100, metadata: &dedup.Metadata{
+				Title:    "Movie",
+				Chapters: 12,
+				Tracks:   []dedup.TrackMetadata{{Number: 1, Type: "video", CodecID: "V_MPEG2", Language: "eng", Default: true}},
+			}},
+			"/data/m2.dedup": {originalSize: 200},
+		},
+	}
+	root, err := NewMKVFSFromConfigs([]dedup.Config{
+		{Name: "movie1.mkv", DedupFile: "/data/m1.dedup", SourceDir: "/src"},
+		{Name: "movie2.mkv", DedupFile: "/data/m2.dedup", SourceDir: "/src"},
+	}, false, factory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	buf := make([]byte, 1024)
+
+	node := &MKVFSNode{file: root.files["movie1.mkv"]}
+	n, errno := node.Getxattr(ctx, MetadataXattr, buf)
+	if errno != 0 {
+		t.Fatalf("Getxattr(metadata) errno = %v", errno)
+	}
+	var got dedup.Metadata
+	if err := json.Unmarshal(buf[:n], &got); err != nil {
+		t.Fatalf("metadata xattr is not JSON: %v (%q)", err, buf[:n])
+	}
+	if got.Title != "Movie" || got.Chapters != 12 || len(got.Tracks) != 1 || got.Tracks[0].CodecID != "V_MPEG2" {
+		t.Errorf("metadata xattr = %+v", got)
+	}
+	n, _ = node.Listxattr(ctx, buf)
+	if want := dedup.VirtualFileXattr + "\x00" + MetadataXattr + "\x00"; string(buf[:n]) != want {
+		t.Errorf("Listxattr() = %q, want %q", buf[:n], want)
+	}
+
+	// Dedup files without metadata don't have the attribute.
+	node = &MKVFSNode{file: root.files["movie2.mkv"]}
+	if _, errno := node.Getxattr(ctx, MetadataXattr, buf); errno != fs.ENOATTR {
+		t.Errorf("Getxattr(metadata) without metadata errno = %v, want ENOATTR", errno)
+	}
+	n, _ = node.Listxattr(ctx, buf)
+	if want := dedup.VirtualFileXattr + "\x00"; string(buf[:n]) != want {
+		t.Errorf("Listxattr() = %q, want %q", buf[:n], want)
+	}
+}
+
 func TestMKVFSNode_Read(t *testing.T) {
 	testData := []byte("Hello, FUSE filesystem!")
 	mockRdr := &mockReader{
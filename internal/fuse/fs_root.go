@@ -143,6 +143,7 @@ func (r *MKVFSRoot) Reload(configs []dedup.Config, logFn func(string, ...interfa
 				DedupPath:     config.DedupFile,
 				SourceDir:     config.SourceDir,
 				Size:          reader.OriginalSize(),
+				metadata:      readerMetadata(reader),
 				readerFactory: r.readerFactory,
 			}}
 			reader.Close()
@@ -172,6 +173,7 @@ func (r *MKVFSRoot) Reload(configs []dedup.Config, logFn func(string, ...interfa
 						DedupPath:     cfg.DedupFile,
 						SourceDir:     cfg.SourceDir,
 						Size:          reader.OriginalSize(),
+						metadata:      readerMetadata(reader),
 						readerFactory: r.readerFactory,
 					}}
 					reader.Close()
@@ -3,6 +3,8 @@ package fuse
 import (
 	"errors"
 	"io"
+
+	"github.com/stuckj/mkvdup/internal/dedup"
 )
 
 // mockReader implements ReaderInitializer for testing.
@@ -12,6 +14,7 @@ type mockReader struct {
 	usesESOffsets bool
 	initErr       error
 	readErr       error
+	metadata      *dedup.Metadata
 	closed        bool
 }
 
@@ -45,6 +48,10 @@ func (m *mockReader) SourceFileInfo() []SourceFileInfo {
 	return nil
 }
 
+func (m *mockReader) Metadata() *dedup.Metadata {
+	return m.metadata
+}
+
 func (m *mockReader) Close() error {
 	m.closed = true
 	return nil
@@ -1,6 +1,8 @@
 // Package fuse provides a FUSE filesystem for accessing deduplicated MKV files.
 package fuse
 
+import "github.com/stuckj/mkvdup/internal/dedup"
+
 // DedupReader is an interface for reading deduplicated MKV files.
 // This allows mocking the dedup.Reader in tests.
 type DedupReader interface {
@@ -17,9 +19,14 @@ type DedupReader interface {
 // SourceFileInfo contains metadata about a source file referenced by a dedup file.
 // This is read from the dedup file header (available without full reader initialization).
 type SourceFileInfo struct {
-	RelativePath string // Path relative to source directory
-	Size         int64  // Expected file size
-	Checksum     uint64 // Expected xxhash checksum
+	Index        int              // Index of the source file in the dedup file
+	RelativePath string           // Path relative to source directory
+	Size         int64            // Expected file size
+	Checksum     uint64           // Expected xxhash checksum
+	Digest       []byte           // Expected extended checksum (nil if the dedup file has none)
+	DigestAlg    string           // Algorithm of Digest, e.g. "sha256"
+	ChunkSize    int64            // Size of the chunks in Chunks (0 if the dedup file has none)
+	Chunks       dedup.FileChunks // Checksums of the chunks the dedup file reads
 }
 
 // ReaderInitializer is an interface for initializing readers with source data.
@@ -40,6 +47,22 @@ type ReaderInitializer interface {
 	SourceFileInfo() []SourceFileInfo
 }
 
+// badChunkSetter is implemented by readers that can fail just the reads
+// touching corrupt source chunks instead of the whole file.
+type badChunkSetter interface {
+	// SetBadChunks marks chunks as corrupt, keyed by source file index.
+	// An empty map clears the marks.
+	SetBadChunks(bad map[int][]int64) error
+}
+
+// metadataProvider is implemented by readers that can describe the original
+// MKV from the dedup file header.
+type metadataProvider interface {
+	// Metadata returns the description of the original MKV, or nil if the
+	// dedup file has none.
+	Metadata() *dedup.Metadata
+}
+
 // ReaderFactory creates DedupReader instances.
 // This allows mocking reader creation in tests.
 type ReaderFactory interface {
@@ -16,7 +16,7 @@ import (
 type ErrorEvent struct {
 	SourcePath    string   // absolute path of the changed source file
 	AffectedFiles []string // virtual file names affected
-	Event         string   // "changed", "missing", "size_changed", "checksum_mismatch", "read_error", "checksum_queue_full"
+	Event         string   // "changed", "missing", "size_changed", "checksum_mismatch", "chunk_mismatch", "read_error", "checksum_queue_full"
 }
 
 // ErrorNotifier batches integrity error events and executes an external
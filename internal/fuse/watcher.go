@@ -1,10 +1,14 @@
 package fuse
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,6 +16,7 @@ import (
 	"github.com/cespare/xxhash/v2"
 	"github.com/fsnotify/fsnotify"
 	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/source"
 )
 
 // Default poll interval for network filesystems where inotify doesn't work.
@@ -21,9 +26,27 @@ const defaultPollInterval = 60 * time.Second
 type checksumRequest struct {
 	absPath          string
 	expectedChecksum uint64
+	expectedDigest   sourceDigest
 	expectedSize     int64
 	affected         []*MKVFile
-	gen              uint64 // generation stamp; stale requests are skipped
+	chunks           []chunkRef // chunk checksums of the affected files that have them
+	gen              uint64     // generation stamp; stale requests are skipped
+}
+
+// chunkRef is the chunk checksum table a virtual file's dedup file holds
+// for one of its source files.
+type chunkRef struct {
+	file      *MKVFile
+	index     int // Source file index in the dedup file
+	chunkSize int64
+	chunks    dedup.FileChunks
+}
+
+// sourceDigest is the expected extended (cryptographic) checksum of a
+// source file. A nil sum means the dedup file has none.
+type sourceDigest struct {
+	algorithm string
+	sum       []byte
 }
 
 // SourceWatcher monitors source files for changes and takes action when
@@ -38,6 +61,14 @@ type SourceWatcher struct {
 	// checksums maps absolute source file paths to expected xxhash values.
 	checksums map[string]uint64
 
+	// digests maps absolute source file paths to expected extended
+	// checksums, for dedup files created with them.
+	digests map[string]sourceDigest
+
+	// chunks maps absolute source file paths to the chunk checksum tables
+	// of the dedup files that have them.
+	chunks map[string][]chunkRef
+
 	// sizes maps absolute source file paths to expected file sizes.
 	sizes map[string]int64
 
@@ -116,6 +147,8 @@ func NewSourceWatcher(action string, pollInterval time.Duration, onErrorCommand
 		watcher:         watcher,
 		reverse:         make(map[string][]*MKVFile),
 		checksums:       make(map[string]uint64),
+		digests:         make(map[string]sourceDigest),
+		chunks:          make(map[string][]chunkRef),
 		sizes:           make(map[string]int64),
 		pollFiles:       make(map[string]time.Time),
 		dedupReverse:    make(map[string][]*MKVFile),
@@ -153,6 +186,8 @@ func (sw *SourceWatcher) Update(files map[string]*MKVFile, readerFactory ReaderF
 	// I/O (reading dedup headers) that should not block event handling.
 	newReverse := make(map[string][]*MKVFile)
 	newChecksums := make(map[string]uint64)
+	newDigests := make(map[string]sourceDigest)
+	newChunks := make(map[string][]chunkRef)
 	newSizes := make(map[string]int64)
 	watchDirs := make(map[string]bool)
 	newDedupReverse := make(map[string][]*MKVFile)
@@ -186,6 +221,14 @@ func (sw *SourceWatcher) Update(files map[string]*MKVFile, readerFactory ReaderF
 			}
 			newReverse[absPath] = append(newReverse[absPath], file)
 			newChecksums[absPath] = sf.Checksum
+			if sf.Digest != nil {
+				newDigests[absPath] = sourceDigest{algorithm: sf.DigestAlg, sum: sf.Digest}
+			}
+			if sf.ChunkSize > 0 {
+				newChunks[absPath] = append(newChunks[absPath], chunkRef{
+					file: file, index: sf.Index, chunkSize: sf.ChunkSize, chunks: sf.Chunks,
+				})
+			}
 			newSizes[absPath] = sf.Size
 			watchDirs[filepath.Dir(absPath)] = true
 		}
@@ -209,6 +252,8 @@ drain:
 
 	sw.reverse = newReverse
 	sw.checksums = newChecksums
+	sw.digests = newDigests
+	sw.chunks = newChunks
 	sw.sizes = newSizes
 	sw.pollFiles = make(map[string]time.Time)
 	sw.dedupReverse = newDedupReverse
@@ -560,8 +605,10 @@ func (sw *SourceWatcher) handleChangeLocked(absPath string) {
 		case sw.checksumCh <- checksumRequest{
 			absPath:          absPath,
 			expectedChecksum: sw.checksums[absPath],
+			expectedDigest:   sw.digests[absPath],
 			expectedSize:     expectedSize,
 			affected:         affectedCopy,
+			chunks:           sw.chunks[absPath],
 			gen:              sw.updateGen,
 		}:
 			sw.checksumPending[absPath] = true
@@ -596,7 +643,7 @@ func (sw *SourceWatcher) checksumWorker() {
 			if stale {
 				continue // Config was reloaded; skip stale request
 			}
-			sw.verifyChecksum(req.absPath, req.expectedChecksum, req.expectedSize, req.affected, req.gen)
+			sw.verifyChecksum(req)
 		case <-sw.stopCh:
 			return
 		}
@@ -606,26 +653,38 @@ func (sw *SourceWatcher) checksumWorker() {
 // verifyChecksum re-hashes a source file in the background. Files remain
 // accessible during verification. If the checksum mismatches, affected
 // virtual files are disabled (recoverable via SIGHUP reload or a
-// subsequent successful checksum). The gen parameter is checked before
-// disabling or enabling so that a reload during verification prevents
-// stale results from affecting files in the new configuration.
-func (sw *SourceWatcher) verifyChecksum(absPath string, expectedChecksum uint64, expectedSize int64, affected []*MKVFile, gen uint64) {
-	names := make([]string, len(affected))
-	for i, f := range affected {
-		names[i] = f.Name
-	}
-
-	// disableIfCurrent disables affected files only if the watcher
-	// generation hasn't changed (i.e., no reload occurred during verification).
-	disableIfCurrent := func() {
+// subsequent successful checksum). When the dedup file carries an extended
+// checksum for the source, it is computed in the same pass and must match
+// too.
+//
+// Virtual files whose dedup file has chunk checksums for the source only
+// depend on the chunks listed there: reads touching a bad chunk fail and the
+// rest of the file stays readable. When every affected file has them, only
+// those chunks are read.
+//
+// The request's generation is checked before disabling or enabling so that
+// a reload during verification prevents stale results from affecting files
+// in the new configuration.
+func (sw *SourceWatcher) verifyChecksum(req checksumRequest) {
+	absPath, affected := req.absPath, req.affected
+	names := fileNames(affected)
+
+	// current reports whether no reload occurred during verification,
+	// logging the skipped action if one did.
+	current := func(action string) bool {
 		sw.mu.RLock()
-		stale := gen != sw.updateGen
+		stale := req.gen != sw.updateGen
 		sw.mu.RUnlock()
 		if stale {
-			sw.logFn("source-watch: checksum: skipping disable for %s (config reloaded during verification)", absPath)
+			sw.logFn("source-watch: checksum: skipping %s for %s (config reloaded during verification)", action, absPath)
+		}
+		return !stale
+	}
+	disableIfCurrent := func(files []*MKVFile) {
+		if !current("disable") {
 			return
 		}
-		for _, f := range affected {
+		for _, f := range files {
 			f.Disable()
 		}
 	}
@@ -634,79 +693,213 @@ func (sw *SourceWatcher) verifyChecksum(absPath string, expectedChecksum uint64,
 	info, err := os.Stat(absPath)
 	if err != nil {
 		sw.logFn("source-watch: checksum: cannot stat %s: %v — disabling %v", absPath, err, names)
-		disableIfCurrent()
+		disableIfCurrent(affected)
 		sw.notify(absPath, "missing", names)
 		return
 	}
-	if info.Size() != expectedSize {
+	if info.Size() != req.expectedSize {
 		sw.logFn("source-watch: checksum: size changed for %s (%d → %d) — disabling %v",
-			absPath, expectedSize, info.Size(), names)
-		disableIfCurrent()
+			absPath, req.expectedSize, info.Size(), names)
+		disableIfCurrent(affected)
 		sw.notify(absPath, "size_changed", names)
 		return
 	}
 
-	// Full xxhash checksum
 	f, err := os.Open(absPath)
 	if err != nil {
 		sw.logFn("source-watch: checksum: cannot open %s: %v — disabling %v", absPath, err, names)
-		disableIfCurrent()
+		disableIfCurrent(affected)
 		sw.notify(absPath, "missing", names)
 		return
 	}
 	defer f.Close()
 
-	h := xxhash.New()
+	// Files without chunk checksums need the whole-file checksum
+	chunked := make(map[*MKVFile]bool)
+	for _, ref := range req.chunks {
+		chunked[ref.file] = true
+	}
+	var whole []*MKVFile
+	for _, file := range affected {
+		if !chunked[file] {
+			whole = append(whole, file)
+		}
+	}
+
+	badChunks := make([][]int64, len(req.chunks))
+	wholeOK := true
+	if len(whole) == 0 {
+		// Read only the chunks the dedup files use
+		r := stopReaderAt{r: f, stopCh: sw.stopCh}
+		for i, ref := range req.chunks {
+			badChunks[i], err = ref.chunks.Verify(r, ref.chunkSize, req.expectedSize, nil)
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		// Full xxhash checksum, plus the extended checksum if the dedup file
+		// has one and the chunk checksums of the files that have them
+		h := xxhash.New()
+		writers := []io.Writer{h}
+		var digest hash.Hash
+		if req.expectedDigest.sum != nil {
+			digest, err = dedup.NewChecksumHash(req.expectedDigest.algorithm)
+			if err != nil {
+				sw.logFn("source-watch: checksum: %v — verifying %s with xxhash only", err, absPath)
+			} else {
+				writers = append(writers, digest)
+			}
+		}
+		hashers := make(map[int64]*source.ChunkHasher)
+		for _, ref := range req.chunks {
+			if hashers[ref.chunkSize] == nil {
+				hashers[ref.chunkSize] = source.NewChunkHasher(ref.chunkSize)
+				writers = append(writers, hashers[ref.chunkSize])
+			}
+		}
+
+		err = sw.hashFile(f, io.MultiWriter(writers...))
+		if err == nil {
+			for i, ref := range req.chunks {
+				badChunks[i] = ref.chunks.Mismatches(hashers[ref.chunkSize].ChunkSums())
+			}
+			if actual := h.Sum64(); actual != req.expectedChecksum {
+				sw.logFn("source-watch: checksum mismatch for %s (got %016x, expected %016x) — disabling %v",
+					absPath, actual, req.expectedChecksum, fileNames(whole))
+				wholeOK = false
+			} else if digest != nil {
+				if actual := digest.Sum(nil); !bytes.Equal(actual, req.expectedDigest.sum) {
+					sw.logFn("source-watch: %s checksum mismatch for %s (got %x, expected %x) — disabling %v",
+						req.expectedDigest.algorithm, absPath, actual, req.expectedDigest.sum, fileNames(whole))
+					wholeOK = false
+				}
+			}
+		}
+	}
+	if errors.Is(err, errWatcherStopped) {
+		return
+	}
+	if err != nil {
+		sw.logFn("source-watch: checksum: read error for %s: %v — disabling %v", absPath, err, names)
+		disableIfCurrent(affected)
+		sw.notify(absPath, "read_error", names)
+		return
+	}
+
+	if len(whole) > 0 {
+		if !wholeOK {
+			disableIfCurrent(whole)
+			sw.notify(absPath, "checksum_mismatch", fileNames(whole))
+		} else if current("re-enable") {
+			// Re-enable affected files so transient issues (e.g., network
+			// glitches) auto-recover without requiring admin SIGHUP.
+			//
+			// NOTE: a virtual file can depend on multiple source files. A
+			// passing checksum for one source could re-enable a file whose
+			// other source is still bad. This is a known limitation; the
+			// common case (single source per MKV) is handled correctly, and
+			// SIGHUP is available as a fallback for multi-source edge cases.
+			sw.logFn("source-watch: checksum verified OK for %s — re-enabling %v", absPath, fileNames(whole))
+			for _, file := range whole {
+				file.Enable()
+			}
+		}
+	}
+
+	if len(req.chunks) == 0 || !current("chunk update") {
+		return
+	}
+	var badNames []string
+	for i, ref := range req.chunks {
+		// Enable first: marking the chunks disables the file again if its
+		// reader cannot fail individual reads.
+		ref.file.Enable()
+		ref.file.SetBadChunks(ref.index, badChunks[i])
+		if len(badChunks[i]) > 0 {
+			sw.logFn("source-watch: checksum: %d corrupt %d-byte chunk(s) in %s (%s) — failing reads of them in %s",
+				len(badChunks[i]), ref.chunkSize, absPath, chunkList(badChunks[i]), ref.file.Name)
+			badNames = append(badNames, ref.file.Name)
+		}
+	}
+	if len(badNames) > 0 {
+		sw.notify(absPath, "chunk_mismatch", badNames)
+		return
+	}
+	chunkedNames := make([]string, 0, len(chunked))
+	for _, file := range affected {
+		if chunked[file] {
+			chunkedNames = append(chunkedNames, file.Name)
+		}
+	}
+	if !wholeOK {
+		sw.logFn("source-watch: checksum: the chunks of %s used by %v are intact — leaving them enabled", absPath, chunkedNames)
+	} else {
+		sw.logFn("source-watch: checksum verified OK for %s — re-enabling %v", absPath, chunkedNames)
+	}
+}
+
+// errWatcherStopped aborts verification when the watcher is stopped.
+var errWatcherStopped = errors.New("source watcher stopped")
+
+// hashFile writes the contents of f to w, stopping early if the watcher is
+// stopped so that large-file hashing doesn't block Stop() indefinitely.
+func (sw *SourceWatcher) hashFile(f *os.File, w io.Writer) error {
 	buf := make([]byte, 1<<20) // 1MB buffer
 	for {
-		// Check for shutdown between reads so large-file hashing
-		// doesn't block Stop() indefinitely.
 		select {
 		case <-sw.stopCh:
-			return
+			return errWatcherStopped
 		default:
 		}
 
-		n, readErr := f.Read(buf)
+		n, err := f.Read(buf)
 		if n > 0 {
-			h.Write(buf[:n])
+			w.Write(buf[:n])
 		}
-		if readErr != nil {
-			if readErr != io.EOF {
-				sw.logFn("source-watch: checksum: read error for %s: %v — disabling %v", absPath, readErr, names)
-				disableIfCurrent()
-				sw.notify(absPath, "read_error", names)
-				return
-			}
-			break
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 	}
-	actualChecksum := h.Sum64()
+}
 
-	if actualChecksum != expectedChecksum {
-		sw.logFn("source-watch: checksum mismatch for %s (got %016x, expected %016x) — disabling %v",
-			absPath, actualChecksum, expectedChecksum, names)
-		disableIfCurrent()
-		sw.notify(absPath, "checksum_mismatch", names)
-	} else {
-		// Re-enable affected files so transient issues (e.g., network
-		// glitches) auto-recover without requiring admin SIGHUP.
-		//
-		// NOTE: a virtual file can depend on multiple source files. A
-		// passing checksum for one source could re-enable a file whose
-		// other source is still bad. This is a known limitation; the
-		// common case (single source per MKV) is handled correctly, and
-		// SIGHUP is available as a fallback for multi-source edge cases.
-		sw.mu.RLock()
-		stale := gen != sw.updateGen
-		sw.mu.RUnlock()
-		if stale {
-			sw.logFn("source-watch: checksum: skipping re-enable for %s (config reloaded during verification)", absPath)
-			return
-		}
-		sw.logFn("source-watch: checksum verified OK for %s — re-enabling %v", absPath, names)
-		for _, f := range affected {
-			f.Enable()
+// stopReaderAt is an io.ReaderAt that fails once the watcher is stopped.
+type stopReaderAt struct {
+	r      io.ReaderAt
+	stopCh chan struct{}
+}
+
+func (s stopReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	select {
+	case <-s.stopCh:
+		return 0, errWatcherStopped
+	default:
+	}
+	return s.r.ReadAt(p, off)
+}
+
+// fileNames returns the names of files.
+func fileNames(files []*MKVFile) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// chunkList formats chunk indexes for a log message, eliding long lists.
+func chunkList(chunks []int64) string {
+	const maxShown = 8
+	parts := make([]string, 0, maxShown+1)
+	for i, c := range chunks {
+		if i == maxShown {
+			parts = append(parts, fmt.Sprintf("and %d more", len(chunks)-maxShown))
+			break
 		}
+		parts = append(parts, strconv.FormatInt(c, 10))
 	}
+	return "chunks " + strings.Join(parts, ", ")
 }
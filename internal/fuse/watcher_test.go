@@ -11,6 +11,7 @@ import (
 
 	"github.com/cespare/xxhash/v2"
 	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/source"
 )
 
 // mockReaderWithSources extends mockReader with SourceFileInfo support.
@@ -271,6 +272,146 @@ func TestSourceWatcher_ChecksumAction_SizeMatch_ChecksumMismatch(t *testing.T) {
 	}
 }
 
+func TestSourceWatcher_ChecksumAction_DigestMismatch(t *testing.T) {
+	sw, lc := newTestWatcher(t, "checksum")
+
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "source.vob")
+	content := []byte("source file content with an extended checksum")
+	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+
+	file := &MKVFile{Name: "movie.mkv"}
+
+	sw.mu.Lock()
+	sw.reverse[tmpFile] = []*MKVFile{file}
+	// Correct xxhash, but a WRONG sha256 digest.
+	sw.checksums[tmpFile] = xxhash.Sum64(content)
+	sw.digests[tmpFile] = sourceDigest{algorithm: dedup.ChecksumSHA256, sum: make([]byte, 32)}
+	sw.sizes[tmpFile] = int64(len(content))
+	sw.handleChangeLocked(tmpFile)
+	sw.mu.Unlock()
+
+	sw.wg.Add(1)
+	go sw.checksumWorker()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if lc.contains(t, "sha256 checksum mismatch") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(sw.stopCh)
+	sw.wg.Wait()
+
+	if !lc.contains(t, "sha256 checksum mismatch") {
+		t.Fatal("timed out waiting for sha256 checksum mismatch detection")
+	}
+	if !isDisabled(file) {
+		t.Error("file should be disabled when the extended checksum mismatches")
+	}
+}
+
+// waitForLog polls lc until it has a message containing substr, then stops
+// the watcher's workers.
+func waitForLog(t *testing.T, sw *SourceWatcher, lc *logCapture, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && !lc.contains(t, substr) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(sw.stopCh)
+	sw.wg.Wait()
+	if !lc.contains(t, substr) {
+		t.Fatalf("timed out waiting for log containing %q", substr)
+	}
+}
+
+func TestSourceWatcher_ChecksumAction_ChunkMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "source.vob")
+	content := make([]byte, 40)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	h := source.NewChunkHasher(16)
+	h.Write(content)
+	sums := h.ChunkSums()
+
+	// Chunk 1 is not used by the dedup file, chunk 2 is
+	corrupt := append([]byte(nil), content...)
+	corrupt[20] ^= 0xFF
+	corrupt[36] ^= 0xFF
+	if err := os.WriteFile(tmpFile, corrupt, 0644); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+
+	t.Run("chunked only", func(t *testing.T) {
+		sw, lc := newTestWatcher(t, "checksum")
+		file := &MKVFile{Name: "movie.mkv"}
+		sw.mu.Lock()
+		sw.reverse[tmpFile] = []*MKVFile{file}
+		sw.checksums[tmpFile] = xxhash.Sum64(content)
+		sw.sizes[tmpFile] = int64(len(content))
+		sw.chunks[tmpFile] = []chunkRef{{
+			file: file, index: 1, chunkSize: 16,
+			chunks: dedup.FileChunks{Chunks: []int64{0, 2}, Sums: []uint64{sums[0], sums[2]}},
+		}}
+		sw.handleChangeLocked(tmpFile)
+		sw.mu.Unlock()
+
+		sw.wg.Add(1)
+		go sw.checksumWorker()
+		waitForLog(t, sw, lc, "corrupt 16-byte chunk(s)")
+
+		if isDisabled(file) {
+			t.Error("file should stay enabled when only some chunks are corrupt")
+		}
+		file.mu.RLock()
+		bad := file.badChunks[1]
+		file.mu.RUnlock()
+		if len(bad) != 1 || bad[0] != 2 {
+			t.Errorf("bad chunks = %v, want [2]", bad)
+		}
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		sw, lc := newTestWatcher(t, "checksum")
+		chunked := &MKVFile{Name: "movie.mkv"}
+		whole := &MKVFile{Name: "extras.mkv"}
+		sw.mu.Lock()
+		sw.reverse[tmpFile] = []*MKVFile{chunked, whole}
+		sw.checksums[tmpFile] = xxhash.Sum64(content)
+		sw.sizes[tmpFile] = int64(len(content))
+		// Only the unused chunk 1 is corrupt for the chunked file
+		sw.chunks[tmpFile] = []chunkRef{{
+			file: chunked, index: 0, chunkSize: 16,
+			chunks: dedup.FileChunks{Chunks: []int64{0}, Sums: []uint64{sums[0]}},
+		}}
+		sw.handleChangeLocked(tmpFile)
+		sw.mu.Unlock()
+
+		sw.wg.Add(1)
+		go sw.checksumWorker()
+		waitForLog(t, sw, lc, "intact")
+
+		if !isDisabled(whole) {
+			t.Error("file without chunk checksums should be disabled on a checksum mismatch")
+		}
+		if isDisabled(chunked) {
+			t.Error("file whose chunks are intact should stay enabled")
+		}
+		chunked.mu.RLock()
+		defer chunked.mu.RUnlock()
+		if len(chunked.badChunks) != 0 {
+			t.Errorf("bad chunks = %v, want none", chunked.badChunks)
+		}
+	})
+}
+
 func TestSourceWatcher_ChecksumAction_FileMissing(t *testing.T) {
 	sw, lc := newTestWatcher(t, "checksum")
 
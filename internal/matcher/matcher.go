@@ -2,6 +2,7 @@
 package matcher
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -41,36 +42,10 @@ const (
 
 // detectNALLengthSize determines the NAL unit length field size from an MKV track's
 // codec ID and codec private data. Returns 0 for Annex B (start code) formats,
-// or the length field size (1, 2, or 4) for AVCC/HVCC formats.
+// or the length field size (1, 2, or 4) for AVCC/HVCC formats. The source
+// indexer uses the same rule for MKV sources, so both sides agree on NAL starts.
 func detectNALLengthSize(codecID string, codecPrivate []byte) int {
-	switch codecID {
-	case "V_MPEG4/ISO/AVC":
-		// AVCC format: CodecPrivate is AVCDecoderConfigurationRecord
-		// Byte 4 bits 0-1 = NAL length size - 1
-		if len(codecPrivate) >= 7 && codecPrivate[0] == 1 {
-			return int(codecPrivate[4]&0x03) + 1
-		}
-		return 4 // Default for AVC if CodecPrivate is missing or malformed
-	case "V_MPEGH/ISO/HEVC":
-		// HVCC format: CodecPrivate is HEVCDecoderConfigurationRecord
-		// Byte 0 = configurationVersion (must be 1)
-		// Byte 21 bits 6-7 = reserved (must be 111111)
-		// Byte 21 bits 0-1 = NAL length size - 1
-		if len(codecPrivate) >= 23 && codecPrivate[0] == 1 {
-			b := codecPrivate[21]
-			// Upper 6 bits must be all 1s per ISO/IEC 23008-2
-			if b&0xFC == 0xFC {
-				size := int(b&0x03) + 1
-				// Valid NAL length sizes are 1, 2, or 4 bytes
-				if size == 1 || size == 2 || size == 4 {
-					return size
-				}
-			}
-		}
-		return 4 // Default for HEVC if CodecPrivate is missing or malformed
-	default:
-		return 0 // Annex B format (MPEG-2, etc.)
-	}
+	return source.MKVNALLengthSize(codecID, codecPrivate)
 }
 
 // NALLengthSizeForTrack returns the NAL length size for a track, suitable for
@@ -87,7 +62,7 @@ type matchedRegion struct {
 	srcOffset        int64 // File offset or ES offset depending on source type
 	isVideo          bool  // For ES-based sources
 	audioSubStreamID byte  // For audio in MPEG-PS
-	isLPCM           bool  // True if this is an LPCM audio region requiring inverse transform
+	lpcmSampleSize   int   // Sample size (2 or 3) of an LPCM audio region requiring inverse transform; 0 otherwise
 }
 
 // Matcher performs the deduplication matching.
@@ -123,9 +98,12 @@ type Matcher struct {
 	trackCodecs    map[int]trackCodecInfo // Map from track number to codec info
 	numWorkers     int                    // Number of worker goroutines for parallel matching
 	verboseWriter  io.Writer              // Destination for diagnostic output (nil = disabled)
+	checkpoint     *Checkpoint            // Records the progress of Match (nil = none)
 	isAVCTrack     map[int]bool           // Per-track: whether this track uses H.264 NAL types
 	isPCMTrack     map[int]bool           // Per-track: whether this track uses PCM audio (A_PCM/*)
 	isTrueHDTrack  map[int]bool           // Per-track: whether this track uses TrueHD audio (A_TRUEHD)
+	isVobSubTrack  map[int]bool           // Per-track: whether this track uses DVD subpictures (S_VOBSUB)
+	isVC1Track     map[int]bool           // Per-track: whether this track is VC-1 video (frame start codes stripped)
 	// Coverage bitmap for O(1) coverage checks. Each bit represents a chunk.
 	// A chunk is marked covered when a matched region fully contains it.
 	coveredChunks []uint64 // Bitmap: bit i = chunk i is covered
@@ -201,6 +179,8 @@ func NewMatcher(sourceIndex *source.Index) (*Matcher, error) {
 		isAVCTrack:    make(map[int]bool),
 		isPCMTrack:    make(map[int]bool),
 		isTrueHDTrack: make(map[int]bool),
+		isVobSubTrack: make(map[int]bool),
+		isVC1Track:    make(map[int]bool),
 		numWorkers:    numWorkers,
 	}, nil
 }
@@ -219,6 +199,15 @@ func (m *Matcher) SetNumWorkers(n int) {
 	m.numWorkers = n
 }
 
+// SetCheckpoint makes Match record its progress in cp, and resume the
+// match cp recorded: the batches of packets it holds are not matched
+// again, and the result of a finished match is returned as it was. cp
+// must have been opened with the CheckpointKey of the MKV and this
+// Matcher's index. Pass nil to match without a checkpoint.
+func (m *Matcher) SetCheckpoint(cp *Checkpoint) {
+	m.checkpoint = cp
+}
+
 // Close releases resources.
 func (m *Matcher) Close() error {
 	if m.mkvMmap != nil {
@@ -232,6 +221,27 @@ type ProgressFunc func(processedPackets, totalPackets int)
 
 // Match processes an MKV file and matches packets to the source.
 func (m *Matcher) Match(mkvPath string, packets []mkv.Packet, tracks []mkv.Track, progress ProgressFunc) (*Result, error) {
+	return m.MatchContext(context.Background(), mkvPath, packets, tracks, progress)
+}
+
+// MatchContext is like Match, but stops once ctx is canceled, returning its
+// error. The workers finish the batch of packets they are matching first,
+// and with a checkpoint, the batches matched so far are recorded for the
+// match to be resumed.
+func (m *Matcher) MatchContext(ctx context.Context, mkvPath string, packets []mkv.Packet, tracks []mkv.Track, progress ProgressFunc) (*Result, error) {
+	if m.checkpoint != nil {
+		if result := m.checkpoint.takeResult(); result != nil {
+			if result.TotalPackets != len(packets) {
+				result.Close()
+				return nil, ErrCheckpointMismatch
+			}
+			if progress != nil {
+				progress(len(packets), len(packets))
+			}
+			return result, nil
+		}
+	}
+
 	// Memory-map the MKV file for zero-copy access
 	info, err := os.Stat(mkvPath)
 	if err != nil {
@@ -245,12 +255,53 @@ func (m *Matcher) Match(mkvPath string, packets []mkv.Packet, tracks []mkv.Track
 	}
 	m.mkvData = m.mkvMmap.Data() // Store reference for zero-copy access
 
-	// Reset per-run state in case Match() is called multiple times
+	m.reset(tracks)
+
+	result := &Result{
+		TotalPackets: len(packets),
+	}
+	result.MatchedPackets, err = m.matchRegions(ctx, packets, m.checkpoint, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress != nil {
+		progress(len(packets), len(packets))
+	}
+
+	m.printDiagnostics()
+
+	// Fill TrueHD gaps using adjacent matched regions
+	m.fillTrueHDGaps(packets)
+
+	// Merge overlapping regions and build final entries
+	m.mergeRegions()
+	var buildErr error
+	result.Entries, result.DeltaFile, buildErr = m.buildEntries()
+	if buildErr != nil {
+		return nil, fmt.Errorf("build entries: %w", buildErr)
+	}
+	result.countBytes()
+
+	if m.checkpoint != nil {
+		if err := m.checkpoint.recordResult(result); err != nil {
+			result.Close()
+			return nil, fmt.Errorf("record checkpoint: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// reset clears the per-run state and sets up the track maps for tracks, in
+// case the Matcher is used more than once.
+func (m *Matcher) reset(tracks []mkv.Track) {
 	m.trackTypes = make(map[int]int)
 	m.trackCodecs = make(map[int]trackCodecInfo)
 	m.isAVCTrack = make(map[int]bool)
 	m.isPCMTrack = make(map[int]bool)
 	m.isTrueHDTrack = make(map[int]bool)
+	m.isVobSubTrack = make(map[int]bool)
+	m.isVC1Track = make(map[int]bool)
 	m.diagVideoPacketsTotal.Store(0)
 	m.diagVideoNALsTotal.Store(0)
 	m.diagVideoNALsTooSmall.Store(0)
@@ -297,8 +348,27 @@ func (m *Matcher) Match(mkvPath string, packets []mkv.Packet, tracks []mkv.Track
 		if t.Type == mkv.TrackTypeAudio && t.CodecID == "A_TRUEHD" {
 			m.isTrueHDTrack[int(t.Number)] = true
 		}
+		if t.Type == mkv.TrackTypeSubtitle && t.CodecID == "S_VOBSUB" {
+			m.isVobSubTrack[int(t.Number)] = true
+		}
+		if t.Type == mkv.TrackTypeVideo && source.MKVTrackCodecType(t.CodecID, t.CodecPrivate) == source.CodecVC1Video {
+			m.isVC1Track[int(t.Number)] = true
+		}
 	}
 
+	// Pre-sort source locations by offset to enable binary search for
+	// locality-aware matching. One-time cost before concurrent access.
+	m.sourceIndex.SortLocationsByOffset()
+
+	// Set appropriate madvise hints for matching access patterns.
+	m.sourceIndex.AdviseForMatching()
+}
+
+// matchRegions matches packets against m.mkvData, collecting the matched
+// regions, and returns the number of packets matched. With a checkpoint
+// cp, the batches it recorded are restored rather than matched, and those
+// matched are recorded.
+func (m *Matcher) matchRegions(ctx context.Context, packets []mkv.Packet, cp *Checkpoint, progress ProgressFunc) (int, error) {
 	// Reset matched regions with pre-allocated capacity
 	// Most packets will match, so estimate capacity as number of packets
 	m.matchedRegions = make([]matchedRegion, 0, len(packets))
@@ -308,17 +378,6 @@ func (m *Matcher) Match(mkvPath string, packets []mkv.Packet, tracks []mkv.Track
 	numChunks := (m.mkvSize + coverageChunkSize - 1) / coverageChunkSize
 	m.coveredChunks = make([]uint64, (numChunks+63)/64)
 
-	// Pre-sort source locations by offset to enable binary search for
-	// locality-aware matching. One-time cost before concurrent access.
-	m.sourceIndex.SortLocationsByOffset()
-
-	// Set appropriate madvise hints for matching access patterns.
-	m.sourceIndex.AdviseForMatching()
-
-	result := &Result{
-		TotalPackets: len(packets),
-	}
-
 	// Sort a copy by track number so the caller's slice is not mutated.
 	// matchParallel builds batches that never cross track boundaries,
 	// so each batch contains consecutive same-track packets with a
@@ -330,99 +389,76 @@ func (m *Matcher) Match(mkvPath string, packets []mkv.Packet, tracks []mkv.Track
 	})
 
 	// Use parallel processing with deterministic batched workers
-	result.MatchedPackets = m.matchParallel(sortedPackets, progress)
+	return m.matchParallel(ctx, sortedPackets, cp, progress)
+}
 
-	if progress != nil {
-		progress(len(packets), len(packets))
+// printDiagnostics prints the diagnostic summary of a run (verbose only).
+func (m *Matcher) printDiagnostics() {
+	if m.verboseWriter == nil {
+		return
 	}
-
-	// Print diagnostic summary (verbose only)
-	if m.verboseWriter != nil {
-		w := m.verboseWriter
-		fmt.Fprintf(w, "\n=== Video Matching Diagnostics ===\n")
-		fmt.Fprintf(w, "Video packets total:        %d\n", m.diagVideoPacketsTotal.Load())
-		fmt.Fprintf(w, "Video NALs total:           %d\n", m.diagVideoNALsTotal.Load())
-		fmt.Fprintf(w, "Video NALs too small:       %d\n", m.diagVideoNALsTooSmall.Load())
-		fmt.Fprintf(w, "Video NALs hash not found:  %d\n", m.diagVideoNALsHashNotFound.Load())
-		fmt.Fprintf(w, "Video NALs verify failed:   %d\n", m.diagVideoNALsVerifyFailed.Load())
-		fmt.Fprintf(w, "Video NALs all skipped:     %d\n", m.diagVideoNALsAllSkipped.Load())
-		fmt.Fprintf(w, "Video NALs matched:         %d\n", m.diagVideoNALsMatched.Load())
-		fmt.Fprintf(w, "Video NALs matched bytes:   %d (%.2f MB)\n",
-			m.diagVideoNALsMatchedBytes.Load(), float64(m.diagVideoNALsMatchedBytes.Load())/(1024*1024))
-		fmt.Fprintf(w, "Video NALs isVideo skips:   %d\n", m.diagVideoNALsSkippedIsVideo.Load())
-		if len(m.isAVCTrack) > 0 {
-			fmt.Fprintf(w, "\nPer-NAL-type breakdown (H.264, type: total / matched / not_found / miss%%):\n")
-			nalTypeNames := map[byte]string{
-				1: "non-IDR slice", 2: "slice A", 3: "slice B", 4: "slice C",
-				5: "IDR slice", 6: "SEI", 7: "SPS", 8: "PPS", 9: "AUD", 12: "filler",
-			}
-			for i := 0; i < 32; i++ {
-				total := m.diagNALTypeTotal[i].Load()
-				if total == 0 {
-					continue
-				}
-				matched := m.diagNALTypeMatched[i].Load()
-				notFound := m.diagNALTypeNotFound[i].Load()
-				name := nalTypeNames[byte(i)]
-				if name == "" {
-					name = "other"
-				}
-				fmt.Fprintf(w, "  type %2d (%14s): %8d / %8d / %8d (%.1f%% miss)\n",
-					i, name, total, matched, notFound, float64(notFound)/float64(total)*100)
-			}
+	w := m.verboseWriter
+	fmt.Fprintf(w, "\n=== Video Matching Diagnostics ===\n")
+	fmt.Fprintf(w, "Video packets total:        %d\n", m.diagVideoPacketsTotal.Load())
+	fmt.Fprintf(w, "Video NALs total:           %d\n", m.diagVideoNALsTotal.Load())
+	fmt.Fprintf(w, "Video NALs too small:       %d\n", m.diagVideoNALsTooSmall.Load())
+	fmt.Fprintf(w, "Video NALs hash not found:  %d\n", m.diagVideoNALsHashNotFound.Load())
+	fmt.Fprintf(w, "Video NALs verify failed:   %d\n", m.diagVideoNALsVerifyFailed.Load())
+	fmt.Fprintf(w, "Video NALs all skipped:     %d\n", m.diagVideoNALsAllSkipped.Load())
+	fmt.Fprintf(w, "Video NALs matched:         %d\n", m.diagVideoNALsMatched.Load())
+	fmt.Fprintf(w, "Video NALs matched bytes:   %d (%.2f MB)\n",
+		m.diagVideoNALsMatchedBytes.Load(), float64(m.diagVideoNALsMatchedBytes.Load())/(1024*1024))
+	fmt.Fprintf(w, "Video NALs isVideo skips:   %d\n", m.diagVideoNALsSkippedIsVideo.Load())
+	if len(m.isAVCTrack) > 0 {
+		fmt.Fprintf(w, "\nPer-NAL-type breakdown (H.264, type: total / matched / not_found / miss%%):\n")
+		nalTypeNames := map[byte]string{
+			1: "non-IDR slice", 2: "slice A", 3: "slice B", 4: "slice C",
+			5: "IDR slice", 6: "SEI", 7: "SPS", 8: "PPS", 9: "AUD", 12: "filler",
 		}
-		// NAL size bucket breakdown
-		nalSizeBucketNames := [5]string{"<64B", "64-127B", "128B-1KB", "1KB-32KB", "32KB+"}
-		fmt.Fprintf(w, "\nVideo NAL size distribution (matched / unmatched):\n")
-		for i := 0; i < 5; i++ {
-			matched := m.diagNALSizeMatched[i].Load()
-			unmatched := m.diagNALSizeUnmatched[i].Load()
-			if matched > 0 || unmatched > 0 {
-				fmt.Fprintf(w, "  %9s: %8d matched, %8d unmatched\n",
-					nalSizeBucketNames[i], matched, unmatched)
+		for i := 0; i < 32; i++ {
+			total := m.diagNALTypeTotal[i].Load()
+			if total == 0 {
+				continue
 			}
+			matched := m.diagNALTypeMatched[i].Load()
+			notFound := m.diagNALTypeNotFound[i].Load()
+			name := nalTypeNames[byte(i)]
+			if name == "" {
+				name = "other"
+			}
+			fmt.Fprintf(w, "  type %2d (%14s): %8d / %8d / %8d (%.1f%% miss)\n",
+				i, name, total, matched, notFound, float64(notFound)/float64(total)*100)
 		}
-
-		fmt.Fprintf(w, "\nTotal match attempts: %d\n", m.diagTotalSyncPoints.Load())
-		fmt.Fprintf(w, "Phase 1 skips (Phase 2 avoided): %d\n", m.diagPhase1Skips.Load())
-		fmt.Fprintf(w, "Phase 2 full-search fallbacks: %d\n", m.diagPhase2Fallbacks.Load())
-		fmt.Fprintf(w, "Phase 2 total locations checked: %d\n", m.diagPhase2Locations.Load())
-		fmt.Fprintf(w, "Phase 2 early exits: %d\n", m.diagPhase2EarlyExits.Load())
-		fmt.Fprintf(w, "Phase 2 capped (hit %d limit): %d\n", phase2MaxVerifyAttempts, m.diagPhase2Capped.Load())
-
-		fmt.Fprintf(w, "\nLocality recovery:\n")
-		fmt.Fprintf(w, "  Attempts:  %d\n", m.diagLocalityAttempts.Load())
-		fmt.Fprintf(w, "  Matched:   %d\n", m.diagLocalityMatched.Load())
-		fmt.Fprintf(w, "  Bytes:     %d\n", m.diagLocalityMatchedBytes.Load())
-
-		fmt.Fprintf(w, "\nFirst hash-not-found examples:\n")
-		for _, ex := range m.diagExamplesOutput {
-			fmt.Fprintf(w, "%s\n", ex)
-		}
-		fmt.Fprintf(w, "=================================\n")
 	}
-
-	// Fill TrueHD gaps using adjacent matched regions
-	m.fillTrueHDGaps(packets)
-
-	// Merge overlapping regions and build final entries
-	m.mergeRegions()
-	var buildErr error
-	result.Entries, result.DeltaFile, buildErr = m.buildEntries()
-	if buildErr != nil {
-		return nil, fmt.Errorf("build entries: %w", buildErr)
-	}
-
-	// Calculate statistics
-	for _, e := range result.Entries {
-		if e.Source == 0 {
-			result.UnmatchedBytes += e.Length
-		} else {
-			result.MatchedBytes += e.Length
+	// NAL size bucket breakdown
+	nalSizeBucketNames := [5]string{"<64B", "64-127B", "128B-1KB", "1KB-32KB", "32KB+"}
+	fmt.Fprintf(w, "\nVideo NAL size distribution (matched / unmatched):\n")
+	for i := 0; i < 5; i++ {
+		matched := m.diagNALSizeMatched[i].Load()
+		unmatched := m.diagNALSizeUnmatched[i].Load()
+		if matched > 0 || unmatched > 0 {
+			fmt.Fprintf(w, "  %9s: %8d matched, %8d unmatched\n",
+				nalSizeBucketNames[i], matched, unmatched)
 		}
 	}
 
-	return result, nil
+	fmt.Fprintf(w, "\nTotal match attempts: %d\n", m.diagTotalSyncPoints.Load())
+	fmt.Fprintf(w, "Phase 1 skips (Phase 2 avoided): %d\n", m.diagPhase1Skips.Load())
+	fmt.Fprintf(w, "Phase 2 full-search fallbacks: %d\n", m.diagPhase2Fallbacks.Load())
+	fmt.Fprintf(w, "Phase 2 total locations checked: %d\n", m.diagPhase2Locations.Load())
+	fmt.Fprintf(w, "Phase 2 early exits: %d\n", m.diagPhase2EarlyExits.Load())
+	fmt.Fprintf(w, "Phase 2 capped (hit %d limit): %d\n", phase2MaxVerifyAttempts, m.diagPhase2Capped.Load())
+
+	fmt.Fprintf(w, "\nLocality recovery:\n")
+	fmt.Fprintf(w, "  Attempts:  %d\n", m.diagLocalityAttempts.Load())
+	fmt.Fprintf(w, "  Matched:   %d\n", m.diagLocalityMatched.Load())
+	fmt.Fprintf(w, "  Bytes:     %d\n", m.diagLocalityMatchedBytes.Load())
+
+	fmt.Fprintf(w, "\nFirst hash-not-found examples:\n")
+	for _, ex := range m.diagExamplesOutput {
+		fmt.Fprintf(w, "%s\n", ex)
+	}
+	fmt.Fprintf(w, "=================================\n")
 }
 
 // ProbeHash represents a hash computed from a sync point in packet data.
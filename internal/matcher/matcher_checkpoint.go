@@ -0,0 +1,415 @@
+package matcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/mkv"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// checkpointMagic starts every checkpoint file.
+const checkpointMagic = "MKVDUPCP"
+
+// checkpointVersion is the version of the checkpoint file format. It is
+// also raised whenever matching changes what a batch of packets matches,
+// so that a checkpoint written by an older build is not resumed.
+const checkpointVersion = 1
+
+// checkpointHeaderSize is the size of the magic, version and key.
+const checkpointHeaderSize = len(checkpointMagic) + 4 + 8
+
+// checkpointSyncInterval is how often a checkpoint is synced to disk while
+// batches are recorded, bounding the work a crash or reboot loses.
+const checkpointSyncInterval = 10 * time.Second
+
+// Record types of a checkpoint file. Each record is its type, the length
+// of its payload (8 bytes), the payload and the xxhash of type and payload.
+const (
+	checkpointBatch  = 'B' // The matched regions of one batch of packets
+	checkpointResult = 'R' // The entries of the finished match, followed by its delta
+)
+
+// ErrCheckpointMismatch reports a checkpoint of another match than the
+// one to resume: of another MKV or source, or written by another version.
+var ErrCheckpointMismatch = errors.New("checkpoint is of another match")
+
+// Checkpoint records the progress of a match in a file, so that a match
+// stopped by cancellation, a crash or a reboot can be resumed instead of
+// started over. It holds the matched regions of each batch of packets
+// matched so far and, once the match is finished, its entries and delta.
+//
+// A checkpoint is keyed by the MKV and the source index matched (see
+// CheckpointKey). Every record carries a checksum, so a record left half
+// written when the process died is dropped when the checkpoint is resumed.
+type Checkpoint struct {
+	path     string
+	file     *os.File
+	w        *bufio.Writer
+	mu       sync.Mutex
+	err      error // First error writing a record
+	lastSync time.Time
+	batches  map[int]*checkpointBatchRecord // Batches recorded before resuming, by index
+	result   *Result                        // Result recorded before resuming, until Match takes it
+}
+
+// checkpointBatchRecord is a batch of packets recorded by a checkpoint,
+// with what processBatch produced for it.
+type checkpointBatchRecord struct {
+	start   int    // Index of the batch's first packet
+	matched []bool // Whether each packet of the batch matched
+	edge    batchEdgeInfo
+	regions []matchedRegion
+}
+
+// CheckpointKey returns the key of a checkpoint of matching the MKV of the
+// given size and checksum against index. It covers the source files and
+// what was indexed of them, so a checkpoint is not resumed against another
+// MKV or index.
+func CheckpointKey(mkvSize int64, mkvChecksum uint64, index *source.Index) uint64 {
+	var b []byte
+	b = binary.AppendUvarint(b, checkpointVersion)
+	b = binary.AppendUvarint(b, batchSize)
+	b = binary.AppendVarint(b, mkvSize)
+	b = binary.LittleEndian.AppendUint64(b, mkvChecksum)
+	b = binary.AppendUvarint(b, uint64(index.WindowSize))
+	b = appendBool(b, index.UsesESOffsets)
+	b = binary.AppendUvarint(b, uint64(index.HashCount()))
+	b = binary.AppendUvarint(b, uint64(index.LocationCount()))
+	b = binary.AppendUvarint(b, uint64(len(index.Files)))
+	for _, f := range index.Files {
+		b = binary.AppendUvarint(b, uint64(len(f.RelativePath)))
+		b = append(b, f.RelativePath...)
+		b = binary.AppendVarint(b, f.Size)
+		b = binary.LittleEndian.AppendUint64(b, f.Checksum)
+	}
+	b = binary.AppendUvarint(b, uint64(len(index.SkippedStreams)))
+	for _, s := range index.SkippedStreams {
+		b = binary.AppendUvarint(b, uint64(s.FileIndex))
+		b = appendBool(b, s.IsVideo)
+		b = append(b, s.SubStreamID)
+	}
+	return xxhash.Sum64(b)
+}
+
+// CreateCheckpoint starts a new checkpoint at path, replacing any file
+// there.
+func CreateCheckpoint(path string, key uint64) (*Checkpoint, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create checkpoint: %w", err)
+	}
+	cp := newCheckpoint(path, f)
+	header := make([]byte, 0, checkpointHeaderSize)
+	header = append(header, checkpointMagic...)
+	header = binary.LittleEndian.AppendUint32(header, checkpointVersion)
+	header = binary.LittleEndian.AppendUint64(header, key)
+	cp.w.Write(header)
+	if err := cp.sync(); err != nil {
+		cp.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("write checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// ResumeCheckpoint opens the checkpoint at path to resume the match it
+// records, and to record the rest of it. Without a checkpoint at path, or
+// with one cut off before its first record, a new one is started. A
+// checkpoint with another key is left alone, and ErrCheckpointMismatch
+// returned.
+func ResumeCheckpoint(path string, key uint64) (*Checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return CreateCheckpoint(path, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint: %w", err)
+	}
+	header := make([]byte, checkpointHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:len(checkpointMagic)]) != checkpointMagic {
+		f.Close()
+		return CreateCheckpoint(path, key)
+	}
+	rest := header[len(checkpointMagic):]
+	if binary.LittleEndian.Uint32(rest) != checkpointVersion || binary.LittleEndian.Uint64(rest[4:]) != key {
+		f.Close()
+		return nil, ErrCheckpointMismatch
+	}
+
+	cp := newCheckpoint(path, f)
+	end, err := cp.load()
+	if err == nil {
+		// Records after the last intact one are written over
+		if err = f.Truncate(end); err == nil {
+			_, err = f.Seek(end, io.SeekStart)
+		}
+	}
+	if err != nil {
+		cp.Close()
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+func newCheckpoint(path string, f *os.File) *Checkpoint {
+	return &Checkpoint{
+		path:    path,
+		file:    f,
+		w:       bufio.NewWriterSize(f, 256*1024),
+		batches: make(map[int]*checkpointBatchRecord),
+	}
+}
+
+// load reads the records of the checkpoint from just past its header, and
+// returns the offset past the last intact one.
+func (cp *Checkpoint) load() (int64, error) {
+	info, err := cp.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := int64(checkpointHeaderSize)
+	r := bufio.NewReaderSize(cp.file, 256*1024)
+	for {
+		typ, payload, ok := readCheckpointRecord(r, info.Size()-end)
+		if !ok {
+			return end, nil
+		}
+		size := int64(1+8+len(payload)) + 8
+		switch typ {
+		case checkpointBatch:
+			idx, rec, err := decodeCheckpointBatch(payload)
+			if err != nil {
+				return end, nil
+			}
+			cp.batches[idx] = rec
+		case checkpointResult:
+			result, deltaSize, err := decodeCheckpointResult(payload)
+			if err != nil {
+				return end, nil
+			}
+			if result.DeltaFile, err = NewDeltaWriter(); err != nil {
+				return 0, err
+			}
+			if !copyCheckpointDelta(result.DeltaFile, r, deltaSize) {
+				result.Close()
+				return end, nil
+			}
+			size += deltaSize + 8
+			result.countBytes()
+			cp.result = result
+		default:
+			return end, nil
+		}
+		end += size
+	}
+}
+
+// readCheckpointRecord reads the next record, of at most limit bytes, and
+// reports whether it is intact.
+func readCheckpointRecord(r io.Reader, limit int64) (byte, []byte, bool) {
+	var head [9]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, false
+	}
+	n := binary.LittleEndian.Uint64(head[1:])
+	if n > uint64(limit) {
+		return 0, nil, false
+	}
+	buf := make([]byte, n+8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, false
+	}
+	payload := buf[:n]
+	h := xxhash.New()
+	h.Write(head[:1])
+	h.Write(payload)
+	if h.Sum64() != binary.LittleEndian.Uint64(buf[n:]) {
+		return 0, nil, false
+	}
+	return head[0], payload, true
+}
+
+// copyCheckpointDelta copies the delta of a result record, followed by its
+// xxhash, from r to dw, and reports whether it is intact.
+func copyCheckpointDelta(dw *DeltaWriter, r io.Reader, size int64) bool {
+	h := xxhash.New()
+	buf := make([]byte, 1024*1024)
+	for size > 0 {
+		n, err := io.ReadFull(r, buf[:min(int64(len(buf)), size)])
+		if err != nil {
+			return false
+		}
+		h.Write(buf[:n])
+		if err := dw.Write(buf[:n]); err != nil {
+			return false
+		}
+		size -= int64(n)
+	}
+	var sum [8]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil || binary.LittleEndian.Uint64(sum[:]) != h.Sum64() {
+		return false
+	}
+	return dw.Flush() == nil
+}
+
+// Path returns the path of the checkpoint file.
+func (cp *Checkpoint) Path() string {
+	return cp.path
+}
+
+// Batches returns the number of batches of packets recorded before the
+// checkpoint was resumed.
+func (cp *Checkpoint) Batches() int {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return len(cp.batches)
+}
+
+// Finished reports whether the checkpoint was resumed with the result of a
+// finished match.
+func (cp *Checkpoint) Finished() bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.result != nil
+}
+
+// Close writes out the records of the checkpoint and closes its file,
+// which is kept for the match to be resumed from.
+func (cp *Checkpoint) Close() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.result != nil {
+		cp.result.Close()
+		cp.result = nil
+	}
+	if cp.file == nil {
+		return nil
+	}
+	err := cp.sync()
+	if cerr := cp.file.Close(); err == nil {
+		err = cerr
+	}
+	cp.file = nil
+	return err
+}
+
+// sync writes out the records written so far and syncs the file.
+func (cp *Checkpoint) sync() error {
+	if err := cp.w.Flush(); err != nil {
+		return err
+	}
+	cp.lastSync = time.Now()
+	return cp.file.Sync()
+}
+
+// writeRecord writes a record of type typ. The caller holds cp.mu.
+func (cp *Checkpoint) writeRecord(typ byte, payload []byte) error {
+	var head [9]byte
+	head[0] = typ
+	binary.LittleEndian.PutUint64(head[1:], uint64(len(payload)))
+	h := xxhash.New()
+	h.Write(head[:1])
+	h.Write(payload)
+	cp.w.Write(head[:])
+	cp.w.Write(payload)
+	_, err := cp.w.Write(binary.LittleEndian.AppendUint64(nil, h.Sum64()))
+	return err
+}
+
+// restore fills in what processBatch produced for each batch the
+// checkpoint recorded, and marks those batches in done.
+func (cp *Checkpoint) restore(packets []mkv.Packet, batches []batchRange, batchResults [][]matchedRegion,
+	batchEdges []batchEdgeInfo, packetMatched []bool, done []bool) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for idx, rec := range cp.batches {
+		if idx >= len(batches) || batches[idx].start != rec.start || batches[idx].end-rec.start != len(rec.matched) {
+			return ErrCheckpointMismatch
+		}
+		head := packets[rec.start]
+		edge := rec.edge
+		edge.firstTrack, edge.lastTrack, edge.headPkt = head.TrackNum, head.TrackNum, head
+		batchEdges[idx] = edge
+		batchResults[idx] = rec.regions
+		copy(packetMatched[rec.start:], rec.matched)
+		done[idx] = true
+	}
+	cp.batches = nil
+	return nil
+}
+
+// recordBatch records what processBatch produced for batch idx. A failure
+// to write it is returned by flush.
+func (cp *Checkpoint) recordBatch(idx int, br batchRange, packetMatched []bool, edge *batchEdgeInfo, regions []matchedRegion) {
+	payload := appendCheckpointBatch(nil, idx, br, packetMatched[br.start:br.end], edge, regions)
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.err != nil {
+		return
+	}
+	cp.err = cp.writeRecord(checkpointBatch, payload)
+	if cp.err == nil && time.Since(cp.lastSync) >= checkpointSyncInterval {
+		cp.err = cp.sync()
+	}
+}
+
+// flush writes out and syncs the batches recorded so far, returning the
+// first error recording them.
+func (cp *Checkpoint) flush() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.err == nil {
+		cp.err = cp.sync()
+	}
+	return cp.err
+}
+
+// recordResult records the result of the finished match, with its delta.
+func (cp *Checkpoint) recordResult(result *Result) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.err != nil {
+		return cp.err
+	}
+	var delta io.Reader
+	var deltaSize int64
+	if result.DeltaFile != nil {
+		if err := result.DeltaFile.Flush(); err != nil {
+			return err
+		}
+		deltaSize = result.DeltaFile.Size()
+		delta = io.NewSectionReader(result.DeltaFile.File(), 0, deltaSize)
+	} else {
+		deltaSize = int64(len(result.DeltaData))
+		delta = bytes.NewReader(result.DeltaData)
+	}
+	if err := cp.writeRecord(checkpointResult, appendCheckpointResult(nil, result, deltaSize)); err != nil {
+		return err
+	}
+	h := xxhash.New()
+	if _, err := io.Copy(io.MultiWriter(cp.w, h), delta); err != nil {
+		return err
+	}
+	cp.w.Write(binary.LittleEndian.AppendUint64(nil, h.Sum64()))
+	return cp.sync()
+}
+
+// takeResult returns the result recorded before the checkpoint was
+// resumed, handing it over to the caller, or nil.
+func (cp *Checkpoint) takeResult() *Result {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	result := cp.result
+	cp.result = nil
+	return result
+}
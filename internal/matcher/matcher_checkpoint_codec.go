@@ -0,0 +1,237 @@
+package matcher
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errCheckpointRecord reports a checkpoint record that does not decode.
+var errCheckpointRecord = errors.New("malformed checkpoint record")
+
+// checkpointDecoder reads the fields of a checkpoint record. The first
+// field that does not decode sets err, after which every field reads as 0.
+type checkpointDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *checkpointDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errCheckpointRecord
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *checkpointDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errCheckpointRecord
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *checkpointDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = errCheckpointRecord
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+// count reads a count of items taking at least one byte each, failing if
+// the record is too short to hold them.
+func (d *checkpointDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.err = errCheckpointRecord
+		return 0
+	}
+	return int(n)
+}
+
+// finish returns the error of the record, which must have been read whole.
+func (d *checkpointDecoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = errCheckpointRecord
+	}
+	return d.err
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// Flags of a region or entry in a checkpoint record.
+const (
+	checkpointVideo = 1 << iota
+	checkpointLPCM
+	checkpointLPCM24
+	checkpointFill
+)
+
+// appendCheckpointBatch appends the payload of a batch record: what
+// processBatch produced for batch idx, except the edge fields taken from
+// its packets.
+func appendCheckpointBatch(b []byte, idx int, br batchRange, matched []bool, edge *batchEdgeInfo, regions []matchedRegion) []byte {
+	b = binary.AppendUvarint(b, uint64(idx))
+	b = binary.AppendUvarint(b, uint64(br.start))
+	b = binary.AppendUvarint(b, uint64(len(matched)))
+	bits := make([]byte, (len(matched)+7)/8)
+	for i, ok := range matched {
+		if ok {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	b = append(b, bits...)
+
+	b = appendBool(b, edge.edgeMissHead)
+	b = binary.AppendVarint(b, int64(edge.headSyncOff))
+	b = binary.AppendVarint(b, int64(edge.headNALSize))
+	b = appendBool(b, edge.headNALSizeExact)
+	tail := edge.tailLocality
+	b = appendBool(b, tail.valid)
+	b = binary.AppendUvarint(b, uint64(tail.fileIdx))
+	b = binary.AppendVarint(b, tail.offset)
+	b = binary.AppendVarint(b, tail.srcEnd)
+	b = binary.AppendVarint(b, tail.mkvEnd)
+
+	b = binary.AppendUvarint(b, uint64(len(regions)))
+	for _, r := range regions {
+		b = binary.AppendVarint(b, r.mkvStart)
+		b = binary.AppendVarint(b, r.mkvEnd-r.mkvStart)
+		b = binary.AppendUvarint(b, uint64(r.fileIndex))
+		b = binary.AppendVarint(b, r.srcOffset)
+		var flags byte
+		if r.isVideo {
+			flags |= checkpointVideo
+		}
+		b = append(b, flags, r.audioSubStreamID)
+		b = binary.AppendUvarint(b, uint64(r.lpcmSampleSize))
+	}
+	return b
+}
+
+// decodeCheckpointBatch decodes the payload of a batch record.
+func decodeCheckpointBatch(payload []byte) (int, *checkpointBatchRecord, error) {
+	d := &checkpointDecoder{buf: payload}
+	idx := int(d.uvarint())
+	rec := &checkpointBatchRecord{start: int(d.uvarint())}
+	n := int(d.uvarint())
+	if d.err == nil && (n == 0 || n > batchSize || (n+7)/8 > len(d.buf)) {
+		return 0, nil, errCheckpointRecord
+	}
+	rec.matched = make([]bool, n)
+	for i := range rec.matched {
+		rec.matched[i] = d.buf[i/8]&(1<<(i%8)) != 0
+	}
+	d.buf = d.buf[(n+7)/8:]
+
+	edge := &rec.edge
+	edge.edgeMissHead = d.byte() != 0
+	edge.headSyncOff = int(d.varint())
+	edge.headNALSize = int(d.varint())
+	edge.headNALSizeExact = d.byte() != 0
+	tail := &edge.tailLocality
+	tail.valid = d.byte() != 0
+	tail.fileIdx = uint16(d.uvarint())
+	tail.offset = d.varint()
+	tail.srcEnd = d.varint()
+	tail.mkvEnd = d.varint()
+
+	rec.regions = make([]matchedRegion, d.count())
+	for i := range rec.regions {
+		r := &rec.regions[i]
+		r.mkvStart = d.varint()
+		r.mkvEnd = r.mkvStart + d.varint()
+		r.fileIndex = uint16(d.uvarint())
+		r.srcOffset = d.varint()
+		r.isVideo = d.byte()&checkpointVideo != 0
+		r.audioSubStreamID = d.byte()
+		r.lpcmSampleSize = int(d.uvarint())
+	}
+	if err := d.finish(); err != nil {
+		return 0, nil, err
+	}
+	return idx, rec, nil
+}
+
+// appendCheckpointResult appends the payload of a result record, whose
+// delta of deltaSize bytes follows it.
+func appendCheckpointResult(b []byte, result *Result, deltaSize int64) []byte {
+	b = binary.AppendUvarint(b, uint64(result.TotalPackets))
+	b = binary.AppendUvarint(b, uint64(result.MatchedPackets))
+	b = binary.AppendUvarint(b, uint64(deltaSize))
+	b = binary.AppendUvarint(b, uint64(len(result.Entries)))
+	for _, e := range result.Entries {
+		b = binary.AppendVarint(b, e.MkvOffset)
+		b = binary.AppendVarint(b, e.Length)
+		b = binary.AppendUvarint(b, uint64(e.Source))
+		b = binary.AppendVarint(b, e.SourceOffset)
+		var flags byte
+		if e.IsVideo {
+			flags |= checkpointVideo
+		}
+		if e.IsLPCM {
+			flags |= checkpointLPCM
+		}
+		if e.IsLPCM24 {
+			flags |= checkpointLPCM24
+		}
+		if e.IsFill {
+			flags |= checkpointFill
+		}
+		b = append(b, flags, e.AudioSubStreamID)
+	}
+	return b
+}
+
+// decodeCheckpointResult decodes the payload of a result record, returning
+// the result without its delta, and the size of the delta.
+func decodeCheckpointResult(payload []byte) (*Result, int64, error) {
+	d := &checkpointDecoder{buf: payload}
+	result := &Result{
+		TotalPackets:   int(d.uvarint()),
+		MatchedPackets: int(d.uvarint()),
+	}
+	deltaSize := int64(d.uvarint())
+	result.Entries = make([]Entry, d.count())
+	for i := range result.Entries {
+		e := &result.Entries[i]
+		e.MkvOffset = d.varint()
+		e.Length = d.varint()
+		e.Source = uint16(d.uvarint())
+		e.SourceOffset = d.varint()
+		flags := d.byte()
+		e.IsVideo = flags&checkpointVideo != 0
+		e.IsLPCM = flags&checkpointLPCM != 0
+		e.IsLPCM24 = flags&checkpointLPCM24 != 0
+		e.IsFill = flags&checkpointFill != 0
+		e.AudioSubStreamID = d.byte()
+	}
+	if err := d.finish(); err != nil {
+		return nil, 0, err
+	}
+	if deltaSize < 0 {
+		return nil, 0, errCheckpointRecord
+	}
+	return result, deltaSize, nil
+}
@@ -0,0 +1,169 @@
+package matcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpoint_Resume(t *testing.T) {
+	mkvPath, packets, tracks, idx := generateDeterminismTestData(t)
+	key := CheckpointKey(1, 2, idx)
+
+	match := func(cp *Checkpoint) (*Result, []byte) {
+		t.Helper()
+		m, err := NewMatcher(idx)
+		if err != nil {
+			t.Fatalf("NewMatcher: %v", err)
+		}
+		defer m.Close()
+		m.SetNumWorkers(4)
+		m.SetCheckpoint(cp)
+		result, err := m.Match(mkvPath, packets, tracks, nil)
+		if err != nil {
+			t.Fatalf("Match: %v", err)
+		}
+		defer result.Close()
+		delta, err := io.ReadAll(io.NewSectionReader(result.DeltaFile.File(), 0, result.DeltaSize()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result, delta
+	}
+	want, wantDelta := match(nil)
+
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	cp, err := CreateCheckpoint(path, key)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint: %v", err)
+	}
+	if got, delta := match(cp); !reflect.DeepEqual(got.Entries, want.Entries) || !bytes.Equal(delta, wantDelta) {
+		t.Fatal("match recording a checkpoint differs from one without")
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find where each record starts
+	var offsets []int64
+	r := bufio.NewReader(bytes.NewReader(data[checkpointHeaderSize:]))
+	end := int64(checkpointHeaderSize)
+	for {
+		typ, payload, ok := readCheckpointRecord(r, int64(len(data))-end)
+		if !ok {
+			t.Fatal("checkpoint has no result record")
+		}
+		offsets = append(offsets, end)
+		if typ == checkpointResult {
+			break
+		}
+		end += int64(1+8+len(payload)) + 8
+	}
+	batches := len(offsets) - 1
+	if batches < 3 {
+		t.Fatalf("checkpoint of %d batches, want at least 3", batches)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		size     int64 // Of the checkpoint left by the interrupted match
+		batches  int
+		finished bool
+	}{
+		{"finished", int64(len(data)), batches, true},
+		{"delta cut off", int64(len(data)) - 1, batches, false},
+		{"batch cut off", offsets[2] + 5, 2, false},
+		{"no records", int64(checkpointHeaderSize), 0, false},
+		{"header cut off", 3, 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, data[:tt.size], 0644); err != nil {
+				t.Fatal(err)
+			}
+			cp, err := ResumeCheckpoint(path, key)
+			if err != nil {
+				t.Fatalf("ResumeCheckpoint: %v", err)
+			}
+			defer cp.Close()
+			if cp.Batches() != tt.batches || cp.Finished() != tt.finished {
+				t.Errorf("resumed %d batches, finished %v; want %d, %v", cp.Batches(), cp.Finished(), tt.batches, tt.finished)
+			}
+			got, delta := match(cp)
+			if !reflect.DeepEqual(got.Entries, want.Entries) || !bytes.Equal(delta, wantDelta) ||
+				got.MatchedPackets != want.MatchedPackets || got.MatchedBytes != want.MatchedBytes {
+				t.Errorf("resumed match: %d entries, %d packets, %d bytes matched; want %d, %d, %d",
+					len(got.Entries), got.MatchedPackets, got.MatchedBytes,
+					len(want.Entries), want.MatchedPackets, want.MatchedBytes)
+			}
+			if err := cp.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			// The resumed match completed the checkpoint
+			cp, err = ResumeCheckpoint(path, key)
+			if err != nil {
+				t.Fatalf("ResumeCheckpoint: %v", err)
+			}
+			defer cp.Close()
+			if !cp.Finished() {
+				t.Error("checkpoint of the resumed match is not finished")
+			}
+		})
+	}
+
+	// A checkpoint of another match is left alone
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResumeCheckpoint(path, key+1); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("ResumeCheckpoint with another key = %v, want %v", err, ErrCheckpointMismatch)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+		t.Error("ResumeCheckpoint with another key changed the checkpoint")
+	}
+}
+
+func TestMatchContext_Canceled(t *testing.T) {
+	mkvPath, packets, tracks, idx := generateDeterminismTestData(t)
+	m, err := NewMatcher(idx)
+	if err != nil {
+		t.Fatalf("NewMatcher: %v", err)
+	}
+	defer m.Close()
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	key := CheckpointKey(1, 2, idx)
+	cp, err := CreateCheckpoint(path, key)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint: %v", err)
+	}
+	m.SetCheckpoint(cp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.MatchContext(ctx, mkvPath, packets, tracks, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("MatchContext = %v, want %v", err, context.Canceled)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The checkpoint is kept, without a result
+	cp, err = ResumeCheckpoint(path, key)
+	if err != nil {
+		t.Fatalf("ResumeCheckpoint: %v", err)
+	}
+	defer cp.Close()
+	if cp.Finished() {
+		t.Error("canceled match recorded a result")
+	}
+}
@@ -68,14 +68,29 @@ func (m *Matcher) mergeRegions() {
 
 // buildEntries creates the final entry list and streams delta data to a temp file.
 func (m *Matcher) buildEntries() ([]Entry, *DeltaWriter, error) {
-	entries := make([]Entry, 0, len(m.matchedRegions)*2+1)
-
 	deltaWriter, err := NewDeltaWriter()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	deltaOffset := int64(0)
+	entries, err := m.appendEntries(make([]Entry, 0, len(m.matchedRegions)*2+1), deltaWriter, 0)
+	if err != nil {
+		deltaWriter.Close()
+		return nil, nil, err
+	}
+	if err := deltaWriter.Flush(); err != nil {
+		deltaWriter.Close()
+		return nil, nil, fmt.Errorf("flush delta: %w", err)
+	}
+
+	return entries, deltaWriter, nil
+}
+
+// appendEntries appends the entries covering m.mkvData to entries, with MKV
+// offsets moved by base, and appends its unmatched data to deltaWriter. A
+// delta entry continuing the last one in entries is merged into it.
+func (m *Matcher) appendEntries(entries []Entry, deltaWriter *DeltaWriter, base int64) ([]Entry, error) {
+	deltaOffset := deltaWriter.Size()
 	pos := int64(0)
 	regionIdx := 0
 
@@ -90,13 +105,14 @@ func (m *Matcher) buildEntries() ([]Entry, *DeltaWriter, error) {
 			regionLen := inRegion.mkvEnd - pos
 
 			entries = append(entries, Entry{
-				MkvOffset:        pos,
+				MkvOffset:        base + pos,
 				Length:           regionLen,
 				Source:           uint16(inRegion.fileIndex + 1),
 				SourceOffset:     inRegion.srcOffset + offsetInRegion,
 				IsVideo:          inRegion.isVideo,
 				AudioSubStreamID: inRegion.audioSubStreamID,
-				IsLPCM:           inRegion.isLPCM,
+				IsLPCM:           inRegion.lpcmSampleSize > 0,
+				IsLPCM24:         inRegion.lpcmSampleSize == 3,
 			})
 
 			pos = inRegion.mkvEnd
@@ -109,28 +125,51 @@ func (m *Matcher) buildEntries() ([]Entry, *DeltaWriter, error) {
 			gapLen := gapEnd - pos
 
 			if gapEnd <= m.mkvSize {
-				entries = append(entries, Entry{
-					MkvOffset:    pos,
-					Length:       gapLen,
-					Source:       0,
-					SourceOffset: deltaOffset,
-				})
-				// Write gap data directly from mmap to temp file
-				if err := deltaWriter.Write(m.mkvData[pos:gapEnd]); err != nil {
-					deltaWriter.Close()
-					return nil, nil, fmt.Errorf("write delta: %w", err)
+				// Runs of a repeating pattern become fill entries; the rest
+				// of the gap goes to the delta.
+				deltaStart := pos
+				runs := findFillRuns(m.mkvData[pos:gapEnd], MinFillLength)
+				runs = append(runs, fillRun{start: gapLen, end: gapLen})
+				for _, run := range runs {
+					if runStart := pos + run.start; runStart > deltaStart {
+						entries = appendDeltaEntry(entries, Entry{
+							MkvOffset:    base + deltaStart,
+							Length:       runStart - deltaStart,
+							Source:       0,
+							SourceOffset: deltaOffset,
+						})
+						// Write gap data directly from mmap to temp file
+						if err := deltaWriter.Write(m.mkvData[deltaStart:runStart]); err != nil {
+							return nil, fmt.Errorf("write delta: %w", err)
+						}
+						deltaOffset += runStart - deltaStart
+					}
+					if run.end > run.start {
+						runStart := pos + run.start
+						entries = append(entries, NewFillEntry(base+runStart, run.end-run.start,
+							m.mkvData[runStart:runStart+int64(run.period)]))
+					}
+					deltaStart = pos + run.end
 				}
-				deltaOffset += gapLen
 			}
 
 			pos = gapEnd
 		}
 	}
 
-	if err := deltaWriter.Flush(); err != nil {
-		deltaWriter.Close()
-		return nil, nil, fmt.Errorf("flush delta: %w", err)
-	}
+	return entries, nil
+}
 
-	return entries, deltaWriter, nil
+// appendDeltaEntry appends the delta entry e to entries, merging it into the
+// last entry if that is delta data just before it.
+func appendDeltaEntry(entries []Entry, e Entry) []Entry {
+	if n := len(entries); n > 0 {
+		last := &entries[n-1]
+		if last.Source == 0 && !last.IsFill &&
+			last.MkvOffset+last.Length == e.MkvOffset && last.SourceOffset+last.Length == e.SourceOffset {
+			last.Length += e.Length
+			return entries
+		}
+	}
+	return append(entries, e)
 }
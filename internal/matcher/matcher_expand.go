@@ -51,7 +51,8 @@ func (m *Matcher) tryVerifyAndExpand(pkt mkv.Packet, loc source.Location, offset
 		}
 	}
 
-	isLPCM := source.IsLPCMSubStreamID(loc.AudioSubStreamID)
+	lpcmSampleSize := m.sourceIndex.LPCMSampleSize(loc)
+	isLPCM := lpcmSampleSize > 0
 
 	// Reject LPCM source matches when the MKV track is not PCM audio.
 	// Without this check, coincidental byte-level matches between non-PCM
@@ -68,18 +69,16 @@ func (m *Matcher) tryVerifyAndExpand(pkt mkv.Packet, loc source.Location, offset
 		mkvSyncOffset, loc, verifyLen,
 	)
 
-	// For LPCM entries, align boundaries to 2-byte sample pairs.
-	// The byte-swap transform operates on pairs; an unpaired byte at either
-	// end cannot be correctly swapped during FUSE reconstruction.
-	if isLPCM && matchLen > 1 {
-		if srcStart%2 == 1 {
-			mkvStart++
-			srcStart++
-			matchLen--
-		}
-		if matchLen%2 == 1 {
-			matchLen--
+	// For LPCM entries, align boundaries to whole samples, so every entry
+	// covers complete byte-swapped samples.
+	if isLPCM && matchLen >= int64(lpcmSampleSize) {
+		w := int64(lpcmSampleSize)
+		if rem := srcStart % w; rem != 0 {
+			mkvStart += w - rem
+			srcStart += w - rem
+			matchLen -= w - rem
 		}
+		matchLen -= matchLen % w
 	}
 	if matchLen <= 0 {
 		return nil
@@ -92,7 +91,7 @@ func (m *Matcher) tryVerifyAndExpand(pkt mkv.Packet, loc source.Location, offset
 		srcOffset:        srcStart,
 		isVideo:          isVideo,
 		audioSubStreamID: loc.AudioSubStreamID,
-		isLPCM:           isLPCM,
+		lpcmSampleSize:   lpcmSampleSize,
 	}
 
 	return region
@@ -78,8 +78,8 @@ func TestTryVerifyAndExpand_RejectsLPCMForNonPCMTrack(t *testing.T) {
 		if region == nil {
 			t.Fatal("expected non-nil region for LPCM match on PCM track, got nil")
 		}
-		if !region.isLPCM {
-			t.Error("expected region.isLPCM to be true")
+		if region.lpcmSampleSize != 2 {
+			t.Errorf("region.lpcmSampleSize = %d, want 2", region.lpcmSampleSize)
 		}
 		if region.audioSubStreamID != 0xA0 {
 			t.Errorf("audioSubStreamID = 0x%02X, want 0xA0", region.audioSubStreamID)
@@ -102,8 +102,8 @@ func TestTryVerifyAndExpand_RejectsLPCMForNonPCMTrack(t *testing.T) {
 		if region == nil {
 			t.Fatal("expected non-nil region for non-LPCM match on non-PCM track, got nil")
 		}
-		if region.isLPCM {
-			t.Error("expected region.isLPCM to be false for AC3 sub-stream")
+		if region.lpcmSampleSize != 0 {
+			t.Error("expected region.lpcmSampleSize to be 0 for AC3 sub-stream")
 		}
 	})
 }
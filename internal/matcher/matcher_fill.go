@@ -0,0 +1,85 @@
+package matcher
+
+// Unmatched data often holds long runs of a short repeating pattern: EBML
+// Void elements, zero padding and filler bytes. Such runs are stored as
+// fill entries, which describe the pattern instead of copying the bytes
+// into the delta.
+
+const (
+	// MaxFillPattern is the longest pattern a fill entry can repeat.
+	MaxFillPattern = 8
+	// MinFillLength is the shortest run of a repeating pattern stored as a
+	// fill entry rather than as delta. Shorter runs would save less than
+	// the index entries splitting the delta around them cost.
+	MinFillLength = 256
+)
+
+// NewFillEntry returns an entry for length bytes at mkvOffset that repeat
+// pattern (1 to MaxFillPattern bytes) from its first byte. The pattern is
+// kept in the entry's other fields: its bytes in SourceOffset, little-endian,
+// and its length in AudioSubStreamID. A zero fill is the pattern {0}.
+func NewFillEntry(mkvOffset, length int64, pattern []byte) Entry {
+	var v uint64
+	for i, b := range pattern {
+		v |= uint64(b) << (8 * i)
+	}
+	return Entry{
+		MkvOffset:        mkvOffset,
+		Length:           length,
+		SourceOffset:     int64(v),
+		AudioSubStreamID: byte(len(pattern)),
+		IsFill:           true,
+	}
+}
+
+// FillPattern returns the pattern a fill entry repeats.
+func (e *Entry) FillPattern() []byte {
+	n := min(int(e.AudioSubStreamID), MaxFillPattern)
+	pattern := make([]byte, n)
+	for i := range pattern {
+		pattern[i] = byte(uint64(e.SourceOffset) >> (8 * i))
+	}
+	return pattern
+}
+
+// fillRun is a run of data repeating its first period bytes.
+type fillRun struct {
+	start, end int64
+	period     int
+}
+
+// periodicPrefix returns how many leading bytes of data repeat its first
+// period bytes.
+func periodicPrefix(data []byte, period int) int {
+	n := min(period, len(data))
+	for n < len(data) && data[n] == data[n-period] {
+		n++
+	}
+	return n
+}
+
+// findFillRuns returns the runs of at least minLength bytes in data that
+// repeat a pattern of up to MaxFillPattern bytes, using the shortest pattern
+// for each run. Offsets are relative to data.
+func findFillRuns(data []byte, minLength int) []fillRun {
+	var runs []fillRun
+	i := 0
+	for i+minLength <= len(data) {
+		best, bestPeriod := 0, 0
+		for p := 1; p <= MaxFillPattern; p++ {
+			if n := periodicPrefix(data[i:], p); n > best {
+				best, bestPeriod = n, p
+			}
+		}
+		if best >= minLength {
+			runs = append(runs, fillRun{int64(i), int64(i + best), bestPeriod})
+			i += best
+			continue
+		}
+		// A run starting within best-2*MaxFillPattern bytes would overlap
+		// this one by at least the sum of both periods, so it would share
+		// their common period and could not extend past it: skip ahead.
+		i += max(1, best-2*MaxFillPattern)
+	}
+	return runs
+}
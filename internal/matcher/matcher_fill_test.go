@@ -0,0 +1,101 @@
+package matcher
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFindFillRuns(t *testing.T) {
+	noise := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i*131 + i/7 + 1)
+		}
+		return b
+	}
+	concat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want []fillRun
+	}{
+		{"no runs", noise(4000), nil},
+		{"zero run", concat(noise(100), make([]byte, 1000), noise(100)), []fillRun{{100, 1100, 1}}},
+		{"whole data", bytes.Repeat([]byte{0xEC}, 300), []fillRun{{0, 300, 1}}},
+		{"short run", concat(noise(100), make([]byte, MinFillLength-1), noise(100)), nil},
+		{"shortest period", concat(noise(10), bytes.Repeat([]byte("abab"), 100)), []fillRun{{10, 410, 2}}},
+		{"longest period", bytes.Repeat([]byte("12345678"), 40), []fillRun{{0, 320, 8}}},
+		{"period too long", bytes.Repeat([]byte("123456789"), 40), nil},
+		{"adjacent runs", concat(bytes.Repeat([]byte("xy"), 150), make([]byte, 400)),
+			[]fillRun{{0, 300, 2}, {300, 700, 1}}},
+		{"run after a shorter run", concat(bytes.Repeat([]byte("xyz"), 50), make([]byte, 300)),
+			[]fillRun{{150, 450, 1}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findFillRuns(tt.data, MinFillLength)
+			if len(got) != len(tt.want) {
+				t.Fatalf("findFillRuns = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("run %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewFillEntry(t *testing.T) {
+	for _, pattern := range [][]byte{{0}, {0xFF}, {1, 2, 3}, {0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0xFF}} {
+		e := NewFillEntry(10, 500, pattern)
+		if !e.IsFill || e.Source != 0 || e.MkvOffset != 10 || e.Length != 500 {
+			t.Errorf("NewFillEntry(%x) = %+v", pattern, e)
+		}
+		if got := e.FillPattern(); !bytes.Equal(got, pattern) {
+			t.Errorf("FillPattern = %x, want %x", got, pattern)
+		}
+	}
+}
+
+func TestBuildEntries_Fill(t *testing.T) {
+	data := bytes.Repeat([]byte("matched data "), 100)
+	data = append(data, []byte("cluster header")...)
+	data = append(data, make([]byte, 2000)...)
+	data = append(data, []byte("trailer")...)
+
+	m := &Matcher{mkvData: data, mkvSize: int64(len(data))}
+	m.matchedRegions = []matchedRegion{{mkvStart: 0, mkvEnd: 1300}}
+	entries, deltaWriter, err := m.buildEntries()
+	if err != nil {
+		t.Fatalf("buildEntries: %v", err)
+	}
+	defer deltaWriter.Close()
+
+	want := []Entry{
+		{MkvOffset: 0, Length: 1300, Source: 1},
+		{MkvOffset: 1300, Length: 14, SourceOffset: 0},
+		NewFillEntry(1314, 2000, []byte{0}),
+		{MkvOffset: 3314, Length: 7, SourceOffset: 14},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	if err := deltaWriter.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	delta, err := io.ReadAll(io.NewSectionReader(deltaWriter.File(), 0, deltaWriter.Size()))
+	if err != nil {
+		t.Fatalf("read delta: %v", err)
+	}
+	if string(delta) != "cluster headertrailer" {
+		t.Errorf("delta = %q, want the unmatched bytes outside the fill", delta)
+	}
+}
@@ -1,6 +1,7 @@
 package matcher
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -67,11 +68,12 @@ type batchRange struct {
 // Packets must be pre-sorted by track number before calling this function.
 // Batches never cross track boundaries — each batch contains packets from
 // exactly one track. Within a track, packets are split into chunks of up
-// to batchSize. This makes intra-batch locality fully deterministic.
-func (m *Matcher) matchParallel(packets []mkv.Packet, progress ProgressFunc) int {
+// to batchSize. This makes intra-batch locality fully deterministic, and
+// lets a checkpoint record batches as they finish, in any order.
+func (m *Matcher) matchParallel(ctx context.Context, packets []mkv.Packet, cp *Checkpoint, progress ProgressFunc) (int, error) {
 	totalPackets := len(packets)
 	if totalPackets == 0 {
-		return 0
+		return 0, nil
 	}
 
 	// Build track-aware batches: split at track boundaries, then chunk
@@ -102,21 +104,52 @@ func (m *Matcher) matchParallel(packets []mkv.Packet, progress ProgressFunc) int
 	var nextBatch atomic.Int64
 	var processedCount atomic.Int64
 
+	// Batches a checkpoint recorded are restored as processBatch left them
+	restored := make([]bool, numBatches)
+	if cp != nil {
+		if err := cp.restore(packets, batches, batchResults, batchEdges, packetMatched, restored); err != nil {
+			return 0, err
+		}
+		for i, ok := range restored {
+			if !ok {
+				continue
+			}
+			for _, r := range batchResults[i] {
+				m.markChunksCovered(r.mkvStart, r.mkvEnd)
+			}
+			processedCount.Add(int64(batches[i].end - batches[i].start))
+		}
+	}
+
 	var wg sync.WaitGroup
 	for i := 0; i < m.numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for {
+			for ctx.Err() == nil {
 				idx := int(nextBatch.Add(1) - 1)
 				if idx >= numBatches {
 					return
 				}
+				if restored[idx] {
+					continue
+				}
 				m.processBatch(packets, batches[idx], idx, batchResults, batchEdges, packetMatched, &processedCount, progress, totalPackets)
+				if cp != nil {
+					cp.recordBatch(idx, batches[idx], packetMatched, &batchEdges[idx], batchResults[idx])
+				}
 			}
 		}()
 	}
 	wg.Wait()
+	if cp != nil {
+		if err := cp.flush(); err != nil {
+			return 0, fmt.Errorf("record checkpoint: %w", err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 
 	// Inter-batch edge sync (deterministic sequential pass)
 	m.syncBatchEdges(batches, batchEdges, batchResults, packetMatched)
@@ -133,7 +166,7 @@ func (m *Matcher) matchParallel(packets []mkv.Packet, progress ProgressFunc) int
 		}
 	}
 
-	return matchedCount
+	return matchedCount, nil
 }
 
 // processBatch processes a single batch of packets sequentially.
@@ -260,9 +293,13 @@ func (m *Matcher) matchPacketBatch(pkt mkv.Packet, loc packetLocality, localCov
 	if isVideo {
 		if codecInfo.nalLengthSize > 0 {
 			syncPoints = source.FindAVCCNALStarts(data, codecInfo.nalLengthSize)
+		} else if m.isVC1Track[int(pkt.TrackNum)] {
+			syncPoints = source.FindVC1MatchSyncPoints(data)
 		} else {
 			syncPoints = source.FindVideoNALStarts(data)
 		}
+	} else if m.isVobSubTrack[int(pkt.TrackNum)] {
+		syncPoints = source.FindVobSubSyncPoints(data)
 	} else if trackType == mkv.TrackTypeSubtitle {
 		syncPoints = source.FindPGSSyncPoints(data)
 	} else if m.isPCMTrack[int(pkt.TrackNum)] {
@@ -14,7 +14,9 @@ type Entry struct {
 	SourceOffset     int64  // Offset in source file (or ES offset for ES-based sources)
 	IsVideo          bool   // For ES-based sources: whether this is video or audio data
 	AudioSubStreamID byte   // For ES-based audio: sub-stream ID (0x80-0x87=AC3, etc.)
-	IsLPCM           bool   // True if this is 16-bit LPCM audio requiring byte-swap on read
+	IsLPCM           bool   // True if this is LPCM audio requiring byte-swap on read
+	IsLPCM24         bool   // With IsLPCM: samples are 24-bit (3-byte swap) rather than 16-bit
+	IsFill           bool   // Source 0: a repeating pattern synthesized on read (see NewFillEntry)
 }
 
 // Result contains the results of the matching process.
@@ -24,6 +26,7 @@ type Result struct {
 	DeltaFile      *DeltaWriter // File-backed delta data (for large files)
 	MatchedBytes   int64        // Total bytes matched to source
 	UnmatchedBytes int64        // Total bytes in delta
+	FilledBytes    int64        // Total bytes in fill entries
 	MatchedPackets int          // Number of packets that matched
 	TotalPackets   int          // Total number of packets processed
 }
@@ -36,6 +39,19 @@ func (r *Result) DeltaSize() int64 {
 	return int64(len(r.DeltaData))
 }
 
+// countBytes totals the matched, unmatched and filled bytes of the entries.
+func (r *Result) countBytes() {
+	for _, e := range r.Entries {
+		if e.IsFill {
+			r.FilledBytes += e.Length
+		} else if e.Source == 0 {
+			r.UnmatchedBytes += e.Length
+		} else {
+			r.MatchedBytes += e.Length
+		}
+	}
+}
+
 // Close cleans up resources held by the result (temp files).
 func (r *Result) Close() {
 	if r.DeltaFile != nil {
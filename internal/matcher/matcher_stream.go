@@ -0,0 +1,82 @@
+package matcher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// Stream matches an MKV that is read once from start to end, such as from a
+// pipe, one window at a time. Each window is matched on its own, so a match
+// cannot extend past the window it starts in. Windows that end between
+// clusters lose little: matches against disc sources stop at cluster
+// headers anyway.
+type Stream struct {
+	m        *Matcher
+	result   *Result
+	offset   int64 // MKV offset of the next window
+	finished bool
+}
+
+// NewStream starts matching an MKV with the given tracks, which must be
+// known before its first packet. The Matcher must not be used for anything
+// else until the stream is finished.
+func (m *Matcher) NewStream(tracks []mkv.Track) (*Stream, error) {
+	deltaWriter, err := NewDeltaWriter()
+	if err != nil {
+		return nil, err
+	}
+	m.reset(tracks)
+	return &Stream{m: m, result: &Result{DeltaFile: deltaWriter}}, nil
+}
+
+// MatchWindow matches the packets of data, the next window of the MKV, and
+// appends its entries and delta to the result. Packet offsets are relative
+// to data, which is not used once MatchWindow returns. Once ctx is
+// canceled, the window is abandoned and its error returned.
+func (s *Stream) MatchWindow(ctx context.Context, data []byte, packets []mkv.Packet) error {
+	m := s.m
+	m.mkvData, m.mkvSize = data, int64(len(data))
+	defer func() { m.mkvData, m.matchedRegions, m.coveredChunks = nil, nil, nil }()
+
+	matched, err := m.matchRegions(ctx, packets, nil, nil)
+	if err != nil {
+		return err
+	}
+	s.result.TotalPackets += len(packets)
+	s.result.MatchedPackets += matched
+	m.fillTrueHDGaps(packets)
+	m.mergeRegions()
+
+	s.result.Entries, err = m.appendEntries(s.result.Entries, s.result.DeltaFile, s.offset)
+	if err != nil {
+		return fmt.Errorf("build entries: %w", err)
+	}
+	s.offset += int64(len(data))
+	return nil
+}
+
+// Size returns the number of MKV bytes matched so far.
+func (s *Stream) Size() int64 {
+	return s.offset
+}
+
+// Finish returns the result covering every window. The caller must Close
+// the result.
+func (s *Stream) Finish() (*Result, error) {
+	if err := s.result.DeltaFile.Flush(); err != nil {
+		return nil, fmt.Errorf("flush delta: %w", err)
+	}
+	s.finished = true
+	s.m.printDiagnostics()
+	s.result.countBytes()
+	return s.result, nil
+}
+
+// Close releases the stream's delta unless Finish handed it to the result.
+func (s *Stream) Close() {
+	if !s.finished {
+		s.result.Close()
+	}
+}
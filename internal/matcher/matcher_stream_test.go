@@ -0,0 +1,124 @@
+package matcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+func TestStream_MatchesWindows(t *testing.T) {
+	mkvPath, packets, tracks, idx := generateDeterminismTestData(t)
+	mkvData, err := os.ReadFile(mkvPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	sourceData := idx.RawReaders[0].(*sliceReader).data
+
+	m, err := NewMatcher(idx)
+	if err != nil {
+		t.Fatalf("NewMatcher: %v", err)
+	}
+	defer m.Close()
+	whole, err := m.Match(mkvPath, packets, tracks, nil)
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	whole.Close()
+
+	// Windows end between packets, as they would between clusters
+	s, err := m.NewStream(tracks)
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+	defer s.Close()
+	windowStart, next := int64(0), 0
+	for next < len(packets) || windowStart < int64(len(mkvData)) {
+		end := int64(len(mkvData))
+		var windowPackets []mkv.Packet
+		for next < len(packets) {
+			p := packets[next]
+			if p.Offset-windowStart > 1<<20 && len(windowPackets) > 0 {
+				end = p.Offset - 8
+				break
+			}
+			p.Offset -= windowStart
+			windowPackets = append(windowPackets, p)
+			next++
+		}
+		if err := s.MatchWindow(context.Background(), mkvData[windowStart:end], windowPackets); err != nil {
+			t.Fatalf("MatchWindow: %v", err)
+		}
+		windowStart = end
+	}
+	result, err := s.Finish()
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	defer result.Close()
+
+	if result.TotalPackets != len(packets) {
+		t.Errorf("TotalPackets = %d, want %d", result.TotalPackets, len(packets))
+	}
+	if result.MatchedBytes < whole.MatchedBytes*95/100 {
+		t.Errorf("MatchedBytes = %d, want close to %d from matching the whole file", result.MatchedBytes, whole.MatchedBytes)
+	}
+
+	delta, err := io.ReadAll(io.NewSectionReader(result.DeltaFile.File(), 0, result.DeltaSize()))
+	if err != nil {
+		t.Fatalf("read delta: %v", err)
+	}
+	var pos int64
+	for i, e := range result.Entries {
+		if e.MkvOffset != pos {
+			t.Fatalf("entry %d starts at %d, want %d", i, e.MkvOffset, pos)
+		}
+		var want []byte
+		switch {
+		case e.IsFill:
+			want = bytes.Repeat(e.FillPattern(), int(e.Length))[:e.Length]
+		case e.Source == 0:
+			want = delta[e.SourceOffset : e.SourceOffset+e.Length]
+		default:
+			want = sourceData[e.SourceOffset : e.SourceOffset+e.Length]
+		}
+		if !bytes.Equal(mkvData[pos:pos+e.Length], want) {
+			t.Fatalf("entry %d (%+v) does not reproduce the MKV", i, e)
+		}
+		pos += e.Length
+	}
+	if pos != int64(len(mkvData)) {
+		t.Errorf("entries cover %d bytes, want %d", pos, len(mkvData))
+	}
+}
+
+func TestStream_MatchWindow_Canceled(t *testing.T) {
+	mkvPath, packets, tracks, idx := generateDeterminismTestData(t)
+	mkvData, err := os.ReadFile(mkvPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	m, err := NewMatcher(idx)
+	if err != nil {
+		t.Fatalf("NewMatcher: %v", err)
+	}
+	defer m.Close()
+	s, err := m.NewStream(tracks)
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.MatchWindow(ctx, mkvData, packets); !errors.Is(err, context.Canceled) {
+		t.Fatalf("MatchWindow = %v, want %v", err, context.Canceled)
+	}
+	if s.Size() != 0 {
+		t.Errorf("Size = %d after a canceled window, want 0", s.Size())
+	}
+}
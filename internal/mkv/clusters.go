@@ -0,0 +1,212 @@
+package mkv
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// ClusterPosition is the location and start time of a Cluster element.
+type ClusterPosition struct {
+	Offset    int64         // Offset of the Cluster element header
+	Timestamp time.Duration // Cluster timestamp, or -1 if it could not be read
+}
+
+// ByteRange is a byte range [Start, End) of an MKV file.
+type ByteRange struct {
+	Start, End int64
+}
+
+// clusterIDBytes is the encoded Cluster element ID searched for to resume
+// a scan after unreadable data.
+var clusterIDBytes = []byte{0x1F, 0x43, 0xB6, 0x75}
+
+// resyncFailureStep is how far past a failed read the search for the next
+// Cluster resumes.
+const resyncFailureStep = 256
+
+// clusterScanner walks the top-level elements of an MKV that may have
+// unreadable regions.
+type clusterScanner struct {
+	r      io.ReaderAt
+	size   int64
+	segEnd int64
+	skip   []ByteRange
+}
+
+// ScanClusters finds the clusters of the MKV data in r, which is size bytes
+// long, without reading any byte in the sorted, non-overlapping skip
+// ranges. Only element headers, the Info element and cluster timestamps are
+// read. When the walk over the Segment's elements reaches a skipped range,
+// a failed read or invalid data, it resumes at the next Cluster found by
+// searching for the Cluster ID, so the clusters on both sides of damage are
+// still found.
+func ScanClusters(r io.ReaderAt, size int64, skip []ByteRange) []ClusterPosition {
+	s := &clusterScanner{r: r, size: size, segEnd: size, skip: skip}
+	timestampScale := int64(1000000) // Matroska default: 1ms
+
+	offset := int64(-1)
+	if ebml, ok := s.elementAt(0); ok && ebml.ID == IDEBMLHeader && ebml.Size >= 0 {
+		if seg, ok := s.elementAt(ebml.DataOffset + ebml.Size); ok && seg.ID == IDSegment {
+			offset = seg.DataOffset
+			if seg.Size >= 0 {
+				s.segEnd = min(size, seg.DataOffset+seg.Size)
+			}
+		}
+	}
+	if offset < 0 {
+		offset = s.resync(0)
+	}
+
+	var clusters []ClusterPosition
+	var ticks []int64
+	for offset >= 0 && offset < s.segEnd {
+		elem, ok := s.elementAt(offset)
+		if !ok || (elem.Size < 0 && elem.ID != IDCluster) || (elem.Size >= 0 && elem.Size > s.segEnd-elem.DataOffset) {
+			offset = s.resync(offset + 1)
+			continue
+		}
+		switch elem.ID {
+		case IDInfo:
+			if v := s.childUint(elem, IDTimestampScale); v > 0 {
+				timestampScale = v
+			}
+		case IDCluster:
+			clusters = append(clusters, ClusterPosition{Offset: offset})
+			ticks = append(ticks, s.childUint(elem, IDTimestamp))
+		}
+		if elem.Size < 0 {
+			offset = s.resync(elem.DataOffset)
+		} else {
+			offset = elem.DataOffset + elem.Size
+		}
+	}
+
+	for i := range clusters {
+		clusters[i].Timestamp = -1
+		if ticks[i] >= 0 {
+			clusters[i].Timestamp = time.Duration(ticks[i] * timestampScale)
+		}
+	}
+	return clusters
+}
+
+// readable returns how many of the n bytes at offset can be read before
+// the end of the data or a skipped range.
+func (s *clusterScanner) readable(offset, n int64) int64 {
+	n = min(n, s.size-offset)
+	for _, sr := range s.skip {
+		if sr.End <= offset {
+			continue
+		}
+		if sr.Start <= offset {
+			return 0
+		}
+		n = min(n, sr.Start-offset)
+		break
+	}
+	return max(n, 0)
+}
+
+// read returns up to n bytes at offset, stopping short of skipped ranges
+// and at the first byte that fails to read.
+func (s *clusterScanner) read(offset, n int64) []byte {
+	n = s.readable(offset, n)
+	if n == 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	got, _ := s.r.ReadAt(buf, offset)
+	return buf[:max(got, 0)]
+}
+
+// elementAt reads the element header at offset.
+func (s *clusterScanner) elementAt(offset int64) (Element, bool) {
+	data := s.read(offset, 12) // Longest ID (4) and size (8)
+	if len(data) == 0 {
+		return Element{}, false
+	}
+	elem, err := ReadElementHeader(bytes.NewReader(data), offset)
+	return elem, err == nil
+}
+
+// childUint returns the value of the first child of parent with the given
+// ID, looking only at the first few children, or -1 if it is not found.
+func (s *clusterScanner) childUint(parent Element, id uint64) int64 {
+	const maxChildren = 16
+	end := s.segEnd
+	if parent.Size >= 0 {
+		end = parent.DataOffset + parent.Size
+	}
+	offset := parent.DataOffset
+	for range maxChildren {
+		if offset >= end {
+			break
+		}
+		elem, ok := s.elementAt(offset)
+		if !ok || elem.Size < 0 || elem.Size > end-elem.DataOffset {
+			break
+		}
+		if elem.ID == id {
+			data := s.read(elem.DataOffset, elem.Size)
+			if int64(len(data)) != elem.Size {
+				break
+			}
+			v, err := ReadUint(bytes.NewReader(data), elem.Size)
+			if err != nil || int64(v) < 0 {
+				break
+			}
+			return int64(v)
+		}
+		offset = elem.DataOffset + elem.Size
+	}
+	return -1
+}
+
+// resync returns the offset of the first Cluster at or after from, or -1
+// if there is none. A match must parse as a Cluster that fits in the
+// Segment and starts with its timestamp.
+func (s *clusterScanner) resync(from int64) int64 {
+	const window = 1024 * 1024
+	offset := from
+	for offset < s.segEnd {
+		n := s.readable(offset, window)
+		if n == 0 {
+			// Jump past the skipped range that starts here
+			next := s.segEnd
+			for _, sr := range s.skip {
+				if sr.Start <= offset && offset < sr.End {
+					next = sr.End
+					break
+				}
+			}
+			offset = next
+			continue
+		}
+		buf := s.read(offset, n)
+		for pos := 0; ; {
+			i := bytes.Index(buf[pos:], clusterIDBytes)
+			if i < 0 {
+				break
+			}
+			candidate := offset + int64(pos+i)
+			if elem, ok := s.elementAt(candidate); ok && elem.ID == IDCluster &&
+				(elem.Size < 0 || elem.Size <= s.segEnd-elem.DataOffset) && s.childUint(elem, IDTimestamp) >= 0 {
+				return candidate
+			}
+			pos += i + 1
+		}
+		switch got := int64(len(buf)); {
+		case got < n:
+			// A read failed: step over the failing byte and a little
+			// more, as the rest of the failing region fails alike.
+			offset += got + resyncFailureStep
+		case n <= int64(len(clusterIDBytes)):
+			offset += n
+		default:
+			// Overlap windows so that an ID across a boundary is found
+			offset += n - int64(len(clusterIDBytes)) + 1
+		}
+	}
+	return -1
+}
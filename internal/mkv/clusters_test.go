@@ -0,0 +1,82 @@
+package mkv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingReaderAt fails reads that touch [bad, bad+n).
+type failingReaderAt struct {
+	data   []byte
+	bad, n int64
+}
+
+func (f *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	if off < f.bad+f.n && end > f.bad {
+		good := max(f.bad-off, 0)
+		copy(p, f.data[off:off+good])
+		return int(good), errors.New("unreadable")
+	}
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+func TestScanClusters(t *testing.T) {
+	ebmlHeader := ebmlElement(IDEBMLHeader, []byte{0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'})
+	info := ebmlElement(IDInfo, ebmlElement(IDTimestampScale, []byte{0x07, 0xA1, 0x20})) // 500000 ns
+	cluster := func(ts byte) []byte {
+		return ebmlElement(IDCluster,
+			ebmlElement(IDTimestamp, []byte{0x07, ts}),
+			ebmlElement(IDSimpleBlock, bytes.Repeat([]byte{0xAB}, 1000)))
+	}
+	clusters := [][]byte{cluster(0x00), cluster(0xD0), cluster(0xFF)}
+	segment := ebmlElement(IDSegment, append(append(append([]byte(nil), info...), clusters[0]...), append(clusters[1], clusters[2]...)...))
+	data := append(append([]byte(nil), ebmlHeader...), segment...)
+
+	offsets := make([]int64, 3)
+	offsets[0] = int64(len(data) - len(clusters[0]) - len(clusters[1]) - len(clusters[2]))
+	offsets[1] = offsets[0] + int64(len(clusters[0]))
+	offsets[2] = offsets[1] + int64(len(clusters[1]))
+	all := []ClusterPosition{
+		{offsets[0], 0x0700 * 500 * time.Microsecond},
+		{offsets[1], 0x07D0 * 500 * time.Microsecond},
+		{offsets[2], 0x07FF * 500 * time.Microsecond},
+	}
+
+	for _, tt := range []struct {
+		name string
+		r    func() *failingReaderAt
+		skip []ByteRange
+		want []ClusterPosition
+	}{
+		{"intact", func() *failingReaderAt { return &failingReaderAt{data: data} }, nil, all},
+		{"damage inside a cluster", func() *failingReaderAt { return &failingReaderAt{data: data} },
+			[]ByteRange{{offsets[0] + 100, offsets[0] + 200}}, all},
+		{"damaged cluster header", func() *failingReaderAt { return &failingReaderAt{data: data} },
+			[]ByteRange{{offsets[1], offsets[1] + 100}}, []ClusterPosition{all[0], all[2]}},
+		{"damaged segment header", func() *failingReaderAt { return &failingReaderAt{data: data} },
+			// Info is not found either, so the default 1ms scale applies
+			[]ByteRange{{int64(len(ebmlHeader)), int64(len(ebmlHeader)) + 4}}, []ClusterPosition{
+				{offsets[0], 0x0700 * time.Millisecond},
+				{offsets[1], 0x07D0 * time.Millisecond},
+				{offsets[2], 0x07FF * time.Millisecond},
+			}},
+		{"failed reads", func() *failingReaderAt {
+			return &failingReaderAt{data: data, bad: offsets[1] - 50, n: 60}
+		}, nil, []ClusterPosition{all[0], all[2]}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScanClusters(tt.r(), int64(len(data)), tt.skip)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ScanClusters = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("cluster %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 )
 
 // EBML Element IDs (Matroska specification)
@@ -30,6 +31,11 @@ const (
 	IDCues     = 0x1C53BB6B
 	IDTags     = 0x1254C367
 
+	// Segment information elements
+	IDTimestampScale = 0x2AD7B1
+	IDDuration       = 0x4489
+	IDTitle          = 0x7BA9
+
 	// Cluster elements
 	IDTimestamp   = 0xE7
 	IDSimpleBlock = 0xA3
@@ -43,6 +49,21 @@ const (
 	IDTrackType    = 0x83
 	IDCodecID      = 0x86
 	IDCodecPrivate = 0x63A2
+	IDName         = 0x536E
+	IDLanguage     = 0x22B59C
+	IDLanguageBCP  = 0x22B59D
+	IDFlagDefault  = 0x88
+	IDFlagForced   = 0x55AA
+	IDVideo        = 0xE0
+	IDPixelWidth   = 0xB0
+	IDPixelHeight  = 0xBA
+	IDAudio        = 0xE1
+	IDSamplingFreq = 0xB5
+	IDChannels     = 0x9F
+
+	// Chapter elements
+	IDEditionEntry = 0x45B9
+	IDChapterAtom  = 0xB6
 )
 
 // Track types
@@ -225,6 +246,21 @@ func ReadInt(r io.Reader, size int64) (int64, error) {
 	return int64(u), nil
 }
 
+// ReadFloat reads a float element value (4 or 8 bytes, or 0 for 0.0).
+func ReadFloat(r io.Reader, size int64) (float64, error) {
+	if size != 0 && size != 4 && size != 8 {
+		return 0, fmt.Errorf("invalid float size: %d", size)
+	}
+	u, err := ReadUint(r, size)
+	if err != nil {
+		return 0, err
+	}
+	if size == 4 {
+		return float64(math.Float32frombits(uint32(u))), nil
+	}
+	return math.Float64frombits(u), nil
+}
+
 // ReadString reads a string element value.
 func ReadString(r io.Reader, size int64) (string, error) {
 	if size < 0 {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/stuckj/mkvdup/internal/mmap"
 )
@@ -25,6 +26,18 @@ type Track struct {
 	Type         int
 	CodecID      string
 	CodecPrivate []byte // Codec-specific init data (zero-copy slice into mmap'd data)
+	Name         string
+	Language     string // BCP 47 tag if present, else ISO 639-2 ("eng" if unset)
+	Default      bool
+	Forced       bool
+
+	// Video tracks
+	PixelWidth  uint64
+	PixelHeight uint64
+
+	// Audio tracks
+	Channels     uint64
+	SamplingFreq float64 // Hz
 }
 
 // Parser parses MKV files to extract codec packets.
@@ -35,6 +48,9 @@ type Parser struct {
 	size     int64
 	tracks   []Track
 	packets  []Packet
+	duration time.Duration
+	title    string
+	chapters int
 }
 
 // NewParser creates a new MKV parser for the given file.
@@ -57,6 +73,15 @@ func NewParser(path string) (*Parser, error) {
 	}, nil
 }
 
+// NewParserFromData creates a parser over MKV data that is already memory-mapped.
+// The caller owns the mapping, so Close does not release it.
+func NewParserFromData(data []byte) *Parser {
+	return &Parser{
+		data: data,
+		size: int64(len(data)),
+	}
+}
+
 // Close releases resources used by the parser.
 func (p *Parser) Close() error {
 	if p.mmapFile != nil {
@@ -121,11 +146,17 @@ func (p *Parser) Parse(progress ProgressFunc) error {
 		}
 
 		switch elem.ID {
+		case IDInfo:
+			p.parseInfo(elem)
+
 		case IDTracks:
 			if err := p.parseTracks(elem); err != nil {
 				return fmt.Errorf("parse tracks: %w", err)
 			}
 
+		case IDChapters:
+			p.parseChapters(elem)
+
 		case IDCluster:
 			if err := p.parseCluster(elem, &clusterTimestamp); err != nil {
 				return fmt.Errorf("parse cluster at %d: %w", offset, err)
@@ -160,6 +191,38 @@ func (p *Parser) readElementAt(offset int64) (Element, error) {
 	return ReadElementHeader(r, offset)
 }
 
+// parseInfo reads the segment duration and title from the Info element.
+// Malformed values are ignored, leaving them unknown.
+func (p *Parser) parseInfo(infoElem Element) {
+	timestampScale := uint64(1000000) // Matroska default: 1ms
+	var duration float64
+	offset := infoElem.DataOffset
+	end := infoElem.DataOffset + infoElem.Size
+
+	for offset < end {
+		elem, err := p.readElementAt(offset)
+		if err != nil || elem.Size < 0 || elem.DataOffset+elem.Size > end {
+			return
+		}
+		r := bytes.NewReader(p.data[elem.DataOffset : elem.DataOffset+elem.Size])
+		switch elem.ID {
+		case IDTimestampScale:
+			if v, err := ReadUint(r, elem.Size); err == nil && v > 0 {
+				timestampScale = v
+			}
+		case IDDuration:
+			duration, _ = ReadFloat(r, elem.Size)
+		case IDTitle:
+			p.title, _ = ReadString(r, elem.Size)
+		}
+		offset = elem.DataOffset + elem.Size
+	}
+
+	if duration > 0 {
+		p.duration = time.Duration(duration * float64(timestampScale))
+	}
+}
+
 // parseTracks parses the Tracks element to extract track information.
 func (p *Parser) parseTracks(tracksElem Element) error {
 	offset := tracksElem.DataOffset
@@ -185,9 +248,11 @@ func (p *Parser) parseTracks(tracksElem Element) error {
 	return nil
 }
 
-// parseTrackEntry parses a TrackEntry element.
+// parseTrackEntry parses a TrackEntry element. Unset flags and language
+// take their Matroska defaults.
 func (p *Parser) parseTrackEntry(trackElem Element) (Track, error) {
-	var track Track
+	track := Track{Language: "eng", Default: true}
+	var bcp47 string
 	offset := trackElem.DataOffset
 	end := trackElem.DataOffset + trackElem.Size
 
@@ -213,14 +278,95 @@ func (p *Parser) parseTrackEntry(trackElem Element) (Track, error) {
 		case IDCodecPrivate:
 			// Zero-copy: slice directly into mmap'd data
 			track.CodecPrivate = p.data[elem.DataOffset : elem.DataOffset+elem.Size]
+		case IDName:
+			track.Name, _ = ReadString(r, elem.Size)
+		case IDLanguage:
+			track.Language, _ = ReadString(r, elem.Size)
+		case IDLanguageBCP:
+			bcp47, _ = ReadString(r, elem.Size)
+		case IDFlagDefault:
+			v, _ := ReadUint(r, elem.Size)
+			track.Default = v != 0
+		case IDFlagForced:
+			v, _ := ReadUint(r, elem.Size)
+			track.Forced = v != 0
+		case IDVideo, IDAudio:
+			p.parseTrackSettings(elem, &track)
 		}
 
 		offset = elem.DataOffset + elem.Size
 	}
 
+	if bcp47 != "" {
+		track.Language = bcp47
+	}
 	return track, nil
 }
 
+// parseTrackSettings reads the picture size from a Video element or the
+// channel count and sampling frequency from an Audio element. Malformed
+// values are ignored.
+func (p *Parser) parseTrackSettings(settingsElem Element, track *Track) {
+	if settingsElem.ID == IDAudio {
+		track.Channels = 1 // Matroska defaults
+		track.SamplingFreq = 8000
+	}
+	offset := settingsElem.DataOffset
+	end := settingsElem.DataOffset + settingsElem.Size
+
+	for offset < end {
+		elem, err := p.readElementAt(offset)
+		if err != nil || elem.Size < 0 || elem.DataOffset+elem.Size > end {
+			return
+		}
+		r := bytes.NewReader(p.data[elem.DataOffset : elem.DataOffset+elem.Size])
+		switch elem.ID {
+		case IDPixelWidth:
+			track.PixelWidth, _ = ReadUint(r, elem.Size)
+		case IDPixelHeight:
+			track.PixelHeight, _ = ReadUint(r, elem.Size)
+		case IDChannels:
+			if v, err := ReadUint(r, elem.Size); err == nil {
+				track.Channels = v
+			}
+		case IDSamplingFreq:
+			if v, err := ReadFloat(r, elem.Size); err == nil {
+				track.SamplingFreq = v
+			}
+		}
+		offset = elem.DataOffset + elem.Size
+	}
+}
+
+// parseChapters counts the top-level chapters of the first edition in the
+// Chapters element. Malformed elements end the count.
+func (p *Parser) parseChapters(chaptersElem Element) {
+	offset := chaptersElem.DataOffset
+	end := chaptersElem.DataOffset + chaptersElem.Size
+
+	for offset < end {
+		elem, err := p.readElementAt(offset)
+		if err != nil || elem.Size < 0 || elem.DataOffset+elem.Size > end {
+			return
+		}
+		if elem.ID == IDEditionEntry {
+			editionEnd := elem.DataOffset + elem.Size
+			for o := elem.DataOffset; o < editionEnd; {
+				atom, err := p.readElementAt(o)
+				if err != nil || atom.Size < 0 || atom.DataOffset+atom.Size > editionEnd {
+					return
+				}
+				if atom.ID == IDChapterAtom {
+					p.chapters++
+				}
+				o = atom.DataOffset + atom.Size
+			}
+			return
+		}
+		offset = elem.DataOffset + elem.Size
+	}
+}
+
 // parseCluster parses a Cluster element and extracts packets.
 func (p *Parser) parseCluster(clusterElem Element, clusterTimestamp *int64) error {
 	offset := clusterElem.DataOffset
@@ -422,6 +568,9 @@ func (p *Parser) ParseTracksOnly() error {
 			return fmt.Errorf("read element at %d: %w", offset, err)
 		}
 
+		if elem.ID == IDInfo {
+			p.parseInfo(elem)
+		}
 		if elem.ID == IDTracks {
 			if err := p.parseTracks(elem); err != nil {
 				return fmt.Errorf("parse tracks: %w", err)
@@ -439,6 +588,24 @@ func (p *Parser) ParseTracksOnly() error {
 	return fmt.Errorf("no Tracks element found")
 }
 
+// Duration returns the segment duration from the Info element, or 0 if the
+// file does not declare one.
+func (p *Parser) Duration() time.Duration {
+	return p.duration
+}
+
+// Title returns the segment title from the Info element, or "" if the file
+// does not declare one.
+func (p *Parser) Title() string {
+	return p.title
+}
+
+// ChapterCount returns the number of chapters in the first edition, or 0 if
+// the file has no chapters. Only Parse reads chapters.
+func (p *Parser) ChapterCount() int {
+	return p.chapters
+}
+
 // Tracks returns all parsed tracks.
 func (p *Parser) Tracks() []Track {
 	return p.tracks
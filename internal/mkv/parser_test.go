@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestParseTracksOnly_Basic(t *testing.T) {
@@ -48,6 +49,25 @@ func TestParseTracksOnly_Basic(t *testing.T) {
 	}
 }
 
+func TestNewParserFromData(t *testing.T) {
+	data, numPackets := createSyntheticMKV(2, 3, 64)
+
+	parser := NewParserFromData(data)
+	if err := parser.Parse(nil); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if len(parser.Packets()) != numPackets {
+		t.Errorf("got %d packets, want %d", len(parser.Packets()), numPackets)
+	}
+	if parser.Size() != int64(len(data)) {
+		t.Errorf("Size() = %d, want %d", parser.Size(), len(data))
+	}
+	// The caller owns the data; Close must not unmap it
+	if err := parser.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+}
+
 func TestParseTracksOnly_NoTracks(t *testing.T) {
 	// Build MKV with EBML header + Segment but no Tracks element
 	var buf bytes.Buffer
@@ -137,3 +157,116 @@ func TestParseTracksOnly_UnknownSizeElement(t *testing.T) {
 		t.Error("expected error for unknown-size element before Tracks, got nil")
 	}
 }
+
+func TestParser_Duration(t *testing.T) {
+	ebmlHeaderData := []byte{0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'}
+	trackEntry := []byte{0xD7, 0x81, 0x01, 0x83, 0x81, 0x01, 0x86, 0x82, 'V', '1'}
+
+	// Info: TimestampScale = 1000000 (1ms), Duration = 90500.0 as a float64
+	var info bytes.Buffer
+	info.Write([]byte{0x2A, 0xD7, 0xB1, 0x83, 0x0F, 0x42, 0x40})
+	info.Write([]byte{0x44, 0x89, 0x88, 0x40, 0xF6, 0x18, 0x40, 0x00, 0x00, 0x00, 0x00})
+
+	var segment bytes.Buffer
+	segment.Write(encodeElementID(IDInfo))
+	segment.Write(encodeVINT(uint64(info.Len())))
+	segment.Write(info.Bytes())
+	segment.Write(encodeElementID(IDTracks))
+	segment.Write(encodeVINT(uint64(len(trackEntry) + 2)))
+	segment.Write(encodeElementID(IDTrackEntry))
+	segment.Write(encodeVINT(uint64(len(trackEntry))))
+	segment.Write(trackEntry)
+
+	var buf bytes.Buffer
+	buf.Write(encodeElementID(IDEBMLHeader))
+	buf.Write(encodeVINT(uint64(len(ebmlHeaderData))))
+	buf.Write(ebmlHeaderData)
+	buf.Write(encodeElementID(IDSegment))
+	buf.Write(encodeVINT(uint64(segment.Len())))
+	buf.Write(segment.Bytes())
+
+	parser := NewParserFromData(buf.Bytes())
+	if err := parser.ParseTracksOnly(); err != nil {
+		t.Fatalf("ParseTracksOnly error: %v", err)
+	}
+	if got, want := parser.Duration(), 90500*time.Millisecond; got != want {
+		t.Errorf("Duration() = %v, want %v", got, want)
+	}
+
+	// Without an Info element the duration is unknown
+	data, _ := createSyntheticMKV(1, 1, 64)
+	parser = NewParserFromData(data)
+	if err := parser.Parse(nil); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if parser.Duration() != 0 {
+		t.Errorf("Duration() without Info = %v, want 0", parser.Duration())
+	}
+}
+
+// ebmlElement encodes an EBML element with the given ID and data.
+func ebmlElement(id uint64, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	out := append(encodeElementID(id), encodeVINT(uint64(len(body)))...)
+	return append(out, body...)
+}
+
+func TestParser_Metadata(t *testing.T) {
+	ebmlHeaderData := []byte{0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'}
+	video := ebmlElement(IDTrackEntry,
+		ebmlElement(IDTrackNum, []byte{1}),
+		ebmlElement(IDTrackType, []byte{TrackTypeVideo}),
+		ebmlElement(IDCodecID, []byte("V_MPEG2")),
+		ebmlElement(IDVideo,
+			ebmlElement(IDPixelWidth, []byte{0x02, 0xD0}),
+			ebmlElement(IDPixelHeight, []byte{0x01, 0xE0})))
+	audio := ebmlElement(IDTrackEntry,
+		ebmlElement(IDTrackNum, []byte{2}),
+		ebmlElement(IDTrackType, []byte{TrackTypeAudio}),
+		ebmlElement(IDCodecID, []byte("A_AC3")),
+		ebmlElement(IDName, []byte("Commentary")),
+		ebmlElement(IDLanguage, []byte("fre")),
+		ebmlElement(IDLanguageBCP, []byte("fr-CA")),
+		ebmlElement(IDFlagDefault, []byte{0}),
+		ebmlElement(IDAudio,
+			ebmlElement(IDChannels, []byte{6}),
+			ebmlElement(IDSamplingFreq, []byte{0x40, 0xE7, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00})))
+	chapters := ebmlElement(IDChapters,
+		ebmlElement(IDEditionEntry,
+			ebmlElement(IDChapterAtom, []byte{}),
+			ebmlElement(IDChapterAtom, ebmlElement(IDChapterAtom, []byte{})),
+			ebmlElement(IDChapterAtom, []byte{})),
+		ebmlElement(IDEditionEntry, ebmlElement(IDChapterAtom, []byte{})))
+
+	var buf bytes.Buffer
+	buf.Write(ebmlElement(IDEBMLHeader, ebmlHeaderData))
+	buf.Write(ebmlElement(IDSegment,
+		ebmlElement(IDInfo, ebmlElement(IDTitle, []byte("Feature Presentation"))),
+		ebmlElement(IDTracks, video, audio),
+		chapters))
+
+	parser := NewParserFromData(buf.Bytes())
+	if err := parser.Parse(nil); err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if parser.Title() != "Feature Presentation" {
+		t.Errorf("Title() = %q", parser.Title())
+	}
+	if parser.ChapterCount() != 3 {
+		t.Errorf("ChapterCount() = %d, want 3 (nested and second-edition chapters excluded)", parser.ChapterCount())
+	}
+	tracks := parser.Tracks()
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	v, a := tracks[0], tracks[1]
+	if v.PixelWidth != 720 || v.PixelHeight != 480 || v.Language != "eng" || !v.Default {
+		t.Errorf("video track = %+v, want 720x480, language eng, default", v)
+	}
+	if a.Name != "Commentary" || a.Language != "fr-CA" || a.Default || a.Forced {
+		t.Errorf("audio track = %+v, want Commentary, fr-CA, not default or forced", a)
+	}
+	if a.Channels != 6 || a.SamplingFreq != 48000 {
+		t.Errorf("audio channels = %d, sampling frequency = %v; want 6, 48000", a.Channels, a.SamplingFreq)
+	}
+}
@@ -0,0 +1,272 @@
+package mkv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamReadSize is how much a StreamParser reads ahead at a time.
+const streamReadSize = 4 * 1024 * 1024
+
+// Window is a run of whole top-level elements of an MKV read by a
+// StreamParser. Consecutive windows cover the stream without gaps.
+type Window struct {
+	Offset  int64    // Stream offset of Data[0]
+	Data    []byte   // The window's bytes
+	Packets []Packet // Packets in Data, with offsets relative to Data
+}
+
+// StreamParser parses an MKV read sequentially, such as from a pipe, without
+// ever holding all of it. The stream is cut into windows of whole top-level
+// elements; packets are found in each window's clusters as it is read.
+type StreamParser struct {
+	r          io.Reader
+	eof        bool
+	buf        []byte // Data read but not yet returned in a window
+	offset     int64  // Stream offset of buf[0]
+	pos        int    // Start of the next unparsed element in buf
+	segmentEnd int64  // Stream offset where the Segment ends (-1 if unknown size)
+	headerDone bool
+
+	info             Parser // Tracks, duration, title and chapters found so far
+	blocks           Parser // Parses clusters in buf; collects the window's packets
+	clusterTimestamp int64
+}
+
+// NewStreamParser returns a parser for the MKV read from r.
+func NewStreamParser(r io.Reader) *StreamParser {
+	return &StreamParser{r: r, segmentEnd: -1}
+}
+
+// ReadHeaders reads the MKV up to its first cluster, so that its tracks,
+// title, duration and chapters are known before any packet is. The headers
+// are returned as part of the first window.
+func (s *StreamParser) ReadHeaders() error {
+	if s.headerDone {
+		return nil
+	}
+	elem, err := s.elementAt(0)
+	if err != nil {
+		return fmt.Errorf("read EBML header: %w", err)
+	}
+	if elem.ID != IDEBMLHeader {
+		return fmt.Errorf("expected EBML header, got 0x%X", elem.ID)
+	}
+	if err := s.need(elem.DataOffset + elem.Size); err != nil {
+		return fmt.Errorf("read EBML header: %w", err)
+	}
+
+	elem, err = s.elementAt(elem.DataOffset + elem.Size)
+	if err != nil {
+		return fmt.Errorf("read Segment: %w", err)
+	}
+	if elem.ID != IDSegment {
+		return fmt.Errorf("expected Segment, got 0x%X", elem.ID)
+	}
+	if elem.Size >= 0 {
+		s.segmentEnd = elem.DataOffset + elem.Size
+	}
+	s.pos = int(elem.DataOffset)
+	s.headerDone = true
+
+	for {
+		elem, ok, err := s.nextElement()
+		if err != nil {
+			return err
+		}
+		if !ok || elem.ID == IDCluster {
+			return nil
+		}
+		if err := s.parseElement(elem); err != nil {
+			return err
+		}
+	}
+}
+
+// NextWindow parses the stream until at least size bytes are read since the
+// last window, or it ends, and returns the elements read as a window. It
+// returns io.EOF once the whole stream has been returned.
+func (s *StreamParser) NextWindow(size int) (*Window, error) {
+	if err := s.ReadHeaders(); err != nil {
+		return nil, err
+	}
+	for s.pos < size {
+		elem, ok, err := s.nextElement()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// Past the Segment: keep any trailing bytes as they are
+			if err := s.need(int64(size)); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, err
+			}
+			s.pos = len(s.buf)
+			if s.eof {
+				break
+			}
+			continue
+		}
+		if err := s.parseElement(elem); err != nil {
+			return nil, err
+		}
+	}
+	if s.pos == 0 {
+		return nil, io.EOF
+	}
+
+	w := &Window{Offset: s.offset, Data: s.buf[:s.pos:s.pos], Packets: s.blocks.packets}
+	s.buf = append(make([]byte, 0, max(len(s.buf)-s.pos, streamReadSize)), s.buf[s.pos:]...)
+	s.offset += int64(s.pos)
+	s.pos = 0
+	s.blocks.packets = nil
+	return w, nil
+}
+
+// nextElement returns the header of the top-level element at s.pos, with
+// offsets relative to buf. It returns false at the end of the Segment or
+// stream.
+func (s *StreamParser) nextElement() (Element, bool, error) {
+	if s.segmentEnd >= 0 && s.offset+int64(s.pos) >= s.segmentEnd {
+		return Element{}, false, nil
+	}
+	if err := s.need(int64(s.pos) + 1); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Element{}, false, nil
+		}
+		return Element{}, false, err
+	}
+	elem, err := s.elementAt(int64(s.pos))
+	if err != nil {
+		return Element{}, false, fmt.Errorf("read element at %d: %w", s.offset+int64(s.pos), err)
+	}
+	return elem, true, nil
+}
+
+// parseElement reads the whole top-level element elem, parses it if it is
+// one the parser uses, and moves past it.
+func (s *StreamParser) parseElement(elem Element) error {
+	start := int64(s.pos)
+	if elem.Size < 0 {
+		if elem.ID != IDCluster {
+			return fmt.Errorf("element 0x%X at %d has unknown size", elem.ID, s.offset+start)
+		}
+		end, err := s.clusterEnd(elem)
+		if err != nil {
+			return fmt.Errorf("cluster at %d: %w", s.offset+start, err)
+		}
+		elem.Size = end - elem.DataOffset
+	}
+	end := elem.DataOffset + elem.Size
+	if err := s.need(end); err != nil {
+		return fmt.Errorf("read element 0x%X at %d: %w", elem.ID, s.offset+start, err)
+	}
+
+	switch elem.ID {
+	case IDCluster:
+		s.blocks.data, s.blocks.size = s.buf, int64(len(s.buf))
+		err := s.blocks.parseCluster(elem, &s.clusterTimestamp)
+		s.blocks.data = nil
+		if err != nil {
+			return fmt.Errorf("parse cluster at %d: %w", s.offset+start, err)
+		}
+
+	case IDInfo, IDTracks, IDChapters:
+		// Copied, so the track codec data does not pin the window
+		s.info.data = bytes.Clone(s.buf[start:end])
+		s.info.size = end - start
+		elem.DataOffset -= start
+		switch elem.ID {
+		case IDInfo:
+			s.info.parseInfo(elem)
+		case IDTracks:
+			if err := s.info.parseTracks(elem); err != nil {
+				return fmt.Errorf("parse tracks: %w", err)
+			}
+		case IDChapters:
+			s.info.parseChapters(elem)
+		}
+	}
+
+	s.pos = int(end)
+	return nil
+}
+
+// clusterEnd returns where a cluster of unknown size ends: at the next
+// top-level element or the end of the stream.
+func (s *StreamParser) clusterEnd(cluster Element) (int64, error) {
+	offset := cluster.DataOffset
+	for {
+		if err := s.need(offset + 1); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return 0, err
+		}
+		elem, err := s.elementAt(offset)
+		if err != nil {
+			return 0, err
+		}
+		if isTopLevelElement(elem.ID) {
+			return offset, nil
+		}
+		if elem.Size < 0 {
+			return 0, fmt.Errorf("element 0x%X has unknown size", elem.ID)
+		}
+		offset = elem.DataOffset + elem.Size
+		if err := s.need(offset); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// elementAt reads the element header at offset in buf.
+func (s *StreamParser) elementAt(offset int64) (Element, error) {
+	// An element header is at most 12 bytes; the stream may end sooner
+	if err := s.need(offset + 12); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return Element{}, err
+	}
+	if offset >= int64(len(s.buf)) {
+		return Element{}, io.ErrUnexpectedEOF
+	}
+	return ReadElementHeader(bytes.NewReader(s.buf[offset:]), offset)
+}
+
+// need reads the stream until buf holds at least n bytes. It returns
+// io.ErrUnexpectedEOF if the stream ends first.
+func (s *StreamParser) need(n int64) error {
+	for int64(len(s.buf)) < n {
+		if s.eof {
+			return io.ErrUnexpectedEOF
+		}
+		if len(s.buf) == cap(s.buf) {
+			grown := make([]byte, len(s.buf), max(2*cap(s.buf), int(n)+streamReadSize))
+			copy(grown, s.buf)
+			s.buf = grown
+		}
+		read, err := s.r.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+read]
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size returns the number of bytes returned in windows so far; once
+// NextWindow has returned io.EOF, the size of the whole stream.
+func (s *StreamParser) Size() int64 {
+	return s.offset
+}
+
+// Parser returns a Parser holding the tracks, title, duration and chapter
+// count read so far. It has no packets and no data to read them from.
+func (s *StreamParser) Parser() *Parser {
+	p := s.info
+	p.data = nil
+	p.size = s.offset
+	return &p
+}
@@ -0,0 +1,154 @@
+package mkv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// unknownSize is an 8-byte EBML size marking an element of unknown size.
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// streamTestMKV returns an MKV with a title, two tracks, clusters of
+// SimpleBlocks and BlockGroups, and chapters after the clusters. With
+// unknownSizes, the Segment and the last cluster have unknown sizes.
+func streamTestMKV(unknownSizes bool) []byte {
+	block := func(track byte, fill byte, n int) []byte {
+		return append([]byte{0x80 | track, 0x00, 0x10, 0x80}, bytes.Repeat([]byte{fill}, n)...)
+	}
+	cluster := func(ts byte, blocks ...[]byte) []byte {
+		children := [][]byte{ebmlElement(IDTimestamp, []byte{ts})}
+		for i, b := range blocks {
+			if i%3 == 2 {
+				children = append(children, ebmlElement(IDBlockGroup, ebmlElement(IDBlock, b)))
+			} else {
+				children = append(children, ebmlElement(IDSimpleBlock, b))
+			}
+		}
+		return ebmlElement(IDCluster, children...)
+	}
+	tracks := ebmlElement(IDTracks,
+		ebmlElement(IDTrackEntry, ebmlElement(IDTrackNum, []byte{1}), ebmlElement(IDTrackType, []byte{TrackTypeVideo}),
+			ebmlElement(IDCodecID, []byte("V_MPEG2"))),
+		ebmlElement(IDTrackEntry, ebmlElement(IDTrackNum, []byte{2}), ebmlElement(IDTrackType, []byte{TrackTypeAudio}),
+			ebmlElement(IDCodecID, []byte("A_AC3"))))
+
+	var body bytes.Buffer
+	body.Write(ebmlElement(IDInfo, ebmlElement(IDTitle, []byte("Streamed"))))
+	body.Write(tracks)
+	body.Write(ebmlElement(0xEC, make([]byte, 50))) // Void
+	for i := range 5 {
+		body.Write(cluster(byte(i), block(1, byte(i), 300), block(2, 0xA0+byte(i), 40), block(1, 0xB0, 500)))
+	}
+	last := cluster(9, block(1, 0x99, 200), block(2, 0x98, 20))
+	if unknownSizes {
+		// Replace the cluster's size with an unknown one
+		header := append(encodeElementID(IDCluster), unknownSize...)
+		last = append(header, last[len(encodeElementID(IDCluster))+len(encodeVINT(uint64(len(last)))):]...)
+	}
+	body.Write(last)
+	body.Write(ebmlElement(IDChapters, ebmlElement(IDEditionEntry, ebmlElement(IDChapterAtom, []byte{}))))
+
+	var buf bytes.Buffer
+	buf.Write(ebmlElement(IDEBMLHeader, []byte{0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'}))
+	if unknownSizes {
+		buf.Write(append(encodeElementID(IDSegment), unknownSize...))
+		buf.Write(body.Bytes())
+	} else {
+		buf.Write(ebmlElement(IDSegment, body.Bytes()))
+		buf.WriteString("trailing bytes")
+	}
+	return buf.Bytes()
+}
+
+func TestStreamParser(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		unknownSizes bool
+		windowSize   int
+	}{
+		{"one window", false, 1 << 20},
+		{"small windows", false, 500},
+		{"unknown sizes", true, 700},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data := streamTestMKV(tt.unknownSizes)
+			want := NewParserFromData(data)
+			if err := want.Parse(nil); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			s := NewStreamParser(iotest.HalfReader(bytes.NewReader(data)))
+			if err := s.ReadHeaders(); err != nil {
+				t.Fatalf("ReadHeaders: %v", err)
+			}
+			if got := len(s.Parser().Tracks()); got != 2 {
+				t.Errorf("tracks after ReadHeaders = %d, want 2", got)
+			}
+
+			var packets []Packet
+			var streamed []byte
+			windows := 0
+			for {
+				w, err := s.NextWindow(tt.windowSize)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("NextWindow: %v", err)
+				}
+				if w.Offset != int64(len(streamed)) {
+					t.Fatalf("window %d at %d, want %d", windows, w.Offset, len(streamed))
+				}
+				for _, p := range w.Packets {
+					if p.Offset+p.Size > int64(len(w.Data)) {
+						t.Fatalf("packet %+v extends past its window of %d bytes", p, len(w.Data))
+					}
+					p.Offset += w.Offset
+					packets = append(packets, p)
+				}
+				streamed = append(streamed, w.Data...)
+				windows++
+			}
+
+			if !bytes.Equal(streamed, data) {
+				t.Errorf("windows hold %d bytes differing from the %d-byte stream", len(streamed), len(data))
+			}
+			if s.Size() != int64(len(data)) {
+				t.Errorf("Size = %d, want %d", s.Size(), len(data))
+			}
+			if tt.windowSize < len(data) && windows < 2 {
+				t.Errorf("got %d windows, want several", windows)
+			}
+			if len(packets) != len(want.Packets()) {
+				t.Fatalf("got %d packets, want %d", len(packets), len(want.Packets()))
+			}
+			for i, p := range want.Packets() {
+				if packets[i] != p {
+					t.Errorf("packet %d = %+v, want %+v", i, packets[i], p)
+				}
+			}
+			p := s.Parser()
+			if p.Title() != "Streamed" || p.ChapterCount() != 1 || len(p.Tracks()) != 2 || p.Size() != int64(len(data)) {
+				t.Errorf("Parser() = title %q, %d chapters, %d tracks, size %d",
+					p.Title(), p.ChapterCount(), len(p.Tracks()), p.Size())
+			}
+		})
+	}
+}
+
+func TestStreamParser_Truncated(t *testing.T) {
+	data := streamTestMKV(false)
+	s := NewStreamParser(bytes.NewReader(data[:len(data)-200]))
+	for {
+		_, err := s.NextWindow(1 << 20)
+		if errors.Is(err, io.EOF) {
+			t.Fatal("truncated stream read to the end without error")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -147,6 +147,39 @@ func DTSCoreFrameSize(data []byte) int {
 	return frameSize
 }
 
+// FindADTSPayloadSyncPoints returns the offsets of raw AAC frame data that
+// follows each ADTS header in data. MKV stores AAC frames without the ADTS
+// header (A_AAC), so the source must be indexed at the start of the frame
+// payload rather than at the ADTS sync word.
+//
+// ADTS header layout: syncword (12 bits, 0xFFF), ID (1), layer (2, always 0),
+// protection_absent (1), ... frame_length (13 bits, header included).
+// The header is 7 bytes, or 9 when a CRC is present (protection_absent=0).
+func FindADTSPayloadSyncPoints(data []byte) []int {
+	var offsets []int
+	for i := 0; i+7 <= len(data); i++ {
+		if data[i] != 0xFF || data[i+1]&0xF6 != 0xF0 {
+			continue
+		}
+		// sampling_frequency_index 13-15 are reserved
+		if (data[i+2]>>2)&0x0F >= 13 {
+			continue
+		}
+		hdrLen := 7
+		if data[i+1]&0x01 == 0 {
+			hdrLen = 9
+		}
+		frameLen := int(data[i+3]&0x03)<<11 | int(data[i+4])<<3 | int(data[i+5])>>5
+		if frameLen <= hdrLen {
+			continue
+		}
+		if i+hdrLen < len(data) {
+			offsets = append(offsets, i+hdrLen)
+		}
+	}
+	return offsets
+}
+
 // FindAllSyncPoints finds both video start codes and audio sync patterns.
 // Returns combined offsets sorted by position.
 func FindAllSyncPoints(data []byte) []int {
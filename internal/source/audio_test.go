@@ -252,6 +252,43 @@ func TestAC3FrameSize_AllValid(t *testing.T) {
 	}
 }
 
+func TestFindADTSPayloadSyncPoints(t *testing.T) {
+	// ADTS header: MPEG-4, layer 0, protection_absent=1, AAC LC, 48 kHz,
+	// frame_length = 7 + 9 = 16 bytes
+	frame := []byte{0xFF, 0xF1, 0x4C, 0x80, 0x02, 0x1F, 0xFC,
+		0x21, 0x10, 0x04, 0x60, 0x8C, 0x1C, 0x00, 0x00, 0x00}
+	// Same frame with CRC (protection_absent=0): 9-byte header
+	crcFrame := []byte{0xFF, 0xF0, 0x4C, 0x80, 0x02, 0x3F, 0xFC, 0xAB, 0xCD,
+		0x21, 0x10, 0x04, 0x60, 0x8C, 0x1C, 0x00, 0x00}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []int
+	}{
+		{"single frame", frame, []int{7}},
+		{"consecutive frames", append(append([]byte{}, frame...), frame...), []int{7, 23}},
+		{"frame with CRC", crcFrame, []int{9}},
+		{"MPEG audio layer II is not ADTS", []byte{0xFF, 0xFD, 0x84, 0x00, 0x10, 0x20, 0x30, 0x40}, nil},
+		{"reserved sample rate", []byte{0xFF, 0xF1, 0x7C, 0x80, 0x02, 0x1F, 0xFC, 0x00}, nil},
+		{"header at end of data", frame[:7], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindADTSPayloadSyncPoints(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("FindADTSPayloadSyncPoints() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("FindADTSPayloadSyncPoints() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
 func TestDTSCoreFrameSize(t *testing.T) {
 	tests := []struct {
 		name string
@@ -112,122 +112,6 @@ func parseBlurayClipInfoCodecs(data []byte) (*SourceCodecs, error) {
 	return codecs, nil
 }
 
-// findCLPIsInISO navigates an ISO9660 filesystem to find CLPI files
-// under BDMV/CLIPINF/. Returns the file extents or an error.
-func findCLPIsInISO(f *os.File) ([]isoFileExtent, error) {
-	rootLBA, rootLen, err := readISOPVDRoot(f)
-	if err != nil {
-		return nil, err
-	}
-
-	rootEntries, err := readISODirectory(f, rootLBA, rootLen)
-	if err != nil {
-		return nil, fmt.Errorf("read ISO root directory: %w", err)
-	}
-
-	bdmv, err := findISOEntry(rootEntries, "BDMV")
-	if err != nil {
-		return nil, fmt.Errorf("find BDMV directory: %w", err)
-	}
-
-	bdmvEntries, err := readISODirectory(f, uint32(bdmv.Offset/isoSectorSize), uint32(bdmv.Size))
-	if err != nil {
-		return nil, fmt.Errorf("read BDMV directory: %w", err)
-	}
-
-	clipinf, err := findISOEntry(bdmvEntries, "CLIPINF")
-	if err != nil {
-		return nil, fmt.Errorf("find CLIPINF directory: %w", err)
-	}
-
-	clipinfEntries, err := readISODirectory(f, uint32(clipinf.Offset/isoSectorSize), uint32(clipinf.Size))
-	if err != nil {
-		return nil, fmt.Errorf("read CLIPINF directory: %w", err)
-	}
-
-	var clpis []isoFileExtent
-	for _, e := range clipinfEntries {
-		if !e.IsDir && strings.HasSuffix(e.Name, ".CLPI") {
-			clpis = append(clpis, e)
-		}
-	}
-
-	if len(clpis) == 0 {
-		return nil, fmt.Errorf("no CLPI files found in BDMV/CLIPINF/")
-	}
-	return clpis, nil
-}
-
-// findCLPIsInUDF navigates a UDF filesystem to find CLPI files under BDMV/CLIPINF/.
-func findCLPIsInUDF(f *os.File) ([]isoFileExtent, error) {
-	ctx, err := newUDFContext(f)
-	if err != nil {
-		return nil, err
-	}
-
-	rootFIDs, err := ctx.readDirectoryFromFE(ctx.rootFE)
-	if err != nil {
-		return nil, fmt.Errorf("read UDF root directory: %w", err)
-	}
-
-	bdmvFE, err := ctx.lookupDir(rootFIDs, "BDMV")
-	if err != nil {
-		return nil, fmt.Errorf("find BDMV: %w", err)
-	}
-
-	bdmvFIDs, err := ctx.readDirectoryFromFE(bdmvFE)
-	if err != nil {
-		return nil, fmt.Errorf("read BDMV directory: %w", err)
-	}
-
-	clipinfFE, err := ctx.lookupDir(bdmvFIDs, "CLIPINF")
-	if err != nil {
-		return nil, fmt.Errorf("find CLIPINF: %w", err)
-	}
-
-	clipinfFIDs, err := ctx.readDirectoryFromFE(clipinfFE)
-	if err != nil {
-		return nil, fmt.Errorf("read CLIPINF directory: %w", err)
-	}
-
-	var clpis []isoFileExtent
-	for _, fid := range clipinfFIDs {
-		if fid.IsDir || fid.IsParent {
-			continue
-		}
-		name := strings.ToUpper(fid.Name)
-		if !strings.HasSuffix(name, ".CLPI") {
-			continue
-		}
-
-		fe, err := ctx.readFileEntryAt(fid.ICBLocation)
-		if err != nil {
-			continue
-		}
-
-		extents, err := ctx.resolveAllExtents(fe)
-		if err != nil || len(extents) == 0 {
-			continue
-		}
-
-		clpi := isoFileExtent{
-			Name:   name,
-			Offset: extents[0].ISOOffset,
-			Size:   int64(fe.InfoLength),
-			IsDir:  false,
-		}
-		if !extentsContiguous(extents) {
-			clpi.Extents = extents
-		}
-		clpis = append(clpis, clpi)
-	}
-
-	if len(clpis) == 0 {
-		return nil, fmt.Errorf("no CLPI files found in UDF BDMV/CLIPINF/")
-	}
-	return clpis, nil
-}
-
 // detectBlurayCodecsFromCLPIs reads CLPI files from within an ISO and returns
 // the unioned codec information from all clip info files.
 func detectBlurayCodecsFromCLPIs(f *os.File, clpis []isoFileExtent) (*SourceCodecs, error) {
@@ -0,0 +1,437 @@
+package source
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// BlurayPlaylist describes a Blu-ray movie playlist (BDMV/PLAYLIST/*.mpls):
+// the clips it plays and the streams it declares.
+type BlurayPlaylist struct {
+	Name     string        // playlist file name, e.g. "00800.mpls"
+	Disc     string        // ISO holding the playlist, relative to the source directory ("" for an extracted BDMV)
+	Clips    []string      // clip IDs (e.g. "00055") in play-item order, each listed once
+	Duration time.Duration // total duration of the play items
+	Codecs   *SourceCodecs // codecs declared by the play items' STN tables
+
+	// Stream counts of the first play item's STN table.
+	AudioStreams    int
+	SubtitleStreams int
+}
+
+// String returns the playlist name, qualified by its ISO for ISO sources.
+func (p *BlurayPlaylist) String() string {
+	if p.Disc != "" {
+		return p.Disc + ":" + p.Name
+	}
+	return p.Name
+}
+
+// hasClip reports whether the playlist plays the clip with the given ID.
+func (p *BlurayPlaylist) hasClip(clipID string) bool {
+	for _, c := range p.Clips {
+		if strings.EqualFold(c, clipID) {
+			return true
+		}
+	}
+	return false
+}
+
+// mplsTicksPerSecond is the clock of MPLS IN/OUT times.
+const mplsTicksPerSecond = 45000
+
+// parseBlurayPlaylist parses an MPLS file's PlayList section.
+//
+// MPLS header layout:
+//
+//	0x00-0x03: Type indicator ("MPLS")
+//	0x04-0x07: Version string
+//	0x08-0x0B: PlayList start offset (4 bytes, big-endian)
+//
+// PlayList layout:
+//
+//	[0-3]  Section length
+//	[4-5]  Reserved
+//	[6-7]  Number of play items
+//	[8-9]  Number of sub-paths
+//	Per play item:
+//	  [0-1]   Length of the rest of the play item
+//	  [2-6]   Clip ID ("00055")
+//	  [7-10]  Codec ID ("M2TS")
+//	  [12]    bit 4: is_multi_angle
+//	  [14-17] IN time (45 kHz)
+//	  [18-21] OUT time (45 kHz)
+//	  [22-33] UO mask, random access flag, still mode and time
+//	  If multi-angle: number of angles, flags, then per extra angle
+//	  clip ID(5) + codec ID(4) + STC ID(1)
+//	  STN table: length(2), reserved(2), numbers of primary video,
+//	  primary audio, PG, IG, secondary audio, secondary video and PiP PG
+//	  streams (1 each), reserved(5), then the stream entries. Each is a
+//	  stream_entry (length(1) + data) followed by stream_attributes
+//	  (length(1) + stream_coding_type(1) + ...).
+func parseBlurayPlaylist(data []byte) (*BlurayPlaylist, error) {
+	if len(data) < 12 || string(data[0:4]) != "MPLS" {
+		return nil, fmt.Errorf("not an MPLS file")
+	}
+	listStart := int(binary.BigEndian.Uint32(data[8:12]))
+	if listStart+10 > len(data) {
+		return nil, fmt.Errorf("PlayList offset %d beyond file size %d", listStart, len(data))
+	}
+	numItems := int(binary.BigEndian.Uint16(data[listStart+6 : listStart+8]))
+
+	pl := &BlurayPlaylist{Codecs: &SourceCodecs{}}
+	off := listStart + 10
+	for i := 0; i < numItems; i++ {
+		if off+2 > len(data) {
+			return nil, fmt.Errorf("play item %d beyond file size", i)
+		}
+		itemEnd := off + 2 + int(binary.BigEndian.Uint16(data[off:off+2]))
+		if itemEnd > len(data) || itemEnd < off+34 {
+			return nil, fmt.Errorf("play item %d truncated", i)
+		}
+		item := data[off:itemEnd]
+		pl.addClip(string(item[2:7]))
+		in := binary.BigEndian.Uint32(item[14:18])
+		out := binary.BigEndian.Uint32(item[18:22])
+		if out > in {
+			pl.Duration += time.Duration(out-in) * time.Second / mplsTicksPerSecond
+		}
+
+		p := 34
+		if item[12]&0x10 != 0 {
+			if p+2 > len(item) {
+				return nil, fmt.Errorf("play item %d: truncated angle list", i)
+			}
+			numAngles := int(item[p])
+			p += 2
+			for a := 1; a < numAngles; a++ {
+				if p+10 > len(item) {
+					return nil, fmt.Errorf("play item %d: truncated angle list", i)
+				}
+				pl.addClip(string(item[p : p+5]))
+				p += 10
+			}
+		}
+		audio, pg, err := pl.parseSTN(item[p:])
+		if err != nil {
+			return nil, fmt.Errorf("play item %d: %w", i, err)
+		}
+		if i == 0 {
+			pl.AudioStreams, pl.SubtitleStreams = audio, pg
+		}
+		off = itemEnd
+	}
+	if len(pl.Clips) == 0 {
+		return nil, fmt.Errorf("playlist has no play items")
+	}
+	return pl, nil
+}
+
+// addClip appends a clip ID unless the playlist already plays it.
+func (p *BlurayPlaylist) addClip(clipID string) {
+	if !p.hasClip(clipID) {
+		p.Clips = append(p.Clips, clipID)
+	}
+}
+
+// parseSTN adds the codecs of the primary video, primary audio and PG stream
+// entries of an STN table to the playlist's codecs, and returns the numbers
+// of audio and PG streams.
+func (p *BlurayPlaylist) parseSTN(stn []byte) (int, int, error) {
+	if len(stn) < 16 {
+		return 0, 0, fmt.Errorf("STN table truncated")
+	}
+	numVideo, numAudio, numPG := int(stn[4]), int(stn[5]), int(stn[6])
+
+	off := 16
+	for i := 0; i < numVideo+numAudio+numPG; i++ {
+		// stream_entry
+		if off >= len(stn) {
+			return 0, 0, fmt.Errorf("STN stream %d beyond table", i)
+		}
+		off += 1 + int(stn[off])
+		// stream_attributes
+		if off+1 >= len(stn) {
+			return 0, 0, fmt.Errorf("STN stream %d attributes beyond table", i)
+		}
+		attrLen := int(stn[off])
+		if attrLen > 0 {
+			ct := tsStreamTypeToCodecType(stn[off+1])
+			switch {
+			case ct == CodecUnknown:
+			case IsVideoCodec(ct):
+				if !containsCodec(p.Codecs.VideoCodecs, ct) {
+					p.Codecs.VideoCodecs = append(p.Codecs.VideoCodecs, ct)
+				}
+			case IsSubtitleCodec(ct):
+				if !containsCodec(p.Codecs.SubtitleCodecs, ct) {
+					p.Codecs.SubtitleCodecs = append(p.Codecs.SubtitleCodecs, ct)
+				}
+			default:
+				if !containsCodec(p.Codecs.AudioCodecs, ct) {
+					p.Codecs.AudioCodecs = append(p.Codecs.AudioCodecs, ct)
+				}
+			}
+		}
+		off += 1 + attrLen
+	}
+	return numAudio, numPG, nil
+}
+
+// maxMPLSSize caps the read size of a playlist. Real MPLS files are a few KB.
+const maxMPLSSize int64 = 1024 * 1024
+
+// ListBlurayPlaylists returns the playlists of a Blu-ray source: those in
+// BDMV/PLAYLIST of an extracted disc, or those of every Blu-ray ISO in the
+// directory. Playlists that fail to parse are skipped.
+func ListBlurayPlaylists(sourceDir string) ([]*BlurayPlaylist, error) {
+	sourceType, err := DetectType(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("detect source type: %w", err)
+	}
+	if sourceType != TypeBluray {
+		return nil, fmt.Errorf("playlists need a Blu-ray source, %s is %s", sourceDir, sourceType)
+	}
+
+	var playlists []*BlurayPlaylist
+	if playlistDir, ok := findPlaylistDir(sourceDir); ok {
+		entries, err := os.ReadDir(playlistDir)
+		if err != nil {
+			return nil, fmt.Errorf("read PLAYLIST directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".mpls") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(playlistDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			if pl, err := parseBlurayPlaylist(data); err == nil {
+				pl.Name = entry.Name()
+				playlists = append(playlists, pl)
+			}
+		}
+	} else {
+		files, err := EnumerateMediaFiles(sourceDir, TypeBluray)
+		if err != nil {
+			return nil, fmt.Errorf("enumerate files: %w", err)
+		}
+		for _, relPath := range files {
+			fullPath := filepath.Join(sourceDir, relPath)
+			if !isISOFile(relPath) || classifyISO(fullPath) != TypeBluray {
+				continue
+			}
+			isoPlaylists, err := listBlurayPlaylistsInISO(fullPath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", relPath, err)
+			}
+			for _, pl := range isoPlaylists {
+				pl.Disc = relPath
+			}
+			playlists = append(playlists, isoPlaylists...)
+		}
+	}
+
+	if len(playlists) == 0 {
+		return nil, fmt.Errorf("no playlists found in %s", sourceDir)
+	}
+	return playlists, nil
+}
+
+// findPlaylistDir returns the BDMV/PLAYLIST directory of an extracted disc.
+func findPlaylistDir(sourceDir string) (string, bool) {
+	for _, c := range []string{
+		filepath.Join(sourceDir, "BDMV", "PLAYLIST"),
+		filepath.Join(sourceDir, "bdmv", "playlist"),
+	} {
+		if info, err := os.Stat(c); err == nil && info.IsDir() {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// listBlurayPlaylistsInISO parses the playlists of a Blu-ray ISO, found
+// through UDF first and ISO9660 as a fallback.
+func listBlurayPlaylistsInISO(isoPath string) ([]*BlurayPlaylist, error) {
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mplsFiles, err := findBDMVFilesInUDF(f, "PLAYLIST", ".MPLS")
+	if err != nil {
+		var isoErr error
+		if mplsFiles, isoErr = findBDMVFilesInISO9660(f, "PLAYLIST", ".MPLS"); isoErr != nil {
+			return nil, fmt.Errorf("find playlists: %w (UDF attempt also failed: %v)", isoErr, err)
+		}
+	}
+
+	var playlists []*BlurayPlaylist
+	for _, mpls := range mplsFiles {
+		data, err := readISOFileExtent(f, mpls, maxMPLSSize)
+		if err != nil {
+			continue
+		}
+		if pl, err := parseBlurayPlaylist(data); err == nil {
+			pl.Name = mpls.Name
+			playlists = append(playlists, pl)
+		}
+	}
+	return playlists, nil
+}
+
+// FindBlurayPlaylist returns the playlist with the given name. The ".mpls"
+// extension is optional and case is ignored. When several ISOs have a
+// playlist of that name, it must be qualified as "<iso>:<name>".
+func FindBlurayPlaylist(playlists []*BlurayPlaylist, name string) (*BlurayPlaylist, error) {
+	disc := ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		disc, name = name[:i], name[i+1:]
+	}
+	base := strings.TrimSuffix(strings.ToUpper(name), ".MPLS")
+
+	var found []*BlurayPlaylist
+	for _, pl := range playlists {
+		if strings.TrimSuffix(strings.ToUpper(pl.Name), ".MPLS") != base {
+			continue
+		}
+		if disc != "" && filepath.Clean(disc) != filepath.Clean(pl.Disc) {
+			continue
+		}
+		found = append(found, pl)
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("playlist %s not found", name)
+	case 1:
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, pl := range found {
+		names[i] = pl.String()
+	}
+	return nil, fmt.Errorf("playlist %s is on several discs, use one of: %s", name, strings.Join(names, ", "))
+}
+
+// SelectBlurayPlaylist picks the playlist an MKV was most likely muxed from.
+// Playlists whose codecs cover the MKV's tracks are preferred, then the one
+// whose duration is closest to the MKV's (to the second), then the one whose
+// audio and subtitle stream counts are closest to the MKV's track counts.
+// Discs often carry many playlists with the same duration and streams that
+// only differ in clip order; any of them indexes the same clips. Without an
+// MKV duration, the longest playlist is taken as the main feature.
+func SelectBlurayPlaylist(playlists []*BlurayPlaylist, duration time.Duration, tracks []mkv.Track) (*BlurayPlaylist, error) {
+	if len(playlists) == 0 {
+		return nil, fmt.Errorf("no playlists to choose from")
+	}
+
+	var audio, subtitles int
+	for _, t := range tracks {
+		switch t.Type {
+		case mkv.TrackTypeAudio:
+			audio++
+		case mkv.TrackTypeSubtitle:
+			subtitles++
+		}
+	}
+
+	type candidate struct {
+		pl         *BlurayPlaylist
+		compatible bool
+		distance   time.Duration
+		layout     int
+	}
+	candidates := make([]candidate, len(playlists))
+	for i, pl := range playlists {
+		c := candidate{
+			pl:         pl,
+			compatible: len(CheckCodecCompatibility(tracks, pl.Codecs)) == 0,
+			layout:     abs(pl.AudioStreams-audio) + abs(pl.SubtitleStreams-subtitles),
+		}
+		if duration > 0 {
+			c.distance = (pl.Duration - duration).Abs().Round(time.Second)
+		} else {
+			c.distance = -pl.Duration.Round(time.Second)
+		}
+		candidates[i] = c
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.compatible != b.compatible {
+			return a.compatible
+		}
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		return a.layout < b.layout
+	})
+
+	best := candidates[0].pl
+	if duration > 0 {
+		// A remux of a playlist has its duration to within a few frames;
+		// allow for trimmed credits or padding, but not another title.
+		tolerance := max(duration/20, 10*time.Second)
+		if candidates[0].distance > tolerance {
+			return nil, fmt.Errorf("no playlist matches the MKV duration %s (closest is %s at %s)",
+				duration.Round(time.Second), best, best.Duration.Round(time.Second))
+		}
+	}
+	return best, nil
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// playlistM2TSFiles returns the extracted M2TS files (relative paths from
+// EnumerateMediaFiles) of the playlist's clips, in play-item order.
+func (p *BlurayPlaylist) playlistM2TSFiles(files []string) ([]string, error) {
+	byClip := make(map[string]string, len(files))
+	for _, f := range files {
+		clip := strings.ToUpper(strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)))
+		byClip[clip] = f
+	}
+	result := make([]string, 0, len(p.Clips))
+	for _, clip := range p.Clips {
+		f, ok := byClip[strings.ToUpper(clip)]
+		if !ok {
+			return nil, fmt.Errorf("clip %s of playlist %s not found in BDMV/STREAM", clip, p)
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// playlistM2TSExtents returns the M2TS regions of an ISO that hold the
+// playlist's clips, in play-item order.
+func (p *BlurayPlaylist) playlistM2TSExtents(m2tsFiles []isoFileExtent) ([]isoFileExtent, error) {
+	result := make([]isoFileExtent, 0, len(p.Clips))
+	for _, clip := range p.Clips {
+		found := false
+		for _, m := range m2tsFiles {
+			if strings.EqualFold(strings.TrimSuffix(m.Name, ".M2TS"), clip) {
+				result = append(result, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("clip %s of playlist %s not found in BDMV/STREAM", clip, p)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,358 @@
+package source
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// testPlayItem describes one play item of a test MPLS file. video, audio and
+// pg list the stream_coding_type of each STN entry.
+type testPlayItem struct {
+	clip    string
+	in, out uint32 // 45 kHz ticks
+	angles  []string
+	video   []byte
+	audio   []byte
+	pg      []byte
+}
+
+// buildTestMPLS creates a minimal MPLS binary with the given play items.
+func buildTestMPLS(items []testPlayItem) []byte {
+	const listStart = 40
+
+	var list []byte
+	for _, it := range items {
+		// clip(5) codec(4) flags(2) STC(1) IN(4) OUT(4) UO(8) RA(1) still(3)
+		body := make([]byte, 32)
+		copy(body[0:5], it.clip)
+		copy(body[5:9], "M2TS")
+		binary.BigEndian.PutUint32(body[12:16], it.in)
+		binary.BigEndian.PutUint32(body[16:20], it.out)
+		if len(it.angles) > 0 {
+			body[10] = 0x10 // is_multi_angle
+			body = append(body, byte(len(it.angles)+1), 0)
+			for _, a := range it.angles {
+				body = append(body, []byte(a+"M2TS")...)
+				body = append(body, 0)
+			}
+		}
+
+		stn := []byte{0, 0, 0, 0, byte(len(it.video)), byte(len(it.audio)), byte(len(it.pg)), 0, 0, 0, 0, 0, 0, 0, 0, 0}
+		for _, streams := range [][]byte{it.video, it.audio, it.pg} {
+			for _, ct := range streams {
+				stn = append(stn, 9, 1, 0x10, 0x11, 0, 0, 0, 0, 0, 0) // stream_entry: PID of the clip
+				stn = append(stn, 5, ct, 0, 0, 0, 0)                  // stream_attributes
+			}
+		}
+		binary.BigEndian.PutUint16(stn[0:2], uint16(len(stn)-2))
+		body = append(body, stn...)
+
+		list = binary.BigEndian.AppendUint16(list, uint16(len(body)))
+		list = append(list, body...)
+	}
+
+	data := make([]byte, listStart+10)
+	copy(data[0:4], "MPLS")
+	copy(data[4:8], "0200")
+	binary.BigEndian.PutUint32(data[8:12], listStart)
+	binary.BigEndian.PutUint32(data[listStart:listStart+4], uint32(6+len(list)))
+	binary.BigEndian.PutUint16(data[listStart+6:listStart+8], uint16(len(items)))
+	return append(data, list...)
+}
+
+func TestParseBlurayPlaylist(t *testing.T) {
+	data := buildTestMPLS([]testPlayItem{
+		{clip: "00055", in: 0, out: 45000 * 60, video: []byte{0x1B}, audio: []byte{0x86, 0x81}, pg: []byte{0x90}},
+		{clip: "00056", in: 45000, out: 45000 * 31, angles: []string{"00057"}, video: []byte{0x1B}, audio: []byte{0x83}},
+		{clip: "00055", in: 0, out: 45000 * 10, video: []byte{0x1B}},
+	})
+
+	pl, err := parseBlurayPlaylist(data)
+	if err != nil {
+		t.Fatalf("parseBlurayPlaylist() error = %v", err)
+	}
+	if want := []string{"00055", "00056", "00057"}; !reflect.DeepEqual(pl.Clips, want) {
+		t.Errorf("Clips = %v, want %v", pl.Clips, want)
+	}
+	if want := 100 * time.Second; pl.Duration != want {
+		t.Errorf("Duration = %v, want %v", pl.Duration, want)
+	}
+	if pl.AudioStreams != 2 || pl.SubtitleStreams != 1 {
+		t.Errorf("stream counts = %d audio, %d subtitle, want 2, 1", pl.AudioStreams, pl.SubtitleStreams)
+	}
+	if !reflect.DeepEqual(pl.Codecs.VideoCodecs, []CodecType{CodecH264Video}) {
+		t.Errorf("video = %v, want [H.264]", pl.Codecs.VideoCodecs)
+	}
+	if want := []CodecType{CodecDTSHDAudio, CodecAC3Audio, CodecTrueHDAudio}; !reflect.DeepEqual(pl.Codecs.AudioCodecs, want) {
+		t.Errorf("audio = %v, want %v", pl.Codecs.AudioCodecs, want)
+	}
+	if !reflect.DeepEqual(pl.Codecs.SubtitleCodecs, []CodecType{CodecPGSSubtitle}) {
+		t.Errorf("subtitles = %v, want [PGS]", pl.Codecs.SubtitleCodecs)
+	}
+}
+
+func TestParseBlurayPlaylist_Invalid(t *testing.T) {
+	valid := buildTestMPLS([]testPlayItem{{clip: "00001", out: 45000, video: []byte{0x1B}}})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"wrong magic", append([]byte("HDMV"), valid[4:]...)},
+		{"truncated play item", valid[:len(valid)-10]},
+		{"no play items", buildTestMPLS(nil)},
+	}
+	for _, tt := range tests {
+		if _, err := parseBlurayPlaylist(tt.data); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestFindBlurayPlaylist(t *testing.T) {
+	playlists := []*BlurayPlaylist{
+		{Name: "00800.mpls"},
+		{Name: "00001.MPLS", Disc: "disc1.iso"},
+		{Name: "00001.MPLS", Disc: "disc2.iso"},
+	}
+	for _, name := range []string{"00800.mpls", "00800", "00800.MPLS"} {
+		if pl, err := FindBlurayPlaylist(playlists, name); err != nil || pl != playlists[0] {
+			t.Errorf("FindBlurayPlaylist(%q) = %v, %v, want %v", name, pl, err, playlists[0])
+		}
+	}
+	if pl, err := FindBlurayPlaylist(playlists, "disc2.iso:00001"); err != nil || pl != playlists[2] {
+		t.Errorf("FindBlurayPlaylist(disc2.iso:00001) = %v, %v, want %v", pl, err, playlists[2])
+	}
+	if _, err := FindBlurayPlaylist(playlists, "00001.mpls"); err == nil || !strings.Contains(err.Error(), "disc1.iso:00001.MPLS") {
+		t.Errorf("FindBlurayPlaylist(ambiguous) error = %v, want the qualified names", err)
+	}
+	if _, err := FindBlurayPlaylist(playlists, "00999.mpls"); err == nil {
+		t.Error("expected error for a missing playlist")
+	}
+}
+
+func TestSelectBlurayPlaylist(t *testing.T) {
+	h264AC3 := &SourceCodecs{VideoCodecs: []CodecType{CodecH264Video}, AudioCodecs: []CodecType{CodecAC3Audio}}
+	vc1AC3 := &SourceCodecs{VideoCodecs: []CodecType{CodecVC1Video}, AudioCodecs: []CodecType{CodecAC3Audio}}
+	feature := &BlurayPlaylist{Name: "00800.mpls", Duration: 2 * time.Hour, Codecs: h264AC3, AudioStreams: 2, SubtitleStreams: 3}
+	decoy := &BlurayPlaylist{Name: "00801.mpls", Duration: 2*time.Hour + 200*time.Millisecond, Codecs: h264AC3, AudioStreams: 5, SubtitleStreams: 9}
+	vc1 := &BlurayPlaylist{Name: "00802.mpls", Duration: 2 * time.Hour, Codecs: vc1AC3, AudioStreams: 2, SubtitleStreams: 3}
+	extra := &BlurayPlaylist{Name: "00010.mpls", Duration: 20 * time.Minute, Codecs: h264AC3, AudioStreams: 1}
+	playlists := []*BlurayPlaylist{extra, vc1, decoy, feature}
+
+	tracks := []mkv.Track{
+		{Number: 1, Type: mkv.TrackTypeVideo, CodecID: "V_MPEG4/ISO/AVC"},
+		{Number: 2, Type: mkv.TrackTypeAudio, CodecID: "A_AC3"},
+		{Number: 3, Type: mkv.TrackTypeAudio, CodecID: "A_AC3"},
+		{Number: 4, Type: mkv.TrackTypeSubtitle, CodecID: "S_HDMV/PGS"},
+		{Number: 5, Type: mkv.TrackTypeSubtitle, CodecID: "S_HDMV/PGS"},
+	}
+
+	// Same duration to the second: the codecs and then the stream layout decide
+	got, err := SelectBlurayPlaylist(playlists, 2*time.Hour+100*time.Millisecond, tracks)
+	if err != nil || got != feature {
+		t.Errorf("SelectBlurayPlaylist(feature) = %v, %v, want %v", got, err, feature)
+	}
+	got, err = SelectBlurayPlaylist(playlists, 20*time.Minute+3*time.Second, tracks[:2])
+	if err != nil || got != extra {
+		t.Errorf("SelectBlurayPlaylist(extra) = %v, %v, want %v", got, err, extra)
+	}
+
+	// Without a duration, a longest playlist is taken as the main feature
+	got, err = SelectBlurayPlaylist(playlists, 0, nil)
+	if err != nil || got.Duration.Round(time.Second) != 2*time.Hour {
+		t.Errorf("SelectBlurayPlaylist(no duration) = %v, %v, want the longest playlist", got, err)
+	}
+
+	if _, err := SelectBlurayPlaylist(playlists, time.Hour, tracks); err == nil {
+		t.Error("expected error when no playlist is close to the MKV duration")
+	}
+}
+
+// writeTestBDMV writes an extracted Blu-ray with the given M2TS clips and
+// playlists.
+func writeTestBDMV(t *testing.T, dir string, clips map[string][]byte, playlists map[string][]byte) {
+	t.Helper()
+	for _, sub := range []string{"STREAM", "PLAYLIST"} {
+		if err := os.MkdirAll(filepath.Join(dir, "BDMV", sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range clips {
+		if err := os.WriteFile(filepath.Join(dir, "BDMV", "STREAM", name+".m2ts"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range playlists {
+		if err := os.WriteFile(filepath.Join(dir, "BDMV", "PLAYLIST", name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIndexer_PlaylistExtracted(t *testing.T) {
+	m2tsData := buildBasicM2TSData()
+	dir := t.TempDir()
+	writeTestBDMV(t, dir,
+		map[string][]byte{"00001": m2tsData, "00002": m2tsData, "00003": m2tsData},
+		map[string][]byte{
+			"00800.mpls": buildTestMPLS([]testPlayItem{
+				{clip: "00003", out: 45000, video: []byte{0x1B}, audio: []byte{0x81}},
+				{clip: "00001", out: 45000, video: []byte{0x1B}, audio: []byte{0x81}},
+			}),
+			"00801.mpls": buildTestMPLS([]testPlayItem{{clip: "00009", out: 45000, video: []byte{0x1B}}}),
+			"00802.mpls": []byte("garbage"),
+		})
+
+	playlists, err := ListBlurayPlaylists(dir)
+	if err != nil {
+		t.Fatalf("ListBlurayPlaylists() error = %v", err)
+	}
+	if len(playlists) != 2 {
+		t.Fatalf("ListBlurayPlaylists() = %v, want 2 parseable playlists", playlists)
+	}
+	pl, err := FindBlurayPlaylist(playlists, "00800")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer.SetPlaylist(pl)
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	var got []string
+	for _, f := range index.Files {
+		got = append(got, f.RelativePath)
+	}
+	want := []string{filepath.Join("BDMV", "STREAM", "00003.m2ts"), filepath.Join("BDMV", "STREAM", "00001.m2ts")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed files = %v, want %v", got, want)
+	}
+
+	// A playlist referencing a missing clip fails the build
+	missing, err := FindBlurayPlaylist(playlists, "00801.mpls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer, err = NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer.SetPlaylist(missing)
+	if err := indexer.Build(nil); err == nil || !strings.Contains(err.Error(), "00009") {
+		t.Errorf("Build() error = %v, want missing clip 00009", err)
+	}
+}
+
+// buildTestBlurayISOWithPlaylist creates an ISO9660 Blu-ray image with two
+// M2TS clips (00001 and 00002) and one playlist, 00800.MPLS.
+//
+// Layout:
+//
+//	Sector 20: Root directory
+//	Sector 21: BDMV directory
+//	Sector 22: STREAM directory
+//	Sector 23: PLAYLIST directory
+//	Sector 24+: M2TS data (twice), then the MPLS data
+func buildTestBlurayISOWithPlaylist(m2tsData, mplsData []byte) []byte {
+	const sector = 2048
+
+	m2tsSectors := (len(m2tsData) + sector - 1) / sector
+	clip1Sector := 24
+	clip2Sector := clip1Sector + m2tsSectors
+	mplsSector := clip2Sector + m2tsSectors
+	totalSectors := mplsSector + (len(mplsData)+sector-1)/sector + 1
+
+	iso := make([]byte, totalSectors*sector)
+
+	pvd := iso[16*sector:]
+	pvd[0] = 1
+	copy(pvd[1:6], "CD001")
+	pvd[6] = 1
+	writeISO9660DirRecord(pvd[156:], 20, sector)
+	iso[17*sector] = 255
+	copy(iso[17*sector+1:17*sector+6], "CD001")
+
+	rootDir := iso[20*sector:]
+	off := writeISO9660DirEntry(rootDir, "\x00", 20, sector, true)
+	off += writeISO9660DirEntry(rootDir[off:], "\x01", 20, sector, true)
+	writeISO9660DirEntry(rootDir[off:], "BDMV", 21, sector, true)
+
+	bdmvDir := iso[21*sector:]
+	off = writeISO9660DirEntry(bdmvDir, "\x00", 21, sector, true)
+	off += writeISO9660DirEntry(bdmvDir[off:], "\x01", 20, sector, true)
+	off += writeISO9660DirEntry(bdmvDir[off:], "STREAM", 22, sector, true)
+	writeISO9660DirEntry(bdmvDir[off:], "PLAYLIST", 23, sector, true)
+
+	streamDir := iso[22*sector:]
+	off = writeISO9660DirEntry(streamDir, "\x00", 22, sector, true)
+	off += writeISO9660DirEntry(streamDir[off:], "\x01", 21, sector, true)
+	off += writeISO9660DirEntry(streamDir[off:], "00001.M2TS", clip1Sector, len(m2tsData), false)
+	writeISO9660DirEntry(streamDir[off:], "00002.M2TS", clip2Sector, len(m2tsData), false)
+
+	playlistDir := iso[23*sector:]
+	off = writeISO9660DirEntry(playlistDir, "\x00", 23, sector, true)
+	off += writeISO9660DirEntry(playlistDir[off:], "\x01", 21, sector, true)
+	writeISO9660DirEntry(playlistDir[off:], "00800.MPLS", mplsSector, len(mplsData), false)
+
+	copy(iso[clip1Sector*sector:], m2tsData)
+	copy(iso[clip2Sector*sector:], m2tsData)
+	copy(iso[mplsSector*sector:], mplsData)
+	return iso
+}
+
+func TestIndexer_PlaylistISO(t *testing.T) {
+	mpls := buildTestMPLS([]testPlayItem{{clip: "00002", out: 45000 * 90, video: []byte{0x1B}, audio: []byte{0x81}}})
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "disc.iso"), buildTestBlurayISOWithPlaylist(buildBasicM2TSData(), mpls), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a playlist, both clips are indexed
+	indexer, err := NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(indexer.Index().Files); n != 2 {
+		t.Errorf("indexed %d M2TS regions without a playlist, want 2", n)
+	}
+	indexer.Index().Close()
+
+	playlists, err := ListBlurayPlaylists(dir)
+	if err != nil {
+		t.Fatalf("ListBlurayPlaylists() error = %v", err)
+	}
+	if len(playlists) != 1 || playlists[0].String() != "disc.iso:00800.MPLS" || playlists[0].Duration != 90*time.Second {
+		t.Fatalf("ListBlurayPlaylists() = %+v, want disc.iso:00800.MPLS of 90s", playlists)
+	}
+
+	indexer, err = NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer.SetPlaylist(playlists[0])
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+	if len(index.Files) != 1 || index.Files[0].RelativePath != "disc.iso" {
+		t.Errorf("indexed files = %+v, want one region of disc.iso", index.Files)
+	}
+}
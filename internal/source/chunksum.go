@@ -0,0 +1,56 @@
+package source
+
+import "github.com/cespare/xxhash/v2"
+
+// ChecksumChunkSize is the size of the chunks covered by
+// File.ChunkChecksums. Chunk checksums let corruption be located to a few
+// megabytes of a source file instead of the whole file.
+const ChecksumChunkSize = 4 * 1024 * 1024
+
+// ChunkHasher computes the xxhash of a whole file and of each fixed-size
+// chunk of it, from the file's contents written in order.
+type ChunkHasher struct {
+	chunkSize int64
+	whole     *xxhash.Digest
+	chunk     *xxhash.Digest
+	inChunk   int64 // Bytes written to the current chunk
+	sums      []uint64
+}
+
+// NewChunkHasher returns a ChunkHasher for chunks of chunkSize bytes.
+func NewChunkHasher(chunkSize int64) *ChunkHasher {
+	return &ChunkHasher{chunkSize: chunkSize, whole: xxhash.New(), chunk: xxhash.New()}
+}
+
+// Write adds p to the hashes. It never returns an error.
+func (h *ChunkHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	h.whole.Write(p)
+	for len(p) > 0 {
+		take := min(int64(len(p)), h.chunkSize-h.inChunk)
+		h.chunk.Write(p[:take])
+		h.inChunk += take
+		p = p[take:]
+		if h.inChunk == h.chunkSize {
+			h.sums = append(h.sums, h.chunk.Sum64())
+			h.chunk.Reset()
+			h.inChunk = 0
+		}
+	}
+	return n, nil
+}
+
+// Sum64 returns the xxhash of everything written so far.
+func (h *ChunkHasher) Sum64() uint64 {
+	return h.whole.Sum64()
+}
+
+// ChunkSums returns the xxhash of each chunk written so far, including a
+// final partial chunk.
+func (h *ChunkHasher) ChunkSums() []uint64 {
+	sums := h.sums[:len(h.sums):len(h.sums)]
+	if h.inChunk > 0 {
+		sums = append(sums, h.chunk.Sum64())
+	}
+	return sums
+}
@@ -31,6 +31,7 @@ const (
 	CodecFLACAudio
 	CodecOpusAudio
 	CodecPGSSubtitle
+	CodecVobSub
 )
 
 // CodecTypeName returns a human-readable name for a codec type.
@@ -68,6 +69,8 @@ func CodecTypeName(ct CodecType) string {
 		return "Opus"
 	case CodecPGSSubtitle:
 		return "PGS"
+	case CodecVobSub:
+		return "VobSub"
 	default:
 		return "Unknown"
 	}
@@ -84,7 +87,7 @@ func IsVideoCodec(ct CodecType) bool {
 
 // IsSubtitleCodec returns true if the codec type is a subtitle codec.
 func IsSubtitleCodec(ct CodecType) bool {
-	return ct == CodecPGSSubtitle
+	return ct == CodecPGSSubtitle || ct == CodecVobSub
 }
 
 // IsAudioCodec returns true if the codec type is an audio codec.
@@ -110,7 +113,8 @@ func MKVCodecToType(codecID string) CodecType {
 	case codecID == "V_MPEGH/ISO/HEVC":
 		return CodecH265Video
 	case codecID == "V_MS/VFW/FOURCC":
-		// Could be VC-1 or other; can't determine without codec private data
+		// Could be VC-1 or other; MKVTrackCodecType reads the FourCC from
+		// codec private data
 		return CodecUnknown
 	case codecID == "A_AC3":
 		return CodecAC3Audio
@@ -138,11 +142,25 @@ func MKVCodecToType(codecID string) CodecType {
 		return CodecOpusAudio
 	case codecID == "S_HDMV/PGS":
 		return CodecPGSSubtitle
+	case codecID == "S_VOBSUB":
+		return CodecVobSub
 	default:
 		return CodecUnknown
 	}
 }
 
+// MKVTrackCodecType maps an MKV track to a CodecType, using its CodecPrivate
+// where the CodecID alone does not identify the codec.
+func MKVTrackCodecType(codecID string, codecPrivate []byte) CodecType {
+	if codecID == "V_MS/VFW/FOURCC" {
+		if bitmapInfoFourCC(codecPrivate) == "WVC1" {
+			return CodecVC1Video
+		}
+		return CodecUnknown
+	}
+	return MKVCodecToType(codecID)
+}
+
 // SourceCodecs describes the codecs found in a source media.
 type SourceCodecs struct {
 	VideoCodecs    []CodecType
@@ -160,13 +178,19 @@ type CodecMismatch struct {
 
 // DetectSourceCodecs determines what codecs are present in the source media.
 // For DVD sources, it extracts codec info from the already-parsed MPEG-PS data.
-// For Blu-ray sources, it performs a lightweight PMT scan of the first M2TS file.
+// For Blu-ray and MPEG-TS sources, it performs a lightweight PMT scan of the
+// indexed transport stream files. For MP4 sources, it uses the sample
+// descriptions read by the parsers, and for MKV sources their track codec IDs.
 func DetectSourceCodecs(index *Index) (*SourceCodecs, error) {
 	switch index.SourceType {
 	case TypeDVD:
 		return detectDVDCodecs(index)
-	case TypeBluray:
+	case TypeBluray, TypeMPEGTS:
 		return detectBlurayCodecs(index)
+	case TypeMP4:
+		return detectMP4Codecs(index)
+	case TypeMKV:
+		return detectMKVCodecs(index)
 	default:
 		return nil, fmt.Errorf("unknown source type")
 	}
@@ -223,7 +247,35 @@ func DetectSourceCodecsFromDir(sourceDir string) (*SourceCodecs, error) {
 		if codecs, err := detectBlurayCodecsFromCLPIDir(sourceDir); err == nil {
 			return codecs, nil
 		}
-		// Fallback: scan PMT from M2TS data.
+		// Fallback: scan PMT from M2TS data. DVD ISOs in a mixed
+		// multi-disc directory are scanned separately as DVDs.
+		var targets []codecScanTarget
+		var dvdISOs []string
+		for _, fi := range infos {
+			fullPath := filepath.Join(sourceDir, fi.relPath)
+			if isISOFile(fi.relPath) && classifyISO(fullPath) == TypeDVD {
+				dvdISOs = append(dvdISOs, fullPath)
+				continue
+			}
+			targets = append(targets, codecScanTarget{
+				Path: fullPath,
+				Size: fi.size,
+			})
+		}
+		codecs, err := detectBlurayCodecsMulti(significantTargets(targets))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range dvdISOs {
+			dvdCodecs, err := detectDVDCodecsFromFile(path)
+			if err != nil {
+				continue
+			}
+			mergeSourceCodecs(codecs, dvdCodecs)
+		}
+		return codecs, nil
+	case TypeMPEGTS:
+		// Plain .ts recordings have no clip metadata; scan their PMTs.
 		targets := make([]codecScanTarget, len(infos))
 		for i, fi := range infos {
 			targets[i] = codecScanTarget{
@@ -232,6 +284,20 @@ func DetectSourceCodecsFromDir(sourceDir string) (*SourceCodecs, error) {
 			}
 		}
 		return detectBlurayCodecsMulti(significantTargets(targets))
+	case TypeMP4:
+		// The sample descriptions in each moov box are authoritative.
+		paths := make([]string, len(infos))
+		for i, fi := range infos {
+			paths[i] = filepath.Join(sourceDir, fi.relPath)
+		}
+		return detectMP4CodecsFromFiles(paths)
+	case TypeMKV:
+		// The track headers of each MKV are authoritative.
+		paths := make([]string, len(infos))
+		for i, fi := range infos {
+			paths[i] = filepath.Join(sourceDir, fi.relPath)
+		}
+		return detectMKVCodecsFromFiles(paths)
 	case TypeDVD:
 		// For DVDs, use the largest file (main feature)
 		var largestFile string
@@ -241,6 +307,12 @@ func DetectSourceCodecsFromDir(sourceDir string) (*SourceCodecs, error) {
 				break
 			}
 		}
+		// Unpacked VIDEO_TS: read the loose IFO files next to the VOBs.
+		if !isISOFile(largestFile) {
+			if codecs, err := detectDVDCodecsFromIFODir(filepath.Dir(filepath.Join(sourceDir, largestFile))); err == nil {
+				return codecs, nil
+			}
+		}
 		return detectDVDCodecsFromFile(filepath.Join(sourceDir, largestFile))
 	default:
 		return nil, fmt.Errorf("unknown source type")
@@ -253,7 +325,7 @@ func CheckCodecCompatibility(tracks []mkv.Track, sourceCodecs *SourceCodecs) []C
 	var mismatches []CodecMismatch
 
 	for _, track := range tracks {
-		ct := MKVCodecToType(track.CodecID)
+		ct := MKVTrackCodecType(track.CodecID, track.CodecPrivate)
 		if ct == CodecUnknown {
 			continue // Skip unknown codecs — no false alarms
 		}
@@ -342,6 +414,8 @@ func codecFamily(ct CodecType) int {
 		return 17
 	case CodecPGSSubtitle:
 		return 20
+	case CodecVobSub:
+		return 21
 	default:
 		return 0
 	}
@@ -37,6 +37,7 @@ func TestMKVCodecToType(t *testing.T) {
 
 		// Subtitle
 		{"S_HDMV/PGS", CodecPGSSubtitle},
+		{"S_VOBSUB", CodecVobSub},
 
 		// Unknown
 		{"S_TEXT/UTF8", CodecUnknown},
@@ -51,6 +52,35 @@ func TestMKVCodecToType(t *testing.T) {
 	}
 }
 
+// testBitmapInfoHeader returns a BITMAPINFOHEADER with the given FourCC,
+// followed by extra codec data.
+func testBitmapInfoHeader(fourCC string, extra ...byte) []byte {
+	h := make([]byte, 40)
+	h[0] = 40 // biSize
+	copy(h[16:20], fourCC)
+	return append(h, extra...)
+}
+
+func TestMKVTrackCodecType(t *testing.T) {
+	tests := []struct {
+		name         string
+		codecID      string
+		codecPrivate []byte
+		want         CodecType
+	}{
+		{"WVC1", "V_MS/VFW/FOURCC", testBitmapInfoHeader("WVC1", 0x00, 0x00, 0x01, 0x0F), CodecVC1Video},
+		{"other FourCC", "V_MS/VFW/FOURCC", testBitmapInfoHeader("XVID"), CodecUnknown},
+		{"no codec private", "V_MS/VFW/FOURCC", nil, CodecUnknown},
+		{"truncated header", "V_MS/VFW/FOURCC", testBitmapInfoHeader("WVC1")[:20], CodecUnknown},
+		{"codec ID only", "V_MPEG4/ISO/AVC", nil, CodecH264Video},
+	}
+	for _, tt := range tests {
+		if got := MKVTrackCodecType(tt.codecID, tt.codecPrivate); got != tt.want {
+			t.Errorf("%s: MKVTrackCodecType(%q) = %v, want %v", tt.name, tt.codecID, got, tt.want)
+		}
+	}
+}
+
 func TestCodecTypeName(t *testing.T) {
 	tests := []struct {
 		ct   CodecType
@@ -71,6 +101,7 @@ func TestCodecTypeName(t *testing.T) {
 		{CodecAACaudio, "AAC"},
 		{CodecFLACAudio, "FLAC"},
 		{CodecOpusAudio, "Opus"},
+		{CodecVobSub, "VobSub"},
 		{CodecUnknown, "Unknown"},
 	}
 
@@ -120,6 +151,19 @@ func TestCheckCodecCompatibility_VideoMismatch(t *testing.T) {
 	}
 }
 
+func TestCheckCodecCompatibility_VC1(t *testing.T) {
+	tracks := []mkv.Track{
+		{Number: 1, Type: mkv.TrackTypeVideo, CodecID: "V_MS/VFW/FOURCC", CodecPrivate: testBitmapInfoHeader("WVC1")},
+	}
+	if mismatches := CheckCodecCompatibility(tracks, &SourceCodecs{VideoCodecs: []CodecType{CodecVC1Video}}); len(mismatches) != 0 {
+		t.Errorf("VC-1 against VC-1 source: got %d mismatches, want 0", len(mismatches))
+	}
+	mismatches := CheckCodecCompatibility(tracks, &SourceCodecs{VideoCodecs: []CodecType{CodecH264Video}})
+	if len(mismatches) != 1 || mismatches[0].MKVCodecType != CodecVC1Video {
+		t.Errorf("VC-1 against H.264 source: got %+v, want one VC-1 mismatch", mismatches)
+	}
+}
+
 func TestCheckCodecCompatibility_AudioMismatch(t *testing.T) {
 	tracks := []mkv.Track{
 		{Number: 1, Type: mkv.TrackTypeVideo, CodecID: "V_MPEG2"},
@@ -286,6 +330,9 @@ func TestIsSubtitleCodec(t *testing.T) {
 	if !IsSubtitleCodec(CodecPGSSubtitle) {
 		t.Error("IsSubtitleCodec(CodecPGSSubtitle) = false, want true")
 	}
+	if !IsSubtitleCodec(CodecVobSub) {
+		t.Error("IsSubtitleCodec(CodecVobSub) = false, want true")
+	}
 	nonSubtitle := []CodecType{CodecUnknown, CodecH264Video, CodecAC3Audio, CodecFLACAudio}
 	for _, c := range nonSubtitle {
 		if IsSubtitleCodec(c) {
@@ -3,14 +3,20 @@ package source
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
+// vtsMATReadSize is how much of a VTS IFO file parseDVDIFOCodecs reads: the
+// VTS_MAT up to the subpicture stream count.
+const vtsMATReadSize = 0x256
+
 // parseDVDIFOCodecs parses a VTS_xx_0.IFO file's VTS_MAT structure to extract
-// video and audio codec information. The IFO file authoritatively declares
-// every stream in the title set, unlike PES scanning which can miss streams
-// that appear later in the VOB data.
+// video, audio and subpicture codec information. The IFO file authoritatively
+// declares every stream in the title set, unlike PES scanning which can miss
+// streams that appear later in the VOB data.
 //
 // VTS_MAT layout (relevant offsets):
 //
@@ -18,14 +24,10 @@ import (
 //	0x200-0x201: VTS video attributes (2 bytes)
 //	0x202-0x203: Number of VTS audio streams (2 bytes, big-endian)
 //	0x204-0x243: VTS audio stream attributes (8 bytes each, max 8)
+//	0x254-0x255: Number of VTS subpicture streams (2 bytes, big-endian)
 func parseDVDIFOCodecs(data []byte) (*SourceCodecs, error) {
-	if len(data) < 0x244 {
-		return nil, fmt.Errorf("IFO data too short (%d bytes)", len(data))
-	}
-
-	magic := string(data[0:12])
-	if magic != "DVDVIDEO-VTS" {
-		return nil, fmt.Errorf("not a VTS IFO file (magic: %q)", magic)
+	if err := checkVTSMAT(data); err != nil {
+		return nil, err
 	}
 
 	codecs := &SourceCodecs{}
@@ -71,49 +73,138 @@ func parseDVDIFOCodecs(data []byte) (*SourceCodecs, error) {
 		}
 	}
 
+	// Subpicture streams are always VobSub; only their presence matters.
+	if len(data) >= 0x256 && binary.BigEndian.Uint16(data[0x254:0x256]) > 0 {
+		codecs.SubtitleCodecs = append(codecs.SubtitleCodecs, CodecVobSub)
+	}
+
 	return codecs, nil
 }
 
+// parseDVDIFOAudioChannels returns the channel count a VTS_MAT declares for
+// each audio stream of its title set, keyed by the ID of the sub-stream
+// carrying it: audio stream n is sub-stream n of its coding mode's range
+// (0x80+n for AC3, 0x88+n for DTS, 0xA0+n for LPCM, 0xC0+n for MPEG), as
+// discs are authored. Byte 1, bits 2-0 of the attributes hold the channel
+// count minus one.
+func parseDVDIFOAudioChannels(data []byte) (map[byte]int, error) {
+	if err := checkVTSMAT(data); err != nil {
+		return nil, err
+	}
+
+	numAudio := min(int(binary.BigEndian.Uint16(data[0x202:0x204])), 8)
+	channels := make(map[byte]int, numAudio)
+	for i := range numAudio {
+		off := 0x204 + i*8
+		if data[off] == 0 && data[off+1] == 0 {
+			continue
+		}
+		var base byte
+		switch (data[off] >> 5) & 0x07 {
+		case 0:
+			base = 0x80
+		case 2, 3:
+			base = 0xC0
+		case 4:
+			base = 0xA0
+		case 6:
+			base = 0x88
+		default:
+			continue
+		}
+		channels[base+byte(i)] = int(data[off+1]&0x07) + 1
+	}
+	return channels, nil
+}
+
+// checkVTSMAT returns an error if data does not start with a VTS_MAT long
+// enough to hold the audio stream attributes.
+func checkVTSMAT(data []byte) error {
+	if len(data) < 0x244 {
+		return fmt.Errorf("IFO data too short (%d bytes)", len(data))
+	}
+	if magic := string(data[0:12]); magic != "DVDVIDEO-VTS" {
+		return fmt.Errorf("not a VTS IFO file (magic: %q)", magic)
+	}
+	return nil
+}
+
 // findIFOsInISO navigates an ISO9660 filesystem to find VTS IFO files
 // (VTS_xx_0.IFO) under the VIDEO_TS directory. Returns nil if navigation fails.
 func findIFOsInISO(f *os.File) []isoFileExtent {
-	rootLBA, rootLen, err := readISOPVDRoot(f)
+	files, err := findVIDEOTSFilesInISO9660(f)
 	if err != nil {
 		return nil
 	}
+	var ifos []isoFileExtent
+	for _, e := range files {
+		if isVTSIFOName(e.Name) {
+			ifos = append(ifos, e)
+		}
+	}
+	return ifos
+}
+
+// findIFOsInUDF navigates a UDF filesystem to find VTS IFO files under VIDEO_TS.
+func findIFOsInUDF(f *os.File) ([]isoFileExtent, error) {
+	files, err := findVIDEOTSFilesInUDF(f)
+	if err != nil {
+		return nil, err
+	}
+	var ifos []isoFileExtent
+	for _, e := range files {
+		if isVTSIFOName(e.Name) {
+			ifos = append(ifos, e)
+		}
+	}
+	if len(ifos) == 0 {
+		return nil, fmt.Errorf("no VTS IFO files found in UDF VIDEO_TS/")
+	}
+	return ifos, nil
+}
+
+// isVTSIFOName reports whether an upper-case file name is a title set IFO
+// (VTS_xx_0.IFO).
+func isVTSIFOName(name string) bool {
+	return strings.HasPrefix(name, "VTS_") && strings.HasSuffix(name, ".IFO") &&
+		len(name) == 12 && name[7] == '0'
+}
+
+// findVIDEOTSFilesInISO9660 lists the files of the VIDEO_TS directory of an
+// ISO9660 filesystem.
+func findVIDEOTSFilesInISO9660(f *os.File) ([]isoFileExtent, error) {
+	rootLBA, rootLen, err := readISOPVDRoot(f)
+	if err != nil {
+		return nil, err
+	}
 
 	rootEntries, err := readISODirectory(f, rootLBA, rootLen)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	videoTS, err := findISOEntry(rootEntries, "VIDEO_TS")
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	vtsEntries, err := readISODirectory(f, uint32(videoTS.Offset/isoSectorSize), uint32(videoTS.Size))
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	var ifos []isoFileExtent
+	var files []isoFileExtent
 	for _, e := range vtsEntries {
-		if e.IsDir {
-			continue
-		}
-		name := e.Name
-		// Match VTS_xx_0.IFO pattern (e.g., VTS_01_0.IFO)
-		if strings.HasPrefix(name, "VTS_") && strings.HasSuffix(name, ".IFO") &&
-			len(name) == 12 && name[7] == '0' {
-			ifos = append(ifos, e)
+		if !e.IsDir {
+			files = append(files, e)
 		}
 	}
-	return ifos
+	return files, nil
 }
 
-// findIFOsInUDF navigates a UDF filesystem to find VTS IFO files under VIDEO_TS.
-func findIFOsInUDF(f *os.File) ([]isoFileExtent, error) {
+// findVIDEOTSFilesInUDF lists the files of the VIDEO_TS directory of a UDF
+// filesystem. Names are upper-cased.
+func findVIDEOTSFilesInUDF(f *os.File) ([]isoFileExtent, error) {
 	ctx, err := newUDFContext(f)
 	if err != nil {
 		return nil, err
@@ -134,18 +225,11 @@ func findIFOsInUDF(f *os.File) ([]isoFileExtent, error) {
 		return nil, fmt.Errorf("read VIDEO_TS directory: %w", err)
 	}
 
-	var ifos []isoFileExtent
+	var files []isoFileExtent
 	for _, fid := range vtsFIDs {
 		if fid.IsDir || fid.IsParent {
 			continue
 		}
-		name := strings.ToUpper(fid.Name)
-		if !strings.HasPrefix(name, "VTS_") || !strings.HasSuffix(name, ".IFO") {
-			continue
-		}
-		if len(name) != 12 || name[7] != '0' {
-			continue
-		}
 
 		fe, err := ctx.readFileEntryAt(fid.ICBLocation)
 		if err != nil || fe.InfoLength == 0 {
@@ -157,22 +241,17 @@ func findIFOsInUDF(f *os.File) ([]isoFileExtent, error) {
 			continue
 		}
 
-		ifo := isoFileExtent{
-			Name:   name,
+		file := isoFileExtent{
+			Name:   strings.ToUpper(fid.Name),
 			Offset: extents[0].ISOOffset,
 			Size:   int64(fe.InfoLength),
-			IsDir:  false,
 		}
 		if !extentsContiguous(extents) {
-			ifo.Extents = extents
+			file.Extents = extents
 		}
-		ifos = append(ifos, ifo)
+		files = append(files, file)
 	}
-
-	if len(ifos) == 0 {
-		return nil, fmt.Errorf("no VTS IFO files found in UDF VIDEO_TS/")
-	}
-	return ifos, nil
+	return files, nil
 }
 
 // detectDVDCodecsFromIFOs reads IFO files from within an ISO and returns
@@ -183,9 +262,7 @@ func detectDVDCodecsFromIFOs(f *os.File, ifos []isoFileExtent) (*SourceCodecs, e
 	anySuccess := false
 
 	for _, ifo := range ifos {
-		// We only need the first 0x244 bytes for VTS_MAT parsing.
-		const maxIFOReadSize int64 = 0x244
-		data, err := readISOFileExtent(f, ifo, maxIFOReadSize)
+		data, err := readISOFileExtent(f, ifo, vtsMATReadSize)
 		if err != nil {
 			lastErr = err
 			continue
@@ -208,3 +285,65 @@ func detectDVDCodecsFromIFOs(f *os.File, ifos []isoFileExtent) (*SourceCodecs, e
 	}
 	return merged, nil
 }
+
+// detectDVDCodecsFromIFODir reads the loose VTS_xx_0.IFO files of an unpacked
+// VIDEO_TS directory and returns the unioned codec information from all title
+// sets.
+func detectDVDCodecsFromIFODir(videoTSDir string) (*SourceCodecs, error) {
+	entries, err := os.ReadDir(videoTSDir)
+	if err != nil {
+		return nil, fmt.Errorf("read VIDEO_TS directory: %w", err)
+	}
+
+	merged := &SourceCodecs{}
+	var lastErr error
+	anySuccess := false
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		// Match VTS_xx_0.IFO pattern (e.g., VTS_01_0.IFO), case-insensitively
+		// since unpacked rips made on some systems use lowercase names.
+		if !isVTSIFOName(strings.ToUpper(e.Name())) {
+			continue
+		}
+
+		data, err := readIFOHeader(filepath.Join(videoTSDir, e.Name()))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		codecs, err := parseDVDIFOCodecs(data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		mergeSourceCodecs(merged, codecs)
+		anySuccess = true
+	}
+
+	if !anySuccess {
+		if lastErr != nil {
+			return nil, fmt.Errorf("failed to parse any VTS IFO: %w", lastErr)
+		}
+		return nil, fmt.Errorf("no VTS IFO files found in %s", videoTSDir)
+	}
+	return merged, nil
+}
+
+// readIFOHeader reads the VTS_MAT portion of a loose IFO file.
+func readIFOHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open IFO: %w", err)
+	}
+	defer f.Close()
+
+	data := make([]byte, vtsMATReadSize)
+	n, err := io.ReadFull(f, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return data[:n], nil
+}
@@ -11,7 +11,7 @@ import (
 // audioEntries: each entry is (codingMode, channels-1) where codingMode is
 // 0=AC3, 2=MPEG-1, 3=MPEG-2ext, 4=LPCM, 6=DTS.
 func buildTestIFO(videoCompression byte, audioEntries [][2]byte) []byte {
-	data := make([]byte, 0x244) // Minimum size for VTS_MAT with 8 audio entries
+	data := make([]byte, vtsMATReadSize)
 	copy(data[0:12], "DVDVIDEO-VTS")
 
 	// Video attributes at 0x200 (bits 15-14 = compression).
@@ -108,6 +108,31 @@ func TestParseDVDIFOCodecs_DuplicateCodecs(t *testing.T) {
 	}
 }
 
+func TestParseDVDIFOCodecs_Subpictures(t *testing.T) {
+	data := buildTestIFO(1, [][2]byte{{0, 1}})
+	codecs, err := parseDVDIFOCodecs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codecs.SubtitleCodecs) != 0 {
+		t.Errorf("subtitle = %v, want none without subpicture streams", codecs.SubtitleCodecs)
+	}
+
+	data[0x255] = 2 // two subpicture streams
+	codecs, err = parseDVDIFOCodecs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codecs.SubtitleCodecs) != 1 || codecs.SubtitleCodecs[0] != CodecVobSub {
+		t.Errorf("subtitle = %v, want [VobSub]", codecs.SubtitleCodecs)
+	}
+
+	// A VTS_MAT cut short before the subpicture count declares none
+	if codecs, err := parseDVDIFOCodecs(data[:0x244]); err != nil || len(codecs.SubtitleCodecs) != 0 {
+		t.Errorf("parseDVDIFOCodecs(short VTS_MAT) = %+v, %v; want no subtitles", codecs, err)
+	}
+}
+
 func TestParseDVDIFOCodecs_InvalidMagic(t *testing.T) {
 	data := make([]byte, 0x244)
 	copy(data[0:12], "NOT-DVD-DATA")
@@ -0,0 +1,647 @@
+package source
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// DVDTitle describes a DVD title as listed by the title search pointer table
+// of VIDEO_TS.IFO, together with the VOB sectors of the cells its program
+// chains play.
+type DVDTitle struct {
+	Number   int           // title number on the disc (1-based), as players and rippers list it
+	Disc     string        // ISO or VIDEO_TS directory holding the title, relative to the source directory
+	TitleSet int           // title set (VTS) number
+	Chapters int           // number of chapters (PTTs)
+	Angles   int           // number of angles
+	Duration time.Duration // total playback time of the title's program chains
+	Codecs   *SourceCodecs // codecs declared by the title set's VTS_MAT
+
+	// Byte ranges of the title's cells, sorted and merged: offsets in the
+	// ISO, or in the concatenated VOB set of the title set for a VIDEO_TS
+	// directory.
+	extents []isoPhysicalRange
+}
+
+// String returns the title number, qualified by the disc holding it.
+func (t *DVDTitle) String() string {
+	return t.Disc + ":" + strconv.Itoa(t.Number)
+}
+
+// Size returns the number of VOB bytes in the title's cells.
+func (t *DVDTitle) Size() int64 {
+	var size int64
+	for _, e := range t.extents {
+		size += e.Length
+	}
+	return size
+}
+
+// maxIFOSize caps the read size of an IFO file. Real IFOs are at most a few
+// hundred KB.
+const maxIFOSize int64 = 4 * 1024 * 1024
+
+// vmgTitle is one entry of the title search pointer table (TT_SRPT).
+type vmgTitle struct {
+	angles   int
+	chapters int
+	titleSet int
+	vtsTitle int // title number within the title set (VTS_TTN)
+}
+
+// parseVMGTitles parses the title search pointer table of a VIDEO_TS.IFO.
+//
+// VMG_MAT layout (relevant offsets):
+//
+//	0x000-0x00B: "DVDVIDEO-VMG" identifier
+//	0x0C4-0x0C7: Start sector of TT_SRPT within the IFO
+//
+// TT_SRPT layout:
+//
+//	[0-1]  Number of titles
+//	[2-3]  Reserved
+//	[4-7]  End address (last byte of the table)
+//	Per title (12 bytes, from offset 8):
+//	  [0]    Title type
+//	  [1]    Number of angles
+//	  [2-3]  Number of chapters (PTTs)
+//	  [4-5]  Parental management mask
+//	  [6]    Title set number
+//	  [7]    Title number within the title set
+//	  [8-11] Start sector of the title set
+func parseVMGTitles(data []byte) ([]vmgTitle, error) {
+	if len(data) < 0xC8 || string(data[0:12]) != "DVDVIDEO-VMG" {
+		return nil, fmt.Errorf("not a VMG IFO file")
+	}
+	off := int(binary.BigEndian.Uint32(data[0xC4:0xC8])) * isoSectorSize
+	if off == 0 || off+8 > len(data) {
+		return nil, fmt.Errorf("TT_SRPT offset %d beyond file size %d", off, len(data))
+	}
+	numTitles := int(binary.BigEndian.Uint16(data[off : off+2]))
+	titles := make([]vmgTitle, 0, numTitles)
+	for i := 0; i < numTitles; i++ {
+		e := off + 8 + i*12
+		if e+12 > len(data) {
+			return nil, fmt.Errorf("title %d beyond file size", i+1)
+		}
+		titles = append(titles, vmgTitle{
+			angles:   int(data[e+1]),
+			chapters: int(binary.BigEndian.Uint16(data[e+2 : e+4])),
+			titleSet: int(data[e+6]),
+			vtsTitle: int(data[e+7]),
+		})
+	}
+	if len(titles) == 0 {
+		return nil, fmt.Errorf("disc has no titles")
+	}
+	return titles, nil
+}
+
+// parseVTSTitleCells returns the byte ranges of the cells played by a title
+// of a title set, relative to the start of the title set's VOBS, and the
+// total playback time of the program chains holding them. The title's
+// program chains are those its chapters point into; without a PTT search
+// table, the entry program chains of the title are used.
+//
+// VTS_MAT layout (relevant offsets):
+//
+//	0x0C4-0x0C7: Start sector of VTSTT_VOBS within the title set
+//	0x0C8-0x0CB: Start sector of VTS_PTT_SRPT within the IFO
+//	0x0CC-0x0CF: Start sector of VTS_PGCIT within the IFO
+//
+// VTS_PTT_SRPT holds the number of titles (2 bytes), then after 8 bytes the
+// offset of each title's chapter list (4 bytes each). A chapter is a PGC
+// number and a program number (2 bytes each).
+//
+// VTS_PGCIT holds the number of PGCs (2 bytes), then after 8 bytes one
+// 8-byte entry per PGC: category (bit 7: entry PGC, bits 6-0: title
+// number), parental mask and the PGC's offset (4 bytes at 4).
+//
+// A PGC has its number of cells at 0x03, its BCD playback time at 0x04 and
+// the offset of its cell playback table at 0xE8. Each 24-byte cell playback
+// entry has the first VOBU start sector at 0x08 and the last VOBU end sector
+// at 0x14, relative to VTSTT_VOBS.
+func parseVTSTitleCells(data []byte, vtsTitle int) ([]isoPhysicalRange, time.Duration, error) {
+	if len(data) < 0xD0 || string(data[0:12]) != "DVDVIDEO-VTS" {
+		return nil, 0, fmt.Errorf("not a VTS IFO file")
+	}
+	pgcit := int(binary.BigEndian.Uint32(data[0xCC:0xD0])) * isoSectorSize
+	if pgcit == 0 || pgcit+8 > len(data) {
+		return nil, 0, fmt.Errorf("VTS_PGCIT offset %d beyond file size %d", pgcit, len(data))
+	}
+	numPGCs := int(binary.BigEndian.Uint16(data[pgcit : pgcit+2]))
+
+	pgcNumbers := vtsTitlePGCs(data, vtsTitle)
+	if len(pgcNumbers) == 0 {
+		for i := 0; i < numPGCs; i++ {
+			e := pgcit + 8 + i*8
+			if e+8 <= len(data) && data[e]&0x80 != 0 && int(data[e]&0x7F) == vtsTitle {
+				pgcNumbers = append(pgcNumbers, i+1)
+			}
+		}
+	}
+	if len(pgcNumbers) == 0 {
+		return nil, 0, fmt.Errorf("title %d has no program chains", vtsTitle)
+	}
+
+	var cells []isoPhysicalRange
+	var duration time.Duration
+	for _, n := range pgcNumbers {
+		if n < 1 || n > numPGCs {
+			return nil, 0, fmt.Errorf("PGC %d out of range (%d PGCs)", n, numPGCs)
+		}
+		e := pgcit + 8 + (n-1)*8
+		if e+8 > len(data) {
+			return nil, 0, fmt.Errorf("PGC %d entry beyond file size", n)
+		}
+		pgc := pgcit + int(binary.BigEndian.Uint32(data[e+4:e+8]))
+		if pgc+0xEC > len(data) {
+			return nil, 0, fmt.Errorf("PGC %d beyond file size", n)
+		}
+		duration += dvdPlaybackTime(data[pgc+4 : pgc+8])
+		numCells := int(data[pgc+3])
+		table := pgc + int(binary.BigEndian.Uint16(data[pgc+0xE8:pgc+0xEA]))
+		for c := 0; c < numCells; c++ {
+			cell := table + c*24
+			if cell+24 > len(data) {
+				return nil, 0, fmt.Errorf("PGC %d cell %d beyond file size", n, c+1)
+			}
+			first := int64(binary.BigEndian.Uint32(data[cell+0x08 : cell+0x0C]))
+			last := int64(binary.BigEndian.Uint32(data[cell+0x14 : cell+0x18]))
+			if last < first {
+				return nil, 0, fmt.Errorf("PGC %d cell %d ends before it starts", n, c+1)
+			}
+			cells = append(cells, isoPhysicalRange{
+				ISOOffset: first * isoSectorSize,
+				Length:    (last - first + 1) * isoSectorSize,
+			})
+		}
+	}
+	if len(cells) == 0 {
+		return nil, 0, fmt.Errorf("title %d has no cells", vtsTitle)
+	}
+	return mergePhysicalRanges(cells), duration, nil
+}
+
+// vtsTitlePGCs returns the numbers of the PGCs the chapters of a title point
+// into, in chapter order and each listed once, or nil if the title set has
+// no PTT search table or the title is not in it.
+func vtsTitlePGCs(data []byte, vtsTitle int) []int {
+	srpt := int(binary.BigEndian.Uint32(data[0xC8:0xCC])) * isoSectorSize
+	if srpt == 0 || srpt+8 > len(data) {
+		return nil
+	}
+	numTitles := int(binary.BigEndian.Uint16(data[srpt : srpt+2]))
+	if vtsTitle < 1 || vtsTitle > numTitles || srpt+8+numTitles*4 > len(data) {
+		return nil
+	}
+	start := srpt + int(binary.BigEndian.Uint32(data[srpt+8+(vtsTitle-1)*4:]))
+	end := srpt + int(binary.BigEndian.Uint32(data[srpt+4:srpt+8])) + 1
+	if vtsTitle < numTitles {
+		end = srpt + int(binary.BigEndian.Uint32(data[srpt+8+vtsTitle*4:]))
+	}
+	end = min(end, len(data))
+
+	var pgcs []int
+	seen := make(map[int]bool)
+	for off := start; off+4 <= end; off += 4 {
+		n := int(binary.BigEndian.Uint16(data[off : off+2]))
+		if !seen[n] {
+			seen[n] = true
+			pgcs = append(pgcs, n)
+		}
+	}
+	return pgcs
+}
+
+// dvdPlaybackTime decodes a BCD playback time: hours, minutes, seconds and
+// frames, with the frame rate in the top two bits of the last byte
+// (01 = 25 fps, 11 = 29.97 fps).
+func dvdPlaybackTime(b []byte) time.Duration {
+	bcd := func(v byte) int { return int(v>>4)*10 + int(v&0x0F) }
+	d := time.Duration(bcd(b[0]))*time.Hour +
+		time.Duration(bcd(b[1]))*time.Minute +
+		time.Duration(bcd(b[2]))*time.Second
+	frames := time.Duration(bcd(b[3] & 0x3F))
+	switch b[3] >> 6 {
+	case 1:
+		d += frames * time.Second / 25
+	case 3:
+		d += frames * time.Second * 1001 / 30000
+	}
+	return d
+}
+
+// mergePhysicalRanges sorts ranges and merges those that overlap or touch.
+func mergePhysicalRanges(ranges []isoPhysicalRange) []isoPhysicalRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].ISOOffset < ranges[j].ISOOffset })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.ISOOffset <= last.ISOOffset+last.Length {
+			last.Length = max(last.Length, r.ISOOffset+r.Length-last.ISOOffset)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// buildDVDTitles combines the titles of a VIDEO_TS.IFO with the cells of
+// their title sets. readVTS returns the IFO of a title set and the offset
+// of its VOBS that cell offsets are relative to.
+func buildDVDTitles(vmg []byte, readVTS func(titleSet int) ([]byte, int64, error)) ([]*DVDTitle, error) {
+	entries, err := parseVMGTitles(vmg)
+	if err != nil {
+		return nil, err
+	}
+	type vtsInfo struct {
+		data   []byte
+		base   int64
+		codecs *SourceCodecs
+	}
+	sets := make(map[int]*vtsInfo)
+
+	titles := make([]*DVDTitle, 0, len(entries))
+	for i, e := range entries {
+		vts, ok := sets[e.titleSet]
+		if !ok {
+			data, base, err := readVTS(e.titleSet)
+			if err != nil {
+				return nil, fmt.Errorf("title %d: %w", i+1, err)
+			}
+			codecs, err := parseDVDIFOCodecs(data)
+			if err != nil {
+				return nil, fmt.Errorf("title %d: %w", i+1, err)
+			}
+			vts = &vtsInfo{data, base, codecs}
+			sets[e.titleSet] = vts
+		}
+		cells, duration, err := parseVTSTitleCells(vts.data, e.vtsTitle)
+		if err != nil {
+			return nil, fmt.Errorf("title %d: %w", i+1, err)
+		}
+		for j := range cells {
+			cells[j].ISOOffset += vts.base
+		}
+		titles = append(titles, &DVDTitle{
+			Number:   i + 1,
+			TitleSet: e.titleSet,
+			Chapters: e.chapters,
+			Angles:   e.angles,
+			Duration: duration,
+			Codecs:   vts.codecs,
+			extents:  cells,
+		})
+	}
+	return titles, nil
+}
+
+// vtsttVOBSOffset returns the byte offset of a title set's VOBS (its
+// VTS_xx_1.VOB) from the start of the title set, as declared by its VTS_MAT.
+func vtsttVOBSOffset(vts []byte) int64 {
+	if len(vts) < 0xC8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(vts[0xC4:0xC8])) * isoSectorSize
+}
+
+// ListDVDTitles returns the titles of a DVD source: those of every VIDEO_TS
+// directory and every DVD ISO in the directory.
+func ListDVDTitles(sourceDir string) ([]*DVDTitle, error) {
+	sourceType, err := DetectType(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("detect source type: %w", err)
+	}
+	if sourceType != TypeDVD {
+		return nil, fmt.Errorf("titles need a DVD source, %s is %s", sourceDir, sourceType)
+	}
+
+	var titles []*DVDTitle
+	for _, dir := range findVIDEOTSDirs(sourceDir) {
+		rel, err := filepath.Rel(sourceDir, dir)
+		if err != nil {
+			return nil, err
+		}
+		dirTitles, err := listDVDTitlesInDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rel, err)
+		}
+		for _, t := range dirTitles {
+			t.Disc = rel
+		}
+		titles = append(titles, dirTitles...)
+	}
+
+	files, err := EnumerateMediaFiles(sourceDir, TypeDVD)
+	if err != nil {
+		return nil, fmt.Errorf("enumerate files: %w", err)
+	}
+	for _, relPath := range files {
+		if !isISOFile(relPath) {
+			continue
+		}
+		isoTitles, err := listDVDTitlesInISO(filepath.Join(sourceDir, relPath))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", relPath, err)
+		}
+		for _, t := range isoTitles {
+			t.Disc = relPath
+		}
+		titles = append(titles, isoTitles...)
+	}
+
+	if len(titles) == 0 {
+		return nil, fmt.Errorf("no titles found in %s", sourceDir)
+	}
+	return titles, nil
+}
+
+// listDVDTitlesInDir parses the titles of an unpacked VIDEO_TS directory.
+// Cell offsets are relative to the VOB set of each title set.
+func listDVDTitlesInDir(videoTSDir string) ([]*DVDTitle, error) {
+	entries, err := os.ReadDir(videoTSDir)
+	if err != nil {
+		return nil, fmt.Errorf("read VIDEO_TS directory: %w", err)
+	}
+	byName := make(map[string]string, len(entries))
+	for _, e := range entries {
+		byName[strings.ToUpper(e.Name())] = filepath.Join(videoTSDir, e.Name())
+	}
+	readIFO := func(name string) ([]byte, error) {
+		path, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return data[:min(int64(len(data)), maxIFOSize)], nil
+	}
+
+	vmg, err := readIFO("VIDEO_TS.IFO")
+	if err != nil {
+		return nil, err
+	}
+	return buildDVDTitles(vmg, func(titleSet int) ([]byte, int64, error) {
+		data, err := readIFO(fmt.Sprintf("VTS_%02d_0.IFO", titleSet))
+		return data, 0, err
+	})
+}
+
+// listDVDTitlesInISO parses the titles of a DVD ISO, whose IFOs are found
+// through ISO9660 first and UDF as a fallback. Cell offsets are ISO offsets.
+func listDVDTitlesInISO(isoPath string) ([]*DVDTitle, error) {
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	files, err := findVIDEOTSFilesInISO9660(f)
+	if err != nil {
+		var udfErr error
+		if files, udfErr = findVIDEOTSFilesInUDF(f); udfErr != nil {
+			return nil, fmt.Errorf("find VIDEO_TS: %w (ISO9660 attempt also failed: %v)", udfErr, err)
+		}
+	}
+	byName := make(map[string]isoFileExtent, len(files))
+	for _, file := range files {
+		byName[file.Name] = file
+	}
+	readIFO := func(name string) ([]byte, int64, error) {
+		file, ok := byName[name]
+		if !ok {
+			return nil, 0, fmt.Errorf("%s not found", name)
+		}
+		data, err := readISOFileExtent(f, file, maxIFOSize)
+		return data, file.Offset, err
+	}
+
+	vmg, _, err := readIFO("VIDEO_TS.IFO")
+	if err != nil {
+		return nil, err
+	}
+	return buildDVDTitles(vmg, func(titleSet int) ([]byte, int64, error) {
+		// A title set is laid out contiguously from its IFO, so its VOBS
+		// start at the offset its VTS_MAT gives from the IFO.
+		data, offset, err := readIFO(fmt.Sprintf("VTS_%02d_0.IFO", titleSet))
+		if err != nil {
+			return nil, 0, err
+		}
+		return data, offset + vtsttVOBSOffset(data), nil
+	})
+}
+
+// FindDVDTitle returns the title with the given number. When several discs
+// have a title of that number, it must be qualified as "<disc>:<number>".
+func FindDVDTitle(titles []*DVDTitle, spec string) (*DVDTitle, error) {
+	disc, num := "", spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		disc, num = spec[:i], spec[i+1:]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid title number %q", num)
+	}
+
+	var found []*DVDTitle
+	for _, t := range titles {
+		if t.Number != n {
+			continue
+		}
+		if disc != "" && filepath.Clean(disc) != filepath.Clean(t.Disc) {
+			continue
+		}
+		found = append(found, t)
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("title %s not found", spec)
+	case 1:
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, t := range found {
+		names[i] = t.String()
+	}
+	return nil, fmt.Errorf("title %d is on several discs, use one of: %s", n, strings.Join(names, ", "))
+}
+
+// DVDTitleCandidates returns the titles an MKV may have been muxed from,
+// best first. Titles whose codecs cover the MKV's tracks are preferred, then
+// those whose duration is closest to the MKV's; titles further from it than
+// a remux could be are left out. Without an MKV duration, every title is a
+// candidate, longest first. Telling apart the remaining candidates, such as
+// the episodes of a TV disc, takes probing their content.
+func DVDTitleCandidates(titles []*DVDTitle, duration time.Duration, tracks []mkv.Track) ([]*DVDTitle, error) {
+	if len(titles) == 0 {
+		return nil, fmt.Errorf("no titles to choose from")
+	}
+
+	type candidate struct {
+		t          *DVDTitle
+		compatible bool
+		distance   time.Duration
+	}
+	candidates := make([]candidate, len(titles))
+	for i, t := range titles {
+		c := candidate{
+			t:          t,
+			compatible: len(CheckCodecCompatibility(tracks, t.Codecs)) == 0,
+		}
+		if duration > 0 {
+			c.distance = (t.Duration - duration).Abs().Round(time.Second)
+		} else {
+			c.distance = -t.Duration.Round(time.Second)
+		}
+		candidates[i] = c
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.compatible != b.compatible {
+			return a.compatible
+		}
+		return a.distance < b.distance
+	})
+
+	// Same tolerance as for Blu-ray playlists: trimmed credits or padding,
+	// but not another title.
+	tolerance := max(duration/20, 10*time.Second)
+	var result []*DVDTitle
+	for _, c := range candidates {
+		if duration > 0 && c.distance > tolerance {
+			continue
+		}
+		result = append(result, c.t)
+	}
+	if len(result) == 0 {
+		best := candidates[0].t
+		return nil, fmt.Errorf("no title matches the MKV duration %s (closest is %s at %s)",
+			duration.Round(time.Second), best, best.Duration.Round(time.Second))
+	}
+	return result, nil
+}
+
+// titleFiles returns the media files (relative paths from
+// EnumerateMediaFiles) holding the title's cells: its ISO, or the VOB set of
+// its title set.
+func (t *DVDTitle) titleFiles(files []string) ([]string, error) {
+	var result []string
+	for _, f := range files {
+		if isISOFile(f) {
+			if filepath.Clean(f) == filepath.Clean(t.Disc) {
+				return []string{f}, nil
+			}
+			continue
+		}
+		dir, name := filepath.Split(f)
+		if ts, _, ok := parseVOBName(name); ok && ts == t.TitleSet &&
+			filepath.Clean(dir) == filepath.Clean(t.Disc) {
+			result = append(result, f)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("VOBs of title %s not found", t)
+	}
+	return result, nil
+}
+
+// dvdTitleAdapter wraps an MPEGPSParser that parses only the cells of a DVD
+// title, assembled from the disc's data. The parser's FileOffset values are
+// relative to the assembled cells; the adapter maps the offsets it hands out
+// for reconstruction (ESOffsetToFileOffset, raw ranges and range map
+// offsets) back to the source file: the ISO, or the concatenated VOB set.
+// Everything else is served by the embedded parser.
+type dvdTitleAdapter struct {
+	*MPEGPSParser
+	extentMap isoExtentMap // maps assembled offset → source file offset
+}
+
+// newDVDTitleAdapter creates an unparsed adapter over the title cells
+// extents of a stream made of parts. Extent offsets are offsets into the
+// concatenated parts; cells beyond the data are clipped.
+func newDVDTitleAdapter(parts [][]byte, extents []isoPhysicalRange) (*dvdTitleAdapter, error) {
+	total := totalLen(parts)
+	var slices [][]byte
+	var kept []isoPhysicalRange
+	for _, e := range extents {
+		start, end := max(e.ISOOffset, 0), min(e.ISOOffset+e.Length, total)
+		if start >= end {
+			continue
+		}
+		kept = append(kept, isoPhysicalRange{ISOOffset: start, Length: end - start})
+		// A cell may straddle two VOB parts.
+		var partStart int64
+		for _, p := range parts {
+			partEnd := partStart + int64(len(p))
+			if s, e := max(start, partStart), min(end, partEnd); s < e {
+				slices = append(slices, p[s-partStart:e-partStart])
+			}
+			partStart = partEnd
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no title cells within the %d bytes of VOB data", total)
+	}
+	return &dvdTitleAdapter{
+		MPEGPSParser: NewMPEGPSParserMultiRegion(newMultiRegionDataFromSlices(slices)),
+		extentMap:    newISOExtentMap(kept),
+	}, nil
+}
+
+// ESOffsetToFileOffset converts an ES offset to a source file offset.
+// Cells are whole sectors, so a PES payload never straddles two of them.
+func (a *dvdTitleAdapter) ESOffsetToFileOffset(esOffset int64, isVideo bool) (fileOffset int64, remaining int) {
+	fOff, rem := a.MPEGPSParser.ESOffsetToFileOffset(esOffset, isVideo)
+	if fOff < 0 {
+		return fOff, rem
+	}
+	return a.extentMap.toISO(fOff), rem
+}
+
+// FileOffsetConverter returns a function that converts parser-relative
+// FileOffset values to source file offsets for range map storage.
+func (a *dvdTitleAdapter) FileOffsetConverter() func(int64) int64 {
+	return a.extentMap.toISO
+}
+
+// RawRangesForESRegion returns the source file ranges holding an ES region.
+func (a *dvdTitleAdapter) RawRangesForESRegion(esOffset int64, size int, isVideo bool) ([]RawRange, error) {
+	ranges, err := a.MPEGPSParser.RawRangesForESRegion(esOffset, size, isVideo)
+	if err != nil {
+		return nil, err
+	}
+	return a.extentMap.mapRawRanges(ranges), nil
+}
+
+// RawRangesForAudioSubStream returns the source file ranges holding a
+// region of an audio or subpicture sub-stream.
+func (a *dvdTitleAdapter) RawRangesForAudioSubStream(subStreamID byte, esOffset int64, size int) ([]RawRange, error) {
+	ranges, err := a.MPEGPSParser.RawRangesForAudioSubStream(subStreamID, esOffset, size)
+	if err != nil {
+		return nil, err
+	}
+	return a.extentMap.mapRawRanges(ranges), nil
+}
+
+// mpegpsParserOf returns the MPEG-PS parser behind an ES reader of a DVD,
+// or false for readers of other sources.
+func mpegpsParserOf(r ESReader) (*MPEGPSParser, bool) {
+	switch r := r.(type) {
+	case *MPEGPSParser:
+		return r, true
+	case *dvdTitleAdapter:
+		return r.MPEGPSParser, true
+	}
+	return nil, false
+}
@@ -0,0 +1,336 @@
+package source
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// buildTestVMGIFO creates a two-sector VIDEO_TS.IFO whose title search
+// pointer table lists the given titles.
+func buildTestVMGIFO(titles []vmgTitle) []byte {
+	data := make([]byte, 2*2048)
+	copy(data[0:12], "DVDVIDEO-VMG")
+	binary.BigEndian.PutUint32(data[0xC4:], 1)
+
+	srpt := data[2048:]
+	binary.BigEndian.PutUint16(srpt[0:], uint16(len(titles)))
+	binary.BigEndian.PutUint32(srpt[4:], uint32(8+len(titles)*12-1))
+	for i, tt := range titles {
+		e := srpt[8+i*12:]
+		e[1] = byte(tt.angles)
+		binary.BigEndian.PutUint16(e[2:], uint16(tt.chapters))
+		e[6] = byte(tt.titleSet)
+		e[7] = byte(tt.vtsTitle)
+	}
+	return data
+}
+
+// testPGC describes a program chain of buildTestVTSIFO: its BCD playback
+// time and its cells as (first, last) VOBU sectors.
+type testPGC struct {
+	time  [4]byte
+	cells [][2]uint32
+}
+
+// buildTestVTSIFO creates a three-sector VTS_xx_0.IFO: the VTS_MAT of an
+// MPEG-2/AC3 title set, a PTT search table whose title i has one chapter per
+// PGC number in titles[i], and the PGC information table. The title set's
+// VOBS start right after the IFO.
+func buildTestVTSIFO(titles [][]int, pgcs []testPGC) []byte {
+	data := make([]byte, 3*2048)
+	copy(data, buildTestIFO(1, [][2]byte{{0, 1}}))
+	binary.BigEndian.PutUint32(data[0xC4:], 3)
+	binary.BigEndian.PutUint32(data[0xC8:], 1)
+	binary.BigEndian.PutUint32(data[0xCC:], 2)
+
+	srpt := data[2048:4096]
+	binary.BigEndian.PutUint16(srpt[0:], uint16(len(titles)))
+	off := 8 + 4*len(titles)
+	for i, pgcNumbers := range titles {
+		binary.BigEndian.PutUint32(srpt[8+4*i:], uint32(off))
+		for _, n := range pgcNumbers {
+			binary.BigEndian.PutUint16(srpt[off:], uint16(n))
+			binary.BigEndian.PutUint16(srpt[off+2:], 1)
+			off += 4
+		}
+	}
+	binary.BigEndian.PutUint32(srpt[4:], uint32(off-1))
+
+	pgcit := data[4096:]
+	binary.BigEndian.PutUint16(pgcit[0:], uint16(len(pgcs)))
+	off = 8 + 8*len(pgcs)
+	for i, p := range pgcs {
+		binary.BigEndian.PutUint32(pgcit[8+8*i+4:], uint32(off))
+		pgc := pgcit[off:]
+		pgc[3] = byte(len(p.cells))
+		copy(pgc[4:8], p.time[:])
+		binary.BigEndian.PutUint16(pgc[0xE8:], 0xEC)
+		for c, cell := range p.cells {
+			entry := pgc[0xEC+24*c:]
+			binary.BigEndian.PutUint32(entry[0x08:], cell[0])
+			binary.BigEndian.PutUint32(entry[0x14:], cell[1])
+		}
+		off += 0xEC + 24*len(p.cells)
+	}
+	return data
+}
+
+func TestParseVTSTitleCells(t *testing.T) {
+	data := buildTestVTSIFO([][]int{{1, 2, 1}, {3}}, []testPGC{
+		{time: [4]byte{0x00, 0x10, 0x00, 0xC0}, cells: [][2]uint32{{10, 19}, {0, 4}}},
+		{time: [4]byte{0x00, 0x05, 0x30, 0x59}, cells: [][2]uint32{{20, 29}, {5, 5}}},
+		{time: [4]byte{0x01, 0x00, 0x00, 0xC0}, cells: [][2]uint32{{100, 199}}},
+	})
+
+	cells, duration, err := parseVTSTitleCells(data, 1)
+	if err != nil {
+		t.Fatalf("parseVTSTitleCells() error = %v", err)
+	}
+	// Cells 0-4 and 5 touch, as do 10-19 and 20-29; PGC 1 is counted once.
+	want := []isoPhysicalRange{{0, 6 * 2048}, {10 * 2048, 20 * 2048}}
+	if len(cells) != len(want) || cells[0] != want[0] || cells[1] != want[1] {
+		t.Errorf("cells = %+v, want %+v", cells, want)
+	}
+	wantDuration := 15*time.Minute + 30*time.Second + 19*time.Second/25
+	if duration != wantDuration {
+		t.Errorf("duration = %v, want %v", duration, wantDuration)
+	}
+
+	if _, _, err := parseVTSTitleCells(data, 3); err == nil {
+		t.Error("parseVTSTitleCells() for a missing title succeeded")
+	}
+	if _, _, err := parseVTSTitleCells(make([]byte, 0x100), 1); err == nil {
+		t.Error("parseVTSTitleCells() on a non-IFO succeeded")
+	}
+}
+
+func TestDVDPlaybackTime(t *testing.T) {
+	tests := []struct {
+		bcd  [4]byte
+		want time.Duration
+	}{
+		{[4]byte{0x01, 0x23, 0x45, 0xC0}, time.Hour + 23*time.Minute + 45*time.Second},
+		{[4]byte{0x00, 0x00, 0x01, 0x50}, time.Second + 10*time.Second/25},
+		{[4]byte{0x00, 0x00, 0x00, 0xD5}, 15 * time.Second * 1001 / 30000},
+	}
+	for _, tt := range tests {
+		if got := dvdPlaybackTime(tt.bcd[:]); got != tt.want {
+			t.Errorf("dvdPlaybackTime(%x) = %v, want %v", tt.bcd, got, tt.want)
+		}
+	}
+}
+
+func TestFindDVDTitle(t *testing.T) {
+	titles := []*DVDTitle{
+		{Number: 1, Disc: "disc1.iso"},
+		{Number: 2, Disc: "disc1.iso"},
+		{Number: 1, Disc: "disc2.iso"},
+	}
+	if got, err := FindDVDTitle(titles, "2"); err != nil || got != titles[1] {
+		t.Errorf("FindDVDTitle(2) = %v, %v, want %v", got, err, titles[1])
+	}
+	if got, err := FindDVDTitle(titles, "disc2.iso:1"); err != nil || got != titles[2] {
+		t.Errorf("FindDVDTitle(disc2.iso:1) = %v, %v, want %v", got, err, titles[2])
+	}
+	if _, err := FindDVDTitle(titles, "1"); err == nil || !strings.Contains(err.Error(), "disc2.iso:1") {
+		t.Errorf("FindDVDTitle(1) error = %v, want ambiguity listing disc2.iso:1", err)
+	}
+	for _, spec := range []string{"3", "0", "main"} {
+		if _, err := FindDVDTitle(titles, spec); err == nil {
+			t.Errorf("FindDVDTitle(%s) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestDVDTitleCandidates(t *testing.T) {
+	dvdCodecs := &SourceCodecs{
+		VideoCodecs: []CodecType{CodecMPEG2Video},
+		AudioCodecs: []CodecType{CodecAC3Audio},
+	}
+	episode1 := &DVDTitle{Number: 1, Duration: 22*time.Minute + 10*time.Second, Codecs: dvdCodecs}
+	episode2 := &DVDTitle{Number: 2, Duration: 22*time.Minute + 40*time.Second, Codecs: dvdCodecs}
+	all := &DVDTitle{Number: 3, Duration: 44*time.Minute + 50*time.Second, Codecs: dvdCodecs}
+	extra := &DVDTitle{Number: 4, Duration: 3 * time.Minute, Codecs: dvdCodecs}
+	titles := []*DVDTitle{episode1, episode2, all, extra}
+	tracks := []mkv.Track{
+		{Type: mkv.TrackTypeVideo, CodecID: "V_MPEG2"},
+		{Type: mkv.TrackTypeAudio, CodecID: "A_AC3"},
+	}
+
+	got, err := DVDTitleCandidates(titles, 22*time.Minute+35*time.Second, tracks)
+	if err != nil {
+		t.Fatalf("DVDTitleCandidates() error = %v", err)
+	}
+	if len(got) != 2 || got[0] != episode2 || got[1] != episode1 {
+		t.Errorf("DVDTitleCandidates() = %v, want [episode 2, episode 1]", got)
+	}
+
+	got, err = DVDTitleCandidates(titles, 0, tracks)
+	if err != nil || len(got) != len(titles) || got[0] != all {
+		t.Errorf("DVDTitleCandidates() without duration = %v, %v, want all titles, longest first", got, err)
+	}
+
+	if _, err := DVDTitleCandidates(titles, 2*time.Hour, tracks); err == nil {
+		t.Error("DVDTitleCandidates() for a 2h MKV succeeded, want error")
+	}
+}
+
+// testDVDTitleDisc returns the VIDEO_TS.IFO, VTS_01_0.IFO and four VOB packs
+// of a disc with two titles in one title set: title 1 plays packs 0-1
+// (video and audio), title 2 packs 2-3 (video only).
+func testDVDTitleDisc() (vmg, vts []byte, packs [][]byte) {
+	vmg = buildTestVMGIFO([]vmgTitle{
+		{angles: 1, chapters: 1, titleSet: 1, vtsTitle: 1},
+		{angles: 1, chapters: 1, titleSet: 1, vtsTitle: 2},
+	})
+	vts = buildTestVTSIFO([][]int{{1}, {2}}, []testPGC{
+		{time: [4]byte{0x00, 0x20, 0x00, 0xC0}, cells: [][2]uint32{{0, 1}}},
+		{time: [4]byte{0x00, 0x45, 0x00, 0xC0}, cells: [][2]uint32{{2, 3}}},
+	})
+	packs = [][]byte{
+		buildTestDVDPack(0xE0, 0, []byte{0x11, 0x22, 0x33}),
+		buildTestDVDPack(0xBD, 0x80, []byte{0x0B, 0x77, 0xAA}),
+		buildTestDVDPack(0xE0, 0, []byte{0x10, 0x20, 0x30, 0x40, 0x50}),
+		buildTestDVDPack(0xE0, 0, []byte{0x60, 0x70, 0x80}),
+	}
+	return vmg, vts, packs
+}
+
+// checkTestDVDTitle2 checks the ES reader of an index restricted to title 2
+// of testDVDTitleDisc, whose VOBS start at vobsOffset in the source file.
+func checkTestDVDTitle2(t *testing.T, index *Index, packs [][]byte, vobsOffset int64) {
+	t.Helper()
+	const payloadStart = 14 + 9
+	const payloadSize = 2048 - payloadStart
+
+	reader, ok := index.ESReaders[0].(*dvdTitleAdapter)
+	if !ok {
+		t.Fatalf("ESReaders[0] is %T, want *dvdTitleAdapter", index.ESReaders[0])
+	}
+	if got := reader.TotalESSize(true); got != 2*payloadSize {
+		t.Errorf("video ES size = %d, want %d (title 2 only)", got, 2*payloadSize)
+	}
+	if subs := reader.AudioSubStreams(); len(subs) != 0 {
+		t.Errorf("AudioSubStreams() = %x, want none (audio is in title 1)", subs)
+	}
+	got, err := reader.ReadESData(0, 10, true)
+	if err != nil || !bytes.Equal(got, packs[2][payloadStart:payloadStart+10]) {
+		t.Errorf("ReadESData(0) = %x, %v, want the start of pack 2", got, err)
+	}
+
+	if off, _ := reader.ESOffsetToFileOffset(0, true); off != vobsOffset+2*2048+payloadStart {
+		t.Errorf("ESOffsetToFileOffset(0) = %d, want %d", off, vobsOffset+2*2048+payloadStart)
+	}
+	raw, err := reader.RawRangesForESRegion(payloadSize-5, 10, true)
+	if err != nil {
+		t.Fatalf("RawRangesForESRegion: %v", err)
+	}
+	want := []RawRange{
+		{FileOffset: vobsOffset + 3*2048 - 5, Size: 5},
+		{FileOffset: vobsOffset + 3*2048 + payloadStart, Size: 5},
+	}
+	if len(raw) != 2 || raw[0] != want[0] || raw[1] != want[1] {
+		t.Errorf("RawRangesForESRegion = %+v, want %+v", raw, want)
+	}
+	if conv := reader.FileOffsetConverter(); conv(2048) != vobsOffset+3*2048 {
+		t.Errorf("FileOffsetConverter()(2048) = %d, want %d", conv(2048), vobsOffset+3*2048)
+	}
+
+	codecs, err := detectDVDCodecs(index)
+	if err != nil || len(codecs.VideoCodecs) != 1 || codecs.VideoCodecs[0] != CodecMPEG2Video {
+		t.Errorf("detectDVDCodecs() = %+v, %v, want MPEG-2 video", codecs, err)
+	}
+}
+
+func TestIndexer_DVDTitleISO(t *testing.T) {
+	vmg, vts, packs := testDVDTitleDisc()
+	iso := buildTestDVDISO([]testIFOEntry{
+		{"VIDEO_TS.IFO", vmg},
+		{"VTS_01_0.IFO", vts},
+		{"VTS_01_1.VOB", bytes.Join(packs, nil)},
+	})
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.iso"), iso, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	titles, err := ListDVDTitles(dir)
+	if err != nil {
+		t.Fatalf("ListDVDTitles() error = %v", err)
+	}
+	if len(titles) != 2 {
+		t.Fatalf("len(titles) = %d, want 2", len(titles))
+	}
+	title := titles[1]
+	if title.String() != "movie.iso:2" || title.Duration != 45*time.Minute || title.Size() != 2*2048 {
+		t.Errorf("title 2 = %s, %v, %d bytes, want movie.iso:2, 45m, 4096 bytes",
+			title, title.Duration, title.Size())
+	}
+
+	indexer, err := NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatalf("NewIndexer() error = %v", err)
+	}
+	indexer.SetTitle(title)
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if len(index.Files) != 1 || index.Files[0].RelativePath != "movie.iso" || index.Files[0].Size != int64(len(iso)) {
+		t.Fatalf("Files = %+v, want the whole movie.iso", index.Files)
+	}
+	// The VOB follows the two-sector VMG IFO and the three-sector VTS IFO,
+	// which buildTestDVDISO places from sector 30.
+	checkTestDVDTitle2(t, index, packs, 35*2048)
+}
+
+func TestIndexer_DVDTitleVOBSet(t *testing.T) {
+	vmg, vts, packs := testDVDTitleDisc()
+	stream := bytes.Join(packs, nil)
+	dir := t.TempDir()
+	// Title 2's cells straddle the two parts.
+	writeTestVIDEOTS(t, dir, map[string][]byte{
+		"VIDEO_TS.IFO": vmg,
+		"VTS_01_0.IFO": vts,
+		"VTS_01_1.VOB": stream[:3*2048],
+		"VTS_01_2.VOB": stream[3*2048:],
+	})
+
+	titles, err := ListDVDTitles(dir)
+	if err != nil {
+		t.Fatalf("ListDVDTitles() error = %v", err)
+	}
+	title, err := FindDVDTitle(titles, "2")
+	if err != nil {
+		t.Fatalf("FindDVDTitle() error = %v", err)
+	}
+	if title.Disc != "VIDEO_TS" {
+		t.Errorf("Disc = %q, want VIDEO_TS", title.Disc)
+	}
+
+	indexer, err := NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatalf("NewIndexer() error = %v", err)
+	}
+	indexer.SetTitle(title)
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if len(index.Files) != 2 || len(index.ESReaders) != 2 || index.ESReaders[1] != nil {
+		t.Fatalf("Files = %+v, ESReaders = %v, want both parts with one reader", index.Files, index.ESReaders)
+	}
+	// Offsets are into the concatenated VOB set.
+	checkTestDVDTitle2(t, index, packs, 0)
+}
@@ -0,0 +1,150 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Unpacked DVD rips store the disc's VIDEO_TS directory as loose files instead
+// of an ISO image. Each title set's main content is a VOB set: VTS_xx_1.VOB,
+// VTS_xx_2.VOB, ... split at 1 GB boundaries. The split always falls on a
+// 2048-byte pack boundary, so concatenating the parts in order yields the
+// original continuous MPEG-PS stream for that title set.
+
+// parseVOBName parses a VTS_xx_N.VOB file name (case-insensitive) and returns
+// the title set number and part number. Menu VOBs (N=0) and VIDEO_TS.VOB are
+// not content VOBs and return ok=false.
+func parseVOBName(name string) (titleSet, part int, ok bool) {
+	name = strings.ToUpper(name)
+	if len(name) != 12 || !strings.HasPrefix(name, "VTS_") || !strings.HasSuffix(name, ".VOB") || name[6] != '_' {
+		return 0, 0, false
+	}
+	if !isDigit(name[4]) || !isDigit(name[5]) || !isDigit(name[7]) {
+		return 0, 0, false
+	}
+	titleSet = int(name[4]-'0')*10 + int(name[5]-'0')
+	part = int(name[7] - '0')
+	if titleSet == 0 || part == 0 {
+		return 0, 0, false
+	}
+	return titleSet, part, true
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// findVIDEOTSDirs returns VIDEO_TS directories (matched case-insensitively)
+// directly under dir or one level below it, mirroring the *.iso and */*.iso
+// layouts accepted for ISO sources. Results are sorted for deterministic
+// file ordering.
+func findVIDEOTSDirs(dir string) []string {
+	var dirs []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if strings.EqualFold(e.Name(), "VIDEO_TS") {
+			dirs = append(dirs, path)
+			continue
+		}
+		subEntries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, se := range subEntries {
+			if se.IsDir() && strings.EqualFold(se.Name(), "VIDEO_TS") {
+				dirs = append(dirs, filepath.Join(path, se.Name()))
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// findContentVOBFiles returns the paths of all content VOBs (VTS_xx_N.VOB
+// with N >= 1) in the VIDEO_TS directories of dir, ordered by directory,
+// title set and part so that each VOB set is contiguous and in stream order.
+func findContentVOBFiles(dir string) []string {
+	var vobs []string
+	for _, videoTS := range findVIDEOTSDirs(dir) {
+		entries, err := os.ReadDir(videoTS)
+		if err != nil {
+			continue
+		}
+		type vobFile struct {
+			path           string
+			titleSet, part int
+		}
+		var found []vobFile
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			ts, part, ok := parseVOBName(e.Name())
+			if !ok {
+				continue
+			}
+			found = append(found, vobFile{filepath.Join(videoTS, e.Name()), ts, part})
+		}
+		sort.Slice(found, func(i, j int) bool {
+			if found[i].titleSet != found[j].titleSet {
+				return found[i].titleSet < found[j].titleSet
+			}
+			return found[i].part < found[j].part
+		})
+		for _, f := range found {
+			vobs = append(vobs, f.path)
+		}
+	}
+	return vobs
+}
+
+// VOBSets groups source file paths into DVD VOB sets. Each returned group
+// lists the indices (into relPaths) of the VTS_xx_1..N.VOB parts of one
+// title set, in stream order. A set only continues while the parts are
+// adjacent in relPaths, live in the same directory, belong to the same title
+// set and have consecutive part numbers, so a missing part starts a new set.
+// Paths that are not content VOBs are not included in any group.
+//
+// The grouping is derived purely from the file names so that the indexer,
+// the dedup writer and the dedup reader all agree on it without it having to
+// be stored in the dedup file.
+func VOBSets(relPaths []string) [][]int {
+	var sets [][]int
+	var cur []int
+	var curDir string
+	var curTitleSet, lastPart int
+	for i, p := range relPaths {
+		dir, name := filepath.Split(p)
+		ts, part, ok := parseVOBName(name)
+		if !ok || !strings.EqualFold(filepath.Base(filepath.Clean(dir)), "VIDEO_TS") {
+			if len(cur) > 0 {
+				sets = append(sets, cur)
+				cur = nil
+			}
+			continue
+		}
+		if len(cur) > 0 && dir == curDir && ts == curTitleSet && part == lastPart+1 && cur[len(cur)-1] == i-1 {
+			cur = append(cur, i)
+			lastPart = part
+			continue
+		}
+		if len(cur) > 0 {
+			sets = append(sets, cur)
+		}
+		cur = []int{i}
+		curDir, curTitleSet, lastPart = dir, ts, part
+	}
+	if len(cur) > 0 {
+		sets = append(sets, cur)
+	}
+	return sets
+}
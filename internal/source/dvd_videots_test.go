@@ -0,0 +1,275 @@
+package source
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// buildTestDVDPack creates one 2048-byte DVD pack: a 14-byte MPEG-2 pack
+// header followed by a single PES packet filling the rest of the pack.
+// For Private Stream 1 (0xBD), a 4-byte AC3-style sub-stream header with
+// the given subStreamID is inserted before the payload. The payload is
+// repeated/truncated to fill the pack.
+func buildTestDVDPack(streamID, subStreamID byte, fill []byte) []byte {
+	const packSize = 2048
+	pack := make([]byte, packSize)
+	copy(pack[0:4], []byte{0x00, 0x00, 0x01, 0xBA})
+	pack[4] = 0x44 // MPEG-2 marker
+	pack[13] = 0x00
+
+	pes := pack[14:]
+	copy(pes[0:4], []byte{0x00, 0x00, 0x01, streamID})
+	pesLen := len(pes) - 6
+	pes[4] = byte(pesLen >> 8)
+	pes[5] = byte(pesLen)
+	pes[6] = 0x80
+	pes[7] = 0x00
+	pes[8] = 0x00 // header_data_length
+	payload := pes[9:]
+	if streamID == 0xBD {
+		payload[0] = subStreamID
+		payload[1] = 1
+		payload = payload[4:]
+	}
+	for i := range payload {
+		payload[i] = fill[i%len(fill)]
+	}
+	return pack
+}
+
+func TestParseVOBName(t *testing.T) {
+	tests := []struct {
+		name     string
+		titleSet int
+		part     int
+		ok       bool
+	}{
+		{"VTS_01_1.VOB", 1, 1, true},
+		{"VTS_12_9.VOB", 12, 9, true},
+		{"vts_02_3.vob", 2, 3, true},
+		{"VTS_01_0.VOB", 0, 0, false}, // menu VOB
+		{"VIDEO_TS.VOB", 0, 0, false},
+		{"VTS_01_0.IFO", 0, 0, false},
+		{"VTS_1_1.VOB", 0, 0, false},
+		{"VTS_AB_1.VOB", 0, 0, false},
+	}
+	for _, tt := range tests {
+		ts, part, ok := parseVOBName(tt.name)
+		if ts != tt.titleSet || part != tt.part || ok != tt.ok {
+			t.Errorf("parseVOBName(%q) = (%d, %d, %v), want (%d, %d, %v)",
+				tt.name, ts, part, ok, tt.titleSet, tt.part, tt.ok)
+		}
+	}
+}
+
+func TestVOBSets(t *testing.T) {
+	paths := []string{
+		"movie.iso",
+		"VIDEO_TS/VTS_01_1.VOB",
+		"VIDEO_TS/VTS_01_2.VOB",
+		"VIDEO_TS/VTS_01_3.VOB",
+		"VIDEO_TS/VTS_02_1.VOB",
+		"VIDEO_TS/VTS_03_1.VOB",
+		"VIDEO_TS/VTS_03_3.VOB", // part 2 missing: starts a new set
+		"disc2/VIDEO_TS/VTS_01_1.VOB",
+		"disc2/VIDEO_TS/VTS_01_2.VOB",
+		"other/VTS_01_1.VOB", // not in a VIDEO_TS directory
+	}
+	got := VOBSets(paths)
+	want := [][]int{{1, 2, 3}, {4}, {5}, {6}, {7, 8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("VOBSets() = %v, want %v", got, want)
+	}
+}
+
+// writeTestVIDEOTS writes the given files into dir/VIDEO_TS.
+func writeTestVIDEOTS(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	videoTS := filepath.Join(dir, "VIDEO_TS")
+	if err := os.MkdirAll(videoTS, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(videoTS, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectType_VIDEOTS(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestVIDEOTS(t, tmpDir, map[string][]byte{
+		"VIDEO_TS.IFO": []byte("fake"),
+		"VTS_01_0.IFO": []byte("fake"),
+		"VTS_01_1.VOB": []byte("fake"),
+	})
+
+	sourceType, err := DetectType(tmpDir)
+	if err != nil {
+		t.Fatalf("DetectType() error = %v", err)
+	}
+	if sourceType != TypeDVD {
+		t.Errorf("DetectType() = %v, want %v", sourceType, TypeDVD)
+	}
+}
+
+func TestDetectType_VIDEOTSWithoutContentVOBs(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestVIDEOTS(t, tmpDir, map[string][]byte{
+		"VIDEO_TS.VOB": []byte("fake"),
+		"VTS_01_0.VOB": []byte("fake"),
+	})
+
+	if _, err := DetectType(tmpDir); err != ErrUnknownSourceType {
+		t.Errorf("DetectType() error = %v, want %v", err, ErrUnknownSourceType)
+	}
+}
+
+func TestEnumerateMediaFiles_VIDEOTS(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestVIDEOTS(t, tmpDir, map[string][]byte{
+		"VIDEO_TS.VOB": []byte("menu"),
+		"VTS_01_0.VOB": []byte("menu"),
+		"VTS_01_0.IFO": []byte("ifo"),
+		"VTS_02_1.VOB": []byte("fake"),
+		"VTS_01_2.VOB": []byte("fake"),
+		"VTS_01_1.VOB": []byte("fake"),
+	})
+
+	files, err := EnumerateMediaFiles(tmpDir, TypeDVD)
+	if err != nil {
+		t.Fatalf("EnumerateMediaFiles() error = %v", err)
+	}
+	want := []string{
+		filepath.Join("VIDEO_TS", "VTS_01_1.VOB"),
+		filepath.Join("VIDEO_TS", "VTS_01_2.VOB"),
+		filepath.Join("VIDEO_TS", "VTS_02_1.VOB"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("EnumerateMediaFiles() = %v, want %v", files, want)
+	}
+}
+
+func TestDetectDVDCodecsFromIFODir(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestVIDEOTS(t, tmpDir, map[string][]byte{
+		"VTS_01_0.IFO": buildTestIFO(1, [][2]byte{{0, 5}}), // MPEG-2, AC3
+		"vts_02_0.ifo": buildTestIFO(1, [][2]byte{{6, 5}}), // MPEG-2, DTS
+		"VIDEO_TS.IFO": []byte("not a VTS IFO"),
+		"VTS_01_1.VOB": []byte("fake"),
+	})
+
+	codecs, err := detectDVDCodecsFromIFODir(filepath.Join(tmpDir, "VIDEO_TS"))
+	if err != nil {
+		t.Fatalf("detectDVDCodecsFromIFODir() error = %v", err)
+	}
+	if len(codecs.VideoCodecs) != 1 || codecs.VideoCodecs[0] != CodecMPEG2Video {
+		t.Errorf("VideoCodecs = %v, want [MPEG-2]", codecs.VideoCodecs)
+	}
+	if !containsCodec(codecs.AudioCodecs, CodecAC3Audio) || !containsCodec(codecs.AudioCodecs, CodecDTSAudio) {
+		t.Errorf("AudioCodecs = %v, want AC3 and DTS", codecs.AudioCodecs)
+	}
+
+	// DetectSourceCodecsFromDir uses the loose IFOs for VIDEO_TS sources
+	codecs, err = DetectSourceCodecsFromDir(tmpDir)
+	if err != nil {
+		t.Fatalf("DetectSourceCodecsFromDir() error = %v", err)
+	}
+	if !containsCodec(codecs.AudioCodecs, CodecDTSAudio) {
+		t.Errorf("DetectSourceCodecsFromDir() AudioCodecs = %v, want DTS", codecs.AudioCodecs)
+	}
+}
+
+func TestDetectDVDCodecsFromIFODir_NoIFOs(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestVIDEOTS(t, tmpDir, map[string][]byte{
+		"VTS_01_1.VOB": []byte("fake"),
+	})
+	if _, err := detectDVDCodecsFromIFODir(filepath.Join(tmpDir, "VIDEO_TS")); err == nil {
+		t.Error("expected error for VIDEO_TS without IFO files")
+	}
+}
+
+func TestIndexer_VOBSetAsContinuousStream(t *testing.T) {
+	videoFill := []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70}
+	audioFill := []byte{0x0B, 0x77, 0xAA, 0xBB}
+
+	// Four packs: V V A V, split into two VOB parts after the third pack.
+	packs := [][]byte{
+		buildTestDVDPack(0xE0, 0, videoFill),
+		buildTestDVDPack(0xE0, 0, videoFill[1:]),
+		buildTestDVDPack(0xBD, 0x80, audioFill),
+		buildTestDVDPack(0xE0, 0, videoFill[2:]),
+	}
+	stream := bytes.Join(packs, nil)
+	split := 3 * 2048
+
+	tmpDir := t.TempDir()
+	writeTestVIDEOTS(t, tmpDir, map[string][]byte{
+		"VTS_01_1.VOB": stream[:split],
+		"VTS_01_2.VOB": stream[split:],
+	})
+
+	indexer, err := NewIndexer(tmpDir, DefaultWindowSize)
+	if err != nil {
+		t.Fatalf("NewIndexer() error = %v", err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if len(index.Files) != 2 {
+		t.Fatalf("len(Files) = %d, want 2", len(index.Files))
+	}
+	if index.Files[0].Size != int64(split) || index.Files[1].Size != int64(len(stream)-split) {
+		t.Errorf("file sizes = %d, %d, want %d, %d",
+			index.Files[0].Size, index.Files[1].Size, split, len(stream)-split)
+	}
+	if len(index.ESReaders) != 2 || index.ESReaders[1] != nil {
+		t.Fatalf("ESReaders = %v, want [parser, nil]", index.ESReaders)
+	}
+	if !index.UsesESOffsets {
+		t.Error("UsesESOffsets = false, want true")
+	}
+
+	// The video ES spans both parts without a seam.
+	parser, ok := index.ESReaders[0].(*MPEGPSParser)
+	if !ok {
+		t.Fatalf("ESReaders[0] is %T, want *MPEGPSParser", index.ESReaders[0])
+	}
+	const payloadSize = 2048 - 14 - 9
+	if got := parser.TotalESSize(true); got != 3*payloadSize {
+		t.Fatalf("video ES size = %d, want %d", got, 3*payloadSize)
+	}
+	got, err := parser.ReadESData(2*payloadSize-10, 20, true)
+	if err != nil {
+		t.Fatalf("ReadESData across parts: %v", err)
+	}
+	wantData := append(append([]byte{}, packs[1][14+9+payloadSize-10:]...), packs[3][14+9:14+9+10]...)
+	if !bytes.Equal(got, wantData) {
+		t.Errorf("ReadESData across parts = %x, want %x", got, wantData)
+	}
+
+	// Raw ranges are offsets into the concatenated VOB set.
+	raw, err := parser.RawRangesForESRegion(2*payloadSize, 10, true)
+	if err != nil {
+		t.Fatalf("RawRangesForESRegion: %v", err)
+	}
+	if len(raw) != 1 || raw[0].FileOffset != int64(split+14+9) {
+		t.Errorf("RawRangesForESRegion = %+v, want offset %d", raw, split+14+9)
+	}
+
+	// All locations point at the first part of the set.
+	for _, locs := range index.HashToLocations {
+		for _, loc := range locs {
+			if loc.FileIndex != 0 {
+				t.Fatalf("location has FileIndex %d, want 0", loc.FileIndex)
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package source
+
+import "github.com/stuckj/mkvdup/internal/mkv"
+
+// Test helpers for the round-trip tests of package source_test, which can
+// import the matcher and dedup packages that themselves import source.
+var (
+	BuildTestDVDPack   = buildTestDVDPack
+	BuildTestBlurayISO = buildTestBlurayISO
+	MakeM2TSPacket     = makeM2TSPacket
+	MakePATPayload     = makePATPayload
+	MakePMTPayload     = makePMTPayload
+	MakePESStart       = makePESStart
+)
+
+// BuildTestVideoMKV builds an MKV file with one video track of codecID,
+// whose blocks are frames, four to a cluster.
+func BuildTestVideoMKV(codecID string, frames [][]byte) []byte {
+	blocks := make([]mkvTestBlock, len(frames))
+	for i, f := range frames {
+		blocks[i] = mkvTestBlock{1, f}
+	}
+	return buildTestMKV([]mkvTestTrack{{1, mkv.TrackTypeVideo, codecID, nil}}, blocks, 4)
+}
@@ -0,0 +1,713 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/mmap"
+)
+
+// indexCacheMagic starts every index cache file.
+const indexCacheMagic = "MKVDUPIX"
+
+// indexCacheVersion is the version of the index cache file format. It is
+// also raised whenever indexing changes what an index holds (new sync
+// points, new parser state), so that indexes cached by older builds are
+// rebuilt rather than used.
+const indexCacheVersion = 2
+
+// indexCacheExt is the extension of index cache files.
+const indexCacheExt = ".idx"
+
+// indexCacheTempGrace is how old a leftover temporary file must be before
+// Prune removes it, so that a cache file being written is left alone.
+const indexCacheTempGrace = time.Hour
+
+// errCacheVersion reports an index cache file of another format version.
+var errCacheVersion = errors.New("index cache file has another format version")
+
+// IndexCache is a directory of built source indexes, so that a source that
+// has not changed need not be indexed again. Each index is stored in its
+// own file, named after the source directory, window size, indexing mode
+// and playlist or title it was built for. A cached index is used only while
+// every file it was built from keeps its size and modification time.
+//
+// A cache file holds the hash table, the source file list with checksums,
+// and the parsed layout of each ES reader (its PES payload range tables),
+// so loading one maps the source files again without reading them.
+type IndexCache struct {
+	dir string
+}
+
+// NewIndexCache returns the index cache in dir. The directory is created
+// when the first index is stored.
+func NewIndexCache(dir string) (*IndexCache, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve index cache path: %w", err)
+	}
+	return &IndexCache{dir: abs}, nil
+}
+
+// DefaultIndexCacheDir returns the default index cache directory:
+// mkvdup/index under the user cache directory ($XDG_CACHE_HOME, or
+// ~/.cache).
+func DefaultIndexCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mkvdup", "index"), nil
+}
+
+// Dir returns the absolute path of the cache.
+func (c *IndexCache) Dir() string {
+	return c.dir
+}
+
+// path returns the path of the cache file for key.
+func (c *IndexCache) path(key string) string {
+	return filepath.Join(c.dir, key+indexCacheExt)
+}
+
+// cacheInput is a source file an index was built from, as it was then.
+type cacheInput struct {
+	path    string // Relative to the source directory
+	size    int64
+	modTime time.Time
+}
+
+// indexCacheHeader is the start of a cache file, describing the index
+// without its contents.
+type indexCacheHeader struct {
+	key         string
+	sourceDir   string // Absolute
+	sourceType  Type
+	windowSize  int
+	rawIndexing bool
+	scope       string
+	created     time.Time
+	inputs      []cacheInput
+	hashes      int
+}
+
+func writeCacheHeader(e *cacheEncoder, h *indexCacheHeader) {
+	e.write([]byte(indexCacheMagic))
+	e.uvarint(indexCacheVersion)
+	e.string(h.key)
+	e.string(h.sourceDir)
+	e.varint(int64(h.sourceType))
+	e.uvarint(uint64(h.windowSize))
+	e.bool(h.rawIndexing)
+	e.string(h.scope)
+	e.varint(h.created.UnixNano())
+	e.uvarint(uint64(len(h.inputs)))
+	for _, in := range h.inputs {
+		e.string(in.path)
+		e.varint(in.size)
+		e.varint(in.modTime.UnixNano())
+	}
+	e.uvarint(uint64(h.hashes))
+}
+
+func readCacheHeader(d *cacheDecoder) (*indexCacheHeader, error) {
+	magic := make([]byte, len(indexCacheMagic))
+	d.read(magic)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if string(magic) != indexCacheMagic {
+		return nil, fmt.Errorf("%w: bad magic", errCacheCorrupt)
+	}
+	if v := d.uvarint(); d.err == nil && v != indexCacheVersion {
+		return nil, fmt.Errorf("%w %d", errCacheVersion, v)
+	}
+	h := &indexCacheHeader{
+		key:         d.string(),
+		sourceDir:   d.string(),
+		sourceType:  Type(d.varint()),
+		windowSize:  int(d.uvarint()),
+		rawIndexing: d.bool(),
+		scope:       d.string(),
+		created:     time.Unix(0, d.varint()),
+	}
+	h.inputs = make([]cacheInput, d.count())
+	for i := range h.inputs {
+		h.inputs[i] = cacheInput{path: d.string(), size: d.varint(), modTime: time.Unix(0, d.varint())}
+	}
+	h.hashes = int(d.uvarint())
+	return h, d.err
+}
+
+// changedInput returns why inputs, the files an index was built from, no
+// longer match current, the files it would be built from now; or "" if
+// they still match.
+func changedInput(inputs, current []cacheInput) string {
+	if len(inputs) != len(current) {
+		return fmt.Sprintf("source had %d files, now %d", len(inputs), len(current))
+	}
+	for i, in := range inputs {
+		cur := current[i]
+		if in.path != cur.path {
+			return fmt.Sprintf("source file %s replaced by %s", in.path, cur.path)
+		}
+		if in.size != cur.size || !in.modTime.Equal(cur.modTime) {
+			return fmt.Sprintf("%s has changed", in.path)
+		}
+	}
+	return ""
+}
+
+// statInputs returns the given files of the source directory as they are
+// now.
+func statInputs(sourceDir string, files []string) ([]cacheInput, error) {
+	inputs := make([]cacheInput, len(files))
+	for i, relPath := range files {
+		info, err := os.Stat(filepath.Join(sourceDir, relPath))
+		if err != nil {
+			return nil, fmt.Errorf("get file info for %s: %w", relPath, err)
+		}
+		inputs[i] = cacheInput{path: relPath, size: info.Size(), modTime: info.ModTime()}
+	}
+	return inputs, nil
+}
+
+// cacheKey returns the key naming the cache file of the index idx builds,
+// and a description of the playlist or title and streams it is restricted
+// to ("" for the whole source).
+func (idx *Indexer) cacheKey() (key, scope string, err error) {
+	abs, err := filepath.Abs(idx.sourceDir)
+	if err != nil {
+		return "", "", fmt.Errorf("resolve source path: %w", err)
+	}
+	// The key also covers what decides which parts of the files are
+	// indexed: the clips of a playlist and the cells of a title. The
+	// scope describes the stream filter fully.
+	var detail string
+	if idx.playlist != nil {
+		scope = "playlist " + idx.playlist.String()
+		detail = strings.Join(idx.playlist.Clips, ",")
+	}
+	if idx.title != nil {
+		scope = "title " + idx.title.String()
+		detail = fmt.Sprint(idx.title.extents)
+	}
+	if idx.streams != nil {
+		if scope != "" {
+			scope += ", "
+		}
+		scope += "streams " + idx.streams.String()
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d\x00%d\x00%t\x00%s\x00%s",
+		abs, idx.sourceType, idx.windowSize, idx.useRawIndexing, scope, detail))
+	return hex.EncodeToString(sum[:16]), scope, nil
+}
+
+// SaveCache stores the index built by Build in the cache, replacing any
+// index cached for the same source and scope.
+func (idx *Indexer) SaveCache(c *IndexCache) error {
+	if len(idx.inputs) == 0 {
+		return errors.New("no index has been built")
+	}
+	key, scope, err := idx.cacheKey()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(idx.sourceDir)
+	if err != nil {
+		return fmt.Errorf("resolve source path: %w", err)
+	}
+	index := idx.index
+	if index.UsesESOffsets && len(index.ESReaders) != len(index.Files) ||
+		!index.UsesESOffsets && len(index.RawReaders) != len(index.Files) {
+		return fmt.Errorf("index has %d files but %d ES and %d raw readers",
+			len(index.Files), len(index.ESReaders), len(index.RawReaders))
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("create index cache directory: %w", err)
+	}
+	// Write to a temporary file and rename it into place, so that a
+	// concurrent run never loads a partial index.
+	tmp, err := os.CreateTemp(c.dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("create index cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// A checksum of everything else ends the file
+	checksum := xxhash.New()
+	e := newCacheEncoder(io.MultiWriter(tmp, checksum))
+	writeCacheHeader(e, &indexCacheHeader{
+		key:         key,
+		sourceDir:   abs,
+		sourceType:  idx.sourceType,
+		windowSize:  idx.windowSize,
+		rawIndexing: idx.useRawIndexing,
+		scope:       scope,
+		created:     time.Now(),
+		inputs:      idx.inputs,
+		hashes:      index.HashCount(),
+	})
+	if err := writeCacheBody(e, index); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := e.flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write index cache file: %w", err)
+	}
+	if _, err := tmp.Write(binary.LittleEndian.AppendUint64(nil, checksum.Sum64())); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write index cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write index cache file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("chmod index cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("rename index cache file: %w", err)
+	}
+	return nil
+}
+
+// writeCacheBody writes the contents of index: its source files, ES
+// readers and hash table.
+func writeCacheBody(e *cacheEncoder, index *Index) error {
+	e.bool(index.UsesESOffsets)
+	e.uvarint(uint64(len(index.Files)))
+	for _, f := range index.Files {
+		e.string(f.RelativePath)
+		e.varint(f.Size)
+		e.uint64(f.Checksum)
+		e.uvarint(uint64(len(f.ChunkChecksums)))
+		for _, sum := range f.ChunkChecksums {
+			e.uint64(sum)
+		}
+	}
+	e.uvarint(uint64(len(index.SkippedStreams)))
+	for _, s := range index.SkippedStreams {
+		e.uvarint(uint64(s.FileIndex))
+		e.bool(s.IsVideo)
+		e.byte(s.SubStreamID)
+		e.uvarint(uint64(s.Codec))
+		e.uvarint(uint64(s.Channels))
+	}
+
+	if index.UsesESOffsets {
+		for i, reader := range index.ESReaders {
+			// The first part of a VOB set reads the parts after it, which
+			// have no reader of their own.
+			parts := 1
+			for parts < len(index.ESReaders)-i && index.ESReaders[i+parts] == nil {
+				parts++
+			}
+			if err := writeReader(e, reader, parts); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.uvarint(uint64(index.HashCount()))
+	index.forEachHash(func(hash uint64, locs []Location) {
+		e.uint64(hash)
+		e.uvarint(uint64(len(locs)))
+		var offset int64
+		for _, loc := range locs {
+			var flags byte
+			if loc.IsVideo {
+				flags = 1
+			}
+			e.uvarint(uint64(loc.FileIndex))
+			e.varint(loc.Offset - offset)
+			e.write([]byte{flags, loc.AudioSubStreamID})
+			offset = loc.Offset
+		}
+	})
+	return nil
+}
+
+// LoadCache replaces the index with the one cached for the same source and
+// scope, if there is one and the source files have not changed since it was
+// built. It reports whether the cached index was loaded; when it was not,
+// Build must be called as usual. An error means the cache file could not
+// be read; the index is left empty then too.
+//
+// With a stream filter set, an index of every stream is loaded when no
+// filtered one is cached, since it is loaded faster than the filtered one
+// is built.
+func (idx *Indexer) LoadCache(c *IndexCache) (bool, error) {
+	loaded, err := idx.loadCache(c)
+	if loaded || err != nil || idx.streams == nil {
+		return loaded, err
+	}
+	streams := idx.streams
+	idx.streams = nil
+	defer func() { idx.streams = streams }()
+	return idx.loadCache(c)
+}
+
+// loadCache loads the index cached under the key of idx's settings (see
+// LoadCache).
+func (idx *Indexer) loadCache(c *IndexCache) (bool, error) {
+	key, _, err := idx.cacheKey()
+	if err != nil {
+		return false, err
+	}
+	path := c.path(key)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("open index cache file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("open index cache file: %w", err)
+	}
+	if info.Size() < 8 {
+		return false, fmt.Errorf("%s: %w", path, errCacheCorrupt)
+	}
+
+	checksum := xxhash.New()
+	d := newCacheDecoder(io.TeeReader(f, checksum), info.Size()-8)
+	h, err := readCacheHeader(d)
+	if errors.Is(err, errCacheVersion) {
+		idx.verbosef("  Cached index %s was written by another version; rebuilding\n", path)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if h.key != key {
+		return false, nil
+	}
+	files, err := idx.mediaFiles()
+	if err != nil {
+		return false, err
+	}
+	inputs, err := statInputs(idx.sourceDir, files)
+	if err != nil {
+		return false, err
+	}
+	if reason := changedInput(h.inputs, inputs); reason != "" {
+		idx.verbosef("  Cached index %s is out of date (%s); rebuilding\n", path, reason)
+		return false, nil
+	}
+
+	index := NewIndex(idx.sourceDir, idx.sourceType, idx.windowSize)
+	err = idx.readCacheBody(d, index)
+	if err == nil && !d.atEnd() {
+		err = fmt.Errorf("%w: trailing data", errCacheCorrupt)
+	}
+	if err == nil {
+		var sum [8]byte
+		if _, err = f.ReadAt(sum[:], info.Size()-8); err == nil && binary.LittleEndian.Uint64(sum[:]) != checksum.Sum64() {
+			err = fmt.Errorf("%w: checksum mismatch", errCacheCorrupt)
+		}
+	}
+	if err != nil {
+		index.Close()
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	idx.index = index
+	idx.inputs = inputs
+	return true, nil
+}
+
+// readCacheBody reads what writeCacheBody wrote into index, mapping the
+// source files for its readers.
+func (idx *Indexer) readCacheBody(d *cacheDecoder, index *Index) error {
+	index.UsesESOffsets = d.bool()
+	index.Files = make([]File, d.count())
+	for i := range index.Files {
+		f := &index.Files[i]
+		f.RelativePath = d.string()
+		f.Size = d.varint()
+		f.Checksum = d.uint64()
+		if n := d.count(); n > 0 {
+			f.ChunkChecksums = make([]uint64, n)
+			for j := range f.ChunkChecksums {
+				f.ChunkChecksums[j] = d.uint64()
+			}
+		}
+	}
+	if n := d.count(); n > 0 {
+		index.SkippedStreams = make([]SkippedStream, n)
+		for i := range index.SkippedStreams {
+			s := &index.SkippedStreams[i]
+			fileIndex := d.uvarint()
+			if fileIndex >= uint64(len(index.Files)) {
+				d.fail(fmt.Errorf("%w: skipped stream in file %d of %d", errCacheCorrupt, fileIndex, len(index.Files)))
+			}
+			s.FileIndex = uint16(fileIndex)
+			s.IsVideo = d.bool()
+			s.SubStreamID = d.byte()
+			s.Codec = CodecType(d.uvarint())
+			s.Channels = int(d.uvarint())
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	// Source entries of one Blu-ray ISO share a single mapping
+	mapped := make(map[string]*mmap.File)
+	open := func(relPath string) ([]byte, error) {
+		if m, ok := mapped[relPath]; ok {
+			return m.Data(), nil
+		}
+		m, err := mmap.Open(filepath.Join(idx.sourceDir, relPath))
+		if err != nil {
+			return nil, fmt.Errorf("mmap open %s: %w", relPath, err)
+		}
+		mapped[relPath] = m
+		index.MmapFiles = append(index.MmapFiles, m)
+		return m.Data(), nil
+	}
+
+	if index.UsesESOffsets {
+		for i, f := range index.Files {
+			reader, err := idx.readReader(d,
+				func() ([]byte, error) { return open(f.RelativePath) },
+				func(n int) ([][]byte, error) {
+					if n < 1 || n > len(index.Files)-i {
+						return nil, fmt.Errorf("%w: VOB set of %d parts", errCacheCorrupt, n)
+					}
+					parts := make([][]byte, n)
+					for j := range parts {
+						var err error
+						if parts[j], err = open(index.Files[i+j].RelativePath); err != nil {
+							return nil, err
+						}
+					}
+					return parts, nil
+				})
+			if err != nil {
+				return fmt.Errorf("reader of %s: %w", f.RelativePath, err)
+			}
+			index.ESReaders = append(index.ESReaders, reader)
+		}
+	} else {
+		for _, f := range index.Files {
+			m, err := mmap.Open(filepath.Join(idx.sourceDir, f.RelativePath))
+			if err != nil {
+				return fmt.Errorf("mmap open %s: %w", f.RelativePath, err)
+			}
+			index.RawReaders = append(index.RawReaders, &mmapRawReader{mmapFile: m})
+		}
+	}
+
+	// The hash table is loaded into the backend Build would choose
+	var totalSize int64
+	for _, f := range index.Files {
+		totalSize += f.Size
+	}
+	sorter := idx.newLocationSorter(estimatedLocations(totalSize))
+	n := d.count()
+	if sorter != nil {
+		defer sorter.abort()
+	} else {
+		index.HashToLocations = make(map[uint64][]Location, n)
+	}
+	for range n {
+		hash := d.uint64()
+		locs := make([]Location, d.count())
+		var offset int64
+		for j := range locs {
+			fileIndex := d.uvarint()
+			offset += d.varint()
+			flags := d.byte()
+			if fileIndex >= uint64(len(index.Files)) {
+				d.fail(fmt.Errorf("%w: location in file %d of %d", errCacheCorrupt, fileIndex, len(index.Files)))
+			}
+			locs[j] = Location{FileIndex: uint16(fileIndex), Offset: offset, IsVideo: flags&1 != 0, AudioSubStreamID: d.byte()}
+		}
+		if d.err != nil {
+			return d.err
+		}
+		if sorter == nil {
+			index.HashToLocations[hash] = locs
+			continue
+		}
+		for _, loc := range locs {
+			sorter.add(hash, loc)
+		}
+	}
+	if d.err != nil || sorter == nil {
+		return d.err
+	}
+	sorted, err := sorter.finish()
+	if err != nil {
+		return fmt.Errorf("sort index: %w", err)
+	}
+	index.sorted = sorted
+	return nil
+}
+
+// verbosef writes diagnostic output when a verbose writer is set.
+func (idx *Indexer) verbosef(format string, args ...any) {
+	if idx.verboseWriter != nil {
+		fmt.Fprintf(idx.verboseWriter, format, args...)
+	}
+}
+
+// IndexCacheEntry describes an index in the cache.
+type IndexCacheEntry struct {
+	Path        string    // Cache file
+	Size        int64     // Size of the cache file
+	SourceDir   string    // Absolute path of the indexed source
+	SourceType  Type      // Type of the source
+	Scope       string    // Playlist, title and streams the index is restricted to ("" for the whole source)
+	WindowSize  int       // Bytes hashed at each sync point
+	RawIndexing bool      // Whether the files were indexed raw rather than by ES
+	Created     time.Time // When the index was built
+	SourceFiles int       // Number of source files indexed
+	SourceSize  int64     // Total size of the source files
+	Hashes      int       // Number of distinct hashes
+	Stale       string    // Why the index can no longer be used ("" while it can)
+}
+
+// List returns the indexes in the cache, sorted by source directory. An
+// index is stale when one of its source files is missing or has changed,
+// or when its file was written by another version or cannot be read. Files
+// added to a source since its index was built are only noticed when the
+// index is loaded.
+func (c *IndexCache) List() ([]IndexCacheEntry, error) {
+	dirEntries, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read index cache: %w", err)
+	}
+	var entries []IndexCacheEntry
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), indexCacheExt) {
+			continue
+		}
+		entries = append(entries, readIndexCacheEntry(filepath.Join(c.dir, de.Name())))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].SourceDir != entries[j].SourceDir {
+			return entries[i].SourceDir < entries[j].SourceDir
+		}
+		return entries[i].Scope < entries[j].Scope
+	})
+	return entries, nil
+}
+
+// readIndexCacheEntry describes the cache file at path from its header.
+func readIndexCacheEntry(path string) IndexCacheEntry {
+	entry := IndexCacheEntry{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		entry.Stale = fmt.Sprintf("unreadable: %v", err)
+		return entry
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		entry.Size = info.Size()
+	}
+	h, err := readCacheHeader(newCacheDecoder(f, entry.Size))
+	if errors.Is(err, errCacheVersion) {
+		entry.Stale = "written by another version"
+		return entry
+	}
+	if err != nil {
+		entry.Stale = fmt.Sprintf("unreadable: %v", err)
+		return entry
+	}
+
+	entry.SourceDir = h.sourceDir
+	entry.SourceType = h.sourceType
+	entry.Scope = h.scope
+	entry.WindowSize = h.windowSize
+	entry.RawIndexing = h.rawIndexing
+	entry.Created = h.created
+	entry.SourceFiles = len(h.inputs)
+	entry.Hashes = h.hashes
+	files := make([]string, len(h.inputs))
+	for i, in := range h.inputs {
+		entry.SourceSize += in.size
+		files[i] = in.path
+	}
+	current, err := statInputs(h.sourceDir, files)
+	if err != nil {
+		entry.Stale = "source file missing"
+		for _, relPath := range files {
+			if _, err := os.Stat(filepath.Join(h.sourceDir, relPath)); err != nil {
+				entry.Stale = relPath + " is missing"
+				break
+			}
+		}
+		return entry
+	}
+	entry.Stale = changedInput(h.inputs, current)
+	return entry
+}
+
+// IndexCachePruneResult summarizes a Prune run.
+type IndexCachePruneResult struct {
+	Kept         int   // Indexes kept
+	Removed      int   // Indexes removed (or that would be)
+	RemovedBytes int64 // Size of the removed cache files
+}
+
+// Prune removes the stale indexes of the cache (see List), or with all
+// every index, along with leftover temporary files. With dryRun, nothing is
+// removed but the result reports what would be.
+func (c *IndexCache) Prune(all, dryRun bool) (IndexCachePruneResult, error) {
+	var res IndexCachePruneResult
+	entries, err := c.List()
+	if err != nil {
+		return res, err
+	}
+	for _, e := range entries {
+		if !all && e.Stale == "" {
+			res.Kept++
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(e.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return res, fmt.Errorf("remove %s: %w", e.Path, err)
+			}
+		}
+		res.Removed++
+		res.RemovedBytes += e.Size
+	}
+
+	temps, err := filepath.Glob(filepath.Join(c.dir, ".tmp-*"))
+	if err != nil {
+		return res, err
+	}
+	cutoff := time.Now().Add(-indexCacheTempGrace)
+	for _, path := range temps {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return res, fmt.Errorf("remove %s: %w", path, err)
+			}
+		}
+		res.RemovedBytes += info.Size()
+	}
+	return res, nil
+}
@@ -0,0 +1,267 @@
+package source
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// cacheEncoder writes the varint-based encoding of index cache files. The
+// first write error is kept in err and later writes are skipped, so callers
+// check it once at the end.
+type cacheEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newCacheEncoder(w io.Writer) *cacheEncoder {
+	return &cacheEncoder{w: bufio.NewWriterSize(w, 1<<20)}
+}
+
+func (e *cacheEncoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *cacheEncoder) uvarint(v uint64) {
+	e.write(binary.AppendUvarint(e.buf[:0], v))
+}
+
+func (e *cacheEncoder) varint(v int64) {
+	e.write(binary.AppendVarint(e.buf[:0], v))
+}
+
+func (e *cacheEncoder) uint64(v uint64) {
+	e.write(binary.LittleEndian.AppendUint64(e.buf[:0], v))
+}
+
+func (e *cacheEncoder) byte(b byte) {
+	e.write([]byte{b})
+}
+
+func (e *cacheEncoder) bool(b bool) {
+	if b {
+		e.byte(1)
+	} else {
+		e.byte(0)
+	}
+}
+
+func (e *cacheEncoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *cacheEncoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.write(b)
+}
+
+// ranges writes PES payload ranges. Offsets are stored relative to the end
+// of the previous range, where consecutive ranges of a stream usually
+// continue, so most take a few bytes.
+func (e *cacheEncoder) ranges(rs []PESPayloadRange) {
+	e.uvarint(uint64(len(rs)))
+	var fileEnd, esEnd int64
+	for _, r := range rs {
+		e.varint(r.FileOffset - fileEnd)
+		e.varint(int64(r.Size))
+		e.varint(r.ESOffset - esEnd)
+		fileEnd = r.FileOffset + int64(r.Size)
+		esEnd = r.ESOffset + int64(r.Size)
+	}
+}
+
+func (e *cacheEncoder) uint32s(s []uint32) {
+	e.uvarint(uint64(len(s)))
+	for _, v := range s {
+		e.uvarint(uint64(v))
+	}
+}
+
+func (e *cacheEncoder) flush() error {
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
+
+// writeCacheMap writes the entries of m in key order.
+func writeCacheMap[K cmp.Ordered, V any](e *cacheEncoder, m map[K]V, key func(K), value func(V)) {
+	e.uvarint(uint64(len(m)))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		key(k)
+		value(m[k])
+	}
+}
+
+// errCacheCorrupt reports an index cache file that does not decode.
+var errCacheCorrupt = errors.New("index cache file is corrupt")
+
+// cacheDecoder reads what cacheEncoder writes. Like the encoder, it keeps
+// the first error and returns zero values after it.
+type cacheDecoder struct {
+	r    *bufio.Reader
+	src  *countingReader
+	size int64 // Bytes the decoder may read from src
+	err  error
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// newCacheDecoder returns a decoder reading at most size bytes of r.
+func newCacheDecoder(r io.Reader, size int64) *cacheDecoder {
+	src := &countingReader{r: io.LimitReader(r, size)}
+	return &cacheDecoder{r: bufio.NewReaderSize(src, 1<<20), src: src, size: size}
+}
+
+// remaining returns the number of bytes left to decode.
+func (d *cacheDecoder) remaining() int64 {
+	return d.size - d.src.n + int64(d.r.Buffered())
+}
+
+// atEnd reports whether everything has been decoded.
+func (d *cacheDecoder) atEnd() bool {
+	_, err := d.r.Peek(1)
+	return errors.Is(err, io.EOF)
+}
+
+func (d *cacheDecoder) fail(err error) {
+	if d.err == nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = err
+	}
+}
+
+func (d *cacheDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *cacheDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *cacheDecoder) uint64() uint64 {
+	var b [8]byte
+	d.read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (d *cacheDecoder) read(b []byte) {
+	if d.err != nil {
+		clear(b)
+		return
+	}
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.fail(err)
+	}
+}
+
+func (d *cacheDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.fail(err)
+	}
+	return b
+}
+
+func (d *cacheDecoder) bool() bool {
+	return d.byte() != 0
+}
+
+// count reads a number of elements. Each element takes at least a byte, so
+// a count beyond the bytes left is corrupt, and is rejected before anything
+// is allocated for it.
+func (d *cacheDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(d.remaining()) {
+		d.fail(fmt.Errorf("%w: count %d", errCacheCorrupt, n))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *cacheDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *cacheDecoder) bytes() []byte {
+	b := make([]byte, d.count())
+	d.read(b)
+	return b
+}
+
+func (d *cacheDecoder) ranges() []PESPayloadRange {
+	rs := make([]PESPayloadRange, d.count())
+	var fileEnd, esEnd int64
+	for i := range rs {
+		if d.err != nil {
+			return nil
+		}
+		r := &rs[i]
+		r.FileOffset = fileEnd + d.varint()
+		r.Size = int(d.varint())
+		r.ESOffset = esEnd + d.varint()
+		fileEnd = r.FileOffset + int64(r.Size)
+		esEnd = r.ESOffset + int64(r.Size)
+	}
+	return rs
+}
+
+func (d *cacheDecoder) uint32s() []uint32 {
+	s := make([]uint32, d.count())
+	for i := range s {
+		s[i] = uint32(d.uvarint())
+	}
+	return s
+}
+
+// readCacheMap reads a map written by writeCacheMap.
+func readCacheMap[K comparable, V any](d *cacheDecoder, key func() K, value func() V) map[K]V {
+	n := d.count()
+	m := make(map[K]V, n)
+	for range n {
+		if d.err != nil {
+			break
+		}
+		k := key()
+		m[k] = value()
+	}
+	return m
+}
@@ -0,0 +1,236 @@
+package source
+
+import (
+	"fmt"
+)
+
+// Kinds of ES reader stored in an index cache file. A reader is rebuilt
+// over the re-mapped source file with the constructor Build used, then
+// given its parsed state back, so nothing is parsed again.
+const (
+	cachedReaderNone    byte = iota // No reader: a later part of a VOB set
+	cachedReaderMPEGPS              // MPEGPSParser or dvdTitleAdapter, as newDVDParser returns
+	cachedReaderMPEGTS              // MPEGTSParser over a whole M2TS or .ts file
+	cachedReaderISOM2TS             // isoM2TSAdapter over an M2TS region of a Blu-ray ISO
+	cachedReaderMP4                 // MP4Parser
+	cachedReaderMKV                 // MKVSourceParser
+)
+
+// writeReader writes an ES reader of the index. parts is the number of
+// source files the reader spans (those of a VOB set).
+func writeReader(e *cacheEncoder, reader ESReader, parts int) error {
+	switch r := reader.(type) {
+	case nil:
+		e.byte(cachedReaderNone)
+	case *MPEGPSParser:
+		e.byte(cachedReaderMPEGPS)
+		e.uvarint(uint64(parts))
+		writeMPEGPSState(e, r)
+	case *dvdTitleAdapter:
+		e.byte(cachedReaderMPEGPS)
+		e.uvarint(uint64(parts))
+		writeMPEGPSState(e, r.MPEGPSParser)
+	case *MPEGTSParser:
+		e.byte(cachedReaderMPEGTS)
+		writeMPEGTSState(e, r)
+	case *isoM2TSAdapter:
+		e.byte(cachedReaderISOM2TS)
+		e.varint(r.baseOffset)
+		e.varint(r.parser.size)
+		e.uvarint(uint64(len(r.extentMap)))
+		for _, em := range r.extentMap {
+			e.varint(em.ISOOffset)
+			e.varint(em.Length)
+		}
+		writeMPEGTSState(e, r.parser)
+	case *MP4Parser:
+		e.byte(cachedReaderMP4)
+		writeSampleESState(e, &r.sampleES)
+	case *MKVSourceParser:
+		e.byte(cachedReaderMKV)
+		writeSampleESState(e, &r.sampleES)
+		writeCacheMap(e, r.subStreamTrackType, e.byte, func(v int) { e.varint(int64(v)) })
+		writeCacheMap(e, r.pcmSubStreams, e.byte, e.bool)
+	default:
+		return fmt.Errorf("ES reader %T cannot be cached", reader)
+	}
+	return nil
+}
+
+// readReader reads an ES reader written by writeReader. data returns the
+// mapped data of the reader's source file, and parts that of the VOB set
+// it starts.
+func (idx *Indexer) readReader(d *cacheDecoder, data func() ([]byte, error), parts func(n int) ([][]byte, error)) (ESReader, error) {
+	kind := d.byte()
+	if d.err != nil {
+		return nil, d.err
+	}
+	switch kind {
+	case cachedReaderNone:
+		return nil, nil
+	case cachedReaderMPEGPS:
+		n := d.count()
+		if d.err != nil {
+			return nil, d.err
+		}
+		p, err := parts(n)
+		if err != nil {
+			return nil, err
+		}
+		parser, reader, err := idx.newDVDParser(p)
+		if err != nil {
+			return nil, err
+		}
+		readMPEGPSState(d, parser)
+		return reader, d.err
+	}
+
+	b, err := data()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case cachedReaderMPEGTS:
+		parser := NewMPEGTSParser(b)
+		readMPEGTSState(d, parser)
+		return parser, d.err
+	case cachedReaderISOM2TS:
+		base, size := d.varint(), d.varint()
+		extents := make([]isoPhysicalRange, d.count())
+		for i := range extents {
+			extents[i] = isoPhysicalRange{ISOOffset: d.varint(), Length: d.varint()}
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+		var adapter *isoM2TSAdapter
+		if len(extents) > 0 {
+			mr := newMultiRegionData(extents, b)
+			adapter = newISOAdapterMultiExtent(NewMPEGTSParserMultiRegion(mr), mr, extents)
+		} else {
+			if base < 0 || size < 0 || base+size > int64(len(b)) {
+				return nil, fmt.Errorf("%w: M2TS region beyond the ISO", errCacheCorrupt)
+			}
+			adapter = newISOAdapter(NewMPEGTSParser(b[base:base+size]), b, base)
+		}
+		readMPEGTSState(d, adapter.parser)
+		return adapter, d.err
+	case cachedReaderMP4:
+		parser := NewMP4Parser(b)
+		readSampleESState(d, &parser.sampleES)
+		return parser, d.err
+	case cachedReaderMKV:
+		parser := NewMKVSourceParser(b)
+		readSampleESState(d, &parser.sampleES)
+		parser.subStreamTrackType = readCacheMap(d, d.byte, func() int { return int(d.varint()) })
+		parser.pcmSubStreams = readCacheMap(d, d.byte, d.bool)
+		return parser, d.err
+	}
+	return nil, fmt.Errorf("%w: unknown ES reader kind %d", errCacheCorrupt, kind)
+}
+
+func writeMPEGPSState(e *cacheEncoder, p *MPEGPSParser) {
+	e.ranges(p.videoRanges)
+	e.ranges(p.audioRanges)
+	e.ranges(p.filteredVideoRanges)
+	writeCacheMap(e, p.filteredAudioBySubStream, e.byte, e.ranges)
+	e.bytes(p.audioSubStreams)
+	e.bool(p.filterUserData)
+	writeCacheMap(e, p.lpcmSubStreams, e.byte, e.bool)
+	writeCacheMap(e, p.lpcmInfo, e.byte, func(h LPCMFrameHeader) {
+		e.bool(h.Emphasis)
+		e.bool(h.Mute)
+		e.write([]byte{h.FrameNumber, h.Quantization, h.SampleRate, h.Channels})
+	})
+}
+
+// readMPEGPSState restores what Parse leaves in p. The PES packet list and
+// the stream IDs of the audio ranges only serve parsing, so they are not
+// cached.
+func readMPEGPSState(d *cacheDecoder, p *MPEGPSParser) {
+	p.videoRanges = d.ranges()
+	p.audioRanges = d.ranges()
+	p.filteredVideoRanges = d.ranges()
+	p.filteredAudioBySubStream = readCacheMap(d, d.byte, d.ranges)
+	p.audioSubStreams = d.bytes()
+	p.filterUserData = d.bool()
+	p.lpcmSubStreams = readCacheMap(d, d.byte, d.bool)
+	p.lpcmInfo = readCacheMap(d, d.byte, func() LPCMFrameHeader {
+		h := LPCMFrameHeader{Emphasis: d.bool(), Mute: d.bool()}
+		var b [4]byte
+		d.read(b[:])
+		h.FrameNumber, h.Quantization, h.SampleRate, h.Channels = b[0], b[1], b[2], b[3]
+		return h
+	})
+}
+
+func writeMPEGTSState(e *cacheEncoder, p *MPEGTSParser) {
+	e.uvarint(uint64(p.packetSize))
+	e.uvarint(uint64(p.tsOffset))
+	e.uvarint(uint64(p.videoPID))
+	e.uvarint(uint64(len(p.audioPIDs)))
+	for _, pid := range p.audioPIDs {
+		e.uvarint(uint64(pid))
+	}
+	e.varint(int64(p.videoCodec))
+	e.ranges(p.videoRanges)
+	e.ranges(p.filteredVideoRanges)
+	writeCacheMap(e, p.audioBySubStream, e.byte, e.ranges)
+	e.bytes(p.audioSubStreams)
+	writeCacheMap(e, p.pidToSubStream, func(pid uint16) { e.uvarint(uint64(pid)) }, e.byte)
+	writeCacheMap(e, p.subStreamToPID, e.byte, func(pid uint16) { e.uvarint(uint64(pid)) })
+	writeCacheMap(e, p.subStreamCodec, e.byte, func(c CodecType) { e.varint(int64(c)) })
+	writeCacheMap(e, p.lpcmHeaders, e.byte, func(h BDLPCMHeader) {
+		e.write([]byte{h.ChannelAssignment, h.SampleRate, h.BitsPerSample})
+	})
+	writeCacheMap(e, p.lpcmSampleSize, e.byte, func(n int) { e.uvarint(uint64(n)) })
+	e.bool(p.filterUserData)
+}
+
+func readMPEGTSState(d *cacheDecoder, p *MPEGTSParser) {
+	pid := func() uint16 { return uint16(d.uvarint()) }
+	p.packetSize = int(d.uvarint())
+	p.tsOffset = int(d.uvarint())
+	p.videoPID = pid()
+	p.audioPIDs = make([]uint16, d.count())
+	for i := range p.audioPIDs {
+		p.audioPIDs[i] = pid()
+	}
+	p.videoCodec = CodecType(d.varint())
+	p.videoRanges = d.ranges()
+	p.filteredVideoRanges = d.ranges()
+	p.audioBySubStream = readCacheMap(d, d.byte, d.ranges)
+	p.audioSubStreams = d.bytes()
+	p.pidToSubStream = readCacheMap(d, pid, d.byte)
+	p.subStreamToPID = readCacheMap(d, d.byte, pid)
+	p.subStreamCodec = readCacheMap(d, d.byte, func() CodecType { return CodecType(d.varint()) })
+	p.lpcmHeaders = readCacheMap(d, d.byte, func() BDLPCMHeader {
+		var b [3]byte
+		d.read(b[:])
+		return BDLPCMHeader{ChannelAssignment: b[0], SampleRate: b[1], BitsPerSample: b[2]}
+	})
+	p.lpcmSampleSize = readCacheMap(d, d.byte, func() int { return int(d.uvarint()) })
+	p.filterUserData = d.bool()
+}
+
+func writeSampleESState(e *cacheEncoder, p *sampleES) {
+	e.varint(int64(p.videoCodec))
+	e.uvarint(uint64(p.nalLengthSize))
+	e.ranges(p.videoRanges)
+	e.uint32s(p.videoSampleSizes)
+	e.bytes(p.audioSubStreams)
+	writeCacheMap(e, p.audioBySubStream, e.byte, e.ranges)
+	writeCacheMap(e, p.audioSampleSizes, e.byte, e.uint32s)
+	writeCacheMap(e, p.subStreamCodec, e.byte, func(c CodecType) { e.varint(int64(c)) })
+}
+
+func readSampleESState(d *cacheDecoder, p *sampleES) {
+	p.videoCodec = CodecType(d.varint())
+	p.nalLengthSize = int(d.uvarint())
+	p.videoRanges = d.ranges()
+	p.videoSampleSizes = d.uint32s()
+	p.audioSubStreams = d.bytes()
+	p.audioBySubStream = readCacheMap(d, d.byte, d.ranges)
+	p.audioSampleSizes = readCacheMap(d, d.byte, d.uint32s)
+	p.subStreamCodec = readCacheMap(d, d.byte, func() CodecType { return CodecType(d.varint()) })
+}
@@ -0,0 +1,248 @@
+package source
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildCachedTestIndex builds the index of dir and stores it in a new cache.
+func buildCachedTestIndex(t *testing.T, dir string) (*Index, *IndexCache) {
+	t.Helper()
+	cache, err := NewIndexCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := indexer.SaveCache(cache); err != nil {
+		t.Fatalf("SaveCache: %v", err)
+	}
+	t.Cleanup(func() { indexer.Index().Close() })
+	return indexer.Index(), cache
+}
+
+// loadCachedTestIndex loads the cached index of dir, failing unless it is used.
+func loadCachedTestIndex(t *testing.T, dir string, cache *IndexCache) *Index {
+	t.Helper()
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := indexer.LoadCache(cache)
+	if err != nil {
+		t.Fatalf("LoadCache: %v", err)
+	}
+	if !loaded {
+		t.Fatal("LoadCache did not use the cached index")
+	}
+	t.Cleanup(func() { indexer.Index().Close() })
+	return indexer.Index()
+}
+
+// compareESReaders checks that two ES readers serve the same streams.
+func compareESReaders(t *testing.T, name string, want, got ESReader) {
+	t.Helper()
+	if reflect.TypeOf(got) != reflect.TypeOf(want) {
+		t.Fatalf("%s: reader is %T, want %T", name, got, want)
+	}
+	if want == nil {
+		return
+	}
+	if size := want.TotalESSize(true); got.TotalESSize(true) != size {
+		t.Errorf("%s: video ES size = %d, want %d", name, got.TotalESSize(true), size)
+	} else if size > 0 {
+		w, werr := want.ReadESData(0, int(size), true)
+		g, gerr := got.ReadESData(0, int(size), true)
+		if werr != nil || gerr != nil || !bytes.Equal(g, w) {
+			t.Errorf("%s: video ES differs (errors %v, %v)", name, gerr, werr)
+		}
+		wOff, wRem := want.ESOffsetToFileOffset(size-1, true)
+		gOff, gRem := got.ESOffsetToFileOffset(size-1, true)
+		if gOff != wOff || gRem != wRem {
+			t.Errorf("%s: last video byte at %d (%d left), want %d (%d left)", name, gOff, gRem, wOff, wRem)
+		}
+	}
+	if !bytes.Equal(got.AudioSubStreams(), want.AudioSubStreams()) {
+		t.Fatalf("%s: sub-streams = %v, want %v", name, got.AudioSubStreams(), want.AudioSubStreams())
+	}
+	for _, id := range want.AudioSubStreams() {
+		size := want.AudioSubStreamESSize(id)
+		if got.AudioSubStreamESSize(id) != size {
+			t.Errorf("%s: sub-stream %d size = %d, want %d", name, id, got.AudioSubStreamESSize(id), size)
+			continue
+		}
+		w, werr := want.ReadAudioSubStreamData(id, 0, int(size))
+		g, gerr := got.ReadAudioSubStreamData(id, 0, int(size))
+		if werr != nil || gerr != nil || !bytes.Equal(g, w) {
+			t.Errorf("%s: sub-stream %d differs (errors %v, %v)", name, id, gerr, werr)
+		}
+	}
+}
+
+func TestIndexCache_RoundTrip(t *testing.T) {
+	videoFill := []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70}
+	audioFill := []byte{0x0B, 0x77, 0xAA, 0xBB}
+	vobs := bytes.Join([][]byte{
+		buildTestDVDPack(0xE0, 0, videoFill),
+		buildTestDVDPack(0xE0, 0, videoFill[1:]),
+		buildTestDVDPack(0xBD, 0x80, audioFill),
+		buildTestDVDPack(0xE0, 0, videoFill[2:]),
+	}, nil)
+
+	for _, tt := range []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{"VOB set", map[string][]byte{
+			"VIDEO_TS/VTS_01_1.VOB": vobs[:3*2048],
+			"VIDEO_TS/VTS_01_2.VOB": vobs[3*2048:],
+		}},
+		{"M2TS", map[string][]byte{
+			"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+			"BDMV/STREAM/00002.m2ts": buildBasicM2TSData(),
+		}},
+		{"DVD and Blu-ray ISOs", map[string][]byte{
+			"disc1.iso": vobs,
+			"disc2.iso": buildTestBlurayISO(buildBasicM2TSData()),
+		}},
+		{"MKV", map[string][]byte{
+			"movie.mkv": buildTestMKV(testMKVTracks, testMKVBlocks(), 3),
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			built, cache := buildCachedTestIndex(t, dir)
+			loaded := loadCachedTestIndex(t, dir, cache)
+
+			if loaded.UsesESOffsets != built.UsesESOffsets || loaded.SourceType != built.SourceType {
+				t.Errorf("loaded UsesESOffsets %v, type %v; want %v, %v",
+					loaded.UsesESOffsets, loaded.SourceType, built.UsesESOffsets, built.SourceType)
+			}
+			if !reflect.DeepEqual(loaded.Files, built.Files) {
+				t.Errorf("Files = %+v, want %+v", loaded.Files, built.Files)
+			}
+			if len(built.HashToLocations) == 0 || !reflect.DeepEqual(loaded.HashToLocations, built.HashToLocations) {
+				t.Errorf("hash table of %d hashes differs from the built one of %d",
+					len(loaded.HashToLocations), len(built.HashToLocations))
+			}
+			if len(loaded.ESReaders) != len(built.ESReaders) {
+				t.Fatalf("%d ES readers, want %d", len(loaded.ESReaders), len(built.ESReaders))
+			}
+			for i := range built.ESReaders {
+				compareESReaders(t, built.Files[i].RelativePath, built.ESReaders[i], loaded.ESReaders[i])
+			}
+		})
+	}
+}
+
+func TestIndexCache_Stale(t *testing.T) {
+	dir := t.TempDir()
+	mkvPath := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(mkvPath, buildTestMKV(testMKVTracks, testMKVBlocks(), 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, cache := buildCachedTestIndex(t, dir)
+
+	// A different window size is cached separately
+	indexer, err := NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := indexer.LoadCache(cache); loaded || err != nil {
+		t.Errorf("LoadCache with another window size = %v, %v; want false, nil", loaded, err)
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Stale != "" || entries[0].SourceFiles != 1 || entries[0].Hashes == 0 {
+		t.Fatalf("List = %+v, want one valid entry", entries)
+	}
+
+	// Touching the source invalidates its index
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(mkvPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	indexer, err = NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := indexer.LoadCache(cache); loaded || err != nil {
+		t.Errorf("LoadCache of a changed source = %v, %v; want false, nil", loaded, err)
+	}
+	if entries, _ = cache.List(); len(entries) != 1 || !strings.Contains(entries[0].Stale, "movie.mkv") {
+		t.Errorf("List of a changed source = %+v, want it stale", entries)
+	}
+
+	res, err := cache.Prune(false, true)
+	if err != nil || res.Removed != 1 || res.RemovedBytes != entries[0].Size {
+		t.Errorf("Prune(dry run) = %+v, %v; want one removal", res, err)
+	}
+	if _, err := os.Stat(entries[0].Path); err != nil {
+		t.Errorf("dry run removed the index: %v", err)
+	}
+	if res, err = cache.Prune(false, false); err != nil || res.Removed != 1 {
+		t.Errorf("Prune = %+v, %v; want one removal", res, err)
+	}
+	if entries, _ = cache.List(); len(entries) != 0 {
+		t.Errorf("List after Prune = %+v, want none", entries)
+	}
+}
+
+func TestIndexCache_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.mkv"), buildTestMKV(testMKVTracks, testMKVBlocks(), 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, cache := buildCachedTestIndex(t, dir)
+	entries, err := cache.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	data, err := os.ReadFile(entries[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-20] ^= 0xFF
+	if err := os.WriteFile(entries[0].Path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := indexer.LoadCache(cache)
+	if loaded || err == nil {
+		t.Fatalf("LoadCache of a corrupt file = %v, %v; want an error", loaded, err)
+	}
+	if len(indexer.Index().HashToLocations) != 0 || len(indexer.Index().MmapFiles) != 0 {
+		t.Error("failed LoadCache left a partial index")
+	}
+	// The index can still be built
+	if err := indexer.Build(nil); err != nil {
+		t.Errorf("Build after failed LoadCache: %v", err)
+	}
+	indexer.Index().Close()
+}
@@ -9,6 +9,9 @@ import (
 
 // Lookup finds locations in the source that match the given hash.
 func (idx *Index) Lookup(hash uint64) []Location {
+	if idx.sorted != nil {
+		return idx.sorted.lookup(hash)
+	}
 	return idx.HashToLocations[hash]
 }
 
@@ -27,6 +30,24 @@ func (idx *Index) ReadESDataAt(loc Location, size int) ([]byte, error) {
 	return idx.ESReaders[loc.FileIndex].ReadAudioSubStreamData(loc.AudioSubStreamID, loc.Offset, size)
 }
 
+// LPCMSampleSize returns the sample size (2 or 3 bytes) if loc is in an LPCM
+// sub-stream whose samples are byte-swapped on read, or 0 otherwise. Without
+// an ES reader that knows, the DVD LPCM sub-stream ID range decides.
+func (idx *Index) LPCMSampleSize(loc Location) int {
+	if loc.IsVideo {
+		return 0
+	}
+	if int(loc.FileIndex) < len(idx.ESReaders) {
+		if sizer, ok := idx.ESReaders[loc.FileIndex].(LPCMSampleSizer); ok {
+			return sizer.LPCMSampleSize(loc.AudioSubStreamID)
+		}
+	}
+	if IsLPCMSubStreamID(loc.AudioSubStreamID) {
+		return 2
+	}
+	return 0
+}
+
 // hintedESReader is the interface for hint-based byte reading.
 // Both MPEGPSParser and MPEGTSParser implement this.
 type hintedESReader interface {
@@ -95,7 +116,9 @@ func (idx *Index) AdviseForMatching() {
 	}
 }
 
-// Close releases resources held by the index.
+// Close releases resources held by the index, dropping its hashes so that
+// their memory is freed even while the Index is still referenced. Closing
+// it again does nothing.
 func (idx *Index) Close() error {
 	// Close all mmap files (these back the ESReaders and RawReaders)
 	for _, mmapFile := range idx.MmapFiles {
@@ -109,5 +132,10 @@ func (idx *Index) Close() error {
 			reader.Close()
 		}
 	}
+	if idx.sorted != nil {
+		idx.sorted.close()
+	}
+	idx.MmapFiles, idx.RawReaders, idx.ESReaders = nil, nil, nil
+	idx.HashToLocations, idx.sorted = nil, nil
 	return nil
 }
@@ -0,0 +1,442 @@
+package source
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"slices"
+
+	"github.com/stuckj/mkvdup/internal/mmap"
+)
+
+// Memory-bounded indexing. Instead of HashToLocations, the locations of a
+// large source are collected in a bounded buffer that is sorted and spilled
+// to a temporary file whenever it fills up. The sorted runs are then merged
+// into one file of fixed-size records ordered by hash, which is mapped and
+// searched in place, so the index costs page cache rather than heap.
+
+const (
+	// sortedRecordSize is the size of a location record in sorted index
+	// files: hash, offset, file index, flags and sub-stream ID.
+	sortedRecordSize = 8 + 8 + 2 + 1 + 1
+
+	// sortEntrySize is the memory one location takes in the sort buffer.
+	sortEntrySize = 32
+
+	// mapBytesPerLocation estimates the memory one location takes in
+	// HashToLocations: a map slot with its slice header, and the slice's
+	// backing array.
+	mapBytesPerLocation = 64
+
+	// autoIndexMemoryDivisor sets the automatic limit on index memory to
+	// this fraction of physical memory.
+	autoIndexMemoryDivisor = 4
+)
+
+// minSortEntries is the smallest sort buffer used, however low the memory
+// limit, to keep the number of runs to merge reasonable.
+var minSortEntries = 1 << 16
+
+// compareLocations orders locations by file, offset, then stream. This is
+// the order of the locations of a hash after SortLocationsByOffset, with
+// ties broken so that both index backends return the same order.
+func compareLocations(a, b Location) int {
+	if c := cmp.Compare(a.FileIndex, b.FileIndex); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Offset, b.Offset); c != 0 {
+		return c
+	}
+	if a.IsVideo != b.IsVideo {
+		if a.IsVideo {
+			return 1
+		}
+		return -1
+	}
+	return cmp.Compare(a.AudioSubStreamID, b.AudioSubStreamID)
+}
+
+// sortEntry is a location with its hash, as held in the sort buffer.
+type sortEntry struct {
+	hash uint64
+	loc  Location
+}
+
+func compareSortEntries(a, b sortEntry) int {
+	if c := cmp.Compare(a.hash, b.hash); c != 0 {
+		return c
+	}
+	return compareLocations(a.loc, b.loc)
+}
+
+func appendSortedRecord(b []byte, e sortEntry) []byte {
+	b = binary.LittleEndian.AppendUint64(b, e.hash)
+	b = binary.LittleEndian.AppendUint64(b, uint64(e.loc.Offset))
+	b = binary.LittleEndian.AppendUint16(b, e.loc.FileIndex)
+	var flags byte
+	if e.loc.IsVideo {
+		flags = 1
+	}
+	return append(b, flags, e.loc.AudioSubStreamID)
+}
+
+func decodeSortedRecord(b []byte) sortEntry {
+	return sortEntry{
+		hash: binary.LittleEndian.Uint64(b),
+		loc: Location{
+			Offset:           int64(binary.LittleEndian.Uint64(b[8:])),
+			FileIndex:        binary.LittleEndian.Uint16(b[16:]),
+			IsVideo:          b[18]&1 != 0,
+			AudioSubStreamID: b[19],
+		},
+	}
+}
+
+// sortedIndex is a mapped file of location records in hash order.
+type sortedIndex struct {
+	file      *mmap.File
+	data      []byte
+	records   int
+	hashes    int // Distinct hashes
+	maxSearch int // Interpolation steps before falling back to bisection
+}
+
+func newSortedIndex(file *mmap.File, hashes int) *sortedIndex {
+	records := file.Len() / sortedRecordSize
+	return &sortedIndex{
+		file:      file,
+		data:      file.Data(),
+		records:   records,
+		hashes:    hashes,
+		maxSearch: 2 * bits.Len(uint(records)),
+	}
+}
+
+func (s *sortedIndex) hashAt(i int) uint64 {
+	return binary.LittleEndian.Uint64(s.data[i*sortedRecordSize:])
+}
+
+func (s *sortedIndex) locationAt(i int) Location {
+	return decodeSortedRecord(s.data[i*sortedRecordSize:]).loc
+}
+
+// find returns the first record of hash, or -1 if there is none. Hashes are
+// close to uniformly distributed, so interpolating the position of hash
+// between the bounds takes a few steps even for billions of records. The
+// search bisects instead if interpolation is not converging.
+func (s *sortedIndex) find(hash uint64) int {
+	lo, hi := 0, s.records-1
+	for step := 0; lo <= hi; step++ {
+		loHash, hiHash := s.hashAt(lo), s.hashAt(hi)
+		if hash < loHash || hash > hiHash {
+			return -1
+		}
+		mid := lo + (hi-lo)/2
+		if step < s.maxSearch && hiHash > loHash {
+			// (hash-loHash) * (hi-lo) / (hiHash-loHash), which is at most hi-lo
+			h, l := bits.Mul64(hash-loHash, uint64(hi-lo))
+			q, _ := bits.Div64(h, l, hiHash-loHash)
+			mid = lo + int(q)
+		}
+		switch h := s.hashAt(mid); {
+		case h < hash:
+			lo = mid + 1
+		case h > hash:
+			hi = mid - 1
+		default:
+			for mid > 0 && s.hashAt(mid-1) == hash {
+				mid--
+			}
+			return mid
+		}
+	}
+	return -1
+}
+
+// lookup returns the locations of hash.
+func (s *sortedIndex) lookup(hash uint64) []Location {
+	first := s.find(hash)
+	if first < 0 {
+		return nil
+	}
+	end := first + 1
+	for end < s.records && s.hashAt(end) == hash {
+		end++
+	}
+	locs := make([]Location, end-first)
+	for i := range locs {
+		locs[i] = s.locationAt(first + i)
+	}
+	return locs
+}
+
+// forEach calls fn with each hash and its locations, in hash order.
+func (s *sortedIndex) forEach(fn func(hash uint64, locs []Location)) {
+	var locs []Location
+	for i := 0; i < s.records; {
+		hash := s.hashAt(i)
+		locs = locs[:0]
+		for ; i < s.records && s.hashAt(i) == hash; i++ {
+			locs = append(locs, s.locationAt(i))
+		}
+		fn(hash, locs)
+	}
+}
+
+func (s *sortedIndex) close() error {
+	return s.file.Close()
+}
+
+// locationSorter collects the locations of an index in a buffer of at most
+// maxEntries, spilling each full buffer to a sorted run file. Errors are
+// kept and returned by finish.
+type locationSorter struct {
+	tempDir    string
+	maxEntries int
+	buf        []sortEntry
+	runs       []string // Spilled run files, each sorted
+	err        error
+}
+
+func newLocationSorter(tempDir string, maxEntries, estimate int) *locationSorter {
+	return &locationSorter{
+		tempDir:    tempDir,
+		maxEntries: maxEntries,
+		buf:        make([]sortEntry, 0, min(maxEntries, max(estimate, 1024))),
+	}
+}
+
+func (s *locationSorter) add(hash uint64, loc Location) {
+	if len(s.buf) == cap(s.buf) {
+		if cap(s.buf) < s.maxEntries {
+			s.buf = slices.Grow(s.buf, min(cap(s.buf), s.maxEntries-cap(s.buf)))
+		} else {
+			s.spill()
+		}
+	}
+	s.buf = append(s.buf, sortEntry{hash, loc})
+}
+
+// spill writes the buffer to a new run file and empties it.
+func (s *locationSorter) spill() {
+	defer func() { s.buf = s.buf[:0] }()
+	if s.err != nil {
+		return
+	}
+	f, err := os.CreateTemp(s.tempDir, "mkvdup-index-run-")
+	if err != nil {
+		s.err = fmt.Errorf("create index run file: %w", err)
+		return
+	}
+	s.runs = append(s.runs, f.Name())
+	_, err = s.writeBuffer(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		s.err = fmt.Errorf("write index run file: %w", err)
+	}
+}
+
+// writeBuffer sorts the buffer and writes it to w as records, returning the
+// number of distinct hashes.
+func (s *locationSorter) writeBuffer(w io.Writer) (int, error) {
+	slices.SortFunc(s.buf, compareSortEntries)
+	bw := bufio.NewWriterSize(w, 1<<20)
+	var rec [sortedRecordSize]byte
+	hashes := 0
+	for i, e := range s.buf {
+		if i == 0 || e.hash != s.buf[i-1].hash {
+			hashes++
+		}
+		if _, err := bw.Write(appendSortedRecord(rec[:0], e)); err != nil {
+			return 0, err
+		}
+	}
+	return hashes, bw.Flush()
+}
+
+// finish merges the collected locations into a mapped sorted index and
+// removes the run files.
+func (s *locationSorter) finish() (*sortedIndex, error) {
+	defer s.abort()
+	if s.err != nil {
+		return nil, s.err
+	}
+	f, err := os.CreateTemp(s.tempDir, "mkvdup-index-")
+	if err != nil {
+		return nil, fmt.Errorf("create index file: %w", err)
+	}
+	// The mapping outlives the name
+	defer os.Remove(f.Name())
+
+	var hashes int
+	if len(s.runs) == 0 {
+		hashes, err = s.writeBuffer(f)
+	} else {
+		if len(s.buf) > 0 {
+			s.spill()
+		}
+		s.buf = nil // Free the buffer for the merge
+		if s.err != nil {
+			f.Close()
+			return nil, s.err
+		}
+		hashes, err = mergeRuns(f, s.runs)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write index file: %w", err)
+	}
+	file, err := mmap.Open(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("map index file: %w", err)
+	}
+	return newSortedIndex(file, hashes), nil
+}
+
+// abort removes the run files and drops the buffer.
+func (s *locationSorter) abort() {
+	for _, run := range s.runs {
+		os.Remove(run)
+	}
+	s.runs = nil
+	s.buf = nil
+}
+
+// runCursor reads the records of a run file in order.
+type runCursor struct {
+	r    *bufio.Reader
+	f    *os.File
+	head sortEntry
+	rec  [sortedRecordSize]byte
+}
+
+// next reads the following record into head, returning io.EOF at the end.
+func (c *runCursor) next() error {
+	if _, err := io.ReadFull(c.r, c.rec[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("run file %s is truncated", c.f.Name())
+		}
+		return err
+	}
+	c.head = decodeSortedRecord(c.rec[:])
+	return nil
+}
+
+// runHeap orders run cursors by their next record.
+type runHeap []*runCursor
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return compareSortEntries(h[i].head, h[j].head) < 0 }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runCursor)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// mergeRuns merges sorted run files into w and returns the number of
+// distinct hashes.
+func mergeRuns(w io.Writer, runs []string) (int, error) {
+	var h runHeap
+	defer func() {
+		for _, c := range h {
+			c.f.Close()
+		}
+	}()
+	for _, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return 0, err
+		}
+		c := &runCursor{r: bufio.NewReaderSize(f, 256<<10), f: f}
+		if err := c.next(); err != nil {
+			f.Close()
+			if errors.Is(err, io.EOF) {
+				continue
+			}
+			return 0, err
+		}
+		h = append(h, c)
+	}
+	heap.Init(&h)
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	var rec [sortedRecordSize]byte
+	hashes := 0
+	var last uint64
+	for len(h) > 0 {
+		c := h[0]
+		if hashes == 0 || c.head.hash != last {
+			hashes++
+			last = c.head.hash
+		}
+		if _, err := bw.Write(appendSortedRecord(rec[:0], c.head)); err != nil {
+			return 0, err
+		}
+		if err := c.next(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			c.f.Close()
+			heap.Pop(&h)
+			continue
+		}
+		heap.Fix(&h, 0)
+	}
+	return hashes, bw.Flush()
+}
+
+// memoryLimit returns the effective limit on index memory, or 0 for none.
+func (idx *Indexer) memoryLimit() int64 {
+	switch {
+	case idx.maxMemory > 0:
+		return idx.maxMemory
+	case idx.maxMemory < 0:
+		return 0
+	}
+	return int64(physicalMemory() / autoIndexMemoryDivisor)
+}
+
+// newLocationSorter returns a sorter for the locations of an index of about
+// n locations if they would exceed the memory limit in HashToLocations, or
+// nil if they fit.
+func (idx *Indexer) newLocationSorter(n int64) *locationSorter {
+	limit := idx.memoryLimit()
+	if limit <= 0 || n*mapBytesPerLocation <= limit {
+		return nil
+	}
+	maxEntries := int(max(limit/sortEntrySize, int64(minSortEntries)))
+	idx.verbosef("  Estimated %d locations exceed the index memory limit of %d bytes; using a sorted index\n", n, limit)
+	return newLocationSorter(idx.tempDir, maxEntries, int(n))
+}
+
+// estimatedLocations estimates the locations indexed from totalSize bytes
+// of source: about one sync point per 2 KB on average.
+func estimatedLocations(totalSize int64) int64 {
+	return max(totalSize/2048, 10000)
+}
+
+// addLocation adds a location of hash to the index being built.
+func (idx *Indexer) addLocation(hash uint64, loc Location) {
+	if idx.worker {
+		idx.found = append(idx.found, sortEntry{hash, loc})
+		return
+	}
+	if idx.sorter != nil {
+		idx.sorter.add(hash, loc)
+		return
+	}
+	idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], loc)
+}
@@ -0,0 +1,203 @@
+package source
+
+import (
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// useSmallSortBuffer lets a memory limit of a few bytes hold only n
+// locations, so small test sources spill to many runs.
+func useSmallSortBuffer(t *testing.T, n int) {
+	t.Helper()
+	old := minSortEntries
+	minSortEntries = n
+	t.Cleanup(func() { minSortEntries = old })
+}
+
+func TestSortedIndex_MatchesHashTable(t *testing.T) {
+	useSmallSortBuffer(t, 4)
+
+	for _, tt := range []struct {
+		name  string
+		raw   bool
+		files map[string][]byte
+	}{
+		{"MKV", false, map[string][]byte{
+			"movie.mkv": buildTestMKV(testMKVTracks, testMKVBlocks(), 3),
+		}},
+		{"M2TS", false, map[string][]byte{
+			"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+			"BDMV/STREAM/00002.m2ts": buildBasicM2TSData(),
+		}},
+		{"raw M2TS", true, map[string][]byte{
+			"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			build := func(maxMemory int64, tempDir string) *Index {
+				t.Helper()
+				indexer, err := NewIndexerWithOptions(dir, MinWindowSize, tt.raw)
+				if err != nil {
+					t.Fatal(err)
+				}
+				indexer.SetMaxMemory(maxMemory)
+				indexer.SetTempDir(tempDir)
+				if err := indexer.Build(nil); err != nil {
+					t.Fatalf("Build: %v", err)
+				}
+				t.Cleanup(func() { indexer.Index().Close() })
+				return indexer.Index()
+			}
+
+			table := build(-1, "")
+			tempDir := t.TempDir()
+			sorted := build(1, tempDir)
+			if table.Sorted() || !sorted.Sorted() {
+				t.Fatalf("Sorted() = %v and %v, want false and true", table.Sorted(), sorted.Sorted())
+			}
+			if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+				t.Errorf("Build left %d files in the temporary directory", len(entries))
+			}
+
+			if table.HashCount() == 0 || sorted.HashCount() != table.HashCount() {
+				t.Errorf("HashCount = %d, want %d", sorted.HashCount(), table.HashCount())
+			}
+			if sorted.LocationCount() != table.LocationCount() {
+				t.Errorf("LocationCount = %d, want %d", sorted.LocationCount(), table.LocationCount())
+			}
+			table.SortLocationsByOffset()
+			sorted.SortLocationsByOffset()
+			for hash, locs := range table.HashToLocations {
+				if got := sorted.Lookup(hash); !reflect.DeepEqual(got, locs) {
+					t.Fatalf("Lookup(%016x) = %+v, want %+v", hash, got, locs)
+				}
+			}
+			for _, hash := range []uint64{0, 1, math.MaxUint64} {
+				if _, ok := table.HashToLocations[hash]; !ok && sorted.Lookup(hash) != nil {
+					t.Errorf("Lookup(%016x) of a missing hash = %+v", hash, sorted.Lookup(hash))
+				}
+			}
+
+			// Closing drops the hashes; the cleanup closes them again
+			for _, idx := range []*Index{table, sorted} {
+				idx.Close()
+				if idx.HashCount() != 0 || idx.Sorted() {
+					t.Errorf("closed index has %d hashes, sorted %v", idx.HashCount(), idx.Sorted())
+				}
+			}
+		})
+	}
+}
+
+func TestSortedIndex_Find(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	hashes := []uint64{0, 1, math.MaxUint64 - 1, math.MaxUint64}
+	for range 5000 {
+		hashes = append(hashes, rng.Uint64())
+	}
+	// Clustered values defeat interpolation
+	for i := range uint64(500) {
+		hashes = append(hashes, 1<<40+i*3)
+	}
+
+	sorter := newLocationSorter(t.TempDir(), 700, 0)
+	want := make(map[uint64][]Location)
+	for i, hash := range hashes {
+		for j := range 1 + i%3 {
+			loc := Location{FileIndex: uint16(j), Offset: int64(i)}
+			sorter.add(hash, loc)
+			want[hash] = append(want[hash], loc)
+		}
+	}
+	if len(sorter.runs) == 0 {
+		t.Fatal("sorter did not spill")
+	}
+	s, err := sorter.finish()
+	if err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	defer s.close()
+
+	if s.hashes != len(want) {
+		t.Errorf("%d hashes, want %d", s.hashes, len(want))
+	}
+	for hash, locs := range want {
+		slices.SortFunc(locs, compareLocations)
+		if got := s.lookup(hash); !reflect.DeepEqual(got, locs) {
+			t.Fatalf("lookup(%016x) = %+v, want %+v", hash, got, locs)
+		}
+	}
+	for i := range uint64(500) {
+		if hash := 1<<40 + i*3 + 1; s.lookup(hash) != nil {
+			t.Fatalf("lookup(%016x) of a missing hash found locations", hash)
+		}
+	}
+}
+
+func TestSortedIndex_Cache(t *testing.T) {
+	useSmallSortBuffer(t, 4)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.mkv"), buildTestMKV(testMKVTracks, testMKVBlocks(), 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewIndexCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A sorted index is cached like any other, and loads into either backend
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer.SetMaxMemory(1)
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	built := indexer.Index()
+	defer built.Close()
+	if err := indexer.SaveCache(cache); err != nil {
+		t.Fatalf("SaveCache: %v", err)
+	}
+
+	for _, maxMemory := range []int64{-1, 1} {
+		indexer, err := NewIndexer(dir, MinWindowSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexer.SetMaxMemory(maxMemory)
+		if loaded, err := indexer.LoadCache(cache); !loaded || err != nil {
+			t.Fatalf("LoadCache = %v, %v", loaded, err)
+		}
+		loaded := indexer.Index()
+		if loaded.Sorted() != (maxMemory > 0) {
+			t.Errorf("max memory %d: Sorted() = %v", maxMemory, loaded.Sorted())
+		}
+		loaded.SortLocationsByOffset()
+		if loaded.HashCount() != built.HashCount() || loaded.LocationCount() != built.LocationCount() {
+			t.Errorf("max memory %d: %d hashes, %d locations; want %d, %d", maxMemory,
+				loaded.HashCount(), loaded.LocationCount(), built.HashCount(), built.LocationCount())
+		}
+		built.forEachHash(func(hash uint64, locs []Location) {
+			if got := loaded.Lookup(hash); !reflect.DeepEqual(got, locs) {
+				t.Errorf("max memory %d: Lookup(%016x) = %+v, want %+v", maxMemory, hash, got, locs)
+			}
+		})
+		loaded.Close()
+	}
+}
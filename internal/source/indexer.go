@@ -1,12 +1,12 @@
 package source
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"path/filepath"
 	"strings"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/stuckj/mkvdup/internal/mmap"
 )
 
@@ -27,8 +27,19 @@ type Indexer struct {
 	sourceType     Type
 	windowSize     int
 	index          *Index
-	useRawIndexing bool      // Force raw file indexing even for DVDs
-	verboseWriter  io.Writer // Destination for diagnostic output (nil = disabled)
+	useRawIndexing bool            // Force raw file indexing even for DVDs
+	verboseWriter  io.Writer       // Destination for diagnostic output (nil = disabled)
+	playlist       *BlurayPlaylist // Restricts a Blu-ray build to one playlist's clips (nil = all)
+	title          *DVDTitle       // Restricts a DVD build to one title's cells (nil = whole disc)
+	inputs         []cacheInput    // Files the index was built from, as they were then (see SaveCache)
+	maxMemory      int64           // Limit on hash table memory (0 = automatic, negative = none)
+	tempDir        string          // Directory for sorted index files ("" = system default)
+	sorter         *locationSorter // Collects locations while building a sorted index (nil = HashToLocations)
+	streams        *StreamFilter   // Source streams indexed (nil = all)
+	workers        int             // Jobs indexed at once (0 = one per CPU)
+	slots          chan struct{}   // Held by jobs running on their own goroutine during Build (nil = serial)
+	worker         bool            // Set on the Indexer of a parallel job (see newWorker)
+	found          []sortEntry     // Locations found by a parallel job, in order
 }
 
 // NewIndexer creates a new Indexer for the given source directory.
@@ -72,6 +83,44 @@ func (idx *Indexer) SetVerboseWriter(w io.Writer) {
 	idx.verboseWriter = w
 }
 
+// SetPlaylist restricts the index to the clips played by a Blu-ray playlist,
+// in play-item order, instead of every M2TS file of the source. Pass nil to
+// index every clip.
+func (idx *Indexer) SetPlaylist(pl *BlurayPlaylist) {
+	idx.playlist = pl
+}
+
+// SetTitle restricts the index to the VOB sectors of the cells played by a
+// DVD title, instead of the whole disc with its menus and other title sets.
+// Pass nil to index the whole disc.
+func (idx *Indexer) SetTitle(t *DVDTitle) {
+	idx.title = t
+}
+
+// SetMaxMemory limits the memory the index's hash table may take, in
+// bytes. A source whose locations would not fit is indexed into a sorted
+// file instead, searched through a mapping; lookups return the same
+// locations either way. Zero sets the limit to a quarter of physical
+// memory, and a negative limit keeps every index in memory.
+func (idx *Indexer) SetMaxMemory(n int64) {
+	idx.maxMemory = n
+}
+
+// SetTempDir sets the directory for the files of sorted indexes. The
+// default is the system temporary directory.
+func (idx *Indexer) SetTempDir(dir string) {
+	idx.tempDir = dir
+}
+
+// SetWorkers sets how many files, VOB sets or Blu-ray ISO regions are
+// indexed at once. The index is the same for any number of workers. Zero
+// uses one per CPU and one indexes serially. Sources built into a sorted
+// index (see SetMaxMemory) are always indexed serially, since parallel
+// jobs hold their locations in memory until they are merged.
+func (idx *Indexer) SetWorkers(n int) {
+	idx.workers = n
+}
+
 // SourceDir returns the source directory path.
 func (idx *Indexer) SourceDir() string {
 	return idx.sourceDir
@@ -83,51 +132,81 @@ type ProgressFunc func(processed, total int64)
 
 // Build scans all media files and builds the hash index.
 // If progress is non-nil, it will be called periodically to report progress.
+// Each call builds a new index, so an Indexer whose settings changed may
+// build again; the caller closes the index of the previous build.
 func (idx *Indexer) Build(progress ProgressFunc) error {
-	files, err := EnumerateMediaFiles(idx.sourceDir, idx.sourceType)
+	return idx.BuildContext(context.Background(), progress)
+}
+
+// BuildContext is like Build, but stops once ctx is canceled, returning
+// its error. Files are parsed and checksummed whole, so a build notices
+// the cancellation between files or while hashing one. The temporary files
+// of a sorted index are removed, and the partial index is closed.
+func (idx *Indexer) BuildContext(ctx context.Context, progress ProgressFunc) error {
+	idx.index = NewIndex(idx.sourceDir, idx.sourceType, idx.windowSize)
+	files, err := idx.mediaFiles()
 	if err != nil {
-		return fmt.Errorf("enumerate media files: %w", err)
+		return err
 	}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no media files found in %s", idx.sourceDir)
+	// Calculate total size for progress reporting. The files are recorded
+	// as they are before indexing, so that a cached index of a file
+	// modified while it was read is not used.
+	idx.inputs, err = statInputs(idx.sourceDir, files)
+	if err != nil {
+		return err
 	}
-
-	// Calculate total size for progress reporting
 	var totalSize int64
-	for _, relPath := range files {
-		fullPath := filepath.Join(idx.sourceDir, relPath)
-		size, err := GetFileInfo(fullPath)
-		if err != nil {
-			return fmt.Errorf("get file info for %s: %w", relPath, err)
-		}
-		totalSize += size
+	for _, in := range idx.inputs {
+		totalSize += in.size
 	}
 
-	// Pre-allocate hash map to reduce reallocation
-	// Estimate: ~1 sync point per 2KB of data on average
-	estimatedSyncPoints := int(totalSize / 2048)
-	if estimatedSyncPoints < 10000 {
-		estimatedSyncPoints = 10000
+	// Pre-allocate hash map to reduce reallocation, or collect the
+	// locations for a sorted index if the map would exceed the memory limit.
+	estimatedSyncPoints := estimatedLocations(totalSize)
+	if idx.sorter = idx.newLocationSorter(estimatedSyncPoints); idx.sorter != nil {
+		defer func() {
+			idx.sorter.abort()
+			idx.sorter = nil
+		}()
+	} else {
+		idx.index.HashToLocations = make(map[uint64][]Location, estimatedSyncPoints)
 	}
-	idx.index.HashToLocations = make(map[uint64][]Location, estimatedSyncPoints)
 
-	// For DVDs (MPEG-PS) and Blu-rays (MPEG-TS), use ES-based indexing
-	// so the matcher works with continuous ES data.
-	// Raw indexing is available as fallback for DVDs.
+	// For DVDs (MPEG-PS), Blu-rays and .ts recordings (MPEG-TS), MP4/MOV and MKV files,
+	// use ES-based indexing so the matcher works with continuous ES data.
+	// Raw indexing is available as fallback for DVDs. DVD ISOs in a mixed
+	// multi-disc Blu-ray source are always ES-indexed, since all locations
+	// in one index must use the same kind of offset.
 	if idx.sourceType == TypeDVD && !idx.useRawIndexing {
 		idx.index.UsesESOffsets = true
-	} else if idx.sourceType == TypeBluray {
+	} else if idx.sourceType == TypeBluray || idx.sourceType == TypeMPEGTS || idx.sourceType == TypeMP4 || idx.sourceType == TypeMKV {
 		idx.index.UsesESOffsets = true
 	}
 
-	var processedSize int64
+	// Unpacked DVD title sets are indexed as one stream per VOB set.
+	// vobSetAt maps the first file of each set to all of its members;
+	// inVOBSet marks the remaining members so the loop skips them.
+	vobSetAt := make(map[int][]int)
+	inVOBSet := make(map[int]bool)
+	if idx.sourceType == TypeDVD && !idx.useRawIndexing {
+		for _, set := range VOBSets(files) {
+			vobSetAt[set[0]] = set
+			for _, i := range set[1:] {
+				inVOBSet[i] = true
+			}
+		}
+	}
 
-	// Process each file
-	// fileIndex tracks the next available index for source file entries.
-	// Most files produce one entry, but Blu-ray ISOs produce one per M2TS region.
-	fileIndex := 0
-	for _, relPath := range files {
+	// Each file, or VOB set, is indexed by a job of its own. Jobs may run
+	// in parallel, but are added to the index in this order, so that the
+	// index only depends on the files.
+	var jobs []indexJob
+	for i, relPath := range files {
+		if inVOBSet[i] {
+			// Already indexed together with the first part of its VOB set
+			continue
+		}
 		fullPath := filepath.Join(idx.sourceDir, relPath)
 
 		size, err := GetFileInfo(fullPath)
@@ -135,68 +214,168 @@ func (idx *Indexer) Build(progress ProgressFunc) error {
 			return fmt.Errorf("get file info for %s: %w", relPath, err)
 		}
 
-		var checksum uint64
-		if idx.sourceType == TypeDVD && !idx.useRawIndexing {
-			checksum, err = idx.indexMPEGPSFile(uint16(fileIndex), fullPath, size, func(fileProcessed int64) {
-				if progress != nil {
-					progress(processedSize+fileProcessed, totalSize)
-				}
-			})
-		} else if idx.sourceType == TypeBluray && isISOFile(relPath) {
-			// Blu-ray ISO: one ISO may contain multiple M2TS regions,
-			// each producing a separate source file entry.
-			var n int
-			n, _, err = idx.indexBlurayISOFile(uint16(fileIndex), fullPath, relPath, size, func(fileProcessed int64) {
-				if progress != nil {
-					progress(processedSize+fileProcessed, totalSize)
+		if set, ok := vobSetAt[i]; ok {
+			relPaths := make([]string, len(set))
+			fullPaths := make([]string, len(set))
+			sizes := make([]int64, len(set))
+			var setSize int64
+			for j, fi := range set {
+				relPaths[j] = files[fi]
+				fullPaths[j] = filepath.Join(idx.sourceDir, files[fi])
+				if sizes[j], err = GetFileInfo(fullPaths[j]); err != nil {
+					return fmt.Errorf("get file info for %s: %w", files[fi], err)
 				}
-			})
-			if err != nil {
-				return fmt.Errorf("index file %s: %w", relPath, err)
+				setSize += sizes[j]
 			}
-			// indexBlurayISOFile already added source file entries
-			fileIndex += n
-			processedSize += size
-			continue
-		} else if idx.sourceType == TypeBluray {
-			checksum, err = idx.indexM2TSFile(uint16(fileIndex), fullPath, size, func(fileProcessed int64) {
-				if progress != nil {
-					progress(processedSize+fileProcessed, totalSize)
-				}
-			})
-		} else {
-			checksum, err = idx.indexRawFile(uint16(fileIndex), fullPath, size, func(fileProcessed int64) {
-				if progress != nil {
-					progress(processedSize+fileProcessed, totalSize)
+			jobs = append(jobs, indexJob{size: setSize, run: func(ctx context.Context, w *Indexer, progress func(int64)) error {
+				// indexVOBSet adds the source file entries
+				if _, err := w.indexVOBSet(ctx, uint16(len(w.index.Files)), relPaths, fullPaths, sizes, progress); err != nil {
+					return fmt.Errorf("index VOB set %s: %w", relPath, err)
 				}
-			})
+				return nil
+			}})
+			continue
+		}
+
+		jobs = append(jobs, indexJob{size: size, run: func(ctx context.Context, w *Indexer, progress func(int64)) error {
+			return w.indexFile(ctx, relPath, fullPath, size, progress)
+		}})
+	}
+
+	if workers := idx.workerCount(); workers > 1 && idx.sorter == nil {
+		idx.slots = make(chan struct{}, workers-1)
+		defer func() { idx.slots = nil }()
+	}
+	var report func(int64)
+	if progress != nil {
+		report = func(processed int64) { progress(processed, totalSize) }
+	}
+	if err := idx.runJobs(ctx, jobs, report); err != nil {
+		if ctx.Err() != nil {
+			idx.index.Close()
 		}
+		return err
+	}
+
+	if idx.sorter != nil {
+		sorted, err := idx.sorter.finish()
 		if err != nil {
-			return fmt.Errorf("index file %s: %w", relPath, err)
+			return fmt.Errorf("sort index: %w", err)
 		}
+		idx.index.sorted = sorted
+	}
+	return nil
+}
 
-		idx.index.Files = append(idx.index.Files, File{
-			RelativePath: relPath,
-			Size:         size,
-			Checksum:     checksum,
-		})
+// indexFile indexes the source file at fullPath, adding its source file
+// entries: one, or one per M2TS region of a Blu-ray ISO.
+func (idx *Indexer) indexFile(ctx context.Context, relPath, fullPath string, size int64, progress func(int64)) error {
+	fileIndex := uint16(len(idx.index.Files))
 
-		fileIndex++
-		processedSize += size
+	// Each ISO is classified individually: a multi-disc Blu-ray source
+	// may also contain DVD ISOs, which are indexed as MPEG-PS.
+	fileType := idx.sourceType
+	if isISOFile(relPath) {
+		fileType = classifyISO(fullPath)
 	}
 
+	var checksum fileChecksums
+	var err error
+	if fileType == TypeDVD && idx.index.UsesESOffsets {
+		checksum, err = idx.indexMPEGPSFile(ctx, fileIndex, fullPath, size, idx.dvdISOChannels(fullPath), progress)
+	} else if fileType == TypeBluray && isISOFile(relPath) {
+		// Blu-ray ISO: one ISO may contain multiple M2TS regions,
+		// each producing a separate source file entry, which
+		// indexBlurayISOFile adds.
+		if _, _, err = idx.indexBlurayISOFile(ctx, fullPath, relPath, size, progress); err != nil {
+			return fmt.Errorf("index file %s: %w", relPath, err)
+		}
+		return nil
+	} else if fileType == TypeBluray || fileType == TypeMPEGTS {
+		checksum, err = idx.indexM2TSFile(ctx, fileIndex, fullPath, size, progress)
+	} else if fileType == TypeMP4 {
+		checksum, err = idx.indexMP4File(ctx, fileIndex, fullPath, size, progress)
+	} else if fileType == TypeMKV {
+		checksum, err = idx.indexMKVFile(ctx, fileIndex, fullPath, size, progress)
+	} else {
+		checksum, err = idx.indexRawFile(ctx, fileIndex, fullPath, size, progress)
+	}
+	if err != nil {
+		return fmt.Errorf("index file %s: %w", relPath, err)
+	}
+
+	idx.index.Files = append(idx.index.Files, File{
+		RelativePath:   relPath,
+		Size:           size,
+		Checksum:       checksum.sum,
+		ChunkChecksums: checksum.chunks,
+	})
 	return nil
 }
 
+// mediaFiles returns the media files the index is built from, relative to
+// the source directory: all of them, or those of the playlist or title the
+// index is restricted to.
+func (idx *Indexer) mediaFiles() ([]string, error) {
+	files, err := EnumerateMediaFiles(idx.sourceDir, idx.sourceType)
+	if err != nil {
+		return nil, fmt.Errorf("enumerate media files: %w", err)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no media files found in %s", idx.sourceDir)
+	}
+
+	if idx.playlist != nil {
+		if files, err = idx.playlistFiles(files); err != nil {
+			return nil, err
+		}
+	}
+	if idx.title != nil {
+		if idx.sourceType != TypeDVD || idx.useRawIndexing {
+			return nil, fmt.Errorf("title %s needs ES indexing of a DVD source", idx.title)
+		}
+		if files, err = idx.title.titleFiles(files); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// playlistFiles narrows the enumerated media files to those holding the
+// clips of idx.playlist: its ISO, or its extracted M2TS files in play-item
+// order.
+func (idx *Indexer) playlistFiles(files []string) ([]string, error) {
+	if idx.sourceType != TypeBluray {
+		return nil, fmt.Errorf("playlist %s given for a %s source", idx.playlist, idx.sourceType)
+	}
+	if idx.playlist.Disc == "" {
+		return idx.playlist.playlistM2TSFiles(files)
+	}
+	for _, f := range files {
+		if filepath.Clean(f) == filepath.Clean(idx.playlist.Disc) {
+			return []string{f}, nil
+		}
+	}
+	return nil, fmt.Errorf("disc %s of playlist %s not found in %s", idx.playlist.Disc, idx.playlist, idx.sourceDir)
+}
+
 // isISOFile returns true if the path has an .iso extension.
 func isISOFile(path string) bool {
 	return strings.HasSuffix(strings.ToLower(path), ".iso")
 }
 
-// checksumWithProgress computes xxhash checksum of data in chunks, calling
-// progress with the number of bytes processed so far after each chunk.
-func checksumWithProgress(data []byte, progress func(int64)) uint64 {
-	hasher := xxhash.New()
+// fileChecksums holds the whole-file and per-chunk checksums of a source
+// file (File.Checksum and File.ChunkChecksums).
+type fileChecksums struct {
+	sum    uint64
+	chunks []uint64
+}
+
+// checksumWithProgress computes the xxhash checksums of data in chunks,
+// calling progress with the number of bytes processed so far after each chunk.
+func checksumWithProgress(data []byte, progress func(int64)) fileChecksums {
+	hasher := NewChunkHasher(ChecksumChunkSize)
 	const chunkSize = 16 * 1024 * 1024 // 16MB chunks
 	for offset := 0; offset < len(data); offset += chunkSize {
 		end := offset + chunkSize
@@ -208,16 +387,18 @@ func checksumWithProgress(data []byte, progress func(int64)) uint64 {
 			progress(int64(end))
 		}
 	}
-	return hasher.Sum64()
+	return fileChecksums{sum: hasher.Sum64(), chunks: hasher.ChunkSums()}
 }
 
 // indexMPEGPSFile processes an MPEG-PS file (DVD ISO) using ES-aware indexing.
 // It extracts the elementary stream data and indexes sync points within it.
-func (idx *Indexer) indexMPEGPSFile(fileIndex uint16, path string, size int64, progress func(int64)) (uint64, error) {
+// channels holds the audio channel counts declared for its sub-streams, for
+// the stream filter.
+func (idx *Indexer) indexMPEGPSFile(ctx context.Context, fileIndex uint16, path string, size int64, channels map[byte]int, progress func(int64)) (fileChecksums, error) {
 	// Memory-map the file with zero-copy access
 	mmapFile, err := mmap.Open(path)
 	if err != nil {
-		return 0, fmt.Errorf("mmap open: %w", err)
+		return fileChecksums{}, fmt.Errorf("mmap open: %w", err)
 	}
 	// Note: Don't close mmapFile - it's stored in MmapFiles for later use
 
@@ -225,19 +406,23 @@ func (idx *Indexer) indexMPEGPSFile(fileIndex uint16, path string, size int64, p
 	idx.index.MmapFiles = append(idx.index.MmapFiles, mmapFile)
 
 	// Parse MPEG-PS structure with progress reporting using zero-copy data
-	parser := NewMPEGPSParser(mmapFile.Data())
+	parser, reader, err := idx.newDVDParser([][]byte{mmapFile.Data()})
+	if err != nil {
+		return fileChecksums{}, err
+	}
+	scale := parsedToFileScale(parser, size)
 
 	// Phase 1: Parse MPEG-PS structure (0% → 33%)
 	if err := parser.ParseWithProgress(func(processed, total int64) {
 		if progress != nil {
-			progress(processed / 3)
+			progress(scale(processed) / 3)
 		}
 	}); err != nil {
-		return 0, fmt.Errorf("parse MPEG-PS: %w", err)
+		return fileChecksums{}, fmt.Errorf("parse MPEG-PS: %w", err)
 	}
 
 	// Store parser for later use by matcher
-	idx.index.ESReaders = append(idx.index.ESReaders, parser)
+	idx.index.ESReaders = append(idx.index.ESReaders, reader)
 
 	// Phase 2: Checksum (33% → 66%)
 	checksum := checksumWithProgress(mmapFile.Data(), func(processed int64) {
@@ -247,43 +432,104 @@ func (idx *Indexer) indexMPEGPSFile(fileIndex uint16, path string, size int64, p
 	})
 
 	// Phase 3: Index ES data (66% → 100%)
-	videoESSize := parser.TotalESSize(true)
-	if videoESSize > 0 {
-		indexProgress := func(fileOffset int64) {
-			if progress != nil {
-				progress(2*size/3 + fileOffset/3)
-			}
+	if err := idx.indexMPEGPSStreams(ctx, fileIndex, parser, channels, func(fileOffset int64) {
+		if progress != nil {
+			progress(2*size/3 + scale(fileOffset)/3)
 		}
-		if err := idx.indexESData(fileIndex, parser, true, videoESSize, indexProgress); err != nil {
-			return 0, fmt.Errorf("index video ES: %w", err)
+	}); err != nil {
+		return fileChecksums{}, err
+	}
+
+	if progress != nil {
+		progress(size)
+	}
+
+	return checksum, nil
+}
+
+// newDVDParser returns an unparsed MPEG-PS parser over a DVD stream made of
+// parts (a whole ISO, or the parts of a VOB set), along with the ES reader
+// to store for it. When the index is restricted to a title, the parser only
+// sees the title's cells and the reader is a dvdTitleAdapter mapping its
+// offsets back to the stream.
+func (idx *Indexer) newDVDParser(parts [][]byte) (*MPEGPSParser, ESReader, error) {
+	if idx.title != nil {
+		adapter, err := newDVDTitleAdapter(parts, idx.title.extents)
+		if err != nil {
+			return nil, nil, fmt.Errorf("title %s: %w", idx.title, err)
+		}
+		if idx.verboseWriter != nil {
+			fmt.Fprintf(idx.verboseWriter, "  Title %s: %d cell ranges, %d of %d bytes\n",
+				idx.title, len(adapter.extentMap), adapter.DataSize(), totalLen(parts))
 		}
+		return adapter.MPEGPSParser, adapter, nil
 	}
+	if len(parts) == 1 {
+		parser := NewMPEGPSParser(parts[0])
+		return parser, parser, nil
+	}
+	parser := NewMPEGPSParserMultiRegion(newMultiRegionDataFromSlices(parts))
+	return parser, parser, nil
+}
 
-	// Index each audio sub-stream separately
+// totalLen returns the combined length of parts.
+func totalLen(parts [][]byte) int64 {
+	var n int64
+	for _, p := range parts {
+		n += int64(len(p))
+	}
+	return n
+}
+
+// parsedToFileScale returns a function scaling parser-relative offsets to
+// the size of the files being indexed, for progress reporting when the
+// parser only sees part of them.
+func parsedToFileScale(parser *MPEGPSParser, size int64) func(int64) int64 {
+	parsed := parser.DataSize()
+	if parsed == size || parsed == 0 {
+		return func(off int64) int64 { return off }
+	}
+	ratio := float64(size) / float64(parsed)
+	return func(off int64) int64 { return int64(float64(off) * ratio) }
+}
+
+// indexMPEGPSStreams indexes the video ES and every audio and subpicture
+// sub-stream of a parsed MPEG-PS stream under the given file index, except
+// those the stream filter leaves out, which are told apart by the channel
+// counts the IFOs declare for them (nil if unknown). progress receives the
+// parser-relative file offset of the video range being indexed.
+func (idx *Indexer) indexMPEGPSStreams(ctx context.Context, fileIndex uint16, parser *MPEGPSParser, channels map[byte]int, progress func(int64)) error {
+	videoESSize := parser.TotalESSize(true)
+	if videoESSize > 0 && !idx.skipStream(fileIndex, true, 0, CodecMPEG2Video, 0) {
+		if err := idx.indexESData(ctx, fileIndex, parser, true, videoESSize, FindVideoNALStarts, progress); err != nil {
+			return fmt.Errorf("index video ES: %w", err)
+		}
+	}
+
+	// Index each audio and subpicture sub-stream separately
 	audioSubStreams := parser.AudioSubStreams()
 	for _, subStreamID := range audioSubStreams {
 		subStreamSize := parser.AudioSubStreamESSize(subStreamID)
-		if subStreamSize > 0 {
+		if subStreamSize > 0 && !idx.skipStream(fileIndex, false, subStreamID, dvdSubStreamCodec(subStreamID), channels[subStreamID]) {
 			if parser.IsLPCMSubStream(subStreamID) {
 				// LPCM has no natural sync patterns; use fixed-interval sync points.
 				// The indexer forces the slow path (ReadAudioSubStreamData) for LPCM
 				// so the data goes through the byte-swap transform.
-				if err := idx.indexSubStream(fileIndex, parser, subStreamID, subStreamSize, FindLPCMIndexSyncPoints); err != nil {
-					return 0, fmt.Errorf("index LPCM sub-stream 0x%02X: %w", subStreamID, err)
+				if err := idx.indexSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize, FindLPCMIndexSyncPoints); err != nil {
+					return fmt.Errorf("index LPCM sub-stream 0x%02X: %w", subStreamID, err)
+				}
+			} else if IsVobSubSubStreamID(subStreamID) {
+				if err := idx.indexSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize, FindVobSubSyncPoints); err != nil {
+					return fmt.Errorf("index subpicture sub-stream 0x%02X: %w", subStreamID, err)
 				}
 			} else {
-				if err := idx.indexAudioSubStream(fileIndex, parser, subStreamID, subStreamSize); err != nil {
-					return 0, fmt.Errorf("index audio sub-stream 0x%02X: %w", subStreamID, err)
+				if err := idx.indexAudioSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize); err != nil {
+					return fmt.Errorf("index audio sub-stream 0x%02X: %w", subStreamID, err)
 				}
 			}
 		}
 	}
-
-	if progress != nil {
-		progress(size)
-	}
-
-	return checksum, nil
+	return nil
 }
 
 // Index returns the built index. Must call Build first.
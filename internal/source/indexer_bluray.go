@@ -1,19 +1,21 @@
 package source
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/stuckj/mkvdup/internal/mmap"
 	"golang.org/x/sys/unix"
 )
 
-// indexM2TSFile processes a Blu-ray M2TS file using ES-aware indexing.
-// It parses the MPEG-TS structure to extract elementary stream data and
-// indexes sync points within the continuous ES, matching what MKV files contain.
-func (idx *Indexer) indexM2TSFile(fileIndex uint16, path string, size int64, progress func(int64)) (uint64, error) {
+// indexM2TSFile processes a Blu-ray M2TS file or a plain .ts recording using
+// ES-aware indexing. It parses the MPEG-TS structure to extract elementary
+// stream data and indexes sync points within the continuous ES, matching what
+// MKV files contain.
+func (idx *Indexer) indexM2TSFile(ctx context.Context, fileIndex uint16, path string, size int64, progress func(int64)) (fileChecksums, error) {
 	mmapFile, err := mmap.Open(path)
 	if err != nil {
-		return 0, fmt.Errorf("mmap open: %w", err)
+		return fileChecksums{}, fmt.Errorf("mmap open: %w", err)
 	}
 	// Note: Don't close mmapFile - it's stored in MmapFiles for later use
 	idx.index.MmapFiles = append(idx.index.MmapFiles, mmapFile)
@@ -28,7 +30,7 @@ func (idx *Indexer) indexM2TSFile(fileIndex uint16, path string, size int64, pro
 			progress(processed / 3)
 		}
 	}); err != nil {
-		return 0, fmt.Errorf("parse MPEG-TS: %w", err)
+		return fileChecksums{}, fmt.Errorf("parse MPEG-TS: %w", err)
 	}
 
 	// Store parser for later use by matcher
@@ -43,14 +45,14 @@ func (idx *Indexer) indexM2TSFile(fileIndex uint16, path string, size int64, pro
 
 	// Phase 3: Index ES data (66% → 100%)
 	videoESSize := parser.TotalESSize(true)
-	if videoESSize > 0 {
+	if videoESSize > 0 && !idx.skipStream(fileIndex, true, 0, parser.VideoCodec(), 0) {
 		indexProgress := func(fileOffset int64) {
 			if progress != nil {
 				progress(2*size/3 + fileOffset/3)
 			}
 		}
-		if err := idx.indexESData(fileIndex, parser, true, videoESSize, indexProgress); err != nil {
-			return 0, fmt.Errorf("index video ES: %w", err)
+		if err := idx.indexESData(ctx, fileIndex, parser, true, videoESSize, videoSyncPointFinder(parser.VideoCodec()), indexProgress); err != nil {
+			return fileChecksums{}, fmt.Errorf("index video ES: %w", err)
 		}
 	}
 
@@ -65,9 +67,18 @@ func (idx *Indexer) indexM2TSFile(fileIndex uint16, path string, size int64, pro
 			continue // indexed below with subtitle-specific sync points
 		}
 		subStreamSize := parser.AudioSubStreamESSize(subStreamID)
-		if subStreamSize > 0 {
-			if err := idx.indexAudioSubStream(fileIndex, parser, subStreamID, subStreamSize); err != nil {
-				return 0, fmt.Errorf("index audio sub-stream %d: %w", subStreamID, err)
+		if subStreamSize > 0 && !idx.skipStream(fileIndex, false, subStreamID, parser.SubStreamCodec(subStreamID), 0) {
+			if parser.SubStreamCodec(subStreamID) == CodecAACaudio {
+				// Broadcast AAC is ADTS-framed; MKV stores the bare frames
+				if err := idx.indexSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize, FindADTSPayloadSyncPoints); err != nil {
+					return fileChecksums{}, fmt.Errorf("index AAC sub-stream %d: %w", subStreamID, err)
+				}
+			} else if parser.IsLPCMSubStream(subStreamID) {
+				if err := idx.indexLPCMSubStream(fileIndex, parser, subStreamID, subStreamSize); err != nil {
+					return fileChecksums{}, fmt.Errorf("index LPCM sub-stream %d: %w", subStreamID, err)
+				}
+			} else if err := idx.indexAudioSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize); err != nil {
+				return fileChecksums{}, fmt.Errorf("index audio sub-stream %d: %w", subStreamID, err)
 			}
 		}
 	}
@@ -75,9 +86,9 @@ func (idx *Indexer) indexM2TSFile(fileIndex uint16, path string, size int64, pro
 	// Index subtitle sub-streams with PGS sync point detection
 	for _, subStreamID := range subtitleIDs {
 		subStreamSize := parser.AudioSubStreamESSize(subStreamID)
-		if subStreamSize > 0 {
-			if err := idx.indexSubStream(fileIndex, parser, subStreamID, subStreamSize, FindPGSSyncPoints); err != nil {
-				return 0, fmt.Errorf("index subtitle sub-stream %d: %w", subStreamID, err)
+		if subStreamSize > 0 && !idx.skipStream(fileIndex, false, subStreamID, parser.SubStreamCodec(subStreamID), 0) {
+			if err := idx.indexSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize, FindPGSSyncPoints); err != nil {
+				return fileChecksums{}, fmt.Errorf("index subtitle sub-stream %d: %w", subStreamID, err)
 			}
 		}
 	}
@@ -90,9 +101,11 @@ func (idx *Indexer) indexM2TSFile(fileIndex uint16, path string, size int64, pro
 }
 
 // indexBlurayISOFile processes a Blu-ray ISO file by finding M2TS regions
-// within the ISO9660 filesystem and indexing each as a separate source file entry.
-// Returns the number of source file entries created and the ISO checksum.
-func (idx *Indexer) indexBlurayISOFile(startFileIndex uint16, path, relPath string, size int64, progress func(int64)) (int, uint64, error) {
+// within the ISO9660 filesystem and indexing each as a separate source file
+// entry, numbered from the next free file index. Regions are indexed in
+// parallel when Build has workers free. Returns the number of source file
+// entries created and the ISO checksum.
+func (idx *Indexer) indexBlurayISOFile(ctx context.Context, path, relPath string, size int64, progress func(int64)) (int, uint64, error) {
 	// Find M2TS file extents within the ISO
 	m2tsFiles, err := findBlurayM2TSInISO(path)
 	if err != nil {
@@ -101,6 +114,11 @@ func (idx *Indexer) indexBlurayISOFile(startFileIndex uint16, path, relPath stri
 	if len(m2tsFiles) == 0 {
 		return 0, 0, fmt.Errorf("no M2TS files found in Blu-ray ISO")
 	}
+	if idx.playlist != nil {
+		if m2tsFiles, err = idx.playlist.playlistM2TSExtents(m2tsFiles); err != nil {
+			return 0, 0, err
+		}
+	}
 
 	// Memory-map the entire ISO
 	mmapFile, err := mmap.Open(path)
@@ -113,15 +131,17 @@ func (idx *Indexer) indexBlurayISOFile(startFileIndex uint16, path, relPath stri
 	mmapFile.Advise(unix.MADV_SEQUENTIAL)
 	isoData := mmapFile.Data()
 
-	// Phase 1: Parse all M2TS regions (0% → 33%)
+	// Phase 1: Parse all M2TS regions (0% → 33%). The regions are parsed
+	// in parallel; those that fail to parse are skipped.
 	type parsedM2TS struct {
 		adapter *isoM2TSAdapter
 		extent  isoFileExtent
+		skip    string // Why the region is skipped ("" = parsed)
 	}
-	var parsed []parsedM2TS
-
-	for _, m2ts := range m2tsFiles {
-		var adapter *isoM2TSAdapter
+	regions := make([]parsedM2TS, len(m2tsFiles))
+	idx.parallelFor(len(m2tsFiles), func(i int) {
+		m2ts := m2tsFiles[i]
+		regions[i].extent = m2ts
 
 		if m2ts.Extents != nil {
 			// Multi-extent UDF file: create virtual contiguous view
@@ -130,35 +150,38 @@ func (idx *Indexer) indexBlurayISOFile(startFileIndex uint16, path, relPath stri
 
 			parser := NewMPEGTSParserMultiRegion(mr)
 			if err := parser.ParseWithProgress(nil); err != nil {
-				if idx.verboseWriter != nil {
-					fmt.Fprintf(idx.verboseWriter, "  [indexBlurayISO] skipping %s: %v\n", m2ts.Name, err)
-				}
-				continue
-			}
-			adapter = newISOAdapterMultiExtent(parser, mr, m2ts.Extents)
-		} else {
-			// Contiguous file: use sub-slice of mmap'd ISO
-			endOffset := m2ts.Offset + m2ts.Size
-			if endOffset > int64(len(isoData)) {
-				if idx.verboseWriter != nil {
-					fmt.Fprintf(idx.verboseWriter, "  [indexBlurayISO] skipping %s: extent beyond ISO bounds (%d + %d > %d)\n",
-						m2ts.Name, m2ts.Offset, m2ts.Size, len(isoData))
-				}
-				continue
+				regions[i].skip = err.Error()
+				return
 			}
+			regions[i].adapter = newISOAdapterMultiExtent(parser, mr, m2ts.Extents)
+			return
+		}
 
-			m2tsData := isoData[m2ts.Offset:endOffset]
-			parser := NewMPEGTSParser(m2tsData)
-			if err := parser.ParseWithProgress(nil); err != nil {
-				if idx.verboseWriter != nil {
-					fmt.Fprintf(idx.verboseWriter, "  [indexBlurayISO] skipping %s: %v\n", m2ts.Name, err)
-				}
-				continue
-			}
-			adapter = newISOAdapter(parser, isoData, m2ts.Offset)
+		// Contiguous file: use sub-slice of mmap'd ISO
+		endOffset := m2ts.Offset + m2ts.Size
+		if endOffset > int64(len(isoData)) {
+			regions[i].skip = fmt.Sprintf("extent beyond ISO bounds (%d + %d > %d)", m2ts.Offset, m2ts.Size, len(isoData))
+			return
+		}
+
+		m2tsData := isoData[m2ts.Offset:endOffset]
+		parser := NewMPEGTSParser(m2tsData)
+		if err := parser.ParseWithProgress(nil); err != nil {
+			regions[i].skip = err.Error()
+			return
 		}
+		regions[i].adapter = newISOAdapter(parser, isoData, m2ts.Offset)
+	})
 
-		parsed = append(parsed, parsedM2TS{adapter: adapter, extent: m2ts})
+	var parsed []parsedM2TS
+	for _, r := range regions {
+		if r.skip != "" {
+			if idx.verboseWriter != nil {
+				fmt.Fprintf(idx.verboseWriter, "  [indexBlurayISO] skipping %s: %s\n", r.extent.Name, r.skip)
+			}
+			continue
+		}
+		parsed = append(parsed, r)
 	}
 
 	if len(parsed) == 0 {
@@ -176,64 +199,79 @@ func (idx *Indexer) indexBlurayISOFile(startFileIndex uint16, path, relPath stri
 		}
 	})
 
-	// Phase 3: Index ES data from all M2TS regions (66% → 100%)
-	entriesCreated := 0
-	for _, p := range parsed {
-		fileIndex := startFileIndex + uint16(entriesCreated)
-		adapter := p.adapter
+	// Phase 3: Index ES data from all M2TS regions (66% → 100%), one job
+	// per region
+	jobs := make([]indexJob, len(parsed))
+	for i, p := range parsed {
+		jobs[i] = indexJob{run: func(ctx context.Context, w *Indexer, _ func(int64)) error {
+			return w.indexISORegion(ctx, p.adapter, p.extent.Name, relPath, size, checksum)
+		}}
+	}
+	if err := idx.runJobs(ctx, jobs, nil); err != nil {
+		return 0, 0, err
+	}
+
+	if progress != nil {
+		progress(size)
+	}
+
+	return len(parsed), checksum.sum, nil
+}
 
-		// Store adapter as ESReader for this source file entry
-		idx.index.ESReaders = append(idx.index.ESReaders, adapter)
+// indexISORegion indexes the streams of a parsed M2TS region of a Blu-ray
+// ISO and adds its source file entry. All entries of an ISO share its path,
+// size and checksum.
+func (idx *Indexer) indexISORegion(ctx context.Context, adapter *isoM2TSAdapter, name, relPath string, size int64, checksum fileChecksums) error {
+	fileIndex := uint16(len(idx.index.Files))
 
-		// Index video ES
-		videoESSize := adapter.TotalESSize(true)
-		if videoESSize > 0 {
-			if err := idx.indexESData(fileIndex, adapter, true, videoESSize, nil); err != nil {
-				return 0, 0, fmt.Errorf("index video ES for %s: %w", p.extent.Name, err)
-			}
+	// Store adapter as ESReader for this source file entry
+	idx.index.ESReaders = append(idx.index.ESReaders, adapter)
+
+	// Index video ES
+	videoESSize := adapter.TotalESSize(true)
+	if videoESSize > 0 && !idx.skipStream(fileIndex, true, 0, adapter.parser.VideoCodec(), 0) {
+		if err := idx.indexESData(ctx, fileIndex, adapter, true, videoESSize, videoSyncPointFinder(adapter.parser.VideoCodec()), nil); err != nil {
+			return fmt.Errorf("index video ES for %s: %w", name, err)
 		}
+	}
 
-		// Index audio sub-streams
-		subtitleIDs := adapter.parser.SubtitleSubStreams()
-		subtitleSet := make(map[byte]bool, len(subtitleIDs))
-		for _, id := range subtitleIDs {
-			subtitleSet[id] = true
+	// Index audio sub-streams
+	subtitleIDs := adapter.parser.SubtitleSubStreams()
+	subtitleSet := make(map[byte]bool, len(subtitleIDs))
+	for _, id := range subtitleIDs {
+		subtitleSet[id] = true
+	}
+	for _, subStreamID := range adapter.AudioSubStreams() {
+		if subtitleSet[subStreamID] {
+			continue
 		}
-		for _, subStreamID := range adapter.AudioSubStreams() {
-			if subtitleSet[subStreamID] {
-				continue
-			}
-			subStreamSize := adapter.AudioSubStreamESSize(subStreamID)
-			if subStreamSize > 0 {
-				if err := idx.indexAudioSubStream(fileIndex, adapter, subStreamID, subStreamSize); err != nil {
-					return 0, 0, fmt.Errorf("index audio sub-stream %d for %s: %w", subStreamID, p.extent.Name, err)
+		subStreamSize := adapter.AudioSubStreamESSize(subStreamID)
+		if subStreamSize > 0 && !idx.skipStream(fileIndex, false, subStreamID, adapter.parser.SubStreamCodec(subStreamID), 0) {
+			if adapter.IsLPCMSubStream(subStreamID) {
+				if err := idx.indexLPCMSubStream(fileIndex, adapter, subStreamID, subStreamSize); err != nil {
+					return fmt.Errorf("index LPCM sub-stream %d for %s: %w", subStreamID, name, err)
 				}
+			} else if err := idx.indexAudioSubStream(ctx, fileIndex, adapter, subStreamID, subStreamSize); err != nil {
+				return fmt.Errorf("index audio sub-stream %d for %s: %w", subStreamID, name, err)
 			}
 		}
+	}
 
-		// Index subtitle sub-streams
-		for _, subStreamID := range subtitleIDs {
-			subStreamSize := adapter.AudioSubStreamESSize(subStreamID)
-			if subStreamSize > 0 {
-				if err := idx.indexSubStream(fileIndex, adapter, subStreamID, subStreamSize, FindPGSSyncPoints); err != nil {
-					return 0, 0, fmt.Errorf("index subtitle sub-stream %d for %s: %w", subStreamID, p.extent.Name, err)
-				}
+	// Index subtitle sub-streams
+	for _, subStreamID := range subtitleIDs {
+		subStreamSize := adapter.AudioSubStreamESSize(subStreamID)
+		if subStreamSize > 0 && !idx.skipStream(fileIndex, false, subStreamID, adapter.parser.SubStreamCodec(subStreamID), 0) {
+			if err := idx.indexSubStream(ctx, fileIndex, adapter, subStreamID, subStreamSize, FindPGSSyncPoints); err != nil {
+				return fmt.Errorf("index subtitle sub-stream %d for %s: %w", subStreamID, name, err)
 			}
 		}
-
-		// Add source file entry — all entries share the same ISO path, size, checksum
-		idx.index.Files = append(idx.index.Files, File{
-			RelativePath: relPath,
-			Size:         size,
-			Checksum:     checksum,
-		})
-
-		entriesCreated++
 	}
 
-	if progress != nil {
-		progress(size)
-	}
-
-	return entriesCreated, checksum, nil
+	idx.index.Files = append(idx.index.Files, File{
+		RelativePath:   relPath,
+		Size:           size,
+		Checksum:       checksum.sum,
+		ChunkChecksums: checksum.chunks,
+	})
+	return nil
 }
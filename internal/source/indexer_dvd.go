@@ -0,0 +1,95 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mmap"
+)
+
+// indexVOBSet processes the VOB set of one DVD title set (VTS_xx_1..N.VOB from
+// an unpacked VIDEO_TS directory) as a single continuous MPEG-PS stream.
+//
+// Every part gets its own source file entry (so sizes and checksums are
+// tracked per file on disk), but all index locations use the file index of
+// the first part, with ES offsets relative to the concatenated stream. The
+// remaining parts get nil ESReaders. Readers reassemble the stream using
+// VOBSets on the source file list.
+//
+// Returns the number of source file entries added (one per part).
+func (idx *Indexer) indexVOBSet(ctx context.Context, fileIndex uint16, relPaths, fullPaths []string, sizes []int64, progress func(int64)) (int, error) {
+	var totalSize int64
+	for _, s := range sizes {
+		totalSize += s
+	}
+
+	parts := make([][]byte, len(fullPaths))
+	for i, path := range fullPaths {
+		mmapFile, err := mmap.Open(path)
+		if err != nil {
+			return 0, fmt.Errorf("mmap open %s: %w", relPaths[i], err)
+		}
+		// Note: Don't close mmapFile - it's stored in MmapFiles for later use
+		idx.index.MmapFiles = append(idx.index.MmapFiles, mmapFile)
+		parts[i] = mmapFile.Data()
+	}
+
+	parser, reader, err := idx.newDVDParser(parts)
+	if err != nil {
+		return 0, err
+	}
+	scale := parsedToFileScale(parser, totalSize)
+
+	// Phase 1: Parse MPEG-PS structure across the whole set (0% → 33%)
+	if err := parser.ParseWithProgress(func(processed, total int64) {
+		if progress != nil {
+			progress(scale(processed) / 3)
+		}
+	}); err != nil {
+		return 0, fmt.Errorf("parse MPEG-PS: %w", err)
+	}
+
+	// The first part owns the parser; the other parts are only reachable
+	// through it, so they get no reader of their own.
+	idx.index.ESReaders = append(idx.index.ESReaders, reader)
+	for range parts[1:] {
+		idx.index.ESReaders = append(idx.index.ESReaders, nil)
+	}
+
+	// Phase 2: Checksum each part (33% → 66%)
+	checksums := make([]fileChecksums, len(parts))
+	var checksummed int64
+	for i, data := range parts {
+		base := checksummed
+		checksums[i] = checksumWithProgress(data, func(processed int64) {
+			if progress != nil {
+				progress(totalSize/3 + (base+processed)/3)
+			}
+		})
+		checksummed += int64(len(data))
+	}
+
+	// Phase 3: Index ES data (66% → 100%)
+	if err := idx.indexMPEGPSStreams(ctx, fileIndex, parser, idx.dvdVOBSetChannels(fullPaths[0]), func(fileOffset int64) {
+		if progress != nil {
+			progress(2*totalSize/3 + scale(fileOffset)/3)
+		}
+	}); err != nil {
+		return 0, err
+	}
+
+	for i, relPath := range relPaths {
+		idx.index.Files = append(idx.index.Files, File{
+			RelativePath:   relPath,
+			Size:           sizes[i],
+			Checksum:       checksums[i].sum,
+			ChunkChecksums: checksums[i].chunks,
+		})
+	}
+
+	if progress != nil {
+		progress(totalSize)
+	}
+
+	return len(parts), nil
+}
@@ -1,6 +1,7 @@
 package source
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cespare/xxhash/v2"
@@ -19,9 +20,10 @@ type esDataProvider interface {
 	IsLPCMSubStream(subStreamID byte) bool
 }
 
-// indexESData indexes the elementary stream data from an ES-aware parser.
+// indexESData indexes the elementary stream data from an ES-aware parser,
+// hashing at the sync points returned by findSyncPoints for each range.
 // Uses zero-copy iteration through PES payload ranges.
-func (idx *Indexer) indexESData(fileIndex uint16, parser esDataProvider, isVideo bool, esSize int64, progress func(int64)) error {
+func (idx *Indexer) indexESData(ctx context.Context, fileIndex uint16, parser esDataProvider, isVideo bool, esSize int64, findSyncPoints syncPointFinder, progress func(int64)) error {
 	ranges := parser.FilteredVideoRanges()
 	if len(ranges) == 0 {
 		return nil
@@ -39,9 +41,9 @@ func (idx *Indexer) indexESData(fileIndex uint16, parser esDataProvider, isVideo
 		}
 		rangeData := parser.DataSlice(r.FileOffset, r.Size)
 
-		// Find NAL unit start positions (byte after 00 00 01)
+		// Find sync points: NAL unit start positions (byte after 00 00 01).
 		// Hashing from NAL header enables matching both Annex B and AVCC formats
-		syncPoints := FindVideoNALStarts(rangeData)
+		syncPoints := findSyncPoints(rangeData)
 
 		// Add each sync point to the index
 		for _, offsetInRange := range syncPoints {
@@ -57,7 +59,7 @@ func (idx *Indexer) indexESData(fileIndex uint16, parser esDataProvider, isVideo
 				window := rangeData[offsetInRange : offsetInRange+idx.windowSize]
 				hash := xxhash.Sum64(window)
 
-				idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], Location{
+				idx.addLocation(hash, Location{
 					FileIndex: fileIndex,
 					Offset:    syncESOffset,
 					IsVideo:   isVideo,
@@ -73,7 +75,7 @@ func (idx *Indexer) indexESData(fileIndex uint16, parser esDataProvider, isVideo
 				}
 				hash := xxhash.Sum64(window)
 
-				idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], Location{
+				idx.addLocation(hash, Location{
 					FileIndex: fileIndex,
 					Offset:    syncESOffset,
 					IsVideo:   isVideo,
@@ -85,8 +87,13 @@ func (idx *Indexer) indexESData(fileIndex uint16, parser esDataProvider, isVideo
 		}
 
 		// Report progress periodically
-		if rangeIdx%10000 == 0 && progress != nil {
-			progress(r.FileOffset)
+		if rangeIdx%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(r.FileOffset)
+			}
 		}
 	}
 
@@ -101,16 +108,25 @@ func (idx *Indexer) indexESData(fileIndex uint16, parser esDataProvider, isVideo
 // syncPointFinder is a function that returns sync point offsets within data.
 type syncPointFinder func(data []byte) []int
 
+// videoSyncPointFinder returns the sync point finder for a start-code video
+// ES of the given codec.
+func videoSyncPointFinder(codec CodecType) syncPointFinder {
+	if codec == CodecVC1Video {
+		return FindVC1IndexSyncPoints
+	}
+	return FindVideoNALStarts
+}
+
 // indexAudioSubStream indexes a specific audio sub-stream.
-func (idx *Indexer) indexAudioSubStream(fileIndex uint16, parser esDataProvider, subStreamID byte, esSize int64) error {
-	return idx.indexSubStream(fileIndex, parser, subStreamID, esSize, FindAudioSyncPoints)
+func (idx *Indexer) indexAudioSubStream(ctx context.Context, fileIndex uint16, parser esDataProvider, subStreamID byte, esSize int64) error {
+	return idx.indexSubStream(ctx, fileIndex, parser, subStreamID, esSize, FindAudioSyncPoints)
 }
 
 // indexSubStream indexes a specific sub-stream using the provided sync point finder.
 // Uses zero-copy iteration through PES payload ranges.
 // For LPCM sub-streams, always uses the slow path (ReadAudioSubStreamData) because
 // the raw data is big-endian but the read method returns byte-swapped little-endian data.
-func (idx *Indexer) indexSubStream(fileIndex uint16, parser esDataProvider, subStreamID byte, esSize int64, findSyncPoints syncPointFinder) error {
+func (idx *Indexer) indexSubStream(ctx context.Context, fileIndex uint16, parser esDataProvider, subStreamID byte, esSize int64, findSyncPoints syncPointFinder) error {
 	ranges := parser.FilteredAudioRanges(subStreamID)
 	if len(ranges) == 0 {
 		return nil
@@ -120,7 +136,12 @@ func (idx *Indexer) indexSubStream(fileIndex uint16, parser esDataProvider, subS
 	isLPCM := parser.IsLPCMSubStream(subStreamID)
 
 	// Iterate through each PES payload range (zero-copy when within one region)
-	for _, r := range ranges {
+	for rangeIdx, r := range ranges {
+		if rangeIdx%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 		endOffset := r.FileOffset + int64(r.Size)
 		if endOffset > dataSize {
 			continue
@@ -146,7 +167,7 @@ func (idx *Indexer) indexSubStream(fileIndex uint16, parser esDataProvider, subS
 				window := rangeData[offsetInRange : offsetInRange+idx.windowSize]
 				hash := xxhash.Sum64(window)
 
-				idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], Location{
+				idx.addLocation(hash, Location{
 					FileIndex:        fileIndex,
 					Offset:           syncESOffset,
 					IsVideo:          false,
@@ -160,7 +181,7 @@ func (idx *Indexer) indexSubStream(fileIndex uint16, parser esDataProvider, subS
 				}
 				hash := xxhash.Sum64(window)
 
-				idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], Location{
+				idx.addLocation(hash, Location{
 					FileIndex:        fileIndex,
 					Offset:           syncESOffset,
 					IsVideo:          false,
@@ -172,3 +193,38 @@ func (idx *Indexer) indexSubStream(fileIndex uint16, parser esDataProvider, subS
 
 	return nil
 }
+
+// lpcmIndexPhases are the offsets past each lpcmIndexSyncInterval boundary of
+// the ES at which indexLPCMSubStream hashes. The matcher probes MKV PCM
+// packets every lpcmMatchSyncInterval bytes from the packet start, and packet
+// starts are sample aligned and so always even: one of these phases lines up
+// with the probes of every packet.
+var lpcmIndexPhases = [...]int64{0, 2, 4, 6}
+
+// indexLPCMSubStream indexes a byte-swapped LPCM sub-stream at fixed ES
+// offsets rather than per PES payload range. Blu-ray LPCM is carried in
+// ~180-byte TS payloads, which would make per-range sync points far denser
+// than needed. Windows are read through ReadAudioSubStreamData so that they
+// are hashed after the byte-swap transform.
+func (idx *Indexer) indexLPCMSubStream(fileIndex uint16, parser esDataProvider, subStreamID byte, esSize int64) error {
+	for base := int64(0); base < esSize; base += lpcmIndexSyncInterval {
+		for _, phase := range lpcmIndexPhases {
+			off := base + phase
+			if off+int64(idx.windowSize) > esSize {
+				break
+			}
+			window, err := parser.ReadAudioSubStreamData(subStreamID, off, idx.windowSize)
+			if err != nil || len(window) < idx.windowSize {
+				continue
+			}
+			hash := xxhash.Sum64(window)
+			idx.addLocation(hash, Location{
+				FileIndex:        fileIndex,
+				Offset:           off,
+				IsVideo:          false,
+				AudioSubStreamID: subStreamID,
+			})
+		}
+	}
+	return nil
+}
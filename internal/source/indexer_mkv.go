@@ -0,0 +1,107 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+	"github.com/stuckj/mkvdup/internal/mmap"
+	"golang.org/x/sys/unix"
+)
+
+// mkvMatchScanLimit is how far into a non-video packet the matcher looks for
+// sync points. Sync points past it are never looked up, so they are not indexed.
+const mkvMatchScanLimit = 4096
+
+// indexMKVFile processes an existing MKV file using its packets as the ES.
+// Because the packets of the MKV being deduplicated are byte-identical, each
+// packet is indexed at exactly the sync points the matcher will hash for a
+// packet of the same track type.
+func (idx *Indexer) indexMKVFile(ctx context.Context, fileIndex uint16, path string, size int64, progress func(int64)) (fileChecksums, error) {
+	mmapFile, err := mmap.Open(path)
+	if err != nil {
+		return fileChecksums{}, fmt.Errorf("mmap open: %w", err)
+	}
+	// Note: Don't close mmapFile - it's stored in MmapFiles for later use
+	idx.index.MmapFiles = append(idx.index.MmapFiles, mmapFile)
+
+	mmapFile.Advise(unix.MADV_SEQUENTIAL)
+
+	// Phase 1: Parse clusters (0% → 25%)
+	parser := NewMKVSourceParser(mmapFile.Data())
+	if err := parser.Parse(func(processed, total int64) {
+		if progress != nil {
+			progress(processed / 4)
+		}
+	}); err != nil {
+		return fileChecksums{}, err
+	}
+
+	// Store parser for later use by matcher
+	idx.index.ESReaders = append(idx.index.ESReaders, parser)
+
+	// Phase 2: Checksum (25% → 50%)
+	checksum := checksumWithProgress(mmapFile.Data(), func(processed int64) {
+		if progress != nil {
+			progress(size/4 + processed/4)
+		}
+	})
+
+	// Phase 3: Index packets (50% → 100%)
+	videoESSize := parser.TotalESSize(true)
+	if videoESSize > 0 && !idx.skipStream(fileIndex, true, 0, parser.VideoCodec(), 0) {
+		findNALs := FindVideoNALStarts
+		if n := parser.NALLengthSize(); n > 0 {
+			findNALs = func(data []byte) []int {
+				return FindAVCCNALStarts(data, n)
+			}
+		} else if parser.VideoCodec() == CodecVC1Video {
+			findNALs = FindVC1MatchSyncPoints
+		}
+		indexProgress := func(esOffset int64) {
+			if progress != nil {
+				progress(size/2 + int64(float64(esOffset)/float64(videoESSize)*float64(size/2)))
+			}
+		}
+		if err := idx.indexSamples(ctx, fileIndex, &parser.sampleES, true, 0, parser.videoSampleSizes, findNALs, indexProgress); err != nil {
+			return fileChecksums{}, fmt.Errorf("index video ES: %w", err)
+		}
+	}
+
+	for _, subStreamID := range parser.AudioSubStreams() {
+		if idx.skipStream(fileIndex, false, subStreamID, parser.SubStreamCodec(subStreamID), 0) {
+			continue
+		}
+		var findSyncPoints syncPointFinder
+		switch {
+		case parser.pcmSubStreams[subStreamID]:
+			// The matcher probes PCM densely, so the packet start suffices.
+		case parser.SubStreamCodec(subStreamID) == CodecVobSub:
+			findSyncPoints = FindVobSubSyncPoints
+		case parser.SubStreamTrackType(subStreamID) == mkv.TrackTypeSubtitle:
+			findSyncPoints = scanLimited(FindPGSSyncPoints)
+		default:
+			findSyncPoints = scanLimited(FindAudioSyncPoints)
+		}
+		if err := idx.indexSamples(ctx, fileIndex, &parser.sampleES, false, subStreamID, parser.audioSampleSizes[subStreamID], findSyncPoints, nil); err != nil {
+			return fileChecksums{}, fmt.Errorf("index sub-stream %d: %w", subStreamID, err)
+		}
+	}
+
+	if progress != nil {
+		progress(size)
+	}
+
+	return checksum, nil
+}
+
+// scanLimited restricts a sync point finder to the first mkvMatchScanLimit
+// bytes of a packet.
+func scanLimited(find syncPointFinder) syncPointFinder {
+	return func(data []byte) []int {
+		if len(data) > mkvMatchScanLimit {
+			data = data[:mkvMatchScanLimit]
+		}
+		return find(data)
+	}
+}
@@ -0,0 +1,90 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mmap"
+	"golang.org/x/sys/unix"
+)
+
+// indexMP4File processes an MP4/MOV file using ES-aware indexing. The sample
+// tables give the exact position of every frame, so sync points are taken
+// from sample boundaries rather than searched for: each audio sample start
+// (an MKV block start after a remux), and each NAL unit of every video sample.
+func (idx *Indexer) indexMP4File(ctx context.Context, fileIndex uint16, path string, size int64, progress func(int64)) (fileChecksums, error) {
+	mmapFile, err := mmap.Open(path)
+	if err != nil {
+		return fileChecksums{}, fmt.Errorf("mmap open: %w", err)
+	}
+	// Note: Don't close mmapFile - it's stored in MmapFiles for later use
+	idx.index.MmapFiles = append(idx.index.MmapFiles, mmapFile)
+
+	mmapFile.Advise(unix.MADV_SEQUENTIAL)
+
+	// The moov box is small compared to mdat, so parsing needs no progress phase.
+	parser := NewMP4Parser(mmapFile.Data())
+	if err := parser.Parse(); err != nil {
+		return fileChecksums{}, fmt.Errorf("parse MP4: %w", err)
+	}
+
+	// Store parser for later use by matcher
+	idx.index.ESReaders = append(idx.index.ESReaders, parser)
+
+	// Phase 1: Checksum (0% → 50%)
+	checksum := checksumWithProgress(mmapFile.Data(), func(processed int64) {
+		if progress != nil {
+			progress(processed / 2)
+		}
+	})
+
+	// Phase 2: Index samples (50% → 100%)
+	videoESSize := parser.TotalESSize(true)
+	if videoESSize > 0 && !idx.skipStream(fileIndex, true, 0, parser.VideoCodec(), 0) {
+		indexProgress := func(esOffset int64) {
+			if progress != nil {
+				progress(size/2 + int64(float64(esOffset)/float64(videoESSize)*float64(size/2)))
+			}
+		}
+		if len(parser.videoSampleSizes) == 0 {
+			// No per-sample sizes; fall back to start code scanning
+			if err := idx.indexESData(ctx, fileIndex, parser, true, videoESSize, FindVideoNALStarts, indexProgress); err != nil {
+				return fileChecksums{}, fmt.Errorf("index video ES: %w", err)
+			}
+		} else {
+			findNALs := FindVideoNALStarts
+			if n := parser.NALLengthSize(); n > 0 {
+				findNALs = func(data []byte) []int {
+					return FindAVCCNALStarts(data, n)
+				}
+			}
+			if err := idx.indexSamples(ctx, fileIndex, &parser.sampleES, true, 0, parser.videoSampleSizes, findNALs, indexProgress); err != nil {
+				return fileChecksums{}, fmt.Errorf("index video ES: %w", err)
+			}
+		}
+	}
+
+	for _, subStreamID := range parser.AudioSubStreams() {
+		subStreamSize := parser.AudioSubStreamESSize(subStreamID)
+		if subStreamSize == 0 || idx.skipStream(fileIndex, false, subStreamID, parser.SubStreamCodec(subStreamID), 0) {
+			continue
+		}
+		sizes := parser.audioSampleSizes[subStreamID]
+		if len(sizes) == 0 {
+			// Constant-size samples (PCM): sample boundaries are meaningless
+			if err := idx.indexAudioSubStream(ctx, fileIndex, parser, subStreamID, subStreamSize); err != nil {
+				return fileChecksums{}, fmt.Errorf("index audio sub-stream %d: %w", subStreamID, err)
+			}
+			continue
+		}
+		if err := idx.indexSamples(ctx, fileIndex, &parser.sampleES, false, subStreamID, sizes, nil, nil); err != nil {
+			return fileChecksums{}, fmt.Errorf("index audio sub-stream %d: %w", subStreamID, err)
+		}
+	}
+
+	if progress != nil {
+		progress(size)
+	}
+
+	return checksum, nil
+}
@@ -0,0 +1,192 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sync"
+)
+
+// indexJob indexes one unit of a source: a file, a VOB set, or an M2TS
+// region of a Blu-ray ISO. run adds the unit's source file entries to
+// w.index, numbering them from len(w.index.Files), and reports the bytes
+// of the unit processed so far to progress, which may be nil. It stops
+// once ctx is canceled.
+type indexJob struct {
+	size int64
+	run  func(ctx context.Context, w *Indexer, progress func(int64)) error
+}
+
+// workerCount returns the number of jobs indexed at once.
+func (idx *Indexer) workerCount() int {
+	if idx.workers > 0 {
+		return idx.workers
+	}
+	return runtime.NumCPU()
+}
+
+// newWorker returns an Indexer for running a job in parallel with others.
+// It indexes into an index of its own, under file indices starting at 0,
+// and collects its locations and verbose output for merge to add to idx
+// once the jobs before it have been added.
+func (idx *Indexer) newWorker() *Indexer {
+	w := &Indexer{
+		sourceDir:      idx.sourceDir,
+		sourceType:     idx.sourceType,
+		windowSize:     idx.windowSize,
+		index:          NewIndex(idx.sourceDir, idx.sourceType, idx.windowSize),
+		useRawIndexing: idx.useRawIndexing,
+		playlist:       idx.playlist,
+		title:          idx.title,
+		streams:        idx.streams,
+		slots:          idx.slots,
+		worker:         true,
+	}
+	w.index.UsesESOffsets = idx.index.UsesESOffsets
+	if idx.verboseWriter != nil {
+		w.verboseWriter = new(bytes.Buffer)
+	}
+	return w
+}
+
+// merge adds what worker w indexed to idx, as if idx had indexed it itself.
+func (idx *Indexer) merge(w *Indexer) {
+	base := uint16(len(idx.index.Files))
+	for _, e := range w.found {
+		e.loc.FileIndex += base
+		idx.addLocation(e.hash, e.loc)
+	}
+	for _, s := range w.index.SkippedStreams {
+		s.FileIndex += base
+		idx.index.SkippedStreams = append(idx.index.SkippedStreams, s)
+	}
+	idx.index.Files = append(idx.index.Files, w.index.Files...)
+	idx.index.ESReaders = append(idx.index.ESReaders, w.index.ESReaders...)
+	idx.index.RawReaders = append(idx.index.RawReaders, w.index.RawReaders...)
+	idx.index.MmapFiles = append(idx.index.MmapFiles, w.index.MmapFiles...)
+	if buf, ok := w.verboseWriter.(*bytes.Buffer); ok {
+		buf.WriteTo(idx.verboseWriter)
+	}
+}
+
+// runJobs runs jobs, adding their results to idx.index in job order, so
+// the index is the same however many run at once. Jobs run in parallel
+// while Build has worker slots free, and otherwise on the calling
+// goroutine, so a job may itself run jobs (a Blu-ray ISO does, one per
+// region) without waiting on the slots its parent holds. report, if
+// non-nil, receives the bytes processed by all jobs so far.
+//
+// Finished jobs keep their locations until those of every earlier job
+// have been added, so only a few are started ahead of the oldest
+// unfinished one. On error, the jobs already started are waited for and
+// the error of the earliest failing job is returned. Once ctx is
+// canceled, no more jobs are started.
+func (idx *Indexer) runJobs(ctx context.Context, jobs []indexJob, report func(int64)) error {
+	var mu sync.Mutex
+	done := make([]int64, len(jobs))
+	var total int64
+	progress := func(i int) func(int64) {
+		if report == nil {
+			return nil
+		}
+		return func(n int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			total += n - done[i]
+			done[i] = n
+			report(total)
+		}
+	}
+
+	if idx.slots == nil {
+		for i, job := range jobs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := progress(i)
+			if err := job.run(ctx, idx, p); err != nil {
+				return err
+			}
+			if p != nil {
+				p(job.size)
+			}
+		}
+		return nil
+	}
+
+	type result struct {
+		w    *Indexer
+		err  error
+		done chan struct{}
+	}
+	results := make([]*result, 0, len(jobs))
+	maxAhead := 2 * (cap(idx.slots) + 1)
+	merged := 0
+	var err error
+	mergeNext := func() {
+		i := merged
+		r := results[i]
+		<-r.done
+		merged++
+		if err == nil && r.err == nil {
+			idx.merge(r.w)
+			if p := progress(i); p != nil {
+				p(jobs[i].size)
+			}
+			return
+		}
+		if err == nil {
+			err = r.err
+		}
+		r.w.index.Close()
+	}
+
+	for i, job := range jobs {
+		for err == nil && len(results)-merged >= maxAhead {
+			mergeNext()
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		r := &result{w: idx.newWorker(), done: make(chan struct{})}
+		results = append(results, r)
+		select {
+		case idx.slots <- struct{}{}:
+			go func() {
+				r.err = job.run(ctx, r.w, progress(i))
+				<-idx.slots
+				close(r.done)
+			}()
+		default:
+			r.err = job.run(ctx, r.w, progress(i))
+			close(r.done)
+		}
+	}
+	for merged < len(results) {
+		mergeNext()
+	}
+	return err
+}
+
+// parallelFor calls fn for each i in [0, n), in parallel while Build has
+// worker slots free, and returns once all calls have.
+func (idx *Indexer) parallelFor(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := range n {
+		select {
+		case idx.slots <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-idx.slots }()
+				fn(i)
+			}()
+		default:
+			fn(i)
+		}
+	}
+	wg.Wait()
+}
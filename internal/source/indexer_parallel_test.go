@@ -0,0 +1,194 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestSource writes files, keyed by path relative to a new temporary
+// directory, and returns the directory.
+func writeTestSource(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuild_ParallelMatchesSerial(t *testing.T) {
+	videoFill := []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70}
+	audioFill := []byte{0x0B, 0x77, 0xAA, 0xBB}
+	vobs := bytes.Join([][]byte{
+		buildTestDVDPack(0xE0, 0, videoFill),
+		buildTestDVDPack(0xE0, 0, videoFill[1:]),
+		buildTestDVDPack(0xBD, 0x80, audioFill),
+		buildTestDVDPack(0xE0, 0, videoFill[2:]),
+	}, nil)
+	mkv := buildTestMKV(testMKVTracks, testMKVBlocks(), 3)
+
+	for _, tt := range []struct {
+		name  string
+		raw   bool
+		files map[string][]byte
+	}{
+		{"M2TS", false, map[string][]byte{
+			"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+			"BDMV/STREAM/00002.m2ts": buildBasicM2TSData(),
+			"BDMV/STREAM/00003.m2ts": buildTrueHDAC3M2TSData(),
+		}},
+		{"raw M2TS", true, map[string][]byte{
+			"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+			"BDMV/STREAM/00002.m2ts": buildBasicM2TSData(),
+		}},
+		{"VOB sets", false, map[string][]byte{
+			"VIDEO_TS/VTS_01_1.VOB": vobs[:3*2048],
+			"VIDEO_TS/VTS_01_2.VOB": vobs[3*2048:],
+			"VIDEO_TS/VTS_02_1.VOB": vobs,
+		}},
+		{"DVD and Blu-ray ISOs", false, map[string][]byte{
+			"disc1.iso": vobs,
+			"disc2.iso": buildTestBlurayISO(buildBasicM2TSData(), buildTrueHDAC3M2TSData(), buildBasicM2TSData()),
+			"disc3.iso": buildTestBlurayISO(buildTrueHDAC3M2TSData()),
+		}},
+		{"MKV", false, map[string][]byte{
+			"a.mkv": mkv,
+			"b.mkv": mkv,
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestSource(t, tt.files)
+			build := func(workers int) (*Index, string) {
+				t.Helper()
+				indexer, err := NewIndexerWithOptions(dir, MinWindowSize, tt.raw)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var verbose bytes.Buffer
+				indexer.SetVerboseWriter(&verbose)
+				indexer.SetWorkers(workers)
+				if err := indexer.Build(nil); err != nil {
+					t.Fatalf("Build with %d workers: %v", workers, err)
+				}
+				t.Cleanup(func() { indexer.Index().Close() })
+				return indexer.Index(), verbose.String()
+			}
+
+			serial, serialOut := build(1)
+			for _, workers := range []int{2, 8} {
+				parallel, parallelOut := build(workers)
+				if !reflect.DeepEqual(parallel.Files, serial.Files) {
+					t.Errorf("%d workers: Files = %+v, want %+v", workers, parallel.Files, serial.Files)
+				}
+				// Location lists are compared unsorted: they must be in the
+				// same order as well
+				if len(serial.HashToLocations) == 0 || !reflect.DeepEqual(parallel.HashToLocations, serial.HashToLocations) {
+					t.Errorf("%d workers: hash table of %d hashes differs from the serial one of %d",
+						workers, len(parallel.HashToLocations), len(serial.HashToLocations))
+				}
+				if parallelOut != serialOut {
+					t.Errorf("%d workers: verbose output\n%s\nwant\n%s", workers, parallelOut, serialOut)
+				}
+				if len(parallel.RawReaders) != len(serial.RawReaders) || len(parallel.MmapFiles) != len(serial.MmapFiles) {
+					t.Errorf("%d workers: %d raw readers and %d mapped files, want %d and %d", workers,
+						len(parallel.RawReaders), len(parallel.MmapFiles), len(serial.RawReaders), len(serial.MmapFiles))
+				}
+				if len(parallel.ESReaders) != len(serial.ESReaders) {
+					t.Fatalf("%d workers: %d ES readers, want %d", workers, len(parallel.ESReaders), len(serial.ESReaders))
+				}
+				for i := range serial.ESReaders {
+					compareESReaders(t, serial.Files[i].RelativePath, serial.ESReaders[i], parallel.ESReaders[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuild_ParallelError(t *testing.T) {
+	mkv := buildTestMKV(testMKVTracks, testMKVBlocks(), 3)
+	dir := writeTestSource(t, map[string][]byte{
+		"a.mkv": mkv,
+		"b.mkv": []byte("not a Matroska file"),
+		"c.mkv": mkv,
+		"d.mkv": mkv,
+	})
+
+	var want string
+	for _, workers := range []int{1, 4} {
+		indexer, err := NewIndexer(dir, MinWindowSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexer.SetWorkers(workers)
+		err = indexer.Build(nil)
+		indexer.Index().Close()
+		if err == nil {
+			t.Fatalf("Build with %d workers of a source with a broken file succeeded", workers)
+		}
+		if workers == 1 {
+			want = err.Error()
+		} else if err.Error() != want {
+			t.Errorf("Build with %d workers: error %q, want %q", workers, err, want)
+		}
+	}
+}
+
+func TestBuildContext_Canceled(t *testing.T) {
+	dir := writeTestSource(t, map[string][]byte{
+		"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+		"BDMV/STREAM/00002.m2ts": buildBasicM2TSData(),
+		"BDMV/STREAM/00003.m2ts": buildTrueHDAC3M2TSData(),
+	})
+
+	for _, tt := range []struct {
+		name      string
+		workers   int
+		maxMemory int64
+	}{
+		{"serial", 1, 0},
+		{"parallel", 4, 0},
+		{"sorted", 1, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			indexer, err := NewIndexer(dir, MinWindowSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexer.SetWorkers(tt.workers)
+			indexer.SetMaxMemory(tt.maxMemory)
+			indexer.SetTempDir(tempDir)
+
+			// Canceled while the first file is indexed
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err = indexer.BuildContext(ctx, func(processed, total int64) { cancel() })
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("BuildContext = %v, want %v", err, context.Canceled)
+			}
+			if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+				t.Errorf("canceled build left %d files in the temporary directory", len(entries))
+			}
+
+			// The Indexer builds again once it is no longer canceled
+			if err := indexer.Build(nil); err != nil {
+				t.Fatalf("Build after a canceled build: %v", err)
+			}
+			defer indexer.Index().Close()
+			if got := len(indexer.Index().Files); got != 3 {
+				t.Errorf("index of %d files, want 3", got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package source
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cespare/xxhash/v2"
@@ -38,29 +39,32 @@ func (r *mmapRawReader) Close() error {
 // indexRawFile processes a raw file (for non-DVD, non-Blu-ray formats).
 // Processes the file in a single pass: computes checksum and indexes sync points
 // together in chunks, releasing mmap pages as they're processed.
-func (idx *Indexer) indexRawFile(fileIndex uint16, path string, size int64, progress func(int64)) (uint64, error) {
+func (idx *Indexer) indexRawFile(ctx context.Context, fileIndex uint16, path string, size int64, progress func(int64)) (fileChecksums, error) {
 	mmapFile, err := mmap.Open(path)
 	if err != nil {
-		return 0, fmt.Errorf("mmap open: %w", err)
+		return fileChecksums{}, fmt.Errorf("mmap open: %w", err)
 	}
 	idx.index.RawReaders = append(idx.index.RawReaders, &mmapRawReader{mmapFile: mmapFile})
 
 	mmapFile.Advise(unix.MADV_SEQUENTIAL)
 	data := mmapFile.Data()
 
-	return idx.indexRawFileData(fileIndex, mmapFile, data, size, progress)
+	return idx.indexRawFileData(ctx, fileIndex, mmapFile, data, size, progress)
 }
 
 // indexRawFileData is the core of indexRawFile operating on already-opened mmap data.
 // Used as a fallback when M2TS packet structure cannot be detected.
-func (idx *Indexer) indexRawFileData(fileIndex uint16, mmapFile *mmap.File, data []byte, size int64, progress func(int64)) (uint64, error) {
-	hasher := xxhash.New()
+func (idx *Indexer) indexRawFileData(ctx context.Context, fileIndex uint16, mmapFile *mmap.File, data []byte, size int64, progress func(int64)) (fileChecksums, error) {
+	hasher := NewChunkHasher(ChecksumChunkSize)
 	const chunkSize = 64 * 1024 * 1024
 	const overlap = 3
 	pageSize := unix.Getpagesize()
 	checksumPos := 0
 
 	for chunkStart := 0; chunkStart < len(data); {
+		if err := ctx.Err(); err != nil {
+			return fileChecksums{}, err
+		}
 		chunkEnd := chunkStart + chunkSize
 		if chunkEnd > len(data) {
 			chunkEnd = len(data)
@@ -82,7 +86,7 @@ func (idx *Indexer) indexRawFileData(fileIndex uint16, mmapFile *mmap.File, data
 			}
 			window := data[offset : offset+idx.windowSize]
 			hash := xxhash.Sum64(window)
-			idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], Location{
+			idx.addLocation(hash, Location{
 				FileIndex: fileIndex,
 				Offset:    int64(offset),
 			})
@@ -94,7 +98,7 @@ func (idx *Indexer) indexRawFileData(fileIndex uint16, mmapFile *mmap.File, data
 			}
 			window := data[offset : offset+idx.windowSize]
 			hash := xxhash.Sum64(window)
-			idx.index.HashToLocations[hash] = append(idx.index.HashToLocations[hash], Location{
+			idx.addLocation(hash, Location{
 				FileIndex: fileIndex,
 				Offset:    int64(offset),
 			})
@@ -115,7 +119,6 @@ func (idx *Indexer) indexRawFileData(fileIndex uint16, mmapFile *mmap.File, data
 		chunkStart = chunkEnd - overlap
 	}
 
-	checksum := hasher.Sum64()
 	mmapFile.Advise(unix.MADV_RANDOM)
-	return checksum, nil
+	return fileChecksums{sum: hasher.Sum64(), chunks: hasher.ChunkSums()}, nil
 }
@@ -0,0 +1,71 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// indexSamples indexes the samples of one track of a sample-based source,
+// given the size of every sample in ES order. findSyncPoints locates sync
+// points within a sample; nil indexes only the sample start. Windows never
+// cross a sample boundary, since an MKV block holds exactly one sample and the
+// matcher only hashes within a block. progress receives the ES offset reached.
+func (idx *Indexer) indexSamples(ctx context.Context, fileIndex uint16, parser *sampleES, isVideo bool, subStreamID byte, sizes []uint32, findSyncPoints syncPointFinder, progress func(int64)) error {
+	var esOffset int64
+	syncPointCount := 0
+	for i, size := range sizes {
+		sampleStart := esOffset
+		esOffset += int64(size)
+		if int(size) < idx.windowSize {
+			continue
+		}
+
+		// A sample is contiguous in the file, so this is zero-copy
+		var sample []byte
+		var err error
+		if isVideo {
+			sample, err = parser.ReadESData(sampleStart, int(size), true)
+		} else {
+			sample, err = parser.ReadAudioSubStreamData(subStreamID, sampleStart, int(size))
+		}
+		if err != nil {
+			return fmt.Errorf("read sample %d: %w", i, err)
+		}
+
+		syncPoints := []int{0}
+		if findSyncPoints != nil {
+			syncPoints = findSyncPoints(sample)
+		}
+		for _, off := range syncPoints {
+			if off+idx.windowSize > len(sample) {
+				continue
+			}
+			hash := xxhash.Sum64(sample[off : off+idx.windowSize])
+			idx.addLocation(hash, Location{
+				FileIndex:        fileIndex,
+				Offset:           sampleStart + int64(off),
+				IsVideo:          isVideo,
+				AudioSubStreamID: subStreamID,
+			})
+			syncPointCount++
+		}
+
+		if i%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(esOffset)
+			}
+		}
+	}
+
+	if idx.verboseWriter != nil {
+		fmt.Fprintf(idx.verboseWriter, "  [indexSamples] video=%v sub-stream=%d: %d samples, %d sync points indexed\n",
+			isVideo, subStreamID, len(sizes), syncPointCount)
+	}
+
+	return nil
+}
@@ -216,6 +216,53 @@ func findISOEntry(entries []isoFileExtent, name string) (*isoFileExtent, error)
 	return nil, fmt.Errorf("%q not found", name)
 }
 
+// findBDMVFilesInISO9660 navigates an ISO9660 filesystem to find the files
+// under BDMV/<dir>/ whose names end in suffix (upper case, e.g. ".CLPI").
+// Returns the file extents or an error.
+func findBDMVFilesInISO9660(f *os.File, dir, suffix string) ([]isoFileExtent, error) {
+	rootLBA, rootLen, err := readISOPVDRoot(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rootEntries, err := readISODirectory(f, rootLBA, rootLen)
+	if err != nil {
+		return nil, fmt.Errorf("read ISO root directory: %w", err)
+	}
+
+	bdmv, err := findISOEntry(rootEntries, "BDMV")
+	if err != nil {
+		return nil, fmt.Errorf("find BDMV directory: %w", err)
+	}
+
+	bdmvEntries, err := readISODirectory(f, uint32(bdmv.Offset/isoSectorSize), uint32(bdmv.Size))
+	if err != nil {
+		return nil, fmt.Errorf("read BDMV directory: %w", err)
+	}
+
+	sub, err := findISOEntry(bdmvEntries, dir)
+	if err != nil {
+		return nil, fmt.Errorf("find %s directory: %w", dir, err)
+	}
+
+	subEntries, err := readISODirectory(f, uint32(sub.Offset/isoSectorSize), uint32(sub.Size))
+	if err != nil {
+		return nil, fmt.Errorf("read %s directory: %w", dir, err)
+	}
+
+	var files []isoFileExtent
+	for _, e := range subEntries {
+		if !e.IsDir && strings.HasSuffix(e.Name, suffix) {
+			files = append(files, e)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files found in BDMV/%s/", suffix, dir)
+	}
+	return files, nil
+}
+
 // readISOFileExtent reads up to maxBytes from an isoFileExtent, handling both
 // contiguous files (single ReadAt from Offset) and non-contiguous UDF files
 // (stitching reads across Extents). Returns the data read and any error.
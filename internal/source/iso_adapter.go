@@ -21,7 +21,7 @@ type isoM2TSAdapter struct {
 
 	// For non-contiguous multi-extent files:
 	mr        *multiRegionData // virtual contiguous view over mmap sub-slices
-	extentMap []extentMapEntry // maps logical offset → ISO offset
+	extentMap isoExtentMap     // maps logical offset → ISO offset
 }
 
 // extentMapEntry maps a range of logical (assembled) offsets to physical ISO offsets.
@@ -31,6 +31,25 @@ type extentMapEntry struct {
 	Length       int64 // length of this extent
 }
 
+// isoExtentMap maps offsets in data assembled from several physical extents
+// back to the offsets of those extents, sorted by LogicalStart.
+type isoExtentMap []extentMapEntry
+
+// newISOExtentMap builds the extent map of data assembled from extents in order.
+func newISOExtentMap(extents []isoPhysicalRange) isoExtentMap {
+	em := make(isoExtentMap, len(extents))
+	logicalOff := int64(0)
+	for i, ext := range extents {
+		em[i] = extentMapEntry{
+			LogicalStart: logicalOff,
+			ISOOffset:    ext.ISOOffset,
+			Length:       ext.Length,
+		}
+		logicalOff += ext.Length
+	}
+	return em
+}
+
 // newISOAdapter creates an adapter for an M2TS region within an ISO.
 func newISOAdapter(parser *MPEGTSParser, isoData []byte, baseOffset int64) *isoM2TSAdapter {
 	return &isoM2TSAdapter{
@@ -44,21 +63,10 @@ func newISOAdapter(parser *MPEGTSParser, isoData []byte, baseOffset int64) *isoM
 // mr provides a virtual contiguous view over the mmap sub-slices.
 // extents describes the physical layout in the ISO.
 func newISOAdapterMultiExtent(parser *MPEGTSParser, mr *multiRegionData, extents []isoPhysicalRange) *isoM2TSAdapter {
-	// Build the extent map with cumulative logical offsets
-	em := make([]extentMapEntry, len(extents))
-	logicalOff := int64(0)
-	for i, ext := range extents {
-		em[i] = extentMapEntry{
-			LogicalStart: logicalOff,
-			ISOOffset:    ext.ISOOffset,
-			Length:       ext.Length,
-		}
-		logicalOff += ext.Length
-	}
 	return &isoM2TSAdapter{
 		parser:    parser,
 		mr:        mr,
-		extentMap: em,
+		extentMap: newISOExtentMap(extents),
 	}
 }
 
@@ -117,7 +125,7 @@ func (a *isoM2TSAdapter) ESOffsetToFileOffset(esOffset int64, isVideo bool) (fil
 	if a.mr != nil {
 		// Multi-extent: parser offset is assembled-relative,
 		// convert to ISO-relative for range maps / reconstruction.
-		return a.logicalToISO(fOff), rem
+		return a.extentMap.toISO(fOff), rem
 	}
 	return fOff + a.baseOffset, rem
 }
@@ -144,7 +152,7 @@ func (a *isoM2TSAdapter) AudioSubStreamESSize(subStreamID byte) int64 {
 // FileOffset values to ISO-relative offsets for range map storage.
 func (a *isoM2TSAdapter) FileOffsetConverter() func(int64) int64 {
 	if a.mr != nil {
-		return a.logicalToISO
+		return a.extentMap.toISO
 	}
 	baseOff := a.baseOffset
 	return func(off int64) int64 { return off + baseOff }
@@ -160,9 +168,14 @@ func (a *isoM2TSAdapter) ReadAudioByteWithHint(subStreamID byte, esOffset int64,
 	return a.parser.ReadAudioByteWithHint(subStreamID, esOffset, rangeHint)
 }
 
-// IsLPCMSubStream always returns false for Blu-ray M2TS (LPCM is DVD-only).
-func (a *isoM2TSAdapter) IsLPCMSubStream(_ byte) bool {
-	return false
+// IsLPCMSubStream reports whether a sub-stream is byte-swapped LPCM.
+func (a *isoM2TSAdapter) IsLPCMSubStream(subStreamID byte) bool {
+	return a.parser.IsLPCMSubStream(subStreamID)
+}
+
+// LPCMSampleSize returns the sample size of a byte-swapped LPCM sub-stream.
+func (a *isoM2TSAdapter) LPCMSampleSize(subStreamID byte) int {
+	return a.parser.LPCMSampleSize(subStreamID)
 }
 
 // --- ESRangeConverter interface (for V3 format — adds baseOffset to raw ranges) ---
@@ -191,7 +204,7 @@ func (a *isoM2TSAdapter) adjustRawRanges(ranges []RawRange) []RawRange {
 	if a.mr != nil {
 		// Multi-extent: convert assembled-relative offsets to ISO-relative
 		// for range maps stored in the dedup file.
-		return a.mapRawRangesToISO(ranges)
+		return a.extentMap.mapRawRanges(ranges)
 	}
 	adjusted := make([]RawRange, len(ranges))
 	for i, r := range ranges {
@@ -203,40 +216,40 @@ func (a *isoM2TSAdapter) adjustRawRanges(ranges []RawRange) []RawRange {
 	return adjusted
 }
 
-// logicalToISO converts a logical offset in the assembled data to the
-// corresponding physical ISO offset using the extent map.
-func (a *isoM2TSAdapter) logicalToISO(logicalOff int64) int64 {
-	if len(a.extentMap) == 0 {
+// toISO converts a logical offset in the assembled data to the
+// corresponding physical ISO offset.
+func (em isoExtentMap) toISO(logicalOff int64) int64 {
+	if len(em) == 0 {
 		return logicalOff
 	}
 	// Binary search for the extent containing this offset
-	idx := sort.Search(len(a.extentMap), func(i int) bool {
-		return a.extentMap[i].LogicalStart+a.extentMap[i].Length > logicalOff
+	idx := sort.Search(len(em), func(i int) bool {
+		return em[i].LogicalStart+em[i].Length > logicalOff
 	})
-	if idx >= len(a.extentMap) {
+	if idx >= len(em) {
 		// Shouldn't happen — fall back to last extent
-		idx = len(a.extentMap) - 1
+		idx = len(em) - 1
 	}
-	e := a.extentMap[idx]
+	e := em[idx]
 	return e.ISOOffset + (logicalOff - e.LogicalStart)
 }
 
-// mapRawRangesToISO converts assembled-relative raw ranges to ISO-relative ranges.
+// mapRawRanges converts assembled-relative raw ranges to ISO-relative ranges.
 // A single assembled range may span an extent boundary, so it may be split into
 // multiple ISO ranges.
-func (a *isoM2TSAdapter) mapRawRangesToISO(ranges []RawRange) []RawRange {
+func (em isoExtentMap) mapRawRanges(ranges []RawRange) []RawRange {
 	var result []RawRange
 	for _, r := range ranges {
 		remaining := int64(r.Size)
 		logOff := r.FileOffset
 		for remaining > 0 {
-			idx := sort.Search(len(a.extentMap), func(i int) bool {
-				return a.extentMap[i].LogicalStart+a.extentMap[i].Length > logOff
+			idx := sort.Search(len(em), func(i int) bool {
+				return em[i].LogicalStart+em[i].Length > logOff
 			})
-			if idx >= len(a.extentMap) {
+			if idx >= len(em) {
 				break
 			}
-			e := a.extentMap[idx]
+			e := em[idx]
 			offsetInExtent := logOff - e.LogicalStart
 			available := e.Length - offsetInExtent
 			chunk := remaining
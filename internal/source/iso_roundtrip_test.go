@@ -0,0 +1,185 @@
+package source_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/dedup"
+	"github.com/stuckj/mkvdup/internal/matcher"
+	"github.com/stuckj/mkvdup/internal/mkv"
+	"github.com/stuckj/mkvdup/internal/source"
+)
+
+// testMPEG2ES returns size bytes of MPEG-2 video ES starting with a
+// sequence header, split into frames at picture start codes.
+func testMPEG2ES(rng *rand.Rand, size int) (es []byte, frames [][]byte) {
+	es = make([]byte, size)
+	rng.Read(es)
+	copy(es, []byte{0x00, 0x00, 0x01, 0xB3})
+	start := 0
+	for next := 600 + rng.Intn(900); next < size-600; next += 600 + rng.Intn(900) {
+		copy(es[next:], []byte{0x00, 0x00, 0x01, 0x00})
+		frames = append(frames, es[start:next])
+		start = next
+	}
+	return es, append(frames, es[start:])
+}
+
+// TestMixedDVDAndBlurayISOs_RoundTrip checks that a dedup file whose
+// entries point into both a DVD ISO, indexed as MPEG-PS, and a Blu-ray ISO,
+// indexed as M2TS, reconstructs the MKV through the range maps of both.
+func TestMixedDVDAndBlurayISOs_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(7))
+
+	// DVD ISO: video packs, each carrying 2025 bytes of the ES
+	const dvdPayload = 2048 - 14 - 9
+	dvdES, dvdFrames := testMPEG2ES(rng, 20*dvdPayload)
+	var dvd []byte
+	for off := 0; off < len(dvdES); off += dvdPayload {
+		dvd = append(dvd, source.BuildTestDVDPack(0xE0, 0, dvdES[off:off+dvdPayload])...)
+	}
+
+	// Blu-ray ISO: one MPEG-2 video PES spread over M2TS packets
+	const (
+		pmtPID   = uint16(0x0100)
+		videoPID = uint16(0x1011)
+	)
+	blurayES, blurayFrames := testMPEG2ES(rng, 175+200*184)
+	m2ts := append(source.MakeM2TSPacket(0, true, 0x01, 0, 0, source.MakePATPayload(pmtPID)),
+		source.MakeM2TSPacket(pmtPID, true, 0x01, 0, 0, source.MakePMTPayload(videoPID, 0x02, nil, nil))...)
+	m2ts = append(m2ts, source.MakeM2TSPacket(videoPID, true, 0x01, 0, 0, source.MakePESStart(0xE0, 0, blurayES[:175]))...)
+	for i, off := 1, 175; off < len(blurayES); i, off = i+1, off+184 {
+		m2ts = append(m2ts, source.MakeM2TSPacket(videoPID, false, 0x01, 0, byte(i), blurayES[off:off+184])...)
+	}
+
+	for name, data := range map[string][]byte{"disc1.iso": dvd, "disc2.iso": source.BuildTestBlurayISO(m2ts)} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The MKV interleaves the frames of both discs, with one frame of
+	// neither for the delta.
+	var frames [][]byte
+	for i := 0; i < max(len(dvdFrames), len(blurayFrames)); i++ {
+		if i < len(dvdFrames) {
+			frames = append(frames, dvdFrames[i])
+		}
+		if i < len(blurayFrames) {
+			frames = append(frames, blurayFrames[i])
+		}
+	}
+	unmatched := make([]byte, 500)
+	rng.Read(unmatched)
+	frames = append(frames, unmatched)
+	mkvData := source.BuildTestVideoMKV("V_MPEG2", frames)
+	mkvPath := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(mkvPath, mkvData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := source.NewIndexer(dir, source.DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+	if indexer.SourceType() != source.TypeBluray {
+		t.Fatalf("source type = %v, want %v", indexer.SourceType(), source.TypeBluray)
+	}
+
+	parser, err := mkv.NewParser(mkvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Close()
+	if err := parser.Parse(nil); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	m, err := matcher.NewMatcher(index)
+	if err != nil {
+		t.Fatalf("NewMatcher: %v", err)
+	}
+	defer m.Close()
+	result, err := m.Match(mkvPath, parser.Packets(), parser.Tracks(), nil)
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	defer result.Close()
+
+	// Entries point into both discs
+	matched := make(map[string]int64)
+	for _, e := range result.Entries {
+		if e.Source > 0 {
+			matched[index.Files[e.Source-1].RelativePath] += e.Length
+		}
+	}
+	if matched["disc1.iso"] < int64(len(dvdES))/2 || matched["disc2.iso"] < int64(len(blurayES))/2 {
+		t.Fatalf("matched bytes per disc = %v, want most of the %d DVD and %d Blu-ray ES bytes",
+			matched, len(dvdES), len(blurayES))
+	}
+
+	// Range maps of every stream, as create writes them for a Blu-ray source
+	var rangeMaps []dedup.RangeMapData
+	for i, r := range index.ESReaders {
+		provider, ok := r.(source.PESRangeProvider)
+		if !ok {
+			t.Fatalf("ESReaders[%d] (%T) provides no PES ranges", i, r)
+		}
+		rm := dedup.RangeMapData{FileIndex: uint16(i), VideoRanges: provider.FilteredVideoRanges()}
+		if adj, ok := r.(source.FileOffsetAdjuster); ok {
+			rm.OffsetFunc = adj.FileOffsetConverter()
+		}
+		for _, subID := range provider.AudioSubStreams() {
+			rm.AudioStreams = append(rm.AudioStreams, dedup.AudioRangeData{
+				SubStreamID: subID,
+				Ranges:      provider.FilteredAudioRanges(subID),
+			})
+		}
+		rangeMaps = append(rangeMaps, rm)
+	}
+
+	dedupPath := filepath.Join(t.TempDir(), "movie.mkvdup")
+	w, err := dedup.NewWriter(dedupPath)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	w.SetHeader(int64(len(mkvData)), xxhash.Sum64(mkvData), indexer.SourceType())
+	w.SetSourceFiles(index.Files)
+	w.SetRangeMaps(rangeMaps)
+	if err := w.SetMatchResult(result, nil); err != nil {
+		t.Fatalf("SetMatchResult: %v", err)
+	}
+	if err := w.Write(); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	w.Close()
+
+	r, err := dedup.NewReader(dedupPath, dir)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+	if err := r.LoadSourceFiles(); err != nil {
+		t.Fatalf("LoadSourceFiles: %v", err)
+	}
+	got := make([]byte, len(mkvData))
+	if n, err := r.ReadAt(got, 0); err != nil || n != len(got) {
+		t.Fatalf("ReadAt: n=%d, err=%v", n, err)
+	}
+	if !bytes.Equal(got, mkvData) {
+		for i := range got {
+			if got[i] != mkvData[i] {
+				t.Fatalf("reconstruction differs from the MKV first at offset %d", i)
+			}
+		}
+	}
+}
@@ -1,14 +1,16 @@
 package source
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 )
 
 // buildTestBlurayISO creates a minimal ISO9660 filesystem containing a
-// BDMV/STREAM/ directory with a single M2TS file. The M2TS data is provided
-// by the caller. Returns the raw ISO bytes.
+// BDMV/STREAM/ directory with an M2TS file (00000.M2TS, 00001.M2TS, ...)
+// for each of the M2TS data given. Returns the raw ISO bytes.
 //
 // ISO9660 layout:
 //
@@ -19,15 +21,18 @@ import (
 //	Sector 19:    (padding)
 //	Sector 20:    Root directory (contains "." , ".." , "BDMV")
 //	Sector 21:    BDMV directory (contains "." , ".." , "STREAM")
-//	Sector 22:    STREAM directory (contains "." , ".." , "00000.M2TS")
-//	Sector 23+:   M2TS file data (padded to sector boundary)
-func buildTestBlurayISO(m2tsData []byte) []byte {
+//	Sector 22:    STREAM directory (contains "." , ".." , "00000.M2TS", ...)
+//	Sector 23+:   M2TS file data (each padded to sector boundary)
+func buildTestBlurayISO(m2tsData ...[]byte) []byte {
 	const sector = 2048
 
-	// M2TS file starts at sector 23, padded to sector boundary
-	m2tsStartSector := 23
-	m2tsSectors := (len(m2tsData) + sector - 1) / sector
-	totalSectors := m2tsStartSector + m2tsSectors
+	// M2TS files start at sector 23, each padded to sector boundary
+	m2tsStartSectors := make([]int, len(m2tsData))
+	totalSectors := 23
+	for i, data := range m2tsData {
+		m2tsStartSectors[i] = totalSectors
+		totalSectors += (len(data) + sector - 1) / sector
+	}
 
 	iso := make([]byte, totalSectors*sector)
 
@@ -59,12 +64,17 @@ func buildTestBlurayISO(m2tsData []byte) []byte {
 	// --- STREAM directory (sector 22) ---
 	streamDir := iso[22*sector:]
 	off = 0
-	off += writeISO9660DirEntry(streamDir[off:], "\x00", 22, sector, true)                            // "."
-	off += writeISO9660DirEntry(streamDir[off:], "\x01", 21, sector, true)                            // ".."
-	off += writeISO9660DirEntry(streamDir[off:], "00000.M2TS", m2tsStartSector, len(m2tsData), false) // M2TS file
+	off += writeISO9660DirEntry(streamDir[off:], "\x00", 22, sector, true) // "."
+	off += writeISO9660DirEntry(streamDir[off:], "\x01", 21, sector, true) // ".."
+	for i, data := range m2tsData {
+		name := fmt.Sprintf("%05d.M2TS", i)
+		off += writeISO9660DirEntry(streamDir[off:], name, m2tsStartSectors[i], len(data), false) // M2TS file
+	}
 
 	// --- M2TS file data (sector 23+) ---
-	copy(iso[m2tsStartSector*sector:], m2tsData)
+	for i, data := range m2tsData {
+		copy(iso[m2tsStartSectors[i]*sector:], data)
+	}
 
 	return iso
 }
@@ -394,3 +404,110 @@ func TestDetectBlurayCodecsFromISO(t *testing.T) {
 		t.Errorf("expected AC3 audio codec, got %v", codecs.AudioCodecs)
 	}
 }
+
+// writeTestMixedDiscs writes a DVD "ISO" (bare MPEG-PS packs, too short for
+// an ISO9660 volume descriptor, so it is classified as DVD) and a Blu-ray
+// ISO into dir, as disc1.iso and disc2.iso.
+func writeTestMixedDiscs(t *testing.T, dir string) (dvdData, blurayData []byte) {
+	t.Helper()
+	dvdData = bytes.Join([][]byte{
+		buildTestDVDPack(0xE0, 0, []byte{0x00, 0x00, 0x01, 0xB3, 0x10, 0x20}),
+		buildTestDVDPack(0xBD, 0x80, []byte{0x0B, 0x77, 0xAA, 0xBB}),
+	}, nil)
+	blurayData = buildTestBlurayISO(buildBasicM2TSData())
+	if err := os.WriteFile(filepath.Join(dir, "disc1.iso"), dvdData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "disc2.iso"), blurayData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dvdData, blurayData
+}
+
+func TestDetectType_MixedDVDAndBlurayISOs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMixedDiscs(t, dir)
+
+	// The DVD ISO sorts first; every ISO must be inspected, not just isos[0]
+	sourceType, err := DetectType(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourceType != TypeBluray {
+		t.Errorf("DetectType() = %v, want %v", sourceType, TypeBluray)
+	}
+
+	files, err := EnumerateMediaFiles(dir, sourceType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != "disc1.iso" || files[1] != "disc2.iso" {
+		t.Errorf("EnumerateMediaFiles() = %v, want [disc1.iso disc2.iso]", files)
+	}
+}
+
+func TestIndexMixedDVDAndBlurayISOs(t *testing.T) {
+	dir := t.TempDir()
+	dvdData, blurayData := writeTestMixedDiscs(t, dir)
+
+	indexer, err := NewIndexer(dir, DefaultWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatal(err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if !index.UsesESOffsets {
+		t.Error("expected UsesESOffsets=true")
+	}
+	if len(index.Files) < 2 {
+		t.Fatalf("expected at least 2 source file entries, got %d", len(index.Files))
+	}
+	if len(index.ESReaders) != len(index.Files) {
+		t.Fatalf("ESReaders count (%d) != Files count (%d)", len(index.ESReaders), len(index.Files))
+	}
+
+	// The DVD ISO is indexed with the MPEG-PS parser...
+	if index.Files[0].RelativePath != "disc1.iso" || index.Files[0].Size != int64(len(dvdData)) {
+		t.Errorf("file 0 = %+v, want disc1.iso (%d bytes)", index.Files[0], len(dvdData))
+	}
+	if _, ok := index.ESReaders[0].(*MPEGPSParser); !ok {
+		t.Errorf("ESReaders[0] is %T, want *MPEGPSParser", index.ESReaders[0])
+	}
+
+	// ...and the Blu-ray ISO with the M2TS-in-ISO adapter.
+	for i := 1; i < len(index.Files); i++ {
+		if index.Files[i].RelativePath != "disc2.iso" || index.Files[i].Size != int64(len(blurayData)) {
+			t.Errorf("file %d = %+v, want disc2.iso (%d bytes)", i, index.Files[i], len(blurayData))
+		}
+		if _, ok := index.ESReaders[i].(*isoM2TSAdapter); !ok {
+			t.Errorf("ESReaders[%d] is %T, want *isoM2TSAdapter", i, index.ESReaders[i])
+		}
+	}
+
+	// The DVD video ES (which contains an MPEG-2 sequence header) is indexed
+	// under the DVD's file index.
+	found := false
+	for _, locs := range index.HashToLocations {
+		for _, loc := range locs {
+			if loc.FileIndex == 0 && loc.IsVideo {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("no video locations indexed for the DVD ISO")
+	}
+
+	// Codecs from both discs are reported
+	codecs, err := DetectSourceCodecs(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsCodec(codecs.VideoCodecs, CodecMPEG2Video) || !containsCodec(codecs.VideoCodecs, CodecH264Video) {
+		t.Errorf("VideoCodecs = %v, want MPEG-2 and H.264", codecs.VideoCodecs)
+	}
+}
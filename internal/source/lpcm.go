@@ -1,5 +1,7 @@
 package source
 
+import "fmt"
+
 // DVD LPCM audio frame format (after 4-byte PS private stream header):
 //
 //	Byte 0: emphasis(1) | mute(1) | reserved(1) | frame_number(5)
@@ -112,3 +114,128 @@ func FindLPCMMatchSyncPoints(data []byte) []int {
 func IsLPCMSubStreamID(subStreamID byte) bool {
 	return subStreamID >= 0xA0 && subStreamID <= 0xA7
 }
+
+// Blu-ray LPCM (HDMV, stream type 0x80) PES payloads start with a 4-byte header:
+//
+//	Bytes 0-1: audio_data_payload_size
+//	Byte 2:    channel_assignment(4) | sampling_frequency(4)
+//	Byte 3:    bits_per_sample(2) | start_flag(1) | reserved(5)
+//	Bytes 4+:  PCM samples (big-endian, one sample per channel per frame)
+//
+// Unlike DVD, samples are not grouped, so 24-bit samples are plain 3-byte
+// big-endian values and the transform to MKV's little-endian layout is a
+// per-sample byte reversal.
+
+// BDLPCMHeaderSize is the size of the Blu-ray LPCM header at the start of
+// each PES payload.
+const BDLPCMHeaderSize = 4
+
+// BDLPCMHeader represents a parsed Blu-ray LPCM header.
+type BDLPCMHeader struct {
+	ChannelAssignment byte // 4 bits: 1=mono, 3=stereo, ..., 9=5.1, 11=7.1
+	SampleRate        byte // 4 bits: 1=48kHz, 4=96kHz, 5=192kHz
+	BitsPerSample     byte // 2 bits: 1=16-bit, 2=20-bit, 3=24-bit
+}
+
+// bdLPCMChannels maps a Blu-ray LPCM channel assignment to its channel count.
+var bdLPCMChannels = [16]int{1: 1, 3: 2, 4: 3, 5: 3, 6: 4, 7: 4, 8: 5, 9: 6, 10: 7, 11: 8}
+
+// ParseBDLPCMHeader parses a 4-byte Blu-ray LPCM header.
+func ParseBDLPCMHeader(data []byte) BDLPCMHeader {
+	if len(data) < BDLPCMHeaderSize {
+		return BDLPCMHeader{}
+	}
+	return BDLPCMHeader{
+		ChannelAssignment: data[2] >> 4,
+		SampleRate:        data[2] & 0x0F,
+		BitsPerSample:     data[3] >> 6,
+	}
+}
+
+// SampleSize returns the size in bytes of one sample that is byte-swapped to
+// match MKV: 2 for 16-bit and 3 for 24-bit audio. It returns 0 for layouts
+// that cannot be matched: 20-bit audio, and odd channel counts, which Blu-ray
+// pads with a silent channel that MKV does not store.
+func (h BDLPCMHeader) SampleSize() int {
+	channels := bdLPCMChannels[h.ChannelAssignment]
+	if channels == 0 || channels%2 == 1 {
+		return 0
+	}
+	switch h.BitsPerSample {
+	case 1:
+		return 2
+	case 3:
+		return 3
+	}
+	return 0
+}
+
+// TransformLPCM24BE performs an in-place byte reversal of 24-bit big-endian
+// PCM samples, converting to little-endian. Trailing bytes that do not form a
+// whole sample are left unchanged.
+func TransformLPCM24BE(data []byte) {
+	n := len(data) - len(data)%3
+	for i := 0; i < n; i += 3 {
+		data[i], data[i+2] = data[i+2], data[i]
+	}
+}
+
+// TransformLPCM byte-swaps big-endian PCM samples of the given size (2 or 3
+// bytes) in place. The transform is its own inverse.
+func TransformLPCM(data []byte, sampleSize int) {
+	if sampleSize == 3 {
+		TransformLPCM24BE(data)
+	} else {
+		TransformLPCM16BE(data)
+	}
+}
+
+// lpcmSwappedOffset returns the ES offset holding the byte that lands at
+// esOffset once the sample containing it is byte-swapped.
+func lpcmSwappedOffset(esOffset int64, sampleSize int) int64 {
+	pos := esOffset % int64(sampleSize)
+	return esOffset - pos + int64(sampleSize) - 1 - pos
+}
+
+// readLPCMFromRanges reads size bytes of an LPCM sub-stream and byte-swaps
+// its samples to little-endian. Samples are aligned to the ES start, so when
+// esOffset or the end of the read falls inside a sample, the whole sample is
+// read, swapped and trimmed to the requested range.
+func readLPCMFromRanges(data []byte, mr *multiRegionData, dataSize int64, ranges []PESPayloadRange, esOffset int64, size, sampleSize int) ([]byte, error) {
+	trimFront := int(esOffset % int64(sampleSize))
+	alignedOffset := esOffset - int64(trimFront)
+	alignedSize := size + trimFront
+	// Extend to complete the trailing sample (if data is available).
+	trimBack := 0
+	if rem := alignedSize % sampleSize; rem != 0 {
+		trimBack = sampleSize - rem
+		alignedSize += trimBack
+	}
+
+	raw, err := readFromRanges(data, mr, dataSize, ranges, alignedOffset, alignedSize)
+	if err != nil {
+		// If extending caused an out-of-range error, retry without the trailing extension
+		if trimBack == 0 {
+			return nil, err
+		}
+		raw, err = readFromRanges(data, mr, dataSize, ranges, alignedOffset, alignedSize-trimBack)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// readFromRanges may return a zero-copy mmap slice, so clone first
+	result := make([]byte, len(raw))
+	copy(result, raw)
+	TransformLPCM(result, sampleSize)
+
+	// Trim to the originally requested range
+	end := trimFront + size
+	if end > len(result) {
+		end = len(result)
+	}
+	if trimFront > end {
+		return nil, fmt.Errorf("LPCM read at ES offset %d out of range", esOffset)
+	}
+	return result[trimFront:end], nil
+}
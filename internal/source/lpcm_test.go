@@ -299,3 +299,92 @@ func TestLPCMAlignedSubRead(t *testing.T) {
 		})
 	}
 }
+
+func TestBDLPCMHeaderSampleSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   int
+	}{
+		{"stereo 16-bit", []byte{0x03, 0xC0, 0x31, 0x40}, 2},
+		{"stereo 24-bit", []byte{0x05, 0xA0, 0x31, 0xC0}, 3},
+		{"5.1 24-bit 96kHz", []byte{0x0D, 0x80, 0x94, 0xC0}, 3},
+		{"stereo 20-bit", []byte{0x05, 0xA0, 0x31, 0x80}, 0},
+		{"mono 16-bit (padded)", []byte{0x01, 0xE0, 0x11, 0x40}, 0},
+		{"5.0 16-bit (padded)", []byte{0x05, 0xA0, 0x81, 0x40}, 0},
+		{"reserved channel assignment", []byte{0x03, 0xC0, 0x21, 0x40}, 0},
+		{"short header", []byte{0x03, 0xC0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseBDLPCMHeader(tt.header).SampleSize(); got != tt.want {
+				t.Errorf("SampleSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	h := ParseBDLPCMHeader([]byte{0x0D, 0x80, 0x94, 0xC0})
+	if h.ChannelAssignment != 9 || h.SampleRate != 4 || h.BitsPerSample != 3 {
+		t.Errorf("ParseBDLPCMHeader() = %+v, want channels 9, rate 4, bits 3", h)
+	}
+}
+
+func TestTransformLPCM24BE(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	TransformLPCM24BE(data)
+	want := []byte{0x03, 0x02, 0x01, 0x06, 0x05, 0x04, 0x07, 0x08}
+	if !bytes.Equal(data, want) {
+		t.Errorf("TransformLPCM24BE = %x, want %x", data, want)
+	}
+	TransformLPCM(data, 3)
+	if !bytes.Equal(data, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}) {
+		t.Errorf("TransformLPCM(3) is not its own inverse: %x", data)
+	}
+}
+
+func TestLPCMSwappedOffset(t *testing.T) {
+	tests := []struct {
+		esOffset   int64
+		sampleSize int
+		want       int64
+	}{
+		{0, 2, 1}, {1, 2, 0}, {6, 2, 7},
+		{0, 3, 2}, {1, 3, 1}, {2, 3, 0}, {4, 3, 4}, {5, 3, 3},
+	}
+	for _, tt := range tests {
+		if got := lpcmSwappedOffset(tt.esOffset, tt.sampleSize); got != tt.want {
+			t.Errorf("lpcmSwappedOffset(%d, %d) = %d, want %d", tt.esOffset, tt.sampleSize, got, tt.want)
+		}
+	}
+}
+
+func TestReadLPCMFromRanges24(t *testing.T) {
+	// Two PES payloads whose boundary splits a sample: ES [0,7) and [7,15)
+	// sit at file offsets 10 and 30.
+	data := make([]byte, 40)
+	es := seqBytes(0x40, 15)
+	copy(data[10:], es[:7])
+	copy(data[30:], es[7:])
+	ranges := []PESPayloadRange{
+		{FileOffset: 10, Size: 7, ESOffset: 0},
+		{FileOffset: 30, Size: 8, ESOffset: 7},
+	}
+	swapped := append([]byte(nil), es...)
+	TransformLPCM24BE(swapped)
+
+	for offset := 0; offset < len(es); offset++ {
+		for size := 1; offset+size <= len(es); size++ {
+			got, err := readLPCMFromRanges(data, nil, int64(len(data)), ranges, int64(offset), size, 3)
+			if err != nil {
+				t.Fatalf("readLPCMFromRanges(%d, %d) error = %v", offset, size, err)
+			}
+			if !bytes.Equal(got, swapped[offset:offset+size]) {
+				t.Errorf("readLPCMFromRanges(%d, %d) = %x, want %x", offset, size, got, swapped[offset:offset+size])
+			}
+		}
+	}
+	// The source must not be modified
+	if !bytes.Equal(data[10:17], es[:7]) {
+		t.Error("readLPCMFromRanges modified the source data")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build darwin
+
+package source
+
+import "golang.org/x/sys/unix"
+
+// physicalMemory returns the total physical memory in bytes, or 0 if it
+// can't be determined.
+func physicalMemory() uint64 {
+	n, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return 0
+	}
+	return n
+}
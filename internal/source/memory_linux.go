@@ -0,0 +1,15 @@
+//go:build linux
+
+package source
+
+import "golang.org/x/sys/unix"
+
+// physicalMemory returns the total physical memory in bytes, or 0 if it
+// can't be determined.
+func physicalMemory() uint64 {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return uint64(info.Totalram) * uint64(info.Unit)
+}
@@ -0,0 +1,77 @@
+package source
+
+import (
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// detectMKVCodecs extracts codec information from an already-indexed MKV
+// source, using the track codec IDs read by each file's parser.
+func detectMKVCodecs(index *Index) (*SourceCodecs, error) {
+	codecs := &SourceCodecs{}
+	for _, esReader := range index.ESReaders {
+		parser, ok := esReader.(*MKVSourceParser)
+		if !ok {
+			continue
+		}
+		if ct := parser.VideoCodec(); ct != CodecUnknown && parser.TotalESSize(true) > 0 {
+			addSourceCodec(codecs, mkv.TrackTypeVideo, ct)
+		}
+		for _, id := range parser.AudioSubStreams() {
+			addSourceCodec(codecs, parser.SubStreamTrackType(id), parser.SubStreamCodec(id))
+		}
+	}
+	return codecs, nil
+}
+
+// detectMKVCodecsFromFiles reads the track headers of each file and unions
+// their codecs. Files that cannot be parsed are skipped; returns an error only
+// if none could be.
+func detectMKVCodecsFromFiles(paths []string) (*SourceCodecs, error) {
+	codecs := &SourceCodecs{}
+	var lastErr error
+	anySuccess := false
+	for _, path := range paths {
+		parser, err := mkv.NewParser(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		err = parser.ParseTracksOnly()
+		if err == nil {
+			for _, t := range parser.Tracks() {
+				addSourceCodec(codecs, t.Type, MKVTrackCodecType(t.CodecID, t.CodecPrivate))
+			}
+			anySuccess = true
+		} else {
+			lastErr = fmt.Errorf("parse MKV %s: %w", path, err)
+		}
+		parser.Close()
+	}
+	if !anySuccess {
+		return nil, fmt.Errorf("failed to scan any MKV codecs: %w", lastErr)
+	}
+	return codecs, nil
+}
+
+// addSourceCodec adds a known codec to the list for its MKV track type.
+func addSourceCodec(codecs *SourceCodecs, trackType int, ct CodecType) {
+	if ct == CodecUnknown {
+		return
+	}
+	var list *[]CodecType
+	switch trackType {
+	case mkv.TrackTypeVideo:
+		list = &codecs.VideoCodecs
+	case mkv.TrackTypeAudio:
+		list = &codecs.AudioCodecs
+	case mkv.TrackTypeSubtitle:
+		list = &codecs.SubtitleCodecs
+	default:
+		return
+	}
+	if !containsCodec(*list, ct) {
+		*list = append(*list, ct)
+	}
+}
@@ -0,0 +1,146 @@
+package source
+
+import (
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// MKVSourceParser exposes the codec packets of an existing MKV file as
+// elementary streams, so that a second MKV remuxed from the same disc (a
+// different track selection, or a newer MakeMKV) can reference the first one.
+// Each track's packets, in file order, form a continuous ES; the packet
+// payloads are byte-identical between remuxes, only the EBML framing differs.
+//
+// The first video track is the video ES. Every other track (audio and
+// subtitles) becomes a sub-stream 0, 1, 2, ... in track order.
+type MKVSourceParser struct {
+	sampleES
+
+	// subStreamTrackType is the MKV track type (audio, subtitle) of each
+	// sub-stream, which decides how the indexer finds its sync points.
+	subStreamTrackType map[byte]int
+	pcmSubStreams      map[byte]bool
+}
+
+// NewMKVSourceParser creates a parser for the given memory-mapped MKV data.
+func NewMKVSourceParser(data []byte) *MKVSourceParser {
+	return &MKVSourceParser{
+		sampleES:           newSampleES(data),
+		subStreamTrackType: make(map[byte]int),
+		pcmSubStreams:      make(map[byte]bool),
+	}
+}
+
+// mkvTrackES accumulates the ES ranges and packet sizes of one track.
+type mkvTrackES struct {
+	ranges   []PESPayloadRange
+	sizes    []uint32
+	esOffset int64
+}
+
+// Parse walks the MKV clusters and builds the ES ranges of every track.
+// If progress is non-nil, it is called periodically with the bytes parsed.
+func (p *MKVSourceParser) Parse(progress func(processed, total int64)) error {
+	parser := mkv.NewParserFromData(p.data)
+	if err := parser.Parse(progress); err != nil {
+		return fmt.Errorf("parse MKV: %w", err)
+	}
+
+	streams := make(map[uint64]*mkvTrackES)
+	for _, pkt := range parser.Packets() {
+		if pkt.Size <= 0 || pkt.Offset+pkt.Size > p.size {
+			continue
+		}
+		es := streams[pkt.TrackNum]
+		if es == nil {
+			es = &mkvTrackES{}
+			streams[pkt.TrackNum] = es
+		}
+		if n := len(es.ranges); n > 0 && es.ranges[n-1].FileOffset+int64(es.ranges[n-1].Size) == pkt.Offset {
+			es.ranges[n-1].Size += int(pkt.Size)
+		} else {
+			es.ranges = append(es.ranges, PESPayloadRange{FileOffset: pkt.Offset, Size: int(pkt.Size), ESOffset: es.esOffset})
+		}
+		es.sizes = append(es.sizes, uint32(pkt.Size))
+		es.esOffset += pkt.Size
+	}
+
+	haveVideo := false
+	for _, t := range parser.Tracks() {
+		es := streams[t.Number]
+		if es == nil {
+			continue
+		}
+		if t.Type == mkv.TrackTypeVideo && !haveVideo {
+			haveVideo = true
+			p.videoCodec = MKVTrackCodecType(t.CodecID, t.CodecPrivate)
+			p.nalLengthSize = MKVNALLengthSize(t.CodecID, t.CodecPrivate)
+			p.videoRanges = es.ranges
+			p.videoSampleSizes = es.sizes
+			continue
+		}
+		if t.Type != mkv.TrackTypeAudio && t.Type != mkv.TrackTypeSubtitle {
+			continue
+		}
+		id, ok := p.addSubStream(es.ranges, es.sizes, MKVCodecToType(t.CodecID))
+		if !ok {
+			continue
+		}
+		p.subStreamTrackType[id] = t.Type
+		p.pcmSubStreams[id] = MKVCodecToType(t.CodecID) == CodecLPCMAudio
+	}
+
+	if !haveVideo && len(p.audioSubStreams) == 0 {
+		return fmt.Errorf("no video, audio or subtitle packets found")
+	}
+	return nil
+}
+
+// MKVNALLengthSize determines the NAL unit length field size from an MKV
+// track's codec ID and codec private data. Returns 0 for Annex B (start code)
+// formats, or the length field size (1, 2, or 4) for AVCC/HVCC formats.
+func MKVNALLengthSize(codecID string, codecPrivate []byte) int {
+	switch codecID {
+	case "V_MPEG4/ISO/AVC":
+		// AVCC format: CodecPrivate is AVCDecoderConfigurationRecord
+		// Byte 4 bits 0-1 = NAL length size - 1
+		if len(codecPrivate) >= 7 && codecPrivate[0] == 1 {
+			return int(codecPrivate[4]&0x03) + 1
+		}
+		return 4 // Default for AVC if CodecPrivate is missing or malformed
+	case "V_MPEGH/ISO/HEVC":
+		// HVCC format: CodecPrivate is HEVCDecoderConfigurationRecord
+		// Byte 0 = configurationVersion (must be 1)
+		// Byte 21 bits 6-7 = reserved (must be 111111)
+		// Byte 21 bits 0-1 = NAL length size - 1
+		if len(codecPrivate) >= 23 && codecPrivate[0] == 1 {
+			b := codecPrivate[21]
+			// Upper 6 bits must be all 1s per ISO/IEC 23008-2
+			if b&0xFC == 0xFC {
+				size := int(b&0x03) + 1
+				// Valid NAL length sizes are 1, 2, or 4 bytes
+				if size == 1 || size == 2 || size == 4 {
+					return size
+				}
+			}
+		}
+		return 4 // Default for HEVC if CodecPrivate is missing or malformed
+	default:
+		return 0 // Annex B format (MPEG-2, etc.)
+	}
+}
+
+// SubStreamTrackType returns the MKV track type (mkv.TrackTypeAudio or
+// mkv.TrackTypeSubtitle) of a sub-stream.
+func (p *MKVSourceParser) SubStreamTrackType(subStreamID byte) int {
+	return p.subStreamTrackType[subStreamID]
+}
+
+// Ensure MKVSourceParser implements the required interfaces at compile time.
+var (
+	_ ESReader         = (*MKVSourceParser)(nil)
+	_ ESRangeConverter = (*MKVSourceParser)(nil)
+	_ PESRangeProvider = (*MKVSourceParser)(nil)
+	_ esDataProvider   = (*MKVSourceParser)(nil)
+)
@@ -0,0 +1,237 @@
+package source
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// mkvTestElement builds an EBML element with an 8-byte size field.
+func mkvTestElement(id uint32, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if v := byte(id >> shift); v != 0 || len(b) > 0 {
+			b = append(b, v)
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01
+	return append(append(b, size...), body...)
+}
+
+type mkvTestTrack struct {
+	number       byte
+	trackType    byte
+	codecID      string
+	codecPrivate []byte
+}
+
+type mkvTestBlock struct {
+	track byte
+	data  []byte
+}
+
+// buildTestMKV builds an MKV file with the given tracks, putting
+// blocksPerCluster SimpleBlocks in each cluster. Different cluster sizes
+// give files whose packets are identical but sit at different offsets.
+func buildTestMKV(tracks []mkvTestTrack, blocks []mkvTestBlock, blocksPerCluster int) []byte {
+	var entries [][]byte
+	for _, t := range tracks {
+		entry := [][]byte{
+			mkvTestElement(0xD7, []byte{t.number}),
+			mkvTestElement(0x83, []byte{t.trackType}),
+			mkvTestElement(0x86, []byte(t.codecID)),
+		}
+		if t.codecPrivate != nil {
+			entry = append(entry, mkvTestElement(0x63A2, t.codecPrivate))
+		}
+		entries = append(entries, mkvTestElement(0xAE, entry...))
+	}
+	segment := [][]byte{mkvTestElement(0x1654AE6B, entries...)}
+	for i := 0; i < len(blocks); i += blocksPerCluster {
+		cluster := [][]byte{mkvTestElement(0xE7, []byte{0})}
+		for _, blk := range blocks[i:min(i+blocksPerCluster, len(blocks))] {
+			cluster = append(cluster, mkvTestElement(0xA3, []byte{0x80 | blk.track, 0, 0, 0x80}, blk.data))
+		}
+		segment = append(segment, mkvTestElement(0x1F43B675, cluster...))
+	}
+	return append(mkvTestElement(0x1A45DFA3, mkvTestElement(0x4282, []byte("matroska"))),
+		mkvTestElement(0x18538067, segment...)...)
+}
+
+// mkvTestAVCPrivate is an AVCDecoderConfigurationRecord with 2-byte NAL lengths.
+var mkvTestAVCPrivate = []byte{1, 0x64, 0, 0x28, 0xFD, 0xE1, 0}
+
+// testMKVBlocks returns interleaved video (2-byte AVCC NAL lengths) and AC3
+// audio blocks.
+func testMKVBlocks() []mkvTestBlock {
+	var blocks []mkvTestBlock
+	for i := 0; i < 4; i++ {
+		nal := append([]byte{0x65}, seqBytes(i*7, 100)...)
+		video := append([]byte{0, byte(len(nal))}, nal...)
+		audio := append([]byte{0x0B, 0x77}, seqBytes(i*13+100, 80)...)
+		blocks = append(blocks, mkvTestBlock{1, video}, mkvTestBlock{2, audio})
+	}
+	return blocks
+}
+
+var testMKVTracks = []mkvTestTrack{
+	{1, mkv.TrackTypeVideo, "V_MPEG4/ISO/AVC", mkvTestAVCPrivate},
+	{2, mkv.TrackTypeAudio, "A_AC3", nil},
+}
+
+func TestMKVSourceParser_Parse(t *testing.T) {
+	blocks := testMKVBlocks()
+	p := NewMKVSourceParser(buildTestMKV(testMKVTracks, blocks, 3))
+	if err := p.Parse(nil); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var video, audio []byte
+	for _, b := range blocks {
+		if b.track == 1 {
+			video = append(video, b.data...)
+		} else {
+			audio = append(audio, b.data...)
+		}
+	}
+	if p.VideoCodec() != CodecH264Video || p.NALLengthSize() != 2 {
+		t.Errorf("video codec = %v, NAL length size = %d, want H.264, 2", p.VideoCodec(), p.NALLengthSize())
+	}
+	if !reflect.DeepEqual(p.AudioSubStreams(), []byte{0}) || p.SubStreamCodec(0) != CodecAC3Audio ||
+		p.SubStreamTrackType(0) != mkv.TrackTypeAudio {
+		t.Fatalf("sub-streams = %v (codec %v), want [0] AC3 audio", p.AudioSubStreams(), p.SubStreamCodec(0))
+	}
+
+	got, err := p.ReadESData(0, len(video), true)
+	if err != nil || !bytes.Equal(got, video) {
+		t.Errorf("video ES = %x (err %v), want the concatenated video packets", got, err)
+	}
+	got, err = p.ReadAudioSubStreamData(0, 0, len(audio))
+	if err != nil || !bytes.Equal(got, audio) {
+		t.Errorf("audio ES = %x (err %v), want the concatenated audio packets", got, err)
+	}
+	if len(p.videoSampleSizes) != 4 || p.videoSampleSizes[0] != uint32(len(blocks[0].data)) {
+		t.Errorf("video sample sizes = %v, want 4 packets of %d bytes", p.videoSampleSizes, len(blocks[0].data))
+	}
+}
+
+func TestMKVSourceParser_NoPackets(t *testing.T) {
+	p := NewMKVSourceParser(buildTestMKV(testMKVTracks, nil, 1))
+	if err := p.Parse(nil); err == nil {
+		t.Error("expected error for MKV without packets")
+	}
+}
+
+func TestMKVNALLengthSize(t *testing.T) {
+	tests := []struct {
+		codecID string
+		private []byte
+		want    int
+	}{
+		{"V_MPEG4/ISO/AVC", mkvTestAVCPrivate, 2},
+		{"V_MPEG4/ISO/AVC", nil, 4},
+		{"V_MPEG2", nil, 0},
+	}
+	for _, tt := range tests {
+		if got := MKVNALLengthSize(tt.codecID, tt.private); got != tt.want {
+			t.Errorf("MKVNALLengthSize(%q, %x) = %d, want %d", tt.codecID, tt.private, got, tt.want)
+		}
+	}
+}
+
+func TestDetectType_MKV(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "movie.mkv"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sourceType, err := DetectType(tmpDir)
+	if err != nil {
+		t.Fatalf("DetectType() error = %v", err)
+	}
+	if sourceType != TypeMKV {
+		t.Errorf("DetectType() = %v, want %v", sourceType, TypeMKV)
+	}
+
+	// Disc content wins over a stray MKV
+	if err := os.WriteFile(filepath.Join(tmpDir, "recording.ts"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sourceType, _ := DetectType(tmpDir); sourceType != TypeMPEGTS {
+		t.Errorf("DetectType() with .ts present = %v, want %v", sourceType, TypeMPEGTS)
+	}
+}
+
+func TestEnumerateMediaFiles_MKV(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "extras"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"movie.mkv", "notes.txt", filepath.Join("extras", "BONUS.MKV")} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := EnumerateMediaFiles(tmpDir, TypeMKV)
+	if err != nil {
+		t.Fatalf("EnumerateMediaFiles() error = %v", err)
+	}
+	want := []string{"movie.mkv", filepath.Join("extras", "BONUS.MKV")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("EnumerateMediaFiles() = %v, want %v", files, want)
+	}
+}
+
+func TestIndexMKVFile(t *testing.T) {
+	blocks := testMKVBlocks()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.mkv"), buildTestMKV(testMKVTracks, blocks, 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatal(err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if !index.UsesESOffsets {
+		t.Error("expected UsesESOffsets=true")
+	}
+	if _, ok := index.ESReaders[0].(*MKVSourceParser); !ok {
+		t.Fatalf("ESReaders[0] is %T, want *MKVSourceParser", index.ESReaders[0])
+	}
+
+	// A remux with a different cluster layout carries the same packets; the
+	// matcher hashes them at the NAL header (video) and the AC3 sync word.
+	videoSize := int64(len(blocks[0].data))
+	locs := index.HashToLocations[xxhash.Sum64(blocks[2].data[2:2+MinWindowSize])]
+	if len(locs) != 1 || !locs[0].IsVideo || locs[0].Offset != videoSize+2 {
+		t.Errorf("locations for video packet 1 = %+v, want one at ES offset %d", locs, videoSize+2)
+	}
+	audioSize := int64(len(blocks[1].data))
+	locs = index.HashToLocations[xxhash.Sum64(blocks[3].data[:MinWindowSize])]
+	if len(locs) != 1 || locs[0].IsVideo || locs[0].AudioSubStreamID != 0 || locs[0].Offset != audioSize {
+		t.Errorf("locations for audio packet 1 = %+v, want one at ES offset %d", locs, audioSize)
+	}
+
+	codecs, err := DetectSourceCodecsFromDir(dir)
+	if err != nil {
+		t.Fatalf("DetectSourceCodecsFromDir() error = %v", err)
+	}
+	if !reflect.DeepEqual(codecs.VideoCodecs, []CodecType{CodecH264Video}) || !reflect.DeepEqual(codecs.AudioCodecs, []CodecType{CodecAC3Audio}) {
+		t.Errorf("DetectSourceCodecsFromDir() = %+v, want H.264 + AC3", codecs)
+	}
+}
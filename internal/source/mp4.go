@@ -0,0 +1,527 @@
+package source
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MP4Parser parses ISO base media files (MP4, MOV, M4V) to extract elementary
+// stream data. Unlike MPEG-PS and MPEG-TS there are no packet headers to strip:
+// the sample table in the moov box (stbl) lists where every sample (frame)
+// lives inside mdat. The parser turns each track's samples, in decode order,
+// into a continuous ES described by PESPayloadRange entries, which is exactly
+// what MKV blocks carry after a remux.
+//
+// The first video track is the video ES. Audio tracks become sub-streams
+// 0, 1, 2, ... in the order they appear in the moov box. Other tracks (text,
+// chapters, timecodes) are ignored. Fragmented MP4 (moof) is not supported.
+type MP4Parser struct {
+	sampleES
+}
+
+// NewMP4Parser creates a parser for the given memory-mapped MP4 data.
+func NewMP4Parser(data []byte) *MP4Parser {
+	return &MP4Parser{sampleES: newSampleES(data)}
+}
+
+// mp4Box is one box (atom) header: its type and the byte range of its payload.
+type mp4Box struct {
+	typ          string
+	payloadStart int64
+	end          int64
+}
+
+// readMP4Boxes returns the boxes found between start and end. A box size of 1
+// means a 64-bit size follows the type; a size of 0 extends the box to end.
+func readMP4Boxes(data []byte, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	pos := start
+	for pos+8 <= end {
+		size := int64(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if pos+16 > end {
+				return nil, fmt.Errorf("truncated 64-bit size for box %q at offset %d", typ, pos)
+			}
+			size = int64(binary.BigEndian.Uint64(data[pos+8:]))
+			headerSize = 16
+		}
+		if size < headerSize || pos+size > end {
+			return nil, fmt.Errorf("invalid size %d for box %q at offset %d", size, typ, pos)
+		}
+		boxes = append(boxes, mp4Box{typ: typ, payloadStart: pos + headerSize, end: pos + size})
+		pos += size
+	}
+	return boxes, nil
+}
+
+// findMP4Box returns the first child box of the given type, or false.
+func findMP4Box(boxes []mp4Box, typ string) (mp4Box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// mp4StscEntry is one sample-to-chunk table entry.
+type mp4StscEntry struct {
+	firstChunk      uint32 // 1-based
+	samplesPerChunk uint32
+}
+
+// mp4Track holds the parts of a trak box needed to locate its samples.
+type mp4Track struct {
+	handler       string // "vide", "soun", ...
+	codec         CodecType
+	nalLengthSize int
+
+	constantSampleSize uint32 // non-zero when all samples have this size
+	sampleCount        uint32
+	sampleSizes        []uint32
+	chunkOffsets       []int64
+	stsc               []mp4StscEntry
+}
+
+// Parse reads the moov box and builds the ES ranges of every video and audio
+// track.
+func (p *MP4Parser) Parse() error {
+	top, err := readMP4Boxes(p.data, 0, p.size)
+	if err != nil {
+		return fmt.Errorf("read top-level boxes: %w", err)
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return fmt.Errorf("no moov box found")
+	}
+
+	moovBoxes, err := readMP4Boxes(p.data, moov.payloadStart, moov.end)
+	if err != nil {
+		return fmt.Errorf("read moov: %w", err)
+	}
+
+	haveVideo := false
+	for _, b := range moovBoxes {
+		if b.typ != "trak" {
+			continue
+		}
+		track, err := p.parseTrack(b)
+		if err != nil {
+			return fmt.Errorf("parse track: %w", err)
+		}
+		if track == nil {
+			continue
+		}
+		switch track.handler {
+		case "vide":
+			if haveVideo {
+				continue
+			}
+			ranges, sizes, err := track.buildRanges(p.size)
+			if err != nil {
+				return fmt.Errorf("video track: %w", err)
+			}
+			if len(ranges) == 0 {
+				continue
+			}
+			haveVideo = true
+			p.videoCodec = track.codec
+			p.nalLengthSize = track.nalLengthSize
+			p.videoRanges = ranges
+			p.videoSampleSizes = sizes
+		case "soun":
+			ranges, sizes, err := track.buildRanges(p.size)
+			if err != nil {
+				return fmt.Errorf("audio track: %w", err)
+			}
+			if len(ranges) == 0 {
+				continue
+			}
+			p.addSubStream(ranges, sizes, track.codec)
+		}
+	}
+
+	if !haveVideo && len(p.audioSubStreams) == 0 {
+		if _, fragmented := findMP4Box(top, "moof"); fragmented {
+			return fmt.Errorf("fragmented MP4 (moof) is not supported")
+		}
+		return fmt.Errorf("no video or audio samples found")
+	}
+	return nil
+}
+
+// parseTrack reads the handler, codec and sample tables of a trak box.
+// Returns nil for tracks without a sample table.
+func (p *MP4Parser) parseTrack(trak mp4Box) (*mp4Track, error) {
+	trakBoxes, err := readMP4Boxes(p.data, trak.payloadStart, trak.end)
+	if err != nil {
+		return nil, err
+	}
+	mdia, ok := findMP4Box(trakBoxes, "mdia")
+	if !ok {
+		return nil, nil
+	}
+	mdiaBoxes, err := readMP4Boxes(p.data, mdia.payloadStart, mdia.end)
+	if err != nil {
+		return nil, err
+	}
+	track := &mp4Track{}
+	if hdlr, ok := findMP4Box(mdiaBoxes, "hdlr"); ok && hdlr.end-hdlr.payloadStart >= 12 {
+		// version/flags(4) + pre_defined(4) + handler_type(4)
+		track.handler = string(p.data[hdlr.payloadStart+8 : hdlr.payloadStart+12])
+	}
+	if track.handler != "vide" && track.handler != "soun" {
+		return nil, nil
+	}
+	minf, ok := findMP4Box(mdiaBoxes, "minf")
+	if !ok {
+		return nil, nil
+	}
+	minfBoxes, err := readMP4Boxes(p.data, minf.payloadStart, minf.end)
+	if err != nil {
+		return nil, err
+	}
+	stbl, ok := findMP4Box(minfBoxes, "stbl")
+	if !ok {
+		return nil, nil
+	}
+	stblBoxes, err := readMP4Boxes(p.data, stbl.payloadStart, stbl.end)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range stblBoxes {
+		payload := p.data[b.payloadStart:b.end]
+		switch b.typ {
+		case "stsd":
+			track.codec, track.nalLengthSize = parseMP4SampleDescription(payload, track.handler)
+		case "stsz":
+			err = track.parseStsz(payload)
+		case "stz2":
+			err = track.parseStz2(payload)
+		case "stsc":
+			err = track.parseStsc(payload)
+		case "stco":
+			err = track.parseChunkOffsets(payload, 4)
+		case "co64":
+			err = track.parseChunkOffsets(payload, 8)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b.typ, err)
+		}
+	}
+	return track, nil
+}
+
+// parseStsz reads a sample size box.
+func (t *mp4Track) parseStsz(payload []byte) error {
+	if len(payload) < 12 {
+		return fmt.Errorf("box too short")
+	}
+	t.constantSampleSize = binary.BigEndian.Uint32(payload[4:])
+	t.sampleCount = binary.BigEndian.Uint32(payload[8:])
+	if t.constantSampleSize != 0 {
+		return nil
+	}
+	if int64(len(payload)-12) < int64(t.sampleCount)*4 {
+		return fmt.Errorf("%d entries do not fit", t.sampleCount)
+	}
+	t.sampleSizes = make([]uint32, t.sampleCount)
+	for i := range t.sampleSizes {
+		t.sampleSizes[i] = binary.BigEndian.Uint32(payload[12+4*i:])
+	}
+	return nil
+}
+
+// parseStz2 reads a compact sample size box (4-, 8- or 16-bit entries).
+func (t *mp4Track) parseStz2(payload []byte) error {
+	if len(payload) < 12 {
+		return fmt.Errorf("box too short")
+	}
+	fieldSize := int(payload[7])
+	t.sampleCount = binary.BigEndian.Uint32(payload[8:])
+	if fieldSize != 4 && fieldSize != 8 && fieldSize != 16 {
+		return fmt.Errorf("invalid field size %d", fieldSize)
+	}
+	if int64(len(payload)-12)*8 < int64(t.sampleCount)*int64(fieldSize) {
+		return fmt.Errorf("%d entries do not fit", t.sampleCount)
+	}
+	entries := payload[12:]
+	t.sampleSizes = make([]uint32, t.sampleCount)
+	for i := range t.sampleSizes {
+		switch fieldSize {
+		case 4:
+			b := entries[i/2]
+			if i%2 == 0 {
+				t.sampleSizes[i] = uint32(b >> 4)
+			} else {
+				t.sampleSizes[i] = uint32(b & 0x0F)
+			}
+		case 8:
+			t.sampleSizes[i] = uint32(entries[i])
+		case 16:
+			t.sampleSizes[i] = uint32(binary.BigEndian.Uint16(entries[2*i:]))
+		}
+	}
+	return nil
+}
+
+// parseStsc reads a sample-to-chunk box.
+func (t *mp4Track) parseStsc(payload []byte) error {
+	if len(payload) < 8 {
+		return fmt.Errorf("box too short")
+	}
+	count := binary.BigEndian.Uint32(payload[4:])
+	if int64(len(payload)-8) < int64(count)*12 {
+		return fmt.Errorf("%d entries do not fit", count)
+	}
+	t.stsc = make([]mp4StscEntry, count)
+	for i := range t.stsc {
+		e := payload[8+12*i:]
+		t.stsc[i] = mp4StscEntry{
+			firstChunk:      binary.BigEndian.Uint32(e),
+			samplesPerChunk: binary.BigEndian.Uint32(e[4:]),
+		}
+	}
+	return nil
+}
+
+// parseChunkOffsets reads a stco (32-bit) or co64 (64-bit) chunk offset box.
+func (t *mp4Track) parseChunkOffsets(payload []byte, entrySize int) error {
+	if len(payload) < 8 {
+		return fmt.Errorf("box too short")
+	}
+	count := binary.BigEndian.Uint32(payload[4:])
+	if int64(len(payload)-8) < int64(count)*int64(entrySize) {
+		return fmt.Errorf("%d entries do not fit", count)
+	}
+	t.chunkOffsets = make([]int64, count)
+	for i := range t.chunkOffsets {
+		if entrySize == 8 {
+			t.chunkOffsets[i] = int64(binary.BigEndian.Uint64(payload[8+8*i:]))
+		} else {
+			t.chunkOffsets[i] = int64(binary.BigEndian.Uint32(payload[8+4*i:]))
+		}
+	}
+	return nil
+}
+
+// sampleSize returns the size of sample i.
+func (t *mp4Track) sampleSize(i uint32) uint32 {
+	if t.constantSampleSize != 0 {
+		return t.constantSampleSize
+	}
+	return t.sampleSizes[i]
+}
+
+// buildRanges walks the sample tables and returns the track's ES ranges
+// (samples in decode order, adjacent samples merged) and the size of every
+// non-empty sample. Sizes are not returned for tracks with a constant sample
+// size (typically PCM, where a "sample" is a single audio frame of a few
+// bytes and sample boundaries are not useful sync points).
+func (t *mp4Track) buildRanges(fileSize int64) ([]PESPayloadRange, []uint32, error) {
+	var ranges []PESPayloadRange
+	var sizes []uint32
+	if t.constantSampleSize == 0 {
+		sizes = make([]uint32, 0, t.sampleCount)
+	}
+	var esOffset int64
+	var sample uint32
+
+	for i, e := range t.stsc {
+		if e.firstChunk == 0 || int64(e.firstChunk) > int64(len(t.chunkOffsets)) {
+			return nil, nil, fmt.Errorf("sample-to-chunk entry %d references chunk %d of %d", i, e.firstChunk, len(t.chunkOffsets))
+		}
+		lastChunk := uint32(len(t.chunkOffsets))
+		if i+1 < len(t.stsc) && t.stsc[i+1].firstChunk > e.firstChunk {
+			lastChunk = t.stsc[i+1].firstChunk - 1
+		}
+		for chunk := e.firstChunk; chunk <= lastChunk && chunk <= uint32(len(t.chunkOffsets)); chunk++ {
+			offset := t.chunkOffsets[chunk-1]
+			for s := uint32(0); s < e.samplesPerChunk && sample < t.sampleCount; s++ {
+				size := t.sampleSize(sample)
+				sample++
+				if size == 0 {
+					continue
+				}
+				if offset < 0 || offset+int64(size) > fileSize {
+					return nil, nil, fmt.Errorf("sample %d at offset %d (size %d) is beyond end of file", sample-1, offset, size)
+				}
+				if n := len(ranges); n > 0 && ranges[n-1].FileOffset+int64(ranges[n-1].Size) == offset {
+					ranges[n-1].Size += int(size)
+				} else {
+					ranges = append(ranges, PESPayloadRange{FileOffset: offset, Size: int(size), ESOffset: esOffset})
+				}
+				if t.constantSampleSize == 0 {
+					sizes = append(sizes, size)
+				}
+				esOffset += int64(size)
+				offset += int64(size)
+			}
+		}
+	}
+	return ranges, sizes, nil
+}
+
+// parseMP4SampleDescription returns the codec of the first entry in an stsd
+// box and, for AVC/HEVC video, the NAL unit length prefix size.
+func parseMP4SampleDescription(payload []byte, handler string) (CodecType, int) {
+	// version/flags(4) + entry_count(4), then sample entry boxes
+	if len(payload) < 8 {
+		return CodecUnknown, 0
+	}
+	entries, err := readMP4Boxes(payload, 8, int64(len(payload)))
+	if err != nil || len(entries) == 0 {
+		return CodecUnknown, 0
+	}
+	entry := entries[0]
+
+	// Child boxes (avcC, esds, ...) follow the fixed sample entry fields:
+	// 8 bytes common to all entries, then 70 more for visual entries or 20
+	// for audio entries (QuickTime sound description v1/v2 add 16/36).
+	childStart := entry.payloadStart + 8
+	if handler == "vide" {
+		childStart += 70
+	} else {
+		childStart += 20
+		if entry.payloadStart+10 <= entry.end {
+			switch binary.BigEndian.Uint16(payload[entry.payloadStart+8:]) {
+			case 1:
+				childStart += 16
+			case 2:
+				childStart += 36
+			}
+		}
+	}
+	var children []mp4Box
+	if childStart <= entry.end {
+		children, _ = readMP4Boxes(payload, childStart, entry.end)
+	}
+	child := func(typ string) []byte {
+		b, ok := findMP4Box(children, typ)
+		if !ok {
+			return nil
+		}
+		return payload[b.payloadStart:b.end]
+	}
+
+	switch entry.typ {
+	case "avc1", "avc3":
+		// AVCDecoderConfigurationRecord: lengthSizeMinusOne in byte 4
+		if avcC := child("avcC"); len(avcC) >= 5 {
+			return CodecH264Video, int(avcC[4]&0x03) + 1
+		}
+		return CodecH264Video, 4
+	case "hvc1", "hev1":
+		// HEVCDecoderConfigurationRecord: lengthSizeMinusOne in byte 21
+		if hvcC := child("hvcC"); len(hvcC) >= 22 {
+			return CodecH265Video, int(hvcC[21]&0x03) + 1
+		}
+		return CodecH265Video, 4
+	case "mp4v", "mp4a":
+		return mp4ObjectTypeCodec(esdsObjectType(child("esds"))), 0
+	case "ac-3":
+		return CodecAC3Audio, 0
+	case "ec-3":
+		return CodecEAC3Audio, 0
+	case "dtsc":
+		return CodecDTSAudio, 0
+	case "dtsh", "dtsl", "dtse":
+		return CodecDTSHDAudio, 0
+	case "mlpa":
+		return CodecTrueHDAudio, 0
+	case ".mp3":
+		return CodecMPEGAudio, 0
+	case "fLaC":
+		return CodecFLACAudio, 0
+	case "Opus":
+		return CodecOpusAudio, 0
+	}
+	return CodecUnknown, 0
+}
+
+// esdsObjectType returns the objectTypeIndication from the
+// DecoderConfigDescriptor of an esds box payload, or 0 if not found.
+func esdsObjectType(esds []byte) byte {
+	if len(esds) < 4 {
+		return 0
+	}
+	pos := 4 // version/flags
+	// readDescriptor returns the tag and body start of the descriptor at pos.
+	readDescriptor := func() (tag byte, body int, ok bool) {
+		if pos >= len(esds) {
+			return 0, 0, false
+		}
+		tag = esds[pos]
+		pos++
+		// Expandable size: up to 4 bytes, 7 bits each
+		for i := 0; i < 4; i++ {
+			if pos >= len(esds) {
+				return 0, 0, false
+			}
+			b := esds[pos]
+			pos++
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return tag, pos, true
+	}
+
+	tag, body, ok := readDescriptor()
+	if !ok || tag != 0x03 || body+3 > len(esds) {
+		return 0
+	}
+	// ES_Descriptor: ES_ID(2) + flags(1) [+ dependsOn_ES_ID(2)] [+ URL] [+ OCR_ES_ID(2)]
+	flags := esds[body+2]
+	pos = body + 3
+	if flags&0x80 != 0 {
+		pos += 2
+	}
+	if flags&0x40 != 0 {
+		if pos >= len(esds) {
+			return 0
+		}
+		pos += 1 + int(esds[pos])
+	}
+	if flags&0x20 != 0 {
+		pos += 2
+	}
+	tag, body, ok = readDescriptor()
+	if !ok || tag != 0x04 || body >= len(esds) {
+		return 0
+	}
+	return esds[body]
+}
+
+// mp4ObjectTypeCodec maps an MPEG-4 objectTypeIndication to a codec type.
+func mp4ObjectTypeCodec(objectType byte) CodecType {
+	switch objectType {
+	case 0x40, 0x66, 0x67, 0x68: // MPEG-4 AAC, MPEG-2 AAC profiles
+		return CodecAACaudio
+	case 0x69, 0x6B: // MPEG-2/MPEG-1 audio
+		return CodecMPEGAudio
+	case 0x60, 0x61, 0x62, 0x63, 0x64, 0x65: // MPEG-2 video profiles
+		return CodecMPEG2Video
+	case 0x6A:
+		return CodecMPEG1Video
+	case 0xA5:
+		return CodecAC3Audio
+	case 0xA6:
+		return CodecEAC3Audio
+	}
+	return CodecUnknown
+}
+
+// Ensure MP4Parser implements the required interfaces at compile time.
+var (
+	_ ESReader         = (*MP4Parser)(nil)
+	_ ESRangeConverter = (*MP4Parser)(nil)
+	_ PESRangeProvider = (*MP4Parser)(nil)
+	_ esDataProvider   = (*MP4Parser)(nil)
+)
@@ -0,0 +1,70 @@
+package source
+
+import (
+	"fmt"
+
+	"github.com/stuckj/mkvdup/internal/mmap"
+)
+
+// detectMP4Codecs extracts codec information from an already-indexed MP4
+// source, using the sample descriptions read by each file's parser.
+func detectMP4Codecs(index *Index) (*SourceCodecs, error) {
+	codecs := &SourceCodecs{}
+	for _, esReader := range index.ESReaders {
+		if parser, ok := esReader.(*MP4Parser); ok {
+			mergeSourceCodecs(codecs, mp4ParserCodecs(parser))
+		}
+	}
+	return codecs, nil
+}
+
+// detectMP4CodecsFromFiles parses the moov box of each file and unions the
+// codecs of their tracks. Files that cannot be parsed are skipped; returns an
+// error only if none could be.
+func detectMP4CodecsFromFiles(paths []string) (*SourceCodecs, error) {
+	codecs := &SourceCodecs{}
+	var lastErr error
+	anySuccess := false
+	for _, path := range paths {
+		fileCodecs, err := detectMP4CodecsFromFile(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		mergeSourceCodecs(codecs, fileCodecs)
+		anySuccess = true
+	}
+	if !anySuccess {
+		return nil, fmt.Errorf("failed to scan any MP4 codecs: %w", lastErr)
+	}
+	return codecs, nil
+}
+
+// detectMP4CodecsFromFile parses the moov box of one MP4/MOV file.
+func detectMP4CodecsFromFile(path string) (*SourceCodecs, error) {
+	mmapFile, err := mmap.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("mmap open: %w", err)
+	}
+	defer mmapFile.Close()
+
+	parser := NewMP4Parser(mmapFile.Data())
+	if err := parser.Parse(); err != nil {
+		return nil, fmt.Errorf("parse MP4 %s: %w", path, err)
+	}
+	return mp4ParserCodecs(parser), nil
+}
+
+// mp4ParserCodecs returns the known codecs of a parsed MP4 file's tracks.
+func mp4ParserCodecs(parser *MP4Parser) *SourceCodecs {
+	codecs := &SourceCodecs{}
+	if ct := parser.VideoCodec(); ct != CodecUnknown && parser.TotalESSize(true) > 0 {
+		codecs.VideoCodecs = append(codecs.VideoCodecs, ct)
+	}
+	for _, id := range parser.AudioSubStreams() {
+		if ct := parser.SubStreamCodec(id); ct != CodecUnknown && !containsCodec(codecs.AudioCodecs, ct) {
+			codecs.AudioCodecs = append(codecs.AudioCodecs, ct)
+		}
+	}
+	return codecs
+}
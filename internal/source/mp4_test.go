@@ -0,0 +1,345 @@
+package source
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// mp4TestBox builds an MP4 box from its type and payload parts.
+func mp4TestBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+// mp4TestFullBox builds a box with a zero version/flags header.
+func mp4TestFullBox(typ string, payload ...[]byte) []byte {
+	return mp4TestBox(typ, append([][]byte{make([]byte, 4)}, payload...)...)
+}
+
+func be32(vals ...uint32) []byte {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// mp4TestTrack builds a trak box with the given handler, sample entry and
+// sample tables. chunkOffsets use co64 when co64 is set.
+func mp4TestTrack(handler string, sampleEntry []byte, sizes []uint32, stsc [][2]uint32, chunkOffsets []int64, co64 bool) []byte {
+	stsz := mp4TestFullBox("stsz", be32(0, uint32(len(sizes))), be32(sizes...))
+	var stscEntries []byte
+	for _, e := range stsc {
+		stscEntries = append(stscEntries, be32(e[0], e[1], 1)...)
+	}
+	var stco []byte
+	if co64 {
+		offs := make([]byte, 8*len(chunkOffsets))
+		for i, o := range chunkOffsets {
+			binary.BigEndian.PutUint64(offs[8*i:], uint64(o))
+		}
+		stco = mp4TestFullBox("co64", be32(uint32(len(chunkOffsets))), offs)
+	} else {
+		offs := make([]uint32, len(chunkOffsets))
+		for i, o := range chunkOffsets {
+			offs[i] = uint32(o)
+		}
+		stco = mp4TestFullBox("stco", be32(uint32(len(chunkOffsets))), be32(offs...))
+	}
+	stbl := mp4TestBox("stbl",
+		mp4TestFullBox("stsd", be32(1), sampleEntry),
+		stsz,
+		mp4TestFullBox("stsc", be32(uint32(len(stsc))), stscEntries),
+		stco,
+	)
+	hdlr := mp4TestFullBox("hdlr", make([]byte, 4), []byte(handler), make([]byte, 13))
+	return mp4TestBox("trak", mp4TestBox("mdia", hdlr, mp4TestBox("minf", stbl)))
+}
+
+// avccTestSample builds an AVCC sample from NAL units with 4-byte lengths.
+func avccTestSample(nals ...[]byte) []byte {
+	var s []byte
+	for _, nal := range nals {
+		s = append(s, be32(uint32(len(nal)))...)
+		s = append(s, nal...)
+	}
+	return s
+}
+
+// mp4TestFile holds a synthetic MP4 and the samples it contains.
+type mp4TestFile struct {
+	data         []byte
+	videoSamples [][]byte
+	audioSamples [][]byte
+	videoNALs    [][]byte // NAL units of the first video sample
+}
+
+// buildTestMP4 creates an MP4 with one H.264 track and one AAC track whose
+// chunks are interleaved in mdat as V(2 samples) A(2 samples) V(1 sample),
+// followed by the moov box (as written by most cameras).
+func buildTestMP4() mp4TestFile {
+	nal1 := append([]byte{0x65}, seqBytes(1, 90)...)
+	nal2 := append([]byte{0x06}, seqBytes(50, 70)...)
+	f := mp4TestFile{
+		videoNALs: [][]byte{nal1, nal2},
+		videoSamples: [][]byte{
+			avccTestSample(nal1, nal2),
+			avccTestSample(append([]byte{0x41}, seqBytes(7, 100)...)),
+			avccTestSample(append([]byte{0x41}, seqBytes(9, 120)...)),
+		},
+		audioSamples: [][]byte{seqBytes(0x80, 80), seqBytes(0x90, 96)},
+	}
+
+	ftyp := mp4TestBox("ftyp", []byte("isom"), be32(0x200), []byte("isomavc1"))
+	mdatStart := int64(len(ftyp) + 8)
+	chunks := [][]byte{
+		append(append([]byte{}, f.videoSamples[0]...), f.videoSamples[1]...),
+		append(append([]byte{}, f.audioSamples[0]...), f.audioSamples[1]...),
+		f.videoSamples[2],
+	}
+	offsets := make([]int64, len(chunks))
+	pos := mdatStart
+	for i, c := range chunks {
+		offsets[i] = pos
+		pos += int64(len(c))
+	}
+	mdat := mp4TestBox("mdat", chunks...)
+
+	avcC := mp4TestBox("avcC", []byte{1, 0x64, 0, 0x28, 0xFF, 0xE0, 0x00})
+	avc1 := mp4TestBox("avc1", make([]byte, 78), avcC)
+	// ES_Descriptor(ES_ID, flags) > DecoderConfigDescriptor(objectType 0x40)
+	esds := mp4TestFullBox("esds", []byte{0x03, 0x13, 0x00, 0x01, 0x00, 0x04, 0x0D, 0x40}, make([]byte, 12))
+	mp4a := mp4TestBox("mp4a", make([]byte, 28), esds)
+
+	sizes := func(samples [][]byte) []uint32 {
+		s := make([]uint32, len(samples))
+		for i, smp := range samples {
+			s[i] = uint32(len(smp))
+		}
+		return s
+	}
+	moov := mp4TestBox("moov",
+		mp4TestFullBox("mvhd", make([]byte, 96)),
+		mp4TestTrack("vide", avc1, sizes(f.videoSamples), [][2]uint32{{1, 2}, {2, 1}}, []int64{offsets[0], offsets[2]}, false),
+		mp4TestTrack("soun", mp4a, sizes(f.audioSamples), [][2]uint32{{1, 2}}, []int64{offsets[1]}, true),
+	)
+	f.data = bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+	return f
+}
+
+func TestMP4Parser_Parse(t *testing.T) {
+	f := buildTestMP4()
+	p := NewMP4Parser(f.data)
+	if err := p.Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if p.VideoCodec() != CodecH264Video || p.NALLengthSize() != 4 {
+		t.Errorf("video = %v/%d, want H.264 with 4-byte NAL lengths", p.VideoCodec(), p.NALLengthSize())
+	}
+	if !reflect.DeepEqual(p.AudioSubStreams(), []byte{0}) || p.SubStreamCodec(0) != CodecAACaudio {
+		t.Errorf("audio sub-streams = %v (codec %v), want [0] AAC", p.AudioSubStreams(), p.SubStreamCodec(0))
+	}
+
+	videoES := bytes.Join(f.videoSamples, nil)
+	audioES := bytes.Join(f.audioSamples, nil)
+	if got := p.TotalESSize(true); got != int64(len(videoES)) {
+		t.Errorf("TotalESSize(video) = %d, want %d", got, len(videoES))
+	}
+	if got := p.AudioSubStreamESSize(0); got != int64(len(audioES)) {
+		t.Errorf("AudioSubStreamESSize(0) = %d, want %d", got, len(audioES))
+	}
+
+	// Samples within a chunk merge into one range; the two video chunks
+	// are separated by the audio chunk.
+	if n := len(p.FilteredVideoRanges()); n != 2 {
+		t.Errorf("video ranges = %d, want 2", n)
+	}
+	if n := len(p.FilteredAudioRanges(0)); n != 1 {
+		t.Errorf("audio ranges = %d, want 1", n)
+	}
+
+	// ES reads skip over the interleaved audio chunk
+	got, err := p.ReadESData(0, len(videoES), true)
+	if err != nil {
+		t.Fatalf("ReadESData: %v", err)
+	}
+	if !bytes.Equal(got, videoES) {
+		t.Error("ReadESData does not return the concatenated video samples")
+	}
+	got, err = p.ReadAudioSubStreamData(0, 0, len(audioES))
+	if err != nil {
+		t.Fatalf("ReadAudioSubStreamData: %v", err)
+	}
+	if !bytes.Equal(got, audioES) {
+		t.Error("ReadAudioSubStreamData does not return the concatenated audio samples")
+	}
+
+	// Raw ranges for a region spanning both video chunks
+	split := len(f.videoSamples[0]) + len(f.videoSamples[1])
+	raw, err := p.RawRangesForESRegion(int64(split-10), 20, true)
+	if err != nil {
+		t.Fatalf("RawRangesForESRegion: %v", err)
+	}
+	if len(raw) != 2 || raw[0].Size != 10 || raw[1].Size != 10 {
+		t.Errorf("RawRangesForESRegion = %+v, want two 10-byte ranges", raw)
+	}
+}
+
+func TestMP4Parser_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no moov", mp4TestBox("ftyp", []byte("isom"))},
+		{"fragmented", bytes.Join([][]byte{
+			mp4TestBox("moov", mp4TestFullBox("mvhd", make([]byte, 96))),
+			mp4TestBox("moof"),
+			mp4TestBox("mdat", seqBytes(0, 100)),
+		}, nil)},
+		{"box overruns file", append(be32(100), []byte("moov")...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewMP4Parser(tt.data).Parse(); err == nil {
+				t.Error("Parse() error = nil, want error")
+			}
+		})
+	}
+
+	// Sample tables pointing past the end of the file
+	f := buildTestMP4()
+	if err := NewMP4Parser(f.data[:len(f.data)-1]).Parse(); err == nil {
+		t.Error("Parse() of truncated file: error = nil, want error")
+	}
+}
+
+func TestEsdsObjectType(t *testing.T) {
+	tests := []struct {
+		name string
+		esds []byte
+		want byte
+	}{
+		{"short sizes", []byte{0, 0, 0, 0, 0x03, 0x13, 0x00, 0x01, 0x00, 0x04, 0x0D, 0x6B}, 0x6B},
+		// ffmpeg writes 4-byte expandable sizes (0x80 0x80 0x80 len)
+		{"long sizes", []byte{0, 0, 0, 0, 0x03, 0x80, 0x80, 0x80, 0x22, 0x00, 0x01, 0x00,
+			0x04, 0x80, 0x80, 0x80, 0x14, 0x40}, 0x40},
+		{"depends-on flag", []byte{0, 0, 0, 0, 0x03, 0x15, 0x00, 0x01, 0x80, 0x00, 0x02, 0x04, 0x0D, 0x69}, 0x69},
+		{"truncated", []byte{0, 0, 0, 0, 0x03}, 0},
+	}
+	for _, tt := range tests {
+		if got := esdsObjectType(tt.esds); got != tt.want {
+			t.Errorf("%s: esdsObjectType() = 0x%02X, want 0x%02X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectType_MP4(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "C0001.MP4"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceType, err := DetectType(tmpDir)
+	if err != nil {
+		t.Fatalf("DetectType() error = %v", err)
+	}
+	if sourceType != TypeMP4 {
+		t.Errorf("DetectType() = %v, want %v", sourceType, TypeMP4)
+	}
+}
+
+func TestEnumerateMediaFiles_MP4(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "camera"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.mp4", "a.M4V", "notes.txt", filepath.Join("camera", "clip.MOV")} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := EnumerateMediaFiles(tmpDir, TypeMP4)
+	if err != nil {
+		t.Fatalf("EnumerateMediaFiles() error = %v", err)
+	}
+	want := []string{"a.M4V", "b.mp4", filepath.Join("camera", "clip.MOV")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("EnumerateMediaFiles() = %v, want %v", files, want)
+	}
+}
+
+func TestIndexMP4File(t *testing.T) {
+	f := buildTestMP4()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.mp4"), f.data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexer.SourceType() != TypeMP4 {
+		t.Fatalf("SourceType() = %v, want %v", indexer.SourceType(), TypeMP4)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatal(err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if !index.UsesESOffsets {
+		t.Error("expected UsesESOffsets=true")
+	}
+	if _, ok := index.ESReaders[0].(*MP4Parser); !ok {
+		t.Fatalf("ESReaders[0] is %T, want *MP4Parser", index.ESReaders[0])
+	}
+
+	// Every NAL unit of an AVCC sample is indexed at its header byte, which
+	// is where the matcher hashes MKV V_MPEG4/ISO/AVC blocks.
+	nal1, nal2 := f.videoNALs[0], f.videoNALs[1]
+	for _, tc := range []struct {
+		nal    []byte
+		offset int64
+	}{
+		{nal1, 4},
+		{nal2, int64(4 + len(nal1) + 4)},
+	} {
+		locs := index.HashToLocations[xxhash.Sum64(tc.nal[:MinWindowSize])]
+		if len(locs) != 1 || !locs[0].IsVideo || locs[0].Offset != tc.offset {
+			t.Errorf("locations for NAL type 0x%02X = %+v, want one video location at ES offset %d", tc.nal[0], locs, tc.offset)
+		}
+	}
+
+	// Audio samples are indexed at their start
+	locs := index.HashToLocations[xxhash.Sum64(f.audioSamples[1][:MinWindowSize])]
+	if len(locs) != 1 || locs[0].IsVideo || locs[0].AudioSubStreamID != 0 || locs[0].Offset != int64(len(f.audioSamples[0])) {
+		t.Errorf("locations for audio sample 1 = %+v, want one at ES offset %d", locs, len(f.audioSamples[0]))
+	}
+
+	codecs, err := DetectSourceCodecs(index)
+	if err != nil {
+		t.Fatalf("DetectSourceCodecs() error = %v", err)
+	}
+	if !reflect.DeepEqual(codecs.VideoCodecs, []CodecType{CodecH264Video}) || !reflect.DeepEqual(codecs.AudioCodecs, []CodecType{CodecAACaudio}) {
+		t.Errorf("DetectSourceCodecs() = %+v, want H.264 + AAC", codecs)
+	}
+	codecs, err = DetectSourceCodecsFromDir(dir)
+	if err != nil {
+		t.Fatalf("DetectSourceCodecsFromDir() error = %v", err)
+	}
+	if !reflect.DeepEqual(codecs.AudioCodecs, []CodecType{CodecAACaudio}) {
+		t.Errorf("DetectSourceCodecsFromDir() AudioCodecs = %v, want [AAC]", codecs.AudioCodecs)
+	}
+}
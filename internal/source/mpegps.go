@@ -23,7 +23,7 @@ const (
 // PESPacket represents a parsed PES packet from an MPEG-PS stream.
 type PESPacket struct {
 	StreamID      byte  // Stream identifier (E0-EF = video, C0-DF = audio, BD = private)
-	SubStreamID   byte  // Sub-stream ID for Private Stream 1 (0x80-0x87 = AC3, 0x88-0x8F = DTS)
+	SubStreamID   byte  // Sub-stream ID for Private Stream 1 (0x20-0x3F = VobSub, 0x80-0x87 = AC3, 0x88-0x8F = DTS)
 	Offset        int64 // Offset of the PES packet start in the file
 	HeaderSize    int   // Total header size (start code + length + PES header + private header)
 	PayloadOffset int64 // Offset of the actual audio/video payload
@@ -41,7 +41,8 @@ type PESPayloadRange struct {
 
 // MPEGPSParser parses MPEG Program Stream files to extract PES packet information.
 type MPEGPSParser struct {
-	data                []byte // Direct mmap'd data - zero-copy access
+	data                []byte           // Direct mmap'd data - zero-copy access; nil when using multiRegion
+	multiRegion         *multiRegionData // non-nil for VOB sets split across multiple files
 	size                int64
 	packets             []PESPacket
 	videoRanges         []PESPayloadRange
@@ -69,6 +70,34 @@ func NewMPEGPSParser(data []byte) *MPEGPSParser {
 	}
 }
 
+// NewMPEGPSParserMultiRegion creates a parser for MPEG-PS data that is split
+// across several files, such as the VTS_xx_1..n.VOB set of a DVD title set.
+// The multiRegionData provides a virtual contiguous view over the mmap'd files,
+// and all FileOffset values produced by the parser are relative to that view.
+func NewMPEGPSParserMultiRegion(mr *multiRegionData) *MPEGPSParser {
+	return &MPEGPSParser{
+		multiRegion: mr,
+		size:        mr.Len(),
+	}
+}
+
+// dataSlice returns a sub-slice of the parser's data source.
+// Uses multiRegion when available, otherwise direct slice of p.data.
+func (p *MPEGPSParser) dataSlice(off, end int64) []byte {
+	if p.multiRegion != nil {
+		return p.multiRegion.Slice(off, end)
+	}
+	return p.data[off:end]
+}
+
+// byteAt returns the byte at the given offset of the parser's data source.
+func (p *MPEGPSParser) byteAt(off int64) byte {
+	if p.multiRegion != nil {
+		return p.multiRegion.ByteAt(off)
+	}
+	return p.data[off]
+}
+
 // MPEGPSProgressFunc is called to report MPEG-PS parsing progress.
 type MPEGPSProgressFunc func(processed, total int64)
 
@@ -101,7 +130,7 @@ func (p *MPEGPSParser) ParseWithProgress(progress MPEGPSProgressFunc) error {
 		if end > p.size {
 			end = p.size
 		}
-		chunkData := p.data[pos:end]
+		chunkData := p.dataSlice(pos, end)
 		if len(chunkData) < 4 {
 			break
 		}
@@ -257,7 +286,7 @@ func (p *MPEGPSParser) buildFilteredVideoRanges() error {
 		if endOffset > p.size {
 			continue
 		}
-		data := p.data[rawRange.FileOffset:endOffset]
+		data := p.dataSlice(rawRange.FileOffset, endOffset)
 
 		// Scan for user_data sections within this PES payload
 		// Use bytes.IndexByte to quickly find 0x01 bytes (SIMD optimized)
@@ -383,7 +412,24 @@ func (p *MPEGPSParser) buildFilteredAudioRanges() error {
 			continue
 		}
 
-		subStreamID := p.data[rawRange.FileOffset]
+		subStreamID := p.byteAt(rawRange.FileOffset)
+
+		// Subpictures (VobSub, 0x20-0x3F) have a 1-byte header: the
+		// sub-stream ID is followed directly by SPU data.
+		if IsVobSubSubStreamID(subStreamID) {
+			if !seenSubStreams[subStreamID] {
+				seenSubStreams[subStreamID] = true
+				p.audioSubStreams = append(p.audioSubStreams, subStreamID)
+			}
+			esOffset := esOffsetBySubStream[subStreamID]
+			rangesBySubStream[subStreamID] = append(rangesBySubStream[subStreamID], PESPayloadRange{
+				FileOffset: rawRange.FileOffset + 1,
+				Size:       rawRange.Size - 1,
+				ESOffset:   esOffset,
+			})
+			esOffsetBySubStream[subStreamID] += int64(rawRange.Size - 1)
+			continue
+		}
 
 		// Check if this is AC3, DTS, or LPCM
 		isAC3 := subStreamID >= 0x80 && subStreamID <= 0x87
@@ -406,7 +452,7 @@ func (p *MPEGPSParser) buildFilteredAudioRanges() error {
 						if headerEnd > p.size {
 							continue
 						}
-						headerData := p.data[rawRange.FileOffset+4 : headerEnd]
+						headerData := p.dataSlice(rawRange.FileOffset+4, headerEnd)
 						info := ParseLPCMFrameHeader(headerData)
 						p.lpcmInfo[subStreamID] = info
 						// Only 16-bit LPCM is supported for byte-swap matching.
@@ -437,7 +483,7 @@ func (p *MPEGPSParser) buildFilteredAudioRanges() error {
 				}
 			}
 		}
-		// Skip unknown sub-stream types (like subtitles 0x20-0x3F)
+		// Skip unknown sub-stream types
 	}
 
 	p.filteredAudioBySubStream = rangesBySubStream
@@ -451,7 +497,7 @@ func (p *MPEGPSParser) parsePackHeader(pos int64) (int, error) {
 	if pos+14 > p.size {
 		return 0, fmt.Errorf("failed to read pack header")
 	}
-	buf := p.data[pos : pos+14]
+	buf := p.dataSlice(pos, pos+14)
 
 	// Check if this is MPEG-2 (starts with 01) or MPEG-1 (starts with 0010)
 	if buf[4]&0xC0 == 0x40 {
@@ -478,7 +524,7 @@ func (p *MPEGPSParser) readPESLength(pos int64) (uint16, error) {
 	if pos+2 > p.size {
 		return 0, fmt.Errorf("failed to read PES length")
 	}
-	return binary.BigEndian.Uint16(p.data[pos : pos+2]), nil
+	return binary.BigEndian.Uint16(p.dataSlice(pos, pos+2)), nil
 }
 
 // parsePESPacket parses a PES packet header and returns packet info.
@@ -515,7 +561,7 @@ func (p *MPEGPSParser) parsePESPacket(pos int64, streamID byte) (PESPacket, erro
 	if pos+9 > p.size {
 		return pkt, fmt.Errorf("failed to read PES header")
 	}
-	buf := p.data[pos+6 : pos+9]
+	buf := p.dataSlice(pos+6, pos+9)
 
 	// Check for MPEG-2 PES (starts with 10)
 	if buf[0]&0xC0 == 0x80 {
@@ -533,7 +579,7 @@ func (p *MPEGPSParser) parsePESPacket(pos int64, streamID byte) (PESPacket, erro
 			if offset+int64(headerLen) >= p.size {
 				return pkt, fmt.Errorf("failed to read PES header: offset out of range")
 			}
-			b := p.data[offset+int64(headerLen)]
+			b := p.byteAt(offset + int64(headerLen))
 			if b == 0xFF {
 				headerLen++
 				if headerLen > 16 { // Safety limit
@@ -677,13 +723,15 @@ func (p *MPEGPSParser) FilteredAudioRanges(subStreamID byte) []PESPayloadRange {
 }
 
 // Data returns the raw mmap'd file data for zero-copy access.
+// Returns nil when using multi-region data; use DataSlice instead.
 func (p *MPEGPSParser) Data() []byte {
 	return p.data
 }
 
 // DataSlice returns a sub-slice of the backing data at the given offset and size.
+// Works for both contiguous and multi-region data.
 func (p *MPEGPSParser) DataSlice(off int64, size int) []byte {
-	return p.data[off : off+int64(size)]
+	return p.dataSlice(off, off+int64(size))
 }
 
 // DataSize returns the total size of the backing data.
@@ -706,18 +754,16 @@ func (p *MPEGPSParser) ReadESByteWithHint(esOffset int64, isVideo bool, rangeHin
 	} else {
 		ranges = p.videoRanges
 	}
-	return readByteWithHint(p.data, nil, p.size, ranges, esOffset, rangeHint)
+	return readByteWithHint(p.data, p.multiRegion, p.size, ranges, esOffset, rangeHint)
 }
 
 // ReadAudioByteWithHint reads a single byte from an audio sub-stream, using a range hint.
 // For LPCM sub-streams (16-bit only), swaps even/odd byte positions to convert big-endian to little-endian.
 func (p *MPEGPSParser) ReadAudioByteWithHint(subStreamID byte, esOffset int64, rangeHint int) (byte, int, bool) {
 	if p.lpcmSubStreams[subStreamID] {
-		// Swap even/odd byte position: XOR with 1
-		swappedOffset := esOffset ^ 1
-		return readByteWithHint(p.data, nil, p.size, p.filteredAudioBySubStream[subStreamID], swappedOffset, rangeHint)
+		return readByteWithHint(p.data, p.multiRegion, p.size, p.filteredAudioBySubStream[subStreamID], lpcmSwappedOffset(esOffset, 2), rangeHint)
 	}
-	return readByteWithHint(p.data, nil, p.size, p.filteredAudioBySubStream[subStreamID], esOffset, rangeHint)
+	return readByteWithHint(p.data, p.multiRegion, p.size, p.filteredAudioBySubStream[subStreamID], esOffset, rangeHint)
 }
 
 // Video start codes that should be KEPT (not user_data)
@@ -769,13 +815,11 @@ func (p *MPEGPSParser) ReadESData(esOffset int64, size int, isVideo bool) ([]byt
 	} else {
 		ranges = p.videoRanges
 	}
-	return readFromRanges(p.data, nil, p.size, ranges, esOffset, size)
+	return readFromRanges(p.data, p.multiRegion, p.size, ranges, esOffset, size)
 }
 
 // ReadAudioSubStreamData reads audio data from a specific sub-stream.
 // For LPCM sub-streams, the data is byte-swapped to match MKV little-endian format.
-// Handles alignment: if esOffset is odd, reads from the pair-aligned offset,
-// swaps, and returns only the requested portion.
 func (p *MPEGPSParser) ReadAudioSubStreamData(subStreamID byte, esOffset int64, size int) ([]byte, error) {
 	ranges, ok := p.filteredAudioBySubStream[subStreamID]
 	if !ok {
@@ -783,55 +827,23 @@ func (p *MPEGPSParser) ReadAudioSubStreamData(subStreamID byte, esOffset int64,
 	}
 
 	if !p.lpcmSubStreams[subStreamID] {
-		return readFromRanges(p.data, nil, p.size, ranges, esOffset, size)
+		return readFromRanges(p.data, p.multiRegion, p.size, ranges, esOffset, size)
 	}
 
 	// LPCM 16-bit forward transform (DVD big-endian → MKV little-endian).
-	// Byte-swap pairs are aligned to the ES start (pairs at offsets 0-1, 2-3, ...).
-	// If esOffset is odd, we must read one extra byte before to complete the pair.
-	alignedOffset := esOffset
-	trimFront := 0
-	if esOffset%2 == 1 {
-		alignedOffset = esOffset - 1
-		trimFront = 1
-	}
-	alignedSize := size + trimFront
-	// If alignedSize is odd, extend by 1 to complete the trailing pair
-	// (if data is available).
-	trimBack := 0
-	if alignedSize%2 == 1 {
-		alignedSize++
-		trimBack = 1
-	}
-
-	data, err := readFromRanges(p.data, nil, p.size, ranges, alignedOffset, alignedSize)
-	if err != nil {
-		// If extending caused an out-of-range error, retry without the trailing extension
-		if trimBack > 0 {
-			alignedSize--
-			trimBack = 0
-			data, err = readFromRanges(p.data, nil, p.size, ranges, alignedOffset, alignedSize)
-		}
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// readFromRanges may return a zero-copy mmap slice, so clone first
-	result := make([]byte, len(data))
-	copy(result, data)
-	TransformLPCM16BE(result)
-
-	// Trim to the originally requested range
-	start := trimFront
-	end := start + size
-	if end > len(result) {
-		end = len(result)
-	}
-	return result[start:end], nil
+	return readLPCMFromRanges(p.data, p.multiRegion, p.size, ranges, esOffset, size, 2)
 }
 
 // IsLPCMSubStream returns true if the given sub-stream ID is an LPCM sub-stream.
 func (p *MPEGPSParser) IsLPCMSubStream(subStreamID byte) bool {
 	return p.lpcmSubStreams[subStreamID]
 }
+
+// LPCMSampleSize returns 2 for byte-swapped (16-bit) LPCM sub-streams, and 0
+// for all others.
+func (p *MPEGPSParser) LPCMSampleSize(subStreamID byte) int {
+	if p.lpcmSubStreams[subStreamID] {
+		return 2
+	}
+	return 0
+}
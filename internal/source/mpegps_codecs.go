@@ -13,7 +13,7 @@ func detectDVDCodecs(index *Index) (*SourceCodecs, error) {
 	codecs := &SourceCodecs{}
 
 	for _, esReader := range index.ESReaders {
-		parser, ok := esReader.(*MPEGPSParser)
+		parser, ok := mpegpsParserOf(esReader)
 		if !ok {
 			continue
 		}
@@ -25,22 +25,16 @@ func detectDVDCodecs(index *Index) (*SourceCodecs, error) {
 			}
 		}
 
-		// Audio from sub-streams (Private Stream 1 and MPEG-1 audio)
+		// Audio and subpictures from sub-streams (Private Stream 1 and MPEG-1 audio)
 		for _, subStreamID := range parser.AudioSubStreams() {
-			var ct CodecType
-			switch {
-			case subStreamID >= 0x80 && subStreamID <= 0x87:
-				ct = CodecAC3Audio
-			case subStreamID >= 0x88 && subStreamID <= 0x8F:
-				ct = CodecDTSAudio
-			case subStreamID >= 0xA0 && subStreamID <= 0xA7:
-				ct = CodecLPCMAudio
-			case subStreamID >= 0xC0 && subStreamID <= 0xDF:
-				ct = CodecMPEGAudio
-			default:
+			ct := dvdSubStreamCodec(subStreamID)
+			if ct == CodecVobSub {
+				if !containsCodec(codecs.SubtitleCodecs, CodecVobSub) {
+					codecs.SubtitleCodecs = append(codecs.SubtitleCodecs, CodecVobSub)
+				}
 				continue
 			}
-			if !containsCodec(codecs.AudioCodecs, ct) {
+			if ct != CodecUnknown && !containsCodec(codecs.AudioCodecs, ct) {
 				codecs.AudioCodecs = append(codecs.AudioCodecs, ct)
 			}
 		}
@@ -49,6 +43,26 @@ func detectDVDCodecs(index *Index) (*SourceCodecs, error) {
 	return codecs, nil
 }
 
+// dvdSubStreamCodec returns the codec of a DVD sub-stream, which its ID
+// range determines: Private Stream 1 IDs for subpictures, AC3, DTS and LPCM,
+// and MPEG audio stream IDs.
+func dvdSubStreamCodec(subStreamID byte) CodecType {
+	switch {
+	case IsVobSubSubStreamID(subStreamID):
+		return CodecVobSub
+	case subStreamID >= 0x80 && subStreamID <= 0x87:
+		return CodecAC3Audio
+	case subStreamID >= 0x88 && subStreamID <= 0x8F:
+		return CodecDTSAudio
+	case subStreamID >= 0xA0 && subStreamID <= 0xA7:
+		return CodecLPCMAudio
+	case subStreamID >= 0xC0 && subStreamID <= 0xDF:
+		return CodecMPEGAudio
+	default:
+		return CodecUnknown
+	}
+}
+
 // detectDVDCodecsFromFile detects codecs from a DVD ISO by parsing VTS IFO
 // metadata files. IFO files authoritatively declare every stream in each title
 // set, unlike PES scanning which can miss audio streams that appear later in
@@ -147,13 +161,19 @@ func scanPESCodecs(buf []byte) (*SourceCodecs, error) {
 			}
 
 		case streamID == 0xBD:
-			// Private Stream 1 — contains AC3, DTS, LPCM sub-streams
+			// Private Stream 1 — contains AC3, DTS, LPCM and subpicture sub-streams
 			// Parse the PES header to get to the sub-stream ID
 			if i+9 < len(buf) {
 				pesHeaderLen := int(buf[i+8])
 				subStreamOffset := i + 9 + pesHeaderLen
 				if subStreamOffset < len(buf) {
 					subStreamID := buf[subStreamOffset]
+					if IsVobSubSubStreamID(subStreamID) {
+						if !containsCodec(codecs.SubtitleCodecs, CodecVobSub) {
+							codecs.SubtitleCodecs = append(codecs.SubtitleCodecs, CodecVobSub)
+						}
+						continue
+					}
 					var ct CodecType
 					switch {
 					case subStreamID >= 0x80 && subStreamID <= 0x87:
@@ -67,3 +67,22 @@ func TestDetectDVDCodecs_WithMPEGAudio(t *testing.T) {
 		t.Errorf("audio codecs = %v, want [MPEG Audio]", codecs.AudioCodecs)
 	}
 }
+
+func TestDetectDVDCodecs_WithVobSub(t *testing.T) {
+	parser := &MPEGPSParser{}
+	parser.videoRanges = []PESPayloadRange{
+		{FileOffset: 0, Size: 1000, ESOffset: 0},
+	}
+	parser.audioSubStreams = []byte{0x80, 0x20, 0x21}
+
+	codecs, err := detectDVDCodecs(&Index{SourceType: TypeDVD, ESReaders: []ESReader{parser}})
+	if err != nil {
+		t.Fatalf("detectDVDCodecs error: %v", err)
+	}
+	if len(codecs.AudioCodecs) != 1 || codecs.AudioCodecs[0] != CodecAC3Audio {
+		t.Errorf("audio codecs = %v, want [AC3]", codecs.AudioCodecs)
+	}
+	if len(codecs.SubtitleCodecs) != 1 || codecs.SubtitleCodecs[0] != CodecVobSub {
+		t.Errorf("subtitle codecs = %v, want [VobSub]", codecs.SubtitleCodecs)
+	}
+}
@@ -477,6 +477,47 @@ func TestBuildFilteredAudioRanges_MixedPS1AndMPEG1(t *testing.T) {
 	}
 }
 
+func TestBuildFilteredAudioRanges_VobSub(t *testing.T) {
+	// A subpicture unit split over two Private Stream 1 packets: each
+	// payload carries only the 1-byte sub-stream ID before the SPU data.
+	data := make([]byte, 1000)
+	data[100] = 0x21 // sub-stream ID (second subpicture stream)
+	data[101] = 0x01 // SPU size 0x0190
+	data[102] = 0x90
+	data[400] = 0x21
+
+	p := &MPEGPSParser{
+		data: data,
+		size: int64(len(data)),
+		audioRanges: []PESPayloadRange{
+			{FileOffset: 100, Size: 200, ESOffset: 0},
+			{FileOffset: 400, Size: 201, ESOffset: 200},
+		},
+		audioRangeStreamIDs: []byte{0xBD, 0xBD},
+	}
+
+	if err := p.buildFilteredAudioRanges(); err != nil {
+		t.Fatalf("buildFilteredAudioRanges() error = %v", err)
+	}
+	if len(p.audioSubStreams) != 1 || p.audioSubStreams[0] != 0x21 {
+		t.Fatalf("audioSubStreams = %v, want [0x21]", p.audioSubStreams)
+	}
+
+	ranges := p.FilteredAudioRanges(0x21)
+	if len(ranges) != 2 {
+		t.Fatalf("filtered ranges count = %d, want 2", len(ranges))
+	}
+	if ranges[0].FileOffset != 101 || ranges[0].Size != 199 {
+		t.Errorf("ranges[0] = %+v, want FileOffset 101, Size 199", ranges[0])
+	}
+	if ranges[1].FileOffset != 401 || ranges[1].ESOffset != 199 {
+		t.Errorf("ranges[1] = %+v, want FileOffset 401, ESOffset 199", ranges[1])
+	}
+	if esSize := p.AudioSubStreamESSize(0x21); esSize != 399 {
+		t.Errorf("AudioSubStreamESSize(0x21) = %d, want 399", esSize)
+	}
+}
+
 func TestBuildFilteredAudioRanges_MultipleMPEG1Streams(t *testing.T) {
 	// Two different MPEG-1 audio streams (0xC0 and 0xC1)
 	data := make([]byte, 1000)
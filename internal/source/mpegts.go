@@ -3,9 +3,12 @@ package source
 import "fmt"
 
 // MPEGTSParser parses MPEG Transport Stream (M2TS) files to extract elementary
-// stream data. This is the Blu-ray equivalent of MPEGPSParser for DVDs.
+// stream data. This is the Blu-ray equivalent of MPEGPSParser for DVDs, and is
+// also used for plain .ts recordings.
 //
 // M2TS files use 192-byte packets: 4-byte timestamp + 188-byte TS packet.
+// Plain transport streams (e.g. broadcast/DVR captures) use bare 188-byte
+// packets; the packet size is detected automatically.
 // Each TS packet carries a fragment of a PES packet, identified by PID.
 // PES packets span multiple TS packets and contain the actual codec data.
 //
@@ -35,6 +38,11 @@ type MPEGTSParser struct {
 	subStreamToPID  map[byte]uint16    // sub-stream ID → PID
 	subStreamCodec  map[byte]CodecType // codec type per sub-stream
 
+	// LPCM sub-streams: header of the first PES payload, and the sample size
+	// of those whose samples are byte-swapped to match MKV
+	lpcmHeaders    map[byte]BDLPCMHeader
+	lpcmSampleSize map[byte]int
+
 	filterUserData bool
 }
 
@@ -47,6 +55,8 @@ func NewMPEGTSParser(data []byte) *MPEGTSParser {
 		pidToSubStream:   make(map[uint16]byte),
 		subStreamToPID:   make(map[byte]uint16),
 		subStreamCodec:   make(map[byte]CodecType),
+		lpcmHeaders:      make(map[byte]BDLPCMHeader),
+		lpcmSampleSize:   make(map[byte]int),
 	}
 }
 
@@ -61,6 +71,8 @@ func NewMPEGTSParserMultiRegion(mr *multiRegionData) *MPEGTSParser {
 		pidToSubStream:   make(map[uint16]byte),
 		subStreamToPID:   make(map[byte]uint16),
 		subStreamCodec:   make(map[byte]CodecType),
+		lpcmHeaders:      make(map[byte]BDLPCMHeader),
+		lpcmSampleSize:   make(map[byte]int),
 	}
 }
 
@@ -144,11 +156,15 @@ func (p *MPEGTSParser) AudioSubStreamESSize(subStreamID byte) int64 {
 }
 
 // ReadAudioSubStreamData reads audio data from a specific sub-stream.
+// For LPCM sub-streams, samples are byte-swapped to match MKV little-endian format.
 func (p *MPEGTSParser) ReadAudioSubStreamData(subStreamID byte, esOffset int64, size int) ([]byte, error) {
 	ranges, ok := p.audioBySubStream[subStreamID]
 	if !ok {
 		return nil, fmt.Errorf("audio sub-stream %d not found", subStreamID)
 	}
+	if sampleSize := p.lpcmSampleSize[subStreamID]; sampleSize > 0 {
+		return readLPCMFromRanges(p.data, p.multiRegion, p.size, ranges, esOffset, size, sampleSize)
+	}
 	return readFromRanges(p.data, p.multiRegion, p.size, ranges, esOffset, size)
 }
 
@@ -190,13 +206,24 @@ func (p *MPEGTSParser) ReadESByteWithHint(esOffset int64, isVideo bool, rangeHin
 }
 
 // ReadAudioByteWithHint reads a single byte from an audio sub-stream with a range hint.
+// For LPCM sub-streams, reads the byte that lands at esOffset once its sample is swapped.
 func (p *MPEGTSParser) ReadAudioByteWithHint(subStreamID byte, esOffset int64, rangeHint int) (byte, int, bool) {
+	if sampleSize := p.lpcmSampleSize[subStreamID]; sampleSize > 0 {
+		esOffset = lpcmSwappedOffset(esOffset, sampleSize)
+	}
 	return readByteWithHint(p.data, p.multiRegion, p.size, p.audioBySubStream[subStreamID], esOffset, rangeHint)
 }
 
-// IsLPCMSubStream always returns false for MPEG-TS (LPCM is DVD-only).
-func (p *MPEGTSParser) IsLPCMSubStream(_ byte) bool {
-	return false
+// IsLPCMSubStream returns true if the given sub-stream is LPCM whose samples
+// are byte-swapped to match MKV.
+func (p *MPEGTSParser) IsLPCMSubStream(subStreamID byte) bool {
+	return p.lpcmSampleSize[subStreamID] > 0
+}
+
+// LPCMSampleSize returns the sample size (2 or 3 bytes) of a byte-swapped
+// LPCM sub-stream, or 0 for other sub-streams.
+func (p *MPEGTSParser) LPCMSampleSize(subStreamID byte) int {
+	return p.lpcmSampleSize[subStreamID]
 }
 
 // --- Accessors for indexer ---
@@ -259,6 +286,12 @@ func (p *MPEGTSParser) AudioPIDs() []uint16 {
 	return p.audioPIDs
 }
 
+// SubStreamCodec returns the codec type of an audio or subtitle sub-stream,
+// as declared in the PMT.
+func (p *MPEGTSParser) SubStreamCodec(subStreamID byte) CodecType {
+	return p.subStreamCodec[subStreamID]
+}
+
 // VideoCodec returns the video codec type detected from the PMT.
 func (p *MPEGTSParser) VideoCodec() CodecType {
 	return p.videoCodec
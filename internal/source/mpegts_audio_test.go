@@ -1,6 +1,7 @@
 package source
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -631,3 +632,61 @@ func TestMPEGTSParser_SubtitleSubStreams(t *testing.T) {
 		t.Errorf("subStreamCodec[%d] = %v, want CodecPGSSubtitle", subtitleSubs[0], parser.subStreamCodec[subtitleSubs[0]])
 	}
 }
+
+func TestMPEGTSParser_BDLPCM(t *testing.T) {
+	const (
+		pmtPID   = uint16(0x0100)
+		videoPID = uint16(0x1011)
+		audioPID = uint16(0x1100)
+	)
+	// Stereo 24-bit 48kHz Blu-ray LPCM header, then 6 samples in each PES
+	header := []byte{0x00, 0x12, 0x31, 0xC0}
+	pes1 := seqBytes(0x10, 18)
+	pes2 := seqBytes(0x80, 18)
+
+	var data []byte
+	data = append(data, makeM2TSPacket(0, true, 0x01, 0, 0, makePATPayload(pmtPID))...)
+	data = append(data, makeM2TSPacket(pmtPID, true, 0x01, 0, 0,
+		makePMTPayload(videoPID, 0x1B, []uint16{audioPID}, []byte{0x80}))...)
+	data = append(data, makeM2TSPacket(videoPID, true, 0x01, 0, 0,
+		makePESStart(0xE0, 0, seqBytes(0, 175)))...)
+	// Pad the PES payloads with adaptation fields so they end with the packet
+	data = append(data, makeM2TSPacket(audioPID, true, 0x03, 183-9-4-18, 0,
+		makePESStart(0xBD, 0, append(append([]byte(nil), header...), pes1...)))...)
+	data = append(data, makeM2TSPacket(audioPID, true, 0x03, 183-9-4-18, 1,
+		makePESStart(0xBD, 0, append(append([]byte(nil), header...), pes2...)))...)
+
+	p := NewMPEGTSParser(data)
+	if err := p.Parse(); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	subs := p.AudioSubStreams()
+	if len(subs) != 1 {
+		t.Fatalf("AudioSubStreams = %v, want 1 sub-stream", subs)
+	}
+	sub := subs[0]
+	if !p.IsLPCMSubStream(sub) || p.LPCMSampleSize(sub) != 3 {
+		t.Fatalf("IsLPCMSubStream = %v, LPCMSampleSize = %d, want true, 3", p.IsLPCMSubStream(sub), p.LPCMSampleSize(sub))
+	}
+
+	// The LPCM headers are not part of the ES
+	es := append(append([]byte(nil), pes1...), pes2...)
+	if got := p.AudioSubStreamESSize(sub); got != int64(len(es)) {
+		t.Fatalf("AudioSubStreamESSize = %d, want %d", got, len(es))
+	}
+	want := append([]byte(nil), es...)
+	TransformLPCM24BE(want)
+	got, err := p.ReadAudioSubStreamData(sub, 0, len(es))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadAudioSubStreamData = %x (err %v), want %x", got, err, want)
+	}
+	got, err = p.ReadAudioSubStreamData(sub, 16, 4)
+	if err != nil || !bytes.Equal(got, want[16:20]) {
+		t.Errorf("ReadAudioSubStreamData across PES = %x (err %v), want %x", got, err, want[16:20])
+	}
+	for i := range want {
+		if b, _, ok := p.ReadAudioByteWithHint(sub, int64(i), 0); !ok || b != want[i] {
+			t.Errorf("ReadAudioByteWithHint(%d) = 0x%02X (ok %v), want 0x%02X", i, b, ok, want[i])
+		}
+	}
+}
@@ -10,7 +10,8 @@ import (
 
 // detectBlurayCodecs scans PMTs from indexed M2TS files to detect codecs.
 // This is a fallback for when the pre-index DetectSourceCodecsFromDir check
-// was skipped (e.g., detection failure).
+// was skipped (e.g., detection failure). Codecs of DVD ISOs in a mixed
+// multi-disc source are taken from their MPEG-PS parsers instead.
 func detectBlurayCodecs(index *Index) (*SourceCodecs, error) {
 	if len(index.Files) == 0 {
 		return nil, fmt.Errorf("no source files in index")
@@ -19,7 +20,14 @@ func detectBlurayCodecs(index *Index) (*SourceCodecs, error) {
 	// sharing the same RelativePath, and we only need to scan each file once.
 	seen := make(map[string]struct{})
 	var targets []codecScanTarget
-	for _, f := range index.Files {
+	hasDVD := false
+	for i, f := range index.Files {
+		if i < len(index.ESReaders) {
+			if _, ok := mpegpsParserOf(index.ESReaders[i]); ok {
+				hasDVD = true
+				continue
+			}
+		}
 		fullPath := filepath.Join(index.SourceDir, f.RelativePath)
 		if _, ok := seen[fullPath]; ok {
 			continue
@@ -30,7 +38,16 @@ func detectBlurayCodecs(index *Index) (*SourceCodecs, error) {
 			Size: f.Size,
 		})
 	}
-	return detectBlurayCodecsMulti(significantTargets(targets))
+	codecs, err := detectBlurayCodecsMulti(significantTargets(targets))
+	if err != nil || !hasDVD {
+		return codecs, err
+	}
+	dvdCodecs, err := detectDVDCodecs(index)
+	if err != nil {
+		return nil, err
+	}
+	mergeSourceCodecs(codecs, dvdCodecs)
+	return codecs, nil
 }
 
 // detectBlurayCodecsMulti scans multiple M2TS files or ISOs and unions their
@@ -82,12 +99,12 @@ func detectBlurayCodecsFromISO(path string) (*SourceCodecs, error) {
 	defer f.Close()
 
 	// Try CLPI-based detection (ISO9660, then UDF).
-	if clpis, err := findCLPIsInISO(f); err == nil && len(clpis) > 0 {
+	if clpis, err := findBDMVFilesInISO9660(f, "CLIPINF", ".CLPI"); err == nil && len(clpis) > 0 {
 		if codecs, err := detectBlurayCodecsFromCLPIs(f, clpis); err == nil {
 			return codecs, nil
 		}
 	}
-	if clpis, err := findCLPIsInUDF(f); err == nil && len(clpis) > 0 {
+	if clpis, err := findBDMVFilesInUDF(f, "CLIPINF", ".CLPI"); err == nil && len(clpis) > 0 {
 		if codecs, err := detectBlurayCodecsFromCLPIs(f, clpis); err == nil {
 			return codecs, nil
 		}
@@ -204,7 +221,7 @@ func parseTSCodecs(data []byte) (*SourceCodecs, error) {
 			streamType := pmtSection[j]
 			esInfoLen := int(pmtSection[j+3]&0x0F)<<8 | int(pmtSection[j+4])
 
-			ct := tsStreamTypeToCodecType(streamType)
+			ct := pmtStreamCodecType(streamType, esInfo(pmtSection, j+5, esInfoLen, streamsEnd))
 			if ct != CodecUnknown {
 				if IsVideoCodec(ct) {
 					if !containsCodec(codecs.VideoCodecs, ct) {
@@ -268,6 +285,59 @@ func tsStreamTypeToCodecType(streamType byte) CodecType {
 	}
 }
 
+// pmtStreamCodecType maps a PMT elementary stream entry to a CodecType.
+// Most streams are identified by stream type alone, but DVB broadcasts carry
+// AC3, E-AC3 and DTS as PES private data (stream type 0x06) and declare the
+// codec in the ES info descriptors instead.
+func pmtStreamCodecType(streamType byte, esInfo []byte) CodecType {
+	if streamType != 0x06 {
+		return tsStreamTypeToCodecType(streamType)
+	}
+	for i := 0; i+2 <= len(esInfo); {
+		tag := esInfo[i]
+		length := int(esInfo[i+1])
+		body := esInfo[i+2:]
+		if length > len(body) {
+			break
+		}
+		body = body[:length]
+		switch tag {
+		case 0x6A: // DVB AC-3_descriptor
+			return CodecAC3Audio
+		case 0x7A: // DVB enhanced_AC-3_descriptor
+			return CodecEAC3Audio
+		case 0x7B: // DVB DTS_descriptor
+			return CodecDTSAudio
+		case 0x05: // registration_descriptor
+			if len(body) >= 4 {
+				switch string(body[:4]) {
+				case "AC-3":
+					return CodecAC3Audio
+				case "EAC3":
+					return CodecEAC3Audio
+				case "DTS1", "DTS2", "DTS3":
+					return CodecDTSAudio
+				}
+			}
+		}
+		i += 2 + length
+	}
+	return CodecUnknown
+}
+
+// esInfo returns the ES info descriptor bytes of a PMT stream entry,
+// clamped to the end of the stream loop.
+func esInfo(pmtSection []byte, start, length, streamsEnd int) []byte {
+	end := start + length
+	if end > streamsEnd {
+		end = streamsEnd
+	}
+	if start >= end {
+		return nil
+	}
+	return pmtSection[start:end]
+}
+
 // detectTSPacketSize determines TS packet size (188 or 192) and the offset to
 // the first sync byte. Returns (0, 0) if no valid TS structure is found.
 func detectTSPacketSize(data []byte) (int, int) {
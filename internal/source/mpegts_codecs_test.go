@@ -266,3 +266,29 @@ func TestTSStreamTypeToCodecType(t *testing.T) {
 		}
 	}
 }
+
+func TestPMTStreamCodecType(t *testing.T) {
+	tests := []struct {
+		name       string
+		streamType byte
+		esInfo     []byte
+		want       CodecType
+	}{
+		{"stream type only", 0x0F, nil, CodecAACaudio},
+		{"private data without descriptors", 0x06, nil, CodecUnknown},
+		{"DVB AC-3 descriptor", 0x06, []byte{0x6A, 0x01, 0x00}, CodecAC3Audio},
+		{"DVB enhanced AC-3 descriptor", 0x06, []byte{0x7A, 0x01, 0x00}, CodecEAC3Audio},
+		{"DVB DTS descriptor", 0x06, []byte{0x7B, 0x00}, CodecDTSAudio},
+		{"registration AC-3", 0x06, []byte{0x05, 0x04, 'A', 'C', '-', '3'}, CodecAC3Audio},
+		{"language then AC-3", 0x06, []byte{0x0A, 0x04, 'e', 'n', 'g', 0x00, 0x6A, 0x01, 0x00}, CodecAC3Audio},
+		{"teletext", 0x06, []byte{0x56, 0x05, 'e', 'n', 'g', 0x09, 0x00}, CodecUnknown},
+		{"truncated descriptor", 0x06, []byte{0x6A, 0x05, 0x00}, CodecUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pmtStreamCodecType(tt.streamType, tt.esInfo); got != tt.want {
+				t.Errorf("pmtStreamCodecType(0x%02X, %x) = %v, want %v", tt.streamType, tt.esInfo, got, tt.want)
+			}
+		})
+	}
+}
@@ -249,6 +249,16 @@ func (p *MPEGTSParser) scanPackets(data []byte, startPos int, logicalBase int64,
 			pesHeaderDataLen := int(payload[8])
 			pesHeaderSize := 9 + pesHeaderDataLen
 
+			// Blu-ray LPCM payloads start with their own 4-byte header,
+			// which MKV does not keep; skip it along with the PES header.
+			if pid != p.videoPID && p.subStreamCodec[p.pidToSubStream[pid]] == CodecLPCMAudio {
+				subID := p.pidToSubStream[pid]
+				pesHeaderSize += BDLPCMHeaderSize
+				if _, ok := p.lpcmHeaders[subID]; !ok && pesHeaderSize <= len(payload) {
+					p.lpcmHeaders[subID] = ParseBDLPCMHeader(payload[pesHeaderSize-BDLPCMHeaderSize : pesHeaderSize])
+				}
+			}
+
 			if pesHeaderSize >= len(payload) {
 				state.headerBytesRemaining = pesHeaderSize - len(payload)
 				continue
@@ -320,8 +330,9 @@ func (p *MPEGTSParser) scanPackets(data []byte, startPos int, logicalBase int64,
 	}
 }
 
-// finalizeParse performs post-scan processing: video range filtering and
-// TrueHD+AC3 stream splitting. Shared by contiguous and multi-region paths.
+// finalizeParse performs post-scan processing: video range filtering,
+// TrueHD+AC3 stream splitting and LPCM sample sizes. Shared by contiguous
+// and multi-region paths.
 func (p *MPEGTSParser) finalizeParse() error {
 	if p.videoPID == 0 && len(p.audioPIDs) == 0 {
 		return fmt.Errorf("no video or audio PIDs found in PMT")
@@ -335,6 +346,12 @@ func (p *MPEGTSParser) finalizeParse() error {
 	p.splitTrueHDAC3Streams()
 	p.splitDTSHDCoreStreams()
 
+	for subID, header := range p.lpcmHeaders {
+		if sampleSize := header.SampleSize(); sampleSize > 0 {
+			p.lpcmSampleSize[subID] = sampleSize
+		}
+	}
+
 	return nil
 }
 
@@ -375,7 +392,7 @@ func (p *MPEGTSParser) parsePATandPMT(data []byte, startOffset int) error {
 			esPID := uint16(pmtSection[j+1]&0x1F)<<8 | uint16(pmtSection[j+2])
 			esInfoLen := int(pmtSection[j+3]&0x0F)<<8 | int(pmtSection[j+4])
 
-			ct := tsStreamTypeToCodecType(streamType)
+			ct := pmtStreamCodecType(streamType, esInfo(pmtSection, j+5, esInfoLen, streamsEnd))
 			if ct != CodecUnknown {
 				if IsVideoCodec(ct) && p.videoPID == 0 {
 					p.videoPID = esPID
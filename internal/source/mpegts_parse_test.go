@@ -1,7 +1,11 @@
 package source
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 func TestMPEGTSParser_BasicParsing(t *testing.T) {
@@ -595,3 +599,115 @@ func TestMPEGTSParser_MultiPacketPMT(t *testing.T) {
 
 	_ = numStreams
 }
+
+func TestIndexTSRecording_H264AAC(t *testing.T) {
+	const (
+		pmtPID   = uint16(0x0100)
+		videoPID = uint16(0x0200)
+		audioPID = uint16(0x0201)
+	)
+	// H.264 slice NAL (after the start code) and one ADTS-framed AAC frame
+	nal := append([]byte{0x65}, seqBytes(1, 120)...)
+	aacPayload := seqBytes(0x40, 100)
+	frameLen := 7 + len(aacPayload)
+	adts := append([]byte{0xFF, 0xF1, 0x4C, 0x80,
+		byte(frameLen >> 3), byte(frameLen<<5) | 0x1F, 0xFC}, aacPayload...)
+
+	// Plain 188-byte transport stream (no M2TS timestamp prefix)
+	var data []byte
+	data = append(data, makeTSPacket(0, true, 0x01, 0, 0, makePATPayload(pmtPID))...)
+	data = append(data, makeTSPacket(pmtPID, true, 0x01, 0, 0,
+		makePMTPayload(videoPID, 0x1B, []uint16{audioPID}, []byte{0x0F}))...)
+	data = append(data, makeTSPacket(videoPID, true, 0x01, 0, 0,
+		makePESStart(0xE0, 0, append([]byte{0x00, 0x00, 0x01}, nal...)))...)
+	data = append(data, makeTSPacket(audioPID, true, 0x01, 0, 0,
+		makePESStart(0xC0, 0, adts))...)
+	data = append(data, makeTSPacket(0x1FFF, false, 0x01, 0, 0, nil)...)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "recording.ts"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexer.SourceType() != TypeMPEGTS {
+		t.Fatalf("SourceType() = %v, want %v", indexer.SourceType(), TypeMPEGTS)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatal(err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if !index.UsesESOffsets {
+		t.Error("expected UsesESOffsets=true")
+	}
+	parser, ok := index.ESReaders[0].(*MPEGTSParser)
+	if !ok {
+		t.Fatalf("ESReaders[0] is %T, want *MPEGTSParser", index.ESReaders[0])
+	}
+	if parser.packetSize != 188 {
+		t.Errorf("packetSize = %d, want 188", parser.packetSize)
+	}
+	if parser.SubStreamCodec(0) != CodecAACaudio {
+		t.Errorf("SubStreamCodec(0) = %v, want AAC", parser.SubStreamCodec(0))
+	}
+
+	// Video is indexed at the NAL header, as for Blu-ray
+	videoLocs := index.HashToLocations[xxhash.Sum64(nal[:MinWindowSize])]
+	if len(videoLocs) != 1 || !videoLocs[0].IsVideo || videoLocs[0].Offset != 3 {
+		t.Errorf("video locations = %+v, want one at ES offset 3", videoLocs)
+	}
+
+	// AAC is indexed at the raw frame data after the ADTS header, since
+	// MKV A_AAC blocks do not carry the header.
+	audioLocs := index.HashToLocations[xxhash.Sum64(aacPayload[:MinWindowSize])]
+	if len(audioLocs) != 1 || audioLocs[0].IsVideo || audioLocs[0].Offset != 7 {
+		t.Errorf("AAC locations = %+v, want one at ES offset 7", audioLocs)
+	}
+}
+
+func TestIndexTSRecording_VC1(t *testing.T) {
+	const (
+		pmtPID   = uint16(0x0100)
+		videoPID = uint16(0x0200)
+	)
+	// Sequence header, then a frame whose payload MKV stores without the
+	// 00 00 01 0D start code
+	seqHeader := append([]byte{0x00, 0x00, 0x01, 0x0F}, seqBytes(0x90, 20)...)
+	frame := seqBytes(0x10, 120)
+	es := append(append(seqHeader, 0x00, 0x00, 0x01, VC1FrameStartCode), frame...)
+
+	var data []byte
+	data = append(data, makeTSPacket(0, true, 0x01, 0, 0, makePATPayload(pmtPID))...)
+	data = append(data, makeTSPacket(pmtPID, true, 0x01, 0, 0,
+		makePMTPayload(videoPID, 0xEA, nil, nil))...)
+	data = append(data, makeTSPacket(videoPID, true, 0x01, 0, 0, makePESStart(0xFD, 0, es))...)
+	data = append(data, makeTSPacket(0x1FFF, false, 0x01, 0, 0, nil)...)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "recording.ts"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	indexer, err := NewIndexer(dir, MinWindowSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Build(nil); err != nil {
+		t.Fatal(err)
+	}
+	index := indexer.Index()
+	defer index.Close()
+
+	if parser := index.ESReaders[0].(*MPEGTSParser); parser.VideoCodec() != CodecVC1Video {
+		t.Fatalf("VideoCodec() = %v, want VC-1", parser.VideoCodec())
+	}
+	frameOffset := int64(len(seqHeader) + 4)
+	locs := index.HashToLocations[xxhash.Sum64(frame[:MinWindowSize])]
+	if len(locs) != 1 || !locs[0].IsVideo || locs[0].Offset != frameOffset {
+		t.Errorf("frame payload locations = %+v, want one at ES offset %d", locs, frameOffset)
+	}
+}
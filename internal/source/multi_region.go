@@ -60,6 +60,25 @@ func newMultiRegionData(extents []isoPhysicalRange, isoData []byte) *multiRegion
 	return mr
 }
 
+// newMultiRegionDataFromSlices creates a multiRegionData that concatenates
+// the given byte slices in order. Used for DVD VOB sets, where each slice is
+// the mmap'd data of one VTS_xx_N.VOB file.
+func newMultiRegionDataFromSlices(parts [][]byte) *multiRegionData {
+	mr := &multiRegionData{
+		regions: make([]multiRegion, len(parts)),
+	}
+	logicalOff := int64(0)
+	for i, data := range parts {
+		mr.regions[i] = multiRegion{
+			data:         data,
+			logicalStart: logicalOff,
+		}
+		logicalOff += int64(len(data))
+	}
+	mr.totalSize = logicalOff
+	return mr
+}
+
 // Len returns the total logical size across all regions.
 func (m *multiRegionData) Len() int64 { return m.totalSize }
 
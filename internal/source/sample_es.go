@@ -0,0 +1,195 @@
+package source
+
+import "fmt"
+
+// maxSampleSubStreams caps the number of audio sub-streams of a sample-based
+// source, since sub-stream IDs are single bytes.
+const maxSampleSubStreams = 256
+
+// sampleES is the elementary stream layout shared by containers that store
+// every frame contiguously and list where each one lives (MP4 sample tables,
+// MKV blocks). Each track's frames, in decode order, form a continuous ES
+// described by PESPayloadRange entries; adjacent frames are merged into one
+// range. The per-frame sizes are kept for indexing, since a frame is exactly
+// what an MKV block carries.
+type sampleES struct {
+	data []byte // mmap'd file data (zero-copy)
+	size int64
+
+	videoCodec    CodecType
+	nalLengthSize int // AVCC/HVCC length prefix size; 0 when not length-prefixed
+
+	videoRanges      []PESPayloadRange
+	videoSampleSizes []uint32
+
+	audioSubStreams  []byte
+	audioBySubStream map[byte][]PESPayloadRange
+	audioSampleSizes map[byte][]uint32
+	subStreamCodec   map[byte]CodecType
+}
+
+// newSampleES creates an empty sample ES layout over the given data.
+func newSampleES(data []byte) sampleES {
+	return sampleES{
+		data:             data,
+		size:             int64(len(data)),
+		audioBySubStream: make(map[byte][]PESPayloadRange),
+		audioSampleSizes: make(map[byte][]uint32),
+		subStreamCodec:   make(map[byte]CodecType),
+	}
+}
+
+// addSubStream appends a sub-stream with the given ranges, sample sizes and
+// codec, returning its ID. ok is false when the sub-stream limit is reached.
+func (p *sampleES) addSubStream(ranges []PESPayloadRange, sizes []uint32, codec CodecType) (id byte, ok bool) {
+	if len(p.audioSubStreams) >= maxSampleSubStreams {
+		return 0, false
+	}
+	id = byte(len(p.audioSubStreams))
+	p.audioSubStreams = append(p.audioSubStreams, id)
+	p.audioBySubStream[id] = ranges
+	p.audioSampleSizes[id] = sizes
+	p.subStreamCodec[id] = codec
+	return id, true
+}
+
+// --- ESReader interface implementation ---
+
+// ReadESData reads elementary stream data at the given ES offset.
+func (p *sampleES) ReadESData(esOffset int64, size int, isVideo bool) ([]byte, error) {
+	if !isVideo {
+		return nil, fmt.Errorf("audio uses per-sub-stream methods, use ReadAudioSubStreamData")
+	}
+	return readFromRanges(p.data, nil, p.size, p.videoRanges, esOffset, size)
+}
+
+// ESOffsetToFileOffset converts an ES offset to a file offset and remaining bytes.
+func (p *sampleES) ESOffsetToFileOffset(esOffset int64, isVideo bool) (fileOffset int64, remaining int) {
+	if !isVideo {
+		return -1, 0
+	}
+	idx := binarySearchRanges(p.videoRanges, esOffset)
+	if idx < 0 {
+		return -1, 0
+	}
+	r := p.videoRanges[idx]
+	offsetInRange := esOffset - r.ESOffset
+	return r.FileOffset + offsetInRange, r.Size - int(offsetInRange)
+}
+
+// TotalESSize returns the total size of the video elementary stream.
+func (p *sampleES) TotalESSize(isVideo bool) int64 {
+	if !isVideo {
+		return 0
+	}
+	return totalESSizeFromRanges(p.videoRanges)
+}
+
+// AudioSubStreams returns the list of audio sub-stream IDs.
+func (p *sampleES) AudioSubStreams() []byte {
+	return p.audioSubStreams
+}
+
+// AudioSubStreamESSize returns the ES size for a specific audio sub-stream.
+func (p *sampleES) AudioSubStreamESSize(subStreamID byte) int64 {
+	return totalESSizeFromRanges(p.audioBySubStream[subStreamID])
+}
+
+// ReadAudioSubStreamData reads audio data from a specific sub-stream.
+func (p *sampleES) ReadAudioSubStreamData(subStreamID byte, esOffset int64, size int) ([]byte, error) {
+	ranges, ok := p.audioBySubStream[subStreamID]
+	if !ok {
+		return nil, fmt.Errorf("audio sub-stream %d not found", subStreamID)
+	}
+	return readFromRanges(p.data, nil, p.size, ranges, esOffset, size)
+}
+
+// --- ESRangeConverter interface implementation ---
+
+// RawRangesForESRegion returns the raw file ranges for a video ES region.
+func (p *sampleES) RawRangesForESRegion(esOffset int64, size int, isVideo bool) ([]RawRange, error) {
+	if !isVideo {
+		return nil, fmt.Errorf("audio uses per-sub-stream methods, use RawRangesForAudioSubStream")
+	}
+	return rawRangesFromPESRanges(p.videoRanges, esOffset, size)
+}
+
+// RawRangesForAudioSubStream returns the raw file ranges for audio data from a specific sub-stream.
+func (p *sampleES) RawRangesForAudioSubStream(subStreamID byte, esOffset int64, size int) ([]RawRange, error) {
+	ranges, ok := p.audioBySubStream[subStreamID]
+	if !ok {
+		return nil, fmt.Errorf("audio sub-stream %d not found", subStreamID)
+	}
+	return rawRangesFromPESRanges(ranges, esOffset, size)
+}
+
+// --- Hint-based reading for matcher hot path ---
+
+// ReadESByteWithHint reads a single byte from the ES stream with a range hint.
+func (p *sampleES) ReadESByteWithHint(esOffset int64, isVideo bool, rangeHint int) (byte, int, bool) {
+	if !isVideo {
+		return 0, -1, false
+	}
+	return readByteWithHint(p.data, nil, p.size, p.videoRanges, esOffset, rangeHint)
+}
+
+// ReadAudioByteWithHint reads a single byte from an audio sub-stream with a range hint.
+func (p *sampleES) ReadAudioByteWithHint(subStreamID byte, esOffset int64, rangeHint int) (byte, int, bool) {
+	return readByteWithHint(p.data, nil, p.size, p.audioBySubStream[subStreamID], esOffset, rangeHint)
+}
+
+// IsLPCMSubStream always returns false: PCM samples are stored exactly as
+// MKV stores them, so no transform is needed.
+func (p *sampleES) IsLPCMSubStream(_ byte) bool {
+	return false
+}
+
+// LPCMSampleSize always returns 0, for the same reason.
+func (p *sampleES) LPCMSampleSize(_ byte) int {
+	return 0
+}
+
+// --- Accessors for indexer ---
+
+// Data returns the raw mmap'd file data for zero-copy access.
+func (p *sampleES) Data() []byte {
+	return p.data
+}
+
+// DataSlice returns a sub-slice of the backing data at the given offset and size.
+func (p *sampleES) DataSlice(off int64, size int) []byte {
+	return p.data[off : off+int64(size)]
+}
+
+// DataSize returns the total size of the backing data.
+func (p *sampleES) DataSize() int64 {
+	return p.size
+}
+
+// FilteredVideoRanges returns the video sample ranges. Sample ranges need no
+// filtering; the name matches the PESRangeProvider interface.
+func (p *sampleES) FilteredVideoRanges() []PESPayloadRange {
+	return p.videoRanges
+}
+
+// FilteredAudioRanges returns the sample ranges for a specific audio sub-stream.
+func (p *sampleES) FilteredAudioRanges(subStreamID byte) []PESPayloadRange {
+	return p.audioBySubStream[subStreamID]
+}
+
+// VideoCodec returns the video codec type, as declared by the container.
+func (p *sampleES) VideoCodec() CodecType {
+	return p.videoCodec
+}
+
+// NALLengthSize returns the NAL unit length prefix size of AVC/HEVC video
+// samples, or 0 if the video is not length-prefixed.
+func (p *sampleES) NALLengthSize() int {
+	return p.nalLengthSize
+}
+
+// SubStreamCodec returns the codec type of an audio sub-stream, as declared
+// by the container.
+func (p *sampleES) SubStreamCodec(subStreamID byte) CodecType {
+	return p.subStreamCodec[subStreamID]
+}
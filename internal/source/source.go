@@ -1,11 +1,12 @@
-// Package source provides functionality for indexing source media files (DVD ISOs, Blu-ray directories).
+// Package source provides functionality for indexing source media files (DVD ISOs, Blu-ray directories,
+// MPEG-TS recordings, MP4/MOV files, existing MKVs).
 package source
 
 import (
 	"errors"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
 	"sync"
 
@@ -17,8 +18,11 @@ type Type int
 
 // Source type constants.
 const (
-	TypeDVD    Type = iota // Contains .iso file
-	TypeBluray             // Contains BDMV/STREAM/*.m2ts
+	TypeDVD    Type = iota // Contains .iso file or unpacked VIDEO_TS directory
+	TypeBluray             // Contains BDMV/STREAM/*.m2ts or at least one Blu-ray .iso file
+	TypeMPEGTS             // Contains *.ts transport stream recordings (188- or 192-byte packets)
+	TypeMP4                // Contains *.mp4, *.m4v or *.mov files (ISO base media format)
+	TypeMKV                // Contains *.mkv files (existing remuxes, possibly mkvdup virtual files)
 )
 
 func (t Type) String() string {
@@ -27,16 +31,30 @@ func (t Type) String() string {
 		return "DVD"
 	case TypeBluray:
 		return "Blu-ray"
+	case TypeMPEGTS:
+		return "MPEG-TS"
+	case TypeMP4:
+		return "MP4"
+	case TypeMKV:
+		return "MKV"
 	default:
 		return "Unknown"
 	}
 }
 
 // ErrUnknownSourceType is returned when the source directory type cannot be determined.
-var ErrUnknownSourceType = errors.New("unknown source type: directory contains neither ISO nor BDMV structure")
+var ErrUnknownSourceType = errors.New("unknown source type: directory contains neither ISO, BDMV, VIDEO_TS, .ts, MP4/MOV nor MKV files")
 
 // DetectType determines whether a directory contains a DVD ISO or Blu-ray structure.
 // ISOs are inspected to determine if they contain DVD (VIDEO_TS) or Blu-ray (BDMV) content.
+// A multi-disc directory mixing DVD and Blu-ray ISOs is reported as Blu-ray; the
+// indexer classifies each ISO individually (see Indexer.Build).
+// Unpacked VIDEO_TS directories with content VOBs are detected as DVD.
+// Directories of .ts recordings (e.g. DVR captures) are detected as MPEG-TS.
+// Directories of MP4/MOV files (downloads, camera footage) are detected as MP4.
+// Directories of MKV files (an earlier remux of the same disc, or a directory
+// of an mkvdup mount) are detected as MKV; this is checked last so a stray MKV
+// next to disc content does not change the source type.
 func DetectType(dir string) (Type, error) {
 	// Check for ISO files
 	isos, err := filepath.Glob(filepath.Join(dir, "*.iso"))
@@ -51,15 +69,16 @@ func DetectType(dir string) (Type, error) {
 	}
 	isos = append(isos, subIsos...)
 
-	// If we found ISOs, inspect them to determine type
+	// If we found ISOs, inspect every one of them: Blu-ray wins if any disc
+	// is a Blu-ray, since Blu-ray sources are handled with ES range maps,
+	// which also cover the MPEG-PS streams of any DVD discs alongside.
 	if len(isos) > 0 {
-		// Check the first ISO to determine type
-		isoType, err := detectISOType(isos[0])
-		if err != nil {
-			// If we can't read the ISO, default to DVD (legacy behavior)
-			return TypeDVD, nil
+		for _, iso := range isos {
+			if classifyISO(iso) == TypeBluray {
+				return TypeBluray, nil
+			}
 		}
-		return isoType, nil
+		return TypeDVD, nil
 	}
 
 	// Check for Blu-ray directory structure
@@ -71,9 +90,51 @@ func DetectType(dir string) (Type, error) {
 		return TypeBluray, nil
 	}
 
+	// Check for unpacked DVD structure (VIDEO_TS/VTS_xx_N.VOB)
+	if len(findContentVOBFiles(dir)) > 0 {
+		return TypeDVD, nil
+	}
+
+	// Check for transport stream recordings
+	ts, err := findTSFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(ts) > 0 {
+		return TypeMPEGTS, nil
+	}
+
+	// Check for MP4/MOV files
+	mp4s, err := findMP4Files(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(mp4s) > 0 {
+		return TypeMP4, nil
+	}
+
+	// Check for existing MKV files
+	mkvs, err := findMKVFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(mkvs) > 0 {
+		return TypeMKV, nil
+	}
+
 	return 0, ErrUnknownSourceType
 }
 
+// classifyISO returns the source type of a single ISO file. ISOs that cannot
+// be read are treated as DVDs (legacy behavior).
+func classifyISO(isoPath string) Type {
+	isoType, err := detectISOType(isoPath)
+	if err != nil {
+		return TypeDVD
+	}
+	return isoType
+}
+
 // detectISOType examines an ISO file to determine if it's a DVD or Blu-ray.
 // DVDs have VIDEO_TS directory, Blu-rays have BDMV directory.
 // Uses minimal reads to avoid loading the entire ISO into memory.
@@ -189,9 +250,10 @@ func detectISOType(isoPath string) (Type, error) {
 
 // File represents a source file within the source directory.
 type File struct {
-	RelativePath string // Path relative to source directory
-	Size         int64
-	Checksum     uint64 // xxhash of file for integrity
+	RelativePath   string // Path relative to source directory
+	Size           int64
+	Checksum       uint64   // xxhash of file for integrity
+	ChunkChecksums []uint64 // xxhash of each ChecksumChunkSize chunk of the file
 }
 
 // Location represents a position within a source file where a hash was found.
@@ -233,6 +295,14 @@ type ESReader interface {
 	ReadAudioSubStreamData(subStreamID byte, esOffset int64, size int) ([]byte, error)
 }
 
+// LPCMSampleSizer is implemented by ES readers whose LPCM sub-streams are
+// stored big-endian and byte-swapped on read to match MKV's little-endian PCM.
+type LPCMSampleSizer interface {
+	// LPCMSampleSize returns the sample size in bytes (2 or 3) of a
+	// byte-swapped LPCM sub-stream, or 0 for any other sub-stream.
+	LPCMSampleSize(subStreamID byte) int
+}
+
 // PESRangeProvider provides access to PES payload ranges for building range maps.
 // Both MPEGPSParser and MPEGTSParser implement this.
 type PESRangeProvider interface {
@@ -292,6 +362,14 @@ type Index struct {
 	// rather than raw file offsets. True for DVD (MPEG-PS) sources.
 	UsesESOffsets bool
 
+	// SkippedStreams lists the source streams left out of the index by
+	// the Indexer's stream filter, in the order they were found.
+	SkippedStreams []SkippedStream
+
+	// sorted holds the locations instead of HashToLocations when the index
+	// was too large for memory (see Indexer.SetMaxMemory).
+	sorted *sortedIndex
+
 	// sortOnce ensures SortLocationsByOffset runs only once.
 	sortOnce sync.Once
 }
@@ -309,22 +387,55 @@ func NewIndex(sourceDir string, sourceType Type, windowSize int) *Index {
 // SortLocationsByOffset sorts all location slices by (FileIndex, Offset).
 // This is a one-time cost at match setup time that enables binary search
 // for nearby locations during matching. Must be called before concurrent access.
+// A sorted index already returns its locations in this order.
 func (idx *Index) SortLocationsByOffset() {
 	idx.sortOnce.Do(func() {
-		for hash, locs := range idx.HashToLocations {
+		for _, locs := range idx.HashToLocations {
 			if len(locs) > 1 {
-				sort.Slice(locs, func(i, j int) bool {
-					if locs[i].FileIndex != locs[j].FileIndex {
-						return locs[i].FileIndex < locs[j].FileIndex
-					}
-					return locs[i].Offset < locs[j].Offset
-				})
-				idx.HashToLocations[hash] = locs
+				slices.SortFunc(locs, compareLocations)
 			}
 		}
 	})
 }
 
+// HashCount returns the number of distinct hashes in the index.
+func (idx *Index) HashCount() int {
+	if idx.sorted != nil {
+		return idx.sorted.hashes
+	}
+	return len(idx.HashToLocations)
+}
+
+// LocationCount returns the number of locations in the index.
+func (idx *Index) LocationCount() int {
+	if idx.sorted != nil {
+		return idx.sorted.records
+	}
+	n := 0
+	for _, locs := range idx.HashToLocations {
+		n += len(locs)
+	}
+	return n
+}
+
+// Sorted reports whether the index is a sorted index file rather than an
+// in-memory hash table.
+func (idx *Index) Sorted() bool {
+	return idx.sorted != nil
+}
+
+// forEachHash calls fn with each hash of the index and its locations. The
+// locations are only valid during the call.
+func (idx *Index) forEachHash(fn func(hash uint64, locs []Location)) {
+	if idx.sorted != nil {
+		idx.sorted.forEach(fn)
+		return
+	}
+	for hash, locs := range idx.HashToLocations {
+		fn(hash, locs)
+	}
+}
+
 // EnumerateMediaFiles returns the list of media files to index based on source type.
 func EnumerateMediaFiles(dir string, sourceType Type) ([]string, error) {
 	var files []string
@@ -345,6 +456,10 @@ func EnumerateMediaFiles(dir string, sourceType Type) ([]string, error) {
 		}
 		files = append(files, isos...)
 
+		// Unpacked VIDEO_TS directories: content VOBs in stream order,
+		// so each title set's VOB set is contiguous (see VOBSets).
+		files = append(files, findContentVOBFiles(dir)...)
+
 	case TypeBluray:
 		// Look for m2ts files in BDMV/STREAM (extracted Blu-ray)
 		m2ts, err := filepath.Glob(filepath.Join(dir, "BDMV", "STREAM", "*.m2ts"))
@@ -353,7 +468,9 @@ func EnumerateMediaFiles(dir string, sourceType Type) ([]string, error) {
 		}
 		files = append(files, m2ts...)
 
-		// If no extracted M2TS files, look for Blu-ray ISOs
+		// If no extracted M2TS files, look for Blu-ray ISOs. This also picks
+		// up any DVD ISOs of a mixed multi-disc directory; the indexer
+		// classifies each ISO individually.
 		if len(files) == 0 {
 			isos, err := filepath.Glob(filepath.Join(dir, "*.iso"))
 			if err != nil {
@@ -368,6 +485,28 @@ func EnumerateMediaFiles(dir string, sourceType Type) ([]string, error) {
 			}
 			files = append(files, isos...)
 		}
+
+	case TypeMPEGTS:
+		// Transport stream recordings (DVR captures, broadcast dumps)
+		ts, err := findTSFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, ts...)
+
+	case TypeMP4:
+		mp4s, err := findMP4Files(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, mp4s...)
+
+	case TypeMKV:
+		mkvs, err := findMKVFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, mkvs...)
 	}
 
 	// Convert to relative paths
@@ -383,6 +522,68 @@ func EnumerateMediaFiles(dir string, sourceType Type) ([]string, error) {
 	return relFiles, nil
 }
 
+// findTSFiles returns the .ts recordings in dir and in its immediate
+// subdirectories (same layout as accepted for ISOs).
+func findTSFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.ts"))
+	if err != nil {
+		return nil, err
+	}
+	sub, err := filepath.Glob(filepath.Join(dir, "*", "*.ts"))
+	if err != nil {
+		return nil, err
+	}
+	return append(files, sub...), nil
+}
+
+// mp4Extensions lists the (lower-case) file extensions of ISO base media files.
+var mp4Extensions = map[string]bool{".mp4": true, ".m4v": true, ".mov": true}
+
+// mkvExtensions lists the (lower-case) file extensions of Matroska files.
+var mkvExtensions = map[string]bool{".mkv": true}
+
+// findMP4Files returns the MP4/MOV files in dir and in its immediate
+// subdirectories. Extensions are matched case-insensitively, since camera
+// footage commonly uses upper-case names (e.g. C0001.MP4).
+func findMP4Files(dir string) ([]string, error) {
+	return findFilesByExtension(dir, mp4Extensions)
+}
+
+// findMKVFiles returns the MKV files in dir and in its immediate subdirectories.
+func findMKVFiles(dir string) ([]string, error) {
+	return findFilesByExtension(dir, mkvExtensions)
+}
+
+// findFilesByExtension returns the files in dir, then those in its immediate
+// subdirectories, whose lower-cased extension is in exts.
+func findFilesByExtension(dir string, exts map[string]bool) ([]string, error) {
+	var files []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var subFiles []string
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if !e.IsDir() {
+			if exts[strings.ToLower(filepath.Ext(e.Name()))] {
+				files = append(files, path)
+			}
+			continue
+		}
+		subEntries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, se := range subEntries {
+			if !se.IsDir() && exts[strings.ToLower(filepath.Ext(se.Name()))] {
+				subFiles = append(subFiles, filepath.Join(path, se.Name()))
+			}
+		}
+	}
+	return append(files, subFiles...), nil
+}
+
 // GetFileInfo returns size information for a file.
 func GetFileInfo(path string) (int64, error) {
 	info, err := os.Stat(path)
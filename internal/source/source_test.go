@@ -3,7 +3,10 @@ package source
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 func TestDetectType_DVD(t *testing.T) {
@@ -149,6 +152,47 @@ func TestEnumerateMediaFiles_Bluray(t *testing.T) {
 	}
 }
 
+func TestDetectType_MPEGTS(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "recording.ts"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceType, err := DetectType(tmpDir)
+	if err != nil {
+		t.Fatalf("DetectType() error = %v", err)
+	}
+	if sourceType != TypeMPEGTS {
+		t.Errorf("DetectType() = %v, want %v", sourceType, TypeMPEGTS)
+	}
+}
+
+func TestEnumerateMediaFiles_MPEGTS(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "2024-01-01")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{
+		filepath.Join(tmpDir, "a.ts"),
+		filepath.Join(subDir, "b.ts"),
+		filepath.Join(tmpDir, "notes.txt"),
+	} {
+		if err := os.WriteFile(p, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := EnumerateMediaFiles(tmpDir, TypeMPEGTS)
+	if err != nil {
+		t.Fatalf("EnumerateMediaFiles() error = %v", err)
+	}
+	want := []string{"a.ts", filepath.Join("2024-01-01", "b.ts")}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Errorf("EnumerateMediaFiles() = %v, want %v", files, want)
+	}
+}
+
 func TestGetFileInfo(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.bin")
@@ -443,6 +487,9 @@ func TestType_String_AllTypes(t *testing.T) {
 	}{
 		{TypeDVD, "DVD"},
 		{TypeBluray, "Blu-ray"},
+		{TypeMPEGTS, "MPEG-TS"},
+		{TypeMP4, "MP4"},
+		{TypeMKV, "MKV"},
 		{Type(-1), "Unknown"},
 		{Type(100), "Unknown"},
 	}
@@ -498,3 +545,35 @@ func TestNewIndex_Fields(t *testing.T) {
 		t.Errorf("HashToLocations should be empty, has %d entries", len(idx.HashToLocations))
 	}
 }
+
+func TestChunkHasher(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	want := []uint64{
+		xxhash.Sum64(data[0:32]),
+		xxhash.Sum64(data[32:64]),
+		xxhash.Sum64(data[64:96]),
+		xxhash.Sum64(data[96:100]),
+	}
+
+	// Writes of varying sizes that straddle chunk boundaries
+	h := NewChunkHasher(32)
+	for _, w := range [][2]int{{0, 5}, {5, 40}, {40, 64}, {64, 100}} {
+		h.Write(data[w[0]:w[1]])
+	}
+	if got := h.ChunkSums(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChunkSums() = %x, want %x", got, want)
+	}
+	if got := h.Sum64(); got != xxhash.Sum64(data) {
+		t.Errorf("Sum64() = %x, want %x", got, xxhash.Sum64(data))
+	}
+
+	// A file that is an exact multiple of the chunk size has no partial chunk
+	h = NewChunkHasher(32)
+	h.Write(data[:64])
+	if got := h.ChunkSums(); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("ChunkSums(64 bytes) = %x, want %x", got, want[:2])
+	}
+}
@@ -0,0 +1,275 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+// StreamFilter selects the source streams worth indexing for an MKV: those
+// whose codec, and for DVD audio channel count, matches one of its tracks.
+// A foreign-language dub or commentary the MKV did not keep is then neither
+// hashed nor held in the index.
+//
+// Codecs are compared by family, so an MKV's DTS core keeps the DTS-HD
+// stream it came from. Channel counts are only compared between streams of
+// the same codec, and only where the source declares them (DVD IFOs).
+// Source streams of an unknown codec, and all streams of a type for which
+// the MKV has a track of unknown codec, are kept.
+type StreamFilter struct {
+	tracks []filterTrack
+	anyOf  map[int]bool // MKV track types with a track of unknown codec
+}
+
+// filterTrack is a track of the MKV a StreamFilter keeps streams for.
+type filterTrack struct {
+	codec    CodecType
+	channels int // 0 = unknown
+}
+
+// NewStreamFilter returns a filter keeping the source streams the given
+// MKV tracks could have been made from.
+func NewStreamFilter(tracks []mkv.Track) *StreamFilter {
+	f := &StreamFilter{anyOf: make(map[int]bool)}
+	for _, track := range tracks {
+		if track.Type != mkv.TrackTypeVideo && track.Type != mkv.TrackTypeAudio && track.Type != mkv.TrackTypeSubtitle {
+			continue
+		}
+		ct := MKVTrackCodecType(track.CodecID, track.CodecPrivate)
+		if codecTrackType(ct) != track.Type {
+			f.anyOf[track.Type] = true
+			continue
+		}
+		t := filterTrack{codec: ct}
+		if track.Type == mkv.TrackTypeAudio {
+			t.channels = int(track.Channels)
+		}
+		if !slices.Contains(f.tracks, t) {
+			f.tracks = append(f.tracks, t)
+		}
+	}
+	// The order of the tracks does not change what is kept, nor the
+	// description that cached indexes are keyed by.
+	slices.SortFunc(f.tracks, func(a, b filterTrack) int {
+		if a.codec != b.codec {
+			return int(a.codec) - int(b.codec)
+		}
+		return a.channels - b.channels
+	})
+	return f
+}
+
+// keeps reports whether a source stream of the given codec and channel
+// count (0 = unknown) is indexed.
+func (f *StreamFilter) keeps(codec CodecType, channels int) bool {
+	trackType := codecTrackType(codec)
+	if trackType == 0 || f.anyOf[trackType] {
+		return true
+	}
+	for _, t := range f.tracks {
+		if codecFamily(t.codec) != codecFamily(codec) {
+			continue
+		}
+		if t.codec == codec && t.channels > 0 && channels > 0 && t.channels != channels {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// String describes the streams the filter keeps, e.g. "MPEG-2, AC3 6ch,
+// VobSub".
+func (f *StreamFilter) String() string {
+	var parts []string
+	for _, t := range f.tracks {
+		if t.channels > 0 {
+			parts = append(parts, fmt.Sprintf("%s %dch", CodecTypeName(t.codec), t.channels))
+		} else {
+			parts = append(parts, CodecTypeName(t.codec))
+		}
+	}
+	for _, tt := range []struct {
+		trackType int
+		name      string
+	}{
+		{mkv.TrackTypeVideo, "any video"},
+		{mkv.TrackTypeAudio, "any audio"},
+		{mkv.TrackTypeSubtitle, "any subtitles"},
+	} {
+		if f.anyOf[tt.trackType] {
+			parts = append(parts, tt.name)
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// codecTrackType returns the MKV track type holding a codec, or 0 for an
+// unknown codec.
+func codecTrackType(ct CodecType) int {
+	switch {
+	case IsVideoCodec(ct):
+		return mkv.TrackTypeVideo
+	case IsAudioCodec(ct):
+		return mkv.TrackTypeAudio
+	case IsSubtitleCodec(ct):
+		return mkv.TrackTypeSubtitle
+	}
+	return 0
+}
+
+// SkippedStream is a source stream a StreamFilter left out of an index.
+type SkippedStream struct {
+	FileIndex   uint16    // Source file entry holding the stream
+	IsVideo     bool      // The video ES rather than a sub-stream
+	SubStreamID byte      // Audio or subtitle sub-stream, unless IsVideo
+	Codec       CodecType // Codec of the stream
+	Channels    int       // Audio channel count declared by the source (0 = unknown)
+}
+
+// String describes the stream, e.g. "sub-stream 0x81 (AC3 2ch)".
+func (s SkippedStream) String() string {
+	desc := CodecTypeName(s.Codec)
+	if s.Channels > 0 {
+		desc = fmt.Sprintf("%s %dch", desc, s.Channels)
+	}
+	if s.IsVideo {
+		return fmt.Sprintf("video (%s)", desc)
+	}
+	return fmt.Sprintf("sub-stream 0x%02X (%s)", s.SubStreamID, desc)
+}
+
+// SkippedStreamsFor returns the streams left out of the index that an MKV
+// track could have been made from: those of its codec family, or of its
+// type for a track of unknown codec.
+func (idx *Index) SkippedStreamsFor(track mkv.Track) []SkippedStream {
+	ct := MKVTrackCodecType(track.CodecID, track.CodecPrivate)
+	var streams []SkippedStream
+	for _, s := range idx.SkippedStreams {
+		if codecFamily(s.Codec) == codecFamily(ct) && ct != CodecUnknown ||
+			ct == CodecUnknown && codecTrackType(s.Codec) == track.Type {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
+
+// SetStreamFilter restricts the index to the source streams f keeps.
+// Pass nil to index every stream. The streams left out are listed in
+// Index.SkippedStreams.
+func (idx *Indexer) SetStreamFilter(f *StreamFilter) {
+	idx.streams = f
+}
+
+// skipStream reports whether the stream filter leaves out a source stream
+// of the given codec and channel count (0 = unknown), recording the streams
+// it does.
+func (idx *Indexer) skipStream(fileIndex uint16, isVideo bool, subStreamID byte, codec CodecType, channels int) bool {
+	if idx.streams == nil || idx.streams.keeps(codec, channels) {
+		return false
+	}
+	s := SkippedStream{
+		FileIndex:   fileIndex,
+		IsVideo:     isVideo,
+		SubStreamID: subStreamID,
+		Codec:       codec,
+		Channels:    channels,
+	}
+	idx.index.SkippedStreams = append(idx.index.SkippedStreams, s)
+	idx.verbosef("  Skipping %s: no matching MKV track\n", s)
+	return true
+}
+
+// dvdISOChannels returns the audio channel counts the VTS IFOs of a DVD ISO
+// declare, keyed by sub-stream ID (see parseDVDIFOAudioChannels), or nil
+// without a stream filter to use them. With a title, only its title set's
+// IFO is read; otherwise a sub-stream whose title sets disagree is left
+// out, as its channel count is not known.
+func (idx *Indexer) dvdISOChannels(path string) map[byte]int {
+	if idx.streams == nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	ifos := findIFOsInISO(f)
+	if len(ifos) == 0 {
+		if ifos, err = findIFOsInUDF(f); err != nil {
+			return nil
+		}
+	}
+	var sets []map[byte]int
+	for _, ifo := range ifos {
+		if idx.title != nil && ifo.Name != fmt.Sprintf("VTS_%02d_0.IFO", idx.title.TitleSet) {
+			continue
+		}
+		data, err := readISOFileExtent(f, ifo, vtsMATReadSize)
+		if err != nil {
+			continue
+		}
+		if channels, err := parseDVDIFOAudioChannels(data); err == nil {
+			sets = append(sets, channels)
+		}
+	}
+	return mergeDVDChannels(sets)
+}
+
+// dvdVOBSetChannels returns the audio channel counts declared by the IFO of
+// the title set whose first VOB is at path, or nil without a stream filter
+// to use them.
+func (idx *Indexer) dvdVOBSetChannels(path string) map[byte]int {
+	if idx.streams == nil {
+		return nil
+	}
+	// VTS_xx_1.VOB is described by VTS_xx_0.IFO, named in either case
+	dir, name := filepath.Split(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(name) != 12 {
+		return nil
+	}
+	want := strings.ToUpper(name[:7]) + "0.IFO"
+	for _, e := range entries {
+		if strings.ToUpper(e.Name()) != want {
+			continue
+		}
+		data, err := readIFOHeader(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil
+		}
+		channels, err := parseDVDIFOAudioChannels(data)
+		if err != nil {
+			return nil
+		}
+		return channels
+	}
+	return nil
+}
+
+// mergeDVDChannels merges the channel counts of several title sets,
+// leaving out the sub-streams they disagree on.
+func mergeDVDChannels(sets []map[byte]int) map[byte]int {
+	merged := make(map[byte]int)
+	conflict := make(map[byte]bool)
+	for _, channels := range sets {
+		for id, n := range channels {
+			if m, ok := merged[id]; ok && m != n {
+				conflict[id] = true
+			}
+			merged[id] = n
+		}
+	}
+	for id := range conflict {
+		delete(merged, id)
+	}
+	return merged
+}
@@ -0,0 +1,238 @@
+package source
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stuckj/mkvdup/internal/mkv"
+)
+
+func TestStreamFilter_Keeps(t *testing.T) {
+	f := NewStreamFilter([]mkv.Track{
+		{Number: 1, Type: mkv.TrackTypeVideo, CodecID: "V_MPEG2"},
+		{Number: 2, Type: mkv.TrackTypeAudio, CodecID: "A_AC3", Channels: 6},
+		{Number: 3, Type: mkv.TrackTypeAudio, CodecID: "A_DTS", Channels: 6},
+		{Number: 4, Type: mkv.TrackTypeSubtitle, CodecID: "S_TEXT/UTF8"},
+		{Number: 5, Type: mkv.TrackTypeAudio, CodecID: "A_AC3", Channels: 6},
+	})
+	if got, want := f.String(), "MPEG-2, AC3 6ch, DTS 6ch, any subtitles"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, tt := range []struct {
+		codec    CodecType
+		channels int
+		want     bool
+	}{
+		{CodecMPEG2Video, 0, true},
+		{CodecMPEG1Video, 0, true}, // same family
+		{CodecH264Video, 0, false},
+		{CodecAC3Audio, 6, true},
+		{CodecAC3Audio, 0, true}, // channels unknown
+		{CodecAC3Audio, 2, false},
+		{CodecEAC3Audio, 2, true}, // channels only compared within a codec
+		{CodecDTSHDAudio, 8, true},
+		{CodecTrueHDAudio, 8, false},
+		{CodecLPCMAudio, 2, false},
+		{CodecVobSub, 0, true}, // a subtitle track of unknown codec keeps all
+		{CodecPGSSubtitle, 0, true},
+		{CodecUnknown, 0, true},
+	} {
+		if got := f.keeps(tt.codec, tt.channels); got != tt.want {
+			t.Errorf("keeps(%s, %d) = %v, want %v", CodecTypeName(tt.codec), tt.channels, got, tt.want)
+		}
+	}
+}
+
+func TestParseDVDIFOAudioChannels(t *testing.T) {
+	// AC3 5.1, AC3 2.0, DTS 5.1, LPCM stereo and an MPEG-1 mono stream
+	data := buildTestIFO(1, [][2]byte{{0, 5}, {0, 1}, {6, 5}, {4, 1}, {2, 0}})
+	channels, err := parseDVDIFOAudioChannels(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[byte]int{0x80: 6, 0x81: 2, 0x8A: 6, 0xA3: 2, 0xC4: 1}
+	if !reflect.DeepEqual(channels, want) {
+		t.Errorf("channels = %v, want %v", channels, want)
+	}
+
+	merged := mergeDVDChannels([]map[byte]int{{0x80: 6, 0x81: 2}, {0x80: 2, 0x82: 6}})
+	if want := map[byte]int{0x81: 2, 0x82: 6}; !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged channels = %v, want %v", merged, want)
+	}
+}
+
+func TestBuild_StreamFilter(t *testing.T) {
+	videoFill := []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70}
+	vob := bytes.Join([][]byte{
+		buildTestDVDPack(0xE0, 0, videoFill),
+		buildTestDVDPack(0xBD, 0x80, []byte{0x0B, 0x77, 0xAA, 0xBB}),
+		buildTestDVDPack(0xBD, 0x81, []byte{0x0B, 0x77, 0xCC, 0xDD}),
+		buildTestDVDPack(0xE0, 0, videoFill[1:]),
+	}, nil)
+
+	for _, tt := range []struct {
+		name   string
+		files  map[string][]byte
+		tracks []mkv.Track
+		want   []SkippedStream
+	}{
+		{
+			// The commentary differs from the main audio only in its
+			// channel count, which the IFO declares
+			name: "VOB sets",
+			files: map[string][]byte{
+				"VIDEO_TS/VTS_01_0.IFO": buildTestIFO(1, [][2]byte{{0, 5}, {0, 1}}),
+				"VIDEO_TS/VTS_01_1.VOB": vob,
+				"VIDEO_TS/VTS_02_1.VOB": vob,
+			},
+			tracks: []mkv.Track{
+				{Type: mkv.TrackTypeVideo, CodecID: "V_MPEG2"},
+				{Type: mkv.TrackTypeAudio, CodecID: "A_AC3", Channels: 6},
+			},
+			// Without an IFO, the channels of the second set are unknown
+			want: []SkippedStream{{FileIndex: 0, SubStreamID: 0x81, Codec: CodecAC3Audio, Channels: 2}},
+		},
+		{
+			name: "M2TS",
+			files: map[string][]byte{
+				"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+				"BDMV/STREAM/00002.m2ts": buildTrueHDAC3M2TSData(),
+			},
+			tracks: []mkv.Track{
+				{Type: mkv.TrackTypeVideo, CodecID: "V_MPEG4/ISO/AVC"},
+				{Type: mkv.TrackTypeAudio, CodecID: "A_TRUEHD", Channels: 8},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestSource(t, tt.files)
+			build := func(f *StreamFilter, workers int) *Index {
+				t.Helper()
+				indexer, err := NewIndexer(dir, MinWindowSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				indexer.SetStreamFilter(f)
+				indexer.SetWorkers(workers)
+				if err := indexer.Build(nil); err != nil {
+					t.Fatalf("Build: %v", err)
+				}
+				t.Cleanup(func() { indexer.Index().Close() })
+				return indexer.Index()
+			}
+
+			full := build(nil, 1)
+			filtered := build(NewStreamFilter(tt.tracks), 1)
+			if len(full.SkippedStreams) != 0 {
+				t.Errorf("unfiltered index skipped %v", full.SkippedStreams)
+			}
+			if tt.want != nil && !reflect.DeepEqual(filtered.SkippedStreams, tt.want) {
+				t.Errorf("SkippedStreams = %+v, want %+v", filtered.SkippedStreams, tt.want)
+			}
+			if len(filtered.SkippedStreams) == 0 {
+				t.Fatal("filter skipped no stream")
+			}
+
+			// The filtered index holds exactly the locations of the
+			// streams it kept
+			skipped := make(map[[2]int]bool)
+			for _, s := range filtered.SkippedStreams {
+				skipped[[2]int{int(s.FileIndex), int(s.SubStreamID)}] = true
+			}
+			want := make(map[uint64][]Location)
+			for hash, locs := range full.HashToLocations {
+				for _, loc := range locs {
+					if loc.IsVideo || !skipped[[2]int{int(loc.FileIndex), int(loc.AudioSubStreamID)}] {
+						want[hash] = append(want[hash], loc)
+					}
+				}
+			}
+			if !reflect.DeepEqual(filtered.HashToLocations, want) {
+				t.Errorf("filtered index has %d hashes, want %d", len(filtered.HashToLocations), len(want))
+			}
+
+			parallel := build(NewStreamFilter(tt.tracks), 4)
+			if !reflect.DeepEqual(parallel.SkippedStreams, filtered.SkippedStreams) ||
+				!reflect.DeepEqual(parallel.HashToLocations, filtered.HashToLocations) {
+				t.Errorf("parallel build skipped %+v, want %+v", parallel.SkippedStreams, filtered.SkippedStreams)
+			}
+		})
+	}
+}
+
+func TestIndexCache_StreamFilter(t *testing.T) {
+	dir := writeTestSource(t, map[string][]byte{
+		"BDMV/STREAM/00001.m2ts": buildTrueHDAC3M2TSData(),
+	})
+	cache, err := NewIndexCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := NewStreamFilter([]mkv.Track{{Type: mkv.TrackTypeAudio, CodecID: "A_AC3"}})
+	newIndexer := func(f *StreamFilter) *Indexer {
+		t.Helper()
+		indexer, err := NewIndexer(dir, MinWindowSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexer.SetStreamFilter(f)
+		t.Cleanup(func() { indexer.Index().Close() })
+		return indexer
+	}
+
+	// An index of every stream serves a filtered build
+	full := newIndexer(nil)
+	if err := full.Build(nil); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := full.SaveCache(cache); err != nil {
+		t.Fatalf("SaveCache: %v", err)
+	}
+	indexer := newIndexer(filter)
+	if loaded, err := indexer.LoadCache(cache); !loaded || err != nil {
+		t.Fatalf("LoadCache with a filter and only a full index cached = %v, %v", loaded, err)
+	}
+	if got := indexer.Index(); len(got.SkippedStreams) != 0 || got.HashCount() != full.Index().HashCount() {
+		t.Errorf("loaded %d hashes, skipping %v; want the full index of %d", got.HashCount(), got.SkippedStreams, full.Index().HashCount())
+	}
+
+	// A filtered index is cached apart from it, with its skipped streams
+	built := newIndexer(filter)
+	if err := built.Build(nil); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := built.SaveCache(cache); err != nil {
+		t.Fatalf("SaveCache: %v", err)
+	}
+	indexer = newIndexer(filter)
+	if loaded, err := indexer.LoadCache(cache); !loaded || err != nil {
+		t.Fatalf("LoadCache = %v, %v", loaded, err)
+	}
+	if got, want := indexer.Index(), built.Index(); !reflect.DeepEqual(got.SkippedStreams, want.SkippedStreams) ||
+		len(want.SkippedStreams) == 0 || got.HashCount() != want.HashCount() {
+		t.Errorf("loaded %d hashes, skipping %v; want %d, skipping %v",
+			got.HashCount(), got.SkippedStreams, want.HashCount(), want.SkippedStreams)
+	}
+	indexer = newIndexer(nil)
+	if loaded, err := indexer.LoadCache(cache); !loaded || err != nil {
+		t.Fatalf("LoadCache without a filter = %v, %v", loaded, err)
+	}
+	if len(indexer.Index().SkippedStreams) != 0 {
+		t.Error("LoadCache without a filter loaded the filtered index")
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopes := make(map[string]bool)
+	for _, e := range entries {
+		scopes[e.Scope] = true
+	}
+	if want := map[string]bool{"": true, "streams AC3": true}; !reflect.DeepEqual(scopes, want) {
+		t.Errorf("cached scopes = %v, want %v", scopes, want)
+	}
+}
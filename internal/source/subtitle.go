@@ -26,3 +26,26 @@ func isValidPGSSegmentType(t byte) bool {
 	}
 	return false
 }
+
+// IsVobSubSubStreamID reports whether a DVD Private Stream 1 sub-stream ID
+// (0x20-0x3F) carries subpictures.
+func IsVobSubSubStreamID(id byte) bool {
+	return id >= 0x20 && id <= 0x3F
+}
+
+// FindVobSubSyncPoints returns the start of a DVD subpicture unit (SPU) if data
+// begins with one. An SPU starts with its total size (2 bytes BE) followed by
+// the offset of its first display control sequence (2 bytes BE), which lies
+// after the header and inside the SPU. An SPU begins a new PES packet on the
+// disc and a new block in an S_VOBSUB track, so only the start is checked.
+func FindVobSubSyncPoints(data []byte) []int {
+	if len(data) < 4 {
+		return nil
+	}
+	size := int(data[0])<<8 | int(data[1])
+	dcsq := int(data[2])<<8 | int(data[3])
+	if dcsq < 4 || dcsq >= size {
+		return nil
+	}
+	return []int{0}
+}
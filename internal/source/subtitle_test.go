@@ -105,3 +105,39 @@ func TestIsValidPGSSegmentType(t *testing.T) {
 		}
 	}
 }
+
+func TestFindVobSubSyncPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []int
+	}{
+		{"empty", nil, nil},
+		{"too short", []byte{0x08, 0x00, 0x00}, nil},
+		// SPU of 0x0800 bytes with its control sequence at 0x07F0
+		{"SPU start", []byte{0x08, 0x00, 0x07, 0xF0, 0x00}, []int{0}},
+		{"control sequence outside SPU", []byte{0x00, 0x10, 0x00, 0x20}, nil},
+		{"control sequence inside header", []byte{0x08, 0x00, 0x00, 0x02}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindVobSubSyncPoints(tt.data)
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("FindVobSubSyncPoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsVobSubSubStreamID(t *testing.T) {
+	for _, id := range []byte{0x20, 0x2F, 0x3F} {
+		if !IsVobSubSubStreamID(id) {
+			t.Errorf("IsVobSubSubStreamID(0x%02X) = false, want true", id)
+		}
+	}
+	for _, id := range []byte{0x1F, 0x40, 0x80, 0xA0} {
+		if IsVobSubSubStreamID(id) {
+			t.Errorf("IsVobSubSubStreamID(0x%02X) = true, want false", id)
+		}
+	}
+}
@@ -223,6 +223,77 @@ func findBlurayM2TSInUDF(f *os.File) ([]isoFileExtent, error) {
 	return m2tsFiles, nil
 }
 
+// findBDMVFilesInUDF navigates a UDF filesystem to find the files under
+// BDMV/<dir>/ whose names end in suffix (upper case, e.g. ".CLPI").
+func findBDMVFilesInUDF(f *os.File, dir, suffix string) ([]isoFileExtent, error) {
+	ctx, err := newUDFContext(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rootFIDs, err := ctx.readDirectoryFromFE(ctx.rootFE)
+	if err != nil {
+		return nil, fmt.Errorf("read UDF root directory: %w", err)
+	}
+
+	bdmvFE, err := ctx.lookupDir(rootFIDs, "BDMV")
+	if err != nil {
+		return nil, fmt.Errorf("find BDMV: %w", err)
+	}
+
+	bdmvFIDs, err := ctx.readDirectoryFromFE(bdmvFE)
+	if err != nil {
+		return nil, fmt.Errorf("read BDMV directory: %w", err)
+	}
+
+	subFE, err := ctx.lookupDir(bdmvFIDs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("find %s: %w", dir, err)
+	}
+
+	subFIDs, err := ctx.readDirectoryFromFE(subFE)
+	if err != nil {
+		return nil, fmt.Errorf("read %s directory: %w", dir, err)
+	}
+
+	var files []isoFileExtent
+	for _, fid := range subFIDs {
+		if fid.IsDir || fid.IsParent {
+			continue
+		}
+		name := strings.ToUpper(fid.Name)
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		fe, err := ctx.readFileEntryAt(fid.ICBLocation)
+		if err != nil {
+			continue
+		}
+
+		extents, err := ctx.resolveAllExtents(fe)
+		if err != nil || len(extents) == 0 {
+			continue
+		}
+
+		file := isoFileExtent{
+			Name:   name,
+			Offset: extents[0].ISOOffset,
+			Size:   int64(fe.InfoLength),
+			IsDir:  false,
+		}
+		if !extentsContiguous(extents) {
+			file.Extents = extents
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files found in UDF BDMV/%s/", suffix, dir)
+	}
+	return files, nil
+}
+
 // udfContext holds the parsed UDF volume structures needed for navigation.
 type udfContext struct {
 	f          *os.File
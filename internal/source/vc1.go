@@ -0,0 +1,66 @@
+package source
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// VC-1 advanced profile (SMPTE 421M) elementary streams are divided into
+// bitstream data units (BDUs), each introduced by a 4-byte start code:
+//
+//	00 00 01 0F: sequence header
+//	00 00 01 0E: entry-point header
+//	00 00 01 0D: frame
+//	00 00 01 0C: field
+//	00 00 01 0B: slice
+//
+// MKV (V_MS/VFW/FOURCC with a WVC1 BITMAPINFOHEADER) stores each frame
+// without its frame start code: a packet starts with the frame header itself,
+// or with the sequence and entry-point headers when they are repeated before
+// a frame. The remaining start codes are kept.
+
+// VC1FrameStartCode is the BDU type of a VC-1 frame start code.
+const VC1FrameStartCode = 0x0D
+
+// bitmapInfoHeaderSize is the size of the BITMAPINFOHEADER at the start of a
+// V_MS/VFW/FOURCC CodecPrivate.
+const bitmapInfoHeaderSize = 40
+
+// bitmapInfoFourCC returns the biCompression FourCC of the BITMAPINFOHEADER
+// in a V_MS/VFW/FOURCC CodecPrivate, or "" if it is too short.
+func bitmapInfoFourCC(codecPrivate []byte) string {
+	if len(codecPrivate) < bitmapInfoHeaderSize || binary.LittleEndian.Uint32(codecPrivate) < bitmapInfoHeaderSize {
+		return ""
+	}
+	return string(codecPrivate[16:20])
+}
+
+// FindVC1IndexSyncPoints returns the sync points indexed in a VC-1 source ES:
+// the byte after each start code, as for other start-code video, and the
+// byte after each frame start code, where the corresponding MKV packet
+// begins.
+func FindVC1IndexSyncPoints(data []byte) []int {
+	offsets := FindVideoNALStarts(data)
+	if len(offsets) == 0 {
+		return offsets
+	}
+	result := make([]int, 0, len(offsets)+len(offsets)/4)
+	for _, off := range offsets {
+		result = append(result, off)
+		if data[off] == VC1FrameStartCode && off+1 < len(data) {
+			result = append(result, off+1)
+		}
+	}
+	return result
+}
+
+// FindVC1MatchSyncPoints returns the sync points hashed in an MKV VC-1
+// packet: the packet start when it is a frame header (its start code having
+// been stripped), plus the byte after each remaining start code.
+func FindVC1MatchSyncPoints(data []byte) []int {
+	offsets := FindVideoNALStarts(data)
+	if len(data) > 0 && !bytes.HasPrefix(data, []byte{0x00, 0x00, 0x01}) {
+		offsets = append([]int{0}, offsets...)
+	}
+	return offsets
+}
@@ -0,0 +1,62 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindVC1IndexSyncPoints(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, 0x01, 0x0F, 0xAA, 0xBB, // sequence header
+		0x00, 0x00, 0x01, 0x0E, 0xCC, // entry point
+		0x00, 0x00, 0x01, 0x0D, 0x11, 0x22, 0x33, // frame
+		0x00, 0x00, 0x01, 0x0C, 0x44, // field
+		0x00, 0x00, 0x01, 0x0D, // frame start code with no payload yet
+	}
+	want := []int{3, 9, 14, 15, 21, 26}
+	if got := FindVC1IndexSyncPoints(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindVC1IndexSyncPoints() = %v, want %v", got, want)
+	}
+	if got := FindVC1IndexSyncPoints([]byte{0x11, 0x22}); len(got) != 0 {
+		t.Errorf("FindVC1IndexSyncPoints(no start codes) = %v, want none", got)
+	}
+}
+
+func TestFindVC1MatchSyncPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []int
+	}{
+		{"frame header first", []byte{0x11, 0x22, 0x00, 0x00, 0x01, 0x0C, 0x44}, []int{0, 5}},
+		{"sequence header first", []byte{0x00, 0x00, 0x01, 0x0F, 0xAA, 0x00, 0x00, 0x01, 0x0E, 0xCC}, []int{3, 8}},
+		{"frame header only", []byte{0x11, 0x22, 0x33}, []int{0}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := FindVC1MatchSyncPoints(tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: FindVC1MatchSyncPoints() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVC1SyncPointsAlign(t *testing.T) {
+	// The frame payload that MKV stores without its start code is indexed at
+	// the position the matcher hashes from the packet start.
+	frame := seqBytes(0x40, 80)
+	source := append([]byte{0x00, 0x00, 0x01, 0x0D}, frame...)
+	indexed := FindVC1IndexSyncPoints(source)
+	probed := FindVC1MatchSyncPoints(frame)
+	if len(probed) == 0 || probed[0] != 0 {
+		t.Fatalf("FindVC1MatchSyncPoints() = %v, want the packet start", probed)
+	}
+	found := false
+	for _, off := range indexed {
+		if off == 4 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("FindVC1IndexSyncPoints() = %v, want the frame payload at 4", indexed)
+	}
+}
@@ -45,18 +45,18 @@ _mkvdup() {
         }
     fi
 
-    local commands="create batch-create probe mount info verify extract check stats validate reload expand-config relocate parse-mkv index-source match deltadiag help"
-    local global_opts="-v --verbose -q --quiet --no-progress --log-file --log-verbose -h --help --version"
+    local commands="create batch-create probe mount info verify extract check stats validate reload expand-config relocate upgrade repair prune-delta-store index-cache parse-mkv index-source match deltadiag help"
+    local global_opts="-v --verbose -q --quiet --no-progress --log-file --log-verbose --index-cache --no-index-cache --max-index-memory --index-workers -h --help --version"
 
     # Find the command (first non-option argument after mkvdup)
     local cmd=""
     local i
     for ((i=1; i < cword; i++)); do
         case "${words[i]}" in
-            -v|--verbose|-q|--quiet|--no-progress|--log-verbose|-h|--help|--version)
+            -v|--verbose|-q|--quiet|--no-progress|--log-verbose|--no-index-cache|-h|--help|--version)
                 ;;
-            --log-file)
-                # Skip --log-file and its argument
+            --log-file|--index-cache|--max-index-memory|--index-workers)
+                # Skip the option and its argument
                 ((i++))
                 ;;
             -*)
@@ -76,6 +76,18 @@ _mkvdup() {
                 _filedir
                 return
                 ;;
+            --index-cache)
+                _filedir -d
+                return
+                ;;
+            --max-index-memory)
+                COMPREPLY=($(compgen -W "auto unlimited" -- "$cur"))
+                return
+                ;;
+            --index-workers)
+                COMPREPLY=($(compgen -W "auto" -- "$cur"))
+                return
+                ;;
         esac
         if [[ "$cur" == -* ]]; then
             COMPREPLY=($(compgen -W "$global_opts" -- "$cur"))
@@ -92,7 +104,7 @@ _mkvdup() {
     fi
 
     # Global options available for commands that don't define their own options
-    if [[ "$cur" == -* && "$cmd" != "create" && "$cmd" != "batch-create" && "$cmd" != "mount" && "$cmd" != "check" && "$cmd" != "stats" && "$cmd" != "validate" && "$cmd" != "reload" && "$cmd" != "info" && "$cmd" != "expand-config" && "$cmd" != "relocate" ]]; then
+    if [[ "$cur" == -* && "$cmd" != "create" && "$cmd" != "batch-create" && "$cmd" != "mount" && "$cmd" != "check" && "$cmd" != "stats" && "$cmd" != "validate" && "$cmd" != "reload" && "$cmd" != "info" && "$cmd" != "expand-config" && "$cmd" != "relocate" && "$cmd" != "upgrade" && "$cmd" != "repair" && "$cmd" != "prune-delta-store" && "$cmd" != "index-cache" ]]; then
         COMPREPLY=($(compgen -W "$global_opts" -- "$cur"))
         return
     fi
@@ -101,7 +113,7 @@ _mkvdup() {
     case "$cmd" in
         create)
             # create [options] <mkv-file> <source-dir> [output] [name]
-            local create_opts="--warn-threshold --non-interactive"
+            local create_opts="--warn-threshold --non-interactive --all-streams --checkpoint --resume --checksum --delta-store"
             if [[ "$cur" == -* ]]; then
                 COMPREPLY=($(compgen -W "$create_opts $global_opts" -- "$cur"))
                 return
@@ -111,13 +123,21 @@ _mkvdup() {
                     # Numeric value; no useful completion to offer
                     return
                     ;;
+                --checksum)
+                    COMPREPLY=($(compgen -W "sha256 blake3 sha512 sha1" -- "$cur"))
+                    return
+                    ;;
+                --delta-store)
+                    _filedir -d
+                    return
+                    ;;
             esac
             _filedir
             ;;
 
         batch-create)
             # batch-create [options] <manifest.yaml>
-            local batch_create_opts="--warn-threshold --skip-codec-mismatch"
+            local batch_create_opts="--warn-threshold --skip-codec-mismatch --checksum --delta-store"
             if [[ "$cur" == -* ]]; then
                 COMPREPLY=($(compgen -W "$batch_create_opts $global_opts" -- "$cur"))
                 return
@@ -127,6 +147,14 @@ _mkvdup() {
                     # Numeric value; no useful completion to offer
                     return
                     ;;
+                --checksum)
+                    COMPREPLY=($(compgen -W "sha256 blake3 sha512 sha1" -- "$cur"))
+                    return
+                    ;;
+                --delta-store)
+                    _filedir -d
+                    return
+                    ;;
             esac
             _filedir '@(yaml|yml)'
             ;;
@@ -293,6 +321,82 @@ _mkvdup() {
             _filedir
             ;;
 
+        upgrade)
+            # upgrade [options] <file.mkvdup>... | --config-dir <dir>
+            local upgrade_opts="--dry-run --config-dir --source-dir"
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "$upgrade_opts $global_opts" -- "$cur"))
+                return
+            fi
+            case "$prev" in
+                --source-dir|--config-dir)
+                    _filedir -d
+                    return
+                    ;;
+            esac
+            _filedir mkvdup
+            ;;
+
+        repair)
+            # repair [options] <file.mkvdup>
+            local repair_opts="--from-mkv --from-dedup --source-dir --dry-run"
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "$repair_opts $global_opts" -- "$cur"))
+                return
+            fi
+            case "$prev" in
+                --source-dir)
+                    _filedir -d
+                    return
+                    ;;
+                --from-mkv)
+                    _filedir '@(mkv|MKV)'
+                    return
+                    ;;
+            esac
+            _filedir mkvdup
+            ;;
+
+        prune-delta-store)
+            # prune-delta-store [--dry-run] [--force] <store-dir> <dedup-file|dir>...
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "--dry-run --force $global_opts" -- "$cur"))
+                return
+            fi
+            _filedir
+            ;;
+
+        index-cache)
+            # index-cache list | prune [--all] [--dry-run] | build [--playlist NAME] [--title N] <source-dir>...
+            local sub="" j
+            for ((j=i+1; j < cword; j++)); do
+                if [[ "${words[j]}" != -* ]]; then
+                    sub="${words[j]}"
+                    break
+                fi
+            done
+            case "$sub" in
+                "")
+                    COMPREPLY=($(compgen -W "list prune build" -- "$cur"))
+                    ;;
+                prune)
+                    COMPREPLY=($(compgen -W "--all --dry-run" -- "$cur"))
+                    ;;
+                build)
+                    if [[ "$cur" == -* ]]; then
+                        COMPREPLY=($(compgen -W "--playlist --title" -- "$cur"))
+                        return
+                    fi
+                    case "$prev" in
+                        --playlist|--title)
+                            return
+                            ;;
+                    esac
+                    _filedir -d
+                    ;;
+            esac
+            ;;
+
         parse-mkv)
             # parse-mkv <mkv-file>
             _filedir '@(mkv|MKV)'
@@ -14,9 +14,9 @@ function __fish_mkvdup_needs_command
             continue
         end
         switch $i
-            case '-v' '--verbose' '-q' '--quiet' '--no-progress' '--log-verbose' '-h' '--help' '--version'
+            case '-v' '--verbose' '-q' '--quiet' '--no-progress' '--log-verbose' '--no-index-cache' '-h' '--help' '--version'
                 continue
-            case '--log-file'
+            case '--log-file' '--index-cache' '--max-index-memory' '--index-workers'
                 set skip_next 1
                 continue
             case '-*'
@@ -38,9 +38,9 @@ function __fish_mkvdup_using_command
             continue
         end
         switch $i
-            case '-v' '--verbose' '-q' '--quiet' '--no-progress' '--log-verbose' '-h' '--help' '--version'
+            case '-v' '--verbose' '-q' '--quiet' '--no-progress' '--log-verbose' '--no-index-cache' '-h' '--help' '--version'
                 continue
-            case '--log-file'
+            case '--log-file' '--index-cache' '--max-index-memory' '--index-workers'
                 set skip_next 1
                 continue
             case '-*'
@@ -66,6 +66,10 @@ complete -c $cmd -n __fish_mkvdup_needs_command -s q -l quiet -d 'Suppress infor
 complete -c $cmd -n __fish_mkvdup_needs_command -l no-progress -d 'Disable progress bars'
 complete -c $cmd -n __fish_mkvdup_needs_command -l log-file -d 'Duplicate output to a log file' -r
 complete -c $cmd -n __fish_mkvdup_needs_command -l log-verbose -d 'Enable verbose output in log file only'
+complete -c $cmd -n __fish_mkvdup_needs_command -l index-cache -d 'Cache source indexes in a directory' -xa '(__fish_complete_directories)'
+complete -c $cmd -n __fish_mkvdup_needs_command -l no-index-cache -d 'Always index sources from scratch'
+complete -c $cmd -n __fish_mkvdup_needs_command -l max-index-memory -d 'Limit source index memory (e.g. 2G)' -xa 'auto unlimited'
+complete -c $cmd -n __fish_mkvdup_needs_command -l index-workers -d 'Index up to N source files at once' -xa 'auto'
 complete -c $cmd -n __fish_mkvdup_needs_command -s h -l help -d 'Show help'
 complete -c $cmd -n __fish_mkvdup_needs_command -l version -d 'Show version'
 
@@ -83,6 +87,10 @@ complete -c $cmd -n __fish_mkvdup_needs_command -a validate -d 'Validate configu
 complete -c $cmd -n __fish_mkvdup_needs_command -a reload -d 'Reload a running daemon configuration'
 complete -c $cmd -n __fish_mkvdup_needs_command -a expand-config -d 'Expand wildcard config to explicit file list'
 complete -c $cmd -n __fish_mkvdup_needs_command -a relocate -d 'Move dedup file + sidecar, updating paths'
+complete -c $cmd -n __fish_mkvdup_needs_command -a upgrade -d 'Rewrite dedup files in the newest format version'
+complete -c $cmd -n __fish_mkvdup_needs_command -a repair -d 'Locate and repair damage in a dedup file'
+complete -c $cmd -n __fish_mkvdup_needs_command -a prune-delta-store -d 'Remove delta store chunks no dedup file uses'
+complete -c $cmd -n __fish_mkvdup_needs_command -a index-cache -d 'List, prune or prebuild cached source indexes'
 complete -c $cmd -n __fish_mkvdup_needs_command -a parse-mkv -d 'Parse and display MKV structure (debug)'
 complete -c $cmd -n __fish_mkvdup_needs_command -a index-source -d 'Index a source directory (debug)'
 complete -c $cmd -n __fish_mkvdup_needs_command -a match -d 'Match packets between MKV and source (debug)'
@@ -95,6 +103,11 @@ complete -c $cmd -n '__fish_mkvdup_using_command create' -s q -l quiet -d 'Suppr
 complete -c $cmd -n '__fish_mkvdup_using_command create' -l no-progress -d 'Disable progress bars'
 complete -c $cmd -n '__fish_mkvdup_using_command create' -l warn-threshold -d 'Minimum space savings percentage' -x
 complete -c $cmd -n '__fish_mkvdup_using_command create' -l non-interactive -d 'Do not prompt on codec mismatch'
+complete -c $cmd -n '__fish_mkvdup_using_command create' -l all-streams -d 'Index every source stream'
+complete -c $cmd -n '__fish_mkvdup_using_command create' -l checkpoint -d 'Record the progress of matching'
+complete -c $cmd -n '__fish_mkvdup_using_command create' -l resume -d 'Resume an interrupted create'
+complete -c $cmd -n '__fish_mkvdup_using_command create' -l checksum -d 'Also store cryptographic checksums' -xa 'sha256 blake3 sha512 sha1'
+complete -c $cmd -n '__fish_mkvdup_using_command create' -l delta-store -d 'Keep the delta in a shared delta store' -xa '(__fish_complete_directories)'
 complete -c $cmd -n '__fish_mkvdup_using_command create' -F -d 'MKV file or source directory'
 
 # batch-create options
@@ -103,6 +116,8 @@ complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -s q -l quiet -d
 complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -l no-progress -d 'Disable progress bars'
 complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -l warn-threshold -d 'Minimum space savings percentage' -x
 complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -l skip-codec-mismatch -d 'Skip MKVs with codec mismatch'
+complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -l checksum -d 'Also store cryptographic checksums' -xa 'sha256 blake3 sha512 sha1'
+complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -l delta-store -d 'Keep the deltas in a shared delta store' -xa '(__fish_complete_directories)'
 complete -c $cmd -n '__fish_mkvdup_using_command batch-create' -F -d 'Manifest file'
 
 # probe options
@@ -173,6 +188,34 @@ complete -c $cmd -n '__fish_mkvdup_using_command relocate' -l dry-run -d 'Previe
 complete -c $cmd -n '__fish_mkvdup_using_command relocate' -l force -d 'Overwrite destination if it already exists'
 complete -c $cmd -n '__fish_mkvdup_using_command relocate' -F -d 'Dedup file or destination'
 
+# upgrade options
+complete -c $cmd -n '__fish_mkvdup_using_command upgrade' -l dry-run -d 'Report which files would be upgraded'
+complete -c $cmd -n '__fish_mkvdup_using_command upgrade' -l config-dir -d 'Upgrade the dedup files named by a config directory'
+complete -c $cmd -n '__fish_mkvdup_using_command upgrade' -l source-dir -d 'Source directory of the dedup files' -xa '(__fish_complete_directories)'
+complete -c $cmd -n '__fish_mkvdup_using_command upgrade' -F -d 'Dedup file or config directory'
+
+# repair options
+complete -c $cmd -n '__fish_mkvdup_using_command repair' -l from-mkv -d 'Original MKV or a copy reconstructed from it' -r -F
+complete -c $cmd -n '__fish_mkvdup_using_command repair' -l from-dedup -d 'Backup of the dedup file' -r -F
+complete -c $cmd -n '__fish_mkvdup_using_command repair' -l source-dir -d 'Source directory of the dedup file' -xa '(__fish_complete_directories)'
+complete -c $cmd -n '__fish_mkvdup_using_command repair' -l dry-run -d 'Report the damage and what would be repaired'
+complete -c $cmd -n '__fish_mkvdup_using_command repair' -F -d 'Dedup file'
+
+# prune-delta-store options
+complete -c $cmd -n '__fish_mkvdup_using_command prune-delta-store' -l dry-run -d 'Report what would be removed'
+complete -c $cmd -n '__fish_mkvdup_using_command prune-delta-store' -l force -d 'Prune even if some files use another store'
+complete -c $cmd -n '__fish_mkvdup_using_command prune-delta-store' -F -d 'Delta store, dedup file or directory'
+
+# index-cache subcommands and options
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and not __fish_seen_subcommand_from list prune build' -a list -d 'Show cached indexes and whether they are valid'
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and not __fish_seen_subcommand_from list prune build' -a prune -d 'Remove indexes whose source has changed or is gone'
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and not __fish_seen_subcommand_from list prune build' -a build -d 'Index sources ahead of time'
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and __fish_seen_subcommand_from prune' -l all -d 'Remove every cached index'
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and __fish_seen_subcommand_from prune' -l dry-run -d 'Report what would be removed'
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and __fish_seen_subcommand_from build' -l playlist -d 'Index only a Blu-ray playlist' -x
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and __fish_seen_subcommand_from build' -l title -d 'Index only a DVD title' -x
+complete -c $cmd -n '__fish_mkvdup_using_command index-cache; and __fish_seen_subcommand_from build' -xa '(__fish_complete_directories)'
+
 # parse-mkv options
 complete -c $cmd -n '__fish_mkvdup_using_command parse-mkv' -F -d 'MKV file'
 
@@ -187,6 +230,6 @@ complete -c $cmd -n '__fish_mkvdup_using_command deltadiag' -s v -l verbose -d '
 complete -c $cmd -n '__fish_mkvdup_using_command deltadiag' -F -d 'Dedup file or MKV file'
 
 # help - complete with subcommand names
-complete -c $cmd -n '__fish_mkvdup_using_command help' -a 'create batch-create probe mount info verify extract check stats validate reload expand-config relocate parse-mkv index-source match deltadiag' -d 'Command'
+complete -c $cmd -n '__fish_mkvdup_using_command help' -a 'create batch-create probe mount info verify extract check stats validate reload expand-config relocate upgrade repair prune-delta-store index-cache parse-mkv index-source match deltadiag' -d 'Command'
 
 end # for cmd